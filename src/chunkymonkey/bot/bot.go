@@ -0,0 +1,360 @@
+// The bot package is a headless client, for putting synthetic load on a
+// server. A bot logs in, answers keep-alives, walks about at random, chats and
+// digs now and then, and keeps track of what the server has sent it.
+package bot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	"chunkymonkey/proto"
+	"chunkymonkey/testconn"
+	. "chunkymonkey/types"
+)
+
+// stance is the height of the bot's eyes above its feet.
+const stance = AbsCoord(1.62)
+
+var (
+	errNotPlaced = errors.New("Not placed in the world.")
+	errLogin     = errors.New("Unexpected reply to login.")
+)
+
+// Config sets how a bot behaves.
+type Config struct {
+	Username string
+
+	// MoveInterval is the time between position updates.
+	MoveInterval time.Duration
+	// StepSize is the furthest the bot moves along each of X and Z in one
+	// step. It must be small enough for the server to accept the move.
+	StepSize AbsCoord
+	// WalkRadius is how far from where it was placed that the bot may walk.
+	WalkRadius AbsCoord
+
+	// Chances that the bot chats, or digs the block beneath it, on each step.
+	ChatChance float64
+	DigChance  float64
+
+	// PlaceTimeout is how long to wait to be placed in the world after
+	// logging in.
+	PlaceTimeout time.Duration
+
+	Seed int64
+}
+
+// DefaultConfig returns a config for a bot that walks at about walking pace
+// near the spawn point.
+func DefaultConfig(username string) *Config {
+	return &Config{
+		Username:     username,
+		MoveInterval: 250 * time.Millisecond,
+		StepSize:     1,
+		WalkRadius:   32,
+		ChatChance:   0.01,
+		DigChance:    0.01,
+		PlaceTimeout: 30 * time.Second,
+		Seed:         time.Now().UnixNano(),
+	}
+}
+
+// Stats are what a bot has measured of the server.
+type Stats struct {
+	LoginLatency    time.Duration   // From handshake to login reply.
+	PlaceLatency    time.Duration   // From login reply to being placed.
+	ChatLatencies   []time.Duration // From sending each chat to it being echoed.
+	PacketsSent     int64
+	PacketsReceived int64
+	KeepAlives      int64 // Keep-alives answered.
+	Chunks          int   // Chunks currently loaded.
+	Entities        int   // Other entities currently known of.
+	Disconnect      string
+}
+
+// Bot is a client connected to a server.
+type Bot struct {
+	config *Config
+	conn   io.ReadWriteCloser
+	rand   *rand.Rand
+
+	sendLock sync.Mutex
+
+	// The following are used by the receive loop, and guarded by lock.
+	lock        sync.Mutex
+	entityId    EntityId
+	position    AbsXyz
+	start       AbsXyz
+	placed      chan bool // Closed when first placed.
+	hasPosition bool
+	chunks      map[ChunkXz]bool
+	entities    map[EntityId]bool
+	chats       map[string]time.Time // Chats sent, awaiting their echo.
+	stats       Stats
+	rxErr       error
+	rxDone      chan bool
+}
+
+// New creates a bot that will connect over conn.
+func New(conn io.ReadWriteCloser, config *Config) *Bot {
+	return &Bot{
+		config:   config,
+		conn:     conn,
+		rand:     rand.New(rand.NewSource(config.Seed)),
+		placed:   make(chan bool),
+		chunks:   make(map[ChunkXz]bool),
+		entities: make(map[EntityId]bool),
+		chats:    make(map[string]time.Time),
+		rxDone:   make(chan bool),
+	}
+}
+
+// Login logs in to a server that isn't checking logins with minecraft.net,
+// and waits until the bot is placed in the world.
+func (bot *Bot) Login() (err error) {
+	start := time.Now()
+	if err = bot.send(func(w io.Writer) error { return proto.ClientWriteHandshake(w, bot.config.Username) }); err != nil {
+		return
+	}
+	if err = bot.expect(proto.PacketIdHandshake); err != nil {
+		return
+	}
+
+	if err = bot.send(func(w io.Writer) error { return proto.ClientWriteLogin(w, bot.config.Username, "") }); err != nil {
+		return
+	}
+	if err = bot.expect(proto.PacketIdLogin); err != nil {
+		return
+	}
+	loggedIn := time.Now()
+	bot.stats.LoginLatency = loggedIn.Sub(start)
+
+	go bot.receiveLoop()
+
+	select {
+	case <-bot.placed:
+		bot.lock.Lock()
+		bot.stats.PlaceLatency = time.Since(loggedIn)
+		bot.lock.Unlock()
+		return nil
+	case <-bot.rxDone:
+		return bot.rxErr
+	case <-time.After(bot.config.PlaceTimeout):
+		return errNotPlaced
+	}
+}
+
+// expect reads the next packet during login, which must have the given ID.
+func (bot *Bot) expect(id byte) (err error) {
+	packet, err := testconn.ReadPacket(bot.conn)
+	if err != nil {
+		return
+	}
+	bot.stats.PacketsReceived++
+
+	switch {
+	case packet.Id == proto.PacketIdDisconnect:
+		return fmt.Errorf("Disconnected: %v", packet.Args[0])
+	case packet.Id != id:
+		return errLogin
+	case id == proto.PacketIdLogin:
+		bot.entityId, _ = packet.EntityId()
+	}
+	return
+}
+
+// Run walks the bot about until stop is closed, or the connection fails.
+func (bot *Bot) Run(stop <-chan bool) (err error) {
+	ticker := time.NewTicker(bot.config.MoveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-bot.rxDone:
+			return bot.rxErr
+		case <-ticker.C:
+			if err = bot.step(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Close disconnects the bot.
+func (bot *Bot) Close() error {
+	return bot.conn.Close()
+}
+
+// Stats returns what the bot has measured so far.
+func (bot *Bot) Stats() (stats Stats) {
+	bot.lock.Lock()
+	defer bot.lock.Unlock()
+
+	stats = bot.stats
+	stats.ChatLatencies = append([]time.Duration(nil), bot.stats.ChatLatencies...)
+	stats.Chunks = len(bot.chunks)
+	stats.Entities = len(bot.entities)
+	return
+}
+
+// step takes one step of the random walk, and maybe chats or digs.
+func (bot *Bot) step() error {
+	bot.lock.Lock()
+	position := bot.position
+	start := bot.start
+	bot.lock.Unlock()
+
+	position.X = bot.walk(position.X, start.X)
+	position.Z = bot.walk(position.Z, start.Z)
+
+	buf := new(bytes.Buffer)
+	proto.WritePlayerPosition(buf, &position, position.Y+stance, true)
+	packets := 1
+
+	if bot.rand.Float64() < bot.config.ChatChance {
+		message := fmt.Sprintf("%s %d", bot.config.Username, bot.rand.Int31())
+		bot.lock.Lock()
+		bot.chats[fmt.Sprintf("<%s> %s", bot.config.Username, message)] = time.Now()
+		bot.lock.Unlock()
+		proto.WriteChatMessage(buf, message)
+		packets++
+	}
+
+	if bot.rand.Float64() < bot.config.DigChance {
+		below := position.ToBlockXyz().AddXyz(0, -1, 0)
+		if below != nil {
+			proto.WritePlayerBlockHit(buf, DigStarted, below, FaceTop)
+			proto.WritePlayerBlockHit(buf, DigBlockBroke, below, FaceTop)
+			packets += 2
+		}
+	}
+
+	bot.lock.Lock()
+	bot.position = position
+	bot.stats.PacketsSent += int64(packets)
+	bot.lock.Unlock()
+
+	return bot.write(buf.Bytes())
+}
+
+// walk moves coord by up to StepSize, keeping it within WalkRadius of start.
+func (bot *Bot) walk(coord, start AbsCoord) AbsCoord {
+	coord += AbsCoord(bot.rand.Float64()*2-1) * bot.config.StepSize
+	if coord > start+bot.config.WalkRadius {
+		coord = start + bot.config.WalkRadius
+	} else if coord < start-bot.config.WalkRadius {
+		coord = start - bot.config.WalkRadius
+	}
+	return coord
+}
+
+// send writes a packet to the server.
+func (bot *Bot) send(write func(w io.Writer) error) error {
+	buf := new(bytes.Buffer)
+	if err := write(buf); err != nil {
+		return err
+	}
+	bot.lock.Lock()
+	bot.stats.PacketsSent++
+	bot.lock.Unlock()
+	return bot.write(buf.Bytes())
+}
+
+func (bot *Bot) write(packets []byte) (err error) {
+	bot.sendLock.Lock()
+	defer bot.sendLock.Unlock()
+	_, err = bot.conn.Write(packets)
+	return
+}
+
+func (bot *Bot) receiveLoop() {
+	defer close(bot.rxDone)
+
+	for {
+		packet, err := testconn.ReadPacket(bot.conn)
+		if err != nil {
+			bot.rxErr = err
+			return
+		}
+		reply, err := bot.received(packet)
+		if err != nil {
+			bot.rxErr = err
+			return
+		}
+		if len(reply) > 0 {
+			if err = bot.write(reply); err != nil {
+				bot.rxErr = err
+				return
+			}
+		}
+	}
+}
+
+// received keeps track of what the server has sent, and returns the reply
+// where the client must make one.
+func (bot *Bot) received(packet *testconn.Packet) (reply []byte, err error) {
+	bot.lock.Lock()
+	defer bot.lock.Unlock()
+
+	bot.stats.PacketsReceived++
+	args := packet.Args
+	buf := new(bytes.Buffer)
+
+	switch packet.Id {
+	case proto.PacketIdKeepAlive:
+		bot.stats.KeepAlives++
+		proto.WriteKeepAlive(buf, args[0].(int32))
+
+	case proto.PacketIdPlayerPositionLook:
+		// The server moves the bot, which must confirm its new position.
+		bot.position = *args[0].(*AbsXyz)
+		if !bot.hasPosition {
+			bot.hasPosition = true
+			bot.start = bot.position
+			close(bot.placed)
+		}
+		proto.ClientWritePlayerPositionLook(buf, &bot.position, args[1].(AbsCoord), args[3].(*LookDegrees), true)
+
+	case proto.PacketIdChatMessage:
+		message := args[0].(string)
+		if sent, ok := bot.chats[message]; ok {
+			bot.stats.ChatLatencies = append(bot.stats.ChatLatencies, time.Since(sent))
+			delete(bot.chats, message)
+		}
+
+	case proto.PacketIdPreChunk:
+		chunkLoc, mode := *args[0].(*ChunkXz), args[1].(ChunkLoadMode)
+		if mode == ChunkUnload {
+			delete(bot.chunks, chunkLoc)
+		} else {
+			bot.chunks[chunkLoc] = true
+		}
+
+	case proto.PacketIdNamedEntitySpawn, proto.PacketIdEntitySpawn,
+		proto.PacketIdItemSpawn, proto.PacketIdObjectSpawn,
+		proto.PacketIdPaintingSpawn, proto.PacketIdExperienceOrb:
+		if entityId, ok := packet.EntityId(); ok && entityId != bot.entityId {
+			bot.entities[entityId] = true
+		}
+
+	case proto.PacketIdEntityDestroy:
+		if entityId, ok := packet.EntityId(); ok {
+			delete(bot.entities, entityId)
+		}
+
+	case proto.PacketIdDisconnect:
+		bot.stats.Disconnect = args[0].(string)
+		return nil, fmt.Errorf("Disconnected: %s", bot.stats.Disconnect)
+	}
+
+	if buf.Len() > 0 {
+		bot.stats.PacketsSent++
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,119 @@
+package bot
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"chunkymonkey/proto"
+	"chunkymonkey/testconn"
+	. "chunkymonkey/types"
+)
+
+// expectSent reads from the server end of the connection what write would
+// have written, and fails the test if the bot sent anything else.
+func expectSent(t *testing.T, server io.Reader, what string, write func(w io.Writer) error) {
+	expected := new(bytes.Buffer)
+	write(expected)
+
+	got := make([]byte, expected.Len())
+	if _, err := io.ReadFull(server, got); err != nil {
+		t.Fatalf("Reading %s: %v", what, err)
+	}
+	if !bytes.Equal(got, expected.Bytes()) {
+		t.Fatalf("Expected %s % x, got % x", what, expected.Bytes(), got)
+	}
+}
+
+func TestBot(t *testing.T) {
+	server, client := testconn.Pipe()
+	defer server.Close()
+
+	config := DefaultConfig("bot")
+	config.PlaceTimeout = 10 * time.Second
+	bot := New(client, config)
+	defer bot.Close()
+
+	position := AbsXyz{8, 65, 8}
+	look := LookDegrees{0, 0}
+	proto.ServerWriteHandshake(server, "-")
+	proto.ServerWriteLogin(server, 7, 0, 0, 0, 0, 128, 8)
+	proto.ServerWritePlayerPositionLook(server, &position, position.Y+stance, &look, false)
+
+	if err := bot.Login(); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	expectSent(t, server, "handshake", func(w io.Writer) error { return proto.ClientWriteHandshake(w, "bot") })
+	expectSent(t, server, "login", func(w io.Writer) error { return proto.ClientWriteLogin(w, "bot", "") })
+	expectSent(t, server, "position confirmation", func(w io.Writer) error {
+		return proto.ClientWritePlayerPositionLook(w, &position, position.Y+stance, &look, true)
+	})
+
+	proto.WritePreChunk(server, &ChunkXz{0, 0}, ChunkInit)
+	proto.WritePreChunk(server, &ChunkXz{1, 0}, ChunkInit)
+	proto.WriteNamedEntitySpawn(server, 7, "bot", &AbsIntXyz{}, &LookBytes{}, 0)
+	proto.WriteNamedEntitySpawn(server, 8, "alice", &AbsIntXyz{}, &LookBytes{}, 0)
+	proto.WriteNamedEntitySpawn(server, 9, "bob", &AbsIntXyz{}, &LookBytes{}, 0)
+	proto.WritePreChunk(server, &ChunkXz{1, 0}, ChunkUnload)
+	proto.WriteEntityDestroy(server, 9)
+	proto.WriteKeepAlive(server, 1234)
+
+	expectSent(t, server, "keep-alive", func(w io.Writer) error { return proto.WriteKeepAlive(w, 1234) })
+
+	stats := bot.Stats()
+	if stats.KeepAlives != 1 {
+		t.Errorf("Expected 1 keep-alive answered, got %d", stats.KeepAlives)
+	}
+	if stats.Chunks != 1 {
+		t.Errorf("Expected 1 chunk loaded, got %d", stats.Chunks)
+	}
+	if stats.Entities != 1 {
+		t.Errorf("Expected 1 other entity, got %d", stats.Entities)
+	}
+	if stats.PacketsSent != 4 || stats.PacketsReceived != 11 {
+		t.Errorf("Expected 4 packets sent and 11 received, got %d and %d", stats.PacketsSent, stats.PacketsReceived)
+	}
+}
+
+func TestBot_Disconnected(t *testing.T) {
+	server, client := testconn.Pipe()
+	defer server.Close()
+
+	bot := New(client, DefaultConfig("bot"))
+	defer bot.Close()
+
+	proto.ServerWriteHandshake(server, "-")
+	proto.WriteDisconnect(server, "Go away")
+
+	if err := bot.Login(); err == nil {
+		t.Errorf("Expected login to fail")
+	}
+}
+
+func TestBot_Walk(t *testing.T) {
+	type Test struct {
+		coord, start AbsCoord
+	}
+
+	var tests = []Test{
+		{0, 0},
+		{32, 0},
+		{-32, 0},
+		{100, 90},
+	}
+
+	bot := New(nil, DefaultConfig("bot"))
+	for _, test := range tests {
+		for i := 0; i < 100; i++ {
+			coord := bot.walk(test.coord, test.start)
+			if coord-test.coord > bot.config.StepSize || test.coord-coord > bot.config.StepSize {
+				t.Errorf("walk(%v, %v) stepped too far, to %v", test.coord, test.start, coord)
+			}
+			if coord-test.start > bot.config.WalkRadius || test.start-coord > bot.config.WalkRadius {
+				t.Errorf("walk(%v, %v) walked too far, to %v", test.coord, test.start, coord)
+			}
+		}
+	}
+}
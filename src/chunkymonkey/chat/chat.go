@@ -0,0 +1,117 @@
+// Package chat formats the messages shown in players' chat consoles. All chat
+// sent by the server is formatted here, according to its kind.
+package chat
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"chunkymonkey/proto"
+)
+
+// MaxLength is the longest chat message, in characters, that clients show on
+// a single line. Longer messages are split over several.
+const MaxLength = 119
+
+// colorTag starts a color code, which is followed by the color's character.
+const colorTag = '§'
+
+// Kind is the kind of a chat message, which decides how it looks.
+type Kind byte
+
+const (
+	// Player is a player talking in chat.
+	Player = Kind(iota)
+	// Action is a player describing what they are doing, with /me.
+	Action
+	// Announcement is a message from the server to all players.
+	Announcement
+	// Reply is a message from the server to a player, such as a command's
+	// reply.
+	Reply
+	// Private is a message from one player to another.
+	Private
+)
+
+// template is how messages of a kind look. Its prefix has "%s" replaced by
+// the name of who the message is from.
+type template struct {
+	color  string // Continues onto each line of a split message.
+	prefix string
+}
+
+var templates = map[Kind]template{
+	Player:       {"", "<%s> "},
+	Action:       {"", "* %s "},
+	Announcement: {"§d", ""},
+	Reply:        {"", ""},
+	Private:      {"§7", "%s whispers "},
+}
+
+// Format returns the lines of chat that show the message, of the kind and
+// from the named player or sender.
+func Format(kind Kind, from, message string) (lines []string) {
+	t := templates[kind]
+	text := t.color + strings.Replace(t.prefix, "%s", from, 1) + message
+	return split([]rune(text), []rune(t.color))
+}
+
+// split breaks text into lines of at most MaxLength characters, at spaces
+// where possible. Lines after the first start with color. Color codes are
+// never left at the end of a line, where clients would refuse them.
+func split(text, color []rune) (lines []string) {
+	for len(text) > MaxLength {
+		cut := MaxLength
+		for i := MaxLength; i > len(color); i-- {
+			if text[i] == ' ' {
+				cut = i
+				break
+			}
+		}
+		line := trimSpaces(text[:cut])
+		for len(line) > len(color)+2 && line[len(line)-2] == colorTag {
+			line = trimSpaces(line[:len(line)-2])
+			cut = len(line)
+		}
+		if len(line) > len(color)+1 && line[len(line)-1] == colorTag {
+			line = line[:len(line)-1]
+			cut = len(line)
+		}
+		lines = append(lines, string(line))
+
+		rest := text[cut:]
+		for len(rest) > 0 && rest[0] == ' ' {
+			rest = rest[1:]
+		}
+		text = append(append([]rune{}, color...), rest...)
+	}
+	return append(lines, string(text))
+}
+
+func trimSpaces(text []rune) []rune {
+	for len(text) > 0 && text[len(text)-1] == ' ' {
+		text = text[:len(text)-1]
+	}
+	return text
+}
+
+// Write writes the chat message packets that show the message.
+func Write(writer io.Writer, kind Kind, from, message string) (err error) {
+	for _, line := range Format(kind, from, message) {
+		if err = proto.WriteChatMessage(writer, line); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Packet returns the chat message packets that show the message, or nil if
+// the message can't be sent.
+func Packet(kind Kind, from, message string) []byte {
+	buf := new(bytes.Buffer)
+	if err := Write(buf, kind, from, message); err != nil {
+		return nil
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,81 @@
+package chat
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"chunkymonkey/proto"
+)
+
+func TestFormat(t *testing.T) {
+	// 30 words of 4 characters make a 149 character message.
+	long := strings.TrimSpace(strings.Repeat("wave ", 30))
+
+	type Test struct {
+		desc     string
+		kind     Kind
+		from     string
+		message  string
+		expected []string
+	}
+
+	var tests = []Test{
+		{"player", Player, "Steve", "hello", []string{"<Steve> hello"}},
+		{"action", Action, "Steve", "waves", []string{"* Steve waves"}},
+		{"announcement", Announcement, "Console", "restart soon", []string{"§drestart soon"}},
+		{"reply", Reply, "", "Ping: 42ms", []string{"Ping: 42ms"}},
+		{"private", Private, "Alex", "psst", []string{"§7Alex whispers psst"}},
+		{
+			"long action",
+			Action, "Steve", long,
+			[]string{
+				"* Steve " + strings.TrimSpace(strings.Repeat("wave ", 22)),
+				strings.TrimSpace(strings.Repeat("wave ", 8)),
+			},
+		},
+		{
+			"long announcement keeps its color",
+			Announcement, "", long,
+			[]string{
+				"§d" + strings.TrimSpace(strings.Repeat("wave ", 23)),
+				"§d" + strings.TrimSpace(strings.Repeat("wave ", 7)),
+			},
+		},
+		{
+			"unbroken",
+			Reply, "", strings.Repeat("x", 200),
+			[]string{strings.Repeat("x", MaxLength), strings.Repeat("x", 200-MaxLength)},
+		},
+		{
+			"color code not left at end of line",
+			Reply, "", strings.Repeat("x", MaxLength-2) + "§cyz",
+			[]string{strings.Repeat("x", MaxLength-2), "§cyz"},
+		},
+	}
+
+	for _, test := range tests {
+		lines := Format(test.kind, test.from, test.message)
+		if strings.Join(lines, "\n") != strings.Join(test.expected, "\n") {
+			t.Errorf("%s: expected %q, got %q", test.desc, test.expected, lines)
+		}
+		for _, line := range lines {
+			if n := len([]rune(line)); n > MaxLength {
+				t.Errorf("%s: line of %d characters is too long: %q", test.desc, n, line)
+			}
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := Write(buf, Action, "Steve", "waves"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := new(bytes.Buffer)
+	proto.WriteChatMessage(expected, "* Steve waves")
+	if !bytes.Equal(buf.Bytes(), expected.Bytes()) {
+		t.Errorf("Expected %x, got %x", expected.Bytes(), buf.Bytes())
+	}
+}
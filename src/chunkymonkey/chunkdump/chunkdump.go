@@ -0,0 +1,232 @@
+// The chunkdump package summarises the contents of chunks read from a world's
+// chunk store, for debugging generation and persistence without a client.
+package chunkdump
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"chunkymonkey/chunkstore"
+	. "chunkymonkey/types"
+	"chunkymonkey/worldstore"
+)
+
+var ErrBadSlice = errors.New("Slice is outside of the chunk.")
+
+// LoadChunk reads a chunk from the world's chunk store for the dimension. No
+// chunk is generated if it isn't there. The error is a NoSuchChunkError if
+// the chunk doesn't exist, or a *ChunkLoadError if it couldn't be read.
+func LoadChunk(worldPath string, loc ChunkXz, dimension DimensionId) (reader chunkstore.IChunkReader, err error) {
+	world, err := worldstore.LoadWorldStore(worldPath)
+	if err != nil {
+		return
+	}
+
+	store, err := world.ChunkStoreForDimension(dimension)
+	if err != nil {
+		return
+	}
+
+	result := <-store.ReadChunk(loc)
+	return result.Reader, result.Err
+}
+
+// DescribeError explains an error from LoadChunk, telling a missing chunk
+// apart from one that is corrupt or couldn't be read.
+func DescribeError(loc ChunkXz, err error) string {
+	if version, ok := err.(chunkstore.UnknownLevelVersion); ok {
+		return fmt.Sprintf("Unsupported world format: level version %d.", int32(version))
+	}
+
+	switch {
+	case chunkstore.IsNoSuchChunk(err):
+		return fmt.Sprintf("Not found: chunk %d,%d does not exist in the world.", loc.X, loc.Z)
+	case chunkstore.IsCorruptChunk(err):
+		return fmt.Sprintf("Corrupt: %v", err)
+	}
+	if _, ok := err.(*chunkstore.ChunkLoadError); ok {
+		return fmt.Sprintf("Load failed: %v", err)
+	}
+	return fmt.Sprintf("Error: %v", err)
+}
+
+// blockAt returns the ID of a block in the chunk.
+func blockAt(reader chunkstore.IChunkReader, x, y, z int) BlockId {
+	subLoc := SubChunkXyz{SubChunkCoord(x), SubChunkCoord(y), SubChunkCoord(z)}
+	index, _ := subLoc.BlockIndex()
+	return index.BlockId(reader.Blocks())
+}
+
+// LayerHistogram counts the blocks of each type in each layer of the chunk,
+// indexed by Y.
+func LayerHistogram(reader chunkstore.IChunkReader) (layers [ChunkSizeY]map[BlockId]int) {
+	for y := range layers {
+		layers[y] = make(map[BlockId]int)
+	}
+	for index, id := range reader.Blocks() {
+		layers[BlockIndex(index).ToSubChunkXyz().Y][BlockId(id)]++
+	}
+	return
+}
+
+// sortedIds returns the IDs counted in a histogram, in order.
+func sortedIds(counts map[BlockId]int) (ids []BlockId) {
+	for id := range counts {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return
+}
+
+// WriteLayerHistogram writes the histogram of each layer from the top down,
+// leaving out layers that are all air.
+func WriteLayerHistogram(w io.Writer, reader chunkstore.IChunkReader) {
+	layers := LayerHistogram(reader)
+	for y := ChunkSizeY - 1; y >= 0; y-- {
+		if layers[y][BlockIdAir] == ChunkSizeH*ChunkSizeH {
+			continue
+		}
+		fmt.Fprintf(w, "y=%3d:", y)
+		for _, id := range sortedIds(layers[y]) {
+			fmt.Fprintf(w, " %d:%d", id, layers[y][id])
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// Slices that a cross section can be taken along.
+const (
+	SliceY = 'y' // Looking down on a layer, with X across and Z down.
+	SliceZ = 'z' // Looking along Z, with X across and Y up.
+)
+
+// sectionChars are used for block types in cross sections, in order of first
+// appearance. Air is always shown as '.'.
+const sectionChars = "#%@&$*+=~:ox^abcdefghijklmnpqrstuvwyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// WriteCrossSection draws a slice through the chunk at the given Y or Z,
+// followed by a legend of the block types in it.
+func WriteCrossSection(w io.Writer, reader chunkstore.IChunkReader, slice byte, at int) (err error) {
+	var rows, cols int
+	var blockAtRowCol func(row, col int) BlockId
+
+	switch slice {
+	case SliceY:
+		if at < 0 || at >= ChunkSizeY {
+			return ErrBadSlice
+		}
+		rows, cols = ChunkSizeH, ChunkSizeH
+		blockAtRowCol = func(row, col int) BlockId { return blockAt(reader, col, at, row) }
+	case SliceZ:
+		if at < 0 || at >= ChunkSizeH {
+			return ErrBadSlice
+		}
+		rows, cols = ChunkSizeY, ChunkSizeH
+		blockAtRowCol = func(row, col int) BlockId { return blockAt(reader, col, ChunkSizeY-1-row, at) }
+	default:
+		return fmt.Errorf("Unknown slice %q, expected %q or %q.", slice, SliceY, SliceZ)
+	}
+
+	chars := map[BlockId]byte{BlockIdAir: '.'}
+	for row := 0; row < rows; row++ {
+		line := make([]byte, cols)
+		for col := range line {
+			id := blockAtRowCol(row, col)
+			char, ok := chars[id]
+			if !ok {
+				char = '?'
+				if n := len(chars) - 1; n < len(sectionChars) {
+					char = sectionChars[n]
+				}
+				chars[id] = char
+			}
+			line[col] = char
+		}
+		if slice == SliceZ {
+			fmt.Fprintf(w, "%3d %s\n", rows-1-row, line)
+		} else {
+			fmt.Fprintf(w, "%3d %s\n", row, line)
+		}
+	}
+
+	ids := make([]BlockId, 0, len(chars))
+	for id := range chars {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	fmt.Fprint(w, "Legend:")
+	for _, id := range ids {
+		fmt.Fprintf(w, " %c=%d", chars[id], id)
+	}
+	fmt.Fprintln(w)
+	return
+}
+
+// HeightMapStats summarises the chunk's height map.
+type HeightMapStats struct {
+	Min, Max int
+	Mean     float64
+}
+
+// HeightMapSummary returns the range and mean of the chunk's height map.
+func HeightMapSummary(reader chunkstore.IChunkReader) (stats HeightMapStats) {
+	heightMap := reader.HeightMap()
+	if len(heightMap) == 0 {
+		return
+	}
+
+	stats.Min = ChunkSizeY
+	total := 0
+	for _, height := range heightMap {
+		h := int(height)
+		if h < stats.Min {
+			stats.Min = h
+		}
+		if h > stats.Max {
+			stats.Max = h
+		}
+		total += h
+	}
+	stats.Mean = float64(total) / float64(len(heightMap))
+	return
+}
+
+// WriteEntities lists the chunk's entities and tile entities.
+func WriteEntities(w io.Writer, reader chunkstore.IChunkReader) {
+	entities := reader.Entities()
+	fmt.Fprintf(w, "Entities: %d\n", len(entities))
+	for _, entity := range entities {
+		fmt.Fprintf(w, "  %T at %v\n", entity, *entity.Position())
+	}
+
+	tileEntities := reader.TileEntities()
+	fmt.Fprintf(w, "Tile entities: %d\n", len(tileEntities))
+	for _, tileEntity := range tileEntities {
+		fmt.Fprintf(w, "  %T at %v\n", tileEntity, tileEntity.Block())
+	}
+}
+
+// WriteSummary writes all of the summaries of the chunk, with a cross section
+// along the given slice.
+func WriteSummary(w io.Writer, reader chunkstore.IChunkReader, slice byte, at int) (err error) {
+	loc := reader.ChunkLoc()
+	fmt.Fprintf(w, "Chunk %d,%d\n\n", loc.X, loc.Z)
+
+	heights := HeightMapSummary(reader)
+	fmt.Fprintf(w, "Height map: min %d, max %d, mean %.1f\n\n", heights.Min, heights.Max, heights.Mean)
+
+	fmt.Fprintln(w, "Blocks by layer (ID:count):")
+	WriteLayerHistogram(w, reader)
+	fmt.Fprintln(w)
+
+	fmt.Fprintf(w, "Cross section at %c=%d:\n", slice, at)
+	if err = WriteCrossSection(w, reader, slice, at); err != nil {
+		return
+	}
+	fmt.Fprintln(w)
+
+	WriteEntities(w, reader)
+	return
+}
@@ -0,0 +1,103 @@
+package chunkdump
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"chunkymonkey/chunkstore"
+	"chunkymonkey/generation"
+	. "chunkymonkey/types"
+)
+
+func flatgrassChunk(t *testing.T) chunkstore.IChunkReader {
+	reader, err := generation.NewFlatgrassGenerator(generation.SeaLevel).ReadChunk(ChunkXz{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reader
+}
+
+func TestLayerHistogram(t *testing.T) {
+	layers := LayerHistogram(flatgrassChunk(t))
+
+	type Test struct {
+		y  int
+		id BlockId
+	}
+
+	var tests = []Test{
+		{0, 7},
+		{1, 1},
+		{63, 3},
+		{64, 2},
+		{65, BlockIdAir},
+	}
+
+	for _, test := range tests {
+		if count := layers[test.y][test.id]; count != ChunkSizeH*ChunkSizeH || len(layers[test.y]) != 1 {
+			t.Errorf("Layer %d: expected only block %d, got %v", test.y, test.id, layers[test.y])
+		}
+	}
+}
+
+func TestHeightMapSummary(t *testing.T) {
+	expected := HeightMapStats{generation.FlatgrassHeight + 1, generation.FlatgrassHeight + 1, generation.FlatgrassHeight + 1}
+	if stats := HeightMapSummary(flatgrassChunk(t)); stats != expected {
+		t.Errorf("Expected %+v, got %+v", expected, stats)
+	}
+}
+
+func TestWriteCrossSection(t *testing.T) {
+	reader := flatgrassChunk(t)
+
+	type Test struct {
+		slice     byte
+		at        int
+		firstLine string
+		lastLine  string
+	}
+
+	var tests = []Test{
+		{SliceY, 64, "  0 ################", "Legend: .=0 #=2"},
+		{SliceZ, 3, "127 ................", "Legend: .=0 @=1 #=2 %=3 &=7"},
+	}
+
+	for _, test := range tests {
+		buf := new(bytes.Buffer)
+		if err := WriteCrossSection(buf, reader, test.slice, test.at); err != nil {
+			t.Errorf("%c=%d: %v", test.slice, test.at, err)
+			continue
+		}
+		lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+		if lines[0] != test.firstLine || lines[len(lines)-1] != test.lastLine {
+			t.Errorf("%c=%d: expected to start %q and end %q, got:\n%s", test.slice, test.at, test.firstLine, test.lastLine, buf)
+		}
+	}
+
+	if err := WriteCrossSection(new(bytes.Buffer), reader, SliceZ, ChunkSizeH); err != ErrBadSlice {
+		t.Errorf("Expected ErrBadSlice, got %v", err)
+	}
+}
+
+func TestDescribeError(t *testing.T) {
+	loc := ChunkXz{1, 2}
+
+	type Test struct {
+		err    error
+		prefix string
+	}
+
+	var tests = []Test{
+		{chunkstore.NoSuchChunkError(false), "Not found:"},
+		{&chunkstore.ChunkLoadError{loc, &chunkstore.CorruptChunkError{loc, nil}}, "Corrupt:"},
+		{&chunkstore.ChunkLoadError{loc, nil}, "Load failed:"},
+		{chunkstore.UnknownLevelVersion(19133), "Unsupported world format:"},
+	}
+
+	for _, test := range tests {
+		if description := DescribeError(loc, test.err); !strings.HasPrefix(description, test.prefix) {
+			t.Errorf("Expected %T to be described as %q..., got %q", test.err, test.prefix, description)
+		}
+	}
+}
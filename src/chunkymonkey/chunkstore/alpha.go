@@ -2,67 +2,90 @@ package chunkstore
 
 import (
 	"compress/gzip"
-	"errors"
 	"fmt"
 	"os"
 	"path"
 
+	"chunkymonkey/logger"
 	. "chunkymonkey/types"
 	"chunkymonkey/util"
 	"nbt"
 )
 
 type chunkStoreAlpha struct {
-	worldPath string
+	// dimensionPath is the directory containing the chunks of the dimension.
+	dimensionPath string
+
+	// regenerateCorrupt causes corrupt chunks to be quarantined and reported
+	// as not existing.
+	regenerateCorrupt bool
 }
 
 // Creates an IChunkStore that reads the Minecraft Alpha world format.
 func newChunkStoreAlpha(worldPath string, dimension DimensionId) (s *chunkStoreAlpha, err error) {
-	// Don't know the dimension directory structure for alpha, but it's likely
-	// not worth writing support for.
-
 	s = &chunkStoreAlpha{
-		worldPath: worldPath,
+		dimensionPath:     dimensionPath(worldPath, dimension),
+		regenerateCorrupt: *regenerateCorruptChunks,
 	}
 	return s, nil
 }
 
 func (s *chunkStoreAlpha) chunkPath(chunkLoc ChunkXz) string {
 	return path.Join(
-		s.worldPath,
+		s.dimensionPath,
 		base36Encode(int32(chunkLoc.X&63)),
 		base36Encode(int32(chunkLoc.Z&63)),
 		"c."+base36Encode(int32(chunkLoc.X))+"."+base36Encode(int32(chunkLoc.Z))+".dat")
 }
 
 func (s *chunkStoreAlpha) ReadChunk(chunkLoc ChunkXz) (reader IChunkReader, err error) {
+	reader, err = s.readChunk(chunkLoc)
+	if corrupt, ok := err.(*CorruptChunkError); ok && s.regenerateCorrupt {
+		err = s.quarantine(corrupt)
+	}
+	return
+}
+
+// quarantine moves the file of a corrupt chunk into the quarantine directory.
+// NoSuchChunkError is returned if this succeeds, so that the chunk is
+// regenerated.
+func (s *chunkStoreAlpha) quarantine(corrupt *CorruptChunkError) error {
+	filename, err := quarantineFilename(path.Join(s.dimensionPath, "quarantine"), corrupt.ChunkLoc, ".dat")
+	if err == nil {
+		err = os.Rename(s.chunkPath(corrupt.ChunkLoc), filename)
+	}
+	if err != nil {
+		logger.Chunk.Error("Failed to quarantine corrupt chunk", "chunk", corrupt.ChunkLoc, "corrupt", corrupt, "err", err)
+		return corrupt
+	}
+
+	logQuarantine(corrupt, filename)
+	return NoSuchChunkError(false)
+}
+
+func (s *chunkStoreAlpha) readChunk(chunkLoc ChunkXz) (reader IChunkReader, err error) {
 	file, err := os.Open(s.chunkPath(chunkLoc))
 	if err != nil {
-		// TODO: Check if the file is present first.
-		// No errno. Assume it's not there.
-		//if errno, ok := util.Errno(err); ok && errno == os.ENOENT {
-		return nil, NoSuchChunkError(false)
-		//}
+		if os.IsNotExist(err) {
+			return nil, NoSuchChunkError(false)
+		}
+		return
 	}
 	defer file.Close()
 
 	gzipReader, err := gzip.NewReader(file)
 	if err != nil {
-		return
+		return nil, &CorruptChunkError{chunkLoc, err}
 	}
 	defer gzipReader.Close()
-	reader, err = newNbtChunkReader(gzipReader)
-	if err != nil {
-		return
+	if reader, err = newNbtChunkReader(gzipReader); err != nil {
+		return nil, &CorruptChunkError{chunkLoc, err}
 	}
 
 	loadedLoc := reader.ChunkLoc()
 	if loadedLoc.X != chunkLoc.X || loadedLoc.Z != chunkLoc.Z {
-		err = errors.New(fmt.Sprintf(
-			"Attempted to load chunk for %+v, but got chunk identified as %+v",
-			chunkLoc,
-			loadedLoc,
-		))
+		return nil, &CorruptChunkError{chunkLoc, fmt.Errorf(
+			"Chunk identifies itself as %d,%d", loadedLoc.X, loadedLoc.Z)}
 	}
 
 	return
@@ -0,0 +1,412 @@
+package chunkstore
+
+import (
+	"errors"
+	"fmt"
+	"path"
+
+	. "chunkymonkey/types"
+	"nbt"
+)
+
+// anvilLevelVersion is the level.dat version of worlds in the Anvil format.
+const anvilLevelVersion = 19133
+
+const (
+	// Anvil chunks are divided vertically into sections of 16 blocks, each
+	// with its blocks ordered by Y, then Z, then X.
+	anvilSectionHeight = 16
+	anvilSectionBlocks = ChunkSizeH * ChunkSizeH * anvilSectionHeight
+
+	// anvilSections is the number of sections within the height of chunks
+	// here. Sections above are left out when reading, and kept as they are
+	// stored when writing.
+	anvilSections = ChunkSizeY / anvilSectionHeight
+)
+
+// errAnvilPalette is returned for chunks saved by Minecraft 1.13 or later,
+// whose sections store blocks by palette rather than by block ID. These are
+// not corrupt, so are neither quarantined nor regenerated.
+var errAnvilPalette = errors.New("Chunk sections use block palettes, which are not supported.")
+
+// chunkStoreAnvil reads and writes worlds in the Anvil format, which stores
+// chunks in region files as chunkStoreBeta does, but divides each chunk into
+// sections. Chunks are converted to and from the layout used by
+// nbtChunkReader and nbtChunkWriter as they are read and written.
+type chunkStoreAnvil struct {
+	regionPath     string
+	quarantinePath string
+	regions        *regionCache
+
+	// regenerateCorrupt causes corrupt chunks to be quarantined and reported
+	// as not existing.
+	regenerateCorrupt bool
+}
+
+// Creates a chunkStoreAnvil that reads the Minecraft Anvil world format.
+func newChunkStoreAnvil(worldPath string, dimension DimensionId) (s *chunkStoreAnvil, err error) {
+	s = &chunkStoreAnvil{
+		regenerateCorrupt: *regenerateCorruptChunks,
+	}
+
+	// The region directory is created by the regionCache when first written
+	// to.
+	s.regionPath = path.Join(dimensionPath(worldPath, dimension), "region")
+	s.quarantinePath = path.Join(path.Dir(s.regionPath), "quarantine")
+	s.regions = newRegionCache(s.regionPath, anvilFileExt, *maxOpenRegionFiles)
+
+	return
+}
+
+func (s *chunkStoreAnvil) ReadChunk(chunkLoc ChunkXz) (reader IChunkReader, err error) {
+	entry, err := s.regions.acquire(regionLocForChunkXz(chunkLoc), false)
+	if err != nil {
+		return
+	}
+	defer s.regions.release(entry)
+
+	chunkReader, err := s.readChunkData(entry.rf, chunkLoc)
+	if err != nil {
+		if corrupt, ok := err.(*CorruptChunkError); ok && s.regenerateCorrupt {
+			err = quarantineRegionChunk(s.quarantinePath, entry.rf, corrupt)
+		}
+		return
+	}
+
+	return chunkReader, nil
+}
+
+func (s *chunkStoreAnvil) readChunkData(rf *regionFile, chunkLoc ChunkXz) (r *nbtChunkReader, err error) {
+	anvilTag, err := rf.ReadChunkLevelTags(chunkLoc, anvilLevelTags)
+	if err != nil {
+		return
+	}
+
+	chunkTag, err := chunkTagFromAnvil(anvilTag)
+	if err == errAnvilPalette {
+		return
+	} else if err != nil {
+		return nil, &CorruptChunkError{chunkLoc, err}
+	}
+
+	if r, err = nbtChunkReaderForTag(chunkTag); err != nil {
+		return nil, &CorruptChunkError{chunkLoc, err}
+	}
+
+	if loadedLoc := r.ChunkLoc(); loadedLoc != chunkLoc {
+		return nil, &CorruptChunkError{chunkLoc, fmt.Errorf("Chunk identifies itself as %d,%d", loadedLoc.X, loadedLoc.Z)}
+	}
+
+	return
+}
+
+func (s *chunkStoreAnvil) SupportsWrite() bool {
+	return true
+}
+
+func (s *chunkStoreAnvil) Writer() IChunkWriter {
+	return newNbtChunkWriter()
+}
+
+func (s *chunkStoreAnvil) WriteChunk(writer IChunkWriter) error {
+	nbtWriter, ok := writer.(*nbtChunkWriter)
+	if !ok {
+		return fmt.Errorf("%T is incorrect IChunkWriter implementation for %T", writer, s)
+	}
+
+	entry, err := s.regions.acquire(regionLocForChunkXz(writer.ChunkLoc()), true)
+	if err != nil {
+		return err
+	}
+	defer s.regions.release(entry)
+
+	// The stored chunk may have sections above the height of chunks here,
+	// which must not be lost. A corrupt chunk has nothing to keep.
+	previous, err := entry.rf.ReadChunkTag(writer.ChunkLoc())
+	switch err.(type) {
+	case nil:
+	case NoSuchChunkError, *CorruptChunkError:
+		previous = nil
+	default:
+		return err
+	}
+
+	anvilTag, err := anvilFromChunkTag(nbtWriter.RootTag(), previous)
+	if err != nil {
+		return err
+	}
+
+	return entry.rf.WriteChunkTag(writer.ChunkLoc(), anvilTag)
+}
+
+// anvilIndex returns the index of a block within an Anvil section, for use
+// with the section's block array and its nibble arrays.
+func anvilIndex(x, y, z int) BlockIndex {
+	return BlockIndex(y<<(2*ChunkHShift) | z<<ChunkHShift | x)
+}
+
+// chunkIndex returns the index of a block within the whole chunk.
+func chunkIndex(x, y, z int) BlockIndex {
+	return BlockIndex(x<<(ChunkHShift+ChunkYShift) | z<<ChunkYShift | y)
+}
+
+// anvilLevelTags are the tags within an Anvil chunk's Level compound that
+// chunkTagFromAnvil converts for nbtChunkReader.
+var anvilLevelTags = map[string]bool{
+	"xPos":         true,
+	"zPos":         true,
+	"Sections":     true,
+	"HeightMap":    true,
+	"Biomes":       true,
+	"Entities":     true,
+	"TileEntities": true,
+}
+
+// chunkTagFromAnvil converts a chunk's NBT from the Anvil layout into that
+// read by nbtChunkReader. Blocks with IDs above 255 are replaced by air, and
+// missing sections are filled with air and full sky light.
+func chunkTagFromAnvil(anvilTag *nbt.Compound) (chunkTag *nbt.Compound, err error) {
+	anvilLevel, ok := nbt.GetCompound(anvilTag, "Level")
+	if !ok {
+		return nil, errors.New("missing or bad Level")
+	}
+
+	const numBlocks = ChunkSizeH * ChunkSizeH * ChunkSizeY
+	blocks := make([]byte, numBlocks)
+	blockData := make([]byte, numBlocks/2)
+	blockLight := make([]byte, numBlocks/2)
+	skyLight := make([]byte, numBlocks/2)
+	for i := range skyLight {
+		skyLight[i] = 0xff
+	}
+
+	if sections, ok := nbt.GetList(anvilLevel, "Sections", nbt.TagCompound); ok {
+		for _, section := range sections.Value {
+			if err = readAnvilSection(section, blocks, blockData, blockLight, skyLight); err != nil {
+				return nil, err
+			}
+		}
+	} else if anvilLevel.Lookup("Sections") != nil {
+		return nil, errors.New("bad Level/Sections")
+	}
+
+	heightMap := make([]byte, ChunkSizeH*ChunkSizeH)
+	if heights, ok := nbt.GetIntArray(anvilLevel, "HeightMap"); ok && len(heights) == len(heightMap) {
+		for i, height := range heights {
+			switch {
+			case height < 0:
+				height = 0
+			case height > ChunkSizeY:
+				height = ChunkSizeY
+			}
+			heightMap[i] = byte(height)
+		}
+	}
+
+	level := nbt.NewCompound()
+	for name, tag := range anvilLevel.Tags {
+		switch name {
+		case "Sections", "HeightMap":
+		default:
+			level.Set(name, tag)
+		}
+	}
+	level.Set("Blocks", &nbt.ByteArray{blocks})
+	level.Set("Data", &nbt.ByteArray{blockData})
+	level.Set("BlockLight", &nbt.ByteArray{blockLight})
+	level.Set("SkyLight", &nbt.ByteArray{skyLight})
+	level.Set("HeightMap", &nbt.ByteArray{heightMap})
+
+	chunkTag = nbt.NewCompound()
+	chunkTag.Set("Level", level)
+
+	return
+}
+
+// readAnvilSection copies the blocks, block data and light of the section
+// into the arrays for the whole chunk.
+func readAnvilSection(section nbt.ITag, blocks, blockData, blockLight, skyLight []byte) error {
+	sectionY, ok := nbt.GetByte(section, "Y")
+	if !ok {
+		return errors.New("missing or bad section Y")
+	}
+
+	sectionBlocks, ok := nbt.GetByteArray(section, "Blocks")
+	if !ok {
+		if section.Lookup("BlockStates") != nil {
+			return errAnvilPalette
+		}
+		return errors.New("missing or bad section Blocks")
+	}
+
+	arrays := []struct {
+		name string
+		size int
+	}{
+		{"Blocks", anvilSectionBlocks},
+		{"Data", anvilSectionBlocks / 2},
+		{"BlockLight", anvilSectionBlocks / 2},
+		{"SkyLight", anvilSectionBlocks / 2},
+	}
+	for _, array := range arrays {
+		value, ok := nbt.GetByteArray(section, array.name)
+		if !ok {
+			return fmt.Errorf("missing or bad section %s", array.name)
+		}
+		if len(value) != array.size {
+			return fmt.Errorf("section %s has length %d, expected %d", array.name, len(value), array.size)
+		}
+	}
+
+	// Sections beyond the height of the world are left out, and kept by
+	// anvilFromChunkTag.
+	if !anvilSectionInRange(sectionY) {
+		return nil
+	}
+
+	// Add holds the high bits of block IDs above 255, which can't be
+	// represented.
+	add, ok := nbt.GetByteArray(section, "Add")
+	if ok && len(add) != anvilSectionBlocks/2 {
+		add = nil
+	}
+
+	sectionData, _ := nbt.GetByteArray(section, "Data")
+	sectionBlockLight, _ := nbt.GetByteArray(section, "BlockLight")
+	sectionSkyLight, _ := nbt.GetByteArray(section, "SkyLight")
+
+	baseY := int(sectionY) * anvilSectionHeight
+	for y := 0; y < anvilSectionHeight; y++ {
+		for z := 0; z < ChunkSizeH; z++ {
+			for x := 0; x < ChunkSizeH; x++ {
+				from := anvilIndex(x, y, z)
+				to := chunkIndex(x, baseY+y, z)
+
+				if add == nil || from.BlockData(add) == 0 {
+					blocks[to] = sectionBlocks[from]
+					to.SetBlockData(blockData, from.BlockData(sectionData))
+				}
+				to.SetBlockData(blockLight, from.BlockData(sectionBlockLight))
+				to.SetBlockData(skyLight, from.BlockData(sectionSkyLight))
+			}
+		}
+	}
+
+	return nil
+}
+
+// anvilSectionInRange returns true if the section at sectionY is within the
+// height of chunks here.
+func anvilSectionInRange(sectionY int8) bool {
+	return sectionY >= 0 && sectionY < anvilSections
+}
+
+// anvilFromChunkTag converts a chunk's NBT from the layout written by
+// nbtChunkWriter into the Anvil layout. Sections containing only air are
+// omitted. previous is the chunk as it is stored in the Anvil layout, or nil.
+// Its sections beyond the height of chunks here are kept, along with the
+// heights of columns that reach into them.
+func anvilFromChunkTag(chunkTag *nbt.Compound, previous *nbt.Compound) (anvilTag *nbt.Compound, err error) {
+	level, ok := nbt.GetCompound(chunkTag, "Level")
+	if !ok {
+		return nil, errors.New("missing or bad Level")
+	}
+	if err = validateChunkTag(chunkTag); err != nil {
+		return
+	}
+
+	blocks, _ := nbt.GetByteArray(level, "Blocks")
+	blockData, _ := nbt.GetByteArray(level, "Data")
+	blockLight, _ := nbt.GetByteArray(level, "BlockLight")
+	skyLight, _ := nbt.GetByteArray(level, "SkyLight")
+	heightMap, _ := nbt.GetByteArray(level, "HeightMap")
+
+	var sections []nbt.ITag
+	for sectionY := 0; sectionY < anvilSections; sectionY++ {
+		var section *nbt.Compound
+		if section, err = writeAnvilSection(sectionY, blocks, blockData, blockLight, skyLight); err != nil {
+			return nil, err
+		}
+		if section != nil {
+			sections = append(sections, section)
+		}
+	}
+
+	heights := make([]int32, len(heightMap))
+	for i, height := range heightMap {
+		heights[i] = int32(height)
+	}
+
+	if previous != nil {
+		if previousSections, ok := nbt.GetList(previous, "Level/Sections", nbt.TagCompound); ok {
+			for _, section := range previousSections.Value {
+				if sectionY, ok := nbt.GetByte(section, "Y"); ok && !anvilSectionInRange(sectionY) {
+					sections = append(sections, section)
+				}
+			}
+		}
+		if previousHeights, ok := nbt.GetIntArray(previous, "Level/HeightMap"); ok && len(previousHeights) == len(heights) {
+			for i, height := range previousHeights {
+				if height > ChunkSizeY {
+					heights[i] = height
+				}
+			}
+		}
+	}
+
+	anvilLevel := nbt.NewCompound()
+	for name, tag := range level.Tags {
+		switch name {
+		case "Blocks", "Data", "BlockLight", "SkyLight", "HeightMap":
+		default:
+			anvilLevel.Set(name, tag)
+		}
+	}
+	anvilLevel.Set("Sections", &nbt.List{nbt.TagCompound, sections})
+	anvilLevel.Set("HeightMap", &nbt.IntArray{heights})
+
+	anvilTag = nbt.NewCompound()
+	anvilTag.Set("Level", anvilLevel)
+
+	return
+}
+
+// writeAnvilSection returns the Anvil section holding the blocks at
+// sectionY, or nil if they are all air.
+func writeAnvilSection(sectionY int, blocks, blockData, blockLight, skyLight []byte) (section *nbt.Compound, err error) {
+	sectionBlocks := make([]byte, anvilSectionBlocks)
+	sectionData := make([]byte, anvilSectionBlocks/2)
+	sectionBlockLight := make([]byte, anvilSectionBlocks/2)
+	sectionSkyLight := make([]byte, anvilSectionBlocks/2)
+
+	empty := true
+	baseY := sectionY * anvilSectionHeight
+	for y := 0; y < anvilSectionHeight; y++ {
+		for z := 0; z < ChunkSizeH; z++ {
+			for x := 0; x < ChunkSizeH; x++ {
+				from := chunkIndex(x, baseY+y, z)
+				to := anvilIndex(x, y, z)
+
+				if blocks[from] != 0 {
+					empty = false
+				}
+				sectionBlocks[to] = blocks[from]
+				to.SetBlockData(sectionData, from.BlockData(blockData))
+				to.SetBlockData(sectionBlockLight, from.BlockData(blockLight))
+				to.SetBlockData(sectionSkyLight, from.BlockData(skyLight))
+			}
+		}
+	}
+
+	if empty {
+		return nil, nil
+	}
+
+	return nbt.NewBuilder().
+		PutByte("Y", int8(sectionY)).
+		PutByteArray("Blocks", sectionBlocks).
+		PutByteArray("Data", sectionData).
+		PutByteArray("BlockLight", sectionBlockLight).
+		PutByteArray("SkyLight", sectionSkyLight).
+		Build()
+}
@@ -0,0 +1,273 @@
+package chunkstore
+
+import (
+	"testing"
+
+	. "chunkymonkey/types"
+	"nbt"
+)
+
+func TestChunkStoreAnvil_RoundTrip(t *testing.T) {
+	s, err := newChunkStoreAnvil(t.TempDir(), DimensionNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const numBlocks = ChunkSizeH * ChunkSizeH * ChunkSizeY
+	loc := ChunkXz{-3, 40}
+	block := chunkIndex(5, 70, 9)
+	blocks := make([]byte, numBlocks)
+	blocks[block] = 42
+	blockData := make([]byte, numBlocks/2)
+	block.SetBlockData(blockData, 7)
+	heightMap := make([]byte, ChunkSizeH*ChunkSizeH)
+	heightMap[9<<ChunkHShift|5] = 71
+
+	writer := s.Writer()
+	writer.SetChunkLoc(loc)
+	writer.SetBlocks(blocks)
+	writer.SetBlockData(blockData)
+	writer.SetBlockLight(make([]byte, numBlocks/2))
+	writer.SetSkyLight(make([]byte, numBlocks/2))
+	writer.SetHeightMap(heightMap)
+	if err = s.WriteChunk(writer); err != nil {
+		t.Fatalf("WriteChunk error: %v", err)
+	}
+
+	reader, err := s.ReadChunk(loc)
+	if err != nil {
+		t.Fatalf("ReadChunk error: %v", err)
+	}
+	if reader.ChunkLoc() != loc {
+		t.Errorf("Expected chunk at %v, got %v", loc, reader.ChunkLoc())
+	}
+	if id := reader.Blocks()[block]; id != 42 {
+		t.Errorf("Expected block 42, got %d", id)
+	}
+	if data := block.BlockData(reader.BlockData()); data != 7 {
+		t.Errorf("Expected block data 7, got %d", data)
+	}
+	if height := reader.HeightMap()[9<<ChunkHShift|5]; height != 71 {
+		t.Errorf("Expected height 71, got %d", height)
+	}
+
+	// Only the section containing the block is stored, the others are read
+	// back as air with full sky light.
+	entry, err := s.regions.acquire(regionLocForChunkXz(loc), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.regions.release(entry)
+	anvilTag, err := entry.rf.ReadChunkTag(loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sections, ok := nbt.GetList(anvilTag, "Level/Sections", nbt.TagCompound); !ok || len(sections.Value) != 1 {
+		t.Errorf("Expected a single section to be written, got %v", sections)
+	}
+	if light := chunkIndex(0, 0, 0).BlockData(reader.SkyLight()); light != 15 {
+		t.Errorf("Expected full sky light in missing section, got %d", light)
+	}
+}
+
+func TestChunkStoreAnvil_KeepsHighSections(t *testing.T) {
+	s, err := newChunkStoreAnvil(t.TempDir(), DimensionNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A chunk of a taller world, with a section at Y=12 and a column reaching
+	// into it.
+	loc := ChunkXz{2, -5}
+	bottom, err := anvilTestSection(0, 1).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	high, err := anvilTestSection(12, 7).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	heights := make([]int32, ChunkSizeH*ChunkSizeH)
+	heights[0] = 208
+	stored, err := nbt.NewBuilder().PutCompound("Level", nbt.NewBuilder().
+		PutInt("xPos", int32(loc.X)).
+		PutInt("zPos", int32(loc.Z)).
+		PutList("Sections", nbt.TagCompound, bottom, high).
+		PutIntArray("HeightMap", heights)).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := s.regions.acquire(regionLocForChunkXz(loc), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = entry.rf.WriteChunkTag(loc, stored)
+	s.regions.release(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The chunk is loaded and saved after a change.
+	reader, err := s.ReadChunk(loc)
+	if err != nil {
+		t.Fatalf("ReadChunk error: %v", err)
+	}
+	changed := chunkIndex(4, 20, 6)
+	blocks := append([]byte(nil), reader.Blocks()...)
+	blocks[changed] = 42
+	writer := s.Writer()
+	writer.SetChunkLoc(loc)
+	writer.SetBlocks(blocks)
+	writer.SetBlockData(reader.BlockData())
+	writer.SetBlockLight(reader.BlockLight())
+	writer.SetSkyLight(reader.SkyLight())
+	writer.SetHeightMap(reader.HeightMap())
+	if err = s.WriteChunk(writer); err != nil {
+		t.Fatalf("WriteChunk error: %v", err)
+	}
+
+	if reader, err = s.ReadChunk(loc); err != nil {
+		t.Fatalf("ReadChunk error: %v", err)
+	}
+	if id := reader.Blocks()[changed]; id != 42 {
+		t.Errorf("Expected the changed block 42, got %d", id)
+	}
+
+	entry, err = s.regions.acquire(regionLocForChunkXz(loc), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.regions.release(entry)
+	anvilTag, err := entry.rf.ReadChunkTag(loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sections, _ := nbt.GetList(anvilTag, "Level/Sections", nbt.TagCompound)
+	found := false
+	for _, section := range sections.Value {
+		if sectionY, _ := nbt.GetByte(section, "Y"); sectionY == 12 {
+			found = true
+			if sectionBlocks, _ := nbt.GetByteArray(section, "Blocks"); len(sectionBlocks) != anvilSectionBlocks || sectionBlocks[0] != 7 {
+				t.Errorf("Expected the section at Y=12 to be unchanged")
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Expected the section at Y=12 to be kept, got %v", sections)
+	}
+	if savedHeights, _ := nbt.GetIntArray(anvilTag, "Level/HeightMap"); len(savedHeights) != len(heights) || savedHeights[0] != 208 {
+		t.Errorf("Expected the height of the tall column to be kept, got %v", savedHeights)
+	}
+}
+
+// anvilTestSection returns an Anvil section at sectionY with every block set
+// to id.
+func anvilTestSection(sectionY int8, id byte) *nbt.Builder {
+	blocks := make([]byte, anvilSectionBlocks)
+	for i := range blocks {
+		blocks[i] = id
+	}
+	return nbt.NewBuilder().
+		PutByte("Y", sectionY).
+		PutByteArray("Blocks", blocks).
+		PutByteArray("Data", make([]byte, anvilSectionBlocks/2)).
+		PutByteArray("BlockLight", make([]byte, anvilSectionBlocks/2)).
+		PutByteArray("SkyLight", make([]byte, anvilSectionBlocks/2))
+}
+
+func TestChunkTagFromAnvil(t *testing.T) {
+	buildSection := func(b *nbt.Builder) nbt.ITag {
+		section, err := b.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return section
+	}
+
+	anvilTag, err := nbt.NewBuilder().PutCompound("Level", nbt.NewBuilder().
+		PutInt("xPos", 1).
+		PutInt("zPos", 2).
+		PutList("Sections", nbt.TagCompound,
+			buildSection(anvilTestSection(1, 3)),
+			// Above the height of the world.
+			buildSection(anvilTestSection(9, 4)),
+			// Add arrays of the wrong length are ignored.
+			buildSection(anvilTestSection(2, 5).
+				PutByteArray("Add", []byte{0x11})))).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunkTag, err := chunkTagFromAnvil(anvilTag)
+	if err != nil {
+		t.Fatalf("chunkTagFromAnvil error: %v", err)
+	}
+	r, err := nbtChunkReaderForTag(chunkTag)
+	if err != nil {
+		t.Fatalf("Converted chunk invalid: %v", err)
+	}
+
+	type Test struct {
+		y        int
+		expected byte
+	}
+
+	tests := []Test{
+		{0, 0},
+		{16, 3},
+		{31, 3},
+		{32, 5},
+		{127, 0},
+	}
+
+	for _, test := range tests {
+		if id := r.Blocks()[chunkIndex(2, test.y, 3)]; id != test.expected {
+			t.Errorf("Block at y=%d expected %d but got %d", test.y, test.expected, id)
+		}
+	}
+
+	// With a valid Add array, blocks with high IDs become air.
+	add := make([]byte, anvilSectionBlocks/2)
+	add[0] = 0x01
+	anvilTag, err = nbt.NewBuilder().PutCompound("Level", nbt.NewBuilder().
+		PutInt("xPos", 1).
+		PutInt("zPos", 2).
+		PutList("Sections", nbt.TagCompound,
+			buildSection(anvilTestSection(0, 5).PutByteArray("Add", add)))).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunkTag, err = chunkTagFromAnvil(anvilTag); err != nil {
+		t.Fatalf("chunkTagFromAnvil error: %v", err)
+	}
+	blocks, _ := nbt.GetByteArray(chunkTag, "Level/Blocks")
+	if blocks[chunkIndex(0, 0, 0)] != 0 || blocks[chunkIndex(1, 0, 0)] != 5 {
+		t.Errorf("Expected only the block with a high ID to become air")
+	}
+}
+
+func TestChunkTagFromAnvil_Palette(t *testing.T) {
+	section, err := nbt.NewBuilder().
+		PutByte("Y", 0).
+		PutList("Palette", nbt.TagCompound).
+		PutIntArray("BlockStates", make([]int32, 256)).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	anvilTag, err := nbt.NewBuilder().PutCompound("Level", nbt.NewBuilder().
+		PutInt("xPos", 0).
+		PutInt("zPos", 0).
+		PutList("Sections", nbt.TagCompound, section)).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = chunkTagFromAnvil(anvilTag); err != errAnvilPalette {
+		t.Errorf("Expected errAnvilPalette, got %v", err)
+	}
+}
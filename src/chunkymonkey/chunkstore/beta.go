@@ -2,7 +2,6 @@ package chunkstore
 
 import (
 	"fmt"
-	"os"
 	"path"
 
 	. "chunkymonkey/types"
@@ -15,72 +14,65 @@ const (
 	// 5 is the size of chunkDataHeader in bytes.
 	chunkDataHeaderSize = 5
 	chunkDataGuessSize  = 8192
+	// The header records the length of each chunk's data in a single byte.
+	maxChunkSectors = 255
 
 	chunkCompressionGzip = 1
 	chunkCompressionZlib = 2
+
+	// The extensions of McRegion and Anvil region files.
+	regionFileExt = "mcr"
+	anvilFileExt  = "mca"
 )
 
 type chunkStoreBeta struct {
-	regionPath  string
-	regionFiles map[uint64]*regionFile
+	regionPath     string
+	quarantinePath string
+	regions        *regionCache
+
+	// regenerateCorrupt causes corrupt chunks to be quarantined and reported
+	// as not existing.
+	regenerateCorrupt bool
 }
 
 // Creates a chunkStoreBeta that reads the Minecraft Beta world format.
 func newChunkStoreBeta(worldPath string, dimension DimensionId) (s *chunkStoreBeta, err error) {
 	s = &chunkStoreBeta{
-		regionFiles: make(map[uint64]*regionFile),
-	}
-
-	if dimension == DimensionNormal {
-		s.regionPath = path.Join(worldPath, "region")
-	} else {
-		s.regionPath = path.Join(worldPath, fmt.Sprintf("DIM%d", dimension), "region")
+		regenerateCorrupt: *regenerateCorruptChunks,
 	}
 
-	if err = os.MkdirAll(s.regionPath, 0777); err != nil {
-		return nil, err
-	}
+	// The region directory is created by the regionCache when first written
+	// to.
+	s.regionPath = path.Join(dimensionPath(worldPath, dimension), "region")
+	s.quarantinePath = path.Join(path.Dir(s.regionPath), "quarantine")
+	s.regions = newRegionCache(s.regionPath, regionFileExt, *maxOpenRegionFiles)
 
 	return
 }
 
-func (s *chunkStoreBeta) regionFile(chunkLoc ChunkXz) (rf *regionFile, err error) {
-	regionLoc := regionLocForChunkXz(chunkLoc)
-
-	rf, ok := s.regionFiles[regionLoc.regionKey()]
-	if ok {
-		return rf, nil
-	}
-
-	// TODO limit number of regionFile objs to a maximum number of
-	// most-frequently-used regions. Close regionFile objects when no
-	// longer needed.
-	filePath := regionLoc.regionFilePath(s.regionPath)
-	rf, err = newRegionFile(filePath)
+func (s *chunkStoreBeta) ReadChunk(chunkLoc ChunkXz) (reader IChunkReader, err error) {
+	entry, err := s.regions.acquire(regionLocForChunkXz(chunkLoc), false)
 	if err != nil {
-		// TODO: Check if the file is there first instead
-		//if errno, ok := util.Errno(err); ok && errno == os.ENOENT {
-		//}
-		err = NoSuchChunkError(false)
 		return
 	}
-	s.regionFiles[regionLoc.regionKey()] = rf
-
-	return rf, nil
-}
+	defer s.regions.release(entry)
 
-func (s *chunkStoreBeta) ReadChunk(chunkLoc ChunkXz) (reader IChunkReader, err error) {
-	rf, err := s.regionFile(chunkLoc)
+	chunkReader, err := entry.rf.ReadChunkData(chunkLoc)
 	if err != nil {
+		if corrupt, ok := err.(*CorruptChunkError); ok && s.regenerateCorrupt {
+			err = s.quarantine(entry.rf, corrupt)
+		}
 		return
 	}
 
-	chunkReader, err := rf.ReadChunkData(chunkLoc)
-	if chunkReader != nil {
-		reader = chunkReader
-	}
+	return chunkReader, nil
+}
 
-	return
+// quarantine moves a corrupt chunk aside into the quarantine directory.
+// NoSuchChunkError is returned if this succeeds, so that the chunk is
+// regenerated.
+func (s *chunkStoreBeta) quarantine(rf *regionFile, corrupt *CorruptChunkError) error {
+	return quarantineRegionChunk(s.quarantinePath, rf, corrupt)
 }
 
 func (s *chunkStoreBeta) SupportsWrite() bool {
@@ -97,10 +89,11 @@ func (s *chunkStoreBeta) WriteChunk(writer IChunkWriter) error {
 		return fmt.Errorf("%T is incorrect IChunkWriter implementation for %T", writer, s)
 	}
 
-	rf, err := s.regionFile(writer.ChunkLoc())
+	entry, err := s.regions.acquire(regionLocForChunkXz(writer.ChunkLoc()), true)
 	if err != nil {
 		return err
 	}
+	defer s.regions.release(entry)
 
-	return rf.WriteChunkData(nbtWriter)
+	return entry.rf.WriteChunkData(nbtWriter)
 }
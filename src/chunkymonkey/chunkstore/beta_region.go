@@ -10,31 +10,62 @@ import (
 	"io"
 	"os"
 	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	. "chunkymonkey/types"
 	"nbt"
 )
 
 // TODO Handle timestamps of chunks.
-// TODO Keep track of used/unused sectors for more efficient packing.
 
 // Handle on a chunk file - used to read chunk data from the file.
+//
+// Chunks are never overwritten in place. New chunk data is written to free
+// sectors and synced to disk before the header is pointed at it, so that a
+// crash part way through a write leaves the chunk's previous data intact.
 type regionFile struct {
-	offsets   regionFileHeader
-	endSector uint32 // The index of the sector just beyond the last used sector.
-	file      *os.File
+	offsets regionFileHeader
+	file    *os.File
+
+	// used records which sectors hold the header or chunk data. Sectors
+	// beyond its end are free.
+	used []bool
+	// pendingFree holds sectors no longer referred to by the header. They
+	// only become free once the file has next been synced, as until then the
+	// header on disk may still refer to them.
+	pendingFree []sectorRange
 }
 
-func newRegionFile(filePath string) (rf *regionFile, err error) {
-	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0666)
+// sectorRange is a run of sectors within a region file.
+type sectorRange struct {
+	index, count uint32
+}
+
+// newRegionFile opens the region file at filePath. If create is false and
+// the file does not exist, NoSuchChunkError is returned.
+func newRegionFile(filePath string, create bool) (rf *regionFile, err error) {
+	flags := os.O_RDWR
+	if create {
+		flags |= os.O_CREATE
+	}
+
+	file, err := os.OpenFile(filePath, flags, 0666)
 	if err != nil {
-		// TODO: Check if the file is present first.
-		//if sysErr, ok := err.(*os.SyscallError); ok && sysErr.Errno == os.ENOENT {
-		err = NoSuchChunkError(false)
-		//}
+		if !create && os.IsNotExist(err) {
+			err = NoSuchChunkError(false)
+		}
 		return
 	}
 
+	defer func() {
+		if err != nil {
+			file.Close()
+			rf = nil
+		}
+	}()
+
 	fi, err := file.Stat()
 	if err != nil {
 		return
@@ -50,35 +81,137 @@ func newRegionFile(filePath string) (rf *regionFile, err error) {
 			return
 		}
 
-		rf.endSector = 2
 	} else {
 		// Existing region file, read header index.
 		if err = rf.offsets.Read(rf.file); err != nil {
+			err = fmt.Errorf("Reading header of region file %s: %v", filePath, err)
 			return
 		}
+	}
+
+	// The first two sectors hold the header.
+	rf.markUsed(sectorRange{0, 2}, true)
+	for _, offset := range rf.offsets {
+		if offset.IsPresent() {
+			sectorCount, sectorIndex := offset.Get()
+			rf.markUsed(sectorRange{sectorIndex, sectorCount}, true)
+		}
+	}
 
-		// Find the index of the sector at the end of the file.
-		for i := range rf.offsets {
-			sectorCount, sectorIndex := rf.offsets[i].Get()
-			lastUsedSector := sectorIndex + sectorCount
-			if lastUsedSector >= rf.endSector {
-				rf.endSector = lastUsedSector + 1
-			}
+	return
+}
+
+// Close flushes any writes to disk, and closes the file.
+func (rf *regionFile) Close() (err error) {
+	if err = rf.file.Sync(); err != nil {
+		rf.file.Close()
+		return
+	}
+	return rf.file.Close()
+}
+
+// markUsed marks the sectors as used or free.
+func (rf *regionFile) markUsed(sectors sectorRange, used bool) {
+	end := int(sectors.index + sectors.count)
+	if used {
+		for len(rf.used) < end {
+			rf.used = append(rf.used, false)
 		}
+	} else if end > len(rf.used) {
+		end = len(rf.used)
+	}
+	for i := int(sectors.index); i < end; i++ {
+		rf.used[i] = used
+	}
+}
 
-		if rf.endSector < 2 {
-			rf.endSector = 2
+// allocate finds and marks as used the first run of free sectors of the
+// given length, extending the file if there is none.
+func (rf *regionFile) allocate(count uint32) (sectors sectorRange) {
+	sectors.count = count
+	run := uint32(0)
+	for i, used := range rf.used {
+		if used {
+			run = 0
+			continue
+		}
+		run++
+		if run == count {
+			sectors.index = uint32(i) + 1 - count
+			rf.markUsed(sectors, true)
+			return
 		}
 	}
 
+	// Extend the file, including any free sectors at its end.
+	sectors.index = uint32(len(rf.used)) - run
+	rf.markUsed(sectors, true)
 	return
 }
 
-func (rf *regionFile) Close() {
-	rf.file.Close()
+// sync flushes writes to disk. Sectors that were pending being freed can be
+// reused afterwards.
+func (rf *regionFile) sync() (err error) {
+	if err = rf.file.Sync(); err != nil {
+		return
+	}
+	for _, sectors := range rf.pendingFree {
+		rf.markUsed(sectors, false)
+	}
+	rf.pendingFree = rf.pendingFree[:0]
+	return
+}
+
+// setOffset points the header at the chunk's new sectors, and frees its old
+// sectors once that is safely on disk.
+func (rf *regionFile) setOffset(chunkLoc ChunkXz, offset chunkOffset) (err error) {
+	oldOffset := rf.offsets.Offset(chunkLoc)
+	if err = rf.offsets.SetOffset(chunkLoc, offset, rf.file); err != nil {
+		rf.offsets[indexForChunkLoc(chunkLoc)] = oldOffset
+		return
+	}
+	if oldOffset.IsPresent() {
+		sectorCount, sectorIndex := oldOffset.Get()
+		rf.pendingFree = append(rf.pendingFree, sectorRange{sectorIndex, sectorCount})
+	}
+	return
 }
 
 func (rf *regionFile) ReadChunkData(chunkLoc ChunkXz) (r *nbtChunkReader, err error) {
+	chunkTag, err := rf.ReadChunkLevelTags(chunkLoc, chunkLevelTags)
+	if err != nil {
+		return
+	}
+
+	if r, err = nbtChunkReaderForTag(chunkTag); err != nil {
+		return nil, &CorruptChunkError{chunkLoc, err}
+	}
+
+	if loadedLoc := r.ChunkLoc(); loadedLoc != chunkLoc {
+		return nil, &CorruptChunkError{chunkLoc, fmt.Errorf("Chunk identifies itself as %d,%d", loadedLoc.X, loadedLoc.Z)}
+	}
+
+	return
+}
+
+// ReadChunkTag reads all of the chunk's NBT data, without checking its
+// contents.
+func (rf *regionFile) ReadChunkTag(chunkLoc ChunkXz) (chunkTag *nbt.Compound, err error) {
+	return rf.decodeChunk(chunkLoc, func(reader io.Reader) (*nbt.Compound, error) {
+		return nbt.NewDecoder(reader, nbt.DefaultLimits).Decode()
+	})
+}
+
+// ReadChunkLevelTags reads only the given tags within the chunk's Level
+// compound, as decodeChunkTag does, without checking their contents.
+func (rf *regionFile) ReadChunkLevelTags(chunkLoc ChunkXz, levelTags map[string]bool) (chunkTag *nbt.Compound, err error) {
+	return rf.decodeChunk(chunkLoc, func(reader io.Reader) (*nbt.Compound, error) {
+		return decodeChunkTag(reader, levelTags)
+	})
+}
+
+// decodeChunk decodes the chunk's NBT data with decode.
+func (rf *regionFile) decodeChunk(chunkLoc ChunkXz, decode func(reader io.Reader) (*nbt.Compound, error)) (chunkTag *nbt.Compound, err error) {
 	offset := rf.offsets.Offset(chunkLoc)
 
 	if !offset.IsPresent() {
@@ -90,80 +223,120 @@ func (rf *regionFile) ReadChunkData(chunkLoc ChunkXz) (r *nbtChunkReader, err er
 	sectorCount, sectorIndex := offset.Get()
 
 	if sectorIndex == 0 || sectorCount == 0 {
-		err = errors.New("Header gave bad chunk offset.")
+		err = &CorruptChunkError{chunkLoc, errors.New("Header gave bad chunk offset.")}
 		return
 	}
 
-	rf.file.Seek(int64(sectorIndex)*regionFileSectorSize, 0)
+	if _, err = rf.file.Seek(int64(sectorIndex)*regionFileSectorSize, 0); err != nil {
+		return
+	}
 
 	maxChunkDataSize := (sectorCount * regionFileSectorSize) - chunkDataHeaderSize
 
 	var header chunkDataHeader
-	binary.Read(rf.file, binary.BigEndian, &header)
+	if err = binary.Read(rf.file, binary.BigEndian, &header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = &CorruptChunkError{chunkLoc, io.ErrUnexpectedEOF}
+		}
+		return
+	}
 	if header.DataSize > maxChunkDataSize {
-		err = fmt.Errorf(
+		err = &CorruptChunkError{chunkLoc, fmt.Errorf(
 			"Chunk is too big (%d bytes) for the sectors it is within (%d*%d - %d=%d) header.",
-			header.DataSize, sectorCount, regionFileSectorSize, chunkDataHeaderSize, maxChunkDataSize)
+			header.DataSize, sectorCount, regionFileSectorSize, chunkDataHeaderSize, maxChunkDataSize)}
 		return
 	}
 
 	dataReader, err := header.DataReader(rf.file)
 	if err != nil {
+		err = &CorruptChunkError{chunkLoc, err}
 		return
 	}
 	defer dataReader.Close()
 
-	r, err = newNbtChunkReader(dataReader)
+	if chunkTag, err = decode(dataReader); err != nil {
+		return nil, &CorruptChunkError{chunkLoc, err}
+	}
 
 	return
 }
 
-func (rf *regionFile) WriteChunkData(w *nbtChunkWriter) (err error) {
-	chunkData, err := serializeChunkData(w)
+// RawChunkData returns the raw sectors holding the chunk's data, for the
+// chunk to be quarantined. Sectors beyond the end of the file are omitted.
+func (rf *regionFile) RawChunkData(chunkLoc ChunkXz) (data []byte, err error) {
+	sectorCount, sectorIndex := rf.offsets.Offset(chunkLoc).Get()
+
+	fi, err := rf.file.Stat()
 	if err != nil {
 		return
 	}
 
-	requiredSize := uint32(len(chunkData))
+	start := int64(sectorIndex) * regionFileSectorSize
+	end := start + int64(sectorCount)*regionFileSectorSize
+	if end > fi.Size() {
+		end = fi.Size()
+	}
+	if start >= end {
+		return nil, nil
+	}
 
-	offset := rf.offsets.Offset(w.ChunkLoc())
-	sectorCount, sectorIndex := offset.Get()
+	data = make([]byte, end-start)
+	_, err = rf.file.ReadAt(data, start)
+	return
+}
 
-	if offset.IsPresent() && requiredSize <= sectorCount*regionFileSectorSize {
-		// Chunk already exists in the region file and the data will fit in its
-		// present location.
-		if _, err = rf.file.WriteAt(chunkData, int64(sectorIndex)*regionFileSectorSize); err != nil {
-			return
-		}
-	} else {
-		// Chunk doesn't yet exist in the region file or won't fit in its present
-		// location. Write it at the end of the file.
-		sectorIndex = rf.endSector
+// RemoveChunk removes the chunk from the region file's header, so that the
+// chunk no longer exists.
+func (rf *regionFile) RemoveChunk(chunkLoc ChunkXz) error {
+	return rf.setOffset(chunkLoc, chunkOffset(0))
+}
 
-		if _, err = rf.file.WriteAt(chunkData, int64(sectorIndex)*regionFileSectorSize); err != nil {
-			return
-		}
+func (rf *regionFile) WriteChunkData(w *nbtChunkWriter) (err error) {
+	return rf.WriteChunkTag(w.ChunkLoc(), w.RootTag())
+}
 
-		sectorCount = requiredSize / regionFileSectorSize
-		if requiredSize%regionFileSectorSize != 0 {
-			sectorCount++
-		}
-		rf.endSector += sectorCount
+// WriteChunkTag writes the chunk's NBT data.
+func (rf *regionFile) WriteChunkTag(chunkLoc ChunkXz, chunkTag *nbt.Compound) (err error) {
+	chunkData, err := serializeChunkData(chunkTag)
+	if err != nil {
+		return
+	}
+
+	sectorCount := uint32(len(chunkData)) / regionFileSectorSize
+	if uint32(len(chunkData))%regionFileSectorSize != 0 {
+		sectorCount++
+	}
+	if sectorCount > maxChunkSectors {
+		return fmt.Errorf("Chunk data is too large (%d bytes) for a region file.", len(chunkData))
+	}
+
+	// The data is written to free sectors and synced before the header is
+	// changed to refer to it.
+	sectors := rf.allocate(sectorCount)
+	if _, err = rf.file.WriteAt(chunkData, int64(sectors.index)*regionFileSectorSize); err == nil {
+		err = rf.sync()
+	}
+	if err != nil {
+		rf.markUsed(sectors, false)
+		return
+	}
 
-		offset.Set(sectorCount, sectorIndex)
-		rf.offsets.SetOffset(w.ChunkLoc(), offset, rf.file)
+	var offset chunkOffset
+	offset.Set(sectors.count, sectors.index)
+	if err = rf.setOffset(chunkLoc, offset); err != nil {
+		rf.markUsed(sectors, false)
 	}
 
 	return
 }
 
 // serializeChunkData produces the compressed chunk NBT data.
-func serializeChunkData(w *nbtChunkWriter) (chunkData []byte, err error) {
+func serializeChunkData(chunkTag *nbt.Compound) (chunkData []byte, err error) {
 	// Reserve room for the chunk data header at the start.
 	buffer := bytes.NewBuffer(make([]byte, chunkDataHeaderSize, chunkDataGuessSize))
 
 	zlibWriter := zlib.NewWriter(buffer)
-	if err = nbt.Write(zlibWriter, w.RootTag()); err != nil {
+	if err = nbt.Write(zlibWriter, chunkTag); err != nil {
 		zlibWriter.Close()
 		return nil, err
 	}
@@ -280,13 +453,43 @@ func regionLocForChunkXz(chunkLoc ChunkXz) regionLoc {
 	}
 }
 
+// regionLocForFilename returns the location of a region file from its name,
+// r.<x>.<z>.mcr, or r.<x>.<z>.mca for Anvil.
+func regionLocForFilename(filename string) (loc regionLoc, ok bool) {
+	parts := strings.Split(filepath.Base(filename), ".")
+	if len(parts) != 4 || parts[0] != "r" || (parts[3] != regionFileExt && parts[3] != anvilFileExt) {
+		return
+	}
+	x, errX := strconv.ParseInt(parts[1], 10, 32)
+	z, errZ := strconv.ParseInt(parts[2], 10, 32)
+	if errX != nil || errZ != nil {
+		return
+	}
+	return regionLoc{regionCoord(x), regionCoord(z)}, true
+}
+
+// chunkXz returns the location of the chunk at the index within the region
+// file's header, the reverse of indexForChunkLoc.
+func (loc *regionLoc) chunkXz(index int) ChunkXz {
+	return ChunkXz{
+		ChunkCoord(loc.X)<<regionFileEdgeShift + ChunkCoord(index&(regionFileEdge-1)),
+		ChunkCoord(loc.Z)<<regionFileEdgeShift + ChunkCoord(index>>regionFileEdgeShift),
+	}
+}
+
 func (loc *regionLoc) regionKey() uint64 {
 	return uint64(loc.X)<<32 | uint64(uint32(loc.Z))
 }
 
 func (loc *regionLoc) regionFilePath(regionPath string) string {
+	return loc.filePath(regionPath, regionFileExt)
+}
+
+// filePath returns the path of the region file with the extension, which is
+// regionFileExt or anvilFileExt.
+func (loc *regionLoc) filePath(regionPath, ext string) string {
 	return path.Join(
 		regionPath,
-		fmt.Sprintf("r.%d.%d.mcr", loc.X, loc.Z),
+		fmt.Sprintf("r.%d.%d.%s", loc.X, loc.Z, ext),
 	)
 }
@@ -1,6 +1,11 @@
 package chunkstore
 
 import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
 	"testing"
 
 	. "chunkymonkey/types"
@@ -64,3 +69,240 @@ func TestChunkOffset(t *testing.T) {
 		}
 	}
 }
+
+// setTestChunk sets valid chunk data in the writer, with the given values of
+// the first two blocks.
+func setTestChunk(writer IChunkWriter, loc ChunkXz, block0, block1 byte) {
+	const numBlocks = ChunkSizeH * ChunkSizeH * ChunkSizeY
+	blocks := make([]byte, numBlocks)
+	blocks[0], blocks[1] = block0, block1
+
+	writer.SetChunkLoc(loc)
+	writer.SetBlocks(blocks)
+	writer.SetBlockData(make([]byte, numBlocks/2))
+	writer.SetBlockLight(make([]byte, numBlocks/2))
+	writer.SetSkyLight(make([]byte, numBlocks/2))
+	writer.SetHeightMap(make([]byte, ChunkSizeH*ChunkSizeH))
+}
+
+// writeTestRegion writes a single chunk to a new beta store in a temporary
+// directory, and returns the store and the path of the region file.
+func writeTestRegion(t *testing.T, loc ChunkXz) (s *chunkStoreBeta, regionPath string) {
+	s, err := newChunkStoreBeta(t.TempDir(), DimensionNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writer := s.Writer()
+	setTestChunk(writer, loc, 1, 2)
+	if err = s.WriteChunk(writer); err != nil {
+		t.Fatalf("WriteChunk error: %v", err)
+	}
+
+	regionLoc := regionLocForChunkXz(loc)
+	return s, regionLoc.regionFilePath(s.regionPath)
+}
+
+func TestChunkStoreBeta_Missing(t *testing.T) {
+	s, regionPath := writeTestRegion(t, ChunkXz{0, 0})
+
+	// Present region file, absent chunk.
+	if _, err := s.ReadChunk(ChunkXz{1, 0}); !IsNoSuchChunk(err) {
+		t.Errorf("Expected NoSuchChunkError for chunk not in region, got %v", err)
+	}
+
+	// Absent region file.
+	if _, err := s.ReadChunk(ChunkXz{64, 64}); !IsNoSuchChunk(err) {
+		t.Errorf("Expected NoSuchChunkError for missing region, got %v", err)
+	}
+	otherRegion := regionLocForChunkXz(ChunkXz{64, 64})
+	if _, err := os.Stat(otherRegion.regionFilePath(s.regionPath)); !os.IsNotExist(err) {
+		t.Errorf("Expected reading not to create region file, got %v", err)
+	}
+
+	if reader, err := s.ReadChunk(ChunkXz{0, 0}); err != nil || reader.ChunkLoc() != (ChunkXz{0, 0}) {
+		t.Errorf("Expected chunk to be read back, got %v", err)
+	}
+
+	if _, err := os.Stat(regionPath); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestChunkStoreBeta_Truncated(t *testing.T) {
+	loc := ChunkXz{3, 4}
+
+	// Truncate within the header, within the chunk data header and within
+	// the chunk data (which starts at the third sector).
+	truncations := []func(fileSize int64) int64{
+		func(fileSize int64) int64 { return 100 },
+		func(fileSize int64) int64 { return 2*regionFileSectorSize + 2 },
+		func(fileSize int64) int64 { return fileSize - 16 },
+	}
+
+	for _, truncation := range truncations {
+		_, regionPath := writeTestRegion(t, loc)
+		fi, err := os.Stat(regionPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		size := truncation(fi.Size())
+		if err = os.Truncate(regionPath, size); err != nil {
+			t.Fatal(err)
+		}
+
+		// Use a new store so that the header is read again.
+		s, err := newChunkStoreBeta(path.Dir(path.Dir(regionPath)), DimensionNormal)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		service := NewChunkService(s)
+		go service.Serve()
+		result := <-service.ReadChunk(loc)
+		if _, ok := result.Err.(*ChunkLoadError); !ok {
+			t.Errorf("Truncated to %d bytes: expected ChunkLoadError, got %v", size, result.Err)
+		}
+	}
+}
+
+func TestChunkStoreBeta_WriteService(t *testing.T) {
+	s, err := newChunkStoreBeta(t.TempDir(), DimensionNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewChunkService(s)
+	go service.Serve()
+
+	// Write the chunk twice, so that it is overwritten in place.
+	for i := 0; i < 2; i++ {
+		writer := service.Writer()
+		setTestChunk(writer, ChunkXz{-1, 70}, 42, byte(i))
+		if err = <-service.WriteChunk(writer); err != nil {
+			t.Fatalf("WriteChunk error: %v", err)
+		}
+	}
+
+	result := <-service.ReadChunk(ChunkXz{-1, 70})
+	if result.Err != nil {
+		t.Fatalf("ReadChunk error: %v", result.Err)
+	}
+	if result.Source != ChunkSourceStore {
+		t.Errorf("Expected chunk source to be the store, got %v", result.Source)
+	}
+	if blocks := result.Reader.Blocks(); blocks[0] != 42 || blocks[1] != 1 {
+		t.Errorf("Blocks read back differ from those written")
+	}
+}
+
+func TestChunkStoreBeta_Corrupt(t *testing.T) {
+	loc := ChunkXz{3, 4}
+	s, regionPath := writeTestRegion(t, loc)
+
+	// Overwrite part of the compressed chunk data, which starts at the third
+	// sector.
+	file, err := os.OpenFile(regionPath, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	garbage := []byte{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad, 0xbe, 0xef}
+	if _, err = file.WriteAt(garbage, 2*regionFileSectorSize+chunkDataHeaderSize+2); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	_, err = s.ReadChunk(loc)
+	if corrupt, ok := err.(*CorruptChunkError); !ok || corrupt.ChunkLoc != loc {
+		t.Fatalf("Expected CorruptChunkError, got %v", err)
+	}
+
+	// Nothing should be quarantined without regenerateCorrupt.
+	quarantined, _ := filepath.Glob(filepath.Join(s.quarantinePath, "*"))
+	if len(quarantined) != 0 {
+		t.Errorf("Expected no quarantined files, got %v", quarantined)
+	}
+
+	s.regenerateCorrupt = true
+	if _, err = s.ReadChunk(loc); !IsNoSuchChunk(err) {
+		t.Fatalf("Expected NoSuchChunkError after quarantine, got %v", err)
+	}
+
+	quarantined, _ = filepath.Glob(filepath.Join(s.quarantinePath, "c.3.4.*.mcc"))
+	if len(quarantined) != 1 {
+		t.Fatalf("Expected one quarantined file, got %v", quarantined)
+	}
+	data, err := ioutil.ReadFile(quarantined[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, garbage) {
+		t.Errorf("Expected quarantined data to contain the corrupt chunk")
+	}
+
+	// The chunk is gone, and can be replaced.
+	if _, err = s.ReadChunk(loc); !IsNoSuchChunk(err) {
+		t.Errorf("Expected NoSuchChunkError on second read, got %v", err)
+	}
+	writer := s.Writer()
+	setTestChunk(writer, loc, 7, 8)
+	if err = s.WriteChunk(writer); err != nil {
+		t.Fatal(err)
+	}
+	if reader, err := s.ReadChunk(loc); err != nil || reader.Blocks()[0] != 7 {
+		t.Errorf("Expected replacement chunk to be read, got %v", err)
+	}
+}
+
+func TestChunkStoreBeta_WriteNotInPlace(t *testing.T) {
+	loc := ChunkXz{3, 4}
+	s, regionPath := writeTestRegion(t, loc)
+
+	entry, err := s.regions.acquire(regionLocForChunkXz(loc), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.regions.release(entry)
+	rf := entry.rf
+	firstOffset := rf.offsets.Offset(loc)
+	first, err := rf.RawChunkData(loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The rewritten chunk goes elsewhere, leaving the first copy intact for
+	// if the header had not been updated.
+	writer := s.Writer()
+	setTestChunk(writer, loc, 5, 6)
+	if err = rf.WriteChunkData(writer.(*nbtChunkWriter)); err != nil {
+		t.Fatal(err)
+	}
+	secondOffset := rf.offsets.Offset(loc)
+	if secondOffset == firstOffset {
+		t.Fatalf("Expected chunk to be written to new sectors, got offset 0x%x again", secondOffset)
+	}
+	data, err := ioutil.ReadFile(regionPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, firstIndex := firstOffset.Get()
+	start := int(firstIndex) * regionFileSectorSize
+	if !bytes.Equal(data[start:start+len(first)], first) {
+		t.Errorf("Expected previous chunk data to be left intact")
+	}
+
+	// The first sectors are freed once the file is next synced, so the write
+	// after next reuses them.
+	for i := byte(0); i < 2; i++ {
+		setTestChunk(writer, loc, 9+i, 10)
+		if err = rf.WriteChunkData(writer.(*nbtChunkWriter)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if offset := rf.offsets.Offset(loc); offset != firstOffset {
+		t.Errorf("Expected freed sectors at 0x%x to be reused, got 0x%x", firstOffset, offset)
+	}
+	if reader, err := rf.ReadChunkData(loc); err != nil || reader.Blocks()[0] != 10 {
+		t.Errorf("Expected latest chunk data to be read, got %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package chunkstore
+
+import (
+	"path"
+	"path/filepath"
+
+	. "chunkymonkey/types"
+	"nbt"
+)
+
+// StoredChunkBounds returns the smallest bounds, inclusive, that contain all of
+// the chunks stored in the world for the dimension, going by the files in the
+// store. Region files are taken to be full, so the bounds can include chunks
+// that don't exist. ok is false if no chunks are stored.
+func StoredChunkBounds(worldPath string, levelData nbt.ITag, dimension DimensionId) (min, max ChunkXz, ok bool, err error) {
+	dimPath := dimensionPath(worldPath, dimension)
+
+	var locs []ChunkXz
+	if version, isBeta := nbt.GetInt(levelData, "Data/version"); isBeta {
+		ext := regionFileExt
+		if version == anvilLevelVersion {
+			ext = anvilFileExt
+		}
+		var filenames []string
+		filenames, err = filepath.Glob(path.Join(dimPath, "region", "r.*.*."+ext))
+		if err != nil {
+			return
+		}
+		for _, filename := range filenames {
+			regionLoc, ok := regionLocForFilename(filename)
+			if !ok {
+				continue
+			}
+			first := regionLoc.chunkXz(0)
+			locs = append(locs, first, ChunkXz{first.X + regionFileEdge - 1, first.Z + regionFileEdge - 1})
+		}
+	} else {
+		var chunkFiles []alphaChunkFile
+		if chunkFiles, err = findAlphaChunkFiles(dimPath); err != nil {
+			return
+		}
+		for _, chunkFile := range chunkFiles {
+			locs = append(locs, chunkFile.loc)
+		}
+	}
+
+	for i, loc := range locs {
+		if i == 0 {
+			min, max = loc, loc
+			continue
+		}
+		if loc.X < min.X {
+			min.X = loc.X
+		}
+		if loc.Z < min.Z {
+			min.Z = loc.Z
+		}
+		if loc.X > max.X {
+			max.X = loc.X
+		}
+		if loc.Z > max.Z {
+			max.Z = loc.Z
+		}
+	}
+	ok = len(locs) > 0
+	return
+}
@@ -0,0 +1,47 @@
+package chunkstore
+
+import (
+	"testing"
+
+	. "chunkymonkey/types"
+	"nbt"
+)
+
+func TestStoredChunkBounds(t *testing.T) {
+	alphaLevel, _ := nbt.NewBuilder().
+		PutCompound("Data", nbt.NewBuilder().PutLong("RandomSeed", 1)).
+		Build()
+	betaLevel, _ := nbt.NewBuilder().
+		PutCompound("Data", nbt.NewBuilder().PutInt("version", 19132)).
+		Build()
+
+	// Alpha worlds have a file for each chunk.
+	worldPath := createAlphaWorld(t, []ChunkXz{{-3, 5}, {2, -1}, {0, 0}})
+	min, max, ok, err := StoredChunkBounds(worldPath, alphaLevel, DimensionNormal)
+	if err != nil || !ok || min != (ChunkXz{-3, -1}) || max != (ChunkXz{2, 5}) {
+		t.Errorf("Alpha: expected bounds -3,-1 to 2,5, got %v to %v, %v, %v", min, max, ok, err)
+	}
+
+	// Beta worlds are bounded by their region files.
+	worldPath = t.TempDir()
+	s, err := newChunkStoreBeta(worldPath, DimensionNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, loc := range []ChunkXz{{-1, 0}, {40, 2}} {
+		writer := s.Writer()
+		setTestChunk(writer, loc, 1, 1)
+		if err = s.WriteChunk(writer); err != nil {
+			t.Fatal(err)
+		}
+	}
+	min, max, ok, err = StoredChunkBounds(worldPath, betaLevel, DimensionNormal)
+	if err != nil || !ok || min != (ChunkXz{-32, 0}) || max != (ChunkXz{63, 31}) {
+		t.Errorf("Beta: expected bounds -32,0 to 63,31, got %v to %v, %v, %v", min, max, ok, err)
+	}
+
+	// Other dimensions have their own files.
+	if _, _, ok, err = StoredChunkBounds(worldPath, betaLevel, DimensionNether); ok || err != nil {
+		t.Errorf("Nether: expected no chunks, got %v, %v", ok, err)
+	}
+}
@@ -1,14 +1,20 @@
 package chunkstore
 
 import (
-	"log"
+	"sync"
+	"time"
 
+	"chunkymonkey/logger"
 	. "chunkymonkey/types"
 )
 
 type readRequest struct {
-	chunkLoc     ChunkXz
-	responseChan chan<- ChunkReadResult
+	chunkLoc ChunkXz
+}
+
+type writeRequest struct {
+	writer       IChunkWriter
+	responseChan chan<- error
 }
 
 type IChunkStoreForeground interface {
@@ -18,19 +24,37 @@ type IChunkStoreForeground interface {
 	WriteChunk(writer IChunkWriter) error
 }
 
+// iSourcedChunkStore is implemented by IChunkStoreForeground implementations
+// that can report which kind of backend satisfied a read (e.g MultiStore).
+type iSourcedChunkStore interface {
+	ReadChunkSource(chunkLoc ChunkXz) (reader IChunkReader, source ChunkSource, err error)
+}
+
 // ChunkService adapts an IChunkStoreForeground (which can only be accessed
 // from one goroutine) to an IChunkStore.
+//
+// Concurrent reads of the same chunk are coalesced into a single read from
+// the store, whose result is sent to all of the requesters. The IChunkReader
+// may therefore be shared, and must not be modified unless its arrays can be
+// claimed (see IChunkArrayOwner).
 type ChunkService struct {
 	store  IChunkStoreForeground
 	reads  chan readRequest
-	writes chan IChunkWriter
+	writes chan writeRequest
+	stats  statsRecorder
+
+	// inFlight holds the response channels of the requesters waiting for each
+	// chunk that has been requested from the store.
+	inFlightLock sync.Mutex
+	inFlight     map[ChunkXz][]chan<- ChunkReadResult
 }
 
 func NewChunkService(store IChunkStoreForeground) (s *ChunkService) {
 	return &ChunkService{
-		store:  store,
-		reads:  make(chan readRequest),
-		writes: make(chan IChunkWriter),
+		store:    store,
+		reads:    make(chan readRequest),
+		writes:   make(chan writeRequest),
+		inFlight: make(map[ChunkXz][]chan<- ChunkReadResult),
 	}
 }
 
@@ -38,22 +62,80 @@ func (s *ChunkService) Serve() {
 	for {
 		select {
 		case request := <-s.reads:
-			reader, err := s.store.ReadChunk(request.chunkLoc)
-			request.responseChan <- ChunkReadResult{reader, err}
-		case writer := <-s.writes:
-			if err := s.store.WriteChunk(writer); err != nil {
-				log.Printf("Could not write chunk at %#v: %v", writer.ChunkLoc(), err)
+			result := s.readChunk(request.chunkLoc)
+
+			s.inFlightLock.Lock()
+			waiting := s.inFlight[request.chunkLoc]
+			delete(s.inFlight, request.chunkLoc)
+			s.inFlightLock.Unlock()
+
+			// A reader sent to several requesters is shared by them, so none
+			// may claim its arrays.
+			if owner, ok := result.Reader.(IChunkArrayOwner); ok && len(waiting) > 1 {
+				owner.ClaimArrays()
 			}
+
+			// The response channels are buffered, so this completes even if
+			// the requesters have gone away.
+			for _, responseChan := range waiting {
+				responseChan <- result
+			}
+		case request := <-s.writes:
+			err := s.store.WriteChunk(request.writer)
+			if err != nil {
+				logger.Chunk.Error("Could not write chunk", "chunk", request.writer.ChunkLoc(), "err", err)
+			}
+			request.responseChan <- err
+		}
+	}
+}
+
+func (s *ChunkService) readChunk(chunkLoc ChunkXz) (result ChunkReadResult) {
+	start := time.Now()
+	defer func() {
+		s.stats.record(result.Source, result.Err, -1, time.Since(start))
+	}()
+
+	if sourced, ok := s.store.(iSourcedChunkStore); ok {
+		result.Reader, result.Source, result.Err = sourced.ReadChunkSource(chunkLoc)
+	} else {
+		// Stores that cannot be written to are assumed to be generators.
+		if !s.store.SupportsWrite() {
+			result.Source = ChunkSourceGenerated
+		}
+		result.Reader, result.Err = s.store.ReadChunk(chunkLoc)
+	}
+
+	// Errors other than the chunk not existing are always ChunkLoadErrors.
+	if result.Err != nil {
+		result.Reader = nil
+		switch result.Err.(type) {
+		case NoSuchChunkError, *ChunkLoadError:
+		default:
+			result.Err = &ChunkLoadError{chunkLoc, result.Err}
 		}
 	}
+
+	return
+}
+
+// Stats returns statistics on the chunks read through the service.
+func (s *ChunkService) Stats() ChunkStoreStats {
+	return s.stats.snapshot()
 }
 
 func (s *ChunkService) ReadChunk(chunkLoc ChunkXz) <-chan ChunkReadResult {
-	responseChan := make(chan ChunkReadResult)
+	responseChan := make(chan ChunkReadResult, 1)
 
-	s.reads <- readRequest{
-		chunkLoc:     chunkLoc,
-		responseChan: responseChan,
+	s.inFlightLock.Lock()
+	waiting, pending := s.inFlight[chunkLoc]
+	s.inFlight[chunkLoc] = append(waiting, responseChan)
+	s.inFlightLock.Unlock()
+
+	if pending {
+		s.stats.recordCoalesced()
+	} else {
+		s.reads <- readRequest{chunkLoc}
 	}
 
 	return responseChan
@@ -67,6 +149,14 @@ func (s *ChunkService) Writer() IChunkWriter {
 	return s.store.Writer()
 }
 
-func (s *ChunkService) WriteChunk(writer IChunkWriter) {
-	s.writes <- writer
+func (s *ChunkService) WriteChunk(writer IChunkWriter) <-chan error {
+	// Buffered so that Serve does not block if the result is not wanted.
+	responseChan := make(chan error, 1)
+
+	s.writes <- writeRequest{
+		writer:       writer,
+		responseChan: responseChan,
+	}
+
+	return responseChan
 }
@@ -0,0 +1,107 @@
+package chunkstore
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+
+	. "chunkymonkey/types"
+)
+
+// gatedStore is a fakeStore whose reads block until the gate is closed.
+type gatedStore struct {
+	*fakeStore
+	started chan bool
+	gate    chan bool
+}
+
+func (s *gatedStore) ReadChunk(chunkLoc ChunkXz) (reader IChunkReader, err error) {
+	s.started <- true
+	<-s.gate
+	return s.fakeStore.ReadChunk(chunkLoc)
+}
+
+func newGatedService() (service *ChunkService, store *gatedStore) {
+	store = &gatedStore{
+		fakeStore: newFakeStore(true),
+		started:   make(chan bool, 1),
+		gate:      make(chan bool),
+	}
+	service = NewChunkService(store)
+	go service.Serve()
+	return
+}
+
+func (s *ChunkService) numWaiting(chunkLoc ChunkXz) int {
+	s.inFlightLock.Lock()
+	defer s.inFlightLock.Unlock()
+	return len(s.inFlight[chunkLoc])
+}
+
+func TestChunkService_Coalesce(t *testing.T) {
+	service, store := newGatedService()
+	loc := ChunkXz{4, 5}
+
+	const numRequesters = 100
+	results := make(chan ChunkReadResult, numRequesters)
+	var wg sync.WaitGroup
+
+	// Hold the first read in the store until all requests are waiting.
+	first := service.ReadChunk(loc)
+	<-store.started
+	for i := 1; i < numRequesters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- <-service.ReadChunk(loc)
+		}()
+	}
+	for service.numWaiting(loc) < numRequesters {
+		// Busy wait for the goroutines to make their requests.
+		runtime.Gosched()
+	}
+	close(store.gate)
+
+	results <- <-first
+	wg.Wait()
+	close(results)
+
+	for result := range results {
+		if result.Err != nil || result.Reader.ChunkLoc() != loc {
+			t.Errorf("Unexpected result %+v", result)
+		}
+	}
+
+	if store.reads != 1 {
+		t.Errorf("Expected 1 read from the store, got %d", store.reads)
+	}
+	if stats := service.Stats(); stats.Requests != 1 || stats.Coalesced != numRequesters-1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	// Later reads are not coalesced with the completed read.
+	<-service.ReadChunk(loc)
+	if store.reads != 2 {
+		t.Errorf("Expected a second read from the store, got %d reads", store.reads)
+	}
+}
+
+func TestChunkService_AbandonedRead(t *testing.T) {
+	service, store := newGatedService()
+	loc := ChunkXz{1, 1}
+
+	// Nobody waits for the result of the first read, yet the service must
+	// complete it and carry on serving.
+	service.ReadChunk(loc)
+	<-store.started
+	close(store.gate)
+
+	done := make(chan ChunkReadResult)
+	go func() {
+		done <- <-service.ReadChunk(ChunkXz{2, 2})
+	}()
+	<-store.started
+	if result := <-done; result.Err != nil {
+		t.Errorf("Read after abandoned read failed: %v", result.Err)
+	}
+}
@@ -0,0 +1,230 @@
+package chunkstore
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	. "chunkymonkey/types"
+	"nbt"
+)
+
+// regionLevelVersion is the level.dat version of worlds in the McRegion
+// (Beta) format.
+const regionLevelVersion = 19132
+
+// ConvertOptions control ConvertAlphaToRegion.
+type ConvertOptions struct {
+	// DeleteOriginals removes the Alpha chunk files once the world has been
+	// converted.
+	DeleteOriginals bool
+
+	// Progress, if not nil, is called after each chunk file is processed.
+	Progress func(progress ConvertProgress)
+}
+
+// ConvertProgress counts the chunk files processed by ConvertAlphaToRegion.
+type ConvertProgress struct {
+	Total     int // Chunk files found.
+	Converted int // Chunks written to region files.
+	Skipped   int // Chunks already present in region files (e.g when resuming).
+	Failed    int // Chunks that could not be converted.
+}
+
+// ConvertAlphaToRegion converts the Alpha world at worldPath, with a file per
+// chunk, to the McRegion format. Each chunk is verified by reading it back
+// from its region file. Only once all chunks have been converted is the
+// version in level.dat updated. Chunks already in the region files are
+// skipped, so an interrupted conversion can be resumed by running it again.
+func ConvertAlphaToRegion(worldPath string, options ConvertOptions) (progress ConvertProgress, err error) {
+	levelFilename := path.Join(worldPath, "level.dat")
+	levelData, err := readLevelData(levelFilename)
+	if err != nil {
+		return
+	}
+
+	chunkFiles, err := findAlphaChunkFiles(worldPath)
+	if err != nil {
+		return
+	}
+	progress.Total = len(chunkFiles)
+
+	alphaStore, err := newChunkStoreAlpha(worldPath, DimensionNormal)
+	if err != nil {
+		return
+	}
+	regionStore, err := newChunkStoreBeta(worldPath, DimensionNormal)
+	if err != nil {
+		return
+	}
+	defer regionStore.regions.closeAll()
+
+	var firstErr error
+	for _, chunkFile := range chunkFiles {
+		skipped, err := convertAlphaChunk(alphaStore, regionStore, chunkFile.loc)
+		switch {
+		case err != nil:
+			progress.Failed++
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %v", chunkFile.filename, err)
+			}
+		case skipped:
+			progress.Skipped++
+		default:
+			progress.Converted++
+		}
+
+		if options.Progress != nil {
+			options.Progress(progress)
+		}
+	}
+
+	if progress.Failed > 0 {
+		err = fmt.Errorf("%d of %d chunks failed to convert, first error: %v", progress.Failed, progress.Total, firstErr)
+		return
+	}
+
+	if err = levelData.Set("Data/version", &nbt.Int{regionLevelVersion}); err != nil {
+		return
+	}
+	if err = writeLevelData(levelFilename, levelData); err != nil {
+		return
+	}
+
+	if options.DeleteOriginals {
+		for _, chunkFile := range chunkFiles {
+			if err = os.Remove(chunkFile.filename); err != nil {
+				return
+			}
+		}
+		removeEmptyAlphaDirs(worldPath)
+	}
+
+	return
+}
+
+type alphaChunkFile struct {
+	filename string
+	loc      ChunkXz
+}
+
+// findAlphaChunkFiles finds the chunk files of an Alpha world, which are
+// named c.<x>.<z>.dat within two levels of directories.
+func findAlphaChunkFiles(worldPath string) (chunkFiles []alphaChunkFile, err error) {
+	filenames, err := filepath.Glob(filepath.Join(worldPath, "*", "*", "c.*.*.dat"))
+	if err != nil {
+		return
+	}
+	sort.Strings(filenames)
+
+	for _, filename := range filenames {
+		parts := strings.Split(filepath.Base(filename), ".")
+		if len(parts) != 4 {
+			continue
+		}
+		x, errX := strconv.ParseInt(parts[1], 36, 32)
+		z, errZ := strconv.ParseInt(parts[2], 36, 32)
+		if errX != nil || errZ != nil {
+			continue
+		}
+		chunkFiles = append(chunkFiles, alphaChunkFile{filename, ChunkXz{ChunkCoord(x), ChunkCoord(z)}})
+	}
+
+	return
+}
+
+// convertAlphaChunk copies a chunk from the Alpha store to the region store,
+// unless the region store already has an identical copy.
+func convertAlphaChunk(alphaStore *chunkStoreAlpha, regionStore *chunkStoreBeta, loc ChunkXz) (skipped bool, err error) {
+	reader, err := alphaStore.readChunk(loc)
+	if err != nil {
+		return
+	}
+	chunkTag := reader.RootTag().(*nbt.Compound)
+
+	expected := new(bytes.Buffer)
+	if err = nbt.Write(expected, chunkTag); err != nil {
+		return
+	}
+
+	if matches, _ := regionChunkMatches(regionStore, loc, expected.Bytes()); matches {
+		return true, nil
+	}
+
+	if err = regionStore.WriteChunk(&nbtChunkWriter{loc: loc, chunkTag: chunkTag}); err != nil {
+		return
+	}
+
+	matches, err := regionChunkMatches(regionStore, loc, expected.Bytes())
+	if err == nil && !matches {
+		err = fmt.Errorf("chunk read back from region file differs")
+	}
+	return
+}
+
+// regionChunkMatches returns true if the chunk in the region store has the
+// given NBT data.
+func regionChunkMatches(regionStore *chunkStoreBeta, loc ChunkXz, expected []byte) (matches bool, err error) {
+	reader, err := regionStore.ReadChunk(loc)
+	if err != nil {
+		return
+	}
+
+	actual := new(bytes.Buffer)
+	if err = nbt.Write(actual, reader.RootTag().(*nbt.Compound)); err != nil {
+		return
+	}
+
+	return bytes.Equal(expected, actual.Bytes()), nil
+}
+
+// removeEmptyAlphaDirs removes the chunk directories of an Alpha world that
+// are now empty. These are named with the base36 chunk coordinates modulo 64.
+func removeEmptyAlphaDirs(worldPath string) {
+	innerDirs, _ := filepath.Glob(filepath.Join(worldPath, "*", "*"))
+	outerDirs, _ := filepath.Glob(filepath.Join(worldPath, "*"))
+	for _, dir := range append(innerDirs, outerDirs...) {
+		name := filepath.Base(dir)
+		if n, err := strconv.ParseInt(name, 36, 32); err != nil || n < 0 || n >= 64 {
+			continue
+		}
+		// Fails harmlessly for non-empty directories.
+		os.Remove(dir)
+	}
+}
+
+func readLevelData(filename string) (levelData *nbt.Compound, err error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	return nbt.ReadCompressed(file)
+}
+
+// writeLevelData replaces level.dat, via a temporary file so that it is never
+// left partially written.
+func writeLevelData(filename string, levelData *nbt.Compound) (err error) {
+	tempFilename := filename + ".tmp"
+	file, err := os.OpenFile(tempFilename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return
+	}
+
+	err = nbt.WriteCompressed(file, levelData, nbt.CompressionGzip)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempFilename)
+		return
+	}
+
+	return os.Rename(tempFilename, filename)
+}
@@ -0,0 +1,159 @@
+package chunkstore
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	. "chunkymonkey/types"
+	"nbt"
+)
+
+// createAlphaWorld creates an Alpha world containing chunks at the given
+// locations.
+func createAlphaWorld(t *testing.T, locs []ChunkXz) (worldPath string) {
+	worldPath = t.TempDir()
+
+	levelData, _ := nbt.NewBuilder().
+		PutCompound("Data", nbt.NewBuilder().
+			PutLong("RandomSeed", 1).
+			PutString("LevelName", "alpha")).
+		Build()
+	if err := writeLevelData(path.Join(worldPath, "level.dat"), levelData); err != nil {
+		t.Fatal(err)
+	}
+
+	alphaStore, err := newChunkStoreAlpha(worldPath, DimensionNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, loc := range locs {
+		writer := alphaStore.Writer()
+		setTestChunk(writer, loc, byte(i), 1)
+		if err = alphaStore.WriteChunk(writer); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return
+}
+
+func TestConvertAlphaToRegion(t *testing.T) {
+	locs := []ChunkXz{{0, 0}, {1, 0}, {-1, -1}, {63, 64}, {-100, 37}}
+	worldPath := createAlphaWorld(t, locs)
+	alphaStore, _ := newChunkStoreAlpha(worldPath, DimensionNormal)
+
+	var progressCalls int
+	progress, err := ConvertAlphaToRegion(worldPath, ConvertOptions{
+		Progress: func(ConvertProgress) { progressCalls++ },
+	})
+	if err != nil {
+		t.Fatalf("Convert error: %v", err)
+	}
+	if progress != (ConvertProgress{Total: 5, Converted: 5}) || progressCalls != 5 {
+		t.Errorf("Unexpected progress %+v after %d calls", progress, progressCalls)
+	}
+
+	regionStore, err := newChunkStoreBeta(worldPath, DimensionNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, loc := range locs {
+		reader, err := regionStore.ReadChunk(loc)
+		if err != nil {
+			t.Errorf("Chunk %v: read error: %v", loc, err)
+			continue
+		}
+		if reader.Blocks()[0] != byte(i) {
+			t.Errorf("Chunk %v: wrong data", loc)
+		}
+		if original, err := alphaStore.ReadChunk(loc); err != nil {
+			t.Errorf("Chunk %v: original read error: %v", loc, err)
+		} else if ChunkHash(original) != ChunkHash(reader) {
+			t.Errorf("Chunk %v: hash changed by conversion", loc)
+		}
+
+		// The originals are left in place.
+		if _, err = os.Stat(alphaStore.chunkPath(loc)); err != nil {
+			t.Errorf("Chunk %v: original removed: %v", loc, err)
+		}
+	}
+
+	levelData, err := readLevelData(path.Join(worldPath, "level.dat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, ok := nbt.GetInt(levelData, "Data/version"); !ok || version != regionLevelVersion {
+		t.Errorf("Expected level version %d, got %d", regionLevelVersion, version)
+	}
+	if name, _ := nbt.GetString(levelData, "Data/LevelName"); name != "alpha" {
+		t.Errorf("Expected other level data to be kept, got LevelName %q", name)
+	}
+
+	// Converting again skips all the chunks, and deletes the originals.
+	progress, err = ConvertAlphaToRegion(worldPath, ConvertOptions{DeleteOriginals: true})
+	if err != nil {
+		t.Fatalf("Second convert error: %v", err)
+	}
+	if progress != (ConvertProgress{Total: 5, Skipped: 5}) {
+		t.Errorf("Unexpected progress on second conversion %+v", progress)
+	}
+	for _, loc := range locs {
+		if _, err = os.Stat(path.Dir(alphaStore.chunkPath(loc))); !os.IsNotExist(err) {
+			t.Errorf("Chunk %v: expected original directory to be removed, got %v", loc, err)
+		}
+	}
+	if _, err = os.Stat(path.Join(worldPath, "region")); err != nil {
+		t.Errorf("Region directory: %v", err)
+	}
+}
+
+func TestConvertAlphaToRegion_Resume(t *testing.T) {
+	locs := []ChunkXz{{0, 0}, {5, 5}}
+	worldPath := createAlphaWorld(t, locs)
+
+	// Simulate an interrupted conversion, with the first chunk converted.
+	alphaStore, _ := newChunkStoreAlpha(worldPath, DimensionNormal)
+	regionStore, _ := newChunkStoreBeta(worldPath, DimensionNormal)
+	if _, err := convertAlphaChunk(alphaStore, regionStore, locs[0]); err != nil {
+		t.Fatal(err)
+	}
+	regionStore.regions.closeAll()
+
+	progress, err := ConvertAlphaToRegion(worldPath, ConvertOptions{})
+	if err != nil {
+		t.Fatalf("Convert error: %v", err)
+	}
+	if progress != (ConvertProgress{Total: 2, Converted: 1, Skipped: 1}) {
+		t.Errorf("Unexpected progress %+v", progress)
+	}
+}
+
+func TestConvertAlphaToRegion_Failure(t *testing.T) {
+	locs := []ChunkXz{{0, 0}, {2, 3}}
+	worldPath := createAlphaWorld(t, locs)
+
+	alphaStore, _ := newChunkStoreAlpha(worldPath, DimensionNormal)
+	if err := os.Truncate(alphaStore.chunkPath(locs[1]), 10); err != nil {
+		t.Fatal(err)
+	}
+
+	progress, err := ConvertAlphaToRegion(worldPath, ConvertOptions{DeleteOriginals: true})
+	if err == nil {
+		t.Fatalf("Expected error converting corrupt chunk")
+	}
+	if progress != (ConvertProgress{Total: 2, Converted: 1, Failed: 1}) {
+		t.Errorf("Unexpected progress %+v", progress)
+	}
+
+	// The level is not marked as converted, and nothing is deleted.
+	levelData, _ := readLevelData(path.Join(worldPath, "level.dat"))
+	if _, ok := nbt.GetInt(levelData, "Data/version"); ok {
+		t.Errorf("Expected level version not to be set")
+	}
+	for _, loc := range locs {
+		if _, err = os.Stat(alphaStore.chunkPath(loc)); err != nil {
+			t.Errorf("Chunk %v: original removed: %v", loc, err)
+		}
+	}
+}
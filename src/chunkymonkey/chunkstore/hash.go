@@ -0,0 +1,23 @@
+package chunkstore
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+)
+
+// ChunkHash returns a hash of the blocks, block data and biomes of a chunk,
+// as a hex string. It doesn't cover lighting or the height map, which can be
+// recalculated, nor entities. Chunks with the same content hash the same
+// whichever store they were read from, so it can check that a chunk survives
+// a round trip through a store, or that a generator's output is unchanged.
+func ChunkHash(reader IChunkReader) string {
+	hash := sha1.New()
+	for _, section := range [][]byte{reader.Blocks(), reader.BlockData(), reader.Biomes()} {
+		// Prefix each section with its length, so that a missing section (such
+		// as biomes) can't be confused with a change in another.
+		binary.Write(hash, binary.BigEndian, uint32(len(section)))
+		hash.Write(section)
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
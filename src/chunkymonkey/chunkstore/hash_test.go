@@ -0,0 +1,38 @@
+package chunkstore
+
+import (
+	"testing"
+
+	. "chunkymonkey/types"
+)
+
+func TestChunkHash(t *testing.T) {
+	loc := ChunkXz{3, -4}
+	read := func(block0 byte, biomes []byte) IChunkReader {
+		store := NewMemoryStore()
+		writer := store.Writer()
+		setTestChunk(writer, loc, block0, 1)
+		if biomes != nil {
+			writer.SetBiomes(biomes)
+		}
+		if err := store.WriteChunk(writer); err != nil {
+			t.Fatal(err)
+		}
+		reader, err := store.ReadChunk(loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return reader
+	}
+
+	hash := ChunkHash(read(1, nil))
+	if again := ChunkHash(read(1, nil)); again != hash {
+		t.Errorf("Same chunk hashed differently: %s and %s", hash, again)
+	}
+	if changed := ChunkHash(read(2, nil)); changed == hash {
+		t.Error("Changing a block didn't change the hash")
+	}
+	if withBiomes := ChunkHash(read(1, make([]byte, ChunkBiomesSize))); withBiomes == hash {
+		t.Error("Adding biomes didn't change the hash")
+	}
+}
@@ -0,0 +1,45 @@
+package chunkstore
+
+import (
+	"fmt"
+
+	. "chunkymonkey/types"
+	"nbt"
+)
+
+// MemoryStore is an IChunkStoreForeground that keeps chunks in memory, for
+// tests and other transient worlds.
+type MemoryStore struct {
+	chunks map[ChunkXz]*nbt.Compound
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		chunks: make(map[ChunkXz]*nbt.Compound),
+	}
+}
+
+func (s *MemoryStore) ReadChunk(chunkLoc ChunkXz) (reader IChunkReader, err error) {
+	chunkTag, ok := s.chunks[chunkLoc]
+	if !ok {
+		return nil, NoSuchChunkError(false)
+	}
+	return &nbtChunkReader{chunkTag: chunkTag}, nil
+}
+
+func (s *MemoryStore) SupportsWrite() bool {
+	return true
+}
+
+func (s *MemoryStore) Writer() IChunkWriter {
+	return newNbtChunkWriter()
+}
+
+func (s *MemoryStore) WriteChunk(writer IChunkWriter) error {
+	nbtWriter, ok := writer.(*nbtChunkWriter)
+	if !ok {
+		return fmt.Errorf("%T is incorrect IChunkWriter implementation for %T", writer, s)
+	}
+	s.chunks[nbtWriter.ChunkLoc()] = nbtWriter.RootTag()
+	return nil
+}
@@ -1,45 +1,151 @@
 package chunkstore
 
 import (
-	"errors"
+	"time"
 
+	"chunkymonkey/gamerules"
+	"chunkymonkey/logger"
 	. "chunkymonkey/types"
 )
 
+// FallbackPolicy controls what MultiStore does with chunks that were not found
+// in its write store, and were instead read from a fallback store (typically
+// a generator).
+type FallbackPolicy int
+
+const (
+	// PersistOnModify leaves fallback chunks to be written to the write store
+	// by their owner when they are first modified.
+	PersistOnModify = FallbackPolicy(iota)
+	// PersistOnGenerate writes fallback chunks to the write store as soon as
+	// they are read, so that they are not generated again.
+	PersistOnGenerate
+)
+
 // MultiStore provides the ability to load a chunk from one or more potential
 // sources of chunk data. The primary purpose of this is to read from a
 // persistant store first, then fall back to generating a chunk if the
 // persistant store does not have it. MultiStore implements IChunkStore.
+//
+// Only a NoSuchChunkError causes the next store to be tried. Any other error
+// (e.g an I/O error in the persistant store) is returned rather than masked by
+// generating the chunk.
+//
+// Writes go to the first of the stores that supports writes, referred to as
+// the write store.
 type MultiStore struct {
 	readStores []IChunkStore
 	writeStore IChunkStore
+	policy     FallbackPolicy
+	stats      statsRecorder
 }
 
-func NewMultiStore(readStores []IChunkStore, writeStore IChunkStore) *MultiStore {
+func NewMultiStore(readStores []IChunkStore, policy FallbackPolicy) *MultiStore {
 	s := &MultiStore{
 		readStores: readStores,
-		writeStore: writeStore,
+		policy:     policy,
+	}
+	s.stats.numBackends = len(readStores)
+
+	for _, store := range readStores {
+		if store.SupportsWrite() {
+			s.writeStore = store
+			break
+		}
 	}
 
 	return s
 }
 
 func (s *MultiStore) ReadChunk(chunkLoc ChunkXz) (reader IChunkReader, err error) {
-	for _, store := range s.readStores {
+	reader, _, err = s.ReadChunkSource(chunkLoc)
+	return
+}
+
+// ReadChunkSource reads the chunk as ReadChunk does, and also returns the
+// kind of backend that it was read from. Chunks read from any store other
+// than the write store are considered to be generated.
+func (s *MultiStore) ReadChunkSource(chunkLoc ChunkXz) (reader IChunkReader, source ChunkSource, err error) {
+	start := time.Now()
+	backend := -1
+	defer func() {
+		s.stats.record(source, err, backend, time.Since(start))
+	}()
+
+	for i, store := range s.readStores {
 		result := <-store.ReadChunk(chunkLoc)
 
 		if result.Err == nil {
-			return result.Reader, result.Err
+			backend = i
+			if store == s.writeStore {
+				return result.Reader, result.Source, nil
+			}
+			if s.policy == PersistOnGenerate {
+				s.persist(result.Reader)
+			}
+			return result.Reader, ChunkSourceGenerated, nil
 		} else {
-			if _, ok := result.Err.(NoSuchChunkError); ok {
+			if IsNoSuchChunk(result.Err) {
 				// Fall through to next chunk store.
 				continue
 			}
-			return nil, result.Err
+			return nil, result.Source, result.Err
 		}
 	}
 
-	return nil, NoSuchChunkError(false)
+	return nil, ChunkSourceStore, NoSuchChunkError(false)
+}
+
+// Stats returns statistics on the chunks read through the MultiStore,
+// including how many were read from each of its read stores.
+func (s *MultiStore) Stats() ChunkStoreStats {
+	return s.stats.snapshot()
+}
+
+// persist writes a chunk read from a fallback store to the write store.
+func (s *MultiStore) persist(reader IChunkReader) {
+	if !s.SupportsWrite() {
+		return
+	}
+
+	writer := s.writeStore.Writer()
+	if writer == nil {
+		logger.Chunk.Warn("Could not persist generated chunk: no writer", "chunk", reader.ChunkLoc())
+		return
+	}
+	// The write store may keep the arrays that it is given, so they are no
+	// longer the reader's alone.
+	if owner, ok := reader.(IChunkArrayOwner); ok {
+		owner.ClaimArrays()
+	}
+	copyChunk(reader, writer)
+	// Any error is logged by the write store.
+	s.writeStore.WriteChunk(writer)
+}
+
+// copyChunk copies the chunk data from reader into writer.
+func copyChunk(reader IChunkReader, writer IChunkWriter) {
+	writer.SetChunkLoc(reader.ChunkLoc())
+	writer.SetBlocks(reader.Blocks())
+	writer.SetBlockData(reader.BlockData())
+	writer.SetBlockLight(reader.BlockLight())
+	writer.SetSkyLight(reader.SkyLight())
+	writer.SetHeightMap(reader.HeightMap())
+	writer.SetBiomes(reader.Biomes())
+
+	// The writer only uses the values of these maps, so the keys are
+	// arbitrary.
+	entities := make(map[EntityId]gamerules.INonPlayerEntity)
+	for i, entity := range reader.Entities() {
+		entities[EntityId(i)] = entity
+	}
+	writer.SetEntities(entities)
+
+	tileEntities := make(map[BlockIndex]gamerules.ITileEntity)
+	for i, tileEntity := range reader.TileEntities() {
+		tileEntities[BlockIndex(i)] = tileEntity
+	}
+	writer.SetTileEntities(tileEntities)
 }
 
 func (s *MultiStore) SupportsWrite() bool {
@@ -53,10 +159,10 @@ func (s *MultiStore) Writer() IChunkWriter {
 	return nil
 }
 
+// WriteChunk writes to the write store, and waits for the write to complete.
 func (s *MultiStore) WriteChunk(writer IChunkWriter) error {
 	if s.writeStore == nil {
-		return errors.New("writes not supported")
+		return ErrReadOnlyStore
 	}
-	s.writeStore.WriteChunk(writer)
-	return nil
+	return <-s.writeStore.WriteChunk(writer)
 }
@@ -0,0 +1,186 @@
+package chunkstore
+
+import (
+	"errors"
+	"testing"
+
+	"chunkymonkey/gamerules"
+	. "chunkymonkey/types"
+	"nbt"
+)
+
+// fakeChunk implements both IChunkReader and IChunkWriter.
+type fakeChunk struct {
+	loc    ChunkXz
+	blocks []byte
+}
+
+func (c *fakeChunk) ChunkLoc() ChunkXz                                    { return c.loc }
+func (c *fakeChunk) Blocks() []byte                                       { return c.blocks }
+func (c *fakeChunk) BlockData() []byte                                    { return nil }
+func (c *fakeChunk) BlockLight() []byte                                   { return nil }
+func (c *fakeChunk) SkyLight() []byte                                     { return nil }
+func (c *fakeChunk) HeightMap() []byte                                    { return nil }
+func (c *fakeChunk) Biomes() []byte                                       { return nil }
+func (c *fakeChunk) Entities() []gamerules.INonPlayerEntity               { return nil }
+func (c *fakeChunk) TileEntities() []gamerules.ITileEntity                { return nil }
+func (c *fakeChunk) RootTag() nbt.ITag                                    { return nil }
+func (c *fakeChunk) SetChunkLoc(loc ChunkXz)                              { c.loc = loc }
+func (c *fakeChunk) SetBlocks(blocks []byte)                              { c.blocks = cloneByteArray(blocks) }
+func (c *fakeChunk) SetBlockData(blockData []byte)                        {}
+func (c *fakeChunk) SetBlockLight(blockLight []byte)                      {}
+func (c *fakeChunk) SetSkyLight(skyLight []byte)                          {}
+func (c *fakeChunk) SetHeightMap(heightMap []byte)                        {}
+func (c *fakeChunk) SetBiomes(biomes []byte)                              {}
+func (c *fakeChunk) SetEntities(map[EntityId]gamerules.INonPlayerEntity)  {}
+func (c *fakeChunk) SetTileEntities(map[BlockIndex]gamerules.ITileEntity) {}
+
+// fakeStore is an in-memory IChunkStoreForeground. If generate is set, it
+// creates any chunk that is read and does not support writes.
+type fakeStore struct {
+	chunks   map[ChunkXz]*fakeChunk
+	generate bool
+	err      error
+	reads    int
+}
+
+func newFakeStore(generate bool) *fakeStore {
+	return &fakeStore{
+		chunks:   make(map[ChunkXz]*fakeChunk),
+		generate: generate,
+	}
+}
+
+func (s *fakeStore) ReadChunk(chunkLoc ChunkXz) (reader IChunkReader, err error) {
+	s.reads++
+	if s.err != nil {
+		return nil, s.err
+	}
+	if s.generate {
+		return &fakeChunk{chunkLoc, []byte{1, 2, 3}}, nil
+	}
+	if chunk, ok := s.chunks[chunkLoc]; ok {
+		return chunk, nil
+	}
+	return nil, NoSuchChunkError(false)
+}
+
+func (s *fakeStore) SupportsWrite() bool {
+	return !s.generate
+}
+
+func (s *fakeStore) Writer() IChunkWriter {
+	return &fakeChunk{}
+}
+
+func (s *fakeStore) WriteChunk(writer IChunkWriter) error {
+	if s.generate {
+		return ErrReadOnlyStore
+	}
+	chunk := writer.(*fakeChunk)
+	s.chunks[chunk.loc] = chunk
+	return nil
+}
+
+func serve(store IChunkStoreForeground) IChunkStore {
+	service := NewChunkService(store)
+	go service.Serve()
+	return service
+}
+
+// newTestMultiStore returns a MultiStore service reading from a persistant
+// store and a generator, and the underlying stores.
+func newTestMultiStore(policy FallbackPolicy) (store IChunkStore, persistant, generator *fakeStore) {
+	persistant, generator = newFakeStore(false), newFakeStore(true)
+	store = serve(NewMultiStore([]IChunkStore{serve(persistant), serve(generator)}, policy))
+	return
+}
+
+func TestMultiStore_PersistOnModify(t *testing.T) {
+	store, persistant, generator := newTestMultiStore(PersistOnModify)
+	loc := ChunkXz{1, 2}
+
+	for i := 0; i < 2; i++ {
+		result := <-store.ReadChunk(loc)
+		if result.Err != nil || result.Source != ChunkSourceGenerated {
+			t.Fatalf("read %d: expected generated chunk, got %v, %v", i, result.Source, result.Err)
+		}
+	}
+
+	if generator.reads != 2 {
+		t.Errorf("Expected chunk to be generated twice, got %d", generator.reads)
+	}
+	if len(persistant.chunks) != 0 {
+		t.Errorf("Expected no chunks to be persisted, got %d", len(persistant.chunks))
+	}
+}
+
+func TestMultiStore_PersistOnGenerate(t *testing.T) {
+	store, persistant, generator := newTestMultiStore(PersistOnGenerate)
+	loc := ChunkXz{1, 2}
+
+	result := <-store.ReadChunk(loc)
+	if result.Err != nil || result.Source != ChunkSourceGenerated {
+		t.Fatalf("Expected generated chunk, got %v, %v", result.Source, result.Err)
+	}
+
+	result = <-store.ReadChunk(loc)
+	if result.Err != nil || result.Source != ChunkSourceStore {
+		t.Fatalf("Expected stored chunk, got %v, %v", result.Source, result.Err)
+	}
+	if blocks := result.Reader.Blocks(); len(blocks) != 3 || blocks[2] != 3 {
+		t.Errorf("Expected generated blocks to be stored, got %v", blocks)
+	}
+
+	if generator.reads != 1 {
+		t.Errorf("Expected chunk to be generated once, got %d", generator.reads)
+	}
+	if _, ok := persistant.chunks[loc]; !ok {
+		t.Errorf("Expected chunk to be persisted")
+	}
+}
+
+func TestMultiStore_Error(t *testing.T) {
+	store, persistant, generator := newTestMultiStore(PersistOnGenerate)
+	persistant.err = errors.New("disk on fire")
+
+	result := <-store.ReadChunk(ChunkXz{0, 0})
+	if loadErr, ok := result.Err.(*ChunkLoadError); !ok || loadErr.Err != persistant.err {
+		t.Errorf("Expected ChunkLoadError for persistant store error, got %v", result.Err)
+	}
+	if generator.reads != 0 {
+		t.Errorf("Expected generator not to be used after an error")
+	}
+}
+
+func TestMultiStore_Write(t *testing.T) {
+	generator, persistant := newFakeStore(true), newFakeStore(false)
+	// The generator is first, but cannot be written to.
+	store := serve(NewMultiStore([]IChunkStore{serve(generator), serve(persistant)}, PersistOnModify))
+
+	writer := store.Writer()
+	writer.SetChunkLoc(ChunkXz{5, 6})
+	if err := <-store.WriteChunk(writer); err != nil {
+		t.Fatalf("WriteChunk error: %v", err)
+	}
+	if _, ok := persistant.chunks[ChunkXz{5, 6}]; !ok {
+		t.Errorf("Expected chunk to be written to the writable store")
+	}
+}
+
+func TestMultiStore_ReadOnly(t *testing.T) {
+	store := serve(NewMultiStore([]IChunkStore{serve(newFakeStore(true))}, PersistOnGenerate))
+
+	if store.SupportsWrite() {
+		t.Errorf("Expected MultiStore of generators not to support writes")
+	}
+	if err := <-store.WriteChunk(&fakeChunk{}); err != ErrReadOnlyStore {
+		t.Errorf("Expected ErrReadOnlyStore, got %v", err)
+	}
+
+	// Generated chunks are still readable, despite there being nowhere to
+	// persist them.
+	if result := <-store.ReadChunk(ChunkXz{0, 0}); result.Err != nil {
+		t.Errorf("ReadChunk error: %v", result.Err)
+	}
+}
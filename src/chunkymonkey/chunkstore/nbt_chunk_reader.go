@@ -1,10 +1,13 @@
 package chunkstore
 
 import (
+	"fmt"
 	"io"
-	"log"
+	"strings"
+	"sync/atomic"
 
 	"chunkymonkey/gamerules"
+	"chunkymonkey/logger"
 	. "chunkymonkey/types"
 	"nbt"
 )
@@ -12,22 +15,130 @@ import (
 // Returned to chunks to pull their data from.
 type nbtChunkReader struct {
 	chunkTag nbt.ITag
+	// unclaimed is 1 while the reader's arrays were freshly decoded for it
+	// and haven't yet been claimed by ClaimArrays.
+	unclaimed int32
 }
 
-// Load a chunk from its NBT representation
+// chunkLevelTags are the tags within a chunk's Level compound that
+// nbtChunkReader reads.
+var chunkLevelTags = map[string]bool{
+	"xPos":         true,
+	"zPos":         true,
+	"Blocks":       true,
+	"Data":         true,
+	"BlockLight":   true,
+	"SkyLight":     true,
+	"HeightMap":    true,
+	"Biomes":       true,
+	"Entities":     true,
+	"TileEntities": true,
+}
+
+// chunkTagVisitor decodes the named tags within a chunk's Level compound into
+// chunkTag, and skips everything else without building its tree.
+type chunkTagVisitor struct {
+	levelTags map[string]bool
+	chunkTag  *nbt.Compound
+}
+
+func (v *chunkTagVisitor) Enter(path string, tagType nbt.TagType) nbt.VisitAction {
+	if path == "Level" && tagType == nbt.TagCompound {
+		return nbt.VisitDescend
+	}
+	if strings.HasPrefix(path, "Level/") && v.levelTags[path[len("Level/"):]] {
+		return nbt.VisitDecode
+	}
+	return nbt.VisitSkip
+}
+
+func (v *chunkTagVisitor) Tag(path string, tag nbt.ITag) {
+	// Level is always created as a compound, so this can't fail.
+	v.chunkTag.Set(path, tag)
+}
+
+// decodeChunkTag decodes the tags in levelTags from a chunk's NBT, with limits
+// on how much is read as the data is untrusted. The other tags of the chunk
+// aren't decoded.
+func decodeChunkTag(reader io.Reader, levelTags map[string]bool) (chunkTag *nbt.Compound, err error) {
+	visitor := &chunkTagVisitor{
+		levelTags: levelTags,
+		chunkTag:  nbt.NewCompound(),
+	}
+	if err = nbt.NewDecoder(reader, nbt.DefaultLimits).Visit(visitor); err != nil {
+		return nil, err
+	}
+	return visitor.chunkTag, nil
+}
+
+// Load a chunk from its NBT representation. The data is untrusted, so limits
+// are placed on how much is decoded, only the tags that the reader uses are
+// decoded, and the chunk is validated.
 func newNbtChunkReader(reader io.Reader) (r *nbtChunkReader, err error) {
-	chunkTag, err := nbt.Read(reader)
+	chunkTag, err := decodeChunkTag(reader, chunkLevelTags)
 	if err != nil {
 		return
 	}
 
+	return nbtChunkReaderForTag(chunkTag)
+}
+
+// nbtChunkReaderForTag returns a reader of the chunk's decoded NBT, once it
+// has been validated. The reader owns the tag's arrays, so chunkTag must not
+// be kept by anything else.
+func nbtChunkReaderForTag(chunkTag *nbt.Compound) (r *nbtChunkReader, err error) {
+	if err = validateChunkTag(chunkTag); err != nil {
+		return
+	}
+
 	r = &nbtChunkReader{
-		chunkTag: chunkTag,
+		chunkTag:  chunkTag,
+		unclaimed: 1,
 	}
 
 	return
 }
 
+// ClaimArrays implements IChunkArrayOwner. Readers of freshly decoded chunks
+// can be claimed, but not those of MemoryStore, which hands out the arrays
+// that it stores.
+func (r *nbtChunkReader) ClaimArrays() bool {
+	return atomic.CompareAndSwapInt32(&r.unclaimed, 1, 0)
+}
+
+// validateChunkTag checks that the tags required by nbtChunkReader are
+// present, and that the block arrays are of the correct size.
+func validateChunkTag(chunkTag *nbt.Compound) error {
+	for _, name := range []string{"Level/xPos", "Level/zPos"} {
+		if _, err := nbt.LookupType(chunkTag, name, nbt.TagInt); err != nil {
+			return err
+		}
+	}
+
+	const numBlocks = ChunkSizeH * ChunkSizeH * ChunkSizeY
+	arrays := []struct {
+		name string
+		size int
+	}{
+		{"Level/Blocks", numBlocks},
+		{"Level/Data", numBlocks / 2},
+		{"Level/BlockLight", numBlocks / 2},
+		{"Level/SkyLight", numBlocks / 2},
+		{"Level/HeightMap", ChunkSizeH * ChunkSizeH},
+	}
+	for _, array := range arrays {
+		value, ok := nbt.GetByteArray(chunkTag, array.name)
+		if !ok {
+			return fmt.Errorf("missing or bad %s", array.name)
+		}
+		if len(value) != array.size {
+			return fmt.Errorf("%s has length %d, expected %d", array.name, len(value), array.size)
+		}
+	}
+
+	return nil
+}
+
 func (r *nbtChunkReader) ChunkLoc() ChunkXz {
 	return ChunkXz{
 		X: ChunkCoord(r.chunkTag.Lookup("Level/xPos").(*nbt.Int).Value),
@@ -55,6 +166,15 @@ func (r *nbtChunkReader) HeightMap() []byte {
 	return r.chunkTag.Lookup("Level/HeightMap").(*nbt.ByteArray).Value
 }
 
+func (r *nbtChunkReader) Biomes() []byte {
+	// Biomes are not part of the Alpha or Beta formats, so are optional.
+	biomes, ok := nbt.GetByteArray(r.chunkTag, "Level/Biomes")
+	if !ok || len(biomes) != ChunkBiomesSize {
+		return nil
+	}
+	return biomes
+}
+
 func (r *nbtChunkReader) Entities() (entities []gamerules.INonPlayerEntity) {
 	entityListTag, ok := r.chunkTag.Lookup("Level/Entities").(*nbt.List)
 	if !ok {
@@ -65,25 +185,25 @@ func (r *nbtChunkReader) Entities() (entities []gamerules.INonPlayerEntity) {
 	for _, tag := range entityListTag.Value {
 		compound, ok := tag.(*nbt.Compound)
 		if !ok {
-			log.Printf("Found non-compound in entities list: %T", tag)
+			logger.Chunk.Warn("Found non-compound in entities list", "type", fmt.Sprintf("%T", tag))
 			continue
 		}
 
 		entityObjectId, ok := compound.Lookup("id").(*nbt.String)
 		if !ok {
-			log.Printf("Missing or bad entity type ID in NBT: %s", entityObjectId)
+			logger.Chunk.Warn("Missing or bad entity type ID in NBT", "id", compound.Lookup("id"))
 			continue
 		}
 
 		entity := gamerules.NewEntityByTypeName(entityObjectId.Value)
 		if entity == nil {
-			log.Printf("Found unhandled entity type: %s", entityObjectId.Value)
+			logger.Chunk.Debug("Found unhandled entity type", "id", entityObjectId.Value)
 			continue
 		}
 
 		err := entity.UnmarshalNbt(compound)
 		if err != nil {
-			log.Printf("Error unmarshalling entity NBT: %s", err)
+			logger.Chunk.Warn("Error unmarshalling entity NBT", "id", entityObjectId.Value, "err", err)
 			continue
 		}
 
@@ -103,24 +223,24 @@ func (r *nbtChunkReader) TileEntities() (tileEntities []gamerules.ITileEntity) {
 	for _, tag := range entityListTag.Value {
 		compound, ok := tag.(*nbt.Compound)
 		if !ok {
-			log.Printf("Found non-compound in tile entities list: %T", tag)
+			logger.Chunk.Warn("Found non-compound in tile entities list", "type", fmt.Sprintf("%T", tag))
 			continue
 		}
 
 		entityObjectId, ok := compound.Lookup("id").(*nbt.String)
 		if !ok {
-			log.Printf("Missing or bad tile entity type ID in NBT: %s", entityObjectId)
+			logger.Chunk.Warn("Missing or bad tile entity type ID in NBT", "id", compound.Lookup("id"))
 			continue
 		}
 
 		entity := gamerules.NewTileEntityByTypeName(entityObjectId.Value)
 		if entity == nil {
-			log.Printf("Found unhandled tile entity type: %s", entityObjectId.Value)
+			logger.Chunk.Debug("Found unhandled tile entity type", "id", entityObjectId.Value)
 			continue
 		}
 
 		if err := entity.UnmarshalNbt(compound); err != nil {
-			log.Printf("%T.UnmarshalNbt failed: %s", err)
+			logger.Chunk.Warn("Error unmarshalling tile entity NBT", "id", entityObjectId.Value, "err", err)
 			continue
 		}
 
@@ -0,0 +1,150 @@
+package chunkstore
+
+import (
+	"bytes"
+	"testing"
+
+	. "chunkymonkey/types"
+	"nbt"
+)
+
+func TestNewNbtChunkReader_Validation(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(chunkTag *nbt.Compound)
+		valid  bool
+	}{
+		{"valid", func(chunkTag *nbt.Compound) {}, true},
+		{"missing xPos", func(chunkTag *nbt.Compound) {
+			chunkTag.Delete("Level/xPos")
+		}, false},
+		{"bad zPos type", func(chunkTag *nbt.Compound) {
+			chunkTag.Set("Level/zPos", &nbt.Short{1})
+		}, false},
+		{"short Blocks", func(chunkTag *nbt.Compound) {
+			chunkTag.Set("Level/Blocks", &nbt.ByteArray{make([]byte, 100)})
+		}, false},
+		{"long SkyLight", func(chunkTag *nbt.Compound) {
+			chunkTag.Set("Level/SkyLight", &nbt.ByteArray{make([]byte, 16385)})
+		}, false},
+		{"missing HeightMap", func(chunkTag *nbt.Compound) {
+			chunkTag.Delete("Level/HeightMap")
+		}, false},
+	}
+
+	for _, test := range tests {
+		writer := newNbtChunkWriter()
+		setTestChunk(writer, ChunkXz{1, 2}, 0, 0)
+		test.modify(writer.RootTag())
+
+		buf := new(bytes.Buffer)
+		if err := nbt.Write(buf, writer.RootTag()); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := newNbtChunkReader(buf)
+		if test.valid && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("%s: expected error", test.name)
+		}
+	}
+}
+
+func TestNbtChunk_Biomes(t *testing.T) {
+	biomes := make([]byte, ChunkBiomesSize)
+	for i := range biomes {
+		biomes[i] = byte(i % 3)
+	}
+
+	tests := []struct {
+		name   string
+		biomes []byte
+		want   []byte
+	}{
+		{"biomes", biomes, biomes},
+		{"none", nil, nil},
+		{"wrong size", biomes[:10], nil},
+	}
+
+	for _, test := range tests {
+		writer := newNbtChunkWriter()
+		setTestChunk(writer, ChunkXz{1, 2}, 0, 0)
+		writer.SetBiomes(test.biomes)
+
+		buf := new(bytes.Buffer)
+		if err := nbt.Write(buf, writer.RootTag()); err != nil {
+			t.Fatal(err)
+		}
+
+		reader, err := newNbtChunkReader(buf)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if got := reader.Biomes(); !bytes.Equal(got, test.want) || (got == nil) != (test.want == nil) {
+			t.Errorf("%s: Biomes() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestNbtChunkReader_ClaimArrays(t *testing.T) {
+	loc := ChunkXz{1, 2}
+	writer := newNbtChunkWriter()
+	setTestChunk(writer, loc, 0, 0)
+
+	buf := new(bytes.Buffer)
+	if err := nbt.Write(buf, writer.RootTag()); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := newNbtChunkReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reader.ClaimArrays() {
+		t.Errorf("Expected a decoded chunk's arrays to be claimable")
+	}
+	if reader.ClaimArrays() {
+		t.Errorf("Expected arrays to be claimed only once")
+	}
+
+	// MemoryStore hands out the arrays that it stores.
+	memStore := NewMemoryStore()
+	if err := memStore.WriteChunk(writer); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := memStore.ReadChunk(loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.(IChunkArrayOwner).ClaimArrays() {
+		t.Errorf("Expected MemoryStore's arrays not to be claimable")
+	}
+}
+
+func TestNewNbtChunkReader_SkipsUnusedTags(t *testing.T) {
+	writer := newNbtChunkWriter()
+	setTestChunk(writer, ChunkXz{1, 2}, 7, 0)
+	writer.RootTag().Set("Level/TileTicks", &nbt.List{nbt.TagCompound, []nbt.ITag{nbt.NewCompound()}})
+	writer.RootTag().Set("DataVersion", &nbt.Int{100})
+
+	buf := new(bytes.Buffer)
+	if err := nbt.Write(buf, writer.RootTag()); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := newNbtChunkReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loc := reader.ChunkLoc(); loc != (ChunkXz{1, 2}) {
+		t.Errorf("Expected chunk 1,2, got %v", loc)
+	}
+	if block := reader.Blocks()[0]; block != 7 {
+		t.Errorf("Expected block 7, got %d", block)
+	}
+	for _, path := range []string{"Level/TileTicks", "DataVersion"} {
+		if tag := reader.chunkTag.Lookup(path); tag != nil {
+			t.Errorf("Expected %s not to be decoded, got %v", path, tag)
+		}
+	}
+}
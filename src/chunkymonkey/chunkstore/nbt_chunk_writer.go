@@ -1,9 +1,10 @@
 package chunkstore
 
 import (
-	"log"
+	"fmt"
 
 	"chunkymonkey/gamerules"
+	"chunkymonkey/logger"
 	. "chunkymonkey/types"
 	"nbt"
 )
@@ -22,22 +23,27 @@ type nbtChunkWriter struct {
 }
 
 func newNbtChunkWriter() *nbtChunkWriter {
+	level := nbt.NewBuilder().
+		PutByteArray("Data", nil).
+		PutList("Entities", nbt.TagCompound).
+		PutLong("LastUpdate", 0). // TODO
+		PutInt("xPos", 0).
+		PutInt("zPos", 0).
+		PutList("TileEntities", nbt.TagCompound).
+		PutByte("TerrainPopulated", 1). // TODO
+		PutByteArray("SkyLight", nil).
+		PutByteArray("HeightMap", nil).
+		PutByteArray("BlockLight", nil).
+		PutByteArray("Blocks", nil)
+
+	chunkTag, err := nbt.NewBuilder().PutCompound("Level", level).Build()
+	if err != nil {
+		// The structure is fixed, so this can only be a programming error.
+		panic(err)
+	}
+
 	return &nbtChunkWriter{
-		chunkTag: &nbt.Compound{map[string]nbt.ITag{
-			"Level": &nbt.Compound{map[string]nbt.ITag{
-				"Entities":         &nbt.List{nbt.TagCompound, nil},
-				"TileEntities":     &nbt.List{nbt.TagCompound, nil},
-				"Blocks":           &nbt.ByteArray{},
-				"Data":             &nbt.ByteArray{},
-				"HeightMap":        &nbt.ByteArray{},
-				"SkyLight":         &nbt.ByteArray{},
-				"BlockLight":       &nbt.ByteArray{},
-				"LastUpdate":       &nbt.Long{0}, // TODO
-				"TerrainPopulated": &nbt.Byte{1}, // TODO
-				"xPos":             &nbt.Int{0},
-				"zPos":             &nbt.Int{0},
-			}},
-		}},
+		chunkTag: chunkTag,
 	}
 }
 
@@ -71,13 +77,23 @@ func (w *nbtChunkWriter) SetHeightMap(heightMap []byte) {
 	w.chunkTag.Lookup("Level/HeightMap").(*nbt.ByteArray).Value = cloneByteArray(heightMap)
 }
 
+func (w *nbtChunkWriter) SetBiomes(biomes []byte) {
+	if biomes == nil {
+		w.chunkTag.Delete("Level/Biomes")
+		return
+	}
+	// The path only fails to set if Level isn't a compound, which it always
+	// is.
+	w.chunkTag.Set("Level/Biomes", &nbt.ByteArray{cloneByteArray(biomes)})
+}
+
 func (w *nbtChunkWriter) SetEntities(entities map[EntityId]gamerules.INonPlayerEntity) {
 	entitiesNbt := make([]nbt.ITag, 0, len(entities))
 	for _, entity := range entities {
 		tag := nbt.NewCompound()
 
 		if err := entity.MarshalNbt(tag); err != nil {
-			log.Printf("%T.MarshalNbt failed: %v", entity, err)
+			logger.Chunk.Error("Failed to marshal entity", "type", fmt.Sprintf("%T", entity), "err", err)
 			continue
 		}
 
@@ -92,7 +108,7 @@ func (w *nbtChunkWriter) SetTileEntities(tileEntities map[BlockIndex]gamerules.I
 		tag := nbt.NewCompound()
 
 		if err := entity.MarshalNbt(tag); err != nil {
-			log.Printf("%T.MarshalNbt failed: %v", entity, err)
+			logger.Chunk.Error("Failed to marshal entity", "type", fmt.Sprintf("%T", entity), "err", err)
 			continue
 		}
 
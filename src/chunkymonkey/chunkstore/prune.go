@@ -0,0 +1,321 @@
+package chunkstore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	. "chunkymonkey/types"
+	"nbt"
+)
+
+var ErrPruneNotSupported = errors.New("The chunk store can't prune chunks.")
+
+// PruneOptions control which chunks are removed by pruning.
+type PruneOptions struct {
+	// Keep returns true for the chunks to keep. All other chunks are removed.
+	Keep func(loc ChunkXz) bool
+
+	// DryRun counts the chunks and bytes that would be removed, without
+	// removing anything.
+	DryRun bool
+}
+
+// PruneStats count the chunks removed by pruning, or that would be removed by
+// a dry run.
+type PruneStats struct {
+	Kept    int   // Chunks kept.
+	Removed int   // Chunks removed.
+	Bytes   int64 // Disk space freed, in bytes.
+}
+
+func (stats *PruneStats) add(other PruneStats) {
+	stats.Kept += other.Kept
+	stats.Removed += other.Removed
+	stats.Bytes += other.Bytes
+}
+
+// IChunkPruner is implemented by chunk stores that can remove chunks. Pruning
+// is safe while the store is in use, although chunks that are written while
+// the store is pruned may be removed if they aren't kept.
+type IChunkPruner interface {
+	PruneChunks(options PruneOptions) (stats PruneStats, err error)
+}
+
+// PruneChunks removes the chunks of the dimension that options.Keep doesn't
+// keep, when the server isn't running. Region files are rewritten with their
+// remaining chunks packed together, and are deleted if no chunks remain.
+func PruneChunks(worldPath string, levelData nbt.ITag, dimension DimensionId, options PruneOptions) (stats PruneStats, err error) {
+	store, err := ChunkStoreForLevel(worldPath, levelData, dimension)
+	if err != nil {
+		return
+	}
+	pruner, ok := store.(IChunkPruner)
+	if !ok {
+		return stats, ErrPruneNotSupported
+	}
+	if stats, err = pruner.PruneChunks(options); err != nil {
+		return
+	}
+
+	if betaStore, ok := store.(*chunkStoreBeta); ok {
+		betaStore.regions.closeAll()
+		var removedBytes int64
+		removedBytes, err = betaStore.removeEmptyRegionFiles(options.DryRun)
+		stats.Bytes += removedBytes
+	}
+	return
+}
+
+// PruneChunks implements IChunkPruner.PruneChunks. Each region file is locked
+// in the region cache while it is rewritten, so that reads and writes of its
+// chunks wait until it is done. Region files left empty are kept, so that
+// they remain open in the cache.
+func (s *chunkStoreBeta) PruneChunks(options PruneOptions) (stats PruneStats, err error) {
+	filenames, err := filepath.Glob(path.Join(s.regionPath, "r.*.*.mcr"))
+	if err != nil {
+		return
+	}
+
+	for _, filename := range filenames {
+		regionLoc, ok := regionLocForFilename(filename)
+		if !ok {
+			continue
+		}
+		regionStats, err := s.pruneRegion(regionLoc, options)
+		if err != nil {
+			return stats, fmt.Errorf("%s: %v", filename, err)
+		}
+		stats.add(regionStats)
+	}
+	return
+}
+
+func (s *chunkStoreBeta) pruneRegion(regionLoc regionLoc, options PruneOptions) (stats PruneStats, err error) {
+	entry, err := s.regions.acquire(regionLoc, false)
+	if err != nil {
+		if IsNoSuchChunk(err) {
+			err = nil
+		}
+		return
+	}
+	defer s.regions.release(entry)
+
+	rf, stats, err := entry.rf.prune(regionLoc, options)
+	if err == nil {
+		entry.rf = rf
+	}
+	return
+}
+
+// removeEmptyRegionFiles removes region files that hold no chunks, returning
+// the number of bytes freed. It must only be used when no region files are
+// open.
+func (s *chunkStoreBeta) removeEmptyRegionFiles(dryRun bool) (bytes int64, err error) {
+	filenames, err := filepath.Glob(path.Join(s.regionPath, "r.*.*.mcr"))
+	if err != nil {
+		return
+	}
+
+	for _, filename := range filenames {
+		var empty bool
+		var size int64
+		if empty, size, err = regionFileIsEmpty(filename); err != nil {
+			return
+		}
+		if !empty {
+			continue
+		}
+		if !dryRun {
+			if err = os.Remove(filename); err != nil {
+				return
+			}
+		}
+		bytes += size
+	}
+	return
+}
+
+// regionFileIsEmpty returns true if the region file's header holds no chunks.
+func regionFileIsEmpty(filename string) (empty bool, size int64, err error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	fi, err := file.Stat()
+	if err != nil {
+		return
+	}
+
+	var header regionFileHeader
+	if err = header.Read(file); err != nil {
+		return
+	}
+	for _, offset := range header {
+		if offset.IsPresent() {
+			return false, fi.Size(), nil
+		}
+	}
+	return true, fi.Size(), nil
+}
+
+// prune rewrites the region file without the chunks that options.Keep doesn't
+// keep, with the remaining chunks packed together so that the space is
+// reclaimed. The new file replaces the old one atomically, and is returned
+// open in place of rf, which is closed. If nothing is to be removed, or for a
+// dry run, rf is returned unchanged.
+func (rf *regionFile) prune(regionLoc regionLoc, options PruneOptions) (newRf *regionFile, stats PruneStats, err error) {
+	newRf = rf
+
+	fi, err := rf.file.Stat()
+	if err != nil {
+		return
+	}
+
+	// Work out the new header, with the kept chunks in order of index.
+	var newOffsets regionFileHeader
+	newSectors := uint32(2)
+	for i, offset := range rf.offsets {
+		if !offset.IsPresent() {
+			continue
+		}
+		if !options.Keep(regionLoc.chunkXz(i)) {
+			stats.Removed++
+			continue
+		}
+		stats.Kept++
+		sectorCount, _ := offset.Get()
+		newOffsets[i].Set(sectorCount, newSectors)
+		newSectors += sectorCount
+	}
+
+	newSize := int64(newSectors) * regionFileSectorSize
+	if stats.Removed == 0 || newSize >= fi.Size() {
+		// Removing the chunks frees no space, so only their header entries
+		// need to be cleared.
+		newSize = fi.Size()
+	}
+	stats.Bytes = fi.Size() - newSize
+	if stats.Removed == 0 || options.DryRun {
+		return
+	}
+
+	if newSize == fi.Size() {
+		for i, offset := range rf.offsets {
+			if offset.IsPresent() && !newOffsets[i].IsPresent() {
+				if err = rf.offsets.SetOffset(regionLoc.chunkXz(i), chunkOffset(0), rf.file); err != nil {
+					return
+				}
+			}
+		}
+		return
+	}
+
+	filename := rf.file.Name()
+	if err = rf.writePacked(filename, &newOffsets); err != nil {
+		return
+	}
+
+	// The old file can't be written to once it has been replaced, so it's
+	// closed whatever happens.
+	rf.file.Close()
+	if newRf, err = newRegionFile(filename, false); err != nil {
+		newRf = rf
+	}
+	return
+}
+
+// writePacked writes the chunks given in newOffsets to a new file, at the
+// sectors given there, and then moves it into place as filename. Each chunk
+// is padded to whole sectors.
+func (rf *regionFile) writePacked(filename string, newOffsets *regionFileHeader) (err error) {
+	file, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}()
+
+	if err = newOffsets.Write(file); err != nil {
+		return
+	}
+
+	// Copy the timestamps of the kept chunks.
+	var timestamps [regionFileEdge * regionFileEdge * 4]byte
+	if _, err = rf.file.ReadAt(timestamps[:], regionFileSectorSize); err != nil && err != io.EOF {
+		return
+	}
+	for i, offset := range newOffsets {
+		if !offset.IsPresent() {
+			binary.BigEndian.PutUint32(timestamps[i*4:], 0)
+		}
+	}
+	if _, err = file.WriteAt(timestamps[:], regionFileSectorSize); err != nil {
+		return
+	}
+
+	for i, offset := range newOffsets {
+		if !offset.IsPresent() {
+			continue
+		}
+		sectorCount, sectorIndex := offset.Get()
+		_, oldSectorIndex := rf.offsets[i].Get()
+
+		// The last chunk in the old file may not fill its last sector, so
+		// what can't be read is left as zeros.
+		data := make([]byte, sectorCount*regionFileSectorSize)
+		if _, err = rf.file.ReadAt(data, int64(oldSectorIndex)*regionFileSectorSize); err != nil && err != io.EOF {
+			return
+		}
+		if _, err = file.WriteAt(data, int64(sectorIndex)*regionFileSectorSize); err != nil {
+			return
+		}
+	}
+
+	if err = file.Sync(); err != nil {
+		return
+	}
+	if err = file.Close(); err != nil {
+		return
+	}
+	return os.Rename(file.Name(), filename)
+}
+
+// PruneChunks implements IChunkPruner.PruneChunks.
+func (s *chunkStoreAlpha) PruneChunks(options PruneOptions) (stats PruneStats, err error) {
+	chunkFiles, err := findAlphaChunkFiles(s.dimensionPath)
+	if err != nil {
+		return
+	}
+
+	for _, chunkFile := range chunkFiles {
+		if options.Keep(chunkFile.loc) {
+			stats.Kept++
+			continue
+		}
+
+		fi, err := os.Stat(chunkFile.filename)
+		if err != nil {
+			return stats, err
+		}
+		if !options.DryRun {
+			if err = os.Remove(chunkFile.filename); err != nil {
+				return stats, err
+			}
+		}
+		stats.Removed++
+		stats.Bytes += fi.Size()
+	}
+	return
+}
@@ -0,0 +1,128 @@
+package chunkstore
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	. "chunkymonkey/types"
+	"nbt"
+)
+
+func TestChunkStoreBeta_PruneChunks(t *testing.T) {
+	s, err := newChunkStoreBeta(t.TempDir(), DimensionNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locs := []ChunkXz{{0, 0}, {1, 0}, {2, 0}, {5, 7}, {-1, 0}}
+	for i, loc := range locs {
+		writer := s.Writer()
+		setTestChunk(writer, loc, byte(i+1), 1)
+		if err = s.WriteChunk(writer); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keep := func(loc ChunkXz) bool {
+		return loc == ChunkXz{0, 0} || loc == ChunkXz{5, 7}
+	}
+	regionLoc := regionLocForChunkXz(ChunkXz{0, 0})
+	regionPath := regionLoc.regionFilePath(s.regionPath)
+	before, err := os.Stat(regionPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dryStats, err := s.PruneChunks(PruneOptions{Keep: keep, DryRun: true})
+	if err != nil {
+		t.Fatalf("Dry run: %v", err)
+	}
+	if dryStats.Kept != 2 || dryStats.Removed != 3 || dryStats.Bytes <= 0 {
+		t.Errorf("Dry run: expected 2 kept and 3 removed, got %+v", dryStats)
+	}
+	for _, loc := range locs {
+		if _, err := s.ReadChunk(loc); err != nil {
+			t.Errorf("Dry run removed chunk %v: %v", loc, err)
+		}
+	}
+
+	stats, err := s.PruneChunks(PruneOptions{Keep: keep})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != dryStats {
+		t.Errorf("Expected the dry run's %+v, got %+v", dryStats, stats)
+	}
+	after, err := os.Stat(regionPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Size() >= before.Size() {
+		t.Errorf("Expected region file to shrink from %d bytes, got %d", before.Size(), after.Size())
+	}
+
+	// The store carries on working with the rewritten file.
+	for i, loc := range locs {
+		reader, err := s.ReadChunk(loc)
+		if keep(loc) {
+			if err != nil || reader.Blocks()[0] != byte(i+1) {
+				t.Errorf("Expected chunk %v to be kept, got %v", loc, err)
+			}
+		} else if !IsNoSuchChunk(err) {
+			t.Errorf("Expected chunk %v to be removed, got %v", loc, err)
+		}
+	}
+	writer := s.Writer()
+	setTestChunk(writer, ChunkXz{3, 3}, 9, 1)
+	if err = s.WriteChunk(writer); err != nil {
+		t.Fatal(err)
+	}
+	if reader, err := s.ReadChunk(ChunkXz{3, 3}); err != nil || reader.Blocks()[0] != 9 {
+		t.Errorf("Expected chunk written after pruning to be read back, got %v", err)
+	}
+}
+
+func TestPruneChunks(t *testing.T) {
+	betaLevel, _ := nbt.NewBuilder().
+		PutCompound("Data", nbt.NewBuilder().PutInt("version", 19132)).
+		Build()
+	worldPath := t.TempDir()
+	s, err := newChunkStoreBeta(worldPath, DimensionNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, loc := range []ChunkXz{{0, 0}, {-1, 0}} {
+		writer := s.Writer()
+		setTestChunk(writer, loc, 1, 1)
+		if err = s.WriteChunk(writer); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.regions.closeAll()
+
+	// Region files left empty are removed.
+	keep := func(loc ChunkXz) bool { return loc.X >= 0 }
+	stats, err := PruneChunks(worldPath, betaLevel, DimensionNormal, PruneOptions{Keep: keep})
+	if err != nil || stats.Kept != 1 || stats.Removed != 1 {
+		t.Errorf("Expected 1 kept and 1 removed, got %+v, %v", stats, err)
+	}
+	emptyRegion := regionLocForChunkXz(ChunkXz{-1, 0})
+	if _, err = os.Stat(emptyRegion.regionFilePath(s.regionPath)); !os.IsNotExist(err) {
+		t.Errorf("Expected empty region file to be removed, got %v", err)
+	}
+
+	// Alpha worlds have their chunk files removed.
+	worldPath = createAlphaWorld(t, []ChunkXz{{0, 0}, {-3, 5}, {2, -1}})
+	alphaLevel, err := readLevelData(path.Join(worldPath, "level.dat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err = PruneChunks(worldPath, alphaLevel, DimensionNormal, PruneOptions{Keep: keep})
+	if err != nil || stats.Kept != 2 || stats.Removed != 1 || stats.Bytes <= 0 {
+		t.Errorf("Alpha: expected 2 kept and 1 removed, got %+v, %v", stats, err)
+	}
+	chunkFiles, err := findAlphaChunkFiles(worldPath)
+	if err != nil || len(chunkFiles) != 2 {
+		t.Errorf("Alpha: expected 2 chunk files left, got %v, %v", chunkFiles, err)
+	}
+}
@@ -0,0 +1,61 @@
+package chunkstore
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"chunkymonkey/logger"
+	. "chunkymonkey/types"
+)
+
+var regenerateCorruptChunks = flag.Bool(
+	"regenerate_corrupt_chunks", false,
+	"Move corrupt chunks into the world's quarantine directory, so that new "+
+		"chunks are generated in their place. Otherwise corrupt chunks are "+
+		"not loaded at all.")
+
+// quarantineFilename returns a new filename within quarantinePath for the
+// data of a corrupt chunk, creating quarantinePath if needed.
+func quarantineFilename(quarantinePath string, chunkLoc ChunkXz, ext string) (filename string, err error) {
+	if err = os.MkdirAll(quarantinePath, 0777); err != nil {
+		return
+	}
+
+	return path.Join(quarantinePath, fmt.Sprintf(
+		"c.%d.%d.%d%s", chunkLoc.X, chunkLoc.Z, time.Now().UnixNano(), ext)), nil
+}
+
+// logQuarantine logs the replacement of a corrupt chunk.
+func logQuarantine(corrupt *CorruptChunkError, filename string) {
+	logger.Chunk.Warn("Moved corrupt chunk aside, it will be regenerated", "chunk", corrupt.ChunkLoc, "corrupt", corrupt, "file", filename)
+}
+
+// quarantineRegionChunk copies the data of a corrupt chunk into the
+// quarantine directory and removes it from the region file. NoSuchChunkError is returned if this
+// succeeds, so that the chunk is regenerated.
+func quarantineRegionChunk(quarantinePath string, rf *regionFile, corrupt *CorruptChunkError) error {
+	data, err := rf.RawChunkData(corrupt.ChunkLoc)
+	if err != nil {
+		logger.Chunk.Error("Failed to read corrupt chunk for quarantine", "chunk", corrupt.ChunkLoc, "corrupt", corrupt, "err", err)
+		return corrupt
+	}
+
+	filename, err := quarantineFilename(quarantinePath, corrupt.ChunkLoc, ".mcc")
+	if err == nil {
+		err = ioutil.WriteFile(filename, data, 0666)
+	}
+	if err == nil {
+		err = rf.RemoveChunk(corrupt.ChunkLoc)
+	}
+	if err != nil {
+		logger.Chunk.Error("Failed to quarantine corrupt chunk", "chunk", corrupt.ChunkLoc, "corrupt", corrupt, "err", err)
+		return corrupt
+	}
+
+	logQuarantine(corrupt, filename)
+	return NoSuchChunkError(false)
+}
@@ -0,0 +1,181 @@
+package chunkstore
+
+import (
+	"container/list"
+	"expvar"
+	"flag"
+	"os"
+	"sync"
+
+	"chunkymonkey/logger"
+)
+
+var (
+	expVarRegionFilesOpen      *expvar.Int
+	expVarRegionFileOpenCount  *expvar.Int
+	expVarRegionFileEvictCount *expvar.Int
+
+	maxOpenRegionFiles = flag.Int(
+		"max_open_region_files", 64,
+		"The maximum number of region files to keep open for each dimension. "+
+			"More may be open briefly if all are in use.")
+)
+
+func init() {
+	expVarRegionFilesOpen = expvar.NewInt("region-files-open")
+	expVarRegionFileOpenCount = expvar.NewInt("region-file-open-count")
+	expVarRegionFileEvictCount = expvar.NewInt("region-file-evict-count")
+}
+
+// regionCacheEntry is an open regionFile within a regionCache.
+type regionCacheEntry struct {
+	key  uint64
+	rf   *regionFile
+	refs int // Guarded by the regionCache lock.
+
+	// lock serializes use of the regionFile, as reads seek within the file.
+	lock sync.Mutex
+}
+
+// regionCache keeps up to a maximum number of region files open, closing the
+// least recently used when more are needed. It is safe to use from multiple
+// goroutines.
+type regionCache struct {
+	regionPath string
+	ext        string // The extension of the region files.
+	maxOpen    int
+
+	lock    sync.Mutex
+	entries map[uint64]*list.Element
+	lru     *list.List // Of *regionCacheEntry, most recently used first.
+
+	opens     int64
+	evictions int64
+}
+
+func newRegionCache(regionPath, ext string, maxOpen int) *regionCache {
+	if maxOpen < 1 {
+		maxOpen = 1
+	}
+
+	return &regionCache{
+		regionPath: regionPath,
+		ext:        ext,
+		maxOpen:    maxOpen,
+		entries:    make(map[uint64]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// acquire returns the entry for the region file at regionLoc, opening the
+// file if needed, and locked for the exclusive use of the caller. If create is
+// false and the region file does not exist, NoSuchChunkError is returned.
+// release must be called when the caller is done with the entry.
+func (c *regionCache) acquire(regionLoc regionLoc, create bool) (entry *regionCacheEntry, err error) {
+	key := regionLoc.regionKey()
+
+	c.lock.Lock()
+	if element, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(element)
+		entry = element.Value.(*regionCacheEntry)
+	} else {
+		if create {
+			if err = os.MkdirAll(c.regionPath, 0777); err != nil {
+				c.lock.Unlock()
+				return nil, err
+			}
+		}
+
+		var rf *regionFile
+		if rf, err = newRegionFile(regionLoc.filePath(c.regionPath, c.ext), create); err != nil {
+			c.lock.Unlock()
+			return nil, err
+		}
+
+		entry = &regionCacheEntry{key: key, rf: rf}
+		c.entries[key] = c.lru.PushFront(entry)
+		c.opens++
+		expVarRegionFilesOpen.Add(1)
+		expVarRegionFileOpenCount.Add(1)
+	}
+	entry.refs++
+	evicted := c.evict()
+	c.lock.Unlock()
+
+	closeEntries(evicted)
+	entry.lock.Lock()
+	return entry, nil
+}
+
+// release releases an entry returned by acquire.
+func (c *regionCache) release(entry *regionCacheEntry) {
+	entry.lock.Unlock()
+
+	c.lock.Lock()
+	entry.refs--
+	evicted := c.evict()
+	c.lock.Unlock()
+
+	closeEntries(evicted)
+}
+
+// evict removes least recently used region files that are not in use until no
+// more than maxOpen are open, returning them to be closed with closeEntries.
+// It must be called with the lock held.
+func (c *regionCache) evict() (evicted []*regionCacheEntry) {
+	for element := c.lru.Back(); element != nil && c.lru.Len() > c.maxOpen; {
+		prev := element.Prev()
+		if entry := element.Value.(*regionCacheEntry); entry.refs == 0 {
+			evicted = append(evicted, c.remove(element))
+			c.evictions++
+			expVarRegionFileEvictCount.Add(1)
+		}
+		element = prev
+	}
+	return
+}
+
+// remove removes the element from the cache, returning its entry to be closed
+// with closeEntries. It must be called with the lock held.
+func (c *regionCache) remove(element *list.Element) *regionCacheEntry {
+	entry := element.Value.(*regionCacheEntry)
+	c.lru.Remove(element)
+	delete(c.entries, entry.key)
+	expVarRegionFilesOpen.Add(-1)
+	return entry
+}
+
+// closeEntries closes the region files of entries removed from the cache.
+// Closing flushes any pending writes to disk, which may be slow, so it must be
+// called without the lock held.
+func closeEntries(entries []*regionCacheEntry) {
+	for _, entry := range entries {
+		if err := entry.rf.Close(); err != nil {
+			logger.Chunk.Error("Error closing region file", "file", entry.rf.file.Name(), "err", err)
+		}
+	}
+}
+
+// stats returns the number of currently open region files, and the total
+// number of opens and evictions.
+func (c *regionCache) stats() (open int, opens, evictions int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.lru.Len(), c.opens, c.evictions
+}
+
+// closeAll closes all region files that are not in use.
+func (c *regionCache) closeAll() {
+	var removed []*regionCacheEntry
+	c.lock.Lock()
+	for element := c.lru.Back(); element != nil; {
+		prev := element.Prev()
+		if element.Value.(*regionCacheEntry).refs == 0 {
+			removed = append(removed, c.remove(element))
+		}
+		element = prev
+	}
+	c.lock.Unlock()
+
+	closeEntries(removed)
+}
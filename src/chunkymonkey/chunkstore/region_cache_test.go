@@ -0,0 +1,112 @@
+package chunkstore
+
+import (
+	"sync"
+	"testing"
+
+	. "chunkymonkey/types"
+)
+
+func TestRegionCache_Eviction(t *testing.T) {
+	cache := newRegionCache(t.TempDir(), regionFileExt, 2)
+	defer cache.closeAll()
+
+	// Missing region files are not created or cached on read.
+	if _, err := cache.acquire(regionLoc{0, 0}, false); !IsNoSuchChunk(err) {
+		t.Fatalf("Expected NoSuchChunkError, got %v", err)
+	}
+
+	for x := regionCoord(0); x < 3; x++ {
+		entry, err := cache.acquire(regionLoc{x, 0}, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cache.release(entry)
+	}
+
+	if open, opens, evictions := cache.stats(); open != 2 || opens != 3 || evictions != 1 {
+		t.Errorf("Expected 2 open, 3 opens and 1 eviction, got %d, %d, %d", open, opens, evictions)
+	}
+
+	// Region files in use are not evicted, even if over the limit.
+	var entries []*regionCacheEntry
+	for x := regionCoord(0); x < 3; x++ {
+		entry, err := cache.acquire(regionLoc{x, 0}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	if open, _, _ := cache.stats(); open != 3 {
+		t.Errorf("Expected 3 open while in use, got %d", open)
+	}
+	for _, entry := range entries {
+		cache.release(entry)
+	}
+	if open, _, _ := cache.stats(); open != 2 {
+		t.Errorf("Expected 2 open after release, got %d", open)
+	}
+}
+
+func TestRegionCache_Concurrent(t *testing.T) {
+	cache := newRegionCache(t.TempDir(), regionFileExt, 2)
+	defer cache.closeAll()
+
+	const numGoroutines = 8
+	const numChunks = 24
+
+	var wg sync.WaitGroup
+	errs := make(chan error, numGoroutines)
+
+	for g := 0; g < numGoroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < numChunks; i++ {
+				// Spread the chunks over several regions, so that files are
+				// continually evicted and reopened.
+				loc := ChunkXz{ChunkCoord(i * regionFileEdge), ChunkCoord(g)}
+
+				writer := newNbtChunkWriter()
+				setTestChunk(writer, loc, byte(g), byte(i))
+
+				entry, err := cache.acquire(regionLocForChunkXz(loc), true)
+				if err != nil {
+					errs <- err
+					return
+				}
+				err = entry.rf.WriteChunkData(writer)
+				cache.release(entry)
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				entry, err = cache.acquire(regionLocForChunkXz(loc), false)
+				if err != nil {
+					errs <- err
+					return
+				}
+				reader, err := entry.rf.ReadChunkData(loc)
+				cache.release(entry)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if blocks := reader.Blocks(); blocks[0] != byte(g) || blocks[1] != byte(i) {
+					t.Errorf("Chunk %v: read back blocks %v", loc, blocks)
+				}
+			}
+		}(g)
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if open, _, evictions := cache.stats(); open > 2 || evictions == 0 {
+		t.Errorf("Expected at most 2 open and some evictions, got %d, %d", open, evictions)
+	}
+}
@@ -0,0 +1,141 @@
+package chunkstore
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+var expVarChunkStoreStats = expvar.NewMap("chunk-store-stats")
+
+// loadTimeBuckets are the upper bounds of the buckets of the chunk load time
+// histogram. Slower loads are counted in the last bucket.
+var loadTimeBuckets = [...]time.Duration{
+	1 * time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	20 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	200 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+	2 * time.Second,
+	5 * time.Second,
+}
+
+// ChunkStoreStats are statistics on the chunk reads made from a store.
+type ChunkStoreStats struct {
+	Requests  int64 // All reads.
+	Loaded    int64 // Reads of chunks from a persistant store.
+	Generated int64 // Reads of generated chunks.
+	NotFound  int64 // Reads of chunks that do not exist.
+	Errors    int64 // Reads that failed to load the chunk.
+
+	// Coalesced counts the requests that were satisfied by a read already in
+	// progress, and are not included in the other counts.
+	Coalesced int64
+
+	// BackendHits counts the reads satisfied by each of a MultiStore's read
+	// stores, in order. It is nil for other stores.
+	BackendHits []int64
+
+	// Load time percentiles, rounded up to a histogram bucket boundary.
+	LoadTimeP50 time.Duration
+	LoadTimeP99 time.Duration
+}
+
+// statsRecorder accumulates ChunkStoreStats. It is safe to use from multiple
+// goroutines.
+type statsRecorder struct {
+	lock        sync.Mutex
+	stats       ChunkStoreStats
+	loadTimes   [len(loadTimeBuckets)]int64
+	numBackends int
+}
+
+// record records a read. backend is the index of the MultiStore read store
+// that satisfied it, or -1.
+func (r *statsRecorder) record(source ChunkSource, err error, backend int, loadTime time.Duration) {
+	bucket := 0
+	for bucket < len(loadTimeBuckets)-1 && loadTime > loadTimeBuckets[bucket] {
+		bucket++
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.stats.Requests++
+	r.loadTimes[bucket]++
+
+	switch {
+	case err == nil && source == ChunkSourceGenerated:
+		r.stats.Generated++
+	case err == nil:
+		r.stats.Loaded++
+	case IsNoSuchChunk(err):
+		r.stats.NotFound++
+	default:
+		r.stats.Errors++
+	}
+
+	if err == nil && backend >= 0 {
+		if r.stats.BackendHits == nil {
+			r.stats.BackendHits = make([]int64, r.numBackends)
+		}
+		r.stats.BackendHits[backend]++
+	}
+}
+
+// recordCoalesced records a request that joined a read in progress.
+func (r *statsRecorder) recordCoalesced() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.stats.Coalesced++
+}
+
+// percentile returns the upper bound of the load time bucket containing the
+// given fraction of reads. It must be called with the lock held.
+func (r *statsRecorder) percentile(fraction float64) time.Duration {
+	if r.stats.Requests == 0 {
+		return 0
+	}
+
+	target := int64(fraction*float64(r.stats.Requests) + 0.5)
+	if target < 1 {
+		target = 1
+	}
+
+	var count int64
+	for i, bucketCount := range r.loadTimes {
+		count += bucketCount
+		if count >= target {
+			return loadTimeBuckets[i]
+		}
+	}
+	return loadTimeBuckets[len(loadTimeBuckets)-1]
+}
+
+// snapshot returns a copy of the stats.
+func (r *statsRecorder) snapshot() (stats ChunkStoreStats) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	stats = r.stats
+	if r.stats.BackendHits != nil {
+		stats.BackendHits = append([]int64(nil), r.stats.BackendHits...)
+	}
+	stats.LoadTimeP50 = r.percentile(0.5)
+	stats.LoadTimeP99 = r.percentile(0.99)
+
+	return
+}
+
+// PublishStats publishes the result of calling stats as the given name in the
+// "chunk-store-stats" expvar.
+func PublishStats(name string, stats func() ChunkStoreStats) {
+	expVarChunkStoreStats.Set(name, expvar.Func(func() interface{} {
+		return stats()
+	}))
+}
@@ -0,0 +1,93 @@
+package chunkstore
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	. "chunkymonkey/types"
+)
+
+func TestStatsRecorder(t *testing.T) {
+	var r statsRecorder
+	r.numBackends = 2
+
+	for i := 0; i < 98; i++ {
+		r.record(ChunkSourceStore, nil, 0, 3*time.Millisecond)
+	}
+	r.record(ChunkSourceGenerated, nil, 1, 150*time.Millisecond)
+	r.record(ChunkSourceStore, errors.New("oops"), -1, time.Minute)
+	r.record(ChunkSourceStore, NoSuchChunkError(false), -1, 0)
+
+	stats := r.snapshot()
+	if stats.Requests != 101 || stats.Loaded != 98 || stats.Generated != 1 ||
+		stats.Errors != 1 || stats.NotFound != 1 {
+		t.Errorf("Unexpected counts: %+v", stats)
+	}
+	if len(stats.BackendHits) != 2 || stats.BackendHits[0] != 98 || stats.BackendHits[1] != 1 {
+		t.Errorf("Unexpected backend hits: %v", stats.BackendHits)
+	}
+	if stats.LoadTimeP50 != 5*time.Millisecond {
+		t.Errorf("Expected p50 of 5ms, got %v", stats.LoadTimeP50)
+	}
+	if stats.LoadTimeP99 != 200*time.Millisecond {
+		t.Errorf("Expected p99 of 200ms, got %v", stats.LoadTimeP99)
+	}
+
+	// The snapshot must not share state with the recorder.
+	stats.BackendHits[0] = 0
+	if r.snapshot().BackendHits[0] != 98 {
+		t.Errorf("Snapshot shares BackendHits with recorder")
+	}
+}
+
+func TestStatsRecorder_Empty(t *testing.T) {
+	var r statsRecorder
+	if stats := r.snapshot(); stats.Requests != 0 || stats.LoadTimeP99 != 0 || stats.BackendHits != nil {
+		t.Errorf("Unexpected stats for no reads: %+v", stats)
+	}
+}
+
+func TestMultiStore_Stats(t *testing.T) {
+	persistant, generator := newFakeStore(false), newFakeStore(true)
+	for i := 0; i < 10; i += 2 {
+		loc := ChunkXz{0, ChunkCoord(i)}
+		persistant.chunks[loc] = &fakeChunk{loc: loc}
+	}
+	persistantService, generatorService := NewChunkService(persistant), NewChunkService(generator)
+	go persistantService.Serve()
+	go generatorService.Serve()
+	multiStore := NewMultiStore([]IChunkStore{persistantService, generatorService}, PersistOnModify)
+	store := serve(multiStore)
+
+	// Read different chunks concurrently (so that the reads are not
+	// coalesced), while also reading the stats.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-store.ReadChunk(ChunkXz{ChunkCoord(i % 2), ChunkCoord(i)})
+			multiStore.Stats()
+			persistantService.Stats()
+		}(i)
+	}
+	wg.Wait()
+
+	stats := multiStore.Stats()
+	if stats.Requests != 10 || stats.Loaded != 5 || stats.Generated != 5 {
+		t.Errorf("Unexpected MultiStore stats: %+v", stats)
+	}
+	if len(stats.BackendHits) != 2 || stats.BackendHits[0] != 5 || stats.BackendHits[1] != 5 {
+		t.Errorf("Unexpected backend hits: %v", stats.BackendHits)
+	}
+
+	stats = persistantService.Stats()
+	if stats.Requests != 10 || stats.Loaded != 5 || stats.NotFound != 5 {
+		t.Errorf("Unexpected persistant store stats: %+v", stats)
+	}
+	if stats = generatorService.Stats(); stats.Generated != 5 {
+		t.Errorf("Unexpected generator stats: %+v", stats)
+	}
+}
@@ -1,16 +1,40 @@
 package chunkstore
 
 import (
+	"errors"
 	"fmt"
+	"path"
 
 	"chunkymonkey/gamerules"
 	. "chunkymonkey/types"
 	"nbt"
 )
 
+// ChunkReadResult is the result of IChunkStore.ReadChunk. Err is nil,
+// NoSuchChunkError or *ChunkLoadError.
 type ChunkReadResult struct {
 	Reader IChunkReader
 	Err    error
+	// Source is the kind of backend that satisfied the read.
+	Source ChunkSource
+}
+
+// ChunkSource identifies the kind of backend that a chunk was read from.
+type ChunkSource int
+
+const (
+	ChunkSourceStore     = ChunkSource(iota) // Loaded from a persistant store.
+	ChunkSourceGenerated                     // Newly generated.
+)
+
+func (source ChunkSource) String() string {
+	switch source {
+	case ChunkSourceStore:
+		return "store"
+	case ChunkSourceGenerated:
+		return "generated"
+	}
+	return fmt.Sprintf("ChunkSource(%d)", int(source))
 }
 
 type IChunkStore interface {
@@ -22,8 +46,23 @@ type IChunkStore interface {
 	Writer() IChunkWriter
 
 	// Submits the set chunk data for writing. The chunk writer must not be
-	// altered any further after calling this.
-	WriteChunk(writer IChunkWriter)
+	// altered any further after calling this. The result of the write is
+	// sent on the returned channel, which is buffered so that callers that
+	// do not care about the result need not receive from it.
+	WriteChunk(writer IChunkWriter) (result <-chan error)
+}
+
+// IChunkReader reads a chunk's data. The arrays returned may belong to the
+// store or be shared with other readers, so callers copy any that they change,
+// unless they have claimed them through IChunkArrayOwner.
+// IChunkArrayOwner is implemented by IChunkReaders whose arrays may have been
+// decoded for the reader alone, rather than shared with a store's cached copy
+// or a generator's template.
+type IChunkArrayOwner interface {
+	// ClaimArrays returns true if the caller may keep and modify the reader's
+	// arrays without copying them. Only the first call returns true, and
+	// nothing else may read the arrays once they have been claimed.
+	ClaimArrays() bool
 }
 
 type IChunkReader interface {
@@ -45,6 +84,10 @@ type IChunkReader interface {
 	// Returns the height map data in the chunk.
 	HeightMap() []byte
 
+	// Returns the biome of each column in the chunk, or nil if the chunk has
+	// no biome data.
+	Biomes() []byte
+
 	// Return a slice of the entities (items, mobs) within the chunk.
 	Entities() []gamerules.INonPlayerEntity
 
@@ -84,6 +127,10 @@ type IChunkWriter interface {
 	// SetHeightMap sets the height map data in the chunk.
 	SetHeightMap(heightMap []byte)
 
+	// SetBiomes sets the biome of each column in the chunk. nil means that
+	// the chunk has no biome data.
+	SetBiomes(biomes []byte)
+
 	// SetEntities sets a list of the entities (items, mobs) within the chunk.
 	SetEntities(entities map[EntityId]gamerules.INonPlayerEntity)
 
@@ -93,16 +140,26 @@ type IChunkWriter interface {
 }
 
 // Given the NamedTag for a level.dat, returns an appropriate
-// IChunkStoreForeground.
+// IChunkStoreForeground. The directories for the dimension need not exist
+// yet, in which case reads return NoSuchChunkError, and the directories are
+// created when the first chunk is written.
 func ChunkStoreForLevel(worldPath string, levelData nbt.ITag, dimension DimensionId) (store IChunkStoreForeground, err error) {
-	versionTag, ok := levelData.Lookup("Data/version").(*nbt.Int)
+	switch dimension {
+	case DimensionNormal, DimensionNether, DimensionEnd:
+	default:
+		return nil, UnknownDimension(dimension)
+	}
+
+	version, ok := nbt.GetInt(levelData, "Data/version")
 
 	if !ok {
 		store, err = newChunkStoreAlpha(worldPath, dimension)
 	} else {
-		switch version := versionTag.Value; version {
+		switch version {
 		case 19132:
 			store, err = newChunkStoreBeta(worldPath, dimension)
+		case anvilLevelVersion:
+			store, err = newChunkStoreAnvil(worldPath, dimension)
 		default:
 			err = UnknownLevelVersion(version)
 		}
@@ -111,14 +168,75 @@ func ChunkStoreForLevel(worldPath string, levelData nbt.ITag, dimension Dimensio
 	return
 }
 
+// dimensionPath returns the directory containing the data for the dimension.
+// The overworld is stored directly within the world directory, other
+// dimensions within a DIM<n> subdirectory (e.g DIM-1 for the Nether).
+func dimensionPath(worldPath string, dimension DimensionId) string {
+	if dimension == DimensionNormal {
+		return worldPath
+	}
+	return path.Join(worldPath, fmt.Sprintf("DIM%d", dimension))
+}
+
+type UnknownDimension DimensionId
+
+func (err UnknownDimension) Error() string {
+	return fmt.Sprintf("Unknown dimension %d", err)
+}
+
 type UnknownLevelVersion int32
 
 func (err UnknownLevelVersion) Error() string {
 	return fmt.Sprintf("Unknown level version %d", err)
 }
 
+// ErrReadOnlyStore is returned when writing to a store that does not support
+// writes (e.g a chunk generator).
+var ErrReadOnlyStore = errors.New("Chunk store is read-only.")
+
+// NoSuchChunkError is returned when a chunk is simply not present in a store.
 type NoSuchChunkError bool
 
 func (err NoSuchChunkError) Error() string {
 	return "Chunk does not exist."
 }
+
+// ChunkLoadError is returned by IChunkStore when a chunk may be present in a
+// store, but could not be loaded from it (e.g an I/O error or corrupt data).
+// Unlike NoSuchChunkError, a chunk should not be generated in its place.
+type ChunkLoadError struct {
+	ChunkLoc ChunkXz
+	Err      error
+}
+
+func (err *ChunkLoadError) Error() string {
+	return fmt.Sprintf("Chunk at %d,%d failed to load: %v", err.ChunkLoc.X, err.ChunkLoc.Z, err.Err)
+}
+
+// CorruptChunkError is returned when a chunk is present in a store, but its
+// data is invalid (e.g truncated, or missing required tags).
+type CorruptChunkError struct {
+	ChunkLoc ChunkXz
+	Err      error
+}
+
+func (err *CorruptChunkError) Error() string {
+	return fmt.Sprintf("Chunk at %d,%d is corrupt: %v", err.ChunkLoc.X, err.ChunkLoc.Z, err.Err)
+}
+
+// IsCorruptChunk returns true if err indicates that a chunk is corrupt,
+// either directly or within a ChunkLoadError.
+func IsCorruptChunk(err error) bool {
+	if loadErr, ok := err.(*ChunkLoadError); ok {
+		err = loadErr.Err
+	}
+	_, ok := err.(*CorruptChunkError)
+	return ok
+}
+
+// IsNoSuchChunk returns true if err indicates that a chunk does not exist,
+// rather than that it failed to load.
+func IsNoSuchChunk(err error) bool {
+	_, ok := err.(NoSuchChunkError)
+	return ok
+}
@@ -0,0 +1,82 @@
+package chunkstore
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	. "chunkymonkey/types"
+	"nbt"
+)
+
+func testLevelData(version int32) *nbt.Compound {
+	data := nbt.NewBuilder().PutLong("RandomSeed", 1)
+	if version != 0 {
+		data.PutInt("version", version)
+	}
+	levelData, _ := nbt.NewBuilder().PutCompound("Data", data).Build()
+	return levelData
+}
+
+func TestChunkStoreForLevel_NoNether(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int32
+		dimPath string
+	}{
+		{"alpha", 0, "DIM-1"},
+		{"beta", regionLevelVersion, "DIM-1/region"},
+	}
+
+	for _, test := range tests {
+		worldPath := t.TempDir()
+		levelData := testLevelData(test.version)
+		loc := ChunkXz{2, -3}
+
+		overworld, err := ChunkStoreForLevel(worldPath, levelData, DimensionNormal)
+		if err != nil {
+			t.Fatalf("%s: overworld store error: %v", test.name, err)
+		}
+		writer := overworld.Writer()
+		setTestChunk(writer, loc, 1, 0)
+		if err = overworld.WriteChunk(writer); err != nil {
+			t.Fatalf("%s: overworld write error: %v", test.name, err)
+		}
+
+		nether, err := ChunkStoreForLevel(worldPath, levelData, DimensionNether)
+		if err != nil {
+			t.Fatalf("%s: nether store error: %v", test.name, err)
+		}
+		if _, err = nether.ReadChunk(loc); !IsNoSuchChunk(err) {
+			t.Errorf("%s: expected NoSuchChunkError from empty nether, got %v", test.name, err)
+		}
+		if _, err = os.Stat(path.Join(worldPath, "DIM-1")); !os.IsNotExist(err) {
+			t.Errorf("%s: expected reading not to create nether directory, got %v", test.name, err)
+		}
+
+		writer = nether.Writer()
+		setTestChunk(writer, loc, 2, 0)
+		if err = nether.WriteChunk(writer); err != nil {
+			t.Fatalf("%s: nether write error: %v", test.name, err)
+		}
+		if fi, err := os.Stat(path.Join(worldPath, test.dimPath)); err != nil || !fi.IsDir() {
+			t.Errorf("%s: expected %s to be created, got %v", test.name, test.dimPath, err)
+		}
+
+		// The dimensions are kept apart.
+		for _, store := range []IChunkStoreForeground{overworld, nether} {
+			if _, err = store.ReadChunk(loc); err != nil {
+				t.Errorf("%s: read error: %v", test.name, err)
+			}
+		}
+		if reader, _ := overworld.ReadChunk(loc); reader != nil && reader.Blocks()[0] != 1 {
+			t.Errorf("%s: overworld chunk overwritten by nether chunk", test.name)
+		}
+	}
+}
+
+func TestChunkStoreForLevel_UnknownDimension(t *testing.T) {
+	if _, err := ChunkStoreForLevel(t.TempDir(), testLevelData(0), DimensionId(5)); err == nil {
+		t.Errorf("Expected error for unknown dimension")
+	}
+}
@@ -0,0 +1,221 @@
+// The clock package abstracts the passing of time, so that anything timed by
+// a Clock can be driven by a Fake clock in tests rather than by wall time.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time and creates tickers and timers.
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+	NewTimer(d time.Duration) Timer
+	After(d time.Duration) <-chan time.Time
+}
+
+// Ticker sends the time on its channel every period, dropping ticks for slow
+// receivers in the same way as a time.Ticker.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Timer sends the time on its channel once, when it expires.
+type Timer interface {
+	C() <-chan time.Time
+	// Stop returns false if the timer had already expired or been stopped.
+	Stop() bool
+}
+
+// Real is the wall clock, and is used everywhere outside of tests.
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t realTicker) Stop() {
+	t.ticker.Stop()
+}
+
+type realTimer struct {
+	timer *time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+func (t realTimer) Stop() bool {
+	return t.timer.Stop()
+}
+
+// Fake is a Clock whose time only moves when it is advanced. Tickers and
+// timers fire during Advance, without sleeping.
+type Fake struct {
+	lock    sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+// NewFake creates a Fake clock starting at the given time.
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+func (clock *Fake) Now() time.Time {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+	return clock.now
+}
+
+func (clock *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	return fakeTicker{clock.addWaiter(d, d)}
+}
+
+func (clock *Fake) NewTimer(d time.Duration) Timer {
+	return fakeTimer{clock.addWaiter(d, 0)}
+}
+
+func (clock *Fake) After(d time.Duration) <-chan time.Time {
+	return clock.NewTimer(d).C()
+}
+
+// Advance moves the time forward by d, firing the tickers and timers that
+// are due in order. A ticker that is due more than once fires only once if its
+// tick isn't received in between.
+func (clock *Fake) Advance(d time.Duration) {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+
+	end := clock.now.Add(d)
+	for {
+		next := clock.nextWaiter(end)
+		if next == nil {
+			break
+		}
+		clock.now = next.when
+		next.fire()
+	}
+	clock.now = end
+
+	waiters := clock.waiters[:0]
+	for _, waiter := range clock.waiters {
+		if !waiter.stopped {
+			waiters = append(waiters, waiter)
+		}
+	}
+	clock.waiters = waiters
+}
+
+// nextWaiter returns the waiter due soonest, if it is due by end.
+func (clock *Fake) nextWaiter(end time.Time) (next *fakeWaiter) {
+	for _, waiter := range clock.waiters {
+		if waiter.stopped || waiter.when.After(end) {
+			continue
+		}
+		if next == nil || waiter.when.Before(next.when) {
+			next = waiter
+		}
+	}
+	return
+}
+
+func (clock *Fake) addWaiter(d, period time.Duration) *fakeWaiter {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+
+	waiter := &fakeWaiter{
+		clock:  clock,
+		c:      make(chan time.Time, 1),
+		when:   clock.now.Add(d),
+		period: period,
+	}
+	if d <= 0 {
+		waiter.fire()
+	} else {
+		clock.waiters = append(clock.waiters, waiter)
+	}
+	return waiter
+}
+
+// fakeWaiter is a ticker or timer of a Fake clock. Its fields are guarded by
+// the clock's lock.
+type fakeWaiter struct {
+	clock   *Fake
+	c       chan time.Time
+	when    time.Time
+	period  time.Duration // Zero for timers.
+	stopped bool
+}
+
+func (waiter *fakeWaiter) fire() {
+	select {
+	case waiter.c <- waiter.when:
+	default:
+	}
+	if waiter.period == 0 {
+		waiter.stopped = true
+	} else {
+		waiter.when = waiter.when.Add(waiter.period)
+	}
+}
+
+func (waiter *fakeWaiter) stop() (wasActive bool) {
+	waiter.clock.lock.Lock()
+	defer waiter.clock.lock.Unlock()
+	wasActive = !waiter.stopped
+	waiter.stopped = true
+	return
+}
+
+type fakeTicker struct {
+	*fakeWaiter
+}
+
+func (t fakeTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t fakeTicker) Stop() {
+	t.stop()
+}
+
+type fakeTimer struct {
+	*fakeWaiter
+}
+
+func (t fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t fakeTimer) Stop() bool {
+	return t.stop()
+}
@@ -0,0 +1,109 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var epoch = time.Unix(1000, 0)
+
+// received returns the time waiting on c, if any.
+func received(c <-chan time.Time) (t time.Time, ok bool) {
+	select {
+	case t = <-c:
+		return t, true
+	default:
+		return
+	}
+}
+
+func TestFake_Timer(t *testing.T) {
+	clock := NewFake(epoch)
+	timer := clock.NewTimer(time.Second)
+
+	clock.Advance(999 * time.Millisecond)
+	if _, ok := received(timer.C()); ok {
+		t.Fatalf("Timer fired early")
+	}
+
+	clock.Advance(2 * time.Millisecond)
+	if got, ok := received(timer.C()); !ok || !got.Equal(epoch.Add(time.Second)) {
+		t.Fatalf("Expected timer to fire at %v, got %v (fired=%v)", epoch.Add(time.Second), got, ok)
+	}
+	if now := clock.Now(); !now.Equal(epoch.Add(1001 * time.Millisecond)) {
+		t.Errorf("Expected time %v, got %v", epoch.Add(1001*time.Millisecond), now)
+	}
+
+	clock.Advance(time.Hour)
+	if _, ok := received(timer.C()); ok {
+		t.Errorf("Timer fired twice")
+	}
+	if timer.Stop() {
+		t.Errorf("Expected Stop to return false for an expired timer")
+	}
+}
+
+func TestFake_TimerStop(t *testing.T) {
+	clock := NewFake(epoch)
+	timer := clock.NewTimer(time.Second)
+
+	if !timer.Stop() {
+		t.Errorf("Expected Stop to return true for an active timer")
+	}
+	clock.Advance(time.Hour)
+	if _, ok := received(timer.C()); ok {
+		t.Errorf("Stopped timer fired")
+	}
+}
+
+func TestFake_Ticker(t *testing.T) {
+	type Test struct {
+		advance time.Duration
+		ticks   int
+	}
+
+	var tests = []Test{
+		{50 * time.Millisecond, 0},
+		{50 * time.Millisecond, 1},
+		{99 * time.Millisecond, 0},
+		{1 * time.Millisecond, 1},
+		// Ticks are dropped if they aren't received.
+		{time.Second, 1},
+	}
+
+	clock := NewFake(epoch)
+	ticker := clock.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for i, test := range tests {
+		clock.Advance(test.advance)
+		ticks := 0
+		for {
+			if _, ok := received(ticker.C()); !ok {
+				break
+			}
+			ticks++
+		}
+		if ticks != test.ticks {
+			t.Errorf("[%d] Advance(%v): expected %d ticks, got %d", i, test.advance, test.ticks, ticks)
+		}
+	}
+}
+
+func TestFake_Order(t *testing.T) {
+	clock := NewFake(epoch)
+	ticker := clock.NewTicker(time.Second)
+	defer ticker.Stop()
+	timer := clock.NewTimer(1500 * time.Millisecond)
+
+	clock.Advance(1200 * time.Millisecond)
+	<-ticker.C()
+	clock.Advance(time.Second)
+
+	if got, _ := received(timer.C()); !got.Equal(epoch.Add(1500 * time.Millisecond)) {
+		t.Errorf("Expected timer to fire at %v, got %v", epoch.Add(1500*time.Millisecond), got)
+	}
+	if got, _ := received(ticker.C()); !got.Equal(epoch.Add(2 * time.Second)) {
+		t.Errorf("Expected tick at %v, got %v", epoch.Add(2*time.Second), got)
+	}
+}
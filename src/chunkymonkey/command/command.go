@@ -4,18 +4,25 @@ import (
 	"chunkymonkey/gamerules"
 )
 
-// A CommandCallback takes the name of the player invoking the command, any
+// A CommandCallback takes the player or console invoking the command, any
 // text supplied after the trigger for the command, and an interface via which
 // game-wide 'actions' can be taken.
-type CommandCallback func(player gamerules.IPlayerClient, args string, game gamerules.IGame)
+type CommandCallback func(sender gamerules.ICommandSender, args string, game gamerules.IGame)
 
 type Command struct {
 	Trigger     string          // The initial text eg. "give".
 	Description string          // A description of what the command does.
 	Usage       string          // A usage string for the command.
+	Permission  string          // If set, players need this permission to use the command.
 	Callback    CommandCallback // This function will be called if a Message begins with the CommandPrefix and the Trigger.
 }
 
 func NewCommand(trigger, desc, usage string, callback CommandCallback) *Command {
 	return &Command{Trigger: trigger, Description: desc, Usage: usage, Callback: callback}
 }
+
+// NewPermittedCommand creates a command that players need the permission to
+// use.
+func NewPermittedCommand(trigger, desc, usage, permission string, callback CommandCallback) *Command {
+	return &Command{Trigger: trigger, Description: desc, Usage: usage, Permission: permission, Callback: callback}
+}
@@ -20,8 +20,8 @@ type CommandFramework struct {
 func NewCommandFramework(prefix string) *CommandFramework {
 	cf := &CommandFramework{prefix: prefix}
 	cmds := getCommands()
-	commandHelp := NewCommand(helpCmd, helpDesc, helpUsage, func(player gamerules.IPlayerClient, msg string, game gamerules.IGame) {
-		cmdHelp(player, msg, cf, game)
+	commandHelp := NewCommand(helpCmd, helpDesc, helpUsage, func(sender gamerules.ICommandSender, msg string, game gamerules.IGame) {
+		cmdHelp(sender, msg, cf, game)
 	})
 	cmds[helpCmd] = commandHelp
 	cmds[helpShortCmd] = commandHelp
@@ -37,13 +37,18 @@ func (cf *CommandFramework) Commands() map[string]*Command {
 	return cf.cmds
 }
 
-func (cf *CommandFramework) Process(player gamerules.IPlayerClient, message string, game gamerules.IGame) {
+func (cf *CommandFramework) Process(sender gamerules.ICommandSender, message string, game gamerules.IGame) {
 	if len(message) < 2 || message[0:len(cf.prefix)] != cf.prefix {
 		return
 	}
 	attr := strings.Split(message, " ")
 	trigger := attr[0][1:]
 	if cmd, ok := cf.cmds[trigger]; ok {
-		cmd.Callback(player, message, game)
+		if cmd.Permission != "" && !permitted(sender, cmd.Permission) {
+			return
+		}
+		cmd.Callback(sender, message, game)
+	} else {
+		sender.EchoMessage(msgUnknownCommand)
 	}
 }
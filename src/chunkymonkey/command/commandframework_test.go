@@ -5,10 +5,21 @@ import (
 
 	"code.google.com/p/gomock/gomock"
 
+	"chunkymonkey/chat"
 	"chunkymonkey/gamerules"
 	"testmatcher"
 )
 
+// namedPlayer is a player without any permissions.
+type namedPlayer struct {
+	gamerules.IPlayerClient
+	name string
+}
+
+func (p *namedPlayer) Name() string {
+	return p.name
+}
+
 func TestCommandFramework(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
@@ -21,7 +32,7 @@ func TestCommandFramework(t *testing.T) {
 
 	cf := NewCommandFramework("/")
 
-	mockGame.EXPECT().BroadcastMessage("§dthis is a broadcast")
+	mockGame.EXPECT().BroadcastChat(chat.Announcement, "", "this is a broadcast")
 	cf.Process(mockPlayer, "/say this is a broadcast", mockGame)
 
 	mockGame.EXPECT().PlayerByName("thePlayer").Return(mockPlayer)
@@ -44,6 +55,44 @@ func TestCommandFramework(t *testing.T) {
 	mockPlayer.EXPECT().EchoMessage("Cannot give more than 512 items at once")
 	cf.Process(mockPlayer, "/give otherPlayer 1 513", mockGame)
 
+	mockPlayer.EXPECT().Ping().Return(int16(42))
+	mockPlayer.EXPECT().EchoMessage("Ping: 42ms")
+	cf.Process(mockPlayer, "/ping", mockGame)
+
+	mockGame.EXPECT().PlayerByName("otherPlayer").Return(mockOther)
+	mockOther.EXPECT().Ping().Return(int16(250))
+	mockPlayer.EXPECT().EchoMessage("otherPlayer's ping: 250ms")
+	cf.Process(mockPlayer, "/ping otherPlayer", mockGame)
+
+	// Players need permission to change the log levels.
+	plain := &namedPlayer{IPlayerClient: mockOther, name: "plain"}
+	mockOther.EXPECT().EchoMessage(msgNotPermitted)
+	cf.Process(plain, "/loglevel chunk debug", mockGame)
+
+	mockPlayer.EXPECT().EchoMessage("Log level of chunk set to debug")
+	cf.Process(mockPlayer, "/loglevel chunk debug", mockGame)
+
+	mockPlayer.EXPECT().EchoMessage(&testmatcher.StringPrefix{"Log levels: chunk=debug cmd="})
+	cf.Process(mockPlayer, "/loglevel", mockGame)
+
+	mockPlayer.EXPECT().EchoMessage(pasteUsage)
+	cf.Process(mockPlayer, "/paste castle", mockGame)
+
+	mockPlayer.EXPECT().EchoMessage(copyUsage)
+	cf.Process(mockPlayer, "/copy castle 1 2 3", mockGame)
+
+	mockPlayer.EXPECT().EchoMessage(pruneUsage)
+	cf.Process(mockPlayer, "/prune far", mockGame)
+
+	mockPlayer.EXPECT().EchoMessage(&testmatcher.StringPrefix{"'nosuch' is not a log subsystem"})
+	cf.Process(mockPlayer, "/loglevel nosuch debug", mockGame)
+
+	mockPlayer.EXPECT().EchoMessage("Log level of all set to info")
+	cf.Process(mockPlayer, "/loglevel all info", mockGame)
+
+	mockPlayer.EXPECT().EchoMessage("Command not available.")
+	cf.Process(mockPlayer, "/nosuch", mockGame)
+
 	mockPlayer.EXPECT().EchoMessage(&testmatcher.StringPrefix{"Commands:"})
 	cf.Process(mockPlayer, "/help", mockGame)
 
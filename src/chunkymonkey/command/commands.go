@@ -2,40 +2,85 @@ package command
 
 import (
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
 
+	"chunkymonkey/chat"
 	"chunkymonkey/gamerules"
+	"chunkymonkey/logger"
+	"chunkymonkey/permission"
+	"chunkymonkey/schematic"
 	. "chunkymonkey/types"
-	"log"
 )
 
 func getCommands() map[string]*Command {
 	cmds := map[string]*Command{}
 	cmds[sayCmd] = NewCommand(sayCmd, sayDesc, sayUsage, cmdSay)
-	cmds[tpCmd] = NewCommand(tpCmd, tpDesc, tpUsage, cmdTp)
+	cmds[meCmd] = NewCommand(meCmd, meDesc, meUsage, cmdMe)
+	cmds[tpCmd] = NewPermittedCommand(tpCmd, tpDesc, tpUsage, tpPermission, cmdTp)
 	cmds[killCmd] = NewCommand(killCmd, killDesc, killUsage, cmdKill)
 	cmds[tellCmd] = NewCommand(tellCmd, tellDesc, tellUsage, cmdTell)
-	cmds[giveCmd] = NewCommand(giveCmd, giveDesc, giveUsage, cmdGive)
+	cmds[giveCmd] = NewPermittedCommand(giveCmd, giveDesc, giveUsage, givePermission, cmdGive)
+	cmds[kickCmd] = NewPermittedCommand(kickCmd, kickDesc, kickUsage, kickPermission, cmdKick)
+	cmds[opCmd] = NewPermittedCommand(opCmd, opDesc, opUsage, opPermission, cmdOp)
+	cmds[deopCmd] = NewPermittedCommand(deopCmd, deopDesc, deopUsage, opPermission, cmdDeop)
+	cmds[banCmd] = NewPermittedCommand(banCmd, banDesc, banUsage, banPermission, cmdBan)
+	cmds[pardonCmd] = NewPermittedCommand(pardonCmd, pardonDesc, pardonUsage, banPermission, cmdPardon)
+	cmds[banIpCmd] = NewPermittedCommand(banIpCmd, banIpDesc, banIpUsage, banPermission, cmdBanIp)
+	cmds[pardonIpCmd] = NewPermittedCommand(pardonIpCmd, pardonIpDesc, pardonIpUsage, banPermission, cmdPardonIp)
+	cmds[whitelistCmd] = NewPermittedCommand(whitelistCmd, whitelistDesc, whitelistUsage, whitelistPermission, cmdWhitelist)
+	cmds[timeCmd] = NewPermittedCommand(timeCmd, timeDesc, timeUsage, timePermission, cmdTime)
+	cmds[pingCmd] = NewCommand(pingCmd, pingDesc, pingUsage, cmdPing)
+	cmds[logLevelCmd] = NewPermittedCommand(logLevelCmd, logLevelDesc, logLevelUsage, logLevelPermission, cmdLogLevel)
+	cmds[pasteCmd] = NewPermittedCommand(pasteCmd, pasteDesc, pasteUsage, pastePermission, cmdPaste)
+	cmds[copyCmd] = NewPermittedCommand(copyCmd, copyDesc, copyUsage, copyPermission, cmdCopy)
+	cmds[pruneCmd] = NewPermittedCommand(pruneCmd, pruneDesc, pruneUsage, prunePermission, cmdPrune)
+	cmds[viewDistanceCmd] = NewCommand(viewDistanceCmd, viewDistanceDesc, viewDistanceUsage, cmdViewDistance)
 	return cmds
 }
 
 const msgNotImplemented = "We are sorry. This command is not yet implemented."
 const msgUnknownItem = "Unknown item ID"
+const msgNotPlayer = "Only players can use this command without naming a player."
+const msgPlayersOnly = "Only players can use this command."
+const msgNotPermitted = "You do not have permission to use this command."
+
+// consoleName is who messages sent from the console are from.
+const consoleName = "Console"
 
 // say message
 const sayCmd = "say"
 const sayUsage = "say <message>"
 const sayDesc = "Broadcasts a message to all players without showing a player name. The message is colored pink."
 
-func cmdSay(player gamerules.IPlayerClient, message string, cmdHandler gamerules.IGame) {
+func cmdSay(sender gamerules.ICommandSender, message string, cmdHandler gamerules.IGame) {
 	args := strings.Split(message, " ")
 	if len(args) < 2 {
-		player.EchoMessage(sayUsage)
+		sender.EchoMessage(sayUsage)
 		return
 	}
 	msg := strings.Join(args[1:], " ")
-	cmdHandler.BroadcastMessage("§d" + msg)
+	cmdHandler.BroadcastChat(chat.Announcement, "", msg)
+}
+
+// me action
+const meCmd = "me"
+const meUsage = "me <action>"
+const meDesc = "Tells all players what you are doing, as \"* Name action\"."
+
+func cmdMe(sender gamerules.ICommandSender, message string, cmdHandler gamerules.IGame) {
+	args := strings.Split(message, " ")
+	if len(args) < 2 {
+		sender.EchoMessage(meUsage)
+		return
+	}
+	player, ok := sender.(namedSender)
+	if !ok {
+		sender.EchoMessage(msgPlayersOnly)
+		return
+	}
+	cmdHandler.BroadcastChat(chat.Action, player.Name(), strings.Join(args[1:], " "))
 }
 
 // tp player1 player2
@@ -44,10 +89,13 @@ const tpCmd = "tp"
 const tpUsage = "tp <player1> <player2>"
 const tpDesc = "Teleports player1 to player2."
 
-func cmdTp(player gamerules.IPlayerClient, message string, cmdHandler gamerules.IGame) {
+// tpPermission is needed by players to use /tp.
+const tpPermission = "admin.commands.tp"
+
+func cmdTp(sender gamerules.ICommandSender, message string, cmdHandler gamerules.IGame) {
 	args := strings.Split(message, " ")
 	if len(args) < 3 {
-		player.EchoMessage(tpUsage)
+		sender.EchoMessage(tpUsage)
 		return
 	}
 
@@ -55,12 +103,12 @@ func cmdTp(player gamerules.IPlayerClient, message string, cmdHandler gamerules.
 	destination := cmdHandler.PlayerByName(args[2])
 	if teleportee == nil {
 		msg := fmt.Sprintf("'%s' is not logged in", args[1])
-		player.EchoMessage(msg)
+		sender.EchoMessage(msg)
 		return
 	}
 	if destination == nil {
 		msg := fmt.Sprintf("'%s' is not logged in", args[2])
-		player.EchoMessage(msg)
+		sender.EchoMessage(msg)
 		return
 	}
 
@@ -69,10 +117,16 @@ func cmdTp(player gamerules.IPlayerClient, message string, cmdHandler gamerules.
 	// TODO: Remove this hack or figure out what needs to happen instead
 	pos.Y += 1.63
 
+	// The destination player may not have moved inside the border yet.
+	border := cmdHandler.WorldBorder()
+	if border.Clamp(&pos) {
+		sender.EchoMessage(fmt.Sprintf("%s is outside the world border, teleporting to the nearest point inside", args[2]))
+	}
+
 	teleportee.EchoMessage(fmt.Sprintf("Hold still! You are being teleported to %s", args[2]))
 	msg := fmt.Sprintf("Teleporting %s to %s at (%.2f, %.2f, %.2f)", args[1], args[2], pos.X, pos.Y, pos.Z)
-	log.Printf("Message: %s", msg)
-	player.EchoMessage(msg)
+	logger.Cmd.Info("Teleporting player", "player", args[1], "to", args[2], "position", pos)
+	sender.EchoMessage(msg)
 
 	teleportee.SetPositionLook(pos, look)
 }
@@ -82,9 +136,9 @@ const killCmd = "kill"
 const killUsage = "kill"
 const killDesc = "Inflicts damage to self. Useful when lost or stuck."
 
-func cmdKill(player gamerules.IPlayerClient, message string, cmdHandler gamerules.IGame) {
+func cmdKill(sender gamerules.ICommandSender, message string, cmdHandler gamerules.IGame) {
 	// TODO inflict damage to player
-	player.EchoMessage(msgNotImplemented)
+	sender.EchoMessage(msgNotImplemented)
 }
 
 // /tell player message
@@ -92,17 +146,19 @@ const tellCmd = "tell"
 const tellUsage = "tell <player> <message>"
 const tellDesc = "Tells a player a message."
 
-func cmdTell(player gamerules.IPlayerClient, message string, cmdHandler gamerules.IGame) {
+func cmdTell(sender gamerules.ICommandSender, message string, cmdHandler gamerules.IGame) {
 	args := strings.Split(message, " ")
 	if len(args) < 3 {
-		player.EchoMessage(tellUsage)
+		sender.EchoMessage(tellUsage)
+		return
+	}
+	recipient := cmdHandler.PlayerByName(args[1])
+	if recipient == nil {
+		sender.EchoMessage(fmt.Sprintf("'%s' is not logged in", args[1]))
 		return
 	}
-	/* TODO Get player to send message, too
-	player := args[1]
-	message := strings.Join(args[2:], " ")
-	*/
-	player.EchoMessage(msgNotImplemented)
+
+	recipient.SendChat(chat.Private, senderName(sender), strings.Join(args[2:], " "))
 }
 
 const helpShortCmd = "?"
@@ -111,22 +167,22 @@ const helpUsage = "help|?"
 const helpDesc = "Shows a list of all commands."
 const msgUnknownCommand = "Command not available."
 
-func cmdHelp(player gamerules.IPlayerClient, message string, cmdFramework *CommandFramework, cmdHandler gamerules.IGame) {
+func cmdHelp(sender gamerules.ICommandSender, message string, cmdFramework *CommandFramework, cmdHandler gamerules.IGame) {
 	args := strings.Split(message, " ")
 	if len(args) > 2 {
-		player.EchoMessage(helpUsage)
+		sender.EchoMessage(helpUsage)
 		return
 	}
 	cmds := cmdFramework.Commands()
 	if len(args) == 2 {
 		cmd := args[1]
 		if command, ok := cmds[cmd]; ok {
-			player.EchoMessage("Command: " + cmdFramework.Prefix() + command.Trigger)
-			player.EchoMessage("Usage: " + command.Usage)
-			player.EchoMessage("Description: " + command.Description)
+			sender.EchoMessage("Command: " + cmdFramework.Prefix() + command.Trigger)
+			sender.EchoMessage("Usage: " + command.Usage)
+			sender.EchoMessage("Description: " + command.Description)
 			return
 		}
-		player.EchoMessage(msgUnknownCommand)
+		sender.EchoMessage(msgUnknownCommand)
 		return
 	}
 	var resp string
@@ -139,17 +195,20 @@ func cmdHelp(player gamerules.IPlayerClient, message string, cmdFramework *Comma
 		}
 		resp = resp[:len(resp)-1]
 	}
-	player.EchoMessage(resp)
+	sender.EchoMessage(resp)
 }
 
 const giveCmd = "give"
 const giveUsage = "give <player> <item ID> [<quantity> [<data>]]"
 const giveDesc = "Gives x amount of y items to player."
 
-func cmdGive(player gamerules.IPlayerClient, message string, cmdHandler gamerules.IGame) {
+// givePermission is needed by players to use /give.
+const givePermission = "admin.commands.give"
+
+func cmdGive(sender gamerules.ICommandSender, message string, cmdHandler gamerules.IGame) {
 	args := strings.Split(message, " ")
 	if len(args) < 3 || len(args) > 5 {
-		player.EchoMessage(giveUsage)
+		sender.EchoMessage(giveUsage)
 		return
 	}
 	args = args[1:]
@@ -160,7 +219,7 @@ func cmdGive(player gamerules.IPlayerClient, message string, cmdHandler gamerule
 
 	if target == nil {
 		msg := fmt.Sprintf("'%s' is not logged in", args[0])
-		player.EchoMessage(msg)
+		sender.EchoMessage(msg)
 		return
 	}
 
@@ -168,7 +227,7 @@ func cmdGive(player gamerules.IPlayerClient, message string, cmdHandler gamerule
 	itemType, ok := cmdHandler.ItemTypeById(itemNum)
 	if err != nil || !ok {
 		msg := fmt.Sprintf("'%s' is not a valid item id", args[1])
-		player.EchoMessage(msg)
+		sender.EchoMessage(msg)
 		return
 	}
 
@@ -176,13 +235,13 @@ func cmdGive(player gamerules.IPlayerClient, message string, cmdHandler gamerule
 	if len(args) >= 3 {
 		quantity, err = strconv.Atoi(args[2])
 		if err != nil {
-			player.EchoMessage(giveUsage)
+			sender.EchoMessage(giveUsage)
 			return
 		}
 
 		if quantity > 512 {
 			msg := "Cannot give more than 512 items at once"
-			player.EchoMessage(msg)
+			sender.EchoMessage(msg)
 			return
 		}
 	}
@@ -191,14 +250,14 @@ func cmdGive(player gamerules.IPlayerClient, message string, cmdHandler gamerule
 	if len(args) >= 4 {
 		data, err = strconv.Atoi(args[2])
 		if err != nil {
-			player.EchoMessage(giveUsage)
+			sender.EchoMessage(giveUsage)
 			return
 		}
 	}
 
 	// Perform the actual give
 	msg := fmt.Sprintf("Giving %d of '%s' to %s", quantity, itemType.Name, args[0])
-	player.EchoMessage(msg)
+	sender.EchoMessage(msg)
 
 	maxStack := int(itemType.MaxStack)
 
@@ -217,8 +276,614 @@ func cmdGive(player gamerules.IPlayerClient, message string, cmdHandler gamerule
 		quantity -= count
 	}
 
-	if player != target {
-		msg = fmt.Sprintf("%s gave you %d of '%s'", player, quantity, itemType.Name)
+	if sender != target {
+		msg = fmt.Sprintf("%s gave you %d of '%s'", sender, quantity, itemType.Name)
 		target.EchoMessage(msg)
 	}
 }
+
+// /time set <ticks>
+const timeCmd = "time"
+const timeUsage = "time set <ticks>|day|night | time add <ticks>"
+const timeDesc = "Sets the time of day, in ticks since dawn (0-23999), or moves the time on."
+
+// timeNames are the times of day that /time set takes by name.
+var timeNames = map[string]Ticks{
+	"day":   0,
+	"night": NightStartTicks,
+}
+
+// timePermission is needed by players to use /time.
+const timePermission = "admin.commands.time"
+
+func cmdTime(sender gamerules.ICommandSender, message string, cmdHandler gamerules.IGame) {
+	args := strings.Split(message, " ")
+	if len(args) != 3 {
+		sender.EchoMessage(timeUsage)
+		return
+	}
+
+	switch args[1] {
+	case "set":
+		time, ok := timeNames[args[2]]
+		if !ok {
+			t, err := strconv.ParseInt(args[2], 10, 64)
+			if err != nil || t < 0 || t >= TicksPerDay {
+				sender.EchoMessage(timeUsage)
+				return
+			}
+			time = Ticks(t)
+		}
+		cmdHandler.SetTime(time)
+		sender.EchoMessage(fmt.Sprintf("Time set to %d", time))
+	case "add":
+		ticks, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil || ticks <= 0 {
+			sender.EchoMessage(timeUsage)
+			return
+		}
+		cmdHandler.AddTime(Ticks(ticks))
+		sender.EchoMessage(fmt.Sprintf("Added %d to the time", ticks))
+	default:
+		sender.EchoMessage(timeUsage)
+	}
+}
+
+// /ping [player]
+const pingCmd = "ping"
+const pingUsage = "ping [<player>]"
+const pingDesc = "Shows your roundtrip latency to the server, or another player's."
+
+func cmdPing(sender gamerules.ICommandSender, message string, cmdHandler gamerules.IGame) {
+	args := strings.Split(message, " ")
+	switch len(args) {
+	case 1:
+		player, ok := sender.(gamerules.IPlayerClient)
+		if !ok {
+			sender.EchoMessage(msgNotPlayer)
+			return
+		}
+		sender.EchoMessage(fmt.Sprintf("Ping: %dms", player.Ping()))
+	case 2:
+		target := cmdHandler.PlayerByName(args[1])
+		if target == nil {
+			sender.EchoMessage(fmt.Sprintf("'%s' is not logged in", args[1]))
+			return
+		}
+		sender.EchoMessage(fmt.Sprintf("%s's ping: %dms", args[1], target.Ping()))
+	default:
+		sender.EchoMessage(pingUsage)
+	}
+}
+
+// /loglevel [<subsystem>|all <level>]
+const logLevelCmd = "loglevel"
+const logLevelUsage = "loglevel [<subsystem>|all <debug|info|warn|error>]"
+const logLevelDesc = "Shows the log level of each subsystem, or sets the level of one or all of them."
+
+// logLevelPermission is needed by players to use /loglevel.
+const logLevelPermission = "admin.commands.loglevel"
+
+func cmdLogLevel(sender gamerules.ICommandSender, message string, cmdHandler gamerules.IGame) {
+	args := strings.Split(message, " ")
+	switch len(args) {
+	case 1:
+		var levels []string
+		for _, name := range logger.Subsystems() {
+			subsystem, _ := logger.Lookup(name)
+			levels = append(levels, fmt.Sprintf("%s=%v", name, subsystem.Level()))
+		}
+		sender.EchoMessage("Log levels: " + strings.Join(levels, " "))
+	case 3:
+		level, err := logger.ParseLevel(args[2])
+		if err != nil {
+			sender.EchoMessage(logLevelUsage)
+			return
+		}
+		if args[1] == "all" {
+			for _, name := range logger.Subsystems() {
+				logger.SetLevel(name, level)
+			}
+		} else if err = logger.SetLevel(args[1], level); err != nil {
+			sender.EchoMessage(fmt.Sprintf("'%s' is not a log subsystem, expected one of: %s",
+				args[1], strings.Join(logger.Subsystems(), " ")))
+			return
+		}
+		logger.Cmd.Info("Log level set", "subsystem", args[1], "level", level)
+		sender.EchoMessage(fmt.Sprintf("Log level of %s set to %v", args[1], level))
+	default:
+		sender.EchoMessage(logLevelUsage)
+	}
+}
+
+// /paste <schematic> <x> <y> <z> [<quarter turns>] [skipair]
+const pasteCmd = "paste"
+const pasteUsage = "paste <schematic> <x> <y> <z> [<quarter turns>] [skipair]"
+const pasteDesc = "Pastes a schematic with its lowest north-west corner at x, y, z, rotated clockwise by the number of quarter turns. With skipair, air in the schematic leaves blocks in place."
+
+// pastePermission is needed by players to use /paste.
+const pastePermission = "admin.commands.paste"
+
+// namedSender is a command sender that is a player.
+type namedSender interface {
+	Name() string
+}
+
+// permitted returns true if the sender may use a command needing the
+// permission, telling them if not. It is checked by the CommandFramework for
+// commands with a Permission. Senders that aren't players, such as the
+// console, are trusted.
+func permitted(sender gamerules.ICommandSender, permission string) bool {
+	if player, ok := sender.(namedSender); ok {
+		if gamerules.Permissions == nil || !gamerules.Permissions.UserPermissions(player.Name()).Has(permission) {
+			sender.EchoMessage(msgNotPermitted)
+			return false
+		}
+	}
+	return true
+}
+
+// parseBlockXyz parses x, y and z arguments as a block position, telling the
+// sender if they are bad.
+func parseBlockXyz(sender gamerules.ICommandSender, args []string, usage string) (loc BlockXyz, ok bool) {
+	var coords [3]int64
+	for i := range coords {
+		var err error
+		if coords[i], err = strconv.ParseInt(args[i], 10, 32); err != nil {
+			sender.EchoMessage(usage)
+			return
+		}
+	}
+	if coords[1] < MinYCoord || coords[1] > MaxYCoord {
+		sender.EchoMessage(fmt.Sprintf("y must be from %d to %d", MinYCoord, MaxYCoord))
+		return
+	}
+	return BlockXyz{BlockCoord(coords[0]), BlockYCoord(coords[1]), BlockCoord(coords[2])}, true
+}
+
+func cmdPaste(sender gamerules.ICommandSender, message string, cmdHandler gamerules.IGame) {
+	args := strings.Split(message, " ")
+	if len(args) < 5 || len(args) > 7 {
+		sender.EchoMessage(pasteUsage)
+		return
+	}
+
+	at, ok := parseBlockXyz(sender, args[2:5], pasteUsage)
+	if !ok {
+		return
+	}
+
+	var options schematic.PasteOptions
+	for _, arg := range args[5:] {
+		if arg == "skipair" {
+			options.SkipAir = true
+		} else if turns, err := strconv.Atoi(arg); err == nil {
+			options.Rotation = turns
+		} else {
+			sender.EchoMessage(pasteUsage)
+			return
+		}
+	}
+
+	name := args[1]
+	cmdHandler.PasteSchematic(name, at, options, func(changed int, err error) {
+		if err != nil {
+			logger.Cmd.Warn("Paste failed", "sender", sender, "schematic", name, "err", err)
+			sender.EchoMessage(fmt.Sprintf("Paste failed: %v", err))
+			return
+		}
+		logger.Cmd.Info("Pasted schematic", "sender", sender, "schematic", name, "at", at, "blocks", changed)
+		sender.EchoMessage(fmt.Sprintf("Pasted %d blocks of %s", changed, name))
+	})
+}
+
+// /copy <schematic> [<x1> <y1> <z1> <x2> <y2> <z2>]
+const copyCmd = "copy"
+const copyUsage = "copy <schematic> [<x1> <y1> <z1> <x2> <y2> <z2>]"
+const copyDesc = "Saves the blocks between two opposite corners as a schematic. Players can leave out the corners to copy the region selected with the wand."
+const msgNoSelection = "Select two corners with the wand first, or give them."
+
+// copyPermission is needed by players to use /copy, and to select regions
+// with the wand.
+const copyPermission = "admin.commands.copy"
+
+// selectingSender is a command sender that can select regions with the wand.
+type selectingSender interface {
+	Selection() (from, to BlockXyz, ok bool)
+}
+
+func cmdCopy(sender gamerules.ICommandSender, message string, cmdHandler gamerules.IGame) {
+	args := strings.Split(message, " ")
+	var from, to BlockXyz
+	switch len(args) {
+	case 2:
+		player, ok := sender.(selectingSender)
+		if !ok {
+			sender.EchoMessage(copyUsage)
+			return
+		}
+		if from, to, ok = player.Selection(); !ok {
+			sender.EchoMessage(msgNoSelection)
+			return
+		}
+	case 8:
+		var ok bool
+		if from, ok = parseBlockXyz(sender, args[2:5], copyUsage); !ok {
+			return
+		}
+		if to, ok = parseBlockXyz(sender, args[5:8], copyUsage); !ok {
+			return
+		}
+	default:
+		sender.EchoMessage(copyUsage)
+		return
+	}
+
+	name := args[1]
+	cmdHandler.CopySchematic(name, from, to, func(blocks int, err error) {
+		if err != nil {
+			logger.Cmd.Warn("Copy failed", "sender", sender, "schematic", name, "err", err)
+			sender.EchoMessage(fmt.Sprintf("Copy failed: %v", err))
+			return
+		}
+		logger.Cmd.Info("Copied schematic", "sender", sender, "schematic", name, "from", from, "to", to, "blocks", blocks)
+		sender.EchoMessage(fmt.Sprintf("Copied %d blocks to %s", blocks, name))
+	})
+}
+
+// /prune <radius> [dryrun]
+const pruneCmd = "prune"
+const pruneUsage = "prune <radius> [dryrun]"
+const pruneDesc = "Deletes the stored chunks further than radius chunks from the spawn, apart from loaded chunks and those with players' beds. With dryrun, only reports what would be deleted."
+
+// prunePermission is needed by players to use /prune.
+const prunePermission = "admin.commands.prune"
+
+func cmdPrune(sender gamerules.ICommandSender, message string, cmdHandler gamerules.IGame) {
+	args := strings.Split(message, " ")
+	if len(args) < 2 || len(args) > 3 || (len(args) == 3 && args[2] != "dryrun") {
+		sender.EchoMessage(pruneUsage)
+		return
+	}
+	radius, err := strconv.Atoi(args[1])
+	if err != nil || radius < 0 {
+		sender.EchoMessage(pruneUsage)
+		return
+	}
+	dryRun := len(args) == 3
+
+	cmdHandler.PruneChunks(radius, dryRun, func(chunks int, bytes int64, err error) {
+		switch {
+		case err != nil:
+			sender.EchoMessage(fmt.Sprintf("Prune failed: %v", err))
+		case dryRun:
+			sender.EchoMessage(fmt.Sprintf("Would prune %d chunks, freeing %d bytes", chunks, bytes))
+		default:
+			logger.Cmd.Info("Pruned chunks", "sender", sender, "radius", radius, "chunks", chunks, "bytes", bytes)
+			sender.EchoMessage(fmt.Sprintf("Pruned %d chunks, freeing %d bytes", chunks, bytes))
+		}
+	})
+}
+
+// /viewdistance <chunks>
+const viewDistanceCmd = "viewdistance"
+const viewDistanceUsage = "viewdistance <chunks>"
+const viewDistanceDesc = "Sets how many chunks around you that you are sent, in each direction."
+
+// viewingSender is a command sender that is sent the chunks around them.
+type viewingSender interface {
+	SetViewDistance(chunks int)
+}
+
+func cmdViewDistance(sender gamerules.ICommandSender, message string, cmdHandler gamerules.IGame) {
+	player, ok := sender.(viewingSender)
+	if !ok {
+		sender.EchoMessage(msgPlayersOnly)
+		return
+	}
+
+	args := strings.Split(message, " ")
+	if len(args) != 2 {
+		sender.EchoMessage(viewDistanceUsage)
+		return
+	}
+	chunks, err := strconv.Atoi(args[1])
+	if err != nil {
+		sender.EchoMessage(viewDistanceUsage)
+		return
+	}
+	player.SetViewDistance(chunks)
+}
+
+// /kick <player> [<reason>]
+const kickCmd = "kick"
+const kickUsage = "kick <player> [<reason>]"
+const kickDesc = "Disconnects a player, telling them the reason."
+const kickDefaultReason = "Kicked by an operator"
+
+// kickPermission is needed by players to use /kick.
+const kickPermission = "admin.commands.kick"
+
+// kickableClient is a player that can be disconnected.
+type kickableClient interface {
+	Kick(reason string)
+}
+
+func cmdKick(sender gamerules.ICommandSender, message string, cmdHandler gamerules.IGame) {
+	args := strings.Split(message, " ")
+	if len(args) < 2 {
+		sender.EchoMessage(kickUsage)
+		return
+	}
+	target, ok := cmdHandler.PlayerByName(args[1]).(kickableClient)
+	if !ok {
+		sender.EchoMessage(fmt.Sprintf("'%s' is not logged in", args[1]))
+		return
+	}
+
+	reason := kickDefaultReason
+	if len(args) > 2 {
+		reason = strings.Join(args[2:], " ")
+	}
+	logger.Cmd.Info("Kicking player", "sender", sender, "player", args[1], "reason", reason)
+	target.Kick(reason)
+	sender.EchoMessage(fmt.Sprintf("Kicked %s", args[1]))
+}
+
+// /op <player>
+const opCmd = "op"
+const opUsage = "op <player>"
+const opDesc = "Makes a player an operator, with every permission."
+
+// opPermission is needed by players to use /op and /deop.
+const opPermission = "admin.commands.op"
+
+const msgNoOpList = "There is no operator list."
+
+func cmdOp(sender gamerules.ICommandSender, message string, cmdHandler gamerules.IGame) {
+	args := strings.Split(message, " ")
+	if len(args) != 2 {
+		sender.EchoMessage(opUsage)
+		return
+	}
+	if gamerules.Ops == nil {
+		sender.EchoMessage(msgNoOpList)
+		return
+	}
+
+	name := args[1]
+	added, err := gamerules.Ops.Op(name)
+	switch {
+	case err != nil:
+		logger.Cmd.Error("Saving operators failed", "err", err)
+		sender.EchoMessage(fmt.Sprintf("Saving operators failed: %v", err))
+	case !added:
+		sender.EchoMessage(fmt.Sprintf("%s is already an operator", name))
+	default:
+		logger.Cmd.Info("Opped player", "sender", sender, "player", name)
+		sender.EchoMessage(fmt.Sprintf("Made %s an operator", name))
+		if target := cmdHandler.PlayerByName(name); target != nil {
+			target.EchoMessage("You are now an operator")
+		}
+	}
+}
+
+// /deop <player>
+const deopCmd = "deop"
+const deopUsage = "deop <player>"
+const deopDesc = "Stops a player being an operator."
+
+func cmdDeop(sender gamerules.ICommandSender, message string, cmdHandler gamerules.IGame) {
+	args := strings.Split(message, " ")
+	if len(args) != 2 {
+		sender.EchoMessage(deopUsage)
+		return
+	}
+	if gamerules.Ops == nil {
+		sender.EchoMessage(msgNoOpList)
+		return
+	}
+
+	name := args[1]
+	removed, err := gamerules.Ops.Deop(name)
+	switch {
+	case err != nil:
+		logger.Cmd.Error("Saving operators failed", "err", err)
+		sender.EchoMessage(fmt.Sprintf("Saving operators failed: %v", err))
+	case !removed:
+		sender.EchoMessage(fmt.Sprintf("%s is not an operator", name))
+	default:
+		logger.Cmd.Info("Deopped player", "sender", sender, "player", name)
+		sender.EchoMessage(fmt.Sprintf("%s is no longer an operator", name))
+		if target := cmdHandler.PlayerByName(name); target != nil {
+			target.EchoMessage("You are no longer an operator")
+		}
+	}
+}
+
+// senderName returns the name of the player sending a command, or consoleName.
+func senderName(sender gamerules.ICommandSender) string {
+	if player, ok := sender.(namedSender); ok {
+		return player.Name()
+	}
+	return consoleName
+}
+
+// banPermission is needed by players to ban and pardon players and addresses.
+const banPermission = "admin.commands.ban"
+
+const msgNoBanList = "There is no ban list."
+const banKickMsg = "You are banned from this server"
+
+// /ban <player> [<reason>]
+const banCmd = "ban"
+const banUsage = "ban <player> [<reason>]"
+const banDesc = "Stops a player logging in, and kicks them if they are logged in."
+
+func cmdBan(sender gamerules.ICommandSender, message string, cmdHandler gamerules.IGame) {
+	args := strings.Split(message, " ")
+	if len(args) < 2 {
+		sender.EchoMessage(banUsage)
+		return
+	}
+	if gamerules.BannedPlayers == nil {
+		sender.EchoMessage(msgNoBanList)
+		return
+	}
+
+	name := args[1]
+	reason := strings.Join(args[2:], " ")
+	if err := gamerules.BannedPlayers.Ban(name, senderName(sender), reason); err != nil {
+		logger.Cmd.Error("Saving bans failed", "err", err)
+		sender.EchoMessage(fmt.Sprintf("Saving bans failed: %v", err))
+		return
+	}
+	logger.Cmd.Info("Banned player", "sender", sender, "player", name, "reason", reason)
+	sender.EchoMessage(fmt.Sprintf("Banned %s", name))
+
+	if target, ok := cmdHandler.PlayerByName(name).(kickableClient); ok {
+		kickMsg := banKickMsg
+		if reason != "" {
+			kickMsg += ": " + reason
+		}
+		target.Kick(kickMsg)
+	}
+}
+
+// /pardon <player>
+const pardonCmd = "pardon"
+const pardonUsage = "pardon <player>"
+const pardonDesc = "Lets a banned player log in again."
+
+func cmdPardon(sender gamerules.ICommandSender, message string, cmdHandler gamerules.IGame) {
+	args := strings.Split(message, " ")
+	if len(args) != 2 {
+		sender.EchoMessage(pardonUsage)
+		return
+	}
+	if gamerules.BannedPlayers == nil {
+		sender.EchoMessage(msgNoBanList)
+		return
+	}
+	pardon(sender, gamerules.BannedPlayers, args[1])
+}
+
+// /ban-ip <address> [<reason>]
+const banIpCmd = "ban-ip"
+const banIpUsage = "ban-ip <address> [<reason>]"
+const banIpDesc = "Stops anyone logging in from an IP address."
+
+func cmdBanIp(sender gamerules.ICommandSender, message string, cmdHandler gamerules.IGame) {
+	args := strings.Split(message, " ")
+	if len(args) < 2 {
+		sender.EchoMessage(banIpUsage)
+		return
+	}
+	if gamerules.BannedIps == nil {
+		sender.EchoMessage(msgNoBanList)
+		return
+	}
+	ip := net.ParseIP(args[1])
+	if ip == nil {
+		sender.EchoMessage(fmt.Sprintf("'%s' is not an IP address", args[1]))
+		return
+	}
+
+	address := ip.String()
+	reason := strings.Join(args[2:], " ")
+	if err := gamerules.BannedIps.Ban(address, senderName(sender), reason); err != nil {
+		logger.Cmd.Error("Saving bans failed", "err", err)
+		sender.EchoMessage(fmt.Sprintf("Saving bans failed: %v", err))
+		return
+	}
+	logger.Cmd.Info("Banned IP address", "sender", sender, "ip", address, "reason", reason)
+	sender.EchoMessage(fmt.Sprintf("Banned %s", address))
+}
+
+// /pardon-ip <address>
+const pardonIpCmd = "pardon-ip"
+const pardonIpUsage = "pardon-ip <address>"
+const pardonIpDesc = "Lets players log in from a banned IP address again."
+
+func cmdPardonIp(sender gamerules.ICommandSender, message string, cmdHandler gamerules.IGame) {
+	args := strings.Split(message, " ")
+	if len(args) != 2 {
+		sender.EchoMessage(pardonIpUsage)
+		return
+	}
+	if gamerules.BannedIps == nil {
+		sender.EchoMessage(msgNoBanList)
+		return
+	}
+	address := args[1]
+	if ip := net.ParseIP(address); ip != nil {
+		address = ip.String()
+	}
+	pardon(sender, gamerules.BannedIps, address)
+}
+
+// pardon lifts the ban on the player name or address in bans.
+func pardon(sender gamerules.ICommandSender, bans *permission.BanList, key string) {
+	removed, err := bans.Pardon(key)
+	switch {
+	case err != nil:
+		logger.Cmd.Error("Saving bans failed", "err", err)
+		sender.EchoMessage(fmt.Sprintf("Saving bans failed: %v", err))
+	case !removed:
+		sender.EchoMessage(fmt.Sprintf("%s is not banned", key))
+	default:
+		logger.Cmd.Info("Pardoned", "sender", sender, "banned", key)
+		sender.EchoMessage(fmt.Sprintf("Pardoned %s", key))
+	}
+}
+
+// /whitelist add|remove <player>
+// /whitelist list
+const whitelistCmd = "whitelist"
+const whitelistUsage = "whitelist add|remove <player> | whitelist list"
+const whitelistDesc = "Changes or lists the players allowed to log in when the whitelist is on."
+
+// whitelistPermission is needed by players to use /whitelist.
+const whitelistPermission = "admin.commands.whitelist"
+
+func cmdWhitelist(sender gamerules.ICommandSender, message string, cmdHandler gamerules.IGame) {
+	args := strings.Split(message, " ")
+	if len(args) < 2 {
+		sender.EchoMessage(whitelistUsage)
+		return
+	}
+	if gamerules.Whitelist == nil {
+		sender.EchoMessage("There is no whitelist.")
+		return
+	}
+
+	var changed bool
+	var err error
+	var done, unchanged string
+	switch {
+	case args[1] == "list" && len(args) == 2:
+		names := gamerules.Whitelist.Names()
+		sender.EchoMessage(fmt.Sprintf("Whitelisted players (%d): %s", len(names), strings.Join(names, ", ")))
+		return
+	case args[1] == "add" && len(args) == 3:
+		changed, err = gamerules.Whitelist.Add(args[2])
+		done, unchanged = "Added %s to the whitelist", "%s is already whitelisted"
+	case args[1] == "remove" && len(args) == 3:
+		changed, err = gamerules.Whitelist.Remove(args[2])
+		done, unchanged = "Removed %s from the whitelist", "%s is not whitelisted"
+	default:
+		sender.EchoMessage(whitelistUsage)
+		return
+	}
+
+	switch {
+	case err != nil:
+		logger.Cmd.Error("Saving whitelist failed", "err", err)
+		sender.EchoMessage(fmt.Sprintf("Saving whitelist failed: %v", err))
+	case !changed:
+		sender.EchoMessage(fmt.Sprintf(unchanged, args[2]))
+	default:
+		logger.Cmd.Info("Changed whitelist", "sender", sender, "action", args[1], "player", args[2])
+		sender.EchoMessage(fmt.Sprintf(done, args[2]))
+	}
+}
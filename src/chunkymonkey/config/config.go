@@ -0,0 +1,113 @@
+// The config package reads the server's configuration from a
+// server.properties file, as used by the standard server. Properties that
+// the server has flags for set those flags, unless they are given on the
+// command line.
+package config
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+var propertiesFile = flag.String(
+	"server_properties", "server.properties",
+	"Properties file whose settings are used for the flags not given on the "+
+		"command line, and whose level-type and generator-settings, if "+
+		"present, override the generator of the world.")
+
+// Properties are the "key=value" settings of a server.properties file.
+type Properties map[string]string
+
+// flagProperties maps the properties that set flags to the flags they set.
+var flagProperties = []struct {
+	property, flag string
+}{
+	{"motd", "server_desc"},
+	{"max-players", "max_player_count"},
+	{"view-distance", "view_distance"},
+	{"spawn-protection", "spawn_protection"},
+	{"online-mode", "online_mode"},
+	{"pvp", "pvp"},
+	{"white-list", "whitelist"},
+}
+
+// Load reads the properties file named by the -server_properties flag.
+func Load() (properties Properties, err error) {
+	return ReadProperties(*propertiesFile)
+}
+
+// ReadProperties reads a server.properties file of "key=value" lines, as used
+// by the standard server. Blank lines and lines starting with '#' are
+// ignored. A missing file is not an error, and results in no properties.
+func ReadProperties(filename string) (properties Properties, err error) {
+	properties = make(Properties)
+
+	file, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		properties[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	err = scanner.Err()
+	return
+}
+
+// ApplyFlags sets the flags of flagSet from the properties, after the command
+// line has been parsed. Flags given on the command line, flags that flagSet
+// doesn't have, and empty properties are left alone. server-ip and
+// server-port set the -addr flag.
+func (properties Properties) ApplyFlags(flagSet *flag.FlagSet) (err error) {
+	given := make(map[string]bool)
+	flagSet.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	set := func(property, name, value string) error {
+		if given[name] || flagSet.Lookup(name) == nil {
+			return nil
+		}
+		if err := flagSet.Set(name, value); err != nil {
+			return fmt.Errorf("Bad %s %q in %s: %v", property, value, *propertiesFile, err)
+		}
+		return nil
+	}
+
+	for _, fp := range flagProperties {
+		if value := properties[fp.property]; value != "" {
+			if err = set(fp.property, fp.flag, value); err != nil {
+				return
+			}
+		}
+	}
+
+	if port := properties["server-port"]; port != "" || properties["server-ip"] != "" {
+		if port == "" {
+			port = "25565"
+		}
+		addr := net.JoinHostPort(properties["server-ip"], port)
+		if err = set("server-port", "addr", addr); err != nil {
+			return
+		}
+	}
+
+	return nil
+}
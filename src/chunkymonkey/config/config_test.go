@@ -0,0 +1,101 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestReadProperties(t *testing.T) {
+	filename := path.Join(t.TempDir(), "server.properties")
+	content := "# comment\n\nmotd = A server\nlevel-type=FLAT\nnot a property\nempty=\n"
+	if err := ioutil.WriteFile(filename, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	properties, err := ReadProperties(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Properties{"motd": "A server", "level-type": "FLAT", "empty": ""}
+	if !reflect.DeepEqual(properties, expected) {
+		t.Errorf("Expected %v, got %v", expected, properties)
+	}
+
+	// A missing file has no properties.
+	properties, err = ReadProperties(path.Join(t.TempDir(), "missing"))
+	if err != nil || len(properties) != 0 {
+		t.Errorf("Expected no properties for a missing file, got %v, %v", properties, err)
+	}
+}
+
+// newTestFlagSet returns flags like the server's, with those in args given on
+// the command line.
+func newTestFlagSet(t *testing.T, args ...string) *flag.FlagSet {
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	flagSet.String("addr", ":25565", "")
+	flagSet.String("server_desc", "Chunkymonkey Minecraft server", "")
+	flagSet.Int("max_player_count", 16, "")
+	flagSet.Bool("online_mode", true, "")
+	if err := flagSet.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return flagSet
+}
+
+func TestProperties_ApplyFlags(t *testing.T) {
+	type Test struct {
+		desc       string
+		args       []string
+		properties Properties
+		expected   map[string]string
+	}
+
+	var tests = []Test{
+		{
+			"properties set the flags",
+			nil,
+			Properties{"motd": "A server", "max-players": "4", "online-mode": "false", "server-port": "25570"},
+			map[string]string{"server_desc": "A server", "max_player_count": "4", "online_mode": "false", "addr": ":25570"},
+		},
+		{
+			"the command line wins",
+			[]string{"-max_player_count=8", "-addr=:1234"},
+			Properties{"max-players": "4", "server-ip": "127.0.0.1", "server-port": "25570"},
+			map[string]string{"max_player_count": "8", "addr": ":1234"},
+		},
+		{
+			"the address without a port",
+			nil,
+			Properties{"server-ip": "::1"},
+			map[string]string{"addr": "[::1]:25565"},
+		},
+		{
+			"empty and unknown properties are ignored",
+			nil,
+			Properties{"motd": "", "view-distance": "5", "gamemode": "1"},
+			map[string]string{"server_desc": "Chunkymonkey Minecraft server"},
+		},
+	}
+
+	for _, test := range tests {
+		flagSet := newTestFlagSet(t, test.args...)
+		if err := test.properties.ApplyFlags(flagSet); err != nil {
+			t.Errorf("%s: ApplyFlags error: %v", test.desc, err)
+			continue
+		}
+		for name, value := range test.expected {
+			if result := flagSet.Lookup(name).Value.String(); result != value {
+				t.Errorf("%s: expected -%s=%q, got %q", test.desc, name, value, result)
+			}
+		}
+	}
+
+	// Values that the flags don't accept are errors.
+	flagSet := newTestFlagSet(t)
+	if err := (Properties{"max-players": "lots"}).ApplyFlags(flagSet); err == nil {
+		t.Errorf("Expected an error for a bad max-players")
+	}
+}
@@ -1,13 +1,20 @@
 package chunkymonkey
 
 import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
 	"errors"
 	"fmt"
-	"log"
+	"io"
 	"net"
+	"sync"
+	"time"
 
 	. "chunkymonkey/entity"
 	"chunkymonkey/gamerules"
+	"chunkymonkey/logger"
+	"chunkymonkey/permission"
 	"chunkymonkey/player"
 	"chunkymonkey/proto"
 	"chunkymonkey/server_auth"
@@ -23,87 +30,125 @@ const (
 	connTypeUnknown = iota
 	connTypeLogin
 	connTypeServerQuery
+	connTypeStatusQuery // From a newer client, with a different protocol.
 )
 
+// rejectLoginTimeout is how long a rejected client has to receive the reason,
+// so that a client that stops reading can't hold on to the connection.
+const rejectLoginTimeout = 2 * time.Second
+
+// loginTimeout is how long a client has to log in once connected, so that
+// clients that go silent while logging in don't hold on to the connection.
+// Once logged in, the player's keep-alives time the connection out instead.
+const loginTimeout = 30 * time.Second
+
 var (
-	clientErrGeneral      = errors.New("Server error.")
-	clientErrUsername     = errors.New("Bad username.")
-	clientErrLoginDenied  = errors.New("You do not have access to this server.")
-	clientErrHandshake    = errors.New("Handshake error.")
-	clientErrLoginGeneral = errors.New("Login error.")
-	clientErrAuthFailed   = errors.New("Minecraft authentication failed.")
-	clientErrUserData     = errors.New("Error reading user data. Please contact the server administrator.")
+	clientErrGeneral         = errors.New("Server error.")
+	clientErrUsername        = errors.New("Bad username. Use only letters, digits, '-' and '_'.")
+	clientErrLoginDenied     = errors.New("You do not have access to this server.")
+	clientErrHandshake       = errors.New("Handshake error.")
+	clientErrEncryption      = errors.New("Failed to set up an encrypted connection.")
+	clientErrProtocol        = errors.New("Protocol error while logging in. Is your client compatible?")
+	clientErrAuthFailed      = errors.New("Minecraft authentication failed. Try restarting your client.")
+	clientErrUserData        = errors.New("Error reading user data. Please contact the server administrator.")
+	clientErrLoggedIn        = errors.New("You are already logged in.")
+	clientErrLoginInProgress = errors.New("Someone is already logging in with your name.")
+	clientErrServerFull      = errors.New("The server is full.")
+	clientErrNotWhitelisted  = errors.New("You are not white-listed on this server!")
+
+	// Worded as the vanilla server does, so that players recognize them.
+	clientErrOutdatedClient = errors.New("Outdated client!")
+	clientErrOutdatedServer = errors.New("Outdated server!")
 
 	loginErrorConnType    = errors.New("unknown/bad connection type")
 	loginErrorMaintenance = errors.New("server under maintenance")
-	loginErrorServerList  = errors.New("server list poll")
+	loginErrorLoggedIn    = errors.New("player already logged in")
+	loginErrorServerFull  = errors.New("server full")
+	loginErrorVerifyToken = errors.New("encryption verify token mismatch")
+	loginErrorWhitelist   = errors.New("player not whitelisted")
 )
 
+// verifyTokenLength is the length of the random token that a client returns
+// encrypted to show that it has the server's public key.
+const verifyTokenLength = 4
+
 type GameInfo struct {
 	game           *Game
 	maxPlayerCount int
 	serverDesc     string
 	maintenanceMsg string
-	serverId       string
+	onlineMode     bool
 	shardManager   *shardserver.LocalShardManager
 	entityManager  *EntityManager
 	worldStore     *worldstore.WorldStore
 	authserver     server_auth.IAuthenticator
+
+	// Connections are encrypted if encryptionKey is set. publicKey is its
+	// public half, ASN.1 DER encoded as sent to clients.
+	encryptionKey *rsa.PrivateKey
+	publicKey     []byte
 }
 
-// Handles connections for a game on the given socket.
+// Handles connections for a game on the given sockets.
 type ConnHandler struct {
-	// UpdateGameInfo is used to reconfigure a running ConnHandler. A Game must
-	// pass something in before this ConnHandler will accept connections.
-	UpdateGameInfo chan *GameInfo
+	listeners []net.Listener
+	gameInfo  *GameInfo
 
-	listener net.Listener
-	gameInfo *GameInfo
+	stopping chan bool
+	stopOnce sync.Once
+	accepts  sync.WaitGroup
 }
 
-// NewConnHandler creates and starts a ConnHandler.
-func NewConnHandler(listener net.Listener, gameInfo *GameInfo) *ConnHandler {
+// NewConnHandler creates a ConnHandler, and starts accepting connections on
+// each of the listeners.
+func NewConnHandler(listeners []net.Listener, gameInfo *GameInfo) *ConnHandler {
 	ch := &ConnHandler{
-		UpdateGameInfo: make(chan *GameInfo),
-		listener:       listener,
-		gameInfo:       gameInfo,
+		listeners: listeners,
+		gameInfo:  gameInfo,
+		stopping:  make(chan bool),
 	}
 
-	go ch.run()
+	for _, listener := range listeners {
+		ch.accepts.Add(1)
+		go ch.accept(listener)
+	}
 
 	return ch
 }
 
 // Stop stops the connection handler from accepting any further connections.
+// It closes the listeners, and returns once they have stopped accepting.
 func (ch *ConnHandler) Stop() {
-	close(ch.UpdateGameInfo)
-	ch.listener.Close()
+	ch.stopOnce.Do(func() {
+		close(ch.stopping)
+		for _, listener := range ch.listeners {
+			listener.Close()
+		}
+	})
+	ch.accepts.Wait()
 }
 
-func (ch *ConnHandler) run() {
-	defer ch.listener.Close()
-	var ok bool
+// accept handles the connections accepted by a listener until it is closed.
+func (ch *ConnHandler) accept(listener net.Listener) {
+	defer ch.accepts.Done()
+	defer listener.Close()
 
 	for {
-		conn, err := ch.listener.Accept()
+		conn, err := listener.Accept()
 		if err != nil {
-			log.Print("Accept: ", err)
-			return
-		}
-
-		// Check for updated game info.
-		select {
-		case ch.gameInfo, ok = <-ch.UpdateGameInfo:
-			if !ok {
-				log.Print("Connection handler shut down.")
-				return
+			select {
+			case <-ch.stopping:
+				logger.Net.Info("Listener shut down", "listener", listener.Addr())
+			default:
+				logger.Net.Error("Accept failed", "listener", listener.Addr(), "err", err)
 			}
-		default:
+			return
 		}
 
 		newLogin := &pktHandler{
 			gameInfo: ch.gameInfo,
-			conn:     conn,
+			listener: listener.Addr(),
+			conn:     &countingConn{conn, &ch.gameInfo.game.netStats},
 		}
 		go newLogin.handle()
 	}
@@ -111,10 +156,16 @@ func (ch *ConnHandler) run() {
 
 type pktHandler struct {
 	gameInfo *GameInfo
+	listener net.Addr // The address of the listener that accepted the connection.
 	conn     net.Conn
 
 	connType int
 	username string
+	serverId string // Sent to the client in the handshake.
+
+	// The encryption key response, encrypted with the server's public key.
+	sharedSecret []byte
+	verifyToken  []byte
 }
 
 func (l *pktHandler) handle() {
@@ -122,29 +173,53 @@ func (l *pktHandler) handle() {
 
 	defer func() {
 		if err != nil {
-			log.Print("Connection closed ", err.Error())
+			logger.Net.Info("Connection closed", "addr", l.conn.RemoteAddr(), "listener", l.listener, "player", l.username, "err", err)
 			if clientErr == nil {
 				clientErr = clientErrGeneral
 			}
-			proto.WriteDisconnect(l.conn, clientErr.Error())
-			l.conn.Close()
+			rejectLogin(l.conn, clientErr.Error())
 		}
 	}()
 
-	err = proto.ServerReadPacketExpect(l.conn, l, []byte{
-		proto.PacketIdHandshake,
-		proto.PacketIdServerListPing,
-	})
-	if err != nil {
-		clientErr = clientErrLoginGeneral
+	l.conn.SetDeadline(time.Now().Add(loginTimeout))
+
+	// Older clients start with a packet ID of this protocol, and newer
+	// clients' status queries are told apart by their first bytes. Anything
+	// else is rejected.
+	prefix := make([]byte, 1, proto.StatusHandshakePrefixLength)
+	if _, err = io.ReadFull(l.conn, prefix); err != nil {
 		return
 	}
+	switch prefix[0] {
+	case proto.PacketIdHandshake, proto.PacketIdServerListPing:
+		err = proto.ServerReadPacketExpect(io.MultiReader(bytes.NewReader(prefix), l.conn), l, []byte{
+			proto.PacketIdHandshake,
+			proto.PacketIdServerListPing,
+		})
+		if err != nil {
+			clientErr = clientErrProtocol
+			return
+		}
+	default:
+		prefix = prefix[:cap(prefix)]
+		if _, err = io.ReadFull(l.conn, prefix[1:]); err != nil {
+			return
+		}
+		if !proto.IsStatusHandshake(prefix) {
+			err = fmt.Errorf("unknown connection starting with % x", prefix)
+			clientErr = clientErrProtocol
+			return
+		}
+		l.connType = connTypeStatusQuery
+	}
 
 	switch l.connType {
 	case connTypeLogin:
 		err, clientErr = l.handleLogin(l.conn)
 	case connTypeServerQuery:
-		err, clientErr = l.handleServerQuery(l.conn)
+		err = l.handleServerQuery(l.conn)
+	case connTypeStatusQuery:
+		err = l.handleStatusQuery(l.conn, prefix)
 	default:
 		err = loginErrorConnType
 	}
@@ -157,7 +232,11 @@ func (l *pktHandler) handleLogin(conn net.Conn) (err, clientErr error) {
 		return
 	}
 
-	log.Print("Client ", conn.RemoteAddr(), " connected as ", l.username)
+	logger.Net.Info("Client connected", "addr", conn.RemoteAddr(), "listener", l.listener, "player", l.username)
+
+	if err, clientErr = l.checkAccessLists(conn.RemoteAddr()); err != nil {
+		return
+	}
 
 	// TODO Allow admins to connect.
 	if l.gameInfo.maintenanceMsg != "" {
@@ -174,14 +253,27 @@ func (l *pktHandler) handleLogin(conn net.Conn) (err, clientErr error) {
 		return
 	}
 
-	if err = proto.ServerWriteHandshake(conn, l.gameInfo.serverId); err != nil {
+	if l.serverId, err = server_auth.NewServerId(l.gameInfo.onlineMode); err != nil {
+		return
+	}
+	authServerId := l.serverId
+	if l.gameInfo.encryptionKey != nil {
+		var sharedSecret []byte
+		if conn, sharedSecret, err = l.encrypt(conn); err != nil {
+			clientErr = clientErrEncryption
+			return
+		}
+		// Any rejection must now be sent encrypted.
+		l.conn = conn
+		authServerId = server_auth.EncryptedServerId(l.serverId, sharedSecret, l.gameInfo.publicKey)
+	} else if err = proto.ServerWriteHandshake(conn, l.serverId); err != nil {
 		clientErr = clientErrHandshake
 		return
 	}
 
-	if l.gameInfo.serverId != "-" {
+	if l.serverId != server_auth.OfflineServerId {
 		var authenticated bool
-		authenticated, err = l.gameInfo.authserver.Authenticate(l.gameInfo.serverId, l.username)
+		authenticated, err = l.gameInfo.authserver.Authenticate(authServerId, l.username, remoteHost(conn.RemoteAddr()))
 		if !authenticated || err != nil {
 			var reason string
 			if err != nil {
@@ -193,17 +285,42 @@ func (l *pktHandler) handleLogin(conn net.Conn) (err, clientErr error) {
 			clientErr = clientErrAuthFailed
 			return
 		}
-		log.Print("Client ", conn.RemoteAddr(), " passed minecraft.net authentication")
+		logger.Net.Info("Client passed minecraft.net authentication", "addr", conn.RemoteAddr(), "player", l.username)
 	}
 
 	err = proto.ServerReadPacketExpect(conn, l, []byte{
 		proto.PacketIdLogin,
 	})
-	if err != nil {
-		clientErr = clientErrLoginGeneral
+	if versionErr, ok := err.(proto.ProtocolVersionError); ok {
+		if versionErr.ClientOutdated() {
+			clientErr = clientErrOutdatedClient
+		} else {
+			clientErr = clientErrOutdatedServer
+		}
+		return
+	} else if err != nil {
+		clientErr = clientErrProtocol
 		return
 	}
 
+	// Any existing session for the player is ended and saved before their
+	// data is loaded.
+	if clientErr = l.gameInfo.game.claimPlayerName(l.username); clientErr != nil {
+		if clientErr == clientErrServerFull {
+			err = loginErrorServerFull
+		} else if clientErr == errGameStopped {
+			err = clientErr
+		} else {
+			err = loginErrorLoggedIn
+		}
+		return
+	}
+	defer func() {
+		if err != nil {
+			l.gameInfo.game.releasePlayerName(l.username)
+		}
+	}()
+
 	entityId := l.gameInfo.entityManager.NewEntity()
 
 	var playerData *nbt.Compound
@@ -212,7 +329,7 @@ func (l *pktHandler) handleLogin(conn net.Conn) (err, clientErr error) {
 		return
 	}
 
-	player := player.NewPlayer(entityId, l.gameInfo.shardManager, conn, l.username, l.gameInfo.worldStore.SpawnPosition, l.gameInfo.game.playerDisconnect, l.gameInfo.game)
+	player := player.NewPlayer(entityId, l.gameInfo.shardManager, conn, l.username, l.gameInfo.game.SpawnBlock(), l.gameInfo.game.playerDisconnect, l.gameInfo.game, l.gameInfo.game.clock)
 	if playerData != nil {
 		if err = player.UnmarshalNbt(playerData); err != nil {
 			// Don't let the player log in, as they will only have default inventory
@@ -224,21 +341,141 @@ func (l *pktHandler) handleLogin(conn net.Conn) (err, clientErr error) {
 		}
 	}
 
-	l.gameInfo.game.playerConnect <- player
+	if err = conn.SetDeadline(time.Time{}); err != nil {
+		return
+	}
+
+	select {
+	case l.gameInfo.game.playerConnect <- player:
+	case <-l.gameInfo.game.quit:
+		err = errGameStopped
+		clientErr = err
+		return
+	}
 	player.Run()
 
 	return
 }
 
-func (l *pktHandler) handleServerQuery(conn net.Conn) (err, clientErr error) {
-	err = loginErrorServerList
-	clientErr = fmt.Errorf(
-		"%s§%d§%d",
-		l.gameInfo.serverDesc,
-		l.gameInfo.game.PlayerCount(), l.gameInfo.maxPlayerCount)
+// remoteHost returns the IP address of a client's address, without the port.
+// Addresses that aren't host and port are returned whole.
+func remoteHost(addr net.Addr) string {
+	if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+		return host
+	}
+	return addr.String()
+}
+
+// checkAccessLists rejects players and addresses that are banned, and players
+// not on the whitelist when -whitelist is set. Operators needn't be on the
+// whitelist, but can still be banned.
+func (l *pktHandler) checkAccessLists(addr net.Addr) (err, clientErr error) {
+	if gamerules.BannedIps != nil {
+		if host, _, splitErr := net.SplitHostPort(addr.String()); splitErr == nil {
+			if ban, banned := gamerules.BannedIps.Banned(host); banned {
+				return fmt.Errorf("IP address %s is banned", host), banMessage("Your IP address is banned from this server", ban)
+			}
+		}
+	}
+
+	if gamerules.BannedPlayers != nil {
+		if ban, banned := gamerules.BannedPlayers.Banned(l.username); banned {
+			return fmt.Errorf("Player %q is banned", l.username), banMessage("You are banned from this server", ban)
+		}
+	}
+
+	if *whitelist && gamerules.Whitelist != nil && !gamerules.Whitelist.Contains(l.username) {
+		if gamerules.Ops == nil || !gamerules.Ops.IsOp(l.username) {
+			return loginErrorWhitelist, clientErrNotWhitelisted
+		}
+	}
+
+	return
+}
+
+// banMessage returns the error shown to a banned player, with the reason for
+// the ban if one was given.
+func banMessage(message string, ban permission.Ban) error {
+	if ban.Reason != "" {
+		message += ": " + ban.Reason
+	}
+	return errors.New(message + ".")
+}
+
+// encrypt agrees a shared secret with the client in place of the handshake
+// reply, and returns conn wrapped to be encrypted with it.
+func (l *pktHandler) encrypt(conn net.Conn) (encrypted net.Conn, sharedSecret []byte, err error) {
+	verifyToken := make([]byte, verifyTokenLength)
+	if _, err = rand.Read(verifyToken); err != nil {
+		return
+	}
+
+	if err = proto.ServerWriteEncryptionKeyRequest(conn, l.serverId, l.gameInfo.publicKey, verifyToken); err != nil {
+		return
+	}
+	err = proto.ServerReadPacketExpect(conn, l, []byte{
+		proto.PacketIdEncryptionKeyResponse,
+	})
+	if err != nil {
+		return
+	}
+
+	key := l.gameInfo.encryptionKey
+	if sharedSecret, err = rsa.DecryptPKCS1v15(rand.Reader, key, l.sharedSecret); err != nil {
+		return
+	}
+	returnedToken, err := rsa.DecryptPKCS1v15(rand.Reader, key, l.verifyToken)
+	if err != nil {
+		return
+	}
+	if !bytes.Equal(returnedToken, verifyToken) {
+		err = loginErrorVerifyToken
+		return
+	}
+
+	// The empty response is the last packet sent unencrypted.
+	if err = proto.WriteEncryptionKeyResponse(conn, nil, nil); err != nil {
+		return
+	}
+	encrypted, err = proto.WrapConn(conn, sharedSecret)
 	return
 }
 
+// rejectLogin sends the client a disconnect packet with the reason to show
+// the user, and closes the connection.
+func rejectLogin(conn net.Conn, reason string) {
+	conn.SetWriteDeadline(time.Now().Add(rejectLoginTimeout))
+	proto.WriteDisconnect(conn, reason)
+	conn.Close()
+}
+
+// serverListStatus returns what clients' server lists show about the game.
+func (l *pktHandler) serverListStatus() *proto.ServerListStatus {
+	return &proto.ServerListStatus{
+		Motd:        l.gameInfo.serverDesc,
+		PlayerCount: l.gameInfo.game.PlayerCount(),
+		MaxPlayers:  l.gameInfo.maxPlayerCount,
+	}
+}
+
+// handleServerQuery answers a server list ping, and closes the connection.
+func (l *pktHandler) handleServerQuery(conn net.Conn) (err error) {
+	defer conn.Close()
+	logger.Net.Debug("Server list ping", "addr", conn.RemoteAddr())
+
+	conn.SetWriteDeadline(time.Now().Add(rejectLoginTimeout))
+	return proto.WriteServerListStatus(conn, l.serverListStatus())
+}
+
+// handleStatusQuery answers the status query of a newer client, whose
+// handshake began with prefix, and closes the connection.
+func (l *pktHandler) handleStatusQuery(conn net.Conn, prefix []byte) (err error) {
+	defer conn.Close()
+	logger.Net.Debug("Status query", "addr", conn.RemoteAddr())
+
+	return proto.ServerAnswerStatusQuery(conn, prefix, l.serverListStatus())
+}
+
 func (l *pktHandler) PacketServerLogin(username string) {
 }
 
@@ -291,4 +528,9 @@ func (l *pktHandler) PacketWindowTransaction(windowId WindowId, txId TxId, accep
 
 func (l *pktHandler) PacketSignUpdate(position *BlockXyz, lines [4]string) {}
 
+func (l *pktHandler) PacketEncryptionKeyResponse(sharedSecret, verifyToken []byte) {
+	l.sharedSecret = sharedSecret
+	l.verifyToken = verifyToken
+}
+
 func (l *pktHandler) PacketDisconnect(reason string) {}
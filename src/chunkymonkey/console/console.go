@@ -0,0 +1,149 @@
+// The console package runs commands for server administrators. Commands are
+// read a line at a time from a transport, such as a connection to a unix
+// domain socket, and dispatched through the command framework. Responses are
+// written back a line at a time.
+package console
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"chunkymonkey/gamerules"
+	"chunkymonkey/logger"
+)
+
+// Console dispatches the commands of administrators connected by any number
+// of transports.
+type Console struct {
+	commands gamerules.ICommandFramework
+	game     gamerules.IGame
+}
+
+func New(commands gamerules.ICommandFramework, game gamerules.IGame) *Console {
+	return &Console{
+		commands: commands,
+		game:     game,
+	}
+}
+
+// Serve runs each line read from r as a command, writing the responses to w,
+// until r ends or w fails. The command prefix may be left out.
+func (console *Console) Serve(r io.Reader, w io.Writer) error {
+	sender := &sender{w: w}
+	prefix := console.commands.Prefix()
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, prefix) {
+			line = prefix + line
+		}
+
+		logger.Cmd.Info("Console command", "command", line)
+		console.commands.Process(sender, line, console.game)
+
+		if err := sender.error(); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// ServeListener serves each connection accepted by the listener as a console
+// session, concurrently, until the listener is closed.
+func (console *Console) ServeListener(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			defer conn.Close()
+			logger.Cmd.Info("Console connected", "listener", listener.Addr())
+			if err := console.Serve(conn, conn); err != nil {
+				logger.Cmd.Warn("Console connection failed", "listener", listener.Addr(), "err", err)
+			}
+		}()
+	}
+}
+
+// ListenUnix listens on a unix domain socket at path, which is given the
+// file permissions perm to control who may connect. A socket left behind at
+// path by a server that didn't shut down cleanly is replaced, but any other
+// file is an error.
+func ListenUnix(path string, perm os.FileMode) (listener net.Listener, err error) {
+	if fi, statErr := os.Lstat(path); statErr == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if conn, dialErr := net.Dial("unix", path); dialErr == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another server", path)
+		}
+		if err = os.Remove(path); err != nil {
+			return
+		}
+	}
+
+	if listener, err = net.Listen("unix", path); err != nil {
+		return
+	}
+	if err = os.Chmod(path, perm); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return
+}
+
+// sender receives the responses to the commands of a console session.
+type sender struct {
+	lock sync.Mutex
+	w    io.Writer
+	err  error
+}
+
+// EchoMessage writes the message as a line, without any color codes. The
+// first write error is kept, and later messages are dropped.
+func (s *sender) EchoMessage(msg string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.err == nil {
+		_, s.err = fmt.Fprintln(s.w, stripColors(msg))
+	}
+}
+
+func (s *sender) error() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.err
+}
+
+func (s *sender) String() string {
+	return "Console"
+}
+
+// stripColors removes chat color codes, such as "§d", from the message.
+func stripColors(msg string) string {
+	if !strings.ContainsRune(msg, '§') {
+		return msg
+	}
+	stripped := make([]rune, 0, len(msg))
+	runes := []rune(msg)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == '§' {
+			i++
+			continue
+		}
+		stripped = append(stripped, runes[i])
+	}
+	return string(stripped)
+}
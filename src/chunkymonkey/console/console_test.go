@@ -0,0 +1,206 @@
+package console
+
+import (
+	"bufio"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"chunkymonkey/chat"
+	"chunkymonkey/command"
+	"chunkymonkey/gamerules"
+	"chunkymonkey/schematic"
+	. "chunkymonkey/types"
+)
+
+// fakeGame records the game-wide actions taken by commands.
+type fakeGame struct {
+	lock      sync.Mutex
+	time      Ticks
+	broadcast []string
+}
+
+func (game *fakeGame) BroadcastPacket(packet []byte) {}
+
+func (game *fakeGame) BroadcastChat(kind chat.Kind, from, message string) {
+	game.lock.Lock()
+	defer game.lock.Unlock()
+	game.broadcast = append(game.broadcast, chat.Format(kind, from, message)...)
+}
+
+func (game *fakeGame) PlayerByName(name string) gamerules.IPlayerClient     { return nil }
+func (game *fakeGame) PlayerByEntityId(id EntityId) gamerules.IPlayerClient { return nil }
+
+func (game *fakeGame) ItemTypeById(id int) (gamerules.ItemType, bool) {
+	return gamerules.ItemType{}, false
+}
+
+func (game *fakeGame) Time() Ticks {
+	game.lock.Lock()
+	defer game.lock.Unlock()
+	return game.time
+}
+
+func (game *fakeGame) SpawnBlock() BlockXyz     { return BlockXyz{0, 64, 0} }
+func (game *fakeGame) WorldBorder() WorldBorder { return WorldBorder{} }
+
+func (game *fakeGame) SetTime(time Ticks) {
+	game.lock.Lock()
+	defer game.lock.Unlock()
+	game.time = time
+}
+
+func (game *fakeGame) AddTime(ticks Ticks) {
+	game.lock.Lock()
+	defer game.lock.Unlock()
+	game.time += ticks
+}
+
+func (game *fakeGame) PasteSchematic(name string, at BlockXyz, options schematic.PasteOptions, done func(changed int, err error)) {
+	done(0, errors.New("No schematics."))
+}
+
+func (game *fakeGame) CopySchematic(name string, from, to BlockXyz, done func(blocks int, err error)) {
+	done(int(to.X-from.X+1)*int(to.Y-from.Y+1)*int(to.Z-from.Z+1), nil)
+}
+
+func (game *fakeGame) PruneChunks(radius int, dryRun bool, done func(chunks int, bytes int64, err error)) {
+	done(radius, int64(radius)*4096, nil)
+}
+
+func TestConsole_Serve(t *testing.T) {
+	game := &fakeGame{}
+	console := New(command.NewCommandFramework("/"), game)
+
+	input := strings.Join([]string{
+		"time set 100",
+		"",
+		"/say hello",
+		"ping",
+		"ping bob",
+		"nosuch",
+		"paste castle",
+		"paste castle 0 64 0 1 skipair",
+		"copy castle",
+		"copy castle 0 64 0 1 65 1",
+		"prune 3 dryrun",
+	}, "\n")
+	output := new(strings.Builder)
+	if err := console.Serve(strings.NewReader(input), output); err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+
+	expected := strings.Join([]string{
+		"Time set to 100",
+		"Only players can use this command without naming a player.",
+		"'bob' is not logged in",
+		"Command not available.",
+		"paste <schematic> <x> <y> <z> [<quarter turns>] [skipair]",
+		"Paste failed: No schematics.",
+		"copy <schematic> [<x1> <y1> <z1> <x2> <y2> <z2>]",
+		"Copied 8 blocks to castle",
+		"Would prune 3 chunks, freeing 12288 bytes",
+	}, "\n") + "\n"
+	if output.String() != expected {
+		t.Errorf("Expected output:\n%s\ngot:\n%s", expected, output.String())
+	}
+
+	if game.time != 100 {
+		t.Errorf("Expected time 100, got %d", game.time)
+	}
+	if len(game.broadcast) != 1 || game.broadcast[0] != "§dhello" {
+		t.Errorf("Expected broadcast of hello, got %q", game.broadcast)
+	}
+}
+
+func TestStripColors(t *testing.T) {
+	type Test struct {
+		msg, expected string
+	}
+
+	var tests = []Test{
+		{"plain", "plain"},
+		{"§dpink", "pink"},
+		{"a§cb§fc", "abc"},
+		{"trailing§", "trailing"},
+	}
+
+	for _, test := range tests {
+		if result := stripColors(test.msg); result != test.expected {
+			t.Errorf("stripColors(%q): expected %q, got %q", test.msg, test.expected, result)
+		}
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "admin.sock")
+	listener, err := ListenUnix(path, 0600)
+	if err != nil {
+		t.Fatalf("ListenUnix: %v", err)
+	}
+	defer listener.Close()
+
+	if fi, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if perm := fi.Mode().Perm(); perm != 0600 {
+		t.Errorf("Expected socket permissions 0600, got %o", perm)
+	}
+
+	if _, err := ListenUnix(path, 0600); err == nil {
+		t.Errorf("Expected ListenUnix to fail for a socket in use")
+	}
+
+	game := &fakeGame{}
+	go New(command.NewCommandFramework("/"), game).ServeListener(listener)
+
+	// Sessions are served concurrently.
+	var conns []net.Conn
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("unix", path)
+		if err != nil {
+			t.Fatalf("Dial: %v", err)
+		}
+		defer conn.Close()
+		conns = append(conns, conn)
+	}
+	for i := len(conns) - 1; i >= 0; i-- {
+		conns[i].Write([]byte("nosuch\n"))
+		line, err := bufio.NewReader(conns[i]).ReadString('\n')
+		if err != nil || line != "Command not available.\n" {
+			t.Errorf("Connection %d: expected response, got %q, %v", i, line, err)
+		}
+	}
+}
+
+func TestListenUnix_Stale(t *testing.T) {
+	dir := t.TempDir()
+
+	// A socket left behind by a server that didn't shut down cleanly.
+	path := filepath.Join(dir, "stale.sock")
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+
+	listener, err := ListenUnix(path, 0600)
+	if err != nil {
+		t.Fatalf("Expected stale socket to be replaced, got %v", err)
+	}
+	listener.Close()
+
+	// Other files are left alone.
+	path = filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(path, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ListenUnix(path, 0600); err == nil {
+		t.Errorf("Expected ListenUnix to refuse to replace a file")
+	}
+}
@@ -57,3 +57,11 @@ func (mgr *EntityManager) RemoveEntityById(entityId EntityId) {
 
 	delete(mgr.entities, entityId)
 }
+
+// Exists returns true if the entityId is in use.
+func (mgr *EntityManager) Exists(entityId EntityId) bool {
+	mgr.lock.Lock()
+	defer mgr.lock.Unlock()
+
+	return mgr.entities[entityId]
+}
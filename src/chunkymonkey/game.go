@@ -2,16 +2,24 @@ package chunkymonkey
 
 import (
 	"bytes"
-	"fmt"
-	"log"
-	"math/rand"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"flag"
 	"net"
 	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"chunkymonkey/chat"
+	"chunkymonkey/clock"
 	"chunkymonkey/command"
 	. "chunkymonkey/entity"
 	"chunkymonkey/gamerules"
+	"chunkymonkey/logger"
 	"chunkymonkey/player"
 	"chunkymonkey/proto"
 	"chunkymonkey/server_auth"
@@ -25,86 +33,266 @@ import (
 // That is: characters that might be abused in filename components, etc.
 var validPlayerUsername = regexp.MustCompile(`^[\-a-zA-Z0-9_]+$`)
 
+var rejectDuplicateLogin = flag.Bool(
+	"reject_duplicate_login", false,
+	"Reject logins from players who are already logged in, rather than "+
+		"disconnecting their existing session.")
+
+var onlineMode = flag.Bool(
+	"online_mode", true,
+	"Check that players logging in are authenticated by minecraft.net.")
+
+var whitelist = flag.Bool(
+	"whitelist", false,
+	"Only let the players on the whitelist, and operators, log in.")
+
+var encryption = flag.Bool(
+	"encryption", false,
+	"Encrypt connections, as required by newer clients. Leave unset for "+
+		"clients that don't support encryption, and for offline testing.")
+
+// encryptionKeyBits is the size of the RSA key generated at startup when
+// connections are encrypted.
+const encryptionKeyBits = 1024
+
+var sessionServer = flag.String(
+	"session_server", "http://www.minecraft.net/game/checkserver.jsp",
+	"URL of the session server that checks that players are authenticated, "+
+		"when -online_mode is set.")
+
+var authCacheTime = flag.Duration(
+	"auth_cache_time", time.Hour,
+	"How long a player authenticated by the session server can still log in "+
+		"from the same IP address while the session server can't be reached.")
+
+var authFallbackOffline = flag.Bool(
+	"auth_fallback_offline", false,
+	"Let players log in unauthenticated while the session server can't be "+
+		"reached, rather than rejecting them, unless they were authenticated "+
+		"within -auth_cache_time. Operators are still rejected.")
+
+var worldBorderRadius = flag.Int(
+	"world_border", 0,
+	"Distance in blocks from the world spawn that players may travel, and "+
+		"that chunks are generated. Zero means no border.")
+
+var playerSaveInterval = flag.Int(
+	"player_save_interval", 60,
+	"Seconds between each writing of the data of every connected player.")
+
+var levelSaveInterval = flag.Int(
+	"level_save_interval", 60,
+	"Seconds between each writing of the world time to level.dat.")
+
+// ticksBetweenPlayerSaves returns the number of ticks between each saving of
+// the connected players' data.
+func ticksBetweenPlayerSaves() Ticks {
+	if *playerSaveInterval < 1 {
+		return TicksPerSecond
+	}
+	return Ticks(*playerSaveInterval) * TicksPerSecond
+}
+
+// ticksBetweenLevelSaves returns the number of ticks between each writing of
+// the level data.
+func ticksBetweenLevelSaves() Ticks {
+	if *levelSaveInterval < 1 {
+		return TicksPerSecond
+	}
+	return Ticks(*levelSaveInterval) * TicksPerSecond
+}
+
+// duplicateLoginKickMsg is sent to a player disconnected because they logged
+// in again.
+const duplicateLoginKickMsg = "You logged in from another location"
+
+// errGameStopped is returned to logins made while the game stops.
+var errGameStopped = errors.New("The server is shutting down.")
+
+// shutdownKickMsg is sent to the players disconnected by Shutdown.
+const shutdownKickMsg = "Server shutting down"
+
+// shutdownKickTimeout is how long Shutdown waits for the players it kicks to
+// be disconnected before saving the world anyway.
+const shutdownKickTimeout = 10 * time.Second
+
+// periodicTask is a function run by the game every Interval ticks.
+type periodicTask struct {
+	Interval Ticks
+	Fn       func(*Game)
+}
+
+// periodicTasks are run from Game.onTick. Tasks with the same interval run in
+// the order they are listed.
+var periodicTasks = []periodicTask{
+	// Clients advance time by themselves between updates, so once a second is
+	// plenty to correct any drift.
+	{TicksPerSecond, (*Game).sendTimeUpdate},
+	// Pings are only measured every -keepalive_interval or so.
+	{TicksPerSecond * 10, (*Game).sendPlayerListPings},
+	{TicksPerSecond, (*Game).updateMetrics},
+	{TicksPerSecond, (*Game).updateTickRate},
+	// Checks the time against the -player_save_interval flag itself.
+	{TicksPerSecond, (*Game).autosavePlayers},
+	// Checks the time against the -level_save_interval flag itself.
+	{TicksPerSecond, (*Game).autosaveLevelData},
+}
+
 type Game struct {
 	shardManager  *shardserver.LocalShardManager
 	entityManager EntityManager
 	worldStore    *worldstore.WorldStore
 	connHandler   *ConnHandler
+	clock         clock.Clock
 
-	// Mapping between entityId/name and player object
+	// Mapping between entityId/name and player object. Names are lower case.
 	players     map[EntityId]*player.Player
 	playerNames map[string]*player.Player
 
+	// Lower case names of players part way through logging in, and the
+	// logins waiting for players to be disconnected.
+	claimedNames      map[string]bool
+	disconnectWaiters map[EntityId][]chan<- error
+
 	// Channels for events/actions
 	workQueue        chan func(*Game)
 	playerConnect    chan *player.Player
 	playerDisconnect chan EntityId
 
+	// quit is closed by Stop to end the main loop, and served is closed once
+	// Serve has returned, if it was started.
+	quit     chan struct{}
+	stopOnce sync.Once
+	stopLock sync.Mutex // Guards served.
+	served   chan struct{}
+
 	// Server information
 	time           Ticks
-	serverId       string
-	maintenanceMsg string // if set, logins are disallowed.
+	serverDesc     string
+	maintenanceMsg string     // if set, logins are disallowed.
+	spawnLock      sync.Mutex // Guards worldStore.SpawnPosition.
+	maxPlayerCount int
+	started        time.Time
+	border         WorldBorder // Centered on the spawn at startup.
+
+	tickTimes tickTimes
+	tickRate  tickRate
+	netStats  netStats
 }
 
-func NewGame(worldPath string, listener net.Listener, serverDesc, maintenanceMsg string, maxPlayerCount int) (game *Game, err error) {
+// NewGame creates a game that accepts connections on each of the listeners.
+func NewGame(worldPath string, listeners []net.Listener, serverDesc, maintenanceMsg string, maxPlayerCount int) (game *Game, err error) {
+	return newGame(worldPath, listeners, serverDesc, maintenanceMsg, maxPlayerCount, clock.Real)
+}
+
+// newGame creates a game timed by clk.
+func newGame(worldPath string, listeners []net.Listener, serverDesc, maintenanceMsg string, maxPlayerCount int, clk clock.Clock) (game *Game, err error) {
 	worldStore, err := worldstore.LoadWorldStore(worldPath)
 	if err != nil {
 		return nil, err
 	}
 
-	authserver, err := server_auth.NewServerAuth("http://www.minecraft.net/game/checkserver.jsp")
+	sessionAuth, err := server_auth.NewServerAuth(*sessionServer)
 	if err != nil {
 		return
 	}
+	authserver := server_auth.NewCachingAuth(sessionAuth, *authCacheTime, *authFallbackOffline)
+	// Operators have every permission, so anyone sending their names mustn't
+	// be let in unauthenticated.
+	authserver.FallbackDenied = func(user string) bool {
+		return gamerules.Ops != nil && gamerules.Ops.IsOp(user)
+	}
+
+	var encryptionKey *rsa.PrivateKey
+	var publicKey []byte
+	if *encryption {
+		if encryptionKey, err = rsa.GenerateKey(rand.Reader, encryptionKeyBits); err != nil {
+			return
+		}
+		if publicKey, err = x509.MarshalPKIXPublicKey(&encryptionKey.PublicKey); err != nil {
+			return
+		}
+	}
 
 	game = &Game{
-		players:          make(map[EntityId]*player.Player),
-		playerNames:      make(map[string]*player.Player),
-		workQueue:        make(chan func(*Game), 256),
-		playerConnect:    make(chan *player.Player),
-		playerDisconnect: make(chan EntityId),
-		time:             worldStore.Time,
-		worldStore:       worldStore,
+		players:           make(map[EntityId]*player.Player),
+		playerNames:       make(map[string]*player.Player),
+		claimedNames:      make(map[string]bool),
+		disconnectWaiters: make(map[EntityId][]chan<- error),
+		workQueue:         make(chan func(*Game), 256),
+		playerConnect:     make(chan *player.Player),
+		playerDisconnect:  make(chan EntityId),
+		quit:              make(chan struct{}),
+		time:              worldStore.Time,
+		serverDesc:        serverDesc,
+		maxPlayerCount:    maxPlayerCount,
+		started:           clk.Now(),
+		worldStore:        worldStore,
+		clock:             clk,
+		border: WorldBorder{
+			Center: worldStore.SpawnPosition,
+			Radius: BlockCoord(*worldBorderRadius),
+		},
 	}
+	game.tickRate.since = game.started
 
 	game.entityManager.Init()
 
-	game.serverId = fmt.Sprintf("%016x", rand.NewSource(worldStore.Seed).Int63())
-	//game.serverId = "-"
+	game.shardManager = shardserver.NewLocalShardManager(worldStore.ChunkStore, &game.entityManager, clk)
+	game.shardManager.SetWorldBorder(game.border)
+	game.shardManager.SetWorldTime(game.Time)
 
-	game.shardManager = shardserver.NewLocalShardManager(worldStore.ChunkStore, &game.entityManager)
+	if *publishMetrics {
+		publishGameMetrics(game)
+	}
 
 	// TODO: Load the prefix from a config file
 	gamerules.CommandFramework = command.NewCommandFramework("/")
 
 	// Start accepting connections.
-	game.connHandler = NewConnHandler(listener, &GameInfo{
+	game.connHandler = NewConnHandler(listeners, &GameInfo{
 		game:           game,
 		maxPlayerCount: maxPlayerCount,
 		serverDesc:     serverDesc,
 		maintenanceMsg: maintenanceMsg,
-		serverId:       game.serverId,
+		onlineMode:     *onlineMode,
 		shardManager:   game.shardManager,
 		entityManager:  &game.entityManager,
 		worldStore:     game.worldStore,
 		authserver:     authserver,
+		encryptionKey:  encryptionKey,
+		publicKey:      publicKey,
 	})
 
 	return
 }
 
-// Fetch external events and respond appropriately.
+// Fetch external events and respond appropriately, until the game is stopped.
 func (game *Game) Serve() {
+	game.stopLock.Lock()
+	select {
+	case <-game.quit:
+		game.stopLock.Unlock()
+		return
+	default:
+	}
+	game.served = make(chan struct{})
+	defer close(game.served)
+	game.stopLock.Unlock()
+
 	defer game.connHandler.Stop()
 
-	ticker := time.NewTicker(NanosecondsInSecond / TicksPerSecond)
+	ticker := game.clock.NewTicker(NanosecondsInSecond / TicksPerSecond)
+	defer ticker.Stop()
 
 	for {
 		select {
+		case <-game.quit:
+			return
 		case f := <-game.workQueue:
 			f(game)
-		case <-ticker.C:
-			game.onTick()
+		case <-ticker.C():
+			game.timedTick()
 		case player := <-game.playerConnect:
 			game.onPlayerConnect(player)
 		case entityId := <-game.playerDisconnect:
@@ -113,47 +301,352 @@ func (game *Game) Serve() {
 	}
 }
 
+// Stop stops the game without saving the world. The listeners are closed, the
+// main loop ends, so that Serve returns, and the shards stop. It returns once
+// they have all stopped, and any player data already queued has been written.
+// Players that are still connected are left to disconnect by themselves.
+// Stopping again does nothing.
+func (game *Game) Stop() {
+	game.stopOnce.Do(func() {
+		game.connHandler.Stop()
+
+		game.stopLock.Lock()
+		close(game.quit)
+		served := game.served
+		game.stopLock.Unlock()
+		if served != nil {
+			<-served
+		}
+
+		game.shardManager.Stop()
+		game.worldStore.FlushPlayerData()
+	})
+}
+
+// Shutdown stops the game from accepting connections, disconnects the
+// connected players, saves the world and then stops the game as Stop does,
+// returning once the world has been written. It must not be called from the
+// main loop, which must be running unless the game has stopped already, in
+// which case Shutdown does nothing.
+func (game *Game) Shutdown() (err error) {
+	select {
+	case <-game.quit:
+		return nil
+	default:
+	}
+	defer game.Stop()
+
+	game.connHandler.Stop()
+
+	result := make(chan chan error, 1)
+	game.enqueue(func(game *Game) {
+		disconnected := make(chan error, len(game.players))
+		for entityId, player := range game.players {
+			game.disconnectWaiters[entityId] = append(game.disconnectWaiters[entityId], disconnected)
+			player.Kick(shutdownKickMsg)
+		}
+		result <- disconnected
+	})
+	disconnected := <-result
+
+	// Players that don't go in time are saved with the world.
+	timeout := game.clock.After(shutdownKickTimeout)
+	for remaining := cap(disconnected); remaining > 0; remaining-- {
+		select {
+		case <-disconnected:
+		case <-timeout:
+			logger.Net.Warn("Players still connected at shutdown", "count", remaining)
+			return game.Save()
+		}
+	}
+
+	return game.Save()
+}
+
+// Save writes the modified chunks of the world, its level data and the data
+// of the connected players, returning once they have been written. It must not
+// be called from the main loop, which must be running.
+func (game *Game) Save() (err error) {
+	if err = game.shardManager.SaveChunks(); err != nil {
+		return
+	}
+
+	result := make(chan error, 1)
+	var players []*player.Player
+	game.enqueue(func(game *Game) {
+		for _, player := range game.players {
+			players = append(players, player)
+		}
+		result <- game.worldStore.WriteLevelData(game.Time())
+	})
+	if err = <-result; err != nil {
+		return
+	}
+
+	game.savePlayers(players)
+	game.worldStore.FlushPlayerData()
+	return nil
+}
+
+// RunTicks runs the main loop synchronously for n ticks, handling the events
+// waiting before each tick. It is for tests that drive a game that isn't being
+// served, so that nothing else runs the main loop meanwhile.
+func (game *Game) RunTicks(n int) {
+	for i := 0; i < n; i++ {
+		game.runPending()
+		game.timedTick()
+	}
+}
+
+// runPending handles events until there are none waiting.
+func (game *Game) runPending() {
+	for {
+		select {
+		case f := <-game.workQueue:
+			f(game)
+		case player := <-game.playerConnect:
+			game.onPlayerConnect(player)
+		case entityId := <-game.playerDisconnect:
+			game.onPlayerDisconnect(entityId)
+		default:
+			return
+		}
+	}
+}
+
+// timedTick runs onTick, recording how long it took.
+func (game *Game) timedTick() {
+	start := game.clock.Now()
+	game.onTick()
+	game.tickTimes.add(game.clock.Now().Sub(start))
+}
+
 // A new player has connected to the server
 func (game *Game) onPlayerConnect(newPlayer *player.Player) {
 	game.players[newPlayer.GetEntityId()] = newPlayer
-	game.playerNames[newPlayer.Name()] = newPlayer
+	game.playerNames[strings.ToLower(newPlayer.Name())] = newPlayer
+	delete(game.claimedNames, strings.ToLower(newPlayer.Name()))
+
+	// Don't leave the player waiting until the next periodic update to find
+	// out what time it is.
+	game.sendTimeUpdateTo(newPlayer)
+
+	// Show the new player everyone online, and everyone else the new player.
+	buf := new(bytes.Buffer)
+	for _, player := range game.players {
+		proto.WriteUserListItem(buf, player.Name(), true, player.Ping())
+	}
+	newPlayer.TransmitPacket(buf.Bytes())
+	game.multicastPacket(userListItemPacket(newPlayer, true), newPlayer)
 }
 
 // A player has disconnected from the server
 func (game *Game) onPlayerDisconnect(entityId EntityId) {
-	oldPlayer := game.players[entityId]
+	oldPlayer, ok := game.players[entityId]
+	if !ok {
+		logger.Net.Warn("Disconnect for unknown player", "entity", entityId)
+		return
+	}
+	// Logins waiting for the player to go can continue once their data has
+	// been queued, as reading it waits for it to be written.
+	defer game.releaseDisconnectWaiters(entityId)
+
 	delete(game.players, entityId)
-	delete(game.playerNames, oldPlayer.Name())
+	delete(game.playerNames, strings.ToLower(oldPlayer.Name()))
 	game.entityManager.RemoveEntityById(entityId)
 
+	game.multicastPacket(userListItemPacket(oldPlayer, false), nil)
+
+	// The player has stopped, so nothing else changes their data.
 	playerData := nbt.NewCompound()
 	if err := oldPlayer.MarshalNbt(playerData); err != nil {
-		log.Printf("Failed to marshal player data: %v", err)
+		logger.World.Error("Failed to marshal player data", "player", oldPlayer.Name(), "err", err)
 		return
 	}
+	game.worldStore.QueuePlayerData(oldPlayer.Name(), playerData)
+}
 
-	if err := game.worldStore.WritePlayerData(oldPlayer.Name(), playerData); err != nil {
-		log.Printf("Failed when writing player data: %v", err)
+// autosavePlayers saves the data of the connected players every
+// -player_save_interval seconds, without waiting for it to be written.
+func (game *Game) autosavePlayers() {
+	if game.time%ticksBetweenPlayerSaves() != 0 {
+		return
+	}
+	players := make([]*player.Player, 0, len(game.players))
+	for _, player := range game.players {
+		players = append(players, player)
+	}
+	// Players may be waiting on the main loop with their lock held.
+	go game.savePlayers(players)
+}
+
+// autosaveLevelData writes the world time to level.dat every
+// -level_save_interval seconds, so that little time is lost if the server
+// stops without saving. The level data is small, and written by the main loop
+// as Save does.
+func (game *Game) autosaveLevelData() {
+	if game.time%ticksBetweenLevelSaves() != 0 {
+		return
+	}
+	if err := game.worldStore.WriteLevelData(game.time); err != nil {
+		logger.World.Error("Failed to write level data", "err", err)
 	}
 }
 
+// savePlayers queues the data of the players to be written. It must not be
+// called from the main loop.
+func (game *Game) savePlayers(players []*player.Player) {
+	for _, p := range players {
+		err := p.SaveSnapshot(func(data *nbt.Compound) {
+			game.worldStore.QueuePlayerData(p.Name(), data)
+		})
+		if err != nil {
+			logger.World.Error("Failed to marshal player data", "player", p.Name(), "err", err)
+		}
+	}
+}
+
+// claimPlayerName is called by a player logging in, before their player data
+// is loaded. It returns the reason to give the client if they must not log
+// in. An existing player with the same name (ignoring case) is disconnected,
+// and claimPlayerName doesn't return until their data has been saved, unless
+// rejectDuplicateLogin is set. The name must be released with
+// releasePlayerName if the login then fails.
+func (game *Game) claimPlayerName(name string) (clientErr error) {
+	result := make(chan error, 1)
+	game.enqueue(func(_ *Game) {
+		game.onClaimPlayerName(name, result)
+	})
+	select {
+	case clientErr = <-result:
+		return
+	case <-game.quit:
+		return errGameStopped
+	}
+}
+
+func (game *Game) onClaimPlayerName(name string, result chan<- error) {
+	key := strings.ToLower(name)
+	if game.claimedNames[key] {
+		// Another login with the name is already in progress.
+		result <- clientErrLoginInProgress
+		return
+	}
+
+	oldPlayer, loggedIn := game.playerNames[key]
+	if loggedIn && *rejectDuplicateLogin {
+		result <- clientErrLoggedIn
+		return
+	}
+
+	// A player logging in again takes the place of their existing session.
+	if !loggedIn && game.maxPlayerCount > 0 && len(game.players)+len(game.claimedNames) >= game.maxPlayerCount {
+		result <- clientErrServerFull
+		return
+	}
+
+	game.claimedNames[key] = true
+	if !loggedIn {
+		result <- nil
+		return
+	}
+
+	logger.Net.Info("Logged in again, disconnecting the existing session", "player", oldPlayer.Name())
+	entityId := oldPlayer.GetEntityId()
+	game.disconnectWaiters[entityId] = append(game.disconnectWaiters[entityId], result)
+	oldPlayer.Kick(duplicateLoginKickMsg)
+}
+
+// releasePlayerName releases a name claimed by a login that failed.
+func (game *Game) releasePlayerName(name string) {
+	game.enqueue(func(_ *Game) {
+		delete(game.claimedNames, strings.ToLower(name))
+	})
+}
+
+// releaseDisconnectWaiters lets logins waiting for the player to be
+// disconnected continue.
+func (game *Game) releaseDisconnectWaiters(entityId EntityId) {
+	for _, waiter := range game.disconnectWaiters[entityId] {
+		waiter <- nil
+	}
+	delete(game.disconnectWaiters, entityId)
+}
+
 func (game *Game) onTick() {
-	game.time++
-	if game.time%TicksPerSecond == 0 {
-		game.sendTimeUpdate()
+	game.storeTime(game.time + 1)
+	for i := range periodicTasks {
+		if game.time%periodicTasks[i].Interval == 0 {
+			periodicTasks[i].Fn(game)
+		}
 	}
 }
 
 // Utility functions
 
-// Send a time/keepalive packet
-func (game *Game) sendTimeUpdate() {
+// storeTime sets the world time. The time is only changed by the game's main
+// loop, but is read atomically by Time from elsewhere.
+func (game *Game) storeTime(time Ticks) {
+	atomic.StoreInt64((*int64)(&game.time), int64(time))
+}
+
+// timeUpdatePacket creates a time update packet. The world time is sent
+// rather than the time of day, as clients take the phase of the moon from the
+// day count. There is only one dimension, so every player is sent the same
+// time.
+func (game *Game) timeUpdatePacket() []byte {
 	buf := new(bytes.Buffer)
 	proto.ServerWriteTimeUpdate(buf, game.time)
+	return buf.Bytes()
+}
+
+// Send a time update packet to all players.
+func (game *Game) sendTimeUpdate() {
+	game.multicastPacket(game.timeUpdatePacket(), nil)
+}
+
+// sendTimeUpdateTo sends a time update packet to a single player.
+func (game *Game) sendTimeUpdateTo(player *player.Player) {
+	player.TransmitPacket(game.timeUpdatePacket())
+}
 
+// userListItemPacket creates a player list packet that adds or updates the
+// player if online is true, or removes them otherwise.
+func userListItemPacket(player *player.Player, online bool) []byte {
+	var ping int16
+	if online {
+		ping = player.Ping()
+	}
+	buf := new(bytes.Buffer)
+	proto.WriteUserListItem(buf, player.Name(), online, ping)
+	return buf.Bytes()
+}
+
+// sendPlayerListPings updates every player's ping in the player list.
+func (game *Game) sendPlayerListPings() {
+	if len(game.players) == 0 {
+		return
+	}
+	buf := new(bytes.Buffer)
+	for _, player := range game.players {
+		proto.WriteUserListItem(buf, player.Name(), true, player.Ping())
+	}
 	game.multicastPacket(buf.Bytes(), nil)
 }
 
+// setTime jumps to the given time of day, keeping the day count, and tells
+// players immediately rather than waiting for the next periodic update.
+func (game *Game) setTime(dayTicks Ticks) {
+	game.storeTime(game.time.WithDayTicks(dayTicks))
+	game.sendTimeUpdate()
+}
+
+// addTime advances the time by ticks, and tells players immediately.
+func (game *Game) addTime(ticks Ticks) {
+	game.storeTime(game.time + ticks)
+	game.sendTimeUpdate()
+}
+
 // Send a packet to every player connected to the server
 func (game *Game) multicastPacket(packet []byte, except interface{}) {
 	for _, player := range game.players {
@@ -165,9 +658,13 @@ func (game *Game) multicastPacket(packet []byte, except interface{}) {
 	}
 }
 
-// Safely enqueue some work to be executed at some point in the future
+// Safely enqueue some work to be executed at some point in the future. It is
+// dropped if the game has stopped.
 func (game *Game) enqueue(f func(*Game)) {
-	game.workQueue <- f
+	select {
+	case game.workQueue <- f:
+	case <-game.quit:
+	}
 }
 
 // The following functions implement the IGame interface
@@ -178,27 +675,70 @@ func (game *Game) BroadcastPacket(packet []byte) {
 	})
 }
 
-func (game *Game) BroadcastMessage(msg string) {
+func (game *Game) BroadcastChat(kind chat.Kind, from, message string) {
+	if packet := chat.Packet(kind, from, message); packet != nil {
+		game.BroadcastPacket(packet)
+	}
+}
+
+func (game *Game) Time() Ticks {
+	return Ticks(atomic.LoadInt64((*int64)(&game.time)))
+}
+
+func (game *Game) SpawnBlock() BlockXyz {
+	game.spawnLock.Lock()
+	defer game.spawnLock.Unlock()
+	return game.worldStore.SpawnPosition
+}
+
+func (game *Game) WorldBorder() WorldBorder {
+	return game.border
+}
+
+// SetSpawnBlock moves the world spawn, where players log in for the first time
+// and respawn when they have no home bed, and tells the players.
+func (game *Game) SetSpawnBlock(spawn BlockXyz) {
+	game.spawnLock.Lock()
+	game.worldStore.SpawnPosition = spawn
+	game.spawnLock.Unlock()
+
 	buf := new(bytes.Buffer)
-	proto.WriteChatMessage(buf, msg)
+	proto.WriteSpawnPosition(buf, &spawn)
 	game.BroadcastPacket(buf.Bytes())
 }
 
+func (game *Game) SetTime(dayTicks Ticks) {
+	game.enqueue(func(_ *Game) {
+		game.setTime(dayTicks)
+	})
+}
+
+func (game *Game) AddTime(ticks Ticks) {
+	game.enqueue(func(_ *Game) {
+		game.addTime(ticks)
+	})
+}
+
 func (game *Game) ItemTypeById(id int) (gamerules.ItemType, bool) {
 	itemType, ok := gamerules.Items[ItemTypeId(id)]
 	return *itemType, ok
 }
 
 func (game *Game) PlayerCount() int {
-	result := make(chan int)
+	result := make(chan int, 1)
 	game.enqueue(func(_ *Game) {
 		result <- len(game.players)
 	})
-	return <-result
+	select {
+	case count := <-result:
+		return count
+	case <-game.quit:
+		return 0
+	}
 }
 
 func (game *Game) PlayerByEntityId(id EntityId) gamerules.IPlayerClient {
-	result := make(chan gamerules.IPlayerClient)
+	result := make(chan gamerules.IPlayerClient, 1)
 	game.enqueue(func(_ *Game) {
 		player, ok := game.players[id]
 		if ok {
@@ -208,13 +748,18 @@ func (game *Game) PlayerByEntityId(id EntityId) gamerules.IPlayerClient {
 		}
 		close(result)
 	})
-	return <-result
+	select {
+	case client := <-result:
+		return client
+	case <-game.quit:
+		return nil
+	}
 }
 
 func (game *Game) PlayerByName(name string) gamerules.IPlayerClient {
-	result := make(chan gamerules.IPlayerClient)
+	result := make(chan gamerules.IPlayerClient, 1)
 	game.enqueue(func(_ *Game) {
-		player, ok := game.playerNames[name]
+		player, ok := game.playerNames[strings.ToLower(name)]
 		if ok {
 			result <- player.Client()
 		} else {
@@ -222,5 +767,10 @@ func (game *Game) PlayerByName(name string) gamerules.IPlayerClient {
 		}
 		close(result)
 	})
-	return <-result
+	select {
+	case client := <-result:
+		return client
+	case <-game.quit:
+		return nil
+	}
 }
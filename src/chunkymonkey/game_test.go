@@ -0,0 +1,763 @@
+package chunkymonkey
+
+import (
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"chunkymonkey/bot"
+	"chunkymonkey/clock"
+	"chunkymonkey/console"
+	"chunkymonkey/gamerules"
+	"chunkymonkey/logger"
+	"chunkymonkey/permission"
+	"chunkymonkey/proto"
+	"chunkymonkey/server_auth"
+	"chunkymonkey/testconn"
+	. "chunkymonkey/types"
+	"chunkymonkey/worldstore"
+)
+
+// testTimeout is how long tests wait for a packet that should arrive. Placing
+// a player in a new world can take several seconds under the race detector.
+const testTimeout = 30 * time.Second
+
+func init() {
+	// The data files are at the root of the repository.
+	err := gamerules.LoadGameRules(
+		"../../blocks.json", "../../items.json", "../../recipes.json",
+		"../../furnace.json", "../../users.json", "../../groups.json")
+	if err != nil {
+		panic(err)
+	}
+}
+
+// newTestGame serves a game in a new world, which clients log in to through
+// the returned listener. Logins aren't checked with minecraft.net.
+func newTestGame(t *testing.T) (game *Game, listener *testconn.Listener) {
+	game, listener = newTestGameClock(t, clock.Real)
+	go game.Serve()
+	shutdownOnCleanup(t, game)
+	return
+}
+
+// shutdownOnCleanup shuts the served game down once the test's clients have
+// been closed, so that the players' data, which is written in the background,
+// is written before the world is removed.
+func shutdownOnCleanup(t *testing.T, game *Game) {
+	t.Cleanup(func() {
+		if err := game.Shutdown(); err != nil {
+			t.Errorf("Shutdown error: %v", err)
+		}
+	})
+}
+
+// newTestGameClock creates a game in a new world timed by clk, but doesn't
+// serve it.
+func newTestGameClock(t *testing.T, clk clock.Clock) (game *Game, listener *testconn.Listener) {
+	defer func(online bool) { *onlineMode = online }(*onlineMode)
+	*onlineMode = false
+
+	worldPath := t.TempDir()
+	if err := worldstore.CreateWorld(worldPath); err != nil {
+		t.Fatal(err)
+	}
+
+	listener = testconn.NewListener()
+	game, err := newGame(worldPath, []net.Listener{listener}, "test server", "", 8, clk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(game.Stop)
+	return
+}
+
+// loginPlaced logs in as username, and waits for the player to be placed in
+// the world.
+func loginPlaced(t *testing.T, listener *testconn.Listener, username string) *testconn.Client {
+	client, err := testconn.Login(listener, username)
+	if err != nil {
+		t.Fatalf("%s: login failed: %v", username, err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	if _, err := client.WaitFor(testTimeout, proto.PacketIdPlayerPositionLook, nil); err != nil {
+		t.Fatalf("%s: not placed: %v", username, err)
+	}
+	return client
+}
+
+// isUserListItem matches player list packets for the user.
+func isUserListItem(username string, online bool) func(*testconn.Packet) bool {
+	return func(packet *testconn.Packet) bool {
+		return packet.Args[0] == username && packet.Args[1] == online
+	}
+}
+
+func TestGame_Login(t *testing.T) {
+	game, listener := newTestGame(t)
+
+	client, err := testconn.Login(listener, "alice")
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	defer client.Close()
+
+	if _, err := client.WaitFor(testTimeout, proto.PacketIdPlayerPositionLook, nil); err != nil {
+		t.Errorf("Player not placed: %v", err)
+	}
+	if _, err := client.Seen(testTimeout, proto.PacketIdUserListItem, isUserListItem("alice", true)); err != nil {
+		t.Errorf("Player not shown in the player list: %v", err)
+	}
+	if count := game.PlayerCount(); count != 1 {
+		t.Errorf("Expected 1 player, got %d", count)
+	}
+	if game.PlayerByEntityId(client.EntityId) == nil {
+		t.Errorf("Expected player with EntityId %d", client.EntityId)
+	}
+}
+
+func TestGame_LoginBadUsername(t *testing.T) {
+	_, listener := newTestGame(t)
+
+	_, err := testconn.Login(listener, "bad/name")
+	if err != testconn.DisconnectError(clientErrUsername.Error()) {
+		t.Errorf("Expected disconnect for bad username, got %v", err)
+	}
+}
+
+func TestGame_LoginProtocolVersion(t *testing.T) {
+	_, listener := newTestGame(t)
+
+	type Test struct {
+		version int32
+		reason  string
+	}
+
+	var tests = []Test{
+		{proto.MinProtocolVersion - 1, "Outdated client!"},
+		{proto.MaxProtocolVersion + 1, "Outdated server!"},
+	}
+
+	for _, test := range tests {
+		_, err := testconn.LoginVersion(listener, "alice", test.version)
+		if err != testconn.DisconnectError(test.reason) {
+			t.Errorf("Protocol version %d: expected disconnect %q, got %v", test.version, test.reason, err)
+		}
+	}
+}
+
+func TestGame_LoginServerFull(t *testing.T) {
+	game, listener := newTestGameClock(t, clock.Real)
+	game.maxPlayerCount = 1
+	go game.Serve()
+	shutdownOnCleanup(t, game)
+
+	loginPlaced(t, listener, "alice")
+
+	_, err := testconn.Login(listener, "bob")
+	if err != testconn.DisconnectError(clientErrServerFull.Error()) {
+		t.Errorf("Expected disconnect for full server, got %v", err)
+	}
+
+	// A player logging in again takes the place of their existing session.
+	loginPlaced(t, listener, "alice")
+}
+
+func TestGame_LoginAccessLists(t *testing.T) {
+	dir := t.TempDir()
+	defer func(whitelisted bool) { *whitelist = whitelisted }(*whitelist)
+	defer func(w *permission.NameList, b *permission.BanList) {
+		gamerules.Whitelist, gamerules.BannedPlayers = w, b
+	}(gamerules.Whitelist, gamerules.BannedPlayers)
+
+	var err error
+	if gamerules.Whitelist, err = permission.LoadNameList(filepath.Join(dir, "whitelist.json")); err != nil {
+		t.Fatal(err)
+	}
+	if gamerules.BannedPlayers, err = permission.LoadBanList(filepath.Join(dir, "banned-players.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err = gamerules.BannedPlayers.Ban("griefer", "test", "Griefing"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = gamerules.Whitelist.Add("alice"); err != nil {
+		t.Fatal(err)
+	}
+	*whitelist = true
+
+	_, listener := newTestGame(t)
+
+	_, err = testconn.Login(listener, "Griefer")
+	if want := "You are banned from this server: Griefing."; err != testconn.DisconnectError(want) {
+		t.Errorf("Expected disconnect %q for banned player, got %v", want, err)
+	}
+	_, err = testconn.Login(listener, "bob")
+	if err != testconn.DisconnectError(clientErrNotWhitelisted.Error()) {
+		t.Errorf("Expected disconnect for player not on the whitelist, got %v", err)
+	}
+	loginPlaced(t, listener, "alice")
+}
+
+// recordingAuth authenticates everyone, recording the server ids checked.
+type recordingAuth struct {
+	lock      sync.Mutex
+	serverIds []string
+}
+
+func (auth *recordingAuth) Authenticate(serverId, user, addr string) (bool, error) {
+	auth.lock.Lock()
+	defer auth.lock.Unlock()
+	auth.serverIds = append(auth.serverIds, serverId)
+	return true, nil
+}
+
+func TestGame_LoginOnlineMode(t *testing.T) {
+	game, listener := newTestGameClock(t, clock.Real)
+	auth := &recordingAuth{}
+	game.connHandler.gameInfo.onlineMode = true
+	game.connHandler.gameInfo.authserver = auth
+	go game.Serve()
+	shutdownOnCleanup(t, game)
+
+	// Each connection is sent its own server id, which is the one checked.
+	var serverIds []string
+	for _, username := range []string{"alice", "bob"} {
+		client := loginPlaced(t, listener, username)
+		handshakes := client.Received(proto.PacketIdHandshake, nil)
+		if len(handshakes) != 1 {
+			t.Fatalf("%s: expected 1 handshake, got %d", username, len(handshakes))
+		}
+		serverIds = append(serverIds, handshakes[0].Args[0].(string))
+	}
+
+	if serverIds[0] == server_auth.OfflineServerId || serverIds[0] == serverIds[1] {
+		t.Errorf("Expected distinct server ids, got %q", serverIds)
+	}
+	auth.lock.Lock()
+	defer auth.lock.Unlock()
+	if len(auth.serverIds) != 2 || auth.serverIds[0] != serverIds[0] || auth.serverIds[1] != serverIds[1] {
+		t.Errorf("Expected server ids %q to be checked, got %q", serverIds, auth.serverIds)
+	}
+}
+
+func TestGame_LoginEncrypted(t *testing.T) {
+	defer func(encrypted bool) { *encryption = encrypted }(*encryption)
+	*encryption = true
+	game, listener := newTestGameClock(t, clock.Real)
+	go game.Serve()
+	shutdownOnCleanup(t, game)
+
+	client, err := testconn.LoginEncrypted(listener, "alice")
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	defer client.Close()
+	if _, err := client.WaitFor(testTimeout, proto.PacketIdPlayerPositionLook, nil); err != nil {
+		t.Fatalf("Player not placed: %v", err)
+	}
+
+	if err := proto.WriteChatMessage(client.Writer, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	isHello := func(packet *testconn.Packet) bool {
+		return packet.Args[0] == "<alice> hello"
+	}
+	if _, err := client.WaitFor(testTimeout, proto.PacketIdChatMessage, isHello); err != nil {
+		t.Errorf("Expected the message to be echoed: %v", err)
+	}
+}
+
+func TestGame_ServerListPing(t *testing.T) {
+	_, listener := newTestGame(t)
+	loginPlaced(t, listener, "alice")
+
+	conn, err := listener.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := testconn.NewClient(conn)
+	defer client.Close()
+	if err = proto.WriteServerListPing(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.WaitFor(testTimeout, proto.PacketIdLogin, nil)
+	if expected := testconn.DisconnectError("test server§1§8"); err != expected {
+		t.Errorf("Expected %v, got %v", expected, err)
+	}
+}
+
+func TestGame_UnknownConnectionRejected(t *testing.T) {
+	_, listener := newTestGame(t)
+
+	conn, err := listener.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := testconn.NewClient(conn)
+	defer client.Close()
+	if _, err = conn.Write([]byte("GET / HTTP/1.0\r\n\r\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.WaitFor(testTimeout, proto.PacketIdLogin, nil)
+	if expected := testconn.DisconnectError(clientErrProtocol.Error()); err != expected {
+		t.Errorf("Expected %v, got %v", expected, err)
+	}
+}
+
+func TestRejectLogin(t *testing.T) {
+	// The client never reads the reason, so the write can't complete.
+	server, client := net.Pipe()
+	defer client.Close()
+
+	done := make(chan bool)
+	go func() {
+		rejectLogin(server, "go away")
+		done <- true
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(rejectLoginTimeout + testTimeout):
+		t.Fatalf("rejectLogin blocked on a client that doesn't read")
+	}
+	if _, err := server.Write([]byte{0}); err == nil {
+		t.Errorf("Expected the connection to be closed")
+	}
+}
+
+func TestGame_NamedEntitySpawn(t *testing.T) {
+	_, listener := newTestGame(t)
+
+	alice := loginPlaced(t, listener, "alice")
+	bob := loginPlaced(t, listener, "bob")
+
+	// Alice may be shown to bob along with his chunks, before he is placed.
+	bob.Collect(500 * time.Millisecond)
+	if spawns := bob.Received(proto.PacketIdNamedEntitySpawn, testconn.ForEntity(alice.EntityId)); len(spawns) != 1 {
+		t.Errorf("Expected bob to see alice spawn once, got %d", len(spawns))
+	}
+
+	if _, err := alice.WaitFor(testTimeout, proto.PacketIdNamedEntitySpawn, testconn.ForEntity(bob.EntityId)); err != nil {
+		t.Errorf("Expected alice to see bob spawn: %v", err)
+	}
+}
+
+func TestGame_ChatBroadcast(t *testing.T) {
+	_, listener := newTestGame(t)
+
+	alice := loginPlaced(t, listener, "alice")
+	bob := loginPlaced(t, listener, "bob")
+
+	if err := proto.WriteChatMessage(alice.Conn, "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	isHello := func(packet *testconn.Packet) bool {
+		return packet.Args[0] == "<alice> hello"
+	}
+	if _, err := bob.WaitFor(testTimeout, proto.PacketIdChatMessage, isHello); err != nil {
+		t.Errorf("Expected bob to receive the message: %v", err)
+	}
+	if _, err := alice.WaitFor(testTimeout, proto.PacketIdChatMessage, isHello); err != nil {
+		t.Errorf("Expected alice to receive her own message: %v", err)
+	}
+}
+
+func TestGame_DisconnectCleanup(t *testing.T) {
+	game, listener := newTestGame(t)
+
+	alice := loginPlaced(t, listener, "alice")
+	bob := loginPlaced(t, listener, "bob")
+	if _, err := alice.WaitFor(testTimeout, proto.PacketIdNamedEntitySpawn, testconn.ForEntity(bob.EntityId)); err != nil {
+		t.Fatalf("Expected alice to see bob spawn: %v", err)
+	}
+
+	alice.Close()
+
+	checkDisconnected(t, game, listener, alice, bob)
+}
+
+func TestGame_DisconnectWriteFailure(t *testing.T) {
+	game, listener := newTestGame(t)
+
+	alice := loginPlaced(t, listener, "alice")
+	bob := loginPlaced(t, listener, "bob")
+	if _, err := alice.WaitFor(testTimeout, proto.PacketIdNamedEntitySpawn, testconn.ForEntity(bob.EntityId)); err != nil {
+		t.Fatalf("Expected alice to see bob spawn: %v", err)
+	}
+
+	// The connection dies mid-session without the server's reads failing, so
+	// that it's only noticed when the chat message can't be sent to alice.
+	alice.Conn.CloseRead()
+	if err := proto.WriteChatMessage(bob.Conn, "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	checkDisconnected(t, game, listener, alice, bob)
+}
+
+// checkDisconnected checks that the game has removed the player whose
+// connection was killed, as seen by the game and the other player.
+func checkDisconnected(t *testing.T, game *Game, listener *testconn.Listener, gone, other *testconn.Client) {
+	if _, err := other.Seen(testTimeout, proto.PacketIdEntityDestroy, testconn.ForEntity(gone.EntityId)); err != nil {
+		t.Errorf("Expected entity to be destroyed for the other player: %v", err)
+	}
+	if _, err := other.Seen(testTimeout, proto.PacketIdUserListItem, isUserListItem("alice", false)); err != nil {
+		t.Errorf("Expected alice to be removed from the other player's list: %v", err)
+	}
+
+	// The game saves the player's data as it removes them.
+	if count := game.PlayerCount(); count != 1 {
+		t.Errorf("Expected 1 player, got %d", count)
+	}
+	if game.PlayerByName("alice") != nil || game.PlayerByEntityId(gone.EntityId) != nil {
+		t.Errorf("Expected alice to be gone")
+	}
+	if game.entityManager.Exists(gone.EntityId) {
+		t.Errorf("Expected entity %d to be removed", gone.EntityId)
+	}
+	if data, err := game.worldStore.PlayerData("alice"); err != nil || data == nil {
+		t.Errorf("Expected alice's data to be saved, got %v, %v", data, err)
+	}
+
+	// The player can log in again.
+	loginPlaced(t, listener, "alice")
+	if count := game.PlayerCount(); count != 2 {
+		t.Errorf("Expected 2 players after logging in again, got %d", count)
+	}
+}
+
+// runConsole runs the commands as the game's console, returning its output.
+func runConsole(t *testing.T, game *Game, commands ...string) string {
+	output := new(strings.Builder)
+	input := strings.NewReader(strings.Join(commands, "\n"))
+	if err := console.New(gamerules.CommandFramework, game).Serve(input, output); err != nil {
+		t.Fatalf("Console error: %v", err)
+	}
+	return output.String()
+}
+
+func TestGame_KickCommand(t *testing.T) {
+	game, listener := newTestGame(t)
+	alice := loginPlaced(t, listener, "alice")
+	bob := loginPlaced(t, listener, "bob")
+
+	if output := runConsole(t, game, "kick bob Go away"); output != "Kicked bob\n" {
+		t.Errorf("Expected bob to be kicked, got %q", output)
+	}
+
+	packet, err := bob.WaitFor(testTimeout, proto.PacketIdDisconnect, nil)
+	if err != nil {
+		t.Fatalf("Expected bob to be disconnected: %v", err)
+	}
+	if reason := packet.Args[0]; reason != "Go away" {
+		t.Errorf("Expected kick reason %q, got %q", "Go away", reason)
+	}
+	if _, err := alice.Seen(testTimeout, proto.PacketIdUserListItem, isUserListItem("bob", false)); err != nil {
+		t.Errorf("Expected bob to be removed from alice's list: %v", err)
+	}
+}
+
+func TestGame_BanCommand(t *testing.T) {
+	defer func(b *permission.BanList) { gamerules.BannedPlayers = b }(gamerules.BannedPlayers)
+	var err error
+	if gamerules.BannedPlayers, err = permission.LoadBanList(filepath.Join(t.TempDir(), "banned-players.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	game, listener := newTestGame(t)
+	bob := loginPlaced(t, listener, "bob")
+
+	if output := runConsole(t, game, "ban bob Griefing"); output != "Banned bob\n" {
+		t.Errorf("Expected bob to be banned, got %q", output)
+	}
+
+	packet, err := bob.WaitFor(testTimeout, proto.PacketIdDisconnect, nil)
+	if err != nil {
+		t.Fatalf("Expected bob to be disconnected: %v", err)
+	}
+	if want := "You are banned from this server: Griefing"; packet.Args[0] != want {
+		t.Errorf("Expected kick reason %q, got %q", want, packet.Args[0])
+	}
+}
+
+func TestGame_AdminCommandsNeedPermission(t *testing.T) {
+	game, listener := newTestGame(t)
+	alice := loginPlaced(t, listener, "alice")
+
+	// Players in the default group may not change the world's time or the
+	// server's logging.
+	isRefused := func(packet *testconn.Packet) bool {
+		return packet.Args[0] == "You do not have permission to use this command."
+	}
+	for _, command := range []string{"/time set 13000", "/loglevel chunk debug"} {
+		if err := proto.WriteChatMessage(alice.Conn, command); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := alice.WaitFor(testTimeout, proto.PacketIdChatMessage, isRefused); err != nil {
+			t.Errorf("%s: expected to be refused: %v", command, err)
+		}
+	}
+
+	if dayTicks := game.Time().DayTicks(); dayTicks >= 13000 {
+		t.Errorf("Expected the time not to be set, got %d", dayTicks)
+	}
+	if level := logger.Chunk.Level(); level == logger.LevelDebug {
+		t.Errorf("Expected the chunk log level not to be set to debug")
+	}
+}
+
+func TestGame_Bot(t *testing.T) {
+	game, listener := newTestGame(t)
+
+	conn, err := listener.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := bot.DefaultConfig("bot")
+	config.MoveInterval = 50 * time.Millisecond
+	config.ChatChance = 1
+	config.DigChance = 0
+	b := bot.New(conn, config)
+	defer b.Close()
+
+	if err = b.Login(); err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+
+	stop := make(chan bool)
+	time.AfterFunc(time.Second, func() { close(stop) })
+	if err = b.Run(stop); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	stats := b.Stats()
+	if stats.Chunks == 0 {
+		t.Errorf("Expected the bot to have been sent chunks")
+	}
+	if len(stats.ChatLatencies) == 0 {
+		t.Errorf("Expected the bot's chat to be echoed")
+	}
+	if stats.Disconnect != "" {
+		t.Errorf("Expected the bot to stay connected, got %q", stats.Disconnect)
+	}
+
+	// Let the player finish handling the bot's chat before the next test
+	// replaces the game's globals.
+	b.Close()
+	for deadline := time.Now().Add(testTimeout); game.PlayerCount() != 0; {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the bot's player to be removed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestGame_MultipleListeners(t *testing.T) {
+	defer func(online bool) { *onlineMode = online }(*onlineMode)
+	*onlineMode = false
+
+	worldPath := t.TempDir()
+	if err := worldstore.CreateWorld(worldPath); err != nil {
+		t.Fatal(err)
+	}
+
+	listeners := []*testconn.Listener{testconn.NewListener(), testconn.NewListener()}
+	game, err := NewGame(worldPath, []net.Listener{listeners[0], listeners[1]}, "test server", "", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(game.Stop)
+	go game.Serve()
+	shutdownOnCleanup(t, game)
+
+	loginPlaced(t, listeners[0], "alice")
+	loginPlaced(t, listeners[1], "bob")
+	if count := game.PlayerCount(); count != 2 {
+		t.Errorf("Expected 2 players, got %d", count)
+	}
+
+	game.Stop()
+	for i, listener := range listeners {
+		if _, err := listener.Dial(); err != testconn.ErrClosed {
+			t.Errorf("Listener %d: expected to be closed after Stop, got %v", i, err)
+		}
+	}
+	// Stopping again is harmless.
+	game.Stop()
+}
+
+func TestGame_StopEndsServe(t *testing.T) {
+	game, listener := newTestGameClock(t, clock.Real)
+	served := make(chan struct{})
+	go func() {
+		game.Serve()
+		close(served)
+	}()
+	loginPlaced(t, listener, "alice")
+
+	game.Stop()
+	select {
+	case <-served:
+	case <-time.After(testTimeout):
+		t.Fatal("Expected Serve to return after Stop")
+	}
+	if count := game.PlayerCount(); count != 0 {
+		t.Errorf("Expected a stopped game to report no players, got %d", count)
+	}
+}
+
+func TestGame_Shutdown(t *testing.T) {
+	game, listener := newTestGame(t)
+	alice := loginPlaced(t, listener, "alice")
+
+	if err := game.Shutdown(); err != nil {
+		t.Fatalf("Shutdown error: %v", err)
+	}
+
+	packet, err := alice.WaitFor(testTimeout, proto.PacketIdDisconnect, nil)
+	if err != nil {
+		t.Fatalf("Expected alice to be kicked: %v", err)
+	}
+	if reason := packet.Args[0]; reason != shutdownKickMsg {
+		t.Errorf("Expected kick reason %q, got %q", shutdownKickMsg, reason)
+	}
+	if count := game.PlayerCount(); count != 0 {
+		t.Errorf("Expected no players, got %d", count)
+	}
+	if data, err := game.worldStore.PlayerData("alice"); err != nil || data == nil {
+		t.Errorf("Expected alice's data to be saved, got %v, %v", data, err)
+	}
+	if _, err := listener.Dial(); err != testconn.ErrClosed {
+		t.Errorf("Expected listener to be closed, got %v", err)
+	}
+}
+
+func TestGame_RunTicks(t *testing.T) {
+	fakeClock := clock.NewFake(time.Unix(1000, 0))
+	game, _ := newTestGameClock(t, fakeClock)
+
+	// Work queued before the ticks is done first.
+	game.SetTime(1000)
+	game.RunTicks(5)
+
+	if game.time != 1005 {
+		t.Errorf("Expected time 1005, got %d", game.time)
+	}
+	// Ticks take no time on a clock that isn't advanced.
+	if game.tickTimes.count != 5 || game.tickTimes.max != 0 {
+		t.Errorf("Expected 5 ticks taking no time, got %d taking up to %v", game.tickTimes.count, game.tickTimes.max)
+	}
+}
+
+func TestGame_PeriodicTimeUpdates(t *testing.T) {
+	game, listener := newTestGameClock(t, clock.NewFake(time.Unix(1000, 0)))
+
+	// The game isn't served, so ticks are run until alice has logged in.
+	type loginResult struct {
+		client *testconn.Client
+		err    error
+	}
+	loggedIn := make(chan loginResult, 1)
+	go func() {
+		client, err := testconn.Login(listener, "alice")
+		loggedIn <- loginResult{client, err}
+	}()
+	var result loginResult
+	for waiting := true; waiting; {
+		select {
+		case result = <-loggedIn:
+			waiting = false
+		default:
+			game.RunTicks(1)
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if result.err != nil {
+		t.Fatalf("Login failed: %v", result.err)
+	}
+	alice := result.client
+	defer alice.Close()
+	game.RunTicks(1)
+	alice.Collect(500 * time.Millisecond)
+	sent := len(alice.Received(proto.PacketIdTimeUpdate, nil))
+
+	start := game.Time()
+	game.RunTicks(3 * TicksPerSecond)
+	alice.Collect(500 * time.Millisecond)
+
+	updates := alice.Received(proto.PacketIdTimeUpdate, nil)[sent:]
+	if len(updates) != 3 {
+		t.Fatalf("Expected 3 time updates in 3 seconds, got %d", len(updates))
+	}
+	for _, update := range updates {
+		updateTime := update.Args[0].(Ticks)
+		if updateTime <= start || updateTime%TicksPerSecond != 0 {
+			t.Errorf("Expected time updates once a second after %d, got one at %d", start, updateTime)
+		}
+	}
+}
+
+func TestGame_AddTime(t *testing.T) {
+	game, _ := newTestGameClock(t, clock.NewFake(time.Unix(1000, 0)))
+
+	game.storeTime(TicksPerDay*2 + 23000)
+	game.AddTime(TicksPerDay + 2000)
+	game.RunTicks(1)
+
+	// The day count moves on with the time of day.
+	if expected := Ticks(TicksPerDay*4 + 1001); game.Time() != expected {
+		t.Errorf("Expected time %d, got %d", expected, game.Time())
+	}
+	if dayTicks := game.Time().DayTicks(); dayTicks != 1001 {
+		t.Errorf("Expected time of day 1001, got %d", dayTicks)
+	}
+}
+
+func TestGame_AutosaveLevelData(t *testing.T) {
+	defer func(interval int) { *levelSaveInterval = interval }(*levelSaveInterval)
+	*levelSaveInterval = 1
+
+	game, _ := newTestGameClock(t, clock.NewFake(time.Unix(1000, 0)))
+	game.storeTime(5000)
+	game.RunTicks(TicksPerSecond)
+
+	world, err := worldstore.LoadWorldStore(game.worldStore.WorldPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := Ticks(5000 + TicksPerSecond); world.Time != expected {
+		t.Errorf("Expected saved time %d, got %d", expected, world.Time)
+	}
+}
+
+func TestGame_SetTime(t *testing.T) {
+	game, _ := newTestGameClock(t, clock.NewFake(time.Unix(1000, 0)))
+
+	type Test struct {
+		time, dayTicks, expected Ticks
+	}
+
+	var tests = []Test{
+		// The day count is kept, even when going back to earlier in the day.
+		{TicksPerDay*3 + 20000, 1000, TicksPerDay*3 + 1000},
+		{TicksPerDay*3 + 1000, 23999, TicksPerDay*3 + 23999},
+		{TicksPerDay - 1, 0, 0},
+	}
+
+	for _, test := range tests {
+		game.storeTime(test.time)
+		game.SetTime(test.dayTicks)
+		game.RunTicks(1)
+		// The tick after setting the time advances it too.
+		if result := game.Time(); result != test.expected+1 {
+			t.Errorf("Time %d set to %d: expected %d, got %d", test.time, test.dayTicks, test.expected+1, result)
+		}
+	}
+}
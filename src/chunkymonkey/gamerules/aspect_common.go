@@ -24,6 +24,15 @@ func spawnItemInBlock(chunk IChunkBlock, blockLoc BlockXyz, itemTypeId ItemTypeI
 	)
 }
 
+// blockTypeAt returns the type of the block at loc, if it can be looked at.
+func blockTypeAt(chunk IChunkBlock, loc *BlockXyz) (blockType *BlockType, ok bool) {
+	blockId, _, ok := chunk.BlockAt(loc)
+	if !ok {
+		return
+	}
+	return Blocks.Get(blockId)
+}
+
 type blockDropItem struct {
 	DroppedItem ItemTypeId
 	Probability byte // Probabilities specified as a percentage
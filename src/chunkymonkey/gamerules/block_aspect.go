@@ -21,11 +21,32 @@ type IChunkBlock interface {
 	AddOnUnsubscribe(entityId EntityId, observer IUnsubscribed)
 	RemoveOnUnsubscribe(entityId EntityId, observer IUnsubscribed)
 
+	// BlockAt returns the type and data of a block in any loaded chunk of the
+	// shard. ok is false if it can't be looked at.
+	BlockAt(blockXyz *BlockXyz) (blockId BlockId, blockData byte, ok bool)
+
+	// SetBlockAt changes a block in any loaded chunk of the shard, telling
+	// players and making it and the blocks next to it active. ok is false if
+	// it can't be changed.
+	SetBlockAt(blockXyz *BlockXyz, blockId BlockId, blockData byte) (ok bool)
+
+	// Biome returns the biome of the column containing the block.
+	Biome(blockIndex BlockIndex) BiomeId
+
 	// AddActiveBlock flags a block in any chunk as active.
 	AddActiveBlock(blockXyz *BlockXyz)
 
 	// AddActiveBlockIndex flags a block in the chunk itself as active by index.
 	AddActiveBlockIndex(blockIndex BlockIndex)
+
+	// ScheduleUpdate has a block in any chunk updated once delay ticks have
+	// passed, provided that it is still of the same type then. A block with an
+	// update already pending isn't scheduled again.
+	ScheduleUpdate(blockXyz *BlockXyz, delay Ticks)
+
+	// ScheduleUpdateIndex schedules an update of a block in the chunk itself by
+	// index.
+	ScheduleUpdateIndex(blockIndex BlockIndex, delay Ticks)
 }
 
 // IUnsubscribed is the interface by which blocks (and potentially other
@@ -71,6 +92,11 @@ type IBlockAspect interface {
 	// inventory for the block (assuming it still has one).
 	InventoryClick(instance *BlockInstance, player IPlayerClient, click *Click)
 
+	// InventoryPutItem is called when the player puts an item into the
+	// inventory for the block by shift-clicking it. Whatever of the item the
+	// inventory doesn't take must be given back to the player.
+	InventoryPutItem(instance *BlockInstance, player IPlayerClient, item *Slot)
+
 	// InventoryUnsubscribed is called when the player closes the window for the
 	// inventory for the block (assuming it still has one).
 	InventoryUnsubscribed(instance *BlockInstance, player IPlayerClient)
@@ -83,3 +109,11 @@ type IBlockAspect interface {
 	// if the block should not tick again.
 	Tick(instance *BlockInstance) bool
 }
+
+// IBlockUpdater is implemented by the aspects of blocks that act some time
+// after something happens, such as flowing water, rather than on every tick.
+type IBlockUpdater interface {
+	// UpdateBlock is called for an update of the block that was scheduled with
+	// IChunkBlock.ScheduleUpdate.
+	UpdateBlock(instance *BlockInstance)
+}
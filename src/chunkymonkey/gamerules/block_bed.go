@@ -0,0 +1,19 @@
+package gamerules
+
+func makeBedAspect() (aspect IBlockAspect) {
+	return &BedAspect{}
+}
+
+// BedAspect is the behaviour of beds. Using a bed at night makes it the
+// player's home bed, where they respawn after dying.
+type BedAspect struct {
+	StandardAspect
+}
+
+func (aspect *BedAspect) Name() string {
+	return "Bed"
+}
+
+func (aspect *BedAspect) Interact(instance *BlockInstance, player IPlayerClient) {
+	player.UseBed(instance.BlockLoc)
+}
@@ -0,0 +1,46 @@
+package gamerules
+
+import (
+	. "chunkymonkey/types"
+)
+
+const (
+	// Set in the data of fence gates and trapdoors when they are open.
+	blockDataOpen = 0x4
+)
+
+// blockShapes are the collision boxes of solid blocks that aren't whole
+// cubes, relative to the block's lowest corner.
+var blockShapes = map[BlockId]AABB{
+	26:  {AbsXyz{0, 0, 0}, AbsXyz{1, 9. / 16, 1}},                            // bed
+	44:  {AbsXyz{0, 0, 0}, AbsXyz{1, 0.5, 1}},                                // slab
+	81:  {AbsXyz{1. / 16, 0, 1. / 16}, AbsXyz{15. / 16, 15. / 16, 15. / 16}}, // cactus
+	85:  {AbsXyz{0, 0, 0}, AbsXyz{1, 1.5, 1}},                                // fence
+	88:  {AbsXyz{0, 0, 0}, AbsXyz{1, 7. / 8, 1}},                             // soul sand
+	92:  {AbsXyz{1. / 16, 0, 1. / 16}, AbsXyz{15. / 16, 0.5, 15. / 16}},      // cake
+	96:  {AbsXyz{0, 0, 0}, AbsXyz{1, 3. / 16, 1}},                            // trapdoor
+	107: {AbsXyz{0, 0, 0}, AbsXyz{1, 1.5, 1}},                                // fence gate
+}
+
+// CollisionBox returns the box that entities collide with for a block of
+// this type at blockLoc. ok is false if entities pass through the block.
+// Fences are taller than a block, so the block below a box must also be
+// checked for collisions.
+func (blockType *BlockType) CollisionBox(blockLoc *BlockXyz, blockData byte) (box AABB, ok bool) {
+	if !blockType.Solid {
+		return
+	}
+
+	switch blockType.id {
+	case 96, 107: // trapdoor, fence gate
+		if blockData&blockDataOpen != 0 {
+			return
+		}
+	}
+
+	shape, isShaped := blockShapes[blockType.id]
+	if !isShaped {
+		return NewBlockAABB(blockLoc), true
+	}
+	return shape.Offset(*blockLoc.ToAbsXyz()), true
+}
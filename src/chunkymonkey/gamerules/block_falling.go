@@ -0,0 +1,60 @@
+package gamerules
+
+import (
+	. "chunkymonkey/types"
+)
+
+// fallDelay is how long a block waits after losing its support before it
+// falls.
+const fallDelay = Ticks(3)
+
+func makeFallingAspect() (aspect IBlockAspect) {
+	return &FallingAspect{}
+}
+
+// Behaviour of blocks such as sand and gravel, which fall when the block
+// beneath them is taken away, becoming a FallingBlock entity until they land.
+type FallingAspect struct {
+	StandardAspect
+	ObjType ObjTypeId // What clients are shown while the block falls.
+}
+
+func (aspect *FallingAspect) Name() string {
+	return "Falling"
+}
+
+// Tick is called when a block next to the falling block changes, and has the
+// block fall shortly if it has lost its support.
+func (aspect *FallingAspect) Tick(instance *BlockInstance) bool {
+	if aspect.unsupported(instance) {
+		instance.Chunk.ScheduleUpdateIndex(instance.Index, fallDelay)
+	}
+	return false
+}
+
+// UpdateBlock implements IBlockUpdater. The block falls if it is still
+// unsupported.
+func (aspect *FallingAspect) UpdateBlock(instance *BlockInstance) {
+	if !aspect.unsupported(instance) {
+		return
+	}
+	if !instance.Chunk.SetBlockAt(&instance.BlockLoc, BlockIdAir, 0) {
+		return
+	}
+
+	position := instance.BlockLoc.ToAbsXyz()
+	position.X += 0.5
+	position.Y += 0.5
+	position.Z += 0.5
+	instance.Chunk.AddEntity(NewFallingBlock(instance.BlockType.id, position))
+}
+
+// unsupported returns true if the block beneath can be fallen into.
+func (aspect *FallingAspect) unsupported(instance *BlockInstance) bool {
+	below := instance.BlockLoc.AddXyz(0, -1, 0)
+	if below == nil {
+		return false
+	}
+	blockType, ok := blockTypeAt(instance.Chunk, below)
+	return ok && blockType.Replaceable
+}
@@ -0,0 +1,271 @@
+package gamerules
+
+import (
+	"fmt"
+
+	. "chunkymonkey/types"
+)
+
+// The data of a fluid block holds its level, which is 0 for a source and rises
+// by the fluid's decay with each block that it has spread sideways. Falling
+// fluid also has fluidFalling set.
+const (
+	fluidLevelMask = 0x7
+	fluidFalling   = 0x8
+	fluidDry       = 8 // A fluid dries up rather than reach this level.
+
+	// fluidHardenLevel is the highest level of flowing fluid that hardens on
+	// touching another fluid.
+	fluidHardenLevel = 4
+)
+
+func makeFluidAspect() (aspect IBlockAspect) {
+	return &FluidAspect{}
+}
+
+// fluidHardening is what a fluid turns into where it meets another fluid.
+type fluidHardening struct {
+	Source  BlockId // A source touched by another fluid.
+	Flowing BlockId // Flowing fluid touched by another fluid.
+	Falling BlockId // Another fluid that the fluid falls onto.
+}
+
+// Behaviour of water and lava. Fluids spread from their sources, falling where
+// they can and otherwise spreading sideways until their level decays away.
+// Each block of fluid only moves when an update scheduled for it runs, which is
+// whenever a block next to it changes. Flowing fluid that is settled is made
+// stationary. Fluid doesn't flow into chunks that aren't loaded within its
+// shard.
+type FluidAspect struct {
+	VoidAspect
+	Flowing    BlockId
+	Stationary BlockId
+	Decay      byte            // How much the level rises with each block spread sideways.
+	Delay      Ticks           // Ticks between each step of the flow.
+	Infinite   bool            // Whether flowing fluid between two sources becomes a source.
+	Hardens    *fluidHardening // What the fluid becomes on meeting another, if anything.
+}
+
+func (aspect *FluidAspect) Name() string {
+	return "Fluid"
+}
+
+func (aspect *FluidAspect) Check() error {
+	for _, blockId := range []BlockId{aspect.Flowing, aspect.Stationary} {
+		if _, ok := Blocks.Get(blockId); !ok {
+			return fmt.Errorf("fluid block type %d does not exist", blockId)
+		}
+	}
+	if aspect.Decay < 1 || aspect.Decay >= fluidDry {
+		return fmt.Errorf("fluid has bad Decay %d", aspect.Decay)
+	}
+	if aspect.Delay < 1 {
+		return fmt.Errorf("fluid has bad Delay %d", aspect.Delay)
+	}
+	if h := aspect.Hardens; h != nil {
+		for _, blockId := range []BlockId{h.Source, h.Flowing, h.Falling} {
+			if _, ok := Blocks.Get(blockId); !ok {
+				return fmt.Errorf("hardened fluid block type %d does not exist", blockId)
+			}
+		}
+	}
+	return nil
+}
+
+// Tick is called when a block next to the fluid changes, and schedules an
+// update of the fluid, unless it hardens straight away.
+func (aspect *FluidAspect) Tick(instance *BlockInstance) bool {
+	if !aspect.harden(instance) {
+		instance.Chunk.ScheduleUpdateIndex(instance.Index, aspect.Delay)
+	}
+	return false
+}
+
+// UpdateBlock implements IBlockUpdater. It runs a step of the flow.
+func (aspect *FluidAspect) UpdateBlock(instance *BlockInstance) {
+	if aspect.harden(instance) {
+		return
+	}
+
+	chunk := instance.Chunk
+	loc := &instance.BlockLoc
+	data := instance.Data
+	if !isFluidSource(data) {
+		var dry bool
+		if data, dry = aspect.inflow(chunk, loc); dry {
+			chunk.SetBlockAt(loc, BlockIdAir, 0)
+			return
+		}
+	}
+
+	if data != instance.Data {
+		chunk.SetBlockAt(loc, aspect.Flowing, data)
+	} else if instance.BlockType.id == aspect.Flowing {
+		chunk.SetBlockAt(loc, aspect.Stationary, data)
+	}
+
+	aspect.spread(chunk, loc, data)
+}
+
+// inflow returns the data that flowing fluid at loc should have, given the
+// fluid around it, or dry if nothing flows into it any more.
+func (aspect *FluidAspect) inflow(chunk IChunkBlock, loc *BlockXyz) (data byte, dry bool) {
+	if above := loc.AddXyz(0, 1, 0); above != nil {
+		if aboveData, ok := aspect.fluidAt(chunk, above); ok {
+			return fluidFalling | aboveData&fluidLevelMask, false
+		}
+	}
+
+	minLevel := byte(fluidDry)
+	sources := 0
+	for _, face := range horizontalFaces {
+		d := face.Offset()
+		neighbourData, ok := aspect.fluidAt(chunk, loc.AddXyz(d.X, d.Y, d.Z))
+		if !ok {
+			continue
+		}
+		if isFluidSource(neighbourData) {
+			sources++
+		}
+		if level := fluidLevel(neighbourData); level < minLevel {
+			minLevel = level
+		}
+	}
+
+	if aspect.Infinite && sources >= 2 {
+		if below := loc.AddXyz(0, -1, 0); below != nil {
+			if belowData, ok := aspect.fluidAt(chunk, below); ok && isFluidSource(belowData) {
+				return 0, false
+			}
+			if blockType, ok := blockTypeAt(chunk, below); ok && blockType.Solid {
+				return 0, false
+			}
+		}
+	}
+
+	if level := minLevel + aspect.Decay; level < fluidDry {
+		return level, false
+	}
+	return 0, true
+}
+
+// spread has fluid at loc with the given data flow into the blocks around it.
+// It falls if it can. Otherwise sources, and fluid that isn't above more of
+// itself, spread sideways.
+func (aspect *FluidAspect) spread(chunk IChunkBlock, loc *BlockXyz, data byte) {
+	if below := loc.AddXyz(0, -1, 0); below != nil {
+		if aspect.flowInto(chunk, below, fluidFalling|data&fluidLevelMask, true) {
+			return
+		}
+		if _, onFluid := aspect.fluidAt(chunk, below); onFluid && !isFluidSource(data) {
+			return
+		}
+	}
+
+	level := fluidLevel(data) + aspect.Decay
+	if level >= fluidDry {
+		return
+	}
+	for _, face := range horizontalFaces {
+		d := face.Offset()
+		if neighbour := loc.AddXyz(d.X, d.Y, d.Z); neighbour != nil {
+			aspect.flowInto(chunk, neighbour, level, false)
+		}
+	}
+}
+
+// flowInto has the fluid flow into the block at loc with the given data, if
+// it can. The block is replaced if it is empty or weaker fluid of the same
+// kind. A hardening fluid that flows into another fluid hardens there instead.
+func (aspect *FluidAspect) flowInto(chunk IChunkBlock, loc *BlockXyz, data byte, falling bool) (flowed bool) {
+	blockType, ok := blockTypeAt(chunk, loc)
+	if !ok {
+		return false
+	}
+
+	if other, isFluid := blockType.Aspect.(*FluidAspect); isFluid {
+		if other.Flowing == aspect.Flowing {
+			_, targetData, _ := chunk.BlockAt(loc)
+			if isFluidSource(targetData) || fluidLevel(targetData) <= fluidLevel(data) {
+				return false
+			}
+		} else {
+			if aspect.Hardens == nil {
+				// The other fluid hardens itself when it is next updated.
+				return false
+			}
+			hardened := aspect.Hardens.Flowing
+			if falling {
+				hardened = aspect.Hardens.Falling
+			}
+			return chunk.SetBlockAt(loc, hardened, 0)
+		}
+	} else if !blockType.Replaceable {
+		return false
+	}
+
+	return chunk.SetBlockAt(loc, aspect.Flowing, data)
+}
+
+// harden turns the fluid into its hardened form if it touches another fluid
+// from above or the side, and returns true if it did.
+func (aspect *FluidAspect) harden(instance *BlockInstance) bool {
+	if aspect.Hardens == nil {
+		return false
+	}
+
+	var hardened BlockId
+	switch {
+	case isFluidSource(instance.Data):
+		hardened = aspect.Hardens.Source
+	case fluidLevel(instance.Data) <= fluidHardenLevel:
+		hardened = aspect.Hardens.Flowing
+	default:
+		return false
+	}
+
+	for _, face := range AllFaces() {
+		if face == FaceBottom {
+			continue
+		}
+		d := face.Offset()
+		neighbour := instance.BlockLoc.AddXyz(d.X, d.Y, d.Z)
+		if neighbour == nil {
+			continue
+		}
+		if blockType, ok := blockTypeAt(instance.Chunk, neighbour); ok {
+			if other, isFluid := blockType.Aspect.(*FluidAspect); isFluid && other.Flowing != aspect.Flowing {
+				return instance.Chunk.SetBlockAt(&instance.BlockLoc, hardened, 0)
+			}
+		}
+	}
+	return false
+}
+
+// fluidAt returns the data of the block at loc if it is the same fluid.
+func (aspect *FluidAspect) fluidAt(chunk IChunkBlock, loc *BlockXyz) (data byte, ok bool) {
+	if loc == nil {
+		return
+	}
+	blockId, data, ok := chunk.BlockAt(loc)
+	if !ok || (blockId != aspect.Flowing && blockId != aspect.Stationary) {
+		return 0, false
+	}
+	return data, true
+}
+
+// isFluidSource returns true if the fluid data is that of a source.
+func isFluidSource(data byte) bool {
+	return data == 0
+}
+
+// fluidLevel returns the level of fluid with the given data. Falling fluid
+// spreads as strongly as a source when it lands.
+func fluidLevel(data byte) byte {
+	if data&fluidFalling != 0 {
+		return 0
+	}
+	return data & fluidLevelMask
+}
+
+var horizontalFaces = []Face{FaceWest, FaceEast, FaceNorth, FaceSouth}
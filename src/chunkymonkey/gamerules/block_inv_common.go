@@ -24,12 +24,21 @@ func (aspect *InventoryAspect) InventoryClick(instance *BlockInstance, player IP
 		blkInv.Click(player, click)
 	} else {
 		// No inventory to act on (shouldn't happen, normally).
-		player.InventoryTxState(blkInv.blockLoc, click.TxId, false)
+		player.InventoryTxState(instance.BlockLoc, click.TxId, false)
 		player.InventoryCursorUpdate(instance.BlockLoc, click.Cursor)
 		return
 	}
 }
 
+func (aspect *InventoryAspect) InventoryPutItem(instance *BlockInstance, player IPlayerClient, item *Slot) {
+	blkInv := aspect.blockInv(instance, false)
+	if blkInv != nil {
+		blkInv.PutItem(player, item)
+	} else {
+		aspect.StandardAspect.InventoryPutItem(instance, player, item)
+	}
+}
+
 func (aspect *InventoryAspect) InventoryUnsubscribed(instance *BlockInstance, player IPlayerClient) {
 	blkInv := aspect.blockInv(instance, false)
 	if blkInv != nil {
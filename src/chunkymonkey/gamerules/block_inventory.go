@@ -60,6 +60,11 @@ func (blkInv *blockInventory) MarshalNbt(tag *nbt.Compound) (err error) {
 }
 
 func (blkInv *blockInventory) Click(player IPlayerClient, click *Click) {
+	if click.ShiftClick {
+		blkInv.shiftClick(player, click)
+		return
+	}
+
 	txState := blkInv.inv.Click(click)
 
 	player.InventoryCursorUpdate(blkInv.blockLoc, click.Cursor)
@@ -68,6 +73,27 @@ func (blkInv *blockInventory) Click(player IPlayerClient, click *Click) {
 	player.InventoryTxState(blkInv.blockLoc, click.TxId, txState == TxStateAccepted)
 }
 
+// shiftClick takes the stack from the clicked slot and gives it to the player.
+func (blkInv *blockInventory) shiftClick(player IPlayerClient, click *Click) {
+	taken, txState := blkInv.inv.ShiftClick(click)
+
+	if !taken.IsEmpty() {
+		player.InventoryTakeItem(blkInv.blockLoc, taken)
+	}
+
+	player.InventoryTxState(blkInv.blockLoc, click.TxId, txState == TxStateAccepted)
+}
+
+// PutItem puts as much of the item into the inventory as will fit, and gives
+// the rest back to the player.
+func (blkInv *blockInventory) PutItem(player IPlayerClient, item *Slot) {
+	blkInv.inv.PutItem(item)
+
+	if !item.IsEmpty() {
+		player.GiveItemAtPosition(blkInv.blockLoc.MidPointToAbsXyz(), *item)
+	}
+}
+
 func (blkInv *blockInventory) SlotUpdate(slot *Slot, slotId SlotId) {
 	for _, subscriber := range blkInv.subscribers {
 		subscriber.InventorySlotUpdate(blkInv.blockLoc, *slot, slotId)
@@ -91,6 +117,10 @@ func (blkInv *blockInventory) AddSubscriber(player IPlayerClient) {
 	slots := blkInv.inv.MakeProtoSlots()
 
 	player.InventorySubscribed(blkInv.blockLoc, blkInv.invTypeId, slots)
+
+	if progressInv, ok := blkInv.inv.(IProgressInventory); ok {
+		progressInv.SendProgress()
+	}
 }
 
 func (blkInv *blockInventory) RemoveSubscriber(entityId EntityId) {
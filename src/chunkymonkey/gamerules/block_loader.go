@@ -15,13 +15,35 @@ type aspectMakerFn func() (aspect IBlockAspect)
 
 var aspectMakers map[string]aspectMakerFn
 
-// Used specifically for json unmarshalling of block definitions.
+// Used specifically for json marshalling of block definitions, in the layout
+// of the data files.
 type blockDef struct {
-	BlockAttrs
+	BlockAttrs BlockAttrs
 	Aspect     string
 	AspectArgs *aspectArgs
 }
 
+// UnmarshalJSON also accepts block definitions with the attributes alongside
+// the aspect, rather than nested in BlockAttrs.
+func (bd *blockDef) UnmarshalJSON(raw []byte) (err error) {
+	var def struct {
+		BlockAttrs
+		NestedAttrs *BlockAttrs `json:"BlockAttrs"`
+		Aspect      string
+		AspectArgs  *aspectArgs
+	}
+	if err = json.Unmarshal(raw, &def); err != nil {
+		return
+	}
+	bd.BlockAttrs = def.BlockAttrs
+	if def.NestedAttrs != nil {
+		bd.BlockAttrs = *def.NestedAttrs
+	}
+	bd.Aspect = def.Aspect
+	bd.AspectArgs = def.AspectArgs
+	return
+}
+
 func newBlockDefFromBlockType(block *BlockType) (bd *blockDef, err error) {
 	var aspectArgs *aspectArgs
 	aspectArgs, err = newAspectArgs(block.Aspect)
@@ -194,8 +216,11 @@ func LoadBlocksFromFile(filename string) (blockTypes BlockTypeList, err error) {
 
 func init() {
 	aspectMakers = map[string]aspectMakerFn{
+		"Bed":          makeBedAspect,
 		"Chest":        makeChestAspect,
 		"Dispenser":    makeDispenserAspect,
+		"Falling":      makeFallingAspect,
+		"Fluid":        makeFluidAspect,
 		"Furnace":      makeFurnaceAspect,
 		"MobSpawner":   makeMobSpawnerAspect,
 		"Music":        makeMusicAspect,
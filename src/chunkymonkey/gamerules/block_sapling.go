@@ -1,8 +1,8 @@
 package gamerules
 
 import (
+	"chunkymonkey/logger"
 	. "chunkymonkey/types"
-	"log"
 	"math/rand"
 )
 
@@ -31,55 +31,20 @@ func (aspect *SaplingAspect) Tick(instance *BlockInstance) bool {
 }
 
 func (aspect *SaplingAspect) makeTree(instance *BlockInstance) bool {
-	loc := instance.SubLoc
-	minheight := 3
-	maxheight := 6
-	height := minheight + rand.Intn(maxheight-minheight)
-	maxy := loc.Y + SubChunkCoord(height)
+	height := TreeMinHeight + rand.Intn(TreeMaxHeight-TreeMinHeight)
 
-	for y := loc.Y; y < maxy; y++ {
-		loc.Y = y
+	for _, block := range TreeBlocks(height) {
+		loc := SubChunkXyz{
+			X: instance.SubLoc.X + SubChunkCoord(block.Dx),
+			Y: instance.SubLoc.Y + SubChunkCoord(block.Dy),
+			Z: instance.SubLoc.Z + SubChunkCoord(block.Dz),
+		}
 		index, ok := loc.BlockIndex()
 		if !ok {
 			// TODO: Can't place a block outside chunk boundaries
-			log.Printf("Couldn't place a tree block (%v,%v,%v)", loc.X, loc.Y, loc.Z)
+			logger.World.Debug("Couldn't place a tree block", "block", loc)
 		} else {
-			instance.Chunk.SetBlockByIndex(index, BlockId(17), byte(0))
-		}
-	}
-
-	// Store the location at the top block of the tree
-	treex, treey, treez := int(loc.X), int(loc.Y), int(loc.Z)
-	cradius := height / 2
-
-	// Start one block above the tree and move down
-	for y := treey + 1; y >= treey-1; y-- {
-		var radius int
-
-		// Slightly round out the canopy
-		if y > treey {
-			radius = cradius - 1
-		} else if y == treey {
-			radius = cradius
-		} else if y < treey {
-			radius = cradius - 1
-		}
-
-		for x := treex - radius; x <= treex+radius; x++ {
-			for z := treez - radius; z <= treez+radius; z++ {
-				if y > treey || x != treex || z != treez {
-					loc.X = SubChunkCoord(x)
-					loc.Y = SubChunkCoord(y)
-					loc.Z = SubChunkCoord(z)
-					index, ok := loc.BlockIndex()
-					if !ok {
-						// TODO: Can't place a block outside chunk boundaries
-						log.Printf("Couldn't place a leaf block (%v,%v,%v)", loc.X, loc.Y, loc.Z)
-					} else {
-						instance.Chunk.SetBlockByIndex(index, BlockId(18), byte(0))
-					}
-				}
-			}
+			instance.Chunk.SetBlockByIndex(index, block.BlockId, byte(0))
 		}
 	}
 
@@ -2,9 +2,19 @@ package gamerules
 
 import (
 	"errors"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"chunkymonkey/proto"
+	. "chunkymonkey/types"
 	"nbt"
 )
 
+// signLineLength is the most characters that a line of a sign may have.
+const signLineLength = 15
+
 func makeSignAspect() (aspect IBlockAspect) {
 	return &SignAspect{}
 }
@@ -12,12 +22,34 @@ func makeSignAspect() (aspect IBlockAspect) {
 type signTileEntity struct {
 	tileEntity
 	text [4]string
+
+	// A sign that has just been placed may be written once, by the player who
+	// placed it.
+	unwritten bool
+	editor    EntityId
 }
 
 func NewSignTileEntity() ITileEntity {
 	return &signTileEntity{}
 }
 
+func newSignTileEntity(instance *BlockInstance) *signTileEntity {
+	sign := &signTileEntity{}
+	sign.chunk = instance.Chunk
+	sign.blockLoc = instance.BlockLoc
+	return sign
+}
+
+// Text returns the lines of text on the sign.
+func (sign *signTileEntity) Text() [4]string {
+	return sign.text
+}
+
+// SendUpdate implements ISentTileEntity.
+func (sign *signTileEntity) SendUpdate(writer io.Writer) error {
+	return proto.WriteSignUpdate(writer, &sign.blockLoc, sign.text)
+}
+
 func (sign *signTileEntity) UnmarshalNbt(tag *nbt.Compound) (err error) {
 	if err = sign.tileEntity.UnmarshalNbt(tag); err != nil {
 		return
@@ -68,4 +100,50 @@ func (aspect SignAspect) Name() string {
 	return "Sign"
 }
 
-// TODO behaviours for signs.
+// Placed readies a sign that the editor has just placed for them to write
+// its text with SetText.
+func (aspect *SignAspect) Placed(instance *BlockInstance, editor EntityId) {
+	sign := newSignTileEntity(instance)
+	sign.unwritten = true
+	sign.editor = editor
+	instance.Chunk.SetTileEntity(instance.Index, sign)
+}
+
+// SetText writes the text that the editor entered on the sign, after placing
+// it. Each sign can only be written once, by the player who placed it, so ok
+// is false if the sign has been written already or was placed by someone
+// else. Lines that are too long or have characters that clients can't show
+// are left blank. sign is the sign as it is afterwards, and is nil if it
+// wasn't placed by a player.
+func (aspect *SignAspect) SetText(instance *BlockInstance, editor EntityId, lines [4]string) (sign ISentTileEntity, ok bool) {
+	placed, isSign := instance.Chunk.TileEntity(instance.Index).(*signTileEntity)
+	if !isSign {
+		return nil, false
+	}
+	if !placed.unwritten || placed.editor != editor {
+		return placed, false
+	}
+
+	for i, line := range lines {
+		if validSignLine(line) {
+			placed.text[i] = line
+		}
+	}
+	placed.unwritten = false
+
+	return placed, true
+}
+
+// validSignLine returns true if the line fits on a sign, and only contains
+// printable characters. Color codes aren't allowed.
+func validSignLine(line string) bool {
+	if utf8.RuneCountInString(line) > signLineLength || strings.ContainsRune(line, '§') {
+		return false
+	}
+	for _, r := range line {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
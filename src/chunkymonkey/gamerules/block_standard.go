@@ -53,6 +53,10 @@ func (aspect *StandardAspect) Interact(instance *BlockInstance, player IPlayerCl
 func (aspect *StandardAspect) InventoryClick(instance *BlockInstance, player IPlayerClient, click *Click) {
 }
 
+func (aspect *StandardAspect) InventoryPutItem(instance *BlockInstance, player IPlayerClient, item *Slot) {
+	player.GiveItemAtPosition(instance.BlockLoc.MidPointToAbsXyz(), *item)
+}
+
 func (aspect *StandardAspect) InventoryUnsubscribed(instance *BlockInstance, player IPlayerClient) {
 }
 
@@ -8,6 +8,7 @@ type BlockAttrs struct {
 	id           BlockId
 	Name         string
 	Opacity      int8
+	Emission     int8 `json:",omitempty"` // The block light that the block gives off.
 	defined      bool
 	Destructable bool
 	Solid        bool
@@ -27,7 +28,7 @@ type BlockTypeList []BlockType
 // Get returns the requested BlockType by ID. ok = false if the block type does
 // not exist.
 func (btl *BlockTypeList) Get(id BlockId) (block *BlockType, ok bool) {
-	if id < 0 || int(id) > len(*btl) {
+	if id < 0 || int(id) >= len(*btl) {
 		ok = false
 		return
 	}
@@ -33,6 +33,10 @@ func (aspect *VoidAspect) Interact(instance *BlockInstance, player IPlayerClient
 func (aspect *VoidAspect) InventoryClick(instance *BlockInstance, player IPlayerClient, click *Click) {
 }
 
+func (aspect *VoidAspect) InventoryPutItem(instance *BlockInstance, player IPlayerClient, item *Slot) {
+	player.GiveItemAtPosition(instance.BlockLoc.MidPointToAbsXyz(), *item)
+}
+
 func (aspect *VoidAspect) InventoryUnsubscribed(instance *BlockInstance, player IPlayerClient) {
 }
 
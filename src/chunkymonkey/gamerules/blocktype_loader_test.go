@@ -2,6 +2,7 @@ package gamerules
 
 import (
 	"bytes"
+	"encoding/json"
 	"reflect"
 	"strings"
 	"testing"
@@ -187,6 +188,35 @@ func TestLoadSaveAndLoadBlockDefs(t *testing.T) {
 	}
 }
 
+// Test that saved blocks have the layout of the data files, with the
+// attributes of each block nested in BlockAttrs.
+func TestSaveBlockDefsLayout(t *testing.T) {
+	blocks, err := LoadBlockDefs(strings.NewReader(twoBlocks))
+	if err != nil {
+		t.Fatalf("Expected no error on load but got %v", err)
+	}
+	writer := &bytes.Buffer{}
+	if err = SaveBlockDefs(writer, blocks); err != nil {
+		t.Fatalf("Expected no error on write but got %v", err)
+	}
+
+	var saved map[string]struct {
+		Name       *string
+		BlockAttrs struct{ Name string }
+	}
+	if err = json.Unmarshal(writer.Bytes(), &saved); err != nil {
+		t.Fatal(err)
+	}
+	for id, name := range map[string]string{"0": "air", "1": "stone"} {
+		if saved[id].BlockAttrs.Name != name {
+			t.Errorf("Block %s: expected BlockAttrs with name %q, got %q", id, name, saved[id].BlockAttrs.Name)
+		}
+		if saved[id].Name != nil {
+			t.Errorf("Block %s: expected no attributes outside BlockAttrs", id)
+		}
+	}
+}
+
 func TestBadAspectArgFails(t *testing.T) {
 	reader := strings.NewReader(badAspect)
 	t.Log(badAspect)
@@ -0,0 +1,75 @@
+// Defines the damage dealt by players attacking entities.
+
+package gamerules
+
+import (
+	"math"
+
+	. "chunkymonkey/types"
+)
+
+const (
+	// FistDamage is the damage dealt when attacking with an empty hand, or
+	// with an item that isn't a weapon or tool.
+	FistDamage = Health(1)
+
+	// Speeds at which an attacked entity is knocked away from its attacker.
+	KnockbackH = AbsVelocityCoord(0.4)
+	KnockbackY = AbsVelocityCoord(0.4)
+)
+
+// itemDamage is the damage dealt by items that are better than a fist.
+var itemDamage = map[ItemTypeId]Health{
+	// Swords.
+	268: 4, // Wood
+	283: 4, // Gold
+	272: 5, // Stone
+	267: 6, // Iron
+	276: 7, // Diamond
+
+	// Axes.
+	271: 3, // Wood
+	286: 3, // Gold
+	275: 4, // Stone
+	258: 5, // Iron
+	279: 6, // Diamond
+
+	// Pickaxes.
+	270: 2, // Wood
+	285: 2, // Gold
+	274: 3, // Stone
+	257: 4, // Iron
+	278: 5, // Diamond
+
+	// Shovels.
+	273: 2, // Stone
+	256: 3, // Iron
+	277: 4, // Diamond
+}
+
+// AttackDamage returns the damage dealt by attacking with the slot's item.
+func (s *Slot) AttackDamage() Health {
+	if damage, ok := itemDamage[s.ItemTypeId]; ok && s.Count > 0 {
+		return damage
+	}
+	return FistDamage
+}
+
+// Knockback returns the velocity that an entity at target is given when hit
+// by an attacker at attacker. It points horizontally away from the attacker,
+// and upwards.
+func Knockback(attacker, target *AbsXyz) (knockback AbsVelocity) {
+	dx := float64(target.X - attacker.X)
+	dz := float64(target.Z - attacker.Z)
+	knockback.Y = KnockbackY
+
+	dist := math.Sqrt(dx*dx + dz*dz)
+	if dist < 1e-4 {
+		// No direction to push in.
+		return
+	}
+
+	knockback.X = AbsVelocityCoord(dx/dist) * KnockbackH
+	knockback.Z = AbsVelocityCoord(dz/dist) * KnockbackH
+	return
+}
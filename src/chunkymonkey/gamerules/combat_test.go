@@ -0,0 +1,62 @@
+package gamerules
+
+import (
+	"testing"
+
+	. "chunkymonkey/types"
+)
+
+func TestSlot_AttackDamage(t *testing.T) {
+	type Test struct {
+		slot     Slot
+		expected Health
+	}
+
+	var tests = []Test{
+		{Slot{}, FistDamage},
+		{Slot{ItemTypeId: 1, Count: 1}, FistDamage},
+		{Slot{ItemTypeId: 276, Count: 1}, 7},
+		{Slot{ItemTypeId: 271, Count: 1}, 3},
+		{Slot{ItemTypeId: 276, Count: 0}, FistDamage},
+	}
+
+	for _, test := range tests {
+		if result := test.slot.AttackDamage(); result != test.expected {
+			t.Errorf("%v.AttackDamage() expected %d got %d", test.slot, test.expected, result)
+		}
+	}
+}
+
+func TestKnockback(t *testing.T) {
+	type Test struct {
+		attacker, target AbsXyz
+		expected         AbsVelocity
+	}
+
+	var tests = []Test{
+		{AbsXyz{0, 64, 0}, AbsXyz{2, 64, 0}, AbsVelocity{KnockbackH, KnockbackY, 0}},
+		{AbsXyz{0, 64, 0}, AbsXyz{0, 70, -3}, AbsVelocity{0, KnockbackY, -KnockbackH}},
+		{AbsXyz{5, 64, 5}, AbsXyz{5, 65, 5}, AbsVelocity{0, KnockbackY, 0}},
+	}
+
+	for _, test := range tests {
+		if result := Knockback(&test.attacker, &test.target); result != test.expected {
+			t.Errorf("Knockback(%v, %v) expected %v got %v", test.attacker, test.target, test.expected, result)
+		}
+	}
+}
+
+func TestMob_Attacked(t *testing.T) {
+	pig := NewPig().(*Pig)
+	pig.PointObject.Init(&AbsXyz{0, 64, 0}, &AbsVelocity{})
+
+	if pig.Health() != PigType.MaxHealth {
+		t.Fatalf("Expected new pig to have %d health, got %d", PigType.MaxHealth, pig.Health())
+	}
+	if pig.Attacked(PigType.MaxHealth-1, &AbsVelocity{}) {
+		t.Errorf("Expected pig to survive")
+	}
+	if !pig.Attacked(1, &AbsVelocity{}) {
+		t.Errorf("Expected pig to be killed")
+	}
+}
@@ -53,6 +53,31 @@ type INonPlayerEntity interface {
 	Tick(physics.IBlockQuerier) (leftBlock bool)
 }
 
+// IAttackable is implemented by non-player entities that can be attacked by
+// players.
+type IAttackable interface {
+	// Attacked reduces the entity's health by damage and pushes it by
+	// knockback. It returns true if the entity was killed.
+	Attacked(damage Health, knockback *AbsVelocity) (killed bool)
+}
+
+// IInteractable is implemented by non-player entities that react to players
+// using them (right-clicking on them).
+type IInteractable interface {
+	// Interact is called when the player uses the entity while holding held.
+	Interact(player IPlayerClient, held *Slot, chunk IChunkBlock)
+}
+
+// ILandingEntity is implemented by non-player entities that act on coming to
+// rest on the ground, after which they are removed.
+type ILandingEntity interface {
+	// OnGround returns true once the entity has come to rest on the ground.
+	OnGround() bool
+
+	// Land is called by the chunk that the entity landed in.
+	Land(chunk IChunkBlock)
+}
+
 // ITileEntity is the interface common to entities that are tile-based.
 type ITileEntity interface {
 	INbtSerializable
@@ -65,3 +90,13 @@ type ITileEntity interface {
 	// Block returns the position of the tile entity.
 	Block() BlockXyz
 }
+
+// ISentTileEntity is implemented by tile entities that clients are told
+// about, such as signs, whose text is sent along with the chunk.
+type ISentTileEntity interface {
+	ITileEntity
+
+	// SendUpdate writes the packets required to tell a client about the tile
+	// entity.
+	SendUpdate(io.Writer) error
+}
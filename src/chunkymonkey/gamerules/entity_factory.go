@@ -26,8 +26,8 @@ var EntityCreateByName = map[string]func() INonPlayerEntity{
 	"Arrow":          NewArrow,
 	"ThrownSnowball": NewThrownSnowball,
 	"ThrownEgg":      NewThrownEgg,
-	"FallingSand":    NewFallingSand,
-	"FallingGravel":  NewFallingGravel,
+	"FallingSand":    NewBlankFallingBlock,
+	"FallingGravel":  NewBlankFallingBlock,
 	"FishingFloat":   NewFishingFloat,
 }
 
@@ -0,0 +1,75 @@
+package gamerules
+
+import (
+	"errors"
+
+	. "chunkymonkey/types"
+	"nbt"
+)
+
+// FallingBlock is a block, such as sand, that is falling after losing the
+// block beneath it. It becomes a block again where it lands, or drops as an
+// item if something else is in the way.
+type FallingBlock struct {
+	Object
+	BlockId BlockId
+}
+
+func NewBlankFallingBlock() INonPlayerEntity {
+	return &FallingBlock{Object: *NewObject(ObjTypeIdFallingSand)}
+}
+
+func NewFallingBlock(blockId BlockId, position *AbsXyz) (block *FallingBlock) {
+	block = &FallingBlock{
+		Object:  *NewObject(fallingObjType(blockId)),
+		BlockId: blockId,
+	}
+	block.PointObject.Init(position, &AbsVelocity{0, 0, 0})
+	return
+}
+
+// fallingObjType returns the type of object that clients are shown for the
+// block while it falls.
+func fallingObjType(blockId BlockId) ObjTypeId {
+	if blockType, ok := Blocks.Get(blockId); ok {
+		if aspect, ok := blockType.Aspect.(*FallingAspect); ok && aspect.ObjType != 0 {
+			return aspect.ObjType
+		}
+	}
+	return ObjTypeIdFallingSand
+}
+
+func (block *FallingBlock) UnmarshalNbt(tag *nbt.Compound) (err error) {
+	if err = block.PointObject.UnmarshalNbt(tag); err != nil {
+		return
+	}
+
+	tile, ok := tag.Lookup("Tile").(*nbt.Byte)
+	if !ok {
+		return errors.New("missing falling block tile")
+	}
+	block.BlockId = BlockId(uint8(tile.Value))
+	block.ObjTypeId = fallingObjType(block.BlockId)
+
+	return
+}
+
+func (block *FallingBlock) MarshalNbt(tag *nbt.Compound) (err error) {
+	if err = block.PointObject.MarshalNbt(tag); err != nil {
+		return
+	}
+	tag.Set("id", &nbt.String{"FallingSand"})
+	tag.Set("Tile", &nbt.Byte{int8(block.BlockId)})
+	return
+}
+
+// Land implements ILandingEntity.
+func (block *FallingBlock) Land(chunk IChunkBlock) {
+	loc := block.Position().ToBlockXyz()
+	if blockType, ok := blockTypeAt(chunk, loc); ok && blockType.Replaceable {
+		if chunk.SetBlockAt(loc, block.BlockId, 0) {
+			return
+		}
+	}
+	spawnItemInBlock(chunk, *loc, ItemTypeId(block.BlockId), 1, 0)
+}
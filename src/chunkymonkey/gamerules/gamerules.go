@@ -13,6 +13,10 @@ var (
 	// TODO: Commands should maybe be accessible via IGame.
 	CommandFramework ICommandFramework
 	Permissions      permission.IPermissions
+	Ops              *permission.OpList
+	Whitelist        *permission.NameList
+	BannedPlayers    *permission.BanList
+	BannedIps        *permission.BanList
 )
 
 func LoadGameRules(blocksDefFile, itemsDefFile, recipesDefFile, furnaceDefFile, userDefFile, groupDefFile string) (err error) {
@@ -53,3 +57,26 @@ func LoadGameRules(blocksDefFile, itemsDefFile, recipesDefFile, furnaceDefFile,
 
 	return
 }
+
+// LoadOps loads the operator list, whose operators are given every permission
+// on top of the Permissions loaded by LoadGameRules.
+func LoadOps(opsFile string) (err error) {
+	if Ops, err = permission.LoadOpList(opsFile); err != nil {
+		return
+	}
+	Permissions = &permission.OpPermissions{Permissions: Permissions, Ops: Ops}
+	return
+}
+
+// LoadAccessLists loads the whitelist and the lists of banned players and IP
+// addresses, which are checked when players log in.
+func LoadAccessLists(whitelistFile, bannedPlayersFile, bannedIpsFile string) (err error) {
+	if Whitelist, err = permission.LoadNameList(whitelistFile); err != nil {
+		return
+	}
+	if BannedPlayers, err = permission.LoadBanList(bannedPlayersFile); err != nil {
+		return
+	}
+	BannedIps, err = permission.LoadIpBanList(bannedIpsFile)
+	return
+}
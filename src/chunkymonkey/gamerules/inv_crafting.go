@@ -48,32 +48,59 @@ func NewWorkbenchInventory() *CraftingInventory {
 func (inv *CraftingInventory) Click(click *Click) (txState TxState) {
 	if click.SlotId == 0 {
 		// Player may only *take* the *whole* stack from the output slot.
+		hadOutput := !inv.slots[0].IsEmpty()
 		txState = inv.Inventory.TakeOnlyClick(click)
-	} else {
-		// Player may interact with the input slots like any other slot.
-		txState = inv.Inventory.Click(click)
-	}
-
-	if txState == TxStateRejected {
-		return
-	}
+		if txState == TxStateRejected || !hadOutput || !inv.slots[0].IsEmpty() {
+			// Nothing was taken, perhaps as the cursor holds something else.
+			return
+		}
 
-	if click.SlotId == 0 {
 		// Player took items from the output slot. Subtract 1 count from each
 		// non-empty input slot.
 		for i := 1; i < len(inv.slots); i++ {
 			inv.slots[i].Decrement()
 			inv.slotUpdate(&inv.slots[i], SlotId(i))
 		}
+	} else {
+		// Player may interact with the input slots like any other slot.
+		txState = inv.Inventory.Click(click)
+		if txState == TxStateRejected {
+			return
+		}
 	}
 
-	// Match recipe and set output slot.
-	inv.slots[0] = inv.recipes.Match(inv.width, inv.height, inv.slots[1:])
-	inv.slotUpdate(&inv.slots[0], 0)
+	inv.matchRecipe()
 
 	return
 }
 
+// ShiftClick takes the whole stack from an input slot. Shift-clicking the
+// output slot isn't supported, as it would craft as many items as possible.
+func (inv *CraftingInventory) ShiftClick(click *Click) (taken Slot, txState TxState) {
+	if click.SlotId == 0 {
+		return taken, TxStateRejected
+	}
+
+	taken, txState = inv.Inventory.ShiftClick(click)
+	if txState != TxStateRejected {
+		inv.matchRecipe()
+	}
+
+	return
+}
+
+// PutItem puts nothing into the crafting grid, which is only filled by hand.
+func (inv *CraftingInventory) PutItem(item *Slot) (changed bool) {
+	return false
+}
+
+// matchRecipe sets the output slot to the result of the recipe matching the
+// input slots, if any.
+func (inv *CraftingInventory) matchRecipe() {
+	inv.slots[0] = inv.recipes.Match(inv.width, inv.height, inv.slots[1:])
+	inv.slotUpdate(&inv.slots[0], 0)
+}
+
 // TakeAllItems empties the inventory, and returns all items that were inside
 // it inside a slice of Slots.
 func (inv *CraftingInventory) TakeAllItems() (items []Slot) {
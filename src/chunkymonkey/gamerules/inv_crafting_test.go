@@ -0,0 +1,54 @@
+package gamerules
+
+import (
+	"strings"
+	"testing"
+
+	. "chunkymonkey/types"
+)
+
+func newTestWorkbench(t *testing.T) *CraftingInventory {
+	recipes, err := LoadRecipes(strings.NewReader(threeRecipes), createItemTypes())
+	if err != nil {
+		t.Fatalf("Failed to load recipes: %v", err)
+	}
+
+	inv := new(CraftingInventory)
+	inv.Inventory.Init(1 + workbenchInvCraftWidth*workbenchInvCraftHeight)
+	inv.width, inv.height = workbenchInvCraftWidth, workbenchInvCraftHeight
+	inv.recipes.Init(recipes)
+	return inv
+}
+
+func TestCraftingInventory_TakeOutput(t *testing.T) {
+	inv := newTestWorkbench(t)
+
+	// Put two logs into the grid.
+	click := Click{SlotId: 5, Cursor: Slot{17, 2, 0}}
+	checkTx(t, TxStateAccepted, inv.Click(&click))
+	checkSlot(t, Slot{5, 4, 0}, inv.slots[0])
+
+	// The output can't be taken with something else on the cursor, and the
+	// logs aren't used up.
+	click = Click{SlotId: 0, Cursor: Slot{265, 1, 0}, ExpectedSlot: Slot{5, 4, 0}}
+	inv.Click(&click)
+	checkSlot(t, Slot{265, 1, 0}, click.Cursor)
+	checkSlot(t, Slot{17, 2, 0}, inv.slots[5])
+
+	// Taking the output uses up one log, and the next planks are ready.
+	click = Click{SlotId: 0, ExpectedSlot: Slot{5, 4, 0}}
+	checkTx(t, TxStateAccepted, inv.Click(&click))
+	checkSlot(t, Slot{5, 4, 0}, click.Cursor)
+	checkSlot(t, Slot{17, 1, 0}, inv.slots[5])
+	checkSlot(t, Slot{5, 4, 0}, inv.slots[0])
+
+	// Clicking the empty output slot uses nothing up.
+	click = Click{SlotId: 5, ExpectedSlot: Slot{17, 1, 0}}
+	inv.Click(&click)
+	checkSlot(t, emptySlot, inv.slots[0])
+	click = Click{SlotId: 5, Cursor: Slot{265, 1, 0}}
+	inv.Click(&click)
+	click = Click{SlotId: 0}
+	inv.Click(&click)
+	checkSlot(t, Slot{265, 1, 0}, inv.slots[5])
+}
@@ -53,10 +53,14 @@ func (inv *FurnaceInventory) UnmarshalNbt(tag *nbt.Compound) (err error) {
 		inv.burnTimeMax = inv.burnTime
 	}
 
+	// CookTime is stored as the time that the current reaction has been running
+	// for, rather than the time it has left to run.
 	if cookTimeTag, ok := tag.Lookup("CookTime").(*nbt.Short); !ok {
 		return errors.New("Bad or missing CookTime tag in Furnace NBT")
+	} else if cookTime := Ticks(cookTimeTag.Value); cookTime < 0 || cookTime > reactionDuration {
+		inv.cookTime = reactionDuration
 	} else {
-		inv.cookTime = Ticks(cookTimeTag.Value)
+		inv.cookTime = reactionDuration - cookTime
 	}
 
 	return nil
@@ -65,7 +69,7 @@ func (inv *FurnaceInventory) UnmarshalNbt(tag *nbt.Compound) (err error) {
 func (inv *FurnaceInventory) MarshalNbt(tag *nbt.Compound) (err error) {
 	tag.Set("id", &nbt.String{"Furnace"})
 	tag.Set("BurnTime", &nbt.Short{int16(inv.burnTime)})
-	tag.Set("CookTime", &nbt.Short{int16(inv.cookTime)})
+	tag.Set("CookTime", &nbt.Short{int16(reactionDuration - inv.cookTime)})
 	return inv.Inventory.MarshalNbt(tag)
 }
 
@@ -101,6 +105,43 @@ func (inv *FurnaceInventory) Click(click *Click) (txState TxState) {
 	return
 }
 
+// ShiftClick takes the whole stack from the clicked slot.
+func (inv *FurnaceInventory) ShiftClick(click *Click) (taken Slot, txState TxState) {
+	taken, txState = inv.Inventory.ShiftClick(click)
+
+	if txState == TxStateAccepted && click.SlotId == furnaceSlotReagent && !taken.IsEmpty() {
+		inv.cookTime = reactionDuration
+	}
+
+	inv.stateCheck()
+
+	inv.sendProgressUpdates()
+
+	return
+}
+
+// PutItem puts items that can be smelted into the reagent slot, and fuel into
+// the fuel slot. Anything else is left where it is.
+func (inv *FurnaceInventory) PutItem(item *Slot) (changed bool) {
+	var slotId SlotId
+	if _, ok := FurnaceReactions.Reactions[item.ItemTypeId]; ok {
+		slotId = furnaceSlotReagent
+	} else if _, ok := FurnaceReactions.Fuels[item.ItemTypeId]; ok {
+		slotId = furnaceSlotFuel
+	} else {
+		return false
+	}
+
+	slot := &inv.slots[slotId]
+	if changed = slot.Add(item); changed {
+		inv.slotUpdate(slot, slotId)
+		inv.stateCheck()
+		inv.sendProgressUpdates()
+	}
+
+	return
+}
+
 func (inv *FurnaceInventory) stateCheck() {
 	reagentSlot := &inv.slots[furnaceSlotReagent]
 	fuelSlot := &inv.slots[furnaceSlotFuel]
@@ -183,16 +224,12 @@ func (inv *FurnaceInventory) sendProgressUpdates() {
 	if inv.ticksSinceUpdate > 5 || !inv.IsLit() {
 		inv.ticksSinceUpdate = 0
 
-		curFuelPrg := PrgBarValue(0)
-		if inv.burnTimeMax != 0 {
-			curFuelPrg = PrgBarValue((maxFuelPrg * inv.burnTime) / inv.burnTimeMax)
-		}
+		curFuelPrg, curReactionRemaining := inv.progress()
 		if inv.lastCurFuel != curFuelPrg {
 			inv.lastCurFuel = curFuelPrg
 			inv.subscriber.ProgressUpdate(PrgBarIdFurnaceFire, curFuelPrg)
 		}
 
-		curReactionRemaining := PrgBarValue(reactionDuration - inv.cookTime)
 		if inv.lastReactionRemaining != curReactionRemaining {
 			inv.lastReactionRemaining = curReactionRemaining
 			inv.subscriber.ProgressUpdate(PrgBarIdFurnaceProgress, curReactionRemaining)
@@ -200,6 +237,27 @@ func (inv *FurnaceInventory) sendProgressUpdates() {
 	}
 }
 
+// SendProgress sends the current state of both progress bars to the
+// subscriber, such as when a player opens the furnace window.
+func (inv *FurnaceInventory) SendProgress() {
+	if inv.subscriber == nil {
+		return
+	}
+
+	inv.lastCurFuel, inv.lastReactionRemaining = inv.progress()
+	inv.subscriber.ProgressUpdate(PrgBarIdFurnaceFire, inv.lastCurFuel)
+	inv.subscriber.ProgressUpdate(PrgBarIdFurnaceProgress, inv.lastReactionRemaining)
+}
+
+// progress returns the values of the fuel and reaction progress bars.
+func (inv *FurnaceInventory) progress() (curFuelPrg, curReactionRemaining PrgBarValue) {
+	if inv.burnTimeMax != 0 {
+		curFuelPrg = PrgBarValue((maxFuelPrg * inv.burnTime) / inv.burnTimeMax)
+	}
+	curReactionRemaining = PrgBarValue(reactionDuration - inv.cookTime)
+	return
+}
+
 func (inv *FurnaceInventory) IsLit() bool {
 	return inv.burnTime > 0
 }
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	. "chunkymonkey/types"
+	"nbt"
 )
 
 const (
@@ -192,3 +193,80 @@ func Test_FurnaceBurnsMultipleFuel(t *testing.T) {
 	runner.runUntil(plankFuelTime * 2)
 	checkLit(t, furnace, false)
 }
+
+func Test_FurnaceNbtRoundTrip(t *testing.T) {
+	furnace, runner := loadedFurnace(t, 2, 2)
+	runner.runFor(50)
+
+	tag := nbt.NewCompound()
+	if err := furnace.MarshalNbt(tag); err != nil {
+		t.Fatal(err)
+	}
+	if cookTime := tag.Lookup("CookTime").(*nbt.Short).Value; cookTime != 50 {
+		t.Errorf("Expected CookTime=50, got %d", cookTime)
+	}
+
+	loaded := NewFurnaceInventory()
+	if err := loaded.UnmarshalNbt(tag); err != nil {
+		t.Fatal(err)
+	}
+	checkLit(t, loaded, true)
+	checkSlot(t, furnace.slots[furnaceSlotFuel], loaded.slots[furnaceSlotFuel])
+	checkSlot(t, furnace.slots[furnaceSlotReagent], loaded.slots[furnaceSlotReagent])
+
+	// The loaded furnace carries on with the reaction where it left off.
+	runner.furnace = loaded
+	runner.runUntil(reactionDuration - 1)
+	checkSlot(t, emptySlot, loaded.slots[furnaceSlotOutput])
+	runner.runFor(1)
+	checkSlot(t, Slot{ironIngotId, 1, 0}, loaded.slots[furnaceSlotOutput])
+}
+
+type progressRecorder map[PrgBarId]PrgBarValue
+
+func (r progressRecorder) SlotUpdate(slot *Slot, slotId SlotId) {}
+
+func (r progressRecorder) ProgressUpdate(prgBarId PrgBarId, value PrgBarValue) {
+	r[prgBarId] = value
+}
+
+func Test_FurnaceSendProgress(t *testing.T) {
+	furnace, runner := loadedFurnace(t, 1, 1)
+	runner.runFor(100)
+
+	progress := make(progressRecorder)
+	furnace.SetSubscriber(progress)
+	furnace.SendProgress()
+
+	if value := progress[PrgBarIdFurnaceProgress]; value != 100 {
+		t.Errorf("Expected reaction progress=100, got %d", value)
+	}
+	expectedFuel := PrgBarValue(maxFuelPrg * (plankFuelTime - 100) / plankFuelTime)
+	if value := progress[PrgBarIdFurnaceFire]; value != expectedFuel {
+		t.Errorf("Expected fuel progress=%d, got %d", expectedFuel, value)
+	}
+}
+
+func Test_FurnacePutItem(t *testing.T) {
+	furnace := NewFurnaceInventory()
+
+	// Items that are neither fuel nor can be smelted are refused.
+	item := Slot{ironIngotId, 1, 0}
+	if furnace.PutItem(&item) {
+		t.Errorf("Expected furnace to refuse %v", item)
+	}
+	checkSlot(t, Slot{ironIngotId, 1, 0}, item)
+
+	item = Slot{ironOreId, 2, 0}
+	furnace.PutItem(&item)
+	checkSlot(t, emptySlot, item)
+	checkSlot(t, Slot{ironOreId, 2, 0}, furnace.slots[furnaceSlotReagent])
+	checkLit(t, furnace, false)
+
+	// Adding fuel lights the furnace.
+	item = Slot{plankId, 2, 0}
+	furnace.PutItem(&item)
+	checkSlot(t, emptySlot, item)
+	checkSlot(t, Slot{plankId, 1, 0}, furnace.slots[furnaceSlotFuel])
+	checkLit(t, furnace, true)
+}
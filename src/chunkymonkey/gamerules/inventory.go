@@ -20,6 +20,8 @@ type IInventorySubscriber interface {
 type IInventory interface {
 	NumSlots() SlotId
 	Click(click *Click) (txState TxState)
+	ShiftClick(click *Click) (taken Slot, txState TxState)
+	PutItem(item *Slot) (changed bool)
 	SetSubscriber(subscriber IInventorySubscriber)
 	MakeProtoSlots() []proto.WindowSlot
 	WriteProtoSlots(slots []proto.WindowSlot)
@@ -29,6 +31,16 @@ type IInventory interface {
 	SlotUnmarshalNbt(tag *nbt.Compound, slotId SlotId) (err error)
 }
 
+// IProgressInventory is implemented by inventories that have progress bars,
+// such as furnaces.
+type IProgressInventory interface {
+	IInventory
+
+	// SendProgress sends the current value of every progress bar to the
+	// subscriber.
+	SendProgress()
+}
+
 type Click struct {
 	SlotId       SlotId
 	Cursor       Slot
@@ -61,7 +73,7 @@ func (inv *Inventory) SetSubscriber(subscriber IInventorySubscriber) {
 // Click takes the default actions upon a click event from a player. The Cursor
 // attribute of click may be modified to represent the cursors new contents.
 func (inv *Inventory) Click(click *Click) TxState {
-	if click.SlotId < 0 || int(click.SlotId) > len(inv.slots) {
+	if click.SlotId < 0 || int(click.SlotId) >= len(inv.slots) {
 		return TxStateRejected
 	}
 
@@ -104,7 +116,7 @@ func (inv *Inventory) Click(click *Click) TxState {
 // items are taken at all. This is intended for use by crafting/furnace output
 // slots.
 func (inv *Inventory) TakeOnlyClick(click *Click) TxState {
-	if click.SlotId < 0 || int(click.SlotId) > len(inv.slots) {
+	if click.SlotId < 0 || int(click.SlotId) >= len(inv.slots) {
 		return TxStateRejected
 	}
 
@@ -124,6 +136,26 @@ func (inv *Inventory) TakeOnlyClick(click *Click) TxState {
 	return TxStateAccepted
 }
 
+// ShiftClick takes the whole stack from the clicked slot, so that the window
+// can move it into another inventory. The cursor is left alone.
+func (inv *Inventory) ShiftClick(click *Click) (taken Slot, txState TxState) {
+	if click.SlotId < 0 || int(click.SlotId) >= len(inv.slots) {
+		return taken, TxStateRejected
+	}
+
+	clickedSlot := &inv.slots[click.SlotId]
+
+	if !click.ExpectedSlot.Equals(clickedSlot) {
+		return taken, TxStateRejected
+	}
+
+	if taken.Swap(clickedSlot) {
+		inv.slotUpdate(clickedSlot, click.SlotId)
+	}
+
+	return taken, TxStateAccepted
+}
+
 func (inv *Inventory) Slot(slotId SlotId) Slot {
 	return inv.slots[slotId]
 }
@@ -135,21 +167,81 @@ func (inv *Inventory) TakeOneItem(slotId SlotId, into *Slot) {
 	}
 }
 
-// PutItem attempts to put the given item into the inventory.
-func (inv *Inventory) PutItem(item *Slot) {
+// PutItem attempts to put the given item into the inventory. It fills partial
+// stacks of the same item before using empty slots.
+func (inv *Inventory) PutItem(item *Slot) (changed bool) {
+	changed = inv.AddToStacks(item)
+	if inv.AddToEmpty(item) {
+		changed = true
+	}
+	return
+}
+
+// AddToStacks adds as much of the item as possible to slots that already hold
+// items of the same type.
+func (inv *Inventory) AddToStacks(item *Slot) (changed bool) {
 	// TODO optimize this algorithm, maybe by maintaining a map of non-full
-	// slots containing an item of various item type IDs. Additionally, it
-	// should prefer to put stackable items into stacks of the same type,
-	// rather than in empty slots.
+	// slots containing an item of various item type IDs.
+	for slotIndex := range inv.slots {
+		if item.Count <= 0 {
+			break
+		}
+		slot := &inv.slots[slotIndex]
+		if !slot.IsEmpty() && slot.Add(item) {
+			changed = true
+			inv.slotUpdate(slot, SlotId(slotIndex))
+		}
+	}
+	return
+}
+
+// AddToEmpty puts as much of the item as possible into empty slots.
+func (inv *Inventory) AddToEmpty(item *Slot) (changed bool) {
 	for slotIndex := range inv.slots {
 		if item.Count <= 0 {
 			break
 		}
 		slot := &inv.slots[slotIndex]
-		if slot.Add(item) {
+		if slot.IsEmpty() && slot.Add(item) {
+			changed = true
 			inv.slotUpdate(slot, SlotId(slotIndex))
 		}
 	}
+	return
+}
+
+// RemoveFromSlot takes up to count items from the slot, and returns them.
+func (inv *Inventory) RemoveFromSlot(slotId SlotId, count ItemCount) (removed Slot) {
+	if slotId < 0 || int(slotId) >= len(inv.slots) || count <= 0 {
+		return
+	}
+
+	slot := &inv.slots[slotId]
+	if slot.IsEmpty() {
+		return
+	}
+	if count > slot.Count {
+		count = slot.Count
+	}
+
+	removed = Slot{slot.ItemTypeId, count, slot.Data}
+	slot.setCount(slot.Count - count)
+	inv.slotUpdate(slot, slotId)
+
+	return
+}
+
+// SwapSlot swaps the contents of the slot with other.
+func (inv *Inventory) SwapSlot(slotId SlotId, other *Slot) (changed bool) {
+	if slotId < 0 || int(slotId) >= len(inv.slots) {
+		return
+	}
+
+	slot := &inv.slots[slotId]
+	if changed = slot.Swap(other); changed {
+		inv.slotUpdate(slot, slotId)
+	}
+	return
 }
 
 // CanTakeItem returns true if it can take at least one item from the passed
@@ -229,11 +321,11 @@ func (inv *Inventory) UnmarshalNbt(tag *nbt.Compound) (err error) {
 			return errors.New("inventory slot not a compound")
 		}
 
-		var slotIdTag *nbt.Byte
-		if slotIdTag, ok = slotTag.Lookup("Slot").(*nbt.Byte); !ok {
+		slotIdValue, ok := nbt.GetByte(slotTag, "Slot")
+		if !ok {
 			return errors.New("Slot ID not a byte")
 		}
-		slotId := SlotId(slotIdTag.Value)
+		slotId := SlotId(slotIdValue)
 
 		if err = inv.SlotUnmarshalNbt(slotTag, slotId); err != nil {
 			return
@@ -2,6 +2,8 @@ package gamerules
 
 import (
 	"testing"
+
+	. "chunkymonkey/types"
 )
 
 func TestInventory_Init(t *testing.T) {
@@ -14,3 +16,107 @@ func TestInventory_Init(t *testing.T) {
 		}
 	}
 }
+
+func TestInventory_PutItem(t *testing.T) {
+	Items = make(ItemTypeMap)
+	apple := ItemTypeId(1)
+	orange := ItemTypeId(2)
+
+	makeItemType(apple)
+	makeItemType(orange)
+
+	var inv Inventory
+	inv.Init(4)
+	inv.slots[1] = Slot{orange, 10, 0}
+	inv.slots[2] = Slot{apple, 60, 0}
+	inv.slots[3] = Slot{apple, 10, 0}
+
+	item := Slot{apple, 60, 0}
+	if !inv.PutItem(&item) {
+		t.Errorf("PutItem reported no change")
+	}
+
+	expected := []Slot{{apple, 2, 0}, {orange, 10, 0}, {apple, 64, 0}, {apple, 64, 0}}
+	for i := range expected {
+		if !slotEq(&expected[i], &inv.slots[i]) {
+			t.Errorf("slot %d expected %+v got %+v", i, expected[i], inv.slots[i])
+		}
+	}
+	if !item.IsEmpty() {
+		t.Errorf("item not consumed: %+v", item)
+	}
+}
+
+func TestInventory_RemoveFromSlot(t *testing.T) {
+	Items = make(ItemTypeMap)
+	apple := ItemTypeId(1)
+	makeItemType(apple)
+
+	type Test struct {
+		slotId          SlotId
+		count           ItemCount
+		expectedRemoved Slot
+		expectedLeft    Slot
+	}
+
+	var tests = []Test{
+		{0, 3, Slot{apple, 3, 5}, Slot{apple, 7, 5}},
+		{0, 20, Slot{apple, 10, 5}, Slot{}},
+		{0, 0, Slot{}, Slot{apple, 10, 5}},
+		{1, 1, Slot{}, Slot{}},
+		{2, 1, Slot{}, Slot{}},
+	}
+
+	for _, r := range tests {
+		var inv Inventory
+		inv.Init(2)
+		inv.slots[0] = Slot{apple, 10, 5}
+
+		removed := inv.RemoveFromSlot(r.slotId, r.count)
+		if !slotEq(&r.expectedRemoved, &removed) {
+			t.Errorf("RemoveFromSlot(%d, %d) expected %+v got %+v", r.slotId, r.count, r.expectedRemoved, removed)
+		}
+		if r.slotId == 0 && !slotEq(&r.expectedLeft, &inv.slots[0]) {
+			t.Errorf("RemoveFromSlot(%d, %d) expected %+v left got %+v", r.slotId, r.count, r.expectedLeft, inv.slots[0])
+		}
+	}
+}
+
+func TestInventory_ShiftClick(t *testing.T) {
+	Items = make(ItemTypeMap)
+	apple := ItemTypeId(1)
+	makeItemType(apple)
+
+	type Test struct {
+		slotId        SlotId
+		expectedSlot  Slot
+		expectedState TxState
+		expectedTaken Slot
+	}
+
+	var tests = []Test{
+		{0, Slot{apple, 10, 5}, TxStateAccepted, Slot{apple, 10, 5}},
+		{1, Slot{}, TxStateAccepted, Slot{}},
+		{0, Slot{apple, 9, 5}, TxStateRejected, Slot{}},
+		{2, Slot{}, TxStateRejected, Slot{}},
+		{-1, Slot{}, TxStateRejected, Slot{}},
+	}
+
+	for _, r := range tests {
+		var inv Inventory
+		inv.Init(2)
+		inv.slots[0] = Slot{apple, 10, 5}
+
+		click := Click{SlotId: r.slotId, ExpectedSlot: r.expectedSlot}
+		taken, txState := inv.ShiftClick(&click)
+		if txState != r.expectedState {
+			t.Errorf("ShiftClick(%d) expected tx state %v got %v", r.slotId, r.expectedState, txState)
+		}
+		if !slotEq(&r.expectedTaken, &taken) {
+			t.Errorf("ShiftClick(%d) expected %+v taken got %+v", r.slotId, r.expectedTaken, taken)
+		}
+		if r.slotId == 0 && txState == TxStateAccepted && !inv.slots[0].IsEmpty() {
+			t.Errorf("ShiftClick(%d) left %+v", r.slotId, inv.slots[0])
+		}
+	}
+}
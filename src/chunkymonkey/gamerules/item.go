@@ -66,7 +66,7 @@ func (item *Item) MarshalNbt(tag *nbt.Compound) (err error) {
 		return
 	}
 	tag.Set("id", &nbt.String{"Item"})
-	tag.Set("Item", &nbt.Compound{map[string]nbt.ITag{
+	tag.Set("Item", &nbt.Compound{Tags: map[string]nbt.ITag{
 		"id":     &nbt.Short{int16(item.ItemTypeId)},
 		"Count":  &nbt.Byte{int8(item.Count)},
 		"Damage": &nbt.Short{int16(item.Data)},
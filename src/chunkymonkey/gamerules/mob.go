@@ -27,17 +27,39 @@ type Mob struct {
 	physics.PointObject
 	mobType EntityMobType
 	look    LookDegrees
-	// TODO(nictuku): Move to a more structured form.
-	metadata map[byte]byte
+	health  Health
+	// metadata is sent in full with the spawn packet, and changes are sent
+	// with updates.
+	metadata proto.Metadata
 	// TODO: Change to an AABB object when we have that.
 }
 
+// Indices of mob metadata entries.
+const (
+	mobMetadataFlags = 0  // byte of mobFlag* bits
+	mobMetadata16    = 16 // byte with a meaning depending on the mob type
+	mobMetadata17    = 17 // byte with a meaning depending on the mob type
+	mobMetadata18    = 18 // byte with a meaning depending on the mob type
+)
+
+// Bits of the mobMetadataFlags entry.
+const (
+	mobFlagBurning = 0x01
+)
+
+// IMob is implemented by every kind of mob, through the Mob that it embeds.
+type IMob interface {
+	INonPlayerEntity
+	GetMob() *Mob
+}
+
 func (mob *Mob) Init(id EntityMobType) {
 	mob.mobType = id
-	mob.metadata = map[byte]byte{
-		0:  byte(0),
-		16: byte(0),
+	if mobType, ok := Mobs[id]; ok {
+		mob.health = mobType.MaxHealth
 	}
+	mob.metadata.SetByte(mobMetadataFlags, 0)
+	mob.metadata.SetByte(mobMetadata16, 0)
 
 	expVarMobSpawnCount.Add(1)
 }
@@ -57,9 +79,13 @@ func (mob *Mob) UnmarshalNbt(tag *nbt.Compound) (err error) {
 	_ = tag.Lookup("DeathTime").(*nbt.Short).Value
 	_ = tag.Lookup("FallDistance").(*nbt.Float).Value
 	_ = tag.Lookup("Fire").(*nbt.Short).Value
-	_ = tag.Lookup("Health").(*nbt.Short).Value
 	_ = tag.Lookup("HurtTime").(*nbt.Short).Value
 
+	// Mobs were once saved with zero health, so those keep their full health.
+	if health := Health(tag.Lookup("Health").(*nbt.Short).Value); health > 0 {
+		mob.health = health
+	}
+
 	return nil
 }
 
@@ -82,20 +108,62 @@ func (mob *Mob) MarshalNbt(tag *nbt.Compound) (err error) {
 	tag.Set("DeathTime", &nbt.Short{0})
 	tag.Set("FallDistance", &nbt.Float{0})
 	tag.Set("Fire", &nbt.Short{0})
-	tag.Set("Health", &nbt.Short{0})
+	tag.Set("Health", &nbt.Short{int16(mob.health)})
 	tag.Set("HurtTime", &nbt.Short{0})
 	return nil
 }
 
+// GetMob returns the mob, for use through IMob by the kinds of mob that
+// embed it.
+func (mob *Mob) GetMob() *Mob {
+	return mob
+}
+
+// MobType returns the type of the mob.
+func (mob *Mob) MobType() EntityMobType {
+	return mob.mobType
+}
+
+// Category returns the category of the mob's type.
+func (mob *Mob) Category() MobCategory {
+	if mobType, ok := Mobs[mob.mobType]; ok {
+		return mobType.Category
+	}
+	return MobHostile
+}
+
 func (mob *Mob) SetLook(look LookDegrees) {
 	mob.look = look
 }
 
 func (mob *Mob) SetBurning(burn bool) {
+	flags, _ := mob.metadata.Byte(mobMetadataFlags)
 	if burn {
-		mob.metadata[0] |= 0x01
+		flags |= mobFlagBurning
 	} else {
-		mob.metadata[0] ^= 0x01
+		flags &^= mobFlagBurning
+	}
+	mob.metadata.SetByte(mobMetadataFlags, flags)
+}
+
+// Health returns the mob's remaining health.
+func (mob *Mob) Health() Health {
+	return mob.health
+}
+
+func (mob *Mob) Attacked(damage Health, knockback *AbsVelocity) (killed bool) {
+	mob.health -= damage
+	if mob.health <= 0 {
+		mob.health = 0
+		return true
+	}
+	mob.PointObject.Push(knockback)
+	return false
+}
+
+func (mob *Mob) Interact(player IPlayerClient, held *Slot, chunk IChunkBlock) {
+	if interact, ok := mobInteractions[mob.mobType]; ok {
+		interact(mob, player, held, chunk)
 	}
 }
 
@@ -104,14 +172,9 @@ func (mob *Mob) Tick(blockQuerier physics.IBlockQuerier) (leftBlock bool) {
 	return mob.PointObject.Tick(blockQuerier)
 }
 
+// FormatMetadata returns all of the mob's metadata, as sent when it spawns.
 func (mob *Mob) FormatMetadata() []proto.EntityMetadata {
-	x := make([]proto.EntityMetadata, len(mob.metadata))
-	i := 0
-	for k, v := range mob.metadata {
-		x[i] = proto.EntityMetadata{0, k, v}
-		i++
-	}
-	return x
+	return mob.metadata.Entries()
 }
 
 func (mob *Mob) SendUpdate(writer io.Writer) (err error) {
@@ -119,7 +182,11 @@ func (mob *Mob) SendUpdate(writer io.Writer) (err error) {
 		return
 	}
 
-	err = mob.PointObject.SendUpdate(writer, mob.EntityId, mob.look.ToLookBytes())
+	if err = mob.PointObject.SendUpdate(writer, mob.EntityId, mob.look.ToLookBytes()); err != nil {
+		return
+	}
+
+	err = mob.metadata.WriteUpdate(writer, mob.EntityId)
 
 	return
 }
@@ -146,6 +213,12 @@ func (mob *Mob) SendSpawn(writer io.Writer) (err error) {
 	return
 }
 
+// mobInteractions holds the behaviour of each type of mob when used by a
+// player. Mob types without an entry ignore being used.
+var mobInteractions = map[EntityMobType]func(mob *Mob, player IPlayerClient, held *Slot, chunk IChunkBlock){
+	MobTypeIdSheep: shearSheep,
+}
+
 // Evil mobs.
 
 type Creeper struct {
@@ -160,17 +233,17 @@ var (
 func NewCreeper() INonPlayerEntity {
 	c := new(Creeper)
 	c.Mob.Init(CreeperType.Id)
-	c.Mob.metadata[17] = creeperNormal
-	c.Mob.metadata[16] = byte(255)
+	c.Mob.metadata.SetByte(mobMetadata17, creeperNormal)
+	c.Mob.metadata.SetByte(mobMetadata16, byte(255))
 	return c
 }
 
 func (c *Creeper) SetNormalStatus() {
-	c.Mob.metadata[17] = creeperNormal
+	c.Mob.metadata.SetByte(mobMetadata17, creeperNormal)
 }
 
 func (c *Creeper) CreeperSetBlueAura() {
-	c.Mob.metadata[17] = creeperBlueAura
+	c.Mob.metadata.SetByte(mobMetadata17, creeperBlueAura)
 }
 
 type Skeleton struct {
@@ -219,12 +292,38 @@ type Sheep struct {
 	Mob
 }
 
+const (
+	itemIdShears = ItemTypeId(359)
+	blockIdWool  = ItemTypeId(35)
+
+	sheepColorMask = 0x0f
+	sheepSheared   = 0x10
+)
+
 func NewSheep() INonPlayerEntity {
 	s := new(Sheep)
 	s.Mob.Init(SheepType.Id)
 	return s
 }
 
+// shearSheep drops 1-3 wool of the sheep's colour if it is sheared by a
+// player holding shears.
+func shearSheep(mob *Mob, player IPlayerClient, held *Slot, chunk IChunkBlock) {
+	if held.ItemTypeId != itemIdShears || held.Count == 0 {
+		return
+	}
+	wool, _ := mob.metadata.Byte(mobMetadata16)
+	if wool&sheepSheared != 0 {
+		return
+	}
+	mob.metadata.SetByte(mobMetadata16, wool|sheepSheared)
+
+	position := *mob.Position()
+	position.Y += 1
+	count := ItemCount(1 + chunk.Rand().Intn(3))
+	chunk.AddEntity(NewItem(blockIdWool, count, ItemData(wool&sheepColorMask), &position, &AbsVelocity{}, 0))
+}
+
 type Cow struct {
 	Mob
 }
@@ -263,8 +362,8 @@ func NewWolf() INonPlayerEntity {
 	w := new(Wolf)
 	w.Mob.Init(WolfType.Id)
 	// TODO(nictuku): String with an optional owner's username.
-	w.Mob.metadata[17] = 0
-	w.Mob.metadata[16] = 0
-	w.Mob.metadata[18] = 0
+	w.Mob.metadata.SetByte(mobMetadata17, 0)
+	w.Mob.metadata.SetByte(mobMetadata16, 0)
+	w.Mob.metadata.SetByte(mobMetadata18, 0)
 	return w
 }
@@ -88,3 +88,28 @@ func TestMobSpawn(t *testing.T) {
 		}
 	}
 }
+
+func TestMobUpdate_Metadata(t *testing.T) {
+	m := NewPig().(*Pig)
+	m.PointObject.Init(&types.AbsXyz{11, 70, -172}, &types.AbsVelocity{0, 0, 0})
+	m.Mob.EntityId = 0x1234
+
+	buf := new(bytes.Buffer)
+	if err := m.SendUpdate(buf); err != nil {
+		t.Fatalf("Error when writing update: %v", err)
+	}
+
+	// Only the changed entry is sent.
+	m.SetBurning(true)
+	buf.Reset()
+	if err := m.SendUpdate(buf); err != nil {
+		t.Fatalf("Error when writing update: %v", err)
+	}
+	metadataUpdate := "\x28\x00\x00\x12\x34\x00\x01\x7f"
+	if !bytes.HasSuffix(buf.Bytes(), []byte(metadataUpdate)) {
+		t.Errorf("Expected update to end with metadata % x, got % x", metadataUpdate, buf.Bytes())
+	}
+	if m.metadata.IsDirty() {
+		t.Errorf("Expected metadata to be unchanged after update")
+	}
+}
@@ -0,0 +1,37 @@
+package gamerules
+
+import (
+	. "chunkymonkey/types"
+)
+
+// Light levels, from 0 to 15, that limit where mobs spawn naturally.
+const (
+	// HostileMobMaxLight is the brightest light that hostile mobs spawn in.
+	HostileMobMaxLight = 7
+	// PassiveMobMinLight is the dimmest sky light that passive mobs spawn in.
+	PassiveMobMinLight = 9
+)
+
+// naturalMobs are the mobs of each category that spawn naturally in any
+// biome. Passive mobs instead depend on the biome.
+var naturalMobs = map[MobCategory][]func() INonPlayerEntity{
+	MobHostile: {NewCreeper, NewSkeleton, NewSpider, NewZombie},
+	MobWater:   {NewSquid},
+}
+
+// naturalPassiveMobs are the passive mobs that spawn naturally in each biome.
+// None spawn in biomes without an entry.
+var naturalPassiveMobs = map[BiomeId][]func() INonPlayerEntity{
+	BiomePlains: {NewPig, NewSheep, NewCow, NewHen},
+	BiomeForest: {NewPig, NewSheep, NewCow, NewHen, NewWolf},
+	BiomeTundra: {NewSheep, NewWolf},
+}
+
+// NaturalMobs returns constructors for the mobs of the category that can
+// spawn naturally in the biome.
+func NaturalMobs(category MobCategory, biome BiomeId) []func() INonPlayerEntity {
+	if category == MobPassive {
+		return naturalPassiveMobs[biome]
+	}
+	return naturalMobs[category]
+}
@@ -4,9 +4,21 @@ import (
 	. "chunkymonkey/types"
 )
 
+// MobCategory groups the mob types that spawn in similar places, and which
+// share a spawn cap.
+type MobCategory byte
+
+const (
+	MobHostile = MobCategory(iota) // Spawn in the dark.
+	MobPassive                     // Spawn on grass in the light.
+	MobWater                       // Spawn in water.
+)
+
 type MobType struct {
-	Id   EntityMobType
-	Name string
+	Id        EntityMobType
+	Name      string
+	MaxHealth Health
+	Category  MobCategory
 }
 
 type MobTypeMap map[EntityMobType]*MobType
@@ -29,17 +41,17 @@ var Mobs = MobTypeMap{
 	MobTypeIdWolf:         &WolfType,
 }
 
-var CreeperType = MobType{MobTypeIdCreeper, "creeper"}
-var SkeletonType = MobType{MobTypeIdSkeleton, "skeleton"}
-var SpiderType = MobType{MobTypeIdSpider, "spider"}
-var GiantZombieType = MobType{MobTypeIdGiantZombie, "giantzombie"}
-var ZombieType = MobType{MobTypeIdZombie, "zombie"}
-var SlimeType = MobType{MobTypeIdSlime, "slime"}
-var GhastType = MobType{MobTypeIdGhast, "ghast"}
-var ZombiePigmanType = MobType{MobTypeIdZombiePigman, "zombiepigman"}
-var PigType = MobType{MobTypeIdPig, "pig"}
-var SheepType = MobType{MobTypeIdSheep, "sheep"}
-var CowType = MobType{MobTypeIdCow, "cow"}
-var HenType = MobType{MobTypeIdHen, "hen"}
-var SquidType = MobType{MobTypeIdSquid, "squid"}
-var WolfType = MobType{MobTypeIdWolf, "wolf"}
+var CreeperType = MobType{MobTypeIdCreeper, "creeper", 20, MobHostile}
+var SkeletonType = MobType{MobTypeIdSkeleton, "skeleton", 20, MobHostile}
+var SpiderType = MobType{MobTypeIdSpider, "spider", 16, MobHostile}
+var GiantZombieType = MobType{MobTypeIdGiantZombie, "giantzombie", 100, MobHostile}
+var ZombieType = MobType{MobTypeIdZombie, "zombie", 20, MobHostile}
+var SlimeType = MobType{MobTypeIdSlime, "slime", 16, MobHostile}
+var GhastType = MobType{MobTypeIdGhast, "ghast", 10, MobHostile}
+var ZombiePigmanType = MobType{MobTypeIdZombiePigman, "zombiepigman", 20, MobHostile}
+var PigType = MobType{MobTypeIdPig, "pig", 10, MobPassive}
+var SheepType = MobType{MobTypeIdSheep, "sheep", 8, MobPassive}
+var CowType = MobType{MobTypeIdCow, "cow", 10, MobPassive}
+var HenType = MobType{MobTypeIdHen, "hen", 4, MobPassive}
+var SquidType = MobType{MobTypeIdSquid, "squid", 10, MobWater}
+var WolfType = MobType{MobTypeIdWolf, "wolf", 8, MobPassive}
@@ -120,14 +120,6 @@ func NewThrownEgg() INonPlayerEntity {
 	return NewObject(ObjTypeIdThrownEgg)
 }
 
-func NewFallingSand() INonPlayerEntity {
-	return NewObject(ObjTypeIdFallingSand)
-}
-
-func NewFallingGravel() INonPlayerEntity {
-	return NewObject(ObjTypeIdFallingGravel)
-}
-
 func NewFishingFloat() INonPlayerEntity {
 	return NewObject(ObjTypeIdFishingFloat)
 }
@@ -5,6 +5,7 @@ package gamerules
 
 import (
 	"fmt"
+	"sort"
 )
 
 const (
@@ -23,6 +24,11 @@ type Recipe struct {
 	Height  byte
 	Input   []Slot
 	Output  Slot
+
+	// Shapeless recipes match their inputs in any arrangement. Their Input
+	// holds only the items needed, sorted by slotsByType, and Width and Height
+	// are unused.
+	Shapeless bool
 }
 
 func (r *Recipe) match(width, height byte, slots []Slot, indices []int) (isMatch bool) {
@@ -42,6 +48,20 @@ func (r *Recipe) match(width, height byte, slots []Slot, indices []int) (isMatch
 	return
 }
 
+// matchShapeless returns true if the slots, sorted by slotsByType, are the
+// inputs of the shapeless recipe.
+func (r *Recipe) matchShapeless(slots []Slot) bool {
+	if len(slots) != len(r.Input) {
+		return false
+	}
+	for i := range r.Input {
+		if !slots[i].IsSameType(&r.Input[i]) {
+			return false
+		}
+	}
+	return true
+}
+
 func (r *Recipe) hash() (hash uint32) {
 	indices := make([]int, len(r.Input))
 	for i := range r.Input {
@@ -50,14 +70,14 @@ func (r *Recipe) hash() (hash uint32) {
 	return inputHash(r.Input, indices)
 }
 
-func (r *Recipe) check() error {
+func (r *Recipe) check(itemTypes ItemTypeMap) error {
 	for i := range r.Input {
 		slot := &r.Input[i]
-		if !slot.IsValidType() {
+		if _, ok := itemTypes[slot.ItemTypeId]; !ok && slot.ItemTypeId != 0 {
 			return fmt.Errorf("Recipe %q input slot %d has unknown item type %d", r.Comment, i, slot.ItemTypeId)
 		}
 	}
-	if !r.Output.IsValidType() {
+	if _, ok := itemTypes[r.Output.ItemTypeId]; !ok {
 		return fmt.Errorf("Recipe %q output slot has unknown item type %d", r.Comment, r.Output.ItemTypeId)
 	}
 	return nil
@@ -84,31 +104,56 @@ func inputHash(slots []Slot, indices []int) (hash uint32) {
 	return
 }
 
+// slotsByType sorts slots by item type and data, so that the inputs of
+// shapeless recipes can be compared regardless of their arrangement.
+type slotsByType []Slot
+
+func (s slotsByType) Len() int {
+	return len(s)
+}
+
+func (s slotsByType) Less(i, j int) bool {
+	if s[i].ItemTypeId != s[j].ItemTypeId {
+		return s[i].ItemTypeId < s[j].ItemTypeId
+	}
+	return s[i].Data < s[j].Data
+}
+
+func (s slotsByType) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
 type RecipeSet struct {
 	recipes []Recipe
 
-	// Recipe by inputs hash.
+	// Shaped recipe by inputs hash.
 	recipeHash map[uint32][]*Recipe
+
+	// Shapeless recipe by sorted inputs hash.
+	shapelessHash map[uint32][]*Recipe
 }
 
-func (r *RecipeSet) init() error {
+func (r *RecipeSet) init(itemTypes ItemTypeMap) error {
 	r.recipeHash = make(map[uint32][]*Recipe)
+	r.shapelessHash = make(map[uint32][]*Recipe)
 	for i := range r.recipes {
 		recipe := &r.recipes[i]
+		hashes := r.recipeHash
+		if recipe.Shapeless {
+			hashes = r.shapelessHash
+		}
 		hash := recipe.hash()
-		bucket := r.recipeHash[hash]
-		bucket = append(bucket, recipe)
-		r.recipeHash[hash] = bucket
+		hashes[hash] = append(hashes[hash], recipe)
 	}
 
-	return r.check()
+	return r.check(itemTypes)
 }
 
 // check checks all the recipes to ensure that they seem consistent, i.e item
 // type IDs exist, etc.
-func (r *RecipeSet) check() error {
+func (r *RecipeSet) check(itemTypes ItemTypeMap) error {
 	for i := range r.recipes {
-		if err := r.recipes[i].check(); err != nil {
+		if err := r.recipes[i].check(itemTypes); err != nil {
 			return err
 		}
 	}
@@ -120,9 +165,10 @@ func (r *RecipeSet) check() error {
 type RecipeSetMatcher struct {
 	recipes *RecipeSet
 
-	// slotBuf is used in searching for a match. Having it in the struct saves
-	// reallocation per call to Match().
+	// indicesArray and slotsArray are used in searching for a match. Having
+	// them in the struct saves reallocation per call to Match().
 	indicesArray [maxRecipeWidth * maxRecipeHeight]int
+	slotsArray   [maxRecipeWidth * maxRecipeHeight]Slot
 }
 
 func (r *RecipeSetMatcher) Init(recipes *RecipeSet) {
@@ -188,18 +234,36 @@ func (r *RecipeSetMatcher) Match(width, height int, slots []Slot) (output Slot)
 
 	hash := inputHash(slots, indices)
 
-	bucket, ok := r.recipes.recipeHash[hash]
-
-	if !ok {
-		return
-	}
-
 	// Find the matching recipe, if any.
-	for i := range bucket {
-		recipe := bucket[i]
+	for _, recipe := range r.recipes.recipeHash[hash] {
 		if recipe.match(byte(widthUsed), byte(heightUsed), slots, indices) {
 			// Found matching recipe.
-			output = recipe.Output
+			return recipe.Output
+		}
+	}
+
+	return r.matchShapeless(slots)
+}
+
+// matchShapeless looks for a shapeless recipe with the items in the slots as
+// its inputs.
+func (r *RecipeSetMatcher) matchShapeless(slots []Slot) (output Slot) {
+	items := r.slotsArray[:0]
+	for i := range slots {
+		if !slots[i].IsEmpty() {
+			items = append(items, slots[i])
+		}
+	}
+	sort.Sort(slotsByType(items))
+
+	indices := r.indicesArray[:len(items)]
+	for i := range indices {
+		indices[i] = i
+	}
+
+	for _, recipe := range r.recipes.shapelessHash[inputHash(items, indices)] {
+		if recipe.matchShapeless(items) {
+			return recipe.Output
 		}
 	}
 
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
 
 	. "chunkymonkey/types"
 )
@@ -27,6 +28,7 @@ type recipeTemplate struct {
 	InputTypes  map[string][]typeInstance
 	OutputTypes []typeInstance
 	OutputCount ItemCount
+	Shapeless   bool
 	height      byte
 	width       byte
 }
@@ -117,6 +119,20 @@ func (rt *recipeTemplate) createRecipe(recipeIndex int, itemTypes ItemTypeMap) (
 	}
 	recipe.Output.Count = rt.OutputCount
 
+	if rt.Shapeless {
+		// Only the items themselves matter, not where they are.
+		inputs := make([]Slot, 0, len(recipe.Input))
+		for _, slot := range recipe.Input {
+			if slot.ItemTypeId != 0 {
+				inputs = append(inputs, slot)
+			}
+		}
+		sort.Sort(slotsByType(inputs))
+		recipe.Width, recipe.Height = 0, 0
+		recipe.Input = inputs
+		recipe.Shapeless = true
+	}
+
 	return
 }
 
@@ -161,7 +177,7 @@ func LoadRecipes(reader io.Reader, itemTypes ItemTypeMap) (recipes *RecipeSet, e
 		}
 	}
 
-	err = recipes.init()
+	err = recipes.init(itemTypes)
 
 	return
 }
@@ -128,3 +128,53 @@ func TestRecipeSet_Match(t *testing.T) {
 	// TODO test things other than square or 1x1 recipes
 	// TODO test recipes with gaps in
 }
+
+const shapelessRecipes = `[
+  {
+    "Comment": "mushroom stew",
+    "Input": ["XYB"],
+    "InputTypes": {
+      "X": [{"Id": 39}],
+      "Y": [{"Id": 40}],
+      "B": [{"Id": 281}]
+    },
+    "OutputTypes": [{"Id": 282}],
+    "OutputCount": 1,
+    "Shapeless": true
+  }
+]`
+
+func TestRecipeSet_MatchShapeless(t *testing.T) {
+	itemTypes := ItemTypeMap{39: &ItemType{}, 40: &ItemType{}, 281: &ItemType{}, 282: &ItemType{}}
+
+	recipes, err := LoadRecipes(strings.NewReader(shapelessRecipes), itemTypes)
+	if err != nil {
+		t.Fatalf("Failed to load recipes: %v", err)
+	}
+
+	empty := Slot{0, 0, 0}
+	brown := Slot{39, 1, 0}
+	red := Slot{40, 1, 0}
+	bowl := Slot{281, 1, 0}
+	stew := Slot{282, 1, 0}
+
+	tests := []struct {
+		comment string
+		input   []Slot
+		expect  *Slot
+	}{
+		{"in a row", Slots(brown, red, bowl, empty, empty, empty, empty, empty, empty), &stew},
+		{"scattered", Slots(empty, bowl, empty, red, empty, empty, empty, empty, brown), &stew},
+		{"missing bowl", Slots(brown, red, empty, empty, empty, empty, empty, empty, empty), &empty},
+		{"extra item", Slots(brown, red, bowl, bowl, empty, empty, empty, empty, empty), &empty},
+	}
+
+	var matcher RecipeSetMatcher
+	matcher.Init(recipes)
+
+	for _, test := range tests {
+		t.Logf("Test %s", test.comment)
+		output := matcher.Match(3, 3, test.input)
+		assertSlotEq(t, test.expect, &output)
+	}
+}
@@ -99,9 +99,31 @@ func (s *Slot) SendUpdate(writer io.Writer, windowId WindowId, slotId SlotId) er
 }
 
 func (s *Slot) SendEquipmentUpdate(writer io.Writer, entityId EntityId, slotId SlotId) error {
+	if s.IsEmpty() {
+		// Clients expect -1 for empty equipment slots.
+		return proto.WriteEntityEquipment(writer, entityId, slotId, -1, 0)
+	}
 	return proto.WriteEntityEquipment(writer, entityId, slotId, s.ItemTypeId, s.Data)
 }
 
+// NumEquipmentSlots is the number of slots in PlayerEquipment.
+const NumEquipmentSlots = 5
+
+// PlayerEquipment is what other players see a player holding and wearing. It
+// is indexed by the slot IDs of the entity equipment packet: 0 is the held
+// item, and 1-4 are armor from feet to head.
+type PlayerEquipment [NumEquipmentSlots]Slot
+
+// SendUpdate writes entity equipment packets for all of the slots.
+func (e *PlayerEquipment) SendUpdate(writer io.Writer, entityId EntityId) (err error) {
+	for i := range e {
+		if err = e[i].SendEquipmentUpdate(writer, entityId, SlotId(i)); err != nil {
+			return
+		}
+	}
+	return
+}
+
 func (s *Slot) setCount(count ItemCount) {
 	s.Count = count
 	if s.Count == 0 {
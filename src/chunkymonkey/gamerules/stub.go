@@ -1,7 +1,9 @@
 package gamerules
 
 import (
+	"chunkymonkey/chat"
 	"chunkymonkey/proto"
+	"chunkymonkey/schematic"
 	. "chunkymonkey/types"
 )
 
@@ -25,13 +27,17 @@ type IPlayerShardClient interface {
 
 	// The following methods are requests upon chunks.
 
+	// ReqSetTrackingPosition tells the shard where the player is, so that only
+	// entities within range of the player are sent to them.
+	ReqSetTrackingPosition(position AbsXyz)
+
 	ReqSubscribeChunk(chunkLoc ChunkXz, notify bool)
 
 	ReqUnsubscribeChunk(chunkLoc ChunkXz)
 
 	ReqMulticastPlayers(chunkLoc ChunkXz, exclude EntityId, packet []byte)
 
-	ReqAddPlayerData(chunkLoc ChunkXz, name string, position AbsXyz, look LookBytes, held ItemTypeId)
+	ReqAddPlayerData(chunkLoc ChunkXz, name string, position AbsXyz, look LookBytes, equipment PlayerEquipment)
 
 	ReqRemovePlayerData(chunkLoc ChunkXz, isDisconnect bool)
 
@@ -39,12 +45,43 @@ type IPlayerShardClient interface {
 
 	ReqSetPlayerLook(chunkLoc ChunkXz, look LookBytes)
 
+	// ReqSetPlayerEquipment requests that other players be shown the player
+	// with the item in the equipment slot.
+	ReqSetPlayerEquipment(chunkLoc ChunkXz, slotId SlotId, item Slot)
+
 	// ReqHitBlock requests that the targetted block be hit.
 	ReqHitBlock(held Slot, target BlockXyz, digStatus DigStatus, face Face)
 
 	// ReqHitBlock requests that the targetted block be interacted with.
 	ReqInteractBlock(held Slot, target BlockXyz, face Face)
 
+	// ReqResendBlock requests that the player be sent the block as it is, to
+	// undo a change that their client made before it was refused.
+	ReqResendBlock(target BlockXyz)
+
+	// ReqUseEntity requests that the player at position attack (leftClick) or
+	// interact with the target entity, if it is in the chunk and within reach.
+	ReqUseEntity(chunkLoc ChunkXz, held Slot, position AbsXyz, target EntityId, leftClick bool)
+
+	// ReqBedSpawn requests the position beside the bed at which the player
+	// should respawn. The shard replies with NotifyBedSpawn.
+	ReqBedSpawn(bed BlockXyz)
+
+	// ReqSpawnPosition requests the position nearest above position at which
+	// the player has room to stand, so that they don't spawn inside solid
+	// blocks. The shard replies with NotifySpawnPosition.
+	ReqSpawnPosition(position AbsXyz)
+
+	// ReqLanded reports that the player landed at position after falling
+	// fallDistance. Unless something there breaks the fall, such as water,
+	// the shard replies with NotifyFall.
+	ReqLanded(position AbsXyz, fallDistance float32)
+
+	// ReqSetSignText requests that the sign be written with the text that the
+	// player entered after placing it. The shard tells the players
+	// subscribed to the chunk what the sign says afterwards.
+	ReqSetSignText(target BlockXyz, lines [4]string)
+
 	// ReqPlaceItem requests that the item passed be placed at the given target
 	// location. The shard *may* choose not to do this, but if it cannot, then it
 	// *must* account for the item in some way (maybe hand it back to the player
@@ -65,6 +102,11 @@ type IPlayerShardClient interface {
 	// ReqInventorySlotUpdate to all subscribers to the inventory.
 	ReqInventoryClick(block BlockXyz, click Click)
 
+	// ReqInventoryPutItem requests that the item be put into the inventory, as
+	// when the player shift-clicks it into an open window. Whatever the
+	// inventory cannot take is given back to the player.
+	ReqInventoryPutItem(block BlockXyz, item Slot)
+
 	// ReqInventoryUnsubscribed requests that the inventory for the block be
 	// unsubscribed to.
 	ReqInventoryUnsubscribed(block BlockXyz)
@@ -78,6 +120,10 @@ type IShardShardClient interface {
 
 	ReqSetActiveBlocks(blocks []BlockXyz)
 
+	// ReqScheduleUpdate schedules an update of a block in the shard, as
+	// IChunkBlock.ScheduleUpdate.
+	ReqScheduleUpdate(block BlockXyz, delay Ticks)
+
 	ReqTransferEntity(loc ChunkXz, entity INonPlayerEntity)
 }
 
@@ -87,8 +133,8 @@ type IGame interface {
 	// Broadcast a packet to all players on the server.
 	BroadcastPacket(packet []byte)
 
-	// Broadcast a message to all players on the server.
-	BroadcastMessage(msg string)
+	// Broadcast a chat message of the kind to all players on the server.
+	BroadcastChat(kind chat.Kind, from, message string)
 
 	// Return a player from their name.
 	PlayerByName(name string) IPlayerClient
@@ -99,6 +145,39 @@ type IGame interface {
 	// Return an ItemType from a numeric item. The boolean flag indicates
 	// whether or not 'id' was a valid item type.
 	ItemTypeById(id int) (ItemType, bool)
+
+	// Time returns the world time, in ticks since the world was created.
+	Time() Ticks
+
+	// SpawnBlock returns the world spawn, which may move while the game runs.
+	SpawnBlock() BlockXyz
+
+	// WorldBorder returns the border players are kept within.
+	WorldBorder() WorldBorder
+
+	// Set the time of day, in ticks since dawn, keeping the day count.
+	// Players are told about the change immediately.
+	SetTime(dayTicks Ticks)
+
+	// AddTime advances the time by ticks, as though they had passed. Players
+	// are told about the change immediately.
+	AddTime(ticks Ticks)
+
+	// PasteSchematic pastes the named schematic into the world, with its
+	// lowest north-west corner at the block. done, if not nil, is called with
+	// the number of blocks changed once the paste is complete, or has failed.
+	PasteSchematic(name string, at BlockXyz, options schematic.PasteOptions, done func(changed int, err error))
+
+	// CopySchematic saves the blocks in the box between two opposite corners,
+	// inclusive, as the named schematic. done, if not nil, is called with the
+	// number of blocks copied once the schematic is saved, or has failed.
+	CopySchematic(name string, from, to BlockXyz, done func(blocks int, err error))
+
+	// PruneChunks removes the stored overworld chunks further than radius
+	// chunks from the spawn, apart from those that are loaded or contain
+	// players' beds. Saving is paused meanwhile. done is called with the
+	// number of chunks and bytes removed, or that would be for a dry run.
+	PruneChunks(radius int, dryRun bool, done func(chunks int, bytes int64, err error))
 }
 
 // IShardClient is the interface by which shards communicate to players on
@@ -109,8 +188,26 @@ type IPlayerClient interface {
 	TransmitPacket(packet []byte)
 
 	// NotifyChunkLoad informs Player that a chunk subscription request with
-	// notify=true has completed.
-	NotifyChunkLoad()
+	// notify=true has completed. loaded is false if the chunk couldn't be
+	// loaded, and so wasn't sent.
+	NotifyChunkLoad(chunkLoc ChunkXz, loaded bool)
+
+	// NotifyBedSpawn informs the player of the position to respawn at beside
+	// their home bed, in reply to ReqBedSpawn. ok is false if the bed is
+	// missing or obstructed.
+	NotifyBedSpawn(position AbsXyz, ok bool)
+
+	// NotifySpawnPosition informs the player of the position to spawn at, in
+	// reply to ReqSpawnPosition.
+	NotifySpawnPosition(position AbsXyz)
+
+	// NotifyFall informs the player that nothing broke their fall of
+	// fallDistance, in reply to ReqLanded, so that they take damage from it.
+	NotifyFall(fallDistance float32)
+
+	// UseBed makes the bed the one that the player respawns at, if it is
+	// night.
+	UseBed(bed BlockXyz)
 
 	// InventorySubscribed informs the player that an inventory has been
 	// opened.
@@ -127,6 +224,11 @@ type IPlayerClient interface {
 	// InventoryCursorUpdate informs the player of their new cursor contents.
 	InventoryCursorUpdate(block BlockXyz, cursor Slot)
 
+	// InventoryTakeItem gives the player the item, shift-clicked out of the
+	// open inventory. Whatever the player has no room for is put back with
+	// ReqInventoryPutItem.
+	InventoryTakeItem(block BlockXyz, item Slot)
+
 	// InventoryTxState requests that the player report the transaction state
 	// as accepted or not. This is used by remote inventories when
 	// TxStateDeferred is returned from Click.
@@ -163,9 +265,27 @@ type IPlayerClient interface {
 
 	// EchoMessage displays a message to the player
 	EchoMessage(msg string)
+
+	// SendChat displays a chat message of the kind to the player.
+	SendChat(kind chat.Kind, from, message string)
+
+	// AttackedByPlayer requests that the player take damage from being hit by
+	// another player, and be knocked back. The player code may *not* honour
+	// this request (e.g PvP might be disabled).
+	AttackedByPlayer(attacker EntityId, damage Health, knockback AbsVelocity)
+
+	// Ping returns the player's smoothed roundtrip latency in milliseconds.
+	Ping() int16
+}
+
+// ICommandSender is who a command is run for: a player, or an administrator
+// at a console.
+type ICommandSender interface {
+	// EchoMessage displays a message to the sender.
+	EchoMessage(msg string)
 }
 
 type ICommandFramework interface {
 	Prefix() string
-	Process(player IPlayerClient, cmd string, game IGame)
+	Process(sender ICommandSender, cmd string, game IGame)
 }
@@ -0,0 +1,52 @@
+package gamerules
+
+import (
+	. "chunkymonkey/types"
+)
+
+const (
+	BlockIdLog    = BlockId(17)
+	BlockIdLeaves = BlockId(18)
+
+	// Trees have trunks from TreeMinHeight to TreeMaxHeight-1 blocks high.
+	TreeMinHeight = 3
+	TreeMaxHeight = 6
+)
+
+// TreeBlock is a block of a tree, relative to the bottom of its trunk.
+type TreeBlock struct {
+	Dx, Dy, Dz int
+	BlockId    BlockId
+}
+
+// TreeBlocks returns the blocks of a tree whose trunk is height blocks high.
+// The trunk comes first, followed by the leaves of the canopy around its top.
+// This is shared by growing saplings and world generation, so that both make
+// the same trees.
+func TreeBlocks(height int) (blocks []TreeBlock) {
+	for y := 0; y < height; y++ {
+		blocks = append(blocks, TreeBlock{0, y, 0, BlockIdLog})
+	}
+
+	top := height - 1
+	cradius := height / 2
+
+	// Start one block above the trunk and move down.
+	for y := top + 1; y >= top-1; y-- {
+		// Slightly round out the canopy.
+		radius := cradius - 1
+		if y == top {
+			radius = cradius
+		}
+
+		for x := -radius; x <= radius; x++ {
+			for z := -radius; z <= radius; z++ {
+				if y > top || x != 0 || z != 0 {
+					blocks = append(blocks, TreeBlock{x, y, z, BlockIdLeaves})
+				}
+			}
+		}
+	}
+
+	return
+}
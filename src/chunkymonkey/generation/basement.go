@@ -0,0 +1,26 @@
+package generation
+
+import (
+	. "chunkymonkey/types"
+)
+
+// BasementHeight is the highest that bedrock may reach. The layer at y=0 is
+// always bedrock, and each layer above it is less likely to be.
+const BasementHeight = 4
+
+// addBasement adds the unbreakable bedrock floor to a chunk. It should be
+// used by all generators, so that they all have the same floor. The
+// roughness is seeded from the chunk location, so that it doesn't depend on
+// the order in which chunks are generated.
+func addBasement(seed int64, data *ChunkData) {
+	// Use a different seed from other per-chunk random numbers.
+	rnd := chunkRand(seed+0x62656472, data.loc)
+
+	for baseIndex := 0; baseIndex < len(data.blocks); baseIndex += ChunkSizeY {
+		for y := 0; y <= BasementHeight; y++ {
+			if y <= rnd.Intn(BasementHeight+1) {
+				data.blocks[baseIndex+y] = byte(BlockIdBedrock)
+			}
+		}
+	}
+}
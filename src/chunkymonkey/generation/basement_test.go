@@ -0,0 +1,63 @@
+package generation
+
+import (
+	"testing"
+
+	"chunkymonkey/chunkstore"
+	. "chunkymonkey/types"
+)
+
+func TestBasement(t *testing.T) {
+	// The TestGenerator needs the game rules to be loaded, so the basement is
+	// tested on a stone chunk instead.
+	generators := map[string]chunkstore.IChunkStoreForeground{
+		"stone": basementStoneGenerator{},
+		"noise": NewNoiseGenerator(1, testNoiseParams()),
+	}
+
+	for name, gen := range generators {
+		layers := make([]int, BasementHeight+2)
+
+		for x := ChunkCoord(0); x < 4; x++ {
+			reader, err := gen.ReadChunk(ChunkXz{x, -x})
+			if err != nil {
+				t.Fatal(err)
+			}
+			blocks := reader.Blocks()
+
+			for baseIndex := 0; baseIndex < len(blocks); baseIndex += ChunkSizeY {
+				if BlockId(blocks[baseIndex]) != BlockIdBedrock {
+					t.Fatalf("%s: no bedrock at y=0", name)
+				}
+				for y := 0; y < len(layers); y++ {
+					if BlockId(blocks[baseIndex+y]) == BlockIdBedrock {
+						layers[y]++
+					}
+				}
+			}
+		}
+
+		// Each layer of the basement is rougher than the one below it.
+		for y := 1; y <= BasementHeight; y++ {
+			if layers[y] == 0 || layers[y] >= layers[y-1] {
+				t.Errorf("%s: %d bedrock blocks at y=%d, %d at y=%d", name, layers[y], y, layers[y-1], y-1)
+			}
+		}
+		if layers[BasementHeight+1] != 0 {
+			t.Errorf("%s: bedrock above the basement", name)
+		}
+	}
+}
+
+type basementStoneGenerator struct {
+	chunkstore.IChunkStoreForeground
+}
+
+func (gen basementStoneGenerator) ReadChunk(chunkLoc ChunkXz) (chunkstore.IChunkReader, error) {
+	data := newStoneChunk(chunkLoc)
+	for baseIndex := 0; baseIndex < len(data.blocks); baseIndex += ChunkSizeY {
+		data.blocks[baseIndex] = 1 // stone
+	}
+	addBasement(1, data)
+	return data, nil
+}
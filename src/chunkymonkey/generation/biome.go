@@ -0,0 +1,57 @@
+package generation
+
+import (
+	. "chunkymonkey/types"
+	"perlin"
+)
+
+// BiomeSource assigns biomes to block columns from temperature and humidity
+// noise. The noise varies slowly, so biomes form regions many chunks across
+// and adjacent columns rarely differ.
+type BiomeSource struct {
+	temperature ISource
+	humidity    ISource
+}
+
+func NewBiomeSource(seed int64) *BiomeSource {
+	return &BiomeSource{
+		temperature: &Scale{
+			Wavelength: 512,
+			Amplitude:  1,
+			Source: &Octaves{
+				Count:       2,
+				Persistence: 0.5,
+				Source:      perlin.NewPerlinNoise(seed + 2),
+			},
+		},
+		humidity: &Scale{
+			Wavelength: 384,
+			Amplitude:  1,
+			Source: &Octaves{
+				Count:       2,
+				Persistence: 0.5,
+				Source:      perlin.NewPerlinNoise(seed + 3),
+			},
+		},
+	}
+}
+
+// Climate returns the temperature and humidity at a block column. Both are
+// roughly in the range [-1, 1].
+func (source *BiomeSource) Climate(x, z float64) (temperature, humidity float64) {
+	return source.temperature.At2d(x, z), source.humidity.At2d(x, z)
+}
+
+// Biome returns the biome of a block column.
+func (source *BiomeSource) Biome(x, z float64) BiomeId {
+	temperature, humidity := source.Climate(x, z)
+	switch {
+	case temperature < -0.25:
+		return BiomeTundra
+	case temperature > 0.2 && humidity < 0:
+		return BiomeDesert
+	case humidity > 0.1:
+		return BiomeForest
+	}
+	return BiomePlains
+}
@@ -0,0 +1,72 @@
+package generation
+
+import (
+	"math"
+	"testing"
+
+	. "chunkymonkey/types"
+)
+
+// TestBiomeSource_Seams checks that biomes don't change systematically at
+// chunk borders, and that the climate either side of a border is close.
+func TestBiomeSource_Seams(t *testing.T) {
+	gen := NewNoiseGenerator(42, testNoiseParams())
+	source := gen.biomes
+
+	const maxClimateStep = 0.02
+	borderColumns, changed := 0, 0
+
+	for cx := -8; cx < 8; cx++ {
+		for cz := -8; cz < 8; cz++ {
+			left, err := gen.ReadChunk(ChunkXz{ChunkCoord(cx), ChunkCoord(cz)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			right, err := gen.ReadChunk(ChunkXz{ChunkCoord(cx + 1), ChunkCoord(cz)})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Compare the last column of each row in left to the first in right.
+			for z := 0; z < ChunkSizeH; z++ {
+				leftLoc := SubChunkXyz{X: ChunkSizeH - 1, Z: SubChunkCoord(z)}
+				rightLoc := SubChunkXyz{X: 0, Z: SubChunkCoord(z)}
+				borderColumns++
+				if left.Biomes()[leftLoc.BiomeIndex()] != right.Biomes()[rightLoc.BiomeIndex()] {
+					changed++
+				}
+
+				x := float64((cx+1)*ChunkSizeH) - 1
+				zf := float64(cz*ChunkSizeH + z)
+				t0, h0 := source.Climate(x, zf)
+				t1, h1 := source.Climate(x+1, zf)
+				if math.Abs(t1-t0) > maxClimateStep || math.Abs(h1-h0) > maxClimateStep {
+					t.Fatalf("climate jumps across border at x=%v z=%v: (%v, %v) -> (%v, %v)",
+						x, zf, t0, h0, t1, h1)
+				}
+			}
+		}
+	}
+
+	// Biome borders should cross chunk borders only occasionally.
+	if changed*20 > borderColumns {
+		t.Errorf("biome changed at %d of %d chunk border columns", changed, borderColumns)
+	}
+}
+
+func TestBiomeSource_Variety(t *testing.T) {
+	source := NewBiomeSource(42)
+
+	seen := make(map[BiomeId]bool)
+	for x := -4096; x < 4096; x += 64 {
+		for z := -4096; z < 4096; z += 64 {
+			seen[source.Biome(float64(x), float64(z))] = true
+		}
+	}
+
+	for _, biome := range []BiomeId{BiomePlains, BiomeDesert, BiomeForest, BiomeTundra} {
+		if !seen[biome] {
+			t.Errorf("biome %d never generated", biome)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package generation
+
+import (
+	"math"
+	"math/rand"
+
+	. "chunkymonkey/types"
+)
+
+const (
+	// caveRange is how many chunks away from its starting chunk a cave can
+	// reach. It bounds the length of the caves.
+	caveRange = 8
+
+	// caveLavaLevel is the height below which carved blocks become lava.
+	caveLavaLevel = 10
+)
+
+// CaveCarver carves tunnels and caverns through generated stone. Each cave
+// starts in a chunk and follows a path derived only from the seed and that
+// chunk's location. A chunk is carved by every cave that starts within
+// caveRange of it, so that a cave crossing chunk borders lines up regardless
+// of the order in which chunks are generated.
+type CaveCarver struct {
+	seed int64
+}
+
+func NewCaveCarver(seed int64) *CaveCarver {
+	return &CaveCarver{seed: seed}
+}
+
+// Carve carves the caves that pass through the chunk.
+func (carver *CaveCarver) Carve(data *ChunkData) {
+	for sx := data.loc.X - caveRange; sx <= data.loc.X+caveRange; sx++ {
+		for sz := data.loc.Z - caveRange; sz <= data.loc.Z+caveRange; sz++ {
+			carver.carveFrom(data, ChunkXz{sx, sz})
+		}
+	}
+}
+
+// chunkHash returns a well mixed hash of the seed and a chunk location.
+func chunkHash(seed int64, loc ChunkXz) uint64 {
+	// The splitmix64 finalizer.
+	h := uint64(seed) ^ uint64(loc.X)*0x9e3779b97f4a7c15 ^ uint64(loc.Z)*0xc2b2ae3d27d4eb4f
+	h = (h ^ (h >> 30)) * 0xbf58476d1ce4e5b9
+	h = (h ^ (h >> 27)) * 0x94d049bb133111eb
+	return h ^ (h >> 31)
+}
+
+// carveFrom carves the caves starting in the source chunk into data.
+func (carver *CaveCarver) carveFrom(data *ChunkData, source ChunkXz) {
+	// Most chunks have no caves. This is checked with a hash as it is much
+	// cheaper than seeding a random number generator for each chunk.
+	hash := chunkHash(carver.seed, source)
+	if hash%7 != 0 {
+		return
+	}
+	rnd := rand.New(rand.NewSource(int64(hash >> 1)))
+
+	// The rest favour few caves.
+	numCaves := rnd.Intn(rnd.Intn(rnd.Intn(12)+1) + 1)
+
+	corner := source.ChunkCornerBlockXY()
+	for i := 0; i < numCaves; i++ {
+		x := float64(corner.X) + rnd.Float64()*ChunkSizeH
+		y := float64(rnd.Intn(rnd.Intn(ChunkSizeY-8) + 8))
+		z := float64(corner.Z) + rnd.Float64()*ChunkSizeH
+
+		tunnels := 1
+		if rnd.Intn(4) == 0 {
+			// A cavern, with tunnels leading from it.
+			carver.carveTunnel(data, rnd.Int63(), x, y, z, 1+rnd.Float64()*6, 0, 0, true)
+			tunnels += rnd.Intn(4)
+		}
+
+		for j := 0; j < tunnels; j++ {
+			yaw := rnd.Float64() * 2 * math.Pi
+			pitch := (rnd.Float64() - 0.5) / 4
+			width := rnd.Float64()*2 + rnd.Float64()
+			carver.carveTunnel(data, rnd.Int63(), x, y, z, width, yaw, pitch, false)
+		}
+	}
+}
+
+// carveTunnel carves a winding tunnel into data. All of the random numbers
+// for the tunnel are drawn whether or not it passes through data, so that
+// its path is the same for every chunk.
+func (carver *CaveCarver) carveTunnel(data *ChunkData, seed int64, x, y, z, width, yaw, pitch float64, cavern bool) {
+	rnd := rand.New(rand.NewSource(seed))
+
+	// Stay within caveRange chunks of the start, allowing for the radius.
+	length := (caveRange-1)*ChunkSizeH - rnd.Intn(ChunkSizeH)
+	if cavern {
+		length /= 4
+	}
+
+	corner := data.loc.ChunkCornerBlockXY()
+	centreX := float64(corner.X) + ChunkSizeH/2
+	centreZ := float64(corner.Z) + ChunkSizeH/2
+
+	var dYaw, dPitch float64
+	for step := 0; step < length; step++ {
+		radius := 1.5 + math.Sin(float64(step)*math.Pi/float64(length))*width
+		vRadius := radius * 0.7
+
+		if cavern {
+			// Caverns stay put and swell in the middle.
+			vRadius = radius * 0.5
+		} else {
+			cosPitch := math.Cos(pitch)
+			x += math.Cos(yaw) * cosPitch
+			y += math.Sin(pitch)
+			z += math.Sin(yaw) * cosPitch
+
+			pitch = pitch*0.7 + dPitch*0.1
+			yaw += dYaw * 0.1
+			dPitch = dPitch*0.9 + (rnd.Float64()-rnd.Float64())*rnd.Float64()*2
+			dYaw = dYaw*0.75 + (rnd.Float64()-rnd.Float64())*rnd.Float64()*4
+		}
+
+		if math.Abs(x-centreX) > ChunkSizeH/2+radius || math.Abs(z-centreZ) > ChunkSizeH/2+radius {
+			continue
+		}
+
+		carveEllipsoid(data, x-float64(corner.X), y, z-float64(corner.Z), radius, vRadius)
+	}
+}
+
+// carveEllipsoid carves the blocks within an ellipsoid centred on the given
+// position relative to the chunk corner.
+func carveEllipsoid(data *ChunkData, x, y, z, radius, vRadius float64) {
+	minX, maxX := clampInt(int(math.Floor(x-radius)), 0, ChunkSizeH-1), clampInt(int(math.Ceil(x+radius)), 0, ChunkSizeH-1)
+	minZ, maxZ := clampInt(int(math.Floor(z-radius)), 0, ChunkSizeH-1), clampInt(int(math.Ceil(z+radius)), 0, ChunkSizeH-1)
+	// Never carve the bedrock at y=0.
+	minY, maxY := clampInt(int(math.Floor(y-vRadius)), 1, ChunkSizeY-2), clampInt(int(math.Ceil(y+vRadius)), 1, ChunkSizeY-2)
+
+	for bx := minX; bx <= maxX; bx++ {
+		dx := (float64(bx) + 0.5 - x) / radius
+		for bz := minZ; bz <= maxZ; bz++ {
+			dz := (float64(bz) + 0.5 - z) / radius
+			baseIndex := (bx*ChunkSizeH + bz) * ChunkSizeY
+			blocks := data.blocks[baseIndex : baseIndex+ChunkSizeY]
+
+			for by := maxY; by >= minY; by-- {
+				dy := (float64(by) + 0.5 - y) / vRadius
+				if dx*dx+dy*dy+dz*dz >= 1 {
+					continue
+				}
+				carveBlock(blocks, by)
+			}
+		}
+	}
+}
+
+// carveBlock carves a block in a column, unless it isn't carvable or would
+// leave water, sand or snow unsupported.
+func carveBlock(blocks []byte, y int) {
+	switch blocks[y] {
+	case 1, 2, 3: // stone, grass, dirt
+	default:
+		return
+	}
+	switch blocks[y+1] {
+	case 8, 9, 12, 78, 79: // water, sand, snow, ice
+		return
+	}
+
+	if y < caveLavaLevel {
+		blocks[y] = 11 // stationary lava
+	} else {
+		blocks[y] = 0
+	}
+}
+
+// floorDivInt divides, rounding towards negative infinity.
+func floorDivInt(a, b int) int {
+	if a < 0 {
+		return -((b - 1 - a) / b)
+	}
+	return a / b
+}
+
+func clampInt(v, min, max int) int {
+	if v < min {
+		return min
+	} else if v > max {
+		return max
+	}
+	return v
+}
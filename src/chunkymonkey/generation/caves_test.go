@@ -0,0 +1,128 @@
+package generation
+
+import (
+	"strings"
+	"testing"
+
+	. "chunkymonkey/types"
+)
+
+// newStoneChunk returns a chunk of solid stone on bedrock.
+func newStoneChunk(loc ChunkXz) *ChunkData {
+	data := newChunkData(loc)
+	for baseIndex := 0; baseIndex < len(data.blocks); baseIndex += ChunkSizeY {
+		data.blocks[baseIndex] = 7 // bedrock
+		for y := 1; y < ChunkSizeY; y++ {
+			data.blocks[baseIndex+y] = 1 // stone
+		}
+	}
+	return data
+}
+
+func carvedStoneChunk(carver *CaveCarver, loc ChunkXz) *ChunkData {
+	data := newStoneChunk(loc)
+	carver.Carve(data)
+	return data
+}
+
+func isCarved(block byte) bool {
+	return block == 0 || block == 11
+}
+
+func TestCaveCarver(t *testing.T) {
+	carver := NewCaveCarver(42)
+
+	carved := 0
+	for x := 0; x < 8; x++ {
+		for z := 0; z < 8; z++ {
+			data := carvedStoneChunk(carver, ChunkXz{ChunkCoord(x), ChunkCoord(z)})
+			for baseIndex := 0; baseIndex < len(data.blocks); baseIndex += ChunkSizeY {
+				if data.blocks[baseIndex] != 7 {
+					t.Fatalf("bedrock carved at %d", baseIndex)
+				}
+				for y := 1; y < ChunkSizeY; y++ {
+					switch data.blocks[baseIndex+y] {
+					case 0:
+						if y < caveLavaLevel {
+							t.Fatalf("air at y=%d, below lava level", y)
+						}
+						carved++
+					case 11:
+						if y >= caveLavaLevel {
+							t.Fatalf("lava at y=%d, above lava level", y)
+						}
+						carved++
+					}
+				}
+			}
+		}
+	}
+
+	if carved == 0 {
+		t.Error("no caves carved")
+	}
+}
+
+// TestCaveCarver_Borders checks that caves line up across chunk borders,
+// whichever chunk is carved first.
+func TestCaveCarver_Borders(t *testing.T) {
+	edge, matched := 0, 0
+
+	for x := 0; x < 6; x++ {
+		for z := 0; z < 6; z++ {
+			leftLoc := ChunkXz{ChunkCoord(x), ChunkCoord(z)}
+			rightLoc := ChunkXz{ChunkCoord(x + 1), ChunkCoord(z)}
+
+			// Carve the chunks in opposite orders with separate carvers.
+			right := carvedStoneChunk(NewCaveCarver(42), rightLoc)
+			left := carvedStoneChunk(NewCaveCarver(42), leftLoc)
+
+			for sz := 0; sz < ChunkSizeH; sz++ {
+				for y := 1; y < ChunkSizeY-1; y++ {
+					leftSub := SubChunkXyz{X: ChunkSizeH - 1, Y: SubChunkCoord(y), Z: SubChunkCoord(sz)}
+					leftIndex, _ := leftSub.BlockIndex()
+					if !isCarved(left.blocks[leftIndex]) {
+						continue
+					}
+					edge++
+
+					// A tunnel through the border continues into a neighbouring
+					// block of the next chunk.
+					rightSub := SubChunkXyz{X: 0, Y: SubChunkCoord(y), Z: SubChunkCoord(sz)}
+					rightIndex, _ := rightSub.BlockIndex()
+					if isCarved(right.blocks[rightIndex]) ||
+						isCarved(right.blocks[rightIndex-1]) ||
+						isCarved(right.blocks[rightIndex+1]) {
+						matched++
+					}
+				}
+			}
+		}
+	}
+
+	if edge == 0 {
+		t.Fatal("no caves at chunk borders")
+	}
+	// Blocks at the edge of a tunnel may only touch the border diagonally.
+	if matched*10 < edge*8 {
+		t.Errorf("only %d of %d carved border blocks continue into the next chunk", matched, edge)
+	}
+}
+
+func TestDumpSlice(t *testing.T) {
+	data := carvedStoneChunk(NewCaveCarver(42), ChunkXz{1, 1})
+
+	dump := DumpSlice(data, 8)
+	lines := strings.Split(strings.TrimSuffix(dump, "\n"), "\n")
+	if len(lines) != ChunkSizeY {
+		t.Fatalf("dump has %d lines, want %d", len(lines), ChunkSizeY)
+	}
+	for _, line := range lines {
+		if len(line) != ChunkSizeH {
+			t.Fatalf("dump line %q has length %d, want %d", line, len(line), ChunkSizeH)
+		}
+	}
+	if lines[ChunkSizeY-1] != strings.Repeat("=", ChunkSizeH) {
+		t.Errorf("bottom line %q is not bedrock", lines[ChunkSizeY-1])
+	}
+}
@@ -4,11 +4,9 @@ import (
 	"chunkymonkey/chunkstore"
 	"chunkymonkey/gamerules"
 	. "chunkymonkey/types"
-	"errors"
 	"math/rand"
 	"nbt"
 	"perlin"
-	"time"
 )
 
 const SeaLevel = 63
@@ -21,9 +19,17 @@ type ChunkData struct {
 	blockLight []byte
 	skyLight   []byte
 	heightMap  []byte
+	biomes     []byte
+
+	tileEntities []gamerules.ITileEntity
 }
 
 func newChunkData(loc ChunkXz) *ChunkData {
+	biomes := make([]byte, ChunkBiomesSize)
+	for i := range biomes {
+		biomes[i] = byte(BiomePlains)
+	}
+
 	return &ChunkData{
 		loc:        loc,
 		blocks:     make([]byte, ChunkSizeH*ChunkSizeH*ChunkSizeY),
@@ -31,9 +37,36 @@ func newChunkData(loc ChunkXz) *ChunkData {
 		skyLight:   make([]byte, (ChunkSizeH*ChunkSizeH*ChunkSizeY)>>1),
 		blockLight: make([]byte, (ChunkSizeH*ChunkSizeH*ChunkSizeY)>>1),
 		heightMap:  make([]byte, ChunkSizeH*ChunkSizeH),
+		biomes:     biomes,
 	}
 }
 
+// clone returns a copy of the chunk data.
+func (data *ChunkData) clone() *ChunkData {
+	return &ChunkData{
+		loc:        data.loc,
+		blocks:     cloneBytes(data.blocks),
+		blockData:  cloneBytes(data.blockData),
+		blockLight: cloneBytes(data.blockLight),
+		skyLight:   cloneBytes(data.skyLight),
+		heightMap:  cloneBytes(data.heightMap),
+		biomes:     cloneBytes(data.biomes),
+
+		tileEntities: append([]gamerules.ITileEntity(nil), data.tileEntities...),
+	}
+}
+
+func cloneBytes(in []byte) []byte {
+	return append([]byte(nil), in...)
+}
+
+// chunkRand returns a random number generator seeded from the seed and a
+// chunk location.
+func chunkRand(seed int64, loc ChunkXz) *rand.Rand {
+	return rand.New(rand.NewSource(
+		seed ^ int64(loc.X)*341873128712 ^ int64(loc.Z)*132897987541))
+}
+
 func (data *ChunkData) ChunkLoc() ChunkXz {
 	return data.loc
 }
@@ -58,34 +91,39 @@ func (data *ChunkData) HeightMap() []byte {
 	return data.heightMap
 }
 
+func (data *ChunkData) Biomes() []byte {
+	return data.biomes
+}
+
 func (data *ChunkData) Entities() []gamerules.INonPlayerEntity {
 	return nil
 }
 
 func (data *ChunkData) TileEntities() []gamerules.ITileEntity {
-	return nil
+	return data.tileEntities
 }
 
 func (data *ChunkData) RootTag() nbt.ITag {
 	return nil
 }
 
+func init() {
+	RegisterGenerator("test", func(seed int64, options string) (chunkstore.IChunkStoreForeground, error) {
+		return NewTestGenerator(seed), nil
+	})
+}
+
 // TestGenerator implements chunkstore.IChunkStore.
 type TestGenerator struct {
+	seed         int64
 	heightSource ISource
-	randSource   rand.Source
-	randGen      *rand.Rand
 }
 
 func NewTestGenerator(seed int64) *TestGenerator {
 	perlin := perlin.NewPerlinNoise(seed)
 
-	randSource := rand.NewSource(time.Now().Unix())
-	randGen := rand.New(randSource)
-
 	return &TestGenerator{
-		randSource: randSource,
-		randGen:    randGen,
+		seed: seed,
 		heightSource: &Sum{
 			Inputs: []ISource{
 				&Turbulence{
@@ -135,7 +173,7 @@ func (s *TestGenerator) Writer() chunkstore.IChunkWriter {
 }
 
 func (s *TestGenerator) WriteChunk(writer chunkstore.IChunkWriter) error {
-	return errors.New("writes not supported by TestGenerator")
+	return chunkstore.ErrReadOnlyStore
 }
 
 func (gen *TestGenerator) ReadChunk(chunkLoc ChunkXz) (reader chunkstore.IChunkReader, err error) {
@@ -169,8 +207,10 @@ func (gen *TestGenerator) ReadChunk(chunkLoc ChunkXz) (reader chunkstore.IChunkR
 		}
 	}
 
+	addBasement(gen.seed, data)
+
 	// The chunk has been generated, now add some trees if appropriate
-	gen.addSaplings(data)
+	gen.addSaplings(data, chunkRand(gen.seed, chunkLoc))
 	gen.setSkylight(data)
 
 	return data, nil
@@ -247,7 +287,10 @@ func (gen *TestGenerator) setSkylight(data *ChunkData) {
 
 }
 
-func (gen *TestGenerator) addSaplings(data *ChunkData) {
+// addSaplings plants saplings on grass. rnd is seeded from the chunk location,
+// so that the saplings don't depend on the order in which chunks are
+// generated.
+func (gen *TestGenerator) addSaplings(data *ChunkData, rnd *rand.Rand) {
 	baseIndex := 0
 	heightMapIndex := 0
 
@@ -260,7 +303,7 @@ func (gen *TestGenerator) addSaplings(data *ChunkData) {
 
 			if data.blocks[blockIndex] == 2 {
 				// We could add a tree, check to see if we want to
-				addTree := gen.randGen.Intn(100) > 95
+				addTree := rnd.Intn(100) > 95
 				if addTree && x > 0 && x < ChunkSizeH-1 && z > 0 && z < ChunkSizeH-1 {
 					if !adjacentBlockIs(data, x, topBlock, z, 2, 2, 2, 6) {
 						// Check if an adjacent block has a sapling already
@@ -0,0 +1,230 @@
+package generation
+
+import (
+	"container/list"
+	"sync"
+
+	"chunkymonkey/gamerules"
+	. "chunkymonkey/types"
+)
+
+// IDecorator adds features, such as trees, to chunks after their terrain has
+// been generated.
+//
+// Each feature starts in an origin chunk and may extend up to one chunk
+// beyond it. A chunk is decorated by running the decorators for it and each
+// of its neighbours, in a fixed order, and keeping the blocks that land in
+// it. Decorators only see undecorated terrain, and the origins are always
+// decorated in the same order, so the result doesn't depend on the order in
+// which chunks are generated.
+type IDecorator interface {
+	// Decorate adds the features starting in the origin chunk of the region.
+	// rnd is seeded from the origin chunk location, and must be the only
+	// source of randomness.
+	Decorate(region *DecorationRegion, rnd IRand)
+}
+
+// IRand is the subset of *rand.Rand used by decorators.
+type IRand interface {
+	Intn(n int) int
+	Float64() float64
+}
+
+// DecorationRegion is the area that a decorator may change: an origin chunk
+// and its neighbours. Coordinates are block coordinates relative to the
+// corner of the origin chunk, so X and Z are in the range [-ChunkSizeH,
+// 2*ChunkSizeH).
+type DecorationRegion struct {
+	origin *ChunkData
+	target *ChunkData
+
+	// neighbour returns the undecorated terrain of the origin's neighbours.
+	neighbour func(loc ChunkXz) *ChunkData
+
+	// The offset of the target chunk's corner from the origin chunk's corner.
+	targetX, targetZ int
+}
+
+// newDecorationRegion creates a region for decorating target with the
+// features starting in origin, which must be target or a neighbour of it.
+// neighbour returns the undecorated terrain of the origin's neighbours, and
+// may be nil if decorators don't look beyond the origin.
+func newDecorationRegion(origin, target *ChunkData, neighbour func(loc ChunkXz) *ChunkData) *DecorationRegion {
+	return &DecorationRegion{
+		origin:    origin,
+		target:    target,
+		neighbour: neighbour,
+		targetX:   int(target.loc.X-origin.loc.X) * ChunkSizeH,
+		targetZ:   int(target.loc.Z-origin.loc.Z) * ChunkSizeH,
+	}
+}
+
+// Origin returns the location of the origin chunk.
+func (region *DecorationRegion) Origin() ChunkXz {
+	return region.origin.loc
+}
+
+// Block returns the terrain block at a location in the region, before any
+// decoration.
+func (region *DecorationRegion) Block(x, y, z int) byte {
+	if y < 0 || y >= ChunkSizeY {
+		return 0
+	}
+
+	data := region.origin
+	chunkX, chunkZ := floorDivInt(x, ChunkSizeH), floorDivInt(z, ChunkSizeH)
+	if chunkX != 0 || chunkZ != 0 {
+		if region.neighbour == nil {
+			return 0
+		}
+		loc := ChunkXz{region.origin.loc.X + ChunkCoord(chunkX), region.origin.loc.Z + ChunkCoord(chunkZ)}
+		data = region.neighbour(loc)
+		x -= chunkX * ChunkSizeH
+		z -= chunkZ * ChunkSizeH
+	}
+	return data.blocks[(x*ChunkSizeH+z)*ChunkSizeY+y]
+}
+
+// Biome returns the biome of a column in the origin chunk.
+func (region *DecorationRegion) Biome(x, z int) BiomeId {
+	subLoc := SubChunkXyz{X: SubChunkCoord(x), Z: SubChunkCoord(z)}
+	return BiomeId(region.origin.biomes[subLoc.BiomeIndex()])
+}
+
+// Top returns the Y coordinate of the highest non-air block in a column of
+// the region, before any decoration.
+func (region *DecorationRegion) Top(x, z int) int {
+	top := ChunkSizeY - 1
+	for top > 0 && region.Block(x, top, z) == 0 {
+		top--
+	}
+	return top
+}
+
+// Place sets a block if it is in the chunk being generated, and the existing
+// block there can be replaced: air can always be replaced, and logs may
+// replace leaves, saplings and snow.
+func (region *DecorationRegion) Place(x, y, z int, blockId byte) {
+	x -= region.targetX
+	z -= region.targetZ
+	if x < 0 || x >= ChunkSizeH || z < 0 || z >= ChunkSizeH || y < 0 || y >= ChunkSizeY {
+		return
+	}
+
+	index := (x*ChunkSizeH+z)*ChunkSizeY + y
+	switch existing := region.target.blocks[index]; {
+	case existing == 0:
+	case blockId == 17 && (existing == 18 || existing == 6 || existing == 78):
+	default:
+		return
+	}
+	region.target.blocks[index] = blockId
+}
+
+// Replace sets a block if it is in the chunk being generated, whatever is
+// there already, except that bedrock is never replaced.
+func (region *DecorationRegion) Replace(x, y, z int, blockId byte) {
+	x -= region.targetX
+	z -= region.targetZ
+	if x < 0 || x >= ChunkSizeH || z < 0 || z >= ChunkSizeH || y < 0 || y >= ChunkSizeY {
+		return
+	}
+
+	index := (x*ChunkSizeH+z)*ChunkSizeY + y
+	if BlockId(region.target.blocks[index]) == BlockIdBedrock {
+		return
+	}
+	region.target.blocks[index] = blockId
+}
+
+// Contains returns true if a column is in the chunk being generated. Blocks
+// placed elsewhere are discarded, so decorators need only create costly
+// things, such as tile entities, in the columns it contains.
+func (region *DecorationRegion) Contains(x, z int) bool {
+	x -= region.targetX
+	z -= region.targetZ
+	return x >= 0 && x < ChunkSizeH && z >= 0 && z < ChunkSizeH
+}
+
+// BlockXyz returns the world location of a block in the region.
+func (region *DecorationRegion) BlockXyz(x, y, z int) BlockXyz {
+	corner := region.origin.loc.ChunkCornerBlockXY()
+	return BlockXyz{corner.X + BlockCoord(x), BlockYCoord(y), corner.Z + BlockCoord(z)}
+}
+
+// AddTileEntity adds a tile entity to the chunk being generated, if its block
+// is in it.
+func (region *DecorationRegion) AddTileEntity(x, y, z int, tileEntity gamerules.ITileEntity) {
+	if region.Contains(x, z) && y >= 0 && y < ChunkSizeY {
+		region.target.tileEntities = append(region.target.tileEntities, tileEntity)
+	}
+}
+
+// decorate decorates the target chunk with the features starting in it and
+// its neighbours. neighbour returns the undecorated terrain of a chunk.
+func decorate(seed int64, target *ChunkData, decorators []IDecorator, neighbour func(loc ChunkXz) *ChunkData) {
+	// The target is modified as it is decorated, so decorate from a copy of
+	// its terrain.
+	terrain := target.clone()
+
+	for dx := ChunkCoord(-1); dx <= 1; dx++ {
+		for dz := ChunkCoord(-1); dz <= 1; dz++ {
+			loc := ChunkXz{target.loc.X + dx, target.loc.Z + dz}
+			origin := terrain
+			if dx != 0 || dz != 0 {
+				origin = neighbour(loc)
+			}
+
+			region := newDecorationRegion(origin, target, neighbour)
+			rnd := chunkRand(seed, loc)
+			for _, decorator := range decorators {
+				decorator.Decorate(region, rnd)
+			}
+		}
+	}
+}
+
+// terrainCache keeps the undecorated terrain of recently generated chunks, as
+// it is needed again to decorate their neighbours.
+type terrainCache struct {
+	lock     sync.Mutex
+	capacity int
+	lru      *list.List // Of *ChunkData, most recently used first.
+	entries  map[ChunkXz]*list.Element
+}
+
+func newTerrainCache(capacity int) *terrainCache {
+	return &terrainCache{
+		capacity: capacity,
+		lru:      list.New(),
+		entries:  make(map[ChunkXz]*list.Element),
+	}
+}
+
+// get returns the terrain of a chunk, calling generate if it isn't cached.
+// The returned data must not be modified.
+func (cache *terrainCache) get(loc ChunkXz, generate func(loc ChunkXz) *ChunkData) *ChunkData {
+	cache.lock.Lock()
+	if elem, ok := cache.entries[loc]; ok {
+		cache.lru.MoveToFront(elem)
+		cache.lock.Unlock()
+		return elem.Value.(*ChunkData)
+	}
+	cache.lock.Unlock()
+
+	// Generate without the lock held. Another goroutine may generate the same
+	// chunk at the same time, in which case the results are identical.
+	data := generate(loc)
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	if _, ok := cache.entries[loc]; !ok {
+		cache.entries[loc] = cache.lru.PushFront(data)
+		for cache.lru.Len() > cache.capacity {
+			oldest := cache.lru.Back()
+			cache.lru.Remove(oldest)
+			delete(cache.entries, oldest.Value.(*ChunkData).loc)
+		}
+	}
+	return data
+}
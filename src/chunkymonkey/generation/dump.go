@@ -0,0 +1,47 @@
+package generation
+
+import (
+	"bytes"
+
+	"chunkymonkey/chunkstore"
+	. "chunkymonkey/types"
+)
+
+// dumpChars are the characters used by DumpSlice for each block type. Other
+// blocks are shown as '?'.
+var dumpChars = map[byte]byte{
+	0:  ' ', // air
+	1:  '#', // stone
+	2:  '"', // grass
+	3:  '%', // dirt
+	6:  'T', // sapling
+	7:  '=', // bedrock
+	9:  '~', // water
+	11: '@', // lava
+	12: '.', // sand
+	78: '^', // snow
+	79: '-', // ice
+}
+
+// DumpSlice returns a side view of the blocks in a chunk with the given Z
+// coordinate as ASCII art, with the top of the world first. It is intended
+// for reviewing the output of generators.
+func DumpSlice(reader chunkstore.IChunkReader, z SubChunkCoord) string {
+	blocks := reader.Blocks()
+	buf := new(bytes.Buffer)
+
+	for y := ChunkSizeY - 1; y >= 0; y-- {
+		for x := 0; x < ChunkSizeH; x++ {
+			subLoc := SubChunkXyz{X: SubChunkCoord(x), Y: SubChunkCoord(y), Z: z}
+			index, _ := subLoc.BlockIndex()
+			c, ok := dumpChars[blocks[index]]
+			if !ok {
+				c = '?'
+			}
+			buf.WriteByte(c)
+		}
+		buf.WriteByte('\n')
+	}
+
+	return buf.String()
+}
@@ -0,0 +1,215 @@
+package generation
+
+import (
+	"chunkymonkey/gamerules"
+	"chunkymonkey/logger"
+	"chunkymonkey/loot"
+	"chunkymonkey/nbtutil"
+	. "chunkymonkey/types"
+	"nbt"
+)
+
+const (
+	// dungeonAttempts is the number of places in each chunk that a dungeon
+	// is tried. Most aren't next to a cave, so have no dungeon.
+	dungeonAttempts = 8
+
+	// dungeonHeight is the height inside a dungeon room.
+	dungeonHeight = 3
+
+	// dungeonChestSlots is the number of slots in a dungeon chest.
+	dungeonChestSlots = 27
+)
+
+// dungeonMobs are the mobs that dungeon spawners may be for.
+var dungeonMobs = []string{"Skeleton", "Zombie", "Zombie", "Spider"}
+
+// DungeonLoot is the contents of dungeon chests.
+var DungeonLoot = loot.Table{
+	MinRolls: 3,
+	MaxRolls: 8,
+	Entries: []loot.Entry{
+		{ItemTypeId: 329, MinCount: 1, MaxCount: 1, Weight: 10},         // saddle
+		{ItemTypeId: 265, MinCount: 1, MaxCount: 4, Weight: 10},         // iron ingot
+		{ItemTypeId: 297, MinCount: 1, MaxCount: 1, Weight: 10},         // bread
+		{ItemTypeId: 296, MinCount: 1, MaxCount: 4, Weight: 10},         // wheat
+		{ItemTypeId: 289, MinCount: 1, MaxCount: 4, Weight: 10},         // gunpowder
+		{ItemTypeId: 287, MinCount: 1, MaxCount: 4, Weight: 10},         // string
+		{ItemTypeId: 325, MinCount: 1, MaxCount: 1, Weight: 10},         // bucket
+		{ItemTypeId: 322, MinCount: 1, MaxCount: 1, Weight: 1},          // golden apple
+		{ItemTypeId: 331, MinCount: 1, MaxCount: 4, Weight: 5},          // redstone
+		{ItemTypeId: 2256, MinCount: 1, MaxCount: 1, Weight: 1},         // record 13
+		{ItemTypeId: 2257, MinCount: 1, MaxCount: 1, Weight: 1},         // record cat
+		{ItemTypeId: 351, Data: 3, MinCount: 1, MaxCount: 1, Weight: 2}, // cocoa beans
+	},
+}
+
+// DungeonDecorator places small rooms of cobblestone and mossy cobblestone
+// underground, where they open onto caves. Each has a mob spawner in the
+// middle, and a chest of DungeonLoot against a wall. Rooms may extend into
+// neighbouring chunks.
+type DungeonDecorator struct{}
+
+func (decorator DungeonDecorator) Decorate(region *DecorationRegion, rnd IRand) {
+	for i := 0; i < dungeonAttempts; i++ {
+		room := dungeonRoom{
+			x:  rnd.Intn(ChunkSizeH),
+			y:  BasementHeight + 1 + rnd.Intn(ChunkSizeY-BasementHeight-dungeonHeight-8),
+			z:  rnd.Intn(ChunkSizeH),
+			rx: 2 + rnd.Intn(2),
+			rz: 2 + rnd.Intn(2),
+		}
+		if room.fits(region) {
+			room.build(region, rnd)
+		}
+	}
+}
+
+// dungeonRoom is a dungeon with its floor at y, centred on (x, z). The
+// inside extends rx and rz blocks either side of the centre, and the walls
+// are one block beyond that.
+type dungeonRoom struct {
+	x, y, z int
+	rx, rz  int
+}
+
+// isSolidTerrain returns true for terrain blocks that dungeons may be built
+// into.
+func isSolidTerrain(blockId byte) bool {
+	switch blockId {
+	case 0, 8, 9, 10, 11: // air, water, lava
+		return false
+	}
+	return true
+}
+
+// fits returns true if the room is enclosed by solid ground above and below,
+// under the surface, and has from one to five openings in its walls, such as
+// onto a cave.
+func (room *dungeonRoom) fits(region *DecorationRegion) bool {
+	ceiling := room.y + dungeonHeight + 1
+	openings := 0
+
+	for dx := -room.rx - 1; dx <= room.rx+1; dx++ {
+		for dz := -room.rz - 1; dz <= room.rz+1; dz++ {
+			x, z := room.x+dx, room.z+dz
+			if !isSolidTerrain(region.Block(x, room.y, z)) || !isSolidTerrain(region.Block(x, ceiling, z)) {
+				return false
+			}
+			// Keep some ground over the ceiling.
+			if region.Top(x, z) <= ceiling+1 {
+				return false
+			}
+
+			wall := dx == -room.rx-1 || dx == room.rx+1 || dz == -room.rz-1 || dz == room.rz+1
+			if wall && region.Block(x, room.y+1, z) == 0 && region.Block(x, room.y+2, z) == 0 {
+				openings++
+			}
+		}
+	}
+
+	return openings >= 1 && openings <= 5
+}
+
+// build builds the room. The same numbers are drawn from rnd whichever chunk
+// is being decorated.
+func (room *dungeonRoom) build(region *DecorationRegion, rnd IRand) {
+	for dx := -room.rx - 1; dx <= room.rx+1; dx++ {
+		for dz := -room.rz - 1; dz <= room.rz+1; dz++ {
+			x, z := room.x+dx, room.z+dz
+			wall := dx == -room.rx-1 || dx == room.rx+1 || dz == -room.rz-1 || dz == room.rz+1
+
+			for dy := 0; dy <= dungeonHeight+1; dy++ {
+				y := room.y + dy
+				switch {
+				case dy == 0:
+					if rnd.Intn(4) == 0 {
+						region.Replace(x, y, z, 4) // cobblestone
+					} else {
+						region.Replace(x, y, z, 48) // mossy cobblestone
+					}
+				case wall || dy == dungeonHeight+1:
+					// Leave the openings.
+					if isSolidTerrain(region.Block(x, y, z)) {
+						region.Replace(x, y, z, 4) // cobblestone
+					}
+				default:
+					region.Replace(x, y, z, 0)
+				}
+			}
+		}
+	}
+
+	// The chest goes against a wall, along a random side.
+	var chestX, chestZ int
+	along := rnd.Intn(2*room.rx+1) - room.rx
+	across := rnd.Intn(2*room.rz+1) - room.rz
+	switch rnd.Intn(4) {
+	case 0:
+		chestX, chestZ = room.x-room.rx, room.z+across
+	case 1:
+		chestX, chestZ = room.x+room.rx, room.z+across
+	case 2:
+		chestX, chestZ = room.x+along, room.z-room.rz
+	default:
+		chestX, chestZ = room.x+along, room.z+room.rz
+	}
+	items := DungeonLoot.Roll(rnd)
+	if len(items) > dungeonChestSlots {
+		items = items[:dungeonChestSlots]
+	}
+	slots := chestSlots(len(items), rnd)
+	mob := dungeonMobs[rnd.Intn(len(dungeonMobs))]
+
+	chestY := room.y + 1
+	region.Replace(chestX, chestY, chestZ, 54) // chest
+	if region.Contains(chestX, chestZ) {
+		tag := nbt.NewCompound()
+		nbtutil.WriteBlockXyzCompound(tag, region.BlockXyz(chestX, chestY, chestZ))
+		itemList := &nbt.List{nbt.TagCompound, nil}
+		for i := range items {
+			slotTag := nbt.NewCompound()
+			slotTag.Set("Slot", &nbt.Byte{int8(slots[i])})
+			items[i].MarshalNbt(slotTag)
+			itemList.Value = append(itemList.Value, slotTag)
+		}
+		tag.Set("Items", itemList)
+		addTileEntity(region, chestX, chestY, chestZ, "Chest", tag)
+	}
+
+	spawnerY := room.y + 1
+	region.Replace(room.x, spawnerY, room.z, 52) // mob spawner
+	if region.Contains(room.x, room.z) {
+		// Spawners don't spawn anything yet, but are ready for when they do.
+		tag := nbt.NewCompound()
+		nbtutil.WriteBlockXyzCompound(tag, region.BlockXyz(room.x, spawnerY, room.z))
+		tag.Set("EntityId", &nbt.String{mob})
+		tag.Set("Delay", &nbt.Short{20})
+		addTileEntity(region, room.x, spawnerY, room.z, "MobSpawner", tag)
+	}
+}
+
+// chestSlots returns n different slots of a dungeon chest, chosen at random.
+func chestSlots(n int, rnd IRand) []int {
+	slots := make([]int, dungeonChestSlots)
+	for i := range slots {
+		slots[i] = i
+	}
+	// A partial Fisher-Yates shuffle.
+	for i := 0; i < n; i++ {
+		j := i + rnd.Intn(dungeonChestSlots-i)
+		slots[i], slots[j] = slots[j], slots[i]
+	}
+	return slots[:n]
+}
+
+// addTileEntity creates a tile entity of the given type from its NBT data,
+// and adds it to the region.
+func addTileEntity(region *DecorationRegion, x, y, z int, typeName string, tag *nbt.Compound) {
+	tileEntity := gamerules.NewTileEntityByTypeName(typeName)
+	if err := tileEntity.UnmarshalNbt(tag); err != nil {
+		logger.World.Error("Generated tile entity is invalid", "type", typeName, "err", err)
+		return
+	}
+	region.AddTileEntity(x, y, z, tileEntity)
+}
@@ -0,0 +1,203 @@
+package generation
+
+import (
+	"math/rand"
+	"testing"
+
+	"chunkymonkey/chunkstore"
+	"chunkymonkey/gamerules"
+	. "chunkymonkey/types"
+	"nbt"
+)
+
+// findDungeons returns the locations of the mob spawners of dungeons in a
+// square of chunks.
+func findDungeons(t *testing.T, gen chunkstore.IChunkStoreForeground, size ChunkCoord) (spawners []BlockXyz) {
+	for x := ChunkCoord(0); x < size; x++ {
+		for z := ChunkCoord(0); z < size; z++ {
+			loc := ChunkXz{x, z}
+			reader, err := gen.ReadChunk(loc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for index, blockId := range reader.Blocks() {
+				if blockId == 52 {
+					subLoc := BlockIndex(index).ToSubChunkXyz()
+					spawners = append(spawners, *loc.ToBlockXyz(&subLoc))
+				}
+			}
+		}
+	}
+	return
+}
+
+// readBlock returns the chunk containing a block, and the block's index in
+// it.
+func readBlock(t *testing.T, gen chunkstore.IChunkStoreForeground, loc BlockXyz) (chunkstore.IChunkReader, int) {
+	chunkLoc, subLoc := loc.ToChunkLocal()
+	reader, err := gen.ReadChunk(*chunkLoc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, _ := subLoc.BlockIndex()
+	return reader, int(index)
+}
+
+// tileEntityAt returns the tile entity of a chunk at a location, if there is
+// one.
+func tileEntityAt(reader chunkstore.IChunkReader, loc BlockXyz) gamerules.ITileEntity {
+	for _, tileEntity := range reader.TileEntities() {
+		if tileEntity.Block() == loc {
+			return tileEntity
+		}
+	}
+	return nil
+}
+
+func TestDungeonDecorator(t *testing.T) {
+	gen := NewNoiseGenerator(42, testNoiseParams())
+	spawners := findDungeons(t, gen, 12)
+	if len(spawners) == 0 {
+		t.Fatal("no dungeons found")
+	}
+
+	for _, spawner := range spawners {
+		reader, index := readBlock(t, gen, spawner)
+		blocks := reader.Blocks()
+		if tileEntityAt(reader, spawner) == nil {
+			t.Errorf("%v: spawner has no tile entity", spawner)
+		}
+		if floor := blocks[index-1]; floor != 4 && floor != 48 {
+			t.Errorf("%v: spawner stands on block %d, not the dungeon floor", spawner, floor)
+		}
+
+		// Under the surface.
+		column := index - int(spawner.Y)
+		if top := int(reader.HeightMap()[column/ChunkSizeY]); top <= int(spawner.Y)+dungeonHeight+1 {
+			t.Errorf("%v: dungeon breaches the surface at y=%d", spawner, top)
+		}
+
+		// A chest of loot against a wall.
+		chests := 0
+		for dx := -3; dx <= 3; dx++ {
+			for dz := -3; dz <= 3; dz++ {
+				loc := BlockXyz{spawner.X + BlockCoord(dx), spawner.Y, spawner.Z + BlockCoord(dz)}
+				reader, index := readBlock(t, gen, loc)
+				if reader.Blocks()[index] != 54 {
+					continue
+				}
+				chests++
+
+				chest := tileEntityAt(reader, loc)
+				if chest == nil {
+					t.Errorf("%v: chest has no tile entity", loc)
+					continue
+				}
+				tag := nbt.NewCompound()
+				chest.MarshalNbt(tag)
+				if items, ok := nbt.GetList(tag, "Items", nbt.TagCompound); !ok || len(items.Value) == 0 {
+					t.Errorf("%v: chest is empty", loc)
+				}
+				if id, _ := nbt.GetString(tag, "id"); id != "Chest" {
+					t.Errorf("%v: chest saved as %q", loc, id)
+				}
+			}
+		}
+		if chests != 1 {
+			t.Errorf("%v: %d chests in the dungeon", spawner, chests)
+		}
+	}
+}
+
+// TestDungeonDecorator_Order checks that dungeons crossing chunk borders are
+// the same whichever chunk is generated first.
+func TestDungeonDecorator_Order(t *testing.T) {
+	spawners := findDungeons(t, NewNoiseGenerator(42, testNoiseParams()), 12)
+
+	for _, spawner := range spawners {
+		centre, _ := spawner.ToChunkLocal()
+		var locs []ChunkXz
+		for dx := ChunkCoord(-1); dx <= 1; dx++ {
+			for dz := ChunkCoord(-1); dz <= 1; dz++ {
+				locs = append(locs, ChunkXz{centre.X + dx, centre.Z + dz})
+			}
+		}
+
+		forward := NewNoiseGenerator(42, testNoiseParams())
+		hashes := make(map[ChunkXz]string)
+		for _, loc := range locs {
+			hashes[loc] = readChunkHash(t, forward, loc)
+		}
+
+		for i := len(locs) - 1; i >= 0; i-- {
+			gen := NewNoiseGenerator(42, testNoiseParams())
+			if hash := readChunkHash(t, gen, locs[i]); hash != hashes[locs[i]] {
+				t.Errorf("%v: generated differently", locs[i])
+			}
+		}
+	}
+}
+
+func TestDecorationRegion_Neighbours(t *testing.T) {
+	origin := newStoneChunk(ChunkXz{0, 0})
+	neighbours := make(map[ChunkXz]*ChunkData)
+	region := newDecorationRegion(origin, origin, func(loc ChunkXz) *ChunkData {
+		if neighbours[loc] == nil {
+			neighbours[loc] = newChunkData(loc)
+			neighbours[loc].blocks[5] = byte(loc.X + 10*loc.Z + 20)
+		}
+		return neighbours[loc]
+	})
+
+	// Only the block at the corner of each neighbour is set.
+	tests := []struct {
+		x, z int
+		want byte
+	}{
+		{0, 0, 1},
+		{-ChunkSizeH, 0, 19},
+		{-ChunkSizeH, -ChunkSizeH, 9},
+		{ChunkSizeH, 0, 21},
+		{ChunkSizeH, ChunkSizeH, 31},
+		{-1, 0, 0},
+	}
+	for _, test := range tests {
+		if block := region.Block(test.x, 5, test.z); block != test.want {
+			t.Errorf("Block(%d, 5, %d) = %d, want %d", test.x, test.z, block, test.want)
+		}
+	}
+
+	region.Replace(0, 0, 0, 4)
+	region.Replace(0, 1, 0, 0)
+	if origin.blocks[0] != 7 {
+		t.Error("replaced bedrock")
+	}
+	if origin.blocks[1] != 0 {
+		t.Error("didn't replace stone")
+	}
+}
+
+// constRand always returns the same random numbers.
+type constRand struct{}
+
+func (constRand) Intn(n int) int   { return 0 }
+func (constRand) Float64() float64 { return 0 }
+
+func TestChestSlots(t *testing.T) {
+	rnds := []IRand{constRand{}, rand.New(rand.NewSource(1))}
+	for _, rnd := range rnds {
+		for n := 0; n <= dungeonChestSlots; n++ {
+			slots := chestSlots(n, rnd)
+			if len(slots) != n {
+				t.Fatalf("%T: expected %d slots, got %d", rnd, n, len(slots))
+			}
+			seen := make(map[int]bool)
+			for _, slot := range slots {
+				if slot < 0 || slot >= dungeonChestSlots || seen[slot] {
+					t.Fatalf("%T: bad or repeated slot %d in %v", rnd, slot, slots)
+				}
+				seen[slot] = true
+			}
+		}
+	}
+}
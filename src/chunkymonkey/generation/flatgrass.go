@@ -0,0 +1,109 @@
+package generation
+
+import (
+	"chunkymonkey/chunkstore"
+	. "chunkymonkey/types"
+)
+
+// FlatgrassGenerator generates flat terrain from a list of layers, by default
+// FlatgrassLayers. If the sea level is above the top layer, it is covered
+// with water, and grass on top becomes sand. It implements
+// chunkstore.IChunkStoreForeground.
+type FlatgrassGenerator struct {
+	// template is a generated chunk, which every chunk is a copy of.
+	template *ChunkData
+}
+
+func init() {
+	RegisterGenerator("flatgrass", func(seed int64, options string) (chunkstore.IChunkStoreForeground, error) {
+		if options == "" {
+			return NewFlatgrassGenerator(*seaLevelFlag), nil
+		}
+		layers, err := ParseFlatLayers(options)
+		if err != nil {
+			return nil, err
+		}
+		return NewFlatGenerator(layers, *seaLevelFlag), nil
+	})
+}
+
+const (
+	// FlatgrassLayers are the default layers of flatgrass worlds: bedrock at
+	// y=0, stone up to y=60, dirt up to y=63, and grass at y=64.
+	FlatgrassLayers = "7,60x1,3x3,2"
+	// FlatgrassHeight is the height of the grass in flatgrass worlds.
+	FlatgrassHeight = 64
+)
+
+// NewFlatgrassGenerator creates a generator of FlatgrassLayers.
+func NewFlatgrassGenerator(seaLevel int) *FlatgrassGenerator {
+	layers, err := ParseFlatLayers(FlatgrassLayers)
+	if err != nil {
+		panic(err)
+	}
+	return NewFlatGenerator(layers, seaLevel)
+}
+
+// NewFlatGenerator creates a generator of the given layers, as returned by
+// ParseFlatLayers.
+func NewFlatGenerator(layers []FlatLayer, seaLevel int) *FlatgrassGenerator {
+	data := newChunkData(ChunkXz{})
+
+	baseIndex := 0
+	for heightMapIndex := range data.heightMap {
+		blocks := data.blocks[baseIndex : baseIndex+ChunkSizeY]
+		y := 0
+		for _, layer := range layers {
+			for i := 0; i < layer.Count; i++ {
+				blocks[y] = byte(layer.BlockId)
+				y++
+			}
+		}
+		if top := y - 1; top >= 0 && top <= seaLevel && blocks[top] == 2 {
+			blocks[top] = 12 // sand
+		}
+		fillSea(blocks, seaLevel, false)
+
+		skyLight := data.skyLight[baseIndex>>1 : (baseIndex+ChunkSizeY)>>1]
+		data.heightMap[heightMapIndex] = byte(setColumnSkyLight(blocks, skyLight))
+		baseIndex += ChunkSizeY
+	}
+
+	return &FlatgrassGenerator{template: data}
+}
+
+func (gen *FlatgrassGenerator) SupportsWrite() bool {
+	return false
+}
+
+func (gen *FlatgrassGenerator) Writer() chunkstore.IChunkWriter {
+	return nil
+}
+
+func (gen *FlatgrassGenerator) WriteChunk(writer chunkstore.IChunkWriter) error {
+	return chunkstore.ErrReadOnlyStore
+}
+
+func (gen *FlatgrassGenerator) ReadChunk(chunkLoc ChunkXz) (reader chunkstore.IChunkReader, err error) {
+	// Copy the template, as the chunk data may be modified by its user.
+	data := gen.template.clone()
+	data.loc = chunkLoc
+	return data, nil
+}
+
+// NewFlatgrassWorld returns a served IChunkStore for a transient flatgrass
+// world, with modified chunks kept in memory. This gives tests a
+// predictable ground plane at FlatgrassHeight.
+func NewFlatgrassWorld() chunkstore.IChunkStore {
+	stores := []chunkstore.IChunkStore{
+		chunkstore.NewChunkService(chunkstore.NewMemoryStore()),
+		chunkstore.NewChunkService(NewFlatgrassGenerator(SeaLevel)),
+	}
+	for _, store := range stores {
+		go store.Serve()
+	}
+
+	world := chunkstore.NewChunkService(chunkstore.NewMultiStore(stores, chunkstore.PersistOnModify))
+	go world.Serve()
+	return world
+}
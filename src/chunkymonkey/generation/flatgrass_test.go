@@ -0,0 +1,174 @@
+package generation
+
+import (
+	"testing"
+
+	"chunkymonkey/chunkstore"
+	. "chunkymonkey/types"
+)
+
+func TestFlatgrassGenerator(t *testing.T) {
+	gen := NewFlatgrassGenerator(SeaLevel)
+	loc := ChunkXz{3, -2}
+
+	reader, err := gen.ReadChunk(loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reader.ChunkLoc() != loc {
+		t.Errorf("ChunkLoc() = %v, want %v", reader.ChunkLoc(), loc)
+	}
+
+	blocks := reader.Blocks()
+	skyLight := reader.SkyLight()
+	heightMap := reader.HeightMap()
+
+	for i, height := range heightMap {
+		if height != FlatgrassHeight+1 {
+			t.Fatalf("heightMap[%d] = %d, want %d", i, height, FlatgrassHeight+1)
+		}
+	}
+
+	for baseIndex := 0; baseIndex < len(blocks); baseIndex += ChunkSizeY {
+		for y := 0; y < ChunkSizeY; y++ {
+			var want byte
+			switch {
+			case y == 0:
+				want = 7
+			case y <= 60:
+				want = 1
+			case y <= 63:
+				want = 3
+			case y == 64:
+				want = 2
+			}
+			if got := blocks[baseIndex+y]; got != want {
+				t.Fatalf("block %d at y=%d = %d, want %d", baseIndex, y, got, want)
+			}
+
+			wantLight := byte(0)
+			if y > FlatgrassHeight {
+				wantLight = 15
+			}
+			column := skyLight[baseIndex>>1 : (baseIndex+ChunkSizeY)>>1]
+			if got := BlockIndex(y).BlockData(column); got != wantLight {
+				t.Fatalf("sky light %d at y=%d = %d, want %d", baseIndex, y, got, wantLight)
+			}
+		}
+	}
+}
+
+func TestFlatgrassGenerator_Copies(t *testing.T) {
+	gen := NewFlatgrassGenerator(SeaLevel)
+
+	reader, _ := gen.ReadChunk(ChunkXz{0, 0})
+	reader.Blocks()[FlatgrassHeight] = 0
+
+	reader, _ = gen.ReadChunk(ChunkXz{0, 0})
+	if reader.Blocks()[FlatgrassHeight] != 2 {
+		t.Error("modifying a generated chunk changed later chunks")
+	}
+}
+
+func TestFlatgrassWorld(t *testing.T) {
+	world := NewFlatgrassWorld()
+	loc := ChunkXz{1, 1}
+
+	result := <-world.ReadChunk(loc)
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if result.Source != chunkstore.ChunkSourceGenerated {
+		t.Errorf("Source = %v, want generated", result.Source)
+	}
+
+	writer := world.Writer()
+	writer.SetChunkLoc(loc)
+	blocks := append([]byte(nil), result.Reader.Blocks()...)
+	blocks[FlatgrassHeight] = 1
+	writer.SetBlocks(blocks)
+	writer.SetBlockData(result.Reader.BlockData())
+	writer.SetBlockLight(result.Reader.BlockLight())
+	writer.SetSkyLight(result.Reader.SkyLight())
+	writer.SetHeightMap(result.Reader.HeightMap())
+	if err := <-world.WriteChunk(writer); err != nil {
+		t.Fatal(err)
+	}
+
+	result = <-world.ReadChunk(loc)
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if result.Source != chunkstore.ChunkSourceStore {
+		t.Errorf("Source = %v, want store", result.Source)
+	}
+	if result.Reader.Blocks()[FlatgrassHeight] != 1 {
+		t.Error("written chunk was not read back")
+	}
+}
+
+func TestNewGenerator(t *testing.T) {
+	for _, name := range GeneratorNames() {
+		if _, err := NewGenerator(name, 0, ""); err != nil {
+			t.Errorf("NewGenerator(%q): %v", name, err)
+		}
+	}
+	if _, err := NewGenerator("nonesuch", 0, ""); err == nil {
+		t.Error("expected error for unknown generator")
+	}
+}
+
+func TestFlatgrassGenerator_Sea(t *testing.T) {
+	seaLevel := FlatgrassHeight + 4
+	gen := NewFlatgrassGenerator(seaLevel)
+
+	reader, err := gen.ReadChunk(ChunkXz{0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := reader.Blocks()
+	skyLight := reader.SkyLight()[:ChunkSizeY>>1]
+
+	if blocks[FlatgrassHeight] != 12 {
+		t.Errorf("block under the sea = %d, want sand", blocks[FlatgrassHeight])
+	}
+	for y := FlatgrassHeight + 1; y <= seaLevel; y++ {
+		if blocks[y] != 9 {
+			t.Errorf("block at y=%d = %d, want water", y, blocks[y])
+		}
+	}
+	if height := int(reader.HeightMap()[0]); height != seaLevel+1 {
+		t.Errorf("height map = %d, want %d", height, seaLevel+1)
+	}
+	if light := BlockIndex(FlatgrassHeight + 1).BlockData(skyLight); light != 3 {
+		t.Errorf("sky light under 4 blocks of water = %d, want 3", light)
+	}
+}
+
+func TestRegisterGenerator(t *testing.T) {
+	var gotSeed int64
+	var gotOptions string
+	RegisterGenerator("registered-for-test", func(seed int64, options string) (chunkstore.IChunkStoreForeground, error) {
+		gotSeed, gotOptions = seed, options
+		return NewFlatgrassGenerator(SeaLevel), nil
+	})
+	defer func() {
+		generatorsLock.Lock()
+		delete(generators, "registered-for-test")
+		generatorsLock.Unlock()
+	}()
+
+	if _, err := NewGenerator("registered-for-test", 5, "opts"); err != nil {
+		t.Fatal(err)
+	}
+	if gotSeed != 5 || gotOptions != "opts" {
+		t.Errorf("generator created with seed %d options %q, want 5 %q", gotSeed, gotOptions, "opts")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a generator twice didn't panic")
+		}
+	}()
+	RegisterGenerator("registered-for-test", nil)
+}
@@ -0,0 +1,73 @@
+package generation
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	. "chunkymonkey/types"
+)
+
+// FlatLayer is a layer of a flat world: Count blocks of BlockId.
+type FlatLayer struct {
+	BlockId BlockId
+	Count   int
+}
+
+// ParseFlatLayers parses a layer specification in the style of the standard
+// server's superflat presets. It is a comma separated list of layers from the
+// bottom of the world up, each a block ID optionally preceded by a count and
+// an "x". For example "7,2x3,2" is bedrock, two layers of dirt, and grass.
+func ParseFlatLayers(spec string) (layers []FlatLayer, err error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, fmt.Errorf("Empty flat layer specification")
+	}
+
+	height := 0
+	for i, layerSpec := range strings.Split(spec, ",") {
+		var layer FlatLayer
+		if layer, err = parseFlatLayer(strings.TrimSpace(layerSpec)); err != nil {
+			return nil, fmt.Errorf("Flat layer %d %q: %v", i+1, layerSpec, err)
+		}
+
+		height += layer.Count
+		if height > ChunkSizeY {
+			return nil, fmt.Errorf("Flat layers up to layer %d are %d blocks high, above the world height of %d", i+1, height, ChunkSizeY)
+		}
+		layers = append(layers, layer)
+	}
+
+	return
+}
+
+func parseFlatLayer(spec string) (layer FlatLayer, err error) {
+	layer.Count = 1
+	idStr := spec
+	if parts := strings.SplitN(spec, "x", 2); len(parts) == 2 {
+		if layer.Count, err = strconv.Atoi(parts[0]); err != nil || layer.Count < 1 {
+			return layer, fmt.Errorf("count must be a positive number")
+		}
+		idStr = parts[1]
+	}
+
+	id, err := strconv.ParseUint(idStr, 10, 8)
+	if err != nil {
+		return layer, fmt.Errorf("block ID must be a number from 0 to 255")
+	}
+	layer.BlockId = BlockId(id)
+	return
+}
+
+// FormatFlatLayers returns the specification of layers, as parsed by
+// ParseFlatLayers.
+func FormatFlatLayers(layers []FlatLayer) string {
+	specs := make([]string, len(layers))
+	for i, layer := range layers {
+		if layer.Count == 1 {
+			specs[i] = strconv.Itoa(int(layer.BlockId))
+		} else {
+			specs[i] = fmt.Sprintf("%dx%d", layer.Count, layer.BlockId)
+		}
+	}
+	return strings.Join(specs, ",")
+}
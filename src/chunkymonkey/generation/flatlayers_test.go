@@ -0,0 +1,107 @@
+package generation
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	. "chunkymonkey/types"
+)
+
+func TestParseFlatLayers(t *testing.T) {
+	tests := []struct {
+		spec   string
+		layers []FlatLayer
+	}{
+		{"7", []FlatLayer{{7, 1}}},
+		{"7,2x3,2", []FlatLayer{{7, 1}, {3, 2}, {2, 1}}},
+		{" 7, 2x3 ,2 ", []FlatLayer{{7, 1}, {3, 2}, {2, 1}}},
+		{"1x0", []FlatLayer{{0, 1}}},
+		{"255", []FlatLayer{{255, 1}}},
+		{"128x1", []FlatLayer{{1, 128}}},
+		{"7,127x1", []FlatLayer{{7, 1}, {1, 127}}},
+		{FlatgrassLayers, []FlatLayer{{7, 1}, {1, 60}, {3, 3}, {2, 1}}},
+	}
+
+	for _, test := range tests {
+		layers, err := ParseFlatLayers(test.spec)
+		if err != nil {
+			t.Errorf("%q: %v", test.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(layers, test.layers) {
+			t.Errorf("%q: parsed %v, want %v", test.spec, layers, test.layers)
+		}
+	}
+}
+
+func TestParseFlatLayers_Errors(t *testing.T) {
+	tests := []struct {
+		spec string
+		// A fragment of the expected error message.
+		err string
+	}{
+		{"", "Empty"},
+		{"   ", "Empty"},
+		{"7,", `layer 2 ""`},
+		{",7", `layer 1 ""`},
+		{"7,,2", `layer 2 ""`},
+		{"stone", "block ID must be a number"},
+		{"256", "block ID must be a number"},
+		{"-1", "block ID must be a number"},
+		{"7,2x", `layer 2 "2x": block ID`},
+		{"x3", "count must be a positive number"},
+		{"0x3", "count must be a positive number"},
+		{"-2x3", "count must be a positive number"},
+		{"ax3", "count must be a positive number"},
+		{"2x3x4", "block ID must be a number"},
+		{"129x1", "above the world height"},
+		{"7,64x1,64x3", "layer 3"},
+	}
+
+	for _, test := range tests {
+		layers, err := ParseFlatLayers(test.spec)
+		if err == nil {
+			t.Errorf("%q: parsed as %v, want error", test.spec, layers)
+		} else if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: error %q, want it to contain %q", test.spec, err, test.err)
+		}
+	}
+}
+
+func TestFormatFlatLayers(t *testing.T) {
+	for _, spec := range []string{"7", "7,2x3,2", FlatgrassLayers} {
+		layers, err := ParseFlatLayers(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if formatted := FormatFlatLayers(layers); formatted != spec {
+			t.Errorf("%q formatted as %q", spec, formatted)
+		}
+	}
+}
+
+func TestFlatGenerator_Options(t *testing.T) {
+	gen, err := NewGenerator("flatgrass", 0, "7,2x3,2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := gen.ReadChunk(ChunkXz{2, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Below sea level, so the grass is sand under the sea.
+	blocks := reader.Blocks()
+	want := []byte{7, 3, 3, 12, 9}
+	if !reflect.DeepEqual(blocks[:len(want)], want) {
+		t.Errorf("column starts %v, want %v", blocks[:len(want)], want)
+	}
+	if blocks[SeaLevel] != 9 || blocks[SeaLevel+1] != 0 {
+		t.Error("column isn't flooded to sea level")
+	}
+
+	if _, err = NewGenerator("flatgrass", 0, "7,2x3,grass"); err == nil {
+		t.Error("created a flat generator with a malformed layer specification")
+	}
+}
@@ -0,0 +1,59 @@
+package generation
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"chunkymonkey/chunkstore"
+)
+
+// NewGeneratorFunc creates a chunk generator for a world, given its seed and
+// the generator options stored with the world. The meaning of the options is
+// up to the generator, and they are often empty.
+type NewGeneratorFunc func(seed int64, options string) (chunkstore.IChunkStoreForeground, error)
+
+var (
+	generatorsLock sync.Mutex
+	generators     = make(map[string]NewGeneratorFunc)
+)
+
+// RegisterGenerator makes a generator available by name, to be selected by
+// worlds. The generators in this package register themselves. Other packages
+// may register their own, before any world is loaded. It panics if the name
+// is already registered.
+func RegisterGenerator(name string, newGenerator NewGeneratorFunc) {
+	generatorsLock.Lock()
+	defer generatorsLock.Unlock()
+
+	if _, exists := generators[name]; exists {
+		panic(fmt.Sprintf("generator %q registered twice", name))
+	}
+	generators[name] = newGenerator
+}
+
+// NewGenerator creates the chunk generator with the given name. It is an
+// error for there to be no such generator, as substituting another would
+// leave seams in the world.
+func NewGenerator(name string, seed int64, options string) (generator chunkstore.IChunkStoreForeground, err error) {
+	generatorsLock.Lock()
+	newGenerator, ok := generators[name]
+	generatorsLock.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("Unknown generator %q, expected one of %v", name, GeneratorNames())
+	}
+	return newGenerator(seed, options)
+}
+
+// GeneratorNames returns the names of the available generators.
+func GeneratorNames() (names []string) {
+	generatorsLock.Lock()
+	defer generatorsLock.Unlock()
+
+	for name := range generators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
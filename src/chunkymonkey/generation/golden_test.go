@@ -0,0 +1,132 @@
+package generation
+
+// The golden tests catch accidental changes to the output of the generators.
+// Any change to a generator's output changes every world generated after it,
+// and leaves seams where new chunks meet chunks already saved by the old
+// version, so changes must be deliberate.
+//
+// When a change is intended, regenerate the golden hashes with:
+//
+//   go test chunkymonkey/generation -run Golden -print_goldens
+//
+// and replace the table in goldenChunks with the output, mentioning the change
+// of output in the commit message.
+
+import (
+	"flag"
+	"sync"
+	"testing"
+
+	"chunkymonkey/chunkstore"
+	"chunkymonkey/gamerules"
+	. "chunkymonkey/types"
+)
+
+var printGoldens = flag.Bool(
+	"print_goldens", false,
+	"Print the golden chunk hashes for the current generators.")
+
+// readChunkHash generates a chunk and returns its chunkstore.ChunkHash.
+func readChunkHash(t *testing.T, gen chunkstore.IChunkStoreForeground, loc ChunkXz) string {
+	reader, err := gen.ReadChunk(loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chunkstore.ChunkHash(reader)
+}
+
+var loadGameRulesOnce sync.Once
+
+// loadGameRules loads the game rules from the data files at the root of the
+// repository. The TestGenerator needs them to light chunks.
+func loadGameRules(t *testing.T) {
+	loadGameRulesOnce.Do(func() {
+		err := gamerules.LoadGameRules(
+			"../../../blocks.json", "../../../items.json", "../../../recipes.json",
+			"../../../furnace.json", "../../../users.json", "../../../groups.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// goldenGenerators creates the generators covered by the golden tests, by
+// name.
+var goldenGenerators = map[string]func(seed int64) chunkstore.IChunkStoreForeground{
+	"test": func(seed int64) chunkstore.IChunkStoreForeground {
+		return NewTestGenerator(seed)
+	},
+	"noise": func(seed int64) chunkstore.IChunkStoreForeground {
+		return NewNoiseGenerator(seed, testNoiseParams())
+	},
+	"flatgrass": func(seed int64) chunkstore.IChunkStoreForeground {
+		return NewFlatgrassGenerator(SeaLevel)
+	},
+	"flatgrass-flooded": func(seed int64) chunkstore.IChunkStoreForeground {
+		return NewFlatgrassGenerator(FlatgrassHeight + 4)
+	},
+}
+
+type goldenChunk struct {
+	generator string
+	seed      int64
+	loc       ChunkXz
+	hash      string
+}
+
+var goldenChunks = []goldenChunk{
+	{"test", 0, ChunkXz{0, 0}, "b795dfd4480c7246c441fe86f572875b46621565"},
+	{"test", 0, ChunkXz{-1, 5}, "d0950174c7faef664813203ce3d69d6e9f41d7f7"},
+	{"test", 0, ChunkXz{100, -37}, "73af5b029a0da8a61b7a2dada55c1ed7a7e9d2a0"},
+	{"test", 42, ChunkXz{0, 0}, "dbb1518a0bb27d2c243494f6a3edb82ec6cb319b"},
+	{"test", 42, ChunkXz{-1, 5}, "929677032921ccaed601e5e4347549b86c87e7db"},
+	{"test", 42, ChunkXz{100, -37}, "9237ef4fe1bfa76c95f9ef0660e8cd05114a979c"},
+	{"noise", 0, ChunkXz{0, 0}, "e390aab6a681bea14e650bfdd32f41dca7f77d77"},
+	{"noise", 0, ChunkXz{-1, 5}, "45196fe71b557e9a636b993f3b4c73b7301beaa2"},
+	{"noise", 0, ChunkXz{100, -37}, "4923c357c6c3ef114e3db9354f4b2602e2af2aa4"},
+	{"noise", 42, ChunkXz{0, 0}, "32121bcab97c52364d7370aa8c65c4f84b57621a"},
+	{"noise", 42, ChunkXz{-1, 5}, "7be1b275fe9a889e9d73853e9308de160fe26b23"},
+	{"noise", 42, ChunkXz{100, -37}, "81b0b8f7ef13357cca959e6db4bdc407a18a3d7a"},
+	{"flatgrass", 0, ChunkXz{0, 0}, "a08b002a4fed134c43e640dcc9537dede71f1250"},
+	{"flatgrass-flooded", 0, ChunkXz{0, 0}, "17d85c61d5cff70813b4416c44042d57ef8290be"},
+}
+
+func TestGenerators_Golden(t *testing.T) {
+	loadGameRules(t)
+
+	generators := make(map[string]map[int64]chunkstore.IChunkStoreForeground)
+	generator := func(name string, seed int64) chunkstore.IChunkStoreForeground {
+		if generators[name] == nil {
+			generators[name] = make(map[int64]chunkstore.IChunkStoreForeground)
+		}
+		gen, ok := generators[name][seed]
+		if !ok {
+			gen = goldenGenerators[name](seed)
+			generators[name][seed] = gen
+		}
+		return gen
+	}
+
+	for _, golden := range goldenChunks {
+		hash := readChunkHash(t, generator(golden.generator, golden.seed), golden.loc)
+		if *printGoldens {
+			t.Logf("{%q, %d, ChunkXz{%d, %d}, %q},", golden.generator, golden.seed, golden.loc.X, golden.loc.Z, hash)
+		} else if hash != golden.hash {
+			t.Errorf("%s seed %d %v: hash %s, want %s", golden.generator, golden.seed, golden.loc, hash, golden.hash)
+		}
+	}
+}
+
+// TestGenerators_GoldenCoverage checks that every generator has golden
+// chunks.
+func TestGenerators_GoldenCoverage(t *testing.T) {
+	covered := make(map[string]bool)
+	for _, golden := range goldenChunks {
+		covered[golden.generator] = true
+	}
+	for _, name := range GeneratorNames() {
+		if !covered[name] {
+			t.Errorf("generator %q has no golden chunks", name)
+		}
+	}
+}
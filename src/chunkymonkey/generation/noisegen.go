@@ -0,0 +1,247 @@
+package generation
+
+import (
+	"flag"
+
+	"chunkymonkey/chunkstore"
+	. "chunkymonkey/types"
+	"perlin"
+)
+
+var (
+	noiseOctaves = flag.Int(
+		"noise_octaves", 5,
+		"Number of octaves of noise in the terrain height of the noise generator.")
+	noiseScale = flag.Float64(
+		"noise_scale", 256,
+		"Horizontal size in blocks of the largest terrain features of the noise generator.")
+	noisePersistence = flag.Float64(
+		"noise_persistence", 0.5,
+		"Relative amplitude of each octave of noise in the noise generator.")
+	noiseAmplitude = flag.Float64(
+		"noise_amplitude", 32,
+		"Vertical size in blocks of the largest terrain features of the noise generator.")
+	noiseOverhang = flag.Float64(
+		"noise_overhang", 8,
+		"Strength of the 3D noise carving overhangs in the noise generator, 0 for none.")
+	noiseCaves = flag.Bool(
+		"noise_caves", true,
+		"Whether the noise generator carves caves.")
+)
+
+func init() {
+	RegisterGenerator("noise", func(seed int64, options string) (chunkstore.IChunkStoreForeground, error) {
+		return NewNoiseGenerator(seed, DefaultNoiseParams()), nil
+	})
+}
+
+// noiseTerrainCacheSize is the number of chunks of undecorated terrain kept
+// for decorating their neighbours.
+const noiseTerrainCacheSize = 256
+
+// NoiseParams control the terrain produced by NoiseGenerator.
+type NoiseParams struct {
+	// Octaves is the number of octaves of 2D noise in the terrain height.
+	Octaves int
+	// Scale is the horizontal size in blocks of the largest octave.
+	Scale float64
+	// Persistence is the amplitude of each octave relative to the previous.
+	Persistence float64
+	// Amplitude is the vertical size in blocks of the largest octave.
+	Amplitude float64
+	// Overhang is the strength of the 3D noise that carves overhangs. It is
+	// roughly how many blocks the surface may be moved by.
+	Overhang float64
+	// OverhangScale is the size in blocks of the 3D noise features.
+	OverhangScale float64
+	// SeaLevel is the height up to which empty space is filled with water.
+	SeaLevel int
+	// DirtDepth is the number of blocks of dirt (or sand) below the surface.
+	DirtDepth int
+	// BeachHeight is how far above sea level the surface is sand.
+	BeachHeight int
+	// Caves enables carving caves through the terrain.
+	Caves bool
+}
+
+// DefaultNoiseParams returns the NoiseParams set by flags.
+func DefaultNoiseParams() NoiseParams {
+	return NoiseParams{
+		Octaves:       *noiseOctaves,
+		Scale:         *noiseScale,
+		Persistence:   *noisePersistence,
+		Amplitude:     *noiseAmplitude,
+		Overhang:      *noiseOverhang,
+		OverhangScale: 24,
+		SeaLevel:      *seaLevelFlag,
+		DirtDepth:     3,
+		BeachHeight:   1,
+		Caves:         *noiseCaves,
+	}
+}
+
+// NoiseGenerator generates terrain from layered Perlin noise. It implements
+// chunkstore.IChunkStoreForeground. Each chunk is purely a function of the
+// seed, the params and the chunk location, so chunks may be generated in any
+// order.
+type NoiseGenerator struct {
+	seed         int64
+	params       NoiseParams
+	heightSource ISource
+	overhang     *perlin.PerlinNoise
+	biomes       *BiomeSource
+	caves        *CaveCarver
+	decorators   []IDecorator
+	terrain      *terrainCache
+}
+
+func NewNoiseGenerator(seed int64, params NoiseParams) *NoiseGenerator {
+	gen := &NoiseGenerator{
+		seed:   seed,
+		params: params,
+		heightSource: &Scale{
+			Wavelength: params.Scale,
+			Amplitude:  params.Amplitude,
+			Source: &Octaves{
+				Count:       params.Octaves,
+				Persistence: params.Persistence,
+				Source:      perlin.NewPerlinNoise(seed),
+			},
+		},
+		// A different seed, so that the overhangs don't follow the height.
+		overhang: perlin.NewPerlinNoise(seed + 1),
+		biomes:   NewBiomeSource(seed),
+		decorators: []IDecorator{
+			TreeDecorator{},
+			DungeonDecorator{},
+		},
+		terrain: newTerrainCache(noiseTerrainCacheSize),
+	}
+	if params.Caves {
+		gen.caves = NewCaveCarver(seed)
+	}
+	return gen
+}
+
+func (gen *NoiseGenerator) SupportsWrite() bool {
+	return false
+}
+
+func (gen *NoiseGenerator) Writer() chunkstore.IChunkWriter {
+	return nil
+}
+
+func (gen *NoiseGenerator) WriteChunk(writer chunkstore.IChunkWriter) error {
+	return chunkstore.ErrReadOnlyStore
+}
+
+func (gen *NoiseGenerator) ReadChunk(chunkLoc ChunkXz) (reader chunkstore.IChunkReader, err error) {
+	data := gen.terrain.get(chunkLoc, gen.generateTerrain).clone()
+
+	decorate(gen.seed, data, gen.decorators, func(loc ChunkXz) *ChunkData {
+		return gen.terrain.get(loc, gen.generateTerrain)
+	})
+
+	baseIndex := 0
+	for heightMapIndex := range data.heightMap {
+		blocks := data.blocks[baseIndex : baseIndex+ChunkSizeY]
+		skyLight := data.skyLight[baseIndex>>1 : (baseIndex+ChunkSizeY)>>1]
+		data.heightMap[heightMapIndex] = byte(setColumnSkyLight(blocks, skyLight))
+		baseIndex += ChunkSizeY
+	}
+
+	return data, nil
+}
+
+// generateTerrain generates the undecorated terrain of a chunk, without
+// lighting.
+func (gen *NoiseGenerator) generateTerrain(chunkLoc ChunkXz) *ChunkData {
+	baseBlockXyz := chunkLoc.ChunkCornerBlockXY()
+	baseX, baseZ := float64(baseBlockXyz.X), float64(baseBlockXyz.Z)
+
+	data := newChunkData(chunkLoc)
+
+	baseIndex := 0
+	for x := 0; x < ChunkSizeH; x++ {
+		for z := 0; z < ChunkSizeH; z++ {
+			blocks := data.blocks[baseIndex : baseIndex+ChunkSizeY]
+			xf, zf := baseX+float64(x), baseZ+float64(z)
+
+			biome := gen.biomes.Biome(xf, zf)
+			subLoc := SubChunkXyz{X: SubChunkCoord(x), Z: SubChunkCoord(z)}
+			data.biomes[subLoc.BiomeIndex()] = byte(biome)
+
+			gen.setSolid(xf, zf, blocks)
+			gen.setSurface(blocks, biome)
+			fillSea(blocks, gen.params.SeaLevel, biome == BiomeTundra)
+
+			baseIndex += ChunkSizeY
+		}
+	}
+
+	addBasement(gen.seed, data)
+
+	if gen.caves != nil {
+		gen.caves.Carve(data)
+		floodCaves(data, gen.params.SeaLevel)
+	}
+
+	return data
+}
+
+// setSolid sets the solid blocks of a column to stone, and leaves the rest as
+// air. The bedrock is added afterwards.
+func (gen *NoiseGenerator) setSolid(x, z float64, blocks []byte) {
+	params := &gen.params
+	height := float64(params.SeaLevel) + gen.heightSource.At2d(x, z)
+
+	// The 3D noise is roughly in the range [-1, 1], so it can only change
+	// blocks within Overhang of the surface.
+	carveMin, carveMax := int(height-params.Overhang), int(height+params.Overhang)
+
+	for y := 1; y < ChunkSizeY; y++ {
+		density := height - float64(y)
+		if y >= carveMin && y <= carveMax && params.Overhang > 0 {
+			scale := params.OverhangScale
+			density += gen.overhang.At3d(x/scale, float64(y)/scale, z/scale) * params.Overhang
+		}
+		if density > 0 {
+			blocks[y] = 1 // stone
+		}
+	}
+}
+
+// setSurface turns the top blocks of each run of stone into the surface
+// blocks of the biome: grass and dirt, or sand in deserts and along
+// shorelines. Tundra is topped with snow.
+func (gen *NoiseGenerator) setSurface(blocks []byte, biome BiomeId) {
+	params := &gen.params
+	open := true
+	depth := 0
+	var fill byte
+
+	for y := ChunkSizeY - 1; y > 0; y-- {
+		if blocks[y] == 0 {
+			depth = 0
+			continue
+		}
+
+		if depth == 0 {
+			// The top block of a run of stone.
+			if biome == BiomeDesert || y <= params.SeaLevel+params.BeachHeight {
+				blocks[y] = 12 // sand
+				fill = 12
+			} else {
+				blocks[y] = 2 // grass
+				fill = 3      // dirt
+				if open && biome == BiomeTundra && y+1 < ChunkSizeY {
+					blocks[y+1] = 78 // snow
+				}
+			}
+		} else if depth <= params.DirtDepth {
+			blocks[y] = fill
+		}
+		open = false
+		depth++
+	}
+}
@@ -0,0 +1,80 @@
+package generation
+
+import (
+	"testing"
+
+	. "chunkymonkey/types"
+)
+
+func testNoiseParams() NoiseParams {
+	return NoiseParams{
+		Octaves:       5,
+		Scale:         256,
+		Persistence:   0.5,
+		Amplitude:     32,
+		Overhang:      8,
+		OverhangScale: 24,
+		SeaLevel:      SeaLevel,
+		DirtDepth:     3,
+		BeachHeight:   1,
+		Caves:         true,
+	}
+}
+
+// TestNoiseGenerator_Order checks that chunks don't depend on what was
+// generated before them.
+func TestNoiseGenerator_Order(t *testing.T) {
+	locs := []ChunkXz{{0, 0}, {1, 0}, {0, 1}, {-3, -3}, {7, -2}}
+
+	forward := NewNoiseGenerator(7, testNoiseParams())
+	hashes := make(map[ChunkXz]string)
+	for _, loc := range locs {
+		hashes[loc] = readChunkHash(t, forward, loc)
+	}
+
+	backward := NewNoiseGenerator(7, testNoiseParams())
+	for i := len(locs) - 1; i >= 0; i-- {
+		loc := locs[i]
+		if hash := readChunkHash(t, backward, loc); hash != hashes[loc] {
+			t.Errorf("%v: generated differently in reverse order", loc)
+		}
+	}
+}
+
+func TestNoiseGenerator_Surface(t *testing.T) {
+	params := testNoiseParams()
+	gen := NewNoiseGenerator(42, params)
+
+	reader, err := gen.ReadChunk(ChunkXz{-1, 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := reader.Blocks()
+	heightMap := reader.HeightMap()
+
+	for column, height := range heightMap {
+		base := column * ChunkSizeY
+		if blocks[base] != 7 {
+			t.Errorf("column %d: no bedrock", column)
+		}
+		switch top := blocks[base+int(height)-1]; top {
+		case 2, 12, 9, 79, 78, 17, 18:
+		default:
+			t.Errorf("column %d: top block %d is not a surface block", column, top)
+		}
+		if int(height) < ChunkSizeY && blocks[base+int(height)] != 0 {
+			t.Errorf("column %d: block above height map is not air", column)
+		}
+	}
+}
+
+func Benchmark_NoiseGenerator(b *testing.B) {
+	gen := NewNoiseGenerator(0, testNoiseParams())
+	var loc ChunkXz
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		loc.X = ChunkCoord(i & 0xffff)
+		gen.ReadChunk(loc)
+	}
+}
@@ -0,0 +1,120 @@
+package generation
+
+import (
+	"flag"
+
+	. "chunkymonkey/types"
+)
+
+var seaLevelFlag = flag.Int(
+	"sea_level", SeaLevel,
+	"Height up to which generators fill open space with water.")
+
+// fillSea fills the open space above the ground in a column with water, up to
+// and including seaLevel. If frozen, the top of the water is ice. Space below
+// the ground, such as caves, is left for floodCaves.
+func fillSea(blocks []byte, seaLevel int, frozen bool) {
+	if seaLevel >= ChunkSizeY {
+		seaLevel = ChunkSizeY - 1
+	}
+	for y := seaLevel; y > 0 && blocks[y] == 0; y-- {
+		if y == seaLevel && frozen {
+			blocks[y] = 79 // ice
+		} else {
+			blocks[y] = 9 // stationary water
+		}
+	}
+}
+
+// floodCaves fills air below sea level that is connected to water from above
+// or beside with water, so that caves opening under the sea are flooded
+// rather than being air pockets under a ceiling of water. Only water within
+// the chunk is considered.
+func floodCaves(data *ChunkData, seaLevel int) {
+	if seaLevel >= ChunkSizeY {
+		seaLevel = ChunkSizeY - 1
+	}
+
+	var pending []int
+	isWater := func(index int) bool {
+		return data.blocks[index] == 9
+	}
+
+	// Start from every air block beside or below water.
+	for x := 0; x < ChunkSizeH; x++ {
+		for z := 0; z < ChunkSizeH; z++ {
+			baseIndex := (x*ChunkSizeH + z) * ChunkSizeY
+			for y := 1; y <= seaLevel; y++ {
+				index := baseIndex + y
+				if data.blocks[index] != 0 {
+					continue
+				}
+				if isWater(index+1) ||
+					(x > 0 && isWater(index-ChunkSizeH*ChunkSizeY)) ||
+					(x < ChunkSizeH-1 && isWater(index+ChunkSizeH*ChunkSizeY)) ||
+					(z > 0 && isWater(index-ChunkSizeY)) ||
+					(z < ChunkSizeH-1 && isWater(index+ChunkSizeY)) {
+					data.blocks[index] = 9
+					pending = append(pending, index)
+				}
+			}
+		}
+	}
+
+	// Water spreads down and sideways, but not up.
+	for len(pending) > 0 {
+		index := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		y := index % ChunkSizeY
+		z := (index / ChunkSizeY) % ChunkSizeH
+		x := index / (ChunkSizeY * ChunkSizeH)
+
+		flow := func(next int) {
+			if data.blocks[next] == 0 {
+				data.blocks[next] = 9
+				pending = append(pending, next)
+			}
+		}
+		if y > 1 {
+			flow(index - 1)
+		}
+		if x > 0 {
+			flow(index - ChunkSizeH*ChunkSizeY)
+		}
+		if x < ChunkSizeH-1 {
+			flow(index + ChunkSizeH*ChunkSizeY)
+		}
+		if z > 0 {
+			flow(index - ChunkSizeY)
+		}
+		if z < ChunkSizeH-1 {
+			flow(index + ChunkSizeY)
+		}
+	}
+}
+
+// setColumnSkyLight sets the sky light of a column, and returns its height
+// map value: one above the highest block that isn't air, so the surface of
+// any water.
+func setColumnSkyLight(blocks []byte, skyLight []byte) (height int) {
+	for height = ChunkSizeY; height > 0 && blocks[height-1] == 0; height-- {
+	}
+
+	var lightLevel = 15
+	for y := ChunkSizeY - 1; y >= 0 && lightLevel > 0; y-- {
+		switch blocks[y] {
+		case 0, 6, 18, 78: // air, sapling, leaves, snow
+		case 9, 79: // water, ice
+			lightLevel -= 3
+		default:
+			lightLevel = 0
+		}
+		if lightLevel < 0 {
+			lightLevel = 0
+		}
+		BlockIndex(y).SetBlockData(skyLight, byte(lightLevel))
+	}
+
+	return
+}
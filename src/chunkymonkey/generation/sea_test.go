@@ -0,0 +1,71 @@
+package generation
+
+import (
+	"testing"
+
+	. "chunkymonkey/types"
+)
+
+func TestFillSea(t *testing.T) {
+	blocks := make([]byte, ChunkSizeY)
+	for y := 0; y <= 50; y++ {
+		blocks[y] = 1
+	}
+	// An overhang above sea level doesn't stop the fill below it.
+	blocks[70] = 1
+
+	fillSea(blocks, SeaLevel, true)
+
+	for y := 51; y < SeaLevel; y++ {
+		if blocks[y] != 9 {
+			t.Fatalf("block at y=%d = %d, want water", y, blocks[y])
+		}
+	}
+	if blocks[SeaLevel] != 79 {
+		t.Errorf("block at sea level = %d, want ice", blocks[SeaLevel])
+	}
+	if blocks[SeaLevel+1] != 0 {
+		t.Errorf("block above sea level = %d, want air", blocks[SeaLevel+1])
+	}
+}
+
+func TestFloodCaves(t *testing.T) {
+	data := newStoneChunk(ChunkXz{0, 0})
+	index := func(x, y, z int) int {
+		return (x*ChunkSizeH+z)*ChunkSizeY + y
+	}
+
+	// A sea over the x=0 column, with a tunnel beside it at y=40 leading to
+	// a shaft down to y=20, and a sealed chamber beyond it at y=10.
+	for y := 40; y <= SeaLevel; y++ {
+		data.blocks[index(0, y, 0)] = 9
+	}
+	for x := 1; x < 8; x++ {
+		data.blocks[index(x, 40, 0)] = 0
+	}
+	for y := 20; y < 40; y++ {
+		data.blocks[index(7, y, 0)] = 0
+	}
+	data.blocks[index(10, 10, 10)] = 0
+	// Air above sea level isn't flooded.
+	data.blocks[index(1, SeaLevel+1, 0)] = 0
+
+	floodCaves(data, SeaLevel)
+
+	for x := 1; x < 8; x++ {
+		if data.blocks[index(x, 40, 0)] != 9 {
+			t.Errorf("tunnel at x=%d not flooded", x)
+		}
+	}
+	for y := 20; y < 40; y++ {
+		if data.blocks[index(7, y, 0)] != 9 {
+			t.Errorf("shaft at y=%d not flooded", y)
+		}
+	}
+	if data.blocks[index(10, 10, 10)] != 0 {
+		t.Error("sealed chamber flooded")
+	}
+	if data.blocks[index(1, SeaLevel+1, 0)] != 0 {
+		t.Error("air above sea level flooded")
+	}
+}
@@ -89,3 +89,24 @@ func (gen *Sum) At2d(x, y float64) float64 {
 	}
 	return accum
 }
+
+// Octaves sums Count copies of Source, each at double the frequency and
+// Persistence times the amplitude of the one before.
+type Octaves struct {
+	Count       int
+	Persistence float64
+	Source      ISource
+}
+
+func (gen *Octaves) At2d(x, y float64) float64 {
+	var accum float64
+	frequency, amplitude := 1.0, 1.0
+	for i := 0; i < gen.Count; i++ {
+		// Offset each octave so that their lattice points don't coincide.
+		offset := float64(i) * 17.31
+		accum += gen.Source.At2d(x*frequency+offset, y*frequency+offset) * amplitude
+		frequency *= 2
+		amplitude *= gen.Persistence
+	}
+	return accum
+}
@@ -0,0 +1,73 @@
+package generation
+
+import (
+	"chunkymonkey/gamerules"
+	. "chunkymonkey/types"
+)
+
+// treeSpacing is the minimum distance between the trunks of trees started
+// in the same chunk.
+const treeSpacing = 3
+
+// biomeTreeDensity is the chance of a tree on each grass block in each
+// biome.
+var biomeTreeDensity = map[BiomeId]float64{
+	BiomePlains: 0.004,
+	BiomeForest: 0.06,
+	BiomeTundra: 0.01,
+}
+
+// TreeDecorator plants trees on grass, as often as the tree density of the
+// biome. The trees are the same as those grown from saplings.
+type TreeDecorator struct{}
+
+func (decorator TreeDecorator) Decorate(region *DecorationRegion, rnd IRand) {
+	type trunk struct{ x, z int }
+	var trunks []trunk
+
+	for x := 0; x < ChunkSizeH; x++ {
+		for z := 0; z < ChunkSizeH; z++ {
+			// Always draw the same numbers for each column, so that each
+			// column's trees don't depend on the biomes of the columns before
+			// it.
+			chance := rnd.Float64()
+			height := gamerules.TreeMinHeight + rnd.Intn(gamerules.TreeMaxHeight-gamerules.TreeMinHeight)
+
+			if chance >= biomeTreeDensity[region.Biome(x, z)] {
+				continue
+			}
+
+			// Grow on grass, over solid ground (not the roof of a cave).
+			ground := region.Top(x, z)
+			if region.Block(x, ground, z) != 2 || region.Block(x, ground-1, z) == 0 {
+				continue
+			}
+			if ground+height+2 >= ChunkSizeY {
+				continue
+			}
+
+			tooClose := false
+			for _, other := range trunks {
+				if absInt(other.x-x) < treeSpacing && absInt(other.z-z) < treeSpacing {
+					tooClose = true
+					break
+				}
+			}
+			if tooClose {
+				continue
+			}
+			trunks = append(trunks, trunk{x, z})
+
+			for _, block := range gamerules.TreeBlocks(height) {
+				region.Place(x+block.Dx, ground+1+block.Dy, z+block.Dz, byte(block.BlockId))
+			}
+		}
+	}
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
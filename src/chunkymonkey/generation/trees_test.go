@@ -0,0 +1,129 @@
+package generation
+
+import (
+	"testing"
+
+	. "chunkymonkey/types"
+)
+
+// findForest returns the location of a chunk that is all forest.
+func findForest(t *testing.T, gen *NoiseGenerator) ChunkXz {
+	for x := 0; x < 256; x++ {
+		loc := ChunkXz{ChunkCoord(x), 0}
+		data := gen.terrain.get(loc, gen.generateTerrain)
+		forest := true
+		for _, biome := range data.biomes {
+			if BiomeId(biome) != BiomeForest {
+				forest = false
+				break
+			}
+		}
+		if forest {
+			return loc
+		}
+	}
+	t.Fatal("no forest found")
+	return ChunkXz{}
+}
+
+func TestTreeDecorator(t *testing.T) {
+	gen := NewNoiseGenerator(42, testNoiseParams())
+	forest := findForest(t, gen)
+
+	logs, edgeLeaves := 0, 0
+	for dx := ChunkCoord(-1); dx <= 1; dx++ {
+		for dz := ChunkCoord(-1); dz <= 1; dz++ {
+			reader, err := gen.ReadChunk(ChunkXz{forest.X + dx, forest.Z + dz})
+			if err != nil {
+				t.Fatal(err)
+			}
+			blocks := reader.Blocks()
+
+			for baseIndex := 0; baseIndex < len(blocks); baseIndex += ChunkSizeY {
+				subLoc := BlockIndex(baseIndex).ToSubChunkXyz()
+				onEdge := subLoc.X == 0 || subLoc.X == ChunkSizeH-1 ||
+					subLoc.Z == 0 || subLoc.Z == ChunkSizeH-1
+
+				for y := 1; y < ChunkSizeY; y++ {
+					switch blocks[baseIndex+y] {
+					case 17:
+						logs++
+						// Trunks stand on the ground, not on air.
+						if below := blocks[baseIndex+y-1]; below != 17 && below != 2 && below != 3 {
+							t.Errorf("log at %+v y=%d stands on block %d", subLoc, y, below)
+						}
+					case 18:
+						if onEdge {
+							edgeLeaves++
+						}
+					}
+				}
+			}
+		}
+	}
+
+	if logs == 0 {
+		t.Fatal("no trees in forest")
+	}
+	if edgeLeaves == 0 {
+		t.Error("no leaves at chunk edges")
+	}
+}
+
+// TestTreeDecorator_Order checks that trees crossing chunk borders are the
+// same whichever chunk is generated first.
+func TestTreeDecorator_Order(t *testing.T) {
+	forest := findForest(t, NewNoiseGenerator(42, testNoiseParams()))
+
+	var locs []ChunkXz
+	for dx := ChunkCoord(-1); dx <= 1; dx++ {
+		for dz := ChunkCoord(-1); dz <= 1; dz++ {
+			locs = append(locs, ChunkXz{forest.X + dx, forest.Z + dz})
+		}
+	}
+
+	forward := NewNoiseGenerator(42, testNoiseParams())
+	hashes := make(map[ChunkXz]string)
+	for _, loc := range locs {
+		hashes[loc] = readChunkHash(t, forward, loc)
+	}
+
+	for i := len(locs) - 1; i >= 0; i-- {
+		// A new generator each time, so that nothing is cached.
+		gen := NewNoiseGenerator(42, testNoiseParams())
+		if hash := readChunkHash(t, gen, locs[i]); hash != hashes[locs[i]] {
+			t.Errorf("%v: generated differently", locs[i])
+		}
+	}
+}
+
+func TestDecorationRegion_Place(t *testing.T) {
+	origin := newChunkData(ChunkXz{0, 0})
+	target := newChunkData(ChunkXz{1, 0})
+	region := newDecorationRegion(origin, target, nil)
+
+	index := func(x, y, z int) int { return (x*ChunkSizeH+z)*ChunkSizeY + y }
+	target.blocks[index(0, 1, 0)] = 1  // stone
+	target.blocks[index(0, 2, 0)] = 18 // leaves
+
+	// Outside the target chunk.
+	region.Place(ChunkSizeH-1, 5, 0, 18)
+	region.Place(2*ChunkSizeH, 5, 0, 18)
+	// Inside the target.
+	region.Place(ChunkSizeH, 5, 0, 18)
+	region.Place(ChunkSizeH, 1, 0, 17)
+	region.Place(ChunkSizeH, 2, 0, 17)
+
+	if origin.blocks[index(ChunkSizeH-1, 5, 0)] != 0 {
+		t.Error("placed block in origin chunk")
+	}
+	if target.blocks[index(0, 5, 0)] != 18 {
+		t.Error("leaves not placed into air")
+	}
+	if target.blocks[index(0, 1, 0)] != 1 {
+		t.Error("log replaced stone")
+	}
+	if target.blocks[index(0, 2, 0)] != 17 {
+		t.Error("log didn't replace leaves")
+	}
+}
@@ -0,0 +1,61 @@
+package chunkymonkey
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// DefaultPort is the port listened on for addresses that don't give one.
+const DefaultPort = "25565"
+
+// ParseListenAddrs parses a comma separated list of addresses to listen on.
+// Each is a host and port as understood by net.Listen, such as
+// "0.0.0.0:25565" or "[::1]:25565". A host without a port, including a bare
+// IPv6 address such as "::1", listens on DefaultPort.
+func ParseListenAddrs(spec string) (addrs []string, err error) {
+	for _, addr := range strings.Split(spec, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+
+		if ip := net.ParseIP(addr); ip != nil {
+			addr = net.JoinHostPort(addr, DefaultPort)
+		} else if _, _, splitErr := net.SplitHostPort(addr); splitErr != nil {
+			if strings.HasPrefix(addr, "[") && strings.HasSuffix(addr, "]") {
+				addr = net.JoinHostPort(addr[1:len(addr)-1], DefaultPort)
+			} else if !strings.Contains(addr, ":") {
+				addr = net.JoinHostPort(addr, DefaultPort)
+			} else {
+				return nil, fmt.Errorf("Bad listen address %q: %v", addr, splitErr)
+			}
+		}
+
+		if _, port, _ := net.SplitHostPort(addr); port == "" {
+			return nil, fmt.Errorf("Bad listen address %q: missing port", addr)
+		}
+		addrs = append(addrs, addr)
+	}
+
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("No listen addresses in %q", spec)
+	}
+	return
+}
+
+// ListenAll listens on each of the TCP addresses. If any of them fails, the
+// listeners already opened are closed.
+func ListenAll(addrs []string) (listeners []net.Listener, err error) {
+	for _, addr := range addrs {
+		var listener net.Listener
+		if listener, err = net.Listen("tcp", addr); err != nil {
+			for _, opened := range listeners {
+				opened.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, listener)
+	}
+	return
+}
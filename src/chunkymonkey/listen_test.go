@@ -0,0 +1,88 @@
+package chunkymonkey
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestParseListenAddrs(t *testing.T) {
+	type Test struct {
+		spec     string
+		expected []string
+		ok       bool
+	}
+
+	var tests = []Test{
+		{":25565", []string{":25565"}, true},
+		{"0.0.0.0:1234", []string{"0.0.0.0:1234"}, true},
+		{"localhost", []string{"localhost:25565"}, true},
+		{"[::1]:1234", []string{"[::1]:1234"}, true},
+		{"[::]:1234", []string{"[::]:1234"}, true},
+		{"::1", []string{"[::1]:25565"}, true},
+		{"[fe80::1%eth0]", []string{"[fe80::1%eth0]:25565"}, true},
+		{"127.0.0.1:1234, [::1]:1234", []string{"127.0.0.1:1234", "[::1]:1234"}, true},
+		// A bare IPv6 address can't have a port, as it would be ambiguous.
+		{"::1:1234", []string{"[::1:1234]:25565"}, true},
+		{"1.2.3.4:5:6", nil, false},
+		{"127.0.0.1:", nil, false},
+		{"", nil, false},
+		{" , ", nil, false},
+	}
+
+	for _, test := range tests {
+		addrs, err := ParseListenAddrs(test.spec)
+		if (err == nil) != test.ok {
+			t.Errorf("ParseListenAddrs(%q): expected ok=%v, got error %v", test.spec, test.ok, err)
+			continue
+		}
+		if !reflect.DeepEqual(addrs, test.expected) {
+			t.Errorf("ParseListenAddrs(%q): expected %q, got %q", test.spec, test.expected, addrs)
+		}
+	}
+}
+
+func TestListenAll(t *testing.T) {
+	addrs := []string{"127.0.0.1:0"}
+	if listener, err := net.Listen("tcp", "[::1]:0"); err == nil {
+		listener.Close()
+		addrs = append(addrs, "[::1]:0")
+	} else {
+		t.Logf("Not testing IPv6: %v", err)
+	}
+
+	listeners, err := ListenAll(addrs)
+	if err != nil {
+		t.Fatalf("ListenAll(%q): %v", addrs, err)
+	}
+	defer func() {
+		for _, listener := range listeners {
+			listener.Close()
+		}
+	}()
+	if len(listeners) != len(addrs) {
+		t.Fatalf("Expected %d listeners, got %d", len(addrs), len(listeners))
+	}
+
+	for _, listener := range listeners {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Errorf("Dial %v: %v", listener.Addr(), err)
+			continue
+		}
+		conn.Close()
+	}
+}
+
+func TestListenAll_Failure(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// The first address is free, but the second is in use.
+	if _, err := ListenAll([]string{"127.0.0.1:0", listener.Addr().String()}); err == nil {
+		t.Errorf("Expected ListenAll to fail when an address is in use")
+	}
+}
@@ -0,0 +1,232 @@
+// The logger package logs messages with a level for each subsystem of the
+// server, so that one subsystem can be debugged without drowning in messages
+// from the others. Messages carry structured fields as key/value pairs, and
+// are written through the standard log package.
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Level is the severity of a message. Messages below a subsystem's level are
+// dropped.
+type Level int32
+
+const (
+	LevelDebug = Level(iota)
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// DefaultLevel is the level of each subsystem until it is changed.
+const DefaultLevel = LevelInfo
+
+var levelNames = [...]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+func (level Level) String() string {
+	if level < 0 || int(level) >= len(levelNames) {
+		return fmt.Sprintf("Level(%d)", int32(level))
+	}
+	return levelNames[level]
+}
+
+// ParseLevel returns the level with the given name.
+func ParseLevel(name string) (level Level, err error) {
+	for i, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return Level(i), nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown log level %q.", name)
+}
+
+// Logger logs messages for a subsystem. Loggers created by With share the
+// level of the subsystem that they came from.
+type Logger struct {
+	subsystem string
+	level     *int32
+	fields    []interface{}
+}
+
+// The subsystems of the server.
+var (
+	Net    = newSubsystem("net")    // Connections and the protocol.
+	Chunk  = newSubsystem("chunk")  // Loading, saving and serving chunks.
+	Entity = newSubsystem("entity") // Players, mobs and items.
+	World  = newSubsystem("world")  // World data and generation.
+	Cmd    = newSubsystem("cmd")    // Commands.
+)
+
+// subsystems holds the Logger for each subsystem, by name.
+var subsystems = make(map[string]*Logger)
+
+func newSubsystem(name string) *Logger {
+	logger := &Logger{
+		subsystem: name,
+		level:     new(int32),
+	}
+	*logger.level = int32(DefaultLevel)
+	subsystems[name] = logger
+	return logger
+}
+
+var ErrUnknownSubsystem = errors.New("Unknown log subsystem.")
+
+// Subsystems returns the names of the subsystems, in order.
+func Subsystems() (names []string) {
+	for name := range subsystems {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// Lookup returns the Logger for a subsystem by name.
+func Lookup(subsystem string) (logger *Logger, ok bool) {
+	logger, ok = subsystems[subsystem]
+	return
+}
+
+// SetLevel sets the level of a subsystem by name.
+func SetLevel(subsystem string, level Level) error {
+	logger, ok := subsystems[subsystem]
+	if !ok {
+		return ErrUnknownSubsystem
+	}
+	logger.SetLevel(level)
+	return nil
+}
+
+// SetLevels configures levels from a comma separated list of
+// "subsystem=level", or of a bare level to set every subsystem to, such as
+// "warn,chunk=debug". Settings later in the list override earlier ones.
+func SetLevels(spec string) error {
+	for _, setting := range strings.Split(spec, ",") {
+		setting = strings.TrimSpace(setting)
+		if setting == "" {
+			continue
+		}
+
+		parts := strings.SplitN(setting, "=", 2)
+		level, err := ParseLevel(parts[len(parts)-1])
+		if err != nil {
+			return err
+		}
+
+		if len(parts) == 1 {
+			for _, logger := range subsystems {
+				logger.SetLevel(level)
+			}
+		} else if err = SetLevel(parts[0], level); err != nil {
+			return fmt.Errorf("%q: %v", parts[0], err)
+		}
+	}
+	return nil
+}
+
+// Subsystem returns the name of the logger's subsystem.
+func (logger *Logger) Subsystem() string {
+	return logger.subsystem
+}
+
+// Level returns the level of the logger's subsystem.
+func (logger *Logger) Level() Level {
+	return Level(atomic.LoadInt32(logger.level))
+}
+
+// SetLevel sets the level of the logger's subsystem. It is safe to call while
+// messages are being logged.
+func (logger *Logger) SetLevel(level Level) {
+	atomic.StoreInt32(logger.level, int32(level))
+}
+
+// Enabled returns true if messages at the level are logged.
+func (logger *Logger) Enabled(level Level) bool {
+	return level >= logger.Level()
+}
+
+// With returns a logger that adds the fields to every message. Fields are
+// key/value pairs, as for Log.
+func (logger *Logger) With(fields ...interface{}) *Logger {
+	withFields := make([]interface{}, 0, len(logger.fields)+len(fields))
+	withFields = append(withFields, logger.fields...)
+	withFields = append(withFields, fields...)
+	return &Logger{
+		subsystem: logger.subsystem,
+		level:     logger.level,
+		fields:    withFields,
+	}
+}
+
+// Log logs the message at the level, followed by the fields. Fields are
+// alternating keys and values, such as "player", name, "chunk", loc.
+func (logger *Logger) Log(level Level, msg string, fields ...interface{}) {
+	logger.output(level, msg, fields)
+}
+
+func (logger *Logger) Debug(msg string, fields ...interface{}) {
+	logger.output(LevelDebug, msg, fields)
+}
+
+func (logger *Logger) Info(msg string, fields ...interface{}) {
+	logger.output(LevelInfo, msg, fields)
+}
+
+func (logger *Logger) Warn(msg string, fields ...interface{}) {
+	logger.output(LevelWarn, msg, fields)
+}
+
+func (logger *Logger) Error(msg string, fields ...interface{}) {
+	logger.output(LevelError, msg, fields)
+}
+
+// output must be called directly by the exported logging methods, so that the
+// file and line logged are those of their caller.
+func (logger *Logger) output(level Level, msg string, fields []interface{}) {
+	if !logger.Enabled(level) {
+		return
+	}
+	log.Output(3, logger.format(level, msg, fields))
+}
+
+// format formats a message as "LEVEL subsystem: msg key=value ...".
+func (logger *Logger) format(level Level, msg string, fields []interface{}) string {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "%s %s: %s", strings.ToUpper(level.String()), logger.subsystem, msg)
+	writeFields(buf, logger.fields)
+	writeFields(buf, fields)
+	return buf.String()
+}
+
+func writeFields(buf *bytes.Buffer, fields []interface{}) {
+	for i := 0; i < len(fields); i += 2 {
+		if i+1 == len(fields) {
+			fmt.Fprintf(buf, " %s", formatValue(fields[i]))
+			break
+		}
+		fmt.Fprintf(buf, " %v=%s", fields[i], formatValue(fields[i+1]))
+	}
+}
+
+// formatValue formats a field value, quoting it if it wouldn't otherwise be
+// clear where it ends.
+func formatValue(value interface{}) string {
+	str := fmt.Sprint(value)
+	if str == "" || strings.ContainsAny(str, " =\"\t\n") {
+		return strconv.Quote(str)
+	}
+	return str
+}
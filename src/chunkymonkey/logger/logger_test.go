@@ -0,0 +1,124 @@
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+)
+
+// captureLog returns the messages logged while f runs.
+func captureLog(f func()) []string {
+	buf := new(bytes.Buffer)
+	defer func(flags int) { log.SetFlags(flags) }(log.Flags())
+	log.SetFlags(0)
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(buf)
+
+	f()
+	return strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+}
+
+func TestLogger_Format(t *testing.T) {
+	type Test struct {
+		msg      string
+		fields   []interface{}
+		expected string
+	}
+
+	var tests = []Test{
+		{"Started", nil, "INFO chunk: Started"},
+		{"Loaded", []interface{}{"x", 1, "z", -2}, "INFO chunk: Loaded x=1 z=-2"},
+		{"Failed", []interface{}{"err", errors.New("bad thing")}, `INFO chunk: Failed err="bad thing"`},
+		{"Empty", []interface{}{"name", ""}, `INFO chunk: Empty name=""`},
+		{"Odd", []interface{}{"key", 1, "extra"}, "INFO chunk: Odd key=1 extra"},
+	}
+
+	for _, test := range tests {
+		lines := captureLog(func() { Chunk.Info(test.msg, test.fields...) })
+		if len(lines) != 1 || lines[0] != test.expected {
+			t.Errorf("Info(%q, %v): expected %q, got %q", test.msg, test.fields, test.expected, lines)
+		}
+	}
+}
+
+func TestLogger_Levels(t *testing.T) {
+	defer Net.SetLevel(Net.Level())
+	Net.SetLevel(LevelWarn)
+
+	lines := captureLog(func() {
+		Net.Debug("debug")
+		Net.Info("info")
+		Net.Warn("warn")
+		Net.Error("error")
+		// Other subsystems aren't affected.
+		Entity.Info("entity info")
+	})
+
+	expected := []string{"WARN net: warn", "ERROR net: error", "INFO entity: entity info"}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected %q, got %q", expected, lines)
+	}
+}
+
+func TestLogger_With(t *testing.T) {
+	defer Entity.SetLevel(Entity.Level())
+
+	player := Entity.With("player", "alice")
+	lines := captureLog(func() {
+		player.Info("Joined", "x", 1)
+		// Loggers with fields share the level of their subsystem.
+		Entity.SetLevel(LevelError)
+		player.Info("Hidden")
+	})
+
+	if len(lines) != 1 || lines[0] != "INFO entity: Joined player=alice x=1" {
+		t.Errorf("Unexpected messages %q", lines)
+	}
+}
+
+func TestSetLevels(t *testing.T) {
+	defer func(levels map[string]Level) {
+		for name, level := range levels {
+			SetLevel(name, level)
+		}
+	}(currentLevels())
+
+	type Test struct {
+		spec     string
+		expected map[string]Level
+		ok       bool
+	}
+
+	var tests = []Test{
+		{"warn", map[string]Level{"net": LevelWarn, "chunk": LevelWarn, "cmd": LevelWarn}, true},
+		{"info, chunk=debug", map[string]Level{"net": LevelInfo, "chunk": LevelDebug}, true},
+		{"net=ERROR", map[string]Level{"net": LevelError, "chunk": LevelDebug}, true},
+		{"net=loud", nil, false},
+		{"nosuch=info", nil, false},
+	}
+
+	for _, test := range tests {
+		err := SetLevels(test.spec)
+		if (err == nil) != test.ok {
+			t.Errorf("SetLevels(%q): expected ok=%v, got error %v", test.spec, test.ok, err)
+			continue
+		}
+		levels := currentLevels()
+		for name, level := range test.expected {
+			if levels[name] != level {
+				t.Errorf("SetLevels(%q): expected %s at %v, got %v", test.spec, name, level, levels[name])
+			}
+		}
+	}
+}
+
+func currentLevels() map[string]Level {
+	levels := make(map[string]Level)
+	for _, name := range Subsystems() {
+		logger, _ := Lookup(name)
+		levels[name] = logger.Level()
+	}
+	return levels
+}
@@ -0,0 +1,84 @@
+// Package loot chooses random items from weighted tables, such as for the
+// contents of generated chests.
+package loot
+
+import (
+	"chunkymonkey/gamerules"
+	. "chunkymonkey/types"
+)
+
+// IRand is the subset of *rand.Rand used to roll loot.
+type IRand interface {
+	Intn(n int) int
+}
+
+// Entry is an item that a Table can produce.
+type Entry struct {
+	ItemTypeId ItemTypeId
+	Data       ItemData
+	// The number of items produced is between MinCount and MaxCount
+	// inclusive.
+	MinCount, MaxCount ItemCount
+	// Weight is how likely the entry is relative to the others in its table.
+	Weight int
+}
+
+// Table is a weighted pool of items.
+type Table struct {
+	// The number of entries chosen is between MinRolls and MaxRolls
+	// inclusive. The same entry may be chosen more than once.
+	MinRolls, MaxRolls int
+	Entries            []Entry
+}
+
+// TotalWeight returns the sum of the weights of the entries.
+func (table *Table) TotalWeight() (total int) {
+	for i := range table.Entries {
+		total += table.Entries[i].Weight
+	}
+	return
+}
+
+// Roll chooses items from the table. The same sequence of random numbers
+// always produces the same items.
+func (table *Table) Roll(rnd IRand) (items []gamerules.Slot) {
+	total := table.TotalWeight()
+	if total <= 0 {
+		return nil
+	}
+
+	rolls := table.MinRolls
+	if table.MaxRolls > table.MinRolls {
+		rolls += rnd.Intn(table.MaxRolls - table.MinRolls + 1)
+	}
+
+	items = make([]gamerules.Slot, 0, rolls)
+	for i := 0; i < rolls; i++ {
+		entry := table.choose(rnd.Intn(total))
+
+		count := entry.MinCount
+		if entry.MaxCount > entry.MinCount {
+			count += ItemCount(rnd.Intn(int(entry.MaxCount-entry.MinCount) + 1))
+		}
+
+		items = append(items, gamerules.Slot{
+			ItemTypeId: entry.ItemTypeId,
+			Count:      count,
+			Data:       entry.Data,
+		})
+	}
+
+	return
+}
+
+// choose returns the entry that a number from 0 to TotalWeight()-1 falls in.
+func (table *Table) choose(n int) *Entry {
+	for i := range table.Entries {
+		entry := &table.Entries[i]
+		if n < entry.Weight {
+			return entry
+		}
+		n -= entry.Weight
+	}
+	panic("loot: weight out of range")
+}
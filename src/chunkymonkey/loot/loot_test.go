@@ -0,0 +1,66 @@
+package loot
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	. "chunkymonkey/types"
+)
+
+var testTable = Table{
+	MinRolls: 2,
+	MaxRolls: 5,
+	Entries: []Entry{
+		{ItemTypeId: 1, MinCount: 1, MaxCount: 1, Weight: 1},
+		{ItemTypeId: 2, MinCount: 2, MaxCount: 4, Weight: 3},
+		{ItemTypeId: 3, Data: 7, MinCount: 1, MaxCount: 1, Weight: 0},
+	},
+}
+
+func TestTable_Roll(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	counts := make(map[ItemTypeId]int)
+
+	for i := 0; i < 1000; i++ {
+		items := testTable.Roll(rnd)
+		if len(items) < testTable.MinRolls || len(items) > testTable.MaxRolls {
+			t.Fatalf("rolled %d items", len(items))
+		}
+		for _, item := range items {
+			counts[item.ItemTypeId]++
+			switch item.ItemTypeId {
+			case 1:
+				if item.Count != 1 {
+					t.Errorf("item 1 count %d", item.Count)
+				}
+			case 2:
+				if item.Count < 2 || item.Count > 4 {
+					t.Errorf("item 2 count %d", item.Count)
+				}
+			default:
+				t.Errorf("rolled item %d with zero weight", item.ItemTypeId)
+			}
+		}
+	}
+
+	// Item 2 is three times as likely as item 1.
+	if ratio := float64(counts[2]) / float64(counts[1]); ratio < 2.5 || ratio > 3.5 {
+		t.Errorf("item 2 rolled %.2f times as often as item 1, want about 3", ratio)
+	}
+}
+
+func TestTable_RollDeterministic(t *testing.T) {
+	first := testTable.Roll(rand.New(rand.NewSource(42)))
+	second := testTable.Roll(rand.New(rand.NewSource(42)))
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("same seed rolled %v and %v", first, second)
+	}
+}
+
+func TestTable_RollEmpty(t *testing.T) {
+	empty := Table{MinRolls: 3, MaxRolls: 3}
+	if items := empty.Roll(rand.New(rand.NewSource(1))); len(items) != 0 {
+		t.Errorf("empty table rolled %v", items)
+	}
+}
@@ -0,0 +1,111 @@
+package maprender
+
+import (
+	"image/color"
+
+	. "chunkymonkey/types"
+)
+
+// BlockColors are the colors that blocks are drawn in, seen from above.
+// Blocks that aren't listed are drawn in unknownColor.
+var BlockColors = map[BlockId]color.RGBA{
+	1:  {125, 125, 125, 255}, // Stone.
+	2:  {95, 159, 53, 255},   // Grass.
+	3:  {134, 96, 67, 255},   // Dirt.
+	4:  {115, 115, 115, 255}, // Cobblestone.
+	5:  {157, 128, 79, 255},  // Planks.
+	6:  {72, 140, 40, 255},   // Sapling.
+	7:  {60, 60, 60, 255},    // Bedrock.
+	8:  {47, 67, 244, 255},   // Water.
+	9:  {47, 67, 244, 255},   // Stationary water.
+	10: {230, 92, 20, 255},   // Lava.
+	11: {230, 92, 20, 255},   // Stationary lava.
+	12: {219, 211, 160, 255}, // Sand.
+	13: {136, 126, 126, 255}, // Gravel.
+	14: {143, 140, 125, 255}, // Gold ore.
+	15: {136, 130, 127, 255}, // Iron ore.
+	16: {115, 115, 115, 255}, // Coal ore.
+	17: {102, 81, 51, 255},   // Log.
+	18: {44, 110, 30, 255},   // Leaves.
+	19: {195, 195, 50, 255},  // Sponge.
+	20: {218, 240, 244, 255}, // Glass.
+	21: {102, 112, 134, 255}, // Lapis lazuli ore.
+	22: {38, 67, 137, 255},   // Lapis lazuli block.
+	24: {218, 210, 158, 255}, // Sandstone.
+	35: {222, 222, 222, 255}, // Wool.
+	37: {241, 249, 2, 255},   // Yellow flower.
+	38: {247, 7, 15, 255},    // Red rose.
+	39: {145, 109, 85, 255},  // Brown mushroom.
+	40: {226, 18, 18, 255},   // Red mushroom.
+	41: {249, 236, 78, 255},  // Gold block.
+	42: {219, 219, 219, 255}, // Iron block.
+	43: {168, 168, 168, 255}, // Double slab.
+	44: {168, 168, 168, 255}, // Slab.
+	45: {146, 99, 86, 255},   // Brick.
+	46: {219, 68, 26, 255},   // TNT.
+	47: {107, 88, 57, 255},   // Bookshelf.
+	48: {90, 108, 90, 255},   // Mossy cobblestone.
+	49: {20, 18, 29, 255},    // Obsidian.
+	50: {255, 216, 0, 255},   // Torch.
+	51: {255, 170, 30, 255},  // Fire.
+	53: {157, 128, 79, 255},  // Wooden stairs.
+	54: {125, 91, 38, 255},   // Chest.
+	56: {129, 140, 143, 255}, // Diamond ore.
+	57: {97, 219, 213, 255},  // Diamond block.
+	58: {107, 71, 42, 255},   // Workbench.
+	59: {131, 165, 31, 255},  // Crops.
+	60: {75, 41, 14, 255},    // Farmland.
+	61: {96, 96, 96, 255},    // Furnace.
+	62: {96, 96, 96, 255},    // Burning furnace.
+	67: {115, 115, 115, 255}, // Cobblestone stairs.
+	73: {132, 107, 107, 255}, // Redstone ore.
+	74: {132, 107, 107, 255}, // Glowing redstone ore.
+	78: {240, 251, 251, 255}, // Snow.
+	79: {125, 173, 255, 255}, // Ice.
+	80: {240, 251, 251, 255}, // Snow block.
+	81: {13, 120, 25, 255},   // Cactus.
+	82: {158, 164, 176, 255}, // Clay.
+	83: {148, 192, 101, 255}, // Reeds.
+	85: {157, 128, 79, 255},  // Fence.
+	86: {227, 144, 29, 255},  // Pumpkin.
+	87: {111, 54, 52, 255},   // Netherrack.
+	88: {84, 64, 51, 255},    // Soul sand.
+	89: {137, 112, 64, 255},  // Glowstone.
+	91: {227, 144, 29, 255},  // Jack-o-lantern.
+}
+
+var (
+	// unknownColor is the color of blocks that aren't in BlockColors.
+	unknownColor = color.RGBA{200, 0, 200, 255}
+	// failedColor is the color of chunks that couldn't be read.
+	failedColor = color.RGBA{255, 0, 0, 255}
+)
+
+// blockColor returns the color of a block at height y, shaded so that higher
+// blocks are lighter and lower ones darker.
+func blockColor(id BlockId, y int) color.RGBA {
+	c, ok := BlockColors[id]
+	if !ok {
+		c = unknownColor
+	}
+
+	// Blocks at sea level are drawn in their own color, and the shading
+	// ranges from half as bright at the bottom of the world to 25% brighter
+	// at the top.
+	const seaLevel = ChunkSizeY / 2
+	var scale float64
+	if y < seaLevel {
+		scale = 0.5 + 0.5*float64(y)/seaLevel
+	} else {
+		scale = 1 + 0.25*float64(y-seaLevel)/(ChunkSizeY-1-seaLevel)
+	}
+	return color.RGBA{shade(c.R, scale), shade(c.G, scale), shade(c.B, scale), c.A}
+}
+
+func shade(component uint8, scale float64) uint8 {
+	value := float64(component) * scale
+	if value > 255 {
+		return 255
+	}
+	return uint8(value)
+}
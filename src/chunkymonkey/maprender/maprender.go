@@ -0,0 +1,253 @@
+// The maprender package draws top-down maps of worlds from their chunk
+// stores, without running the server. Each block column is drawn in the color
+// of its highest block, shaded by height. Large worlds are drawn as tiles, so
+// that only one tile and one row of chunks are held in memory at a time.
+package maprender
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+
+	"chunkymonkey/chunkstore"
+	"chunkymonkey/logger"
+	. "chunkymonkey/types"
+)
+
+var ErrBadZoom = errors.New("Zoom must be at least 1.")
+var ErrBadBounds = errors.New("Bounds are empty.")
+
+// Bounds are the chunks to draw, from Min to Max inclusive.
+type Bounds struct {
+	Min, Max ChunkXz
+}
+
+// Contains returns true if the chunk is within the bounds.
+func (bounds *Bounds) Contains(loc ChunkXz) bool {
+	return loc.X >= bounds.Min.X && loc.X <= bounds.Max.X &&
+		loc.Z >= bounds.Min.Z && loc.Z <= bounds.Max.Z
+}
+
+type Options struct {
+	// Zoom is the width of a block, in pixels.
+	Zoom int
+	// TileChunks is the width of a tile, in chunks. Tiles are aligned so
+	// that tile 0,0 starts at chunk 0,0, and are all the same size. 0 draws
+	// the bounds as a single tile.
+	TileChunks int
+}
+
+// Tile is a drawn part of the map.
+type Tile struct {
+	// X and Z locate the tile in the grid of tiles. They are both 0 if the
+	// map isn't tiled.
+	X, Z int
+	// Bounds are the chunks that the tile covers, whether or not they were
+	// drawn.
+	Bounds Bounds
+	Image  *image.RGBA
+}
+
+// Stats count the chunks drawn.
+type Stats struct {
+	Rendered int // Chunks drawn.
+	Missing  int // Chunks that don't exist, left transparent.
+	Failed   int // Chunks that couldn't be read, drawn in red.
+}
+
+// RenderTiles draws the chunks within bounds, passing each tile to fn as it
+// is finished. The tile's image is reused for the next tile once fn returns.
+// Chunks that fail to load are logged and drawn in red, rather than stopping
+// the rendering; err is only set for bad options or by fn.
+func RenderTiles(store chunkstore.IChunkStore, bounds Bounds, options Options, fn func(tile *Tile) error) (stats Stats, err error) {
+	if options.Zoom < 1 {
+		return stats, ErrBadZoom
+	}
+	if bounds.Min.X > bounds.Max.X || bounds.Min.Z > bounds.Max.Z {
+		return stats, ErrBadBounds
+	}
+
+	var minTile, maxTile image.Point
+	var widthX, widthZ int
+	if options.TileChunks > 0 {
+		size := options.TileChunks
+		minTile = image.Point{floorDiv(int(bounds.Min.X), size), floorDiv(int(bounds.Min.Z), size)}
+		maxTile = image.Point{floorDiv(int(bounds.Max.X), size), floorDiv(int(bounds.Max.Z), size)}
+		widthX, widthZ = size, size
+	} else {
+		widthX = int(bounds.Max.X-bounds.Min.X) + 1
+		widthZ = int(bounds.Max.Z-bounds.Min.Z) + 1
+	}
+
+	chunkPixels := ChunkSizeH * options.Zoom
+	img := image.NewRGBA(image.Rect(0, 0, widthX*chunkPixels, widthZ*chunkPixels))
+
+	for tileZ := minTile.Y; tileZ <= maxTile.Y; tileZ++ {
+		for tileX := minTile.X; tileX <= maxTile.X; tileX++ {
+			tile := &Tile{X: tileX, Z: tileZ, Image: img}
+			if options.TileChunks > 0 {
+				tile.Bounds.Min = ChunkXz{ChunkCoord(tileX * widthX), ChunkCoord(tileZ * widthZ)}
+			} else {
+				tile.Bounds.Min = bounds.Min
+			}
+			tile.Bounds.Max = ChunkXz{tile.Bounds.Min.X + ChunkCoord(widthX-1), tile.Bounds.Min.Z + ChunkCoord(widthZ-1)}
+
+			clearImage(img)
+			renderTile(store, &bounds, tile, options.Zoom, &stats)
+			if err = fn(tile); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// Render draws the chunks within bounds as a single image.
+func Render(store chunkstore.IChunkStore, bounds Bounds, zoom int) (img *image.RGBA, stats Stats, err error) {
+	stats, err = RenderTiles(store, bounds, Options{Zoom: zoom}, func(tile *Tile) error {
+		img = tile.Image
+		return nil
+	})
+	return
+}
+
+// WriteTiles draws the chunks within bounds as PNG files in dir, named
+// tile.<x>.<z>.png. Tiles with nothing drawn in them aren't written.
+func WriteTiles(store chunkstore.IChunkStore, bounds Bounds, options Options, dir string) (stats Stats, err error) {
+	if err = os.MkdirAll(dir, 0777); err != nil {
+		return
+	}
+	return RenderTiles(store, bounds, options, func(tile *Tile) error {
+		if !isEmpty(tile.Image) {
+			return WritePNG(filepath.Join(dir, fmt.Sprintf("tile.%d.%d.png", tile.X, tile.Z)), tile.Image)
+		}
+		return nil
+	})
+}
+
+// WritePNG writes the image to a PNG file.
+func WritePNG(filename string, img image.Image) (err error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return
+	}
+	if err = png.Encode(file, img); err != nil {
+		file.Close()
+		return
+	}
+	return file.Close()
+}
+
+// renderTile draws the chunks in the tile that are within bounds, reading a
+// row of chunks at a time.
+func renderTile(store chunkstore.IChunkStore, bounds *Bounds, tile *Tile, zoom int, stats *Stats) {
+	chunkPixels := ChunkSizeH * zoom
+	results := make([]<-chan chunkstore.ChunkReadResult, tile.Bounds.Max.X-tile.Bounds.Min.X+1)
+
+	for z := tile.Bounds.Min.Z; z <= tile.Bounds.Max.Z; z++ {
+		// All of the row's reads are requested before any is waited for, so
+		// that the store is kept busy.
+		for i := range results {
+			loc := ChunkXz{tile.Bounds.Min.X + ChunkCoord(i), z}
+			results[i] = nil
+			if bounds.Contains(loc) {
+				results[i] = store.ReadChunk(loc)
+			}
+		}
+
+		for i, resultChan := range results {
+			if resultChan == nil {
+				continue
+			}
+			loc := ChunkXz{tile.Bounds.Min.X + ChunkCoord(i), z}
+			offset := image.Point{i * chunkPixels, int(z-tile.Bounds.Min.Z) * chunkPixels}
+
+			result := <-resultChan
+			err := result.Err
+			if err == nil {
+				err = renderChunk(tile.Image, offset, zoom, result.Reader)
+			}
+			switch {
+			case err == nil:
+				stats.Rendered++
+			case chunkstore.IsNoSuchChunk(err):
+				stats.Missing++
+			default:
+				logger.Chunk.Warn("Could not render chunk", "chunk", loc, "err", err)
+				stats.Failed++
+				markFailed(tile.Image, image.Rect(0, 0, chunkPixels, chunkPixels).Add(offset))
+			}
+		}
+	}
+}
+
+// renderChunk draws the chunk with its north-west corner at offset.
+func renderChunk(img *image.RGBA, offset image.Point, zoom int, reader chunkstore.IChunkReader) error {
+	blocks := reader.Blocks()
+	if len(blocks) != ChunkSizeH*ChunkSizeH*ChunkSizeY {
+		return &chunkstore.CorruptChunkError{reader.ChunkLoc(), fmt.Errorf("%d blocks", len(blocks))}
+	}
+
+	for x := 0; x < ChunkSizeH; x++ {
+		for z := 0; z < ChunkSizeH; z++ {
+			for y := ChunkSizeY - 1; y >= 0; y-- {
+				subLoc := SubChunkXyz{SubChunkCoord(x), SubChunkCoord(y), SubChunkCoord(z)}
+				index, _ := subLoc.BlockIndex()
+				id := index.BlockId(blocks)
+				if id == BlockIdAir {
+					continue
+				}
+
+				c := blockColor(id, y)
+				for px := 0; px < zoom; px++ {
+					for pz := 0; pz < zoom; pz++ {
+						img.SetRGBA(offset.X+x*zoom+px, offset.Y+z*zoom+pz, c)
+					}
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// markFailed marks the rectangle as failed, with a cross so that it can be
+// told apart from red blocks.
+func markFailed(img *image.RGBA, rect image.Rectangle) {
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			img.SetRGBA(x, y, failedColor)
+		}
+	}
+	for i := 0; i < rect.Dx(); i++ {
+		img.SetRGBA(rect.Min.X+i, rect.Min.Y+i, unknownColor)
+		img.SetRGBA(rect.Max.X-1-i, rect.Min.Y+i, unknownColor)
+	}
+}
+
+func clearImage(img *image.RGBA) {
+	for i := range img.Pix {
+		img.Pix[i] = 0
+	}
+}
+
+// isEmpty returns true if nothing has been drawn on the image.
+func isEmpty(img *image.RGBA) bool {
+	for _, b := range img.Pix {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// floorDiv divides, rounding towards negative infinity.
+func floorDiv(n, d int) int {
+	if n < 0 {
+		return -((d - 1 - n) / d)
+	}
+	return n / d
+}
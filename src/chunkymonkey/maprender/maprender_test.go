@@ -0,0 +1,158 @@
+package maprender
+
+import (
+	"image/color"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"chunkymonkey/chunkstore"
+	. "chunkymonkey/types"
+)
+
+const (
+	blockIdStone = BlockId(1)
+	blockIdGrass = BlockId(2)
+)
+
+// newTestStore serves a store holding a chunk of grass at height 64 at each
+// of the locations, with stone at height 100 in the north-west corner.
+func newTestStore(t *testing.T, locs ...ChunkXz) chunkstore.IChunkStore {
+	memStore := chunkstore.NewMemoryStore()
+	for _, loc := range locs {
+		blocks := make([]byte, ChunkSizeH*ChunkSizeH*ChunkSizeY)
+		for x := 0; x < ChunkSizeH; x++ {
+			for z := 0; z < ChunkSizeH; z++ {
+				subLoc := SubChunkXyz{SubChunkCoord(x), 64, SubChunkCoord(z)}
+				index, _ := subLoc.BlockIndex()
+				index.SetBlockId(blocks, blockIdGrass)
+			}
+		}
+		subLoc := SubChunkXyz{0, 100, 0}
+		index, _ := subLoc.BlockIndex()
+		index.SetBlockId(blocks, blockIdStone)
+
+		writer := memStore.Writer()
+		writer.SetChunkLoc(loc)
+		writer.SetBlocks(blocks)
+		if err := memStore.WriteChunk(writer); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store := chunkstore.NewChunkService(memStore)
+	go store.Serve()
+	return store
+}
+
+func TestRender(t *testing.T) {
+	store := newTestStore(t, ChunkXz{0, 0}, ChunkXz{1, 1})
+	bounds := Bounds{ChunkXz{0, 0}, ChunkXz{1, 1}}
+
+	img, stats, err := Render(store, bounds, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (Stats{Rendered: 2, Missing: 2}) {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if size := img.Bounds().Size(); size.X != 64 || size.Y != 64 {
+		t.Fatalf("Expected a 64x64 image, got %v", size)
+	}
+
+	type Test struct {
+		x, y     int
+		expected color.RGBA
+	}
+
+	var tests = []Test{
+		// The highest block is drawn, zoomed to 2x2 pixels.
+		{0, 0, blockColor(blockIdStone, 100)},
+		{1, 1, blockColor(blockIdStone, 100)},
+		{2, 0, blockColor(blockIdGrass, 64)},
+		{63, 63, blockColor(blockIdGrass, 64)},
+		// Missing chunks are transparent.
+		{32, 0, color.RGBA{}},
+		{0, 32, color.RGBA{}},
+	}
+
+	for _, test := range tests {
+		if c := img.RGBAAt(test.x, test.y); c != test.expected {
+			t.Errorf("Pixel %d,%d: expected %v, got %v", test.x, test.y, test.expected, c)
+		}
+	}
+
+	if _, _, err = Render(store, bounds, 0); err != ErrBadZoom {
+		t.Errorf("Expected ErrBadZoom, got %v", err)
+	}
+	if _, _, err = Render(store, Bounds{ChunkXz{1, 0}, ChunkXz{0, 0}}, 1); err != ErrBadBounds {
+		t.Errorf("Expected ErrBadBounds, got %v", err)
+	}
+}
+
+func TestRender_Corrupt(t *testing.T) {
+	memStore := chunkstore.NewMemoryStore()
+	writer := memStore.Writer()
+	writer.SetChunkLoc(ChunkXz{0, 0})
+	writer.SetBlocks(make([]byte, 100))
+	memStore.WriteChunk(writer)
+	store := chunkstore.NewChunkService(memStore)
+	go store.Serve()
+
+	img, stats, err := Render(store, Bounds{ChunkXz{0, 0}, ChunkXz{0, 0}}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (Stats{Failed: 1}) {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if c := img.RGBAAt(1, 0); c != failedColor {
+		t.Errorf("Expected the corrupt chunk to be marked, got %v", c)
+	}
+}
+
+func TestWriteTiles(t *testing.T) {
+	store := newTestStore(t, ChunkXz{-1, 0}, ChunkXz{2, 0})
+	dir := t.TempDir()
+
+	// Tiles of 2x2 chunks, of which the one from 0,0 to 1,1 is empty.
+	stats, err := WriteTiles(store, Bounds{ChunkXz{-2, 0}, ChunkXz{3, 0}}, Options{Zoom: 1, TileChunks: 2}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (Stats{Rendered: 2, Missing: 4}) {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	names, _ := filepath.Glob(filepath.Join(dir, "*"))
+	sort.Strings(names)
+	expected := []string{filepath.Join(dir, "tile.-1.0.png"), filepath.Join(dir, "tile.1.0.png")}
+	if len(names) != len(expected) || names[0] != expected[0] || names[1] != expected[1] {
+		t.Errorf("Expected tiles %q, got %q", expected, names)
+	}
+	if fi, err := os.Stat(expected[0]); err != nil || fi.Size() == 0 {
+		t.Errorf("Expected a PNG in %s, got %v", expected[0], err)
+	}
+}
+
+func TestFloorDiv(t *testing.T) {
+	type Test struct {
+		n, d, expected int
+	}
+
+	var tests = []Test{
+		{0, 32, 0},
+		{31, 32, 0},
+		{32, 32, 1},
+		{-1, 32, -1},
+		{-32, 32, -1},
+		{-33, 32, -2},
+	}
+
+	for _, test := range tests {
+		if result := floorDiv(test.n, test.d); result != test.expected {
+			t.Errorf("floorDiv(%d, %d): expected %d, got %d", test.n, test.d, test.expected, result)
+		}
+	}
+}
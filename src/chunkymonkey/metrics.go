@@ -0,0 +1,144 @@
+package chunkymonkey
+
+import (
+	"expvar"
+	"flag"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"chunkymonkey/chunkstore"
+)
+
+var publishMetrics = flag.Bool(
+	"metrics", true,
+	"Publish game metrics as the \"game-metrics\" expvar, served with the "+
+		"HTTP diagnostics at /debug/vars.")
+
+// GameMetrics are published as the "game-metrics" expvar. The JSON keys are
+// the documented names of the metrics, and must not change without warning.
+type GameMetrics struct {
+	PlayersOnline int `json:"players-online"`
+	ChunksLoaded  int `json:"chunks-loaded"`
+	// Entities counts entities by kind: "player", "item", "mob", "object" or
+	// "other".
+	Entities map[string]int `json:"entities"`
+
+	// MainQueueDepth is the number of requests waiting for the game's main
+	// loop.
+	MainQueueDepth int `json:"main-queue-depth"`
+	// Time taken by the game's ticks since the previous update.
+	TickDurationAvgNs int64 `json:"tick-duration-avg-ns"`
+	TickDurationMaxNs int64 `json:"tick-duration-max-ns"`
+
+	ChunkStore chunkstore.ChunkStoreStats `json:"chunk-store"`
+
+	// Bytes sent to and received from all connections, including those that
+	// didn't log in.
+	BytesSent     int64 `json:"bytes-sent"`
+	BytesReceived int64 `json:"bytes-received"`
+
+	// PlayerSendQueueDepths is the number of packets queued to send to each
+	// player, by name.
+	PlayerSendQueueDepths map[string]int `json:"player-send-queue-depths"`
+}
+
+// gameMetrics holds the latest metrics, updated once a second by the main loop
+// of the game that publishes them.
+var gameMetrics struct {
+	lock    sync.Mutex
+	game    *Game
+	metrics GameMetrics
+	publish sync.Once
+}
+
+// publishGameMetrics makes the game the one whose metrics are published.
+func publishGameMetrics(game *Game) {
+	gameMetrics.lock.Lock()
+	gameMetrics.game = game
+	gameMetrics.lock.Unlock()
+
+	gameMetrics.publish.Do(func() {
+		expvar.Publish("game-metrics", expvar.Func(func() interface{} {
+			gameMetrics.lock.Lock()
+			defer gameMetrics.lock.Unlock()
+			return gameMetrics.metrics
+		}))
+	})
+}
+
+// tickTimes accumulates the time taken by ticks. It is only used by the main
+// loop.
+type tickTimes struct {
+	count int64
+	total time.Duration
+	max   time.Duration
+}
+
+func (t *tickTimes) add(duration time.Duration) {
+	t.count++
+	t.total += duration
+	if duration > t.max {
+		t.max = duration
+	}
+}
+
+// netStats count the bytes sent and received over a game's connections.
+type netStats struct {
+	sent, received int64
+}
+
+// countingConn counts the bytes read and written through a connection.
+type countingConn struct {
+	net.Conn
+	stats *netStats
+}
+
+func (conn *countingConn) Read(b []byte) (n int, err error) {
+	n, err = conn.Conn.Read(b)
+	atomic.AddInt64(&conn.stats.received, int64(n))
+	return
+}
+
+func (conn *countingConn) Write(b []byte) (n int, err error) {
+	n, err = conn.Conn.Write(b)
+	atomic.AddInt64(&conn.stats.sent, int64(n))
+	return
+}
+
+// updateMetrics takes a snapshot of the game's metrics for publishing.
+func (game *Game) updateMetrics() {
+	if !*publishMetrics {
+		return
+	}
+
+	shardStats := game.shardManager.Stats()
+
+	metrics := GameMetrics{
+		PlayersOnline:         len(game.players),
+		ChunksLoaded:          shardStats.Chunks,
+		Entities:              shardStats.Entities,
+		MainQueueDepth:        len(game.workQueue),
+		TickDurationMaxNs:     int64(game.tickTimes.max),
+		ChunkStore:            game.worldStore.ChunkStoreStats(),
+		BytesSent:             atomic.LoadInt64(&game.netStats.sent),
+		BytesReceived:         atomic.LoadInt64(&game.netStats.received),
+		PlayerSendQueueDepths: make(map[string]int, len(game.players)),
+	}
+	metrics.Entities["player"] = len(game.players)
+	if game.tickTimes.count > 0 {
+		metrics.TickDurationAvgNs = int64(game.tickTimes.total) / game.tickTimes.count
+	}
+	game.tickTimes = tickTimes{}
+
+	for _, player := range game.players {
+		metrics.PlayerSendQueueDepths[player.Name()] = player.TxQueueStats().Depth
+	}
+
+	gameMetrics.lock.Lock()
+	defer gameMetrics.lock.Unlock()
+	if gameMetrics.game == game {
+		gameMetrics.metrics = metrics
+	}
+}
@@ -0,0 +1,62 @@
+package chunkymonkey
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGameMetrics(t *testing.T) {
+	_, listener := newTestGame(t)
+	loginPlaced(t, listener, "alice")
+
+	// Read the metrics as served over HTTP, once they include the player and
+	// the chunks sent to them.
+	var metrics map[string]interface{}
+	for deadline := time.Now().Add(testTimeout); ; {
+		recorder := httptest.NewRecorder()
+		expvar.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/vars", nil))
+
+		var vars map[string]json.RawMessage
+		if err := json.Unmarshal(recorder.Body.Bytes(), &vars); err != nil {
+			t.Fatalf("Bad JSON from /debug/vars: %v", err)
+		}
+		if err := json.Unmarshal(vars["game-metrics"], &metrics); err != nil {
+			t.Fatalf("Bad game-metrics: %v", err)
+		}
+		if chunks, _ := metrics["chunks-loaded"].(float64); chunks > 0 && metrics["players-online"] == 1.0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected 1 player online with chunks loaded, got metrics %v", metrics)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	keys := []string{
+		"players-online",
+		"chunks-loaded",
+		"entities",
+		"main-queue-depth",
+		"tick-duration-avg-ns",
+		"tick-duration-max-ns",
+		"chunk-store",
+		"bytes-sent",
+		"bytes-received",
+		"player-send-queue-depths",
+	}
+	for _, key := range keys {
+		if _, ok := metrics[key]; !ok {
+			t.Errorf("Expected metric %q", key)
+		}
+	}
+
+	if sent, _ := metrics["bytes-sent"].(float64); sent == 0 {
+		t.Errorf("Expected bytes to have been sent, got %v", metrics["bytes-sent"])
+	}
+	if depths, _ := metrics["player-send-queue-depths"].(map[string]interface{}); depths["alice"] == nil {
+		t.Errorf("Expected a send queue depth for alice, got %v", metrics["player-send-queue-depths"])
+	}
+}
@@ -9,82 +9,68 @@ import (
 )
 
 func ReadFloat2(tag nbt.ITag, path string) (x, y float32, err error) {
-	list, ok := tag.Lookup(path).(*nbt.List)
+	list, ok := nbt.GetList(tag, path, nbt.TagFloat)
 	if !ok || len(list.Value) != 2 {
-		err = fmt.Errorf("ReadFloat2 %q: not a list of 2", path)
+		err = fmt.Errorf("ReadFloat2 %q: not a list of 2 Floats", path)
 		return
 	}
 
-	xv, xok := list.Value[0].(*nbt.Float)
-	yv, yok := list.Value[1].(*nbt.Float)
-
-	if ok = xok && yok; ok {
-		x, y = xv.Value, yv.Value
-	} else {
-		err = fmt.Errorf("ReadFloat2 %q: X or Y was not a Float", path)
-	}
-
-	return
+	return list.Value[0].(*nbt.Float).Value, list.Value[1].(*nbt.Float).Value, nil
 }
 
 func ReadDouble3(tag nbt.ITag, path string) (x, y, z float64, err error) {
-	list, ok := tag.Lookup(path).(*nbt.List)
+	list, ok := nbt.GetList(tag, path, nbt.TagDouble)
 	if !ok || len(list.Value) != 3 {
-		err = fmt.Errorf("ReadDouble3 %q: not a list of 3", path)
+		err = fmt.Errorf("ReadDouble3 %q: not a list of 3 Doubles", path)
 		return
 	}
 
-	xv, xok := list.Value[0].(*nbt.Double)
-	yv, yok := list.Value[1].(*nbt.Double)
-	zv, zok := list.Value[2].(*nbt.Double)
-
-	if ok = xok && yok && zok; ok {
-		x, y, z = xv.Value, yv.Value, zv.Value
-	} else {
-		err = fmt.Errorf("ReadDouble3 %q: X, Y or Z was not a Double", path)
-	}
-
-	return
+	return list.Value[0].(*nbt.Double).Value, list.Value[1].(*nbt.Double).Value, list.Value[2].(*nbt.Double).Value, nil
 }
 
 func ReadShort(tag nbt.ITag, path string) (v int16, err error) {
-	vTag, ok := tag.Lookup(path).(*nbt.Short)
-	if !ok {
-		err = fmt.Errorf("ReadShort %q: was not a Short", path)
+	vTag, err := nbt.LookupType(tag, path, nbt.TagShort)
+	if err != nil {
 		return
 	}
 
-	return vTag.Value, nil
+	return vTag.(*nbt.Short).Value, nil
 }
 
 func ReadByte(tag nbt.ITag, path string) (v int8, err error) {
-	vTag, ok := tag.Lookup(path).(*nbt.Byte)
-	if !ok {
-		err = fmt.Errorf("ReadByte %q: was not a Byte", path)
+	vTag, err := nbt.LookupType(tag, path, nbt.TagByte)
+	if err != nil {
 		return
 	}
 
-	return vTag.Value, nil
+	return vTag.(*nbt.Byte).Value, nil
 }
 
 func ReadInt(tag nbt.ITag, path string) (v int32, err error) {
-	vTag, ok := tag.Lookup(path).(*nbt.Int)
-	if !ok {
-		err = fmt.Errorf("ReadInt %q: was not a Int", path)
+	vTag, err := nbt.LookupType(tag, path, nbt.TagInt)
+	if err != nil {
+		return
+	}
+
+	return vTag.(*nbt.Int).Value, nil
+}
+
+func ReadLong(tag nbt.ITag, path string) (v int64, err error) {
+	vTag, err := nbt.LookupType(tag, path, nbt.TagLong)
+	if err != nil {
 		return
 	}
 
-	return vTag.Value, nil
+	return vTag.(*nbt.Long).Value, nil
 }
 
 func ReadFloat(tag nbt.ITag, path string) (v float32, err error) {
-	vTag, ok := tag.Lookup(path).(*nbt.Float)
-	if !ok {
-		err = fmt.Errorf("ReadFloat %q: was not a Float", path)
+	vTag, err := nbt.LookupType(tag, path, nbt.TagFloat)
+	if err != nil {
 		return
 	}
 
-	return vTag.Value, nil
+	return vTag.(*nbt.Float).Value, nil
 }
 
 func ReadAbsXyz(tag nbt.ITag, path string) (pos AbsXyz, err error) {
@@ -117,16 +103,16 @@ func ReadLookDegrees(tag nbt.ITag, path string) (pos LookDegrees, err error) {
 }
 
 func ReadBlockXyzCompound(tag nbt.ITag) (loc BlockXyz, err error) {
-	x, xOk := tag.Lookup("x").(*nbt.Int)
-	y, yOk := tag.Lookup("y").(*nbt.Int)
-	z, zOk := tag.Lookup("z").(*nbt.Int)
+	x, xOk := nbt.GetInt(tag, "x")
+	y, yOk := nbt.GetInt(tag, "y")
+	z, zOk := nbt.GetInt(tag, "z")
 
 	if !xOk || !yOk || !zOk {
 		err = fmt.Errorf("ReadBlockXyzCompound: x, y or z was not present or not an Int in %#v", tag)
 		return
 	}
 
-	return BlockXyz{BlockCoord(x.Value), BlockYCoord(y.Value), BlockCoord(z.Value)}, nil
+	return BlockXyz{BlockCoord(x), BlockYCoord(y), BlockCoord(z)}, nil
 }
 
 func WriteBlockXyzCompound(compound *nbt.Compound, loc BlockXyz) {
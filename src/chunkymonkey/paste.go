@@ -0,0 +1,150 @@
+package chunkymonkey
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"chunkymonkey/gamerules"
+	"chunkymonkey/logger"
+	"chunkymonkey/schematic"
+	"chunkymonkey/shardserver"
+	. "chunkymonkey/types"
+)
+
+var schematicDir = flag.String(
+	"schematic_dir", "",
+	"The directory that /paste loads .schematic files from and /copy saves "+
+		"them to. Defaults to the schematics directory within the world.")
+
+// maxCopyBlocks is the most blocks that can be copied into a schematic at
+// once, to bound the memory and time that a copy takes.
+const maxCopyBlocks = 1 << 22
+
+var (
+	ErrBadSchematicName = errors.New("Schematic names must not contain a path.")
+	ErrCopyOutOfWorld   = errors.New("The region to copy is below the world.")
+	ErrCopyTooLarge     = errors.New("The region to copy is too large.")
+)
+
+// schematicPath returns the file of the named schematic within the schematic
+// directory. The ".schematic" extension may be left out of the name.
+func (game *Game) schematicPath(name string) (filename string, err error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return "", ErrBadSchematicName
+	}
+	if !strings.HasSuffix(name, ".schematic") {
+		name += ".schematic"
+	}
+	dir := *schematicDir
+	if dir == "" {
+		dir = filepath.Join(game.worldStore.WorldPath, "schematics")
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// paste pastes the schematic into the world with its lowest north-west corner
+// at the block, loading the chunks that it spans if need be. Blocks of
+// unknown types are left out. It must be run on the game's main loop, such as
+// with enqueue. done, if not nil, is called from another goroutine once the
+// blocks have been changed.
+func (game *Game) paste(s *schematic.Schematic, at BlockXyz, options schematic.PasteOptions, done func(changed int, err error)) {
+	var changes []shardserver.BlockChange
+	var unknown int
+	s.Rotate(options.Rotation).Each(at, options.SkipAir, func(loc BlockXyz, blockId BlockId, blockData byte) {
+		if _, ok := gamerules.Blocks.Get(blockId); !ok {
+			unknown++
+			return
+		}
+		changes = append(changes, shardserver.BlockChange{loc, blockId, blockData})
+	})
+	if unknown > 0 {
+		logger.World.Warn("Pasting left out blocks of unknown types", "at", at, "blocks", unknown)
+	}
+
+	logger.World.Info("Pasting schematic", "at", at, "blocks", len(changes), "rotation", options.Rotation)
+	game.shardManager.SetBlocks(changes, done)
+}
+
+// PasteSchematic implements IGame.PasteSchematic.
+func (game *Game) PasteSchematic(name string, at BlockXyz, options schematic.PasteOptions, done func(changed int, err error)) {
+	filename, err := game.schematicPath(name)
+	var s *schematic.Schematic
+	if err == nil {
+		s, err = schematic.Load(filename)
+	}
+	if err != nil {
+		if done != nil {
+			done(0, err)
+		}
+		return
+	}
+
+	game.enqueue(func(game *Game) {
+		game.paste(s, at, options, done)
+	})
+}
+
+// CopySchematic implements IGame.CopySchematic.
+func (game *Game) CopySchematic(name string, from, to BlockXyz, done func(blocks int, err error)) {
+	finish := func(blocks int, err error) {
+		if done != nil {
+			done(blocks, err)
+		}
+	}
+
+	filename, err := game.schematicPath(name)
+	if err != nil {
+		finish(0, err)
+		return
+	}
+
+	min, max := from, to
+	if min.X > max.X {
+		min.X, max.X = max.X, min.X
+	}
+	if min.Y > max.Y {
+		min.Y, max.Y = max.Y, min.Y
+	}
+	if min.Z > max.Z {
+		min.Z, max.Z = max.Z, min.Z
+	}
+	if min.Y < 0 {
+		finish(0, ErrCopyOutOfWorld)
+		return
+	}
+	width := int64(max.X-min.X) + 1
+	height := int64(max.Y-min.Y) + 1
+	length := int64(max.Z-min.Z) + 1
+	if width*height*length > maxCopyBlocks {
+		finish(0, ErrCopyTooLarge)
+		return
+	}
+
+	s, err := schematic.New(int(width), int(height), int(length))
+	if err != nil {
+		finish(0, err)
+		return
+	}
+
+	logger.World.Info("Copying schematic", "from", min, "to", max, "schematic", filename)
+	// Each block is set by only one shard, so the shards can set them
+	// concurrently.
+	game.shardManager.ReadBlocks(min, max, func(loc BlockXyz, blockId BlockId, blockData byte) {
+		s.Set(int(loc.X-min.X), int(loc.Y-min.Y), int(loc.Z-min.Z), blockId, blockData)
+	}, func(err error) {
+		if err == nil {
+			err = os.MkdirAll(filepath.Dir(filename), 0777)
+		}
+		if err == nil {
+			err = s.Save(filename)
+		}
+		if err != nil {
+			finish(0, err)
+			return
+		}
+		finish(len(s.Blocks), nil)
+	})
+}
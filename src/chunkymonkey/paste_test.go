@@ -0,0 +1,171 @@
+package chunkymonkey
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"chunkymonkey/proto"
+	"chunkymonkey/schematic"
+	. "chunkymonkey/types"
+	"chunkymonkey/worldstore"
+	"nbt"
+)
+
+func TestGame_schematicPath(t *testing.T) {
+	defer func(dir string) { *schematicDir = dir }(*schematicDir)
+	*schematicDir = "schematics"
+	game := &Game{worldStore: &worldstore.WorldStore{WorldPath: "world"}}
+
+	type Test struct {
+		name     string
+		expected string
+		err      error
+	}
+
+	var tests = []Test{
+		{"castle", filepath.Join("schematics", "castle.schematic"), nil},
+		{"castle.schematic", filepath.Join("schematics", "castle.schematic"), nil},
+		{"", "", ErrBadSchematicName},
+		{"../castle", "", ErrBadSchematicName},
+		{"sub/castle", "", ErrBadSchematicName},
+		{"..", "", ErrBadSchematicName},
+	}
+
+	for _, test := range tests {
+		filename, err := game.schematicPath(test.name)
+		if filename != test.expected || err != test.err {
+			t.Errorf("schematicPath(%q): expected %q, %v, got %q, %v", test.name, test.expected, test.err, filename, err)
+		}
+	}
+
+	// Schematics are kept in the world by default.
+	*schematicDir = ""
+	expected := filepath.Join("world", "schematics", "castle.schematic")
+	if filename, err := game.schematicPath("castle"); filename != expected || err != nil {
+		t.Errorf("Expected %q, got %q, %v", expected, filename, err)
+	}
+}
+
+func TestGame_PasteSchematic(t *testing.T) {
+	defer func(dir string) { *schematicDir = dir }(*schematicDir)
+	*schematicDir = t.TempDir()
+
+	// A 2x1x2 square of cobblestone, with an air block.
+	root, _ := nbt.NewBuilder().
+		PutCompound("Schematic", nbt.NewBuilder().
+			PutShort("Width", 2).
+			PutShort("Height", 1).
+			PutShort("Length", 2).
+			PutByteArray("Blocks", []byte{4, 4, 4, 0}).
+			PutByteArray("Data", make([]byte, 4))).
+		Build()
+	file, err := os.Create(filepath.Join(*schematicDir, "square.schematic"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = nbt.WriteCompressed(file, root, nbt.CompressionGzip); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	game, listener := newTestGame(t)
+	alice := loginPlaced(t, listener, "alice")
+
+	type Result struct {
+		changed int
+		err     error
+	}
+	result := make(chan Result, 1)
+	done := func(changed int, err error) {
+		result <- Result{changed, err}
+	}
+
+	game.PasteSchematic("square", BlockXyz{2, 100, 2}, schematic.PasteOptions{SkipAir: true}, done)
+	if r := <-result; r.changed != 3 || r.err != nil {
+		t.Fatalf("Expected 3 blocks pasted, got %d, %v", r.changed, r.err)
+	}
+
+	// Alice is near enough to be told about the change.
+	if _, err = alice.WaitFor(testTimeout, proto.PacketIdBlockChangeMulti, nil); err != nil {
+		t.Errorf("Expected alice to be sent the changes: %v", err)
+	}
+
+	game.PasteSchematic("nosuch", BlockXyz{2, 100, 2}, schematic.PasteOptions{}, done)
+	if r := <-result; r.err == nil {
+		t.Errorf("Expected a missing schematic to fail")
+	}
+}
+
+func TestGame_CopySchematic(t *testing.T) {
+	defer func(dir string) { *schematicDir = dir }(*schematicDir)
+	*schematicDir = ""
+
+	game, _ := newTestGame(t)
+
+	type Result struct {
+		blocks int
+		err    error
+	}
+	result := make(chan Result, 1)
+	done := func(blocks int, err error) {
+		result <- Result{blocks, err}
+	}
+	copyRegion := func(name string, from, to BlockXyz) *schematic.Schematic {
+		game.CopySchematic(name, from, to, done)
+		if r := <-result; r.blocks != 8 || r.err != nil {
+			t.Fatalf("Expected 8 blocks copied, got %d, %v", r.blocks, r.err)
+		}
+		s, err := schematic.Load(filepath.Join(game.worldStore.WorldPath, "schematics", name+".schematic"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	// Build a 2x2x2 cube of different blocks, and copy it with the corners
+	// given in any order.
+	s := copyRegion("empty", BlockXyz{2, 100, 2}, BlockXyz{3, 101, 3})
+	for i := range s.Blocks {
+		s.Blocks[i] = byte(1 + i)
+		s.Data[i] = byte(i)
+	}
+	s.Blocks[5] = byte(BlockIdAir)
+	pasted := make(chan error, 1)
+	game.enqueue(func(game *Game) {
+		game.paste(s, BlockXyz{2, 100, 2}, schematic.PasteOptions{}, func(_ int, err error) {
+			pasted <- err
+		})
+	})
+	if err := <-pasted; err != nil {
+		t.Fatal(err)
+	}
+
+	copied := copyRegion("cube", BlockXyz{3, 101, 2}, BlockXyz{2, 100, 3})
+	if copied.Width != 2 || copied.Height != 2 || copied.Length != 2 ||
+		!bytes.Equal(copied.Blocks, s.Blocks) || !bytes.Equal(copied.Data, s.Data) {
+		t.Errorf("Expected %+v, got %+v", s, copied)
+	}
+
+	// The copy pastes elsewhere as the original.
+	game.PasteSchematic("cube", BlockXyz{-40, 90, 50}, schematic.PasteOptions{}, func(_ int, err error) {
+		pasted <- err
+	})
+	if err := <-pasted; err != nil {
+		t.Fatal(err)
+	}
+	again := copyRegion("again", BlockXyz{-40, 90, 50}, BlockXyz{-39, 91, 51})
+	if !bytes.Equal(again.Blocks, s.Blocks) || !bytes.Equal(again.Data, s.Data) {
+		t.Errorf("Expected %+v, got %+v", s, again)
+	}
+
+	game.CopySchematic("low", BlockXyz{0, -1, 0}, BlockXyz{1, 1, 1}, done)
+	if r := <-result; r.err != ErrCopyOutOfWorld {
+		t.Errorf("Expected ErrCopyOutOfWorld, got %v", r.err)
+	}
+	game.CopySchematic("huge", BlockXyz{0, 0, 0}, BlockXyz{1000, 100, 1000}, done)
+	if r := <-result; r.err != ErrCopyTooLarge {
+		t.Errorf("Expected ErrCopyTooLarge, got %v", r.err)
+	}
+}
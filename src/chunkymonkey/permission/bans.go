@@ -0,0 +1,157 @@
+package permission
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// banTimeFormat is the format of the times in the ban lists.
+const banTimeFormat = "2006-01-02 15:04:05 -0700"
+
+// banForever is the expiry time of a permanent ban.
+const banForever = "forever"
+
+// Ban is an entry in a BanList. Either the Name or the Ip is set, depending on
+// the list.
+type Ban struct {
+	Name    string `json:"name,omitempty"`
+	Ip      string `json:"ip,omitempty"`
+	Created string `json:"created"`
+	Source  string `json:"source"`
+	Expires string `json:"expires"`
+	Reason  string `json:"reason"`
+}
+
+// key returns the name or address that is banned.
+func (ban *Ban) key() string {
+	if ban.Ip != "" {
+		return ban.Ip
+	}
+	return ban.Name
+}
+
+// Expired returns true if the ban expired before now. Bans that don't expire,
+// or whose expiry can't be parsed, never do.
+func (ban *Ban) Expired(now time.Time) bool {
+	if ban.Expires == "" || ban.Expires == banForever {
+		return false
+	}
+	expires, err := time.Parse(banTimeFormat, ban.Expires)
+	return err == nil && expires.Before(now)
+}
+
+// BanList is a list of banned players or IP addresses, stored as in the
+// standard server's banned-players.json and banned-ips.json, and saved
+// whenever it changes. Names are matched without regard to case.
+type BanList struct {
+	filename string
+	byIp     bool
+
+	lock sync.Mutex
+	bans []Ban
+}
+
+// LoadBanList loads a list of banned players from filename. A missing file is
+// not an error, and results in an empty list, which is created on the first
+// change.
+func LoadBanList(filename string) (list *BanList, err error) {
+	return loadBanList(filename, false)
+}
+
+// LoadIpBanList loads a list of banned IP addresses from filename, as
+// LoadBanList does for players.
+func LoadIpBanList(filename string) (list *BanList, err error) {
+	return loadBanList(filename, true)
+}
+
+func loadBanList(filename string, byIp bool) (list *BanList, err error) {
+	list = &BanList{filename: filename, byIp: byIp}
+	if err = loadJsonList(filename, &list.bans); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Banned returns the ban on the player name or IP address, if it is banned and
+// the ban hasn't expired.
+func (list *BanList) Banned(key string) (ban Ban, banned bool) {
+	list.lock.Lock()
+	defer list.lock.Unlock()
+
+	i := list.find(key)
+	if i < 0 || list.bans[i].Expired(time.Now()) {
+		return
+	}
+	return list.bans[i], true
+}
+
+// Keys returns the banned names or addresses.
+func (list *BanList) Keys() (keys []string) {
+	list.lock.Lock()
+	defer list.lock.Unlock()
+	for i := range list.bans {
+		keys = append(keys, list.bans[i].key())
+	}
+	return
+}
+
+// Ban bans the player name or IP address forever, and saves the list. Any
+// existing ban on it is replaced. source is who banned it.
+func (list *BanList) Ban(key, source, reason string) (err error) {
+	list.lock.Lock()
+	defer list.lock.Unlock()
+
+	ban := Ban{
+		Created: time.Now().Format(banTimeFormat),
+		Source:  source,
+		Expires: banForever,
+		Reason:  reason,
+	}
+	if list.byIp {
+		ban.Ip = key
+	} else {
+		ban.Name = key
+	}
+
+	old := list.bans
+	list.bans = append([]Ban(nil), old...)
+	if i := list.find(key); i >= 0 {
+		list.bans[i] = ban
+	} else {
+		list.bans = append(list.bans, ban)
+	}
+	if err = saveJsonList(list.filename, list.bans); err != nil {
+		list.bans = old
+	}
+	return
+}
+
+// Pardon lifts the ban on the player name or IP address, and saves the list.
+// removed is false if it wasn't banned.
+func (list *BanList) Pardon(key string) (removed bool, err error) {
+	list.lock.Lock()
+	defer list.lock.Unlock()
+
+	i := list.find(key)
+	if i < 0 {
+		return false, nil
+	}
+	old := list.bans
+	list.bans = append(append([]Ban(nil), old[:i]...), old[i+1:]...)
+	if err = saveJsonList(list.filename, list.bans); err != nil {
+		list.bans = old
+		return
+	}
+	return true, nil
+}
+
+// find returns the index of the ban on the name or address, or -1.
+func (list *BanList) find(key string) int {
+	for i := range list.bans {
+		if strings.EqualFold(list.bans[i].key(), key) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,88 @@
+package permission
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBanList_Persistence(t *testing.T) {
+	filename := tempListFile(t, "banned-players.json")
+
+	list, err := LoadBanList(filename)
+	if err != nil {
+		t.Fatalf("Loading missing file: %v", err)
+	}
+	if err = list.Ban("griefy", "huin", "Griefing"); err != nil {
+		t.Fatal(err)
+	}
+	if err = list.Ban("Griefy", "agon", "Griefing again"); err != nil {
+		t.Fatal(err)
+	}
+	if err = list.Ban("spammy", "agon", ""); err != nil {
+		t.Fatal(err)
+	}
+	if removed, err := list.Pardon("SPAMMY"); err != nil || !removed {
+		t.Fatalf("Expected spammy to be pardoned, got removed=%t err=%v", removed, err)
+	}
+	if removed, _ := list.Pardon("nobody"); removed {
+		t.Errorf("Expected pardoning nobody to remove nothing")
+	}
+
+	loaded, err := LoadBanList(filename)
+	if err != nil {
+		t.Fatalf("Reloading: %v", err)
+	}
+	if keys := loaded.Keys(); !reflect.DeepEqual(keys, []string{"Griefy"}) {
+		t.Errorf("Expected reloaded bans [Griefy], got %v", keys)
+	}
+	ban, banned := loaded.Banned("griefy")
+	if !banned || ban.Source != "agon" || ban.Reason != "Griefing again" || ban.Expires != banForever {
+		t.Errorf("Expected griefy banned by agon, got banned=%t %+v", banned, ban)
+	}
+	if _, banned := loaded.Banned("spammy"); banned {
+		t.Errorf("Expected spammy not to be banned")
+	}
+}
+
+func TestBanList_Ip(t *testing.T) {
+	list, err := LoadIpBanList(tempListFile(t, "banned-ips.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = list.Ban("10.0.0.1", "Console", "Spam"); err != nil {
+		t.Fatal(err)
+	}
+
+	if ban, banned := list.Banned("10.0.0.1"); !banned || ban.Ip != "10.0.0.1" || ban.Name != "" {
+		t.Errorf("Expected 10.0.0.1 banned by address, got banned=%t %+v", banned, ban)
+	}
+	if _, banned := list.Banned("10.0.0.2"); banned {
+		t.Errorf("Expected 10.0.0.2 not to be banned")
+	}
+}
+
+func TestBan_Expired(t *testing.T) {
+	now := time.Date(2012, 1, 2, 12, 0, 0, 0, time.UTC)
+
+	type Test struct {
+		expires string
+		want    bool
+	}
+
+	tests := []Test{
+		{"", false},
+		{banForever, false},
+		{"not a time", false},
+		{"2012-01-02 11:00:00 +0000", true},
+		{"2012-01-02 13:00:00 +0000", false},
+		{"2012-01-02 13:00:00 +0200", true},
+	}
+
+	for _, test := range tests {
+		ban := Ban{Expires: test.expires}
+		if got := ban.Expired(now); got != test.want {
+			t.Errorf("Expires %q: got %t, want %t", test.expires, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package permission
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// NameEntry is an entry in a NameList.
+type NameEntry struct {
+	Name string `json:"name"`
+}
+
+// NameList is a list of users, such as the operators or the whitelist. It is
+// stored as a JSON list of objects with a "name", as in the standard server's
+// ops.json and whitelist.json, and is saved whenever it changes. Names are
+// matched without regard to case.
+type NameList struct {
+	filename string
+
+	lock    sync.Mutex
+	entries []NameEntry
+}
+
+// LoadNameList loads a list from filename. A missing file is not an error,
+// and results in an empty list, which is created on the first change.
+func LoadNameList(filename string) (list *NameList, err error) {
+	list = &NameList{filename: filename}
+	if err = loadJsonList(filename, &list.entries); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Contains returns true if the user is in the list.
+func (list *NameList) Contains(username string) bool {
+	list.lock.Lock()
+	defer list.lock.Unlock()
+	return list.find(username) >= 0
+}
+
+// Names returns the names in the list.
+func (list *NameList) Names() (names []string) {
+	list.lock.Lock()
+	defer list.lock.Unlock()
+	for _, entry := range list.entries {
+		names = append(names, entry.Name)
+	}
+	return
+}
+
+// Add adds the user to the list, and saves it. added is false if they were
+// already in it.
+func (list *NameList) Add(username string) (added bool, err error) {
+	list.lock.Lock()
+	defer list.lock.Unlock()
+
+	if list.find(username) >= 0 {
+		return false, nil
+	}
+	list.entries = append(list.entries, NameEntry{Name: username})
+	if err = saveJsonList(list.filename, list.entries); err != nil {
+		list.entries = list.entries[:len(list.entries)-1]
+		return
+	}
+	return true, nil
+}
+
+// Remove removes the user from the list, and saves it. removed is false if
+// they weren't in it.
+func (list *NameList) Remove(username string) (removed bool, err error) {
+	list.lock.Lock()
+	defer list.lock.Unlock()
+
+	i := list.find(username)
+	if i < 0 {
+		return false, nil
+	}
+	old := list.entries
+	list.entries = append(append([]NameEntry(nil), old[:i]...), old[i+1:]...)
+	if err = saveJsonList(list.filename, list.entries); err != nil {
+		list.entries = old
+		return
+	}
+	return true, nil
+}
+
+// find returns the index of the user in the list, or -1.
+func (list *NameList) find(username string) int {
+	for i, entry := range list.entries {
+		if strings.EqualFold(entry.Name, username) {
+			return i
+		}
+	}
+	return -1
+}
+
+// loadJsonList reads the JSON list in filename into entries, leaving them
+// empty if the file doesn't exist.
+func loadJsonList(filename string, entries interface{}) (err error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	return json.Unmarshal(data, entries)
+}
+
+// saveJsonList writes entries as JSON to a temporary file, which then
+// replaces filename, so that a failed write leaves the old list in place. A
+// nil slice of entries must be written as an empty list rather than null.
+func saveJsonList(filename string, entries interface{}) (err error) {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return
+	}
+	if string(data) == "null" {
+		data = []byte("[]")
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}()
+	if _, err = file.Write(append(data, '\n')); err != nil {
+		return
+	}
+	if err = file.Close(); err != nil {
+		return
+	}
+	return os.Rename(file.Name(), filename)
+}
@@ -0,0 +1,57 @@
+package permission
+
+// OpList is the list of operators, who have every permission, as stored in
+// ops.json.
+type OpList struct {
+	*NameList
+}
+
+// LoadOpList loads the operator list from filename. A missing file is not an
+// error, and results in an empty list, which is created on the first change.
+func LoadOpList(filename string) (list *OpList, err error) {
+	names, err := LoadNameList(filename)
+	if err != nil {
+		return
+	}
+	return &OpList{names}, nil
+}
+
+// IsOp returns true if the user is an operator.
+func (list *OpList) IsOp(username string) bool {
+	return list.Contains(username)
+}
+
+// Op makes the user an operator, and saves the list. added is false if they
+// already were one.
+func (list *OpList) Op(username string) (added bool, err error) {
+	return list.Add(username)
+}
+
+// Deop stops the user being an operator, and saves the list. removed is false
+// if they weren't one.
+func (list *OpList) Deop(username string) (removed bool, err error) {
+	return list.Remove(username)
+}
+
+// OpPermissions gives the operators in Ops every permission, and everyone else
+// their permissions from Permissions.
+type OpPermissions struct {
+	Permissions IPermissions
+	Ops         *OpList
+}
+
+// Implementation of IPermissions
+func (p *OpPermissions) UserPermissions(username string) IUserPermissions {
+	if p.Ops.IsOp(username) {
+		return allPermissions{}
+	}
+	return p.Permissions.UserPermissions(username)
+}
+
+// allPermissions are the permissions of an operator.
+type allPermissions struct{}
+
+// Implementation of IUserPermissions
+func (allPermissions) Has(node string) bool {
+	return true
+}
@@ -0,0 +1,81 @@
+package permission
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func tempListFile(t *testing.T, name string) string {
+	return filepath.Join(t.TempDir(), name)
+}
+
+func TestOpList_Persistence(t *testing.T) {
+	filename := tempListFile(t, "ops.json")
+
+	list, err := LoadOpList(filename)
+	if err != nil {
+		t.Fatalf("Loading missing file: %v", err)
+	}
+	if list.IsOp("huin") {
+		t.Errorf("Expected empty list, got %v", list.Names())
+	}
+
+	type Test struct {
+		op, name string
+		want     bool
+	}
+
+	tests := []Test{
+		{"op", "huin", true},
+		{"op", "HUIN", false},
+		{"op", "agon", true},
+		{"deop", "nobody", false},
+		{"deop", "Agon", true},
+		{"deop", "agon", false},
+	}
+
+	for _, test := range tests {
+		var changed bool
+		if test.op == "op" {
+			changed, err = list.Op(test.name)
+		} else {
+			changed, err = list.Deop(test.name)
+		}
+		if err != nil {
+			t.Fatalf("%s %q: %v", test.op, test.name, err)
+		}
+		if changed != test.want {
+			t.Errorf("%s %q: got changed=%t, want %t", test.op, test.name, changed, test.want)
+		}
+	}
+
+	loaded, err := LoadOpList(filename)
+	if err != nil {
+		t.Fatalf("Reloading: %v", err)
+	}
+	if names := loaded.Names(); !reflect.DeepEqual(names, []string{"huin"}) {
+		t.Errorf("Expected reloaded ops [huin], got %v", names)
+	}
+	if !loaded.IsOp("Huin") {
+		t.Errorf("Expected Huin to be an op")
+	}
+}
+
+func TestOpPermissions(t *testing.T) {
+	ops, err := LoadOpList(tempListFile(t, "ops.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ops.Op("defaulty"); err != nil {
+		t.Fatal(err)
+	}
+	perms := &OpPermissions{Permissions: testLoadPermission(), Ops: ops}
+
+	if !perms.UserPermissions("defaulty").Has("admin.commands.op") {
+		t.Errorf("Expected op to have every permission")
+	}
+	if perms.UserPermissions("griefy").Has("login") {
+		t.Errorf("Expected non-op to keep their own permissions")
+	}
+}
@@ -25,6 +25,14 @@ const (
 	objBlockDistance = 4.25 / PixelsPerBlock
 )
 
+// DefaultPhysics is the motion of point objects that haven't been given
+// their own PhysicsParams.
+var DefaultPhysics = PhysicsParams{
+	Gravity:  gravityBlocksPerTick2,
+	Drag:     1.0 / airResistance,
+	MinSpeed: minVel,
+}
+
 type blockAxisMove byte
 
 const (
@@ -47,20 +55,48 @@ type PointObject struct {
 	velocity  AbsVelocity
 	onGround  bool
 	remainder TickTime
+	physics   *PhysicsParams
 }
 
 func (obj *PointObject) Position() *AbsXyz {
 	return &obj.position
 }
 
+// OnGround returns true if the object has come to rest on a solid block.
+func (obj *PointObject) OnGround() bool {
+	return obj.onGround
+}
+
+// SetPhysics sets the constants for the object's motion. Objects use
+// DefaultPhysics until this is called.
+func (obj *PointObject) SetPhysics(params *PhysicsParams) {
+	obj.physics = params
+}
+
+func (obj *PointObject) physicsParams() *PhysicsParams {
+	if obj.physics == nil {
+		return &DefaultPhysics
+	}
+	return obj.physics
+}
+
 func (obj *PointObject) Init(position *AbsXyz, velocity *AbsVelocity) {
 	obj.LastSentPosition = *position.ToAbsIntXyz()
-	obj.LastSentVelocity = *velocity.ToVelocity()
+	obj.LastSentVelocity = *velocity.ToPacketVelocity()
 	obj.position = *position
 	obj.velocity = *velocity
 	obj.onGround = false
 }
 
+// Push adds to the object's velocity, lifting it off the ground so that the
+// push takes effect.
+func (obj *PointObject) Push(v *AbsVelocity) {
+	obj.velocity.X += v.X
+	obj.velocity.Y += v.Y
+	obj.velocity.Z += v.Z
+	obj.onGround = false
+}
+
 func (obj *PointObject) UnmarshalNbt(tag *nbt.Compound) (err error) {
 	// Position within the chunk
 	if obj.position, err = nbtutil.ReadAbsXyz(tag, "Pos"); err != nil {
@@ -72,7 +108,7 @@ func (obj *PointObject) UnmarshalNbt(tag *nbt.Compound) (err error) {
 	if obj.velocity, err = nbtutil.ReadAbsVelocity(tag, "Motion"); err != nil {
 		return
 	}
-	obj.LastSentVelocity = *obj.velocity.ToVelocity()
+	obj.LastSentVelocity = *obj.velocity.ToPacketVelocity()
 
 	if onGround, ok := tag.Lookup("OnGround").(*nbt.Byte); ok {
 		obj.onGround = onGround.Value != 0
@@ -137,7 +173,7 @@ func (obj *PointObject) SendUpdate(writer io.Writer, entityId EntityId, look *Lo
 		obj.LastSentPosition = *curPosition
 	}
 
-	curVelocity := obj.velocity.ToVelocity()
+	curVelocity := obj.velocity.ToPacketVelocity()
 	if curVelocity.X != obj.LastSentVelocity.X || curVelocity.Y != obj.LastSentVelocity.Y || curVelocity.Z != obj.LastSentVelocity.Z {
 		if err = proto.WriteEntityVelocity(writer, entityId, curVelocity); err != nil {
 			return
@@ -258,34 +294,7 @@ func (obj *PointObject) Tick(blockQuerier IBlockQuerier) (leftChunk bool) {
 }
 
 func (obj *PointObject) updateVelocity() (stopped bool) {
-	v := &obj.velocity
-
-	if !obj.onGround {
-		v.Y -= gravityBlocksPerTick2 * AbsVelocityCoord(1.0+float64(obj.remainder))
-	}
-
-	stopped = true
-
-	if v.X > -minVel && v.X < minVel {
-		v.X = 0
-	} else {
-		v.X -= v.X / airResistance
-		stopped = false
-	}
-	if v.Y > -minVel && v.Y < minVel {
-		v.Y = 0
-	} else {
-		v.Y -= v.Y / airResistance
-		stopped = false
-	}
-	if v.Z > -minVel && v.Z < minVel {
-		v.Z = 0
-	} else {
-		v.Z -= v.Z / airResistance
-		stopped = false
-	}
-
-	return
+	return obj.velocity.Accelerate(1.0+obj.remainder, obj.physicsParams(), obj.onGround)
 }
 
 func (obj *PointObject) nextBlockToEnter(move blockAxisMove) *BlockXyz {
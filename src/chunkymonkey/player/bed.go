@@ -0,0 +1,58 @@
+package player
+
+import (
+	"bytes"
+
+	"chunkymonkey/proto"
+	. "chunkymonkey/types"
+)
+
+const (
+	bedMissingMessage = "Your home bed was missing or obstructed"
+	bedDayMessage     = "You can only sleep at night"
+)
+
+// useBed makes the bed the player's home bed if it is night at the given
+// world time.
+func (player *Player) useBed(bed *BlockXyz, time Ticks) {
+	if time.IsDay() {
+		buf := new(bytes.Buffer)
+		proto.WriteChatMessage(buf, bedDayMessage)
+		player.TransmitPacket(buf.Bytes())
+		return
+	}
+	player.setHomeBed(bed)
+}
+
+// setHomeBed makes the bed the one that the player respawns at.
+func (player *Player) setHomeBed(bed *BlockXyz) {
+	player.homeBed = *bed
+	player.hasHomeBed = true
+}
+
+// notifyBedSpawn places the player beside their home bed on respawning. If the
+// bed has gone, the player respawns at the world spawn instead.
+func (player *Player) notifyBedSpawn(position *AbsXyz, ok bool) {
+	if !player.placePending {
+		return
+	}
+	player.placePending = false
+
+	if !ok {
+		player.hasHomeBed = false
+
+		buf := new(bytes.Buffer)
+		proto.WriteChatMessage(buf, bedMissingMessage)
+		player.TransmitPacket(buf.Bytes())
+
+		player.position = *player.spawnBlock.ToAbsXyz()
+		player.chunkSubs.Respawn(&player.position)
+		player.checkSpawnPosition()
+		return
+	}
+
+	player.position = *position
+	if player.chunkSubs.spawnChunksSent() {
+		player.place()
+	}
+}
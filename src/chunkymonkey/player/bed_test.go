@@ -0,0 +1,124 @@
+package player
+
+import (
+	"testing"
+
+	"chunkymonkey/proto"
+	. "chunkymonkey/types"
+	"nbt"
+)
+
+func isChatMessage(packet []byte) bool {
+	return packet[0] == proto.PacketIdChatMessage
+}
+
+func TestPlayer_RespawnAtBed(t *testing.T) {
+	player := newTestPlayer(BlockXyz{8, 70, 8})
+	player.chunkSubs.Init(player)
+	player.serveChunks()
+	player.setHomeBed(&BlockXyz{100, 64, 100})
+
+	player.health = 0
+	player.respawn()
+	connecter := player.shardConnecter.(*fakeShardConnecter)
+	if len(connecter.bedRequests) != 1 || connecter.bedRequests[0] != player.homeBed {
+		t.Fatalf("Expected the bed to be checked, got %v", connecter.bedRequests)
+	}
+
+	player.serveChunks()
+	if player.spawnComplete {
+		t.Fatalf("Player placed before the bed was checked")
+	}
+	player.sentPackets()
+
+	player.notifyBedSpawn(&AbsXyz{99.5, 64, 100.5}, true)
+	if !player.spawnComplete {
+		t.Fatalf("Player not placed after the bed was checked")
+	}
+	if expected := (AbsXyz{99.5, 64.01, 100.5}); player.position != expected {
+		t.Errorf("Expected player at %v, got %v", expected, player.position)
+	}
+}
+
+func TestPlayer_RespawnAtMissingBed(t *testing.T) {
+	player := newTestPlayer(BlockXyz{8, 70, 8})
+	player.chunkSubs.Init(player)
+	player.serveChunks()
+	player.setHomeBed(&BlockXyz{100, 64, 100})
+
+	player.health = 0
+	player.respawn()
+	player.notifyBedSpawn(&AbsXyz{}, false)
+	player.serveChunks()
+
+	if player.hasHomeBed {
+		t.Errorf("Expected the home bed to be forgotten")
+	}
+	if !player.spawnComplete {
+		t.Fatalf("Player not placed")
+	}
+	if !player.position.ToChunkXz().Equals(ChunkXz{0, 0}) {
+		t.Errorf("Expected player at world spawn, got %v", player.position)
+	}
+
+	var messages int
+	for _, packet := range player.sentPackets() {
+		if isChatMessage(packet) {
+			messages++
+		}
+	}
+	if messages != 1 {
+		t.Errorf("Expected 1 chat message, got %d", messages)
+	}
+}
+
+func TestPlayer_UseBed(t *testing.T) {
+	type Test struct {
+		time    Ticks
+		setsBed bool
+	}
+
+	var tests = []Test{
+		{NightStartTicks - 1, false},
+		{NightStartTicks, true},
+		{NightEndTicks - 1, true},
+		{NightEndTicks, false},
+		{TicksPerDay*10 + NightStartTicks, true},
+		{TicksPerDay * 10, false},
+	}
+
+	for _, test := range tests {
+		player := newTestPlayer(BlockXyz{8, 70, 8})
+		player.useBed(&BlockXyz{100, 64, 100}, test.time)
+		if player.hasHomeBed != test.setsBed {
+			t.Errorf("Time %d: expected home bed set %t, got %t", test.time, test.setsBed, player.hasHomeBed)
+		}
+		var messages int
+		for _, packet := range player.sentPackets() {
+			if isChatMessage(packet) {
+				messages++
+			}
+		}
+		if test.setsBed == (messages != 0) {
+			t.Errorf("Time %d: expected a message only if the bed isn't set, got %d", test.time, messages)
+		}
+	}
+}
+
+func TestPlayer_HomeBedNbt(t *testing.T) {
+	player := newTestPlayer(BlockXyz{8, 70, 8})
+	player.setHomeBed(&BlockXyz{-5, 64, 12})
+
+	tag := nbt.NewCompound()
+	if err := player.MarshalNbt(tag); err != nil {
+		t.Fatalf("MarshalNbt: %v", err)
+	}
+
+	loaded := newTestPlayer(BlockXyz{8, 70, 8})
+	if err := loaded.UnmarshalNbt(tag); err != nil {
+		t.Fatalf("UnmarshalNbt: %v", err)
+	}
+	if !loaded.hasHomeBed || loaded.homeBed != player.homeBed {
+		t.Errorf("Expected home bed %v, got %v (%t)", player.homeBed, loaded.homeBed, loaded.hasHomeBed)
+	}
+}
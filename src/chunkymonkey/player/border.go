@@ -0,0 +1,61 @@
+package player
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+
+	"chunkymonkey/proto"
+	. "chunkymonkey/types"
+)
+
+var borderWarningDistance = flag.Int(
+	"world_border_warning", 16,
+	"Players are warned when they come within this many blocks of the world "+
+		"border. 0 disables the warning.")
+
+const (
+	borderMessage        = "You have reached the edge of the world"
+	borderWarningMessage = "You are %d blocks from the edge of the world"
+)
+
+// keepWithinBorder moves the player back inside the world border if the
+// position is outside it, and returns true if it did. Players already outside,
+// such as those that logged out before the border was set, are pulled to the
+// nearest point inside.
+func (player *Player) keepWithinBorder(position *AbsXyz) bool {
+	border := player.game.WorldBorder()
+	pos := *position
+	if !border.Clamp(&pos) {
+		return false
+	}
+	player.setPositionLook(pos, player.look)
+
+	buf := new(bytes.Buffer)
+	proto.WriteChatMessage(buf, borderMessage)
+	player.TransmitPacket(buf.Bytes())
+	return true
+}
+
+// warnNearBorder tells the player when they first come near the world border.
+// They are warned again once they have moved away from it and back.
+func (player *Player) warnNearBorder() {
+	border := player.game.WorldBorder()
+	if !border.Enabled() {
+		return
+	}
+
+	distance := border.DistanceToEdge(&player.position)
+	if distance > AbsCoord(*borderWarningDistance) {
+		player.borderWarned = false
+		return
+	}
+	if player.borderWarned {
+		return
+	}
+	player.borderWarned = true
+
+	buf := new(bytes.Buffer)
+	proto.WriteChatMessage(buf, fmt.Sprintf(borderWarningMessage, int(distance)))
+	player.TransmitPacket(buf.Bytes())
+}
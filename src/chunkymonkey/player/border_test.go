@@ -0,0 +1,63 @@
+package player
+
+import (
+	"testing"
+
+	"chunkymonkey/proto"
+	. "chunkymonkey/types"
+)
+
+func TestPlayer_WorldBorder(t *testing.T) {
+	defer func(distance int) { *borderWarningDistance = distance }(*borderWarningDistance)
+	*borderWarningDistance = 4
+
+	player := newTestPlayer(BlockXyz{8, 70, 8})
+	player.game = &fakeGame{border: WorldBorder{Center: BlockXyz{8, 64, 8}, Radius: 20}}
+	player.chunkSubs.Init(player)
+	player.serveChunks()
+	player.sentPackets()
+
+	type Test struct {
+		desc     string
+		move     AbsXyz
+		expected AbsXyz
+		chat     bool
+		moved    bool
+	}
+
+	var tests = []Test{
+		{"far from edge", AbsXyz{17, 70, 8}, AbsXyz{17, 70, 8}, false, false},
+		{"near edge", AbsXyz{26, 70, 8}, AbsXyz{26, 70, 8}, true, false},
+		{"still near edge", AbsXyz{27, 70, 8}, AbsXyz{27, 70, 8}, false, false},
+		{"beyond edge", AbsXyz{31, 70, 8}, AbsXyz{28.5, 70, 8}, true, true},
+		{"away from edge", AbsXyz{20, 70, 8}, AbsXyz{20, 70, 8}, false, false},
+		{"towards other edge", AbsXyz{20, 70, 18}, AbsXyz{20, 70, 18}, false, false},
+		{"near edge again", AbsXyz{20, 70, 26}, AbsXyz{20, 70, 26}, true, false},
+	}
+
+	for _, test := range tests {
+		player.PacketPlayerPosition(&test.move, test.move.Y+StanceNormal, true)
+		player.serveChunks()
+
+		if player.position != test.expected {
+			t.Errorf("%s: expected player at %v, got %v", test.desc, test.expected, player.position)
+		}
+		var chat, moved bool
+		for _, packet := range player.sentPackets() {
+			chat = chat || isChatMessage(packet)
+			moved = moved || packet[0] == proto.PacketIdPlayerPosition
+		}
+		if chat != test.chat {
+			t.Errorf("%s: expected chat message sent=%t, got %t", test.desc, test.chat, chat)
+		}
+		if moved != test.moved {
+			t.Errorf("%s: expected position sent=%t, got %t", test.desc, test.moved, moved)
+		}
+	}
+
+	// Teleports outside the border are moved inside.
+	player.setPositionLook(AbsXyz{-500, 70, 8}, player.look)
+	if expected := (AbsXyz{-11.5, 70, 8}); player.position != expected {
+		t.Errorf("Expected teleport to %v, got %v", expected, player.position)
+	}
+}
@@ -0,0 +1,68 @@
+package player
+
+import (
+	"bytes"
+	"flag"
+
+	"chunkymonkey/logger"
+	"chunkymonkey/proto"
+	. "chunkymonkey/types"
+)
+
+var pvpEnabled = flag.Bool(
+	"pvp", true,
+	"Allow players to damage each other.")
+
+func (player *Player) PacketUseEntity(user EntityId, target EntityId, leftClick bool) {
+	player.lock.Lock()
+	defer player.lock.Unlock()
+
+	if user != player.EntityId {
+		logger.Entity.Warn("Ignoring use of entity by spoofed entity", "player", player.name, "target", target, "user", user)
+		return
+	}
+	if target == player.EntityId {
+		logger.Entity.Debug("Ignoring use of self", "player", player.name)
+		return
+	}
+	if !player.spawnComplete || player.health <= 0 {
+		return
+	}
+
+	// The chunk holding the target checks that it is within reach.
+	held, _ := player.inventory.HeldItem()
+	for _, chunkLoc := range chunksInReach(&player.position) {
+		if shardClient, ok := player.chunkSubs.ShardClientForChunkXz(&chunkLoc); ok {
+			shardClient.ReqUseEntity(chunkLoc, held, player.position, target, leftClick)
+		}
+	}
+}
+
+// chunksInReach returns the chunks that may hold entities within
+// MaxInteractDistance of position.
+func chunksInReach(position *AbsXyz) (locs []ChunkXz) {
+	min := AbsXyz{position.X - MaxInteractDistance, 0, position.Z - MaxInteractDistance}
+	max := AbsXyz{position.X + MaxInteractDistance, 0, position.Z + MaxInteractDistance}
+	minLoc, maxLoc := min.ToChunkXz(), max.ToChunkXz()
+
+	for x := minLoc.X; x <= maxLoc.X; x++ {
+		for z := minLoc.Z; z <= maxLoc.Z; z++ {
+			locs = append(locs, ChunkXz{x, z})
+		}
+	}
+	return
+}
+
+// attackedByPlayer damages the player and knocks them back, if PvP is
+// enabled.
+func (player *Player) attackedByPlayer(attacker EntityId, damage Health, knockback *AbsVelocity) {
+	if !*pvpEnabled || !player.spawnComplete || player.health <= 0 {
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	proto.WriteEntityVelocity(buf, player.EntityId, knockback.ToPacketVelocity())
+	player.TransmitPacket(buf.Bytes())
+
+	player.damage(damage)
+}
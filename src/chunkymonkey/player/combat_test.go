@@ -0,0 +1,88 @@
+package player
+
+import (
+	"testing"
+
+	. "chunkymonkey/types"
+)
+
+func TestChunksInReach(t *testing.T) {
+	type Test struct {
+		position AbsXyz
+		expected []ChunkXz
+	}
+
+	var tests = []Test{
+		{AbsXyz{8, 70, 8}, []ChunkXz{{0, 0}}},
+		{AbsXyz{2, 70, 8}, []ChunkXz{{-1, 0}, {0, 0}}},
+		{AbsXyz{14, 70, 2}, []ChunkXz{{0, -1}, {0, 0}, {1, -1}, {1, 0}}},
+		{AbsXyz{-8, 70, -14}, []ChunkXz{{-1, -2}, {-1, -1}}},
+	}
+
+	for _, test := range tests {
+		result := chunksInReach(&test.position)
+		if len(result) != len(test.expected) {
+			t.Errorf("chunksInReach(%v) expected %v got %v", test.position, test.expected, result)
+			continue
+		}
+		for i := range result {
+			if !result[i].Equals(test.expected[i]) {
+				t.Errorf("chunksInReach(%v) expected %v got %v", test.position, test.expected, result)
+				break
+			}
+		}
+	}
+}
+
+func TestPlayer_PacketUseEntity(t *testing.T) {
+	type Test struct {
+		desc     string
+		user     EntityId
+		target   EntityId
+		expected int
+	}
+
+	var tests = []Test{
+		{"attack", 1, 2, 1},
+		{"spoofed user", 2, 3, 0},
+		{"self", 1, 1, 0},
+	}
+
+	for _, test := range tests {
+		player := newTestPlayer(BlockXyz{8, 70, 8})
+		player.chunkSubs.Init(player)
+		player.serveChunks()
+		connecter := player.shardConnecter.(*fakeShardConnecter)
+
+		player.PacketUseEntity(test.user, test.target, true)
+		if len(connecter.entityUses) != test.expected {
+			t.Errorf("%s: expected %d chunk requests, got %d", test.desc, test.expected, len(connecter.entityUses))
+		}
+	}
+}
+
+func TestPlayer_AttackedByPlayer(t *testing.T) {
+	defer func(enabled bool) { *pvpEnabled = enabled }(*pvpEnabled)
+
+	type Test struct {
+		pvp      bool
+		expected Health
+	}
+
+	var tests = []Test{
+		{true, MaxHealth - 5},
+		{false, MaxHealth},
+	}
+
+	for _, test := range tests {
+		*pvpEnabled = test.pvp
+		player := newTestPlayer(BlockXyz{8, 70, 8})
+		player.chunkSubs.Init(player)
+		player.serveChunks()
+
+		player.attackedByPlayer(2, 5, &AbsVelocity{0.4, 0.4, 0})
+		if player.health != test.expected {
+			t.Errorf("pvp=%t: expected health %d, got %d", test.pvp, test.expected, player.health)
+		}
+	}
+}
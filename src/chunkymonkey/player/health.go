@@ -0,0 +1,185 @@
+package player
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"time"
+
+	"chunkymonkey/gamerules"
+	"chunkymonkey/logger"
+	"chunkymonkey/proto"
+	. "chunkymonkey/types"
+)
+
+const (
+	// SafeFallDistance is how far a player can fall without taking damage.
+	// Each block fallen beyond it does one point of damage.
+	SafeFallDistance = 3
+
+	// deathDropSpeed is the greatest horizontal speed at which a dead player's
+	// items are scattered, and deathDropLift their upward speed.
+	deathDropSpeed = 0.5
+	deathDropLift  = 0.2
+)
+
+// fallDamage returns the damage done by a fall of fallDistance.
+func fallDamage(fallDistance float32) Health {
+	damage := math.Ceil(float64(fallDistance - SafeFallDistance))
+	if damage < 0 {
+		return 0
+	}
+	return Health(damage)
+}
+
+// updateFall adds any drop from prevY to the player's current position to the
+// distance that they have fallen, and has the shard check their landing once
+// they are on the ground. Clients don't tell us when the player is swimming or
+// climbing, so any rise, which can only happen while off the ground that way,
+// ends the fall.
+func (player *Player) updateFall(prevY AbsCoord, onGround bool) {
+	if !player.spawnComplete || player.health <= 0 {
+		return
+	}
+
+	switch dy := prevY - player.position.Y; {
+	case dy > 0:
+		player.fallDistance += float32(dy)
+	case dy < 0:
+		player.fallDistance = 0
+	}
+	if !onGround {
+		return
+	}
+
+	fallDistance := player.fallDistance
+	player.fallDistance = 0
+	if fallDamage(fallDistance) <= 0 {
+		return
+	}
+	if shardClient, _, ok := player.chunkSubs.ShardClientForBlockXyz(player.position.ToBlockXyz()); ok {
+		shardClient.ReqLanded(player.position, fallDistance)
+	}
+}
+
+// fallen damages the player for a fall of fallDistance that nothing broke.
+func (player *Player) fallen(fallDistance float32) {
+	if player.health <= 0 {
+		return
+	}
+	if damage := fallDamage(fallDistance); damage > 0 {
+		player.damage(damage)
+	}
+}
+
+// damage reduces the player's health, and tells their client. Other players
+// are shown the player being hurt, and the player dies if they have no health
+// left.
+func (player *Player) damage(amount Health) {
+	if player.health <= 0 {
+		return
+	}
+	player.health -= amount
+	if player.health < 0 {
+		player.health = 0
+	}
+
+	buf := new(bytes.Buffer)
+	proto.WriteUpdateHealth(buf, player.health, player.food, 0)
+	player.TransmitPacket(buf.Bytes())
+
+	if player.health > 0 {
+		player.multicastStatus(EntityStatusHurt)
+	} else {
+		player.die()
+	}
+}
+
+// die drops everything that the player is carrying where they died, and shows
+// other players that they are dead. The client shows the player the respawn
+// screen, and sends PacketRespawn once they choose to respawn.
+func (player *Player) die() {
+	logger.Entity.Info("Player died", "player", player.name, "position", player.position)
+
+	player.fallDistance = 0
+	player.closeCurrentWindow(true)
+
+	items := player.inventory.TakeAllItems()
+	if !player.cursor.IsEmpty() {
+		items = append(items, player.cursor)
+		player.cursor = gamerules.Slot{}
+	}
+	player.updateEquipment()
+
+	if len(items) > 0 {
+		shardClient, _, ok := player.chunkSubs.ShardClientForBlockXyz(player.position.ToBlockXyz())
+		if ok {
+			for _, item := range items {
+				shardClient.ReqDropItem(item, player.position, deathDropVelocity(), TicksPerSecond/2)
+			}
+		} else {
+			logger.Entity.Warn("Dead player's items lost outside of the world", "player", player.name, "position", player.position, "count", len(items))
+		}
+	}
+
+	player.multicastStatus(EntityStatusDead)
+}
+
+// deathDropVelocity returns a random velocity that scatters a dead player's
+// items around them.
+func deathDropVelocity() AbsVelocity {
+	speed := rand.Float64() * deathDropSpeed
+	angle := rand.Float64() * 2 * math.Pi
+	return AbsVelocity{
+		AbsVelocityCoord(-math.Sin(angle) * speed),
+		deathDropLift,
+		AbsVelocityCoord(math.Cos(angle) * speed),
+	}
+}
+
+// multicastStatus shows the other players near the player a change in their
+// status.
+func (player *Player) multicastStatus(status EntityStatus) {
+	if shardClient, ok := player.chunkSubs.CurrentShardClient(); ok {
+		buf := new(bytes.Buffer)
+		proto.WriteEntityStatus(buf, player.EntityId, status)
+		shardClient.ReqMulticastPlayers(player.chunkSubs.curChunkLoc, player.EntityId, buf.Bytes())
+	}
+}
+
+// respawn restores a dead player to full health at their home bed, or else at
+// the world spawn, which may have moved since they logged in.
+func (player *Player) respawn() {
+	if player.health > 0 {
+		return
+	}
+	player.health = MaxHealth
+	player.fallDistance = 0
+	player.lastVoidDamage = time.Time{}
+
+	buf := new(bytes.Buffer)
+	proto.WriteRespawn(buf, DimensionNormal, GameDifficultyNormal, GameTypeSurvival, MaxYCoord+1, 0)
+	proto.WriteUpdateHealth(buf, player.health, player.food, 0)
+	player.TransmitPacket(buf.Bytes())
+
+	// The client forgets its chunks on respawning, so they must be sent again
+	// before the player is placed.
+	player.height = StanceNormal
+	player.spawnComplete = false
+	if !player.hasHomeBed {
+		player.spawnBlock = player.game.SpawnBlock()
+		player.position = *player.spawnBlock.ToAbsXyz()
+		player.chunkSubs.Respawn(&player.position)
+		player.checkSpawnPosition()
+		return
+	}
+
+	// The shard must also check the bed and find somewhere to stand beside it
+	// before the player is placed there.
+	player.position = *player.homeBed.ToAbsXyz()
+	player.placePending = true
+	player.chunkSubs.Respawn(&player.position)
+	if shardClient, ok := player.chunkSubs.CurrentShardClient(); ok {
+		shardClient.ReqBedSpawn(player.homeBed)
+	}
+}
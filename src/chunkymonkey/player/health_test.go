@@ -0,0 +1,136 @@
+package player
+
+import (
+	"testing"
+
+	"chunkymonkey/gamerules"
+	. "chunkymonkey/types"
+)
+
+func init() {
+	// The data files are at the root of the repository.
+	err := gamerules.LoadGameRules(
+		"../../../blocks.json", "../../../items.json", "../../../recipes.json",
+		"../../../furnace.json", "../../../users.json", "../../../groups.json")
+	if err != nil {
+		panic(err)
+	}
+}
+
+// countPackets returns how many of the packets have the ID.
+func countPackets(packets [][]byte, id byte) (count int) {
+	for _, packet := range packets {
+		if packet[0] == id {
+			count++
+		}
+	}
+	return
+}
+
+func TestFallDamage(t *testing.T) {
+	type Test struct {
+		fallDistance float32
+		expected     Health
+	}
+
+	var tests = []Test{
+		{0, 0},
+		{SafeFallDistance, 0},
+		{SafeFallDistance + 0.1, 1},
+		{SafeFallDistance + 1, 1},
+		{SafeFallDistance + 10.5, 11},
+	}
+
+	for _, test := range tests {
+		if result := fallDamage(test.fallDistance); result != test.expected {
+			t.Errorf("fallDamage(%v) expected %d got %d", test.fallDistance, test.expected, result)
+		}
+	}
+}
+
+func TestPlayer_UpdateFall(t *testing.T) {
+	type Test struct {
+		desc     string
+		heights  []AbsCoord // Heights moved to, off the ground, before landing.
+		landing  AbsCoord
+		expected []float32 // Landings reported to the shard.
+	}
+
+	var tests = []Test{
+		{"short fall", []AbsCoord{69, 68}, 67.5, nil},
+		{"long fall", []AbsCoord{68, 66}, 64, []float32{6}},
+		{"jump", []AbsCoord{71, 70.5}, 70, nil},
+		{"swim up", []AbsCoord{60, 55, 58}, 59, nil},
+	}
+
+	for _, test := range tests {
+		player := newTestPlayer(BlockXyz{8, 70, 8})
+		player.chunkSubs.Init(player)
+		player.serveChunks()
+		connecter := player.shardConnecter.(*fakeShardConnecter)
+
+		for _, y := range test.heights {
+			prevY := player.position.Y
+			player.position.Y = y
+			player.updateFall(prevY, false)
+		}
+		prevY := player.position.Y
+		player.position.Y = test.landing
+		player.updateFall(prevY, true)
+
+		if len(connecter.landings) != len(test.expected) {
+			t.Errorf("%s: expected landings %v, got %v", test.desc, test.expected, connecter.landings)
+			continue
+		}
+		for i := range test.expected {
+			// The player is placed slightly above the spawn block.
+			if diff := connecter.landings[i] - test.expected[i]; diff < 0 || diff > 0.1 {
+				t.Errorf("%s: expected landings %v, got %v", test.desc, test.expected, connecter.landings)
+			}
+		}
+		if player.fallDistance != 0 {
+			t.Errorf("%s: expected fall distance reset on landing, got %v", test.desc, player.fallDistance)
+		}
+	}
+}
+
+func TestPlayer_Die(t *testing.T) {
+	player := newTestPlayer(BlockXyz{8, 70, 8})
+	player.chunkSubs.Init(player)
+	player.serveChunks()
+	connecter := player.shardConnecter.(*fakeShardConnecter)
+
+	player.inventory.AddStack(&gamerules.Slot{ItemTypeId: 1, Count: 10})
+	player.inventory.AddStack(&gamerules.Slot{ItemTypeId: 4, Count: 64})
+	player.cursor = gamerules.Slot{ItemTypeId: 3, Count: 5}
+
+	player.fallen(SafeFallDistance + float32(MaxHealth-1))
+	if player.health != 1 {
+		t.Fatalf("Expected health 1 after fall, got %d", player.health)
+	}
+	if len(connecter.drops) != 0 {
+		t.Fatalf("Expected nothing dropped by a living player, got %v", connecter.drops)
+	}
+
+	player.damage(5)
+	if player.health != 0 {
+		t.Fatalf("Expected player to be dead, health %d", player.health)
+	}
+	if len(connecter.drops) != 3 {
+		t.Fatalf("Expected 3 item stacks dropped, got %v", connecter.drops)
+	}
+	if held, _ := player.inventory.HeldItem(); !held.IsEmpty() || !player.cursor.IsEmpty() {
+		t.Errorf("Expected empty inventory after death, holding %v, cursor %v", held, player.cursor)
+	}
+
+	// Dead players take no more damage.
+	player.fallen(SafeFallDistance + 5)
+	if player.health != 0 || len(connecter.drops) != 3 {
+		t.Errorf("Expected no change to a dead player, health %d, drops %v", player.health, connecter.drops)
+	}
+
+	player.respawn()
+	if player.health != MaxHealth {
+		t.Errorf("Expected full health after respawn, got %d", player.health)
+	}
+}
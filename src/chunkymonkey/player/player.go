@@ -6,13 +6,17 @@ import (
 	"expvar"
 	"flag"
 	"fmt"
-	"log"
 	"math/rand"
 	"net"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"chunkymonkey/chat"
+	"chunkymonkey/clock"
 	"chunkymonkey/gamerules"
+	"chunkymonkey/logger"
 	"chunkymonkey/nbtutil"
 	"chunkymonkey/physics"
 	"chunkymonkey/proto"
@@ -24,12 +28,22 @@ import (
 var (
 	expVarPlayerConnectionCount    *expvar.Int
 	expVarPlayerDisconnectionCount *expvar.Int
+	expVarPlayerTxQueue            *expvar.Map
 	errUnknownItemID               error
 
 	playerPingNoCheck = flag.Bool(
 		"player_ping_no_check", false,
 		"Relax checks on player keep-alive packets. This can be useful for "+
 			"recorded/replayed sessions.")
+
+	keepAliveInterval = flag.Duration(
+		"keepalive_interval", 20*time.Second,
+		"Time between a player answering a keep-alive and being sent the next.")
+
+	connectionTimeout = flag.Duration(
+		"connection_timeout", 60*time.Second,
+		"Time without receiving anything from a player, while a keep-alive is "+
+			"unanswered, before they are disconnected.")
 )
 
 const (
@@ -37,13 +51,30 @@ const (
 	MaxHealth    = Health(20)
 	MaxFoodUnits = FoodUnits(20)
 
-	PingTimeoutNs  = 1e9 * 60 // Player connection times out after 60 seconds.
-	PingIntervalNs = 1e9 * 20 // Time between receiving keep alive response from client and sending new request.
+	// pingSmoothing is the weight given to each new roundtrip sample in the
+	// player's smoothed latency, so that one slow response doesn't swing it.
+	pingSmoothing = 0.25
+
+	// kickCloseDelay is how long a kicked player's client has to receive the
+	// reason before the connection is closed.
+	kickCloseDelay = time.Second
+
+	// slowConnectionKickMsg is sent to players disconnected because their
+	// outbound packet queue stalled or filled up.
+	slowConnectionKickMsg = "Your connection is too slow"
 )
 
+// playerTxQueueVar is published for each player in the "player-tx-queue"
+// expvar.
+type playerTxQueueVar struct {
+	Name string
+	TxQueueStats
+}
+
 func init() {
 	expVarPlayerConnectionCount = expvar.NewInt("player-connection-count")
 	expVarPlayerDisconnectionCount = expvar.NewInt("player-disconnection-count")
+	expVarPlayerTxQueue = expvar.NewMap("player-tx-queue")
 	errUnknownItemID = errors.New("Unknown item ID")
 }
 
@@ -57,8 +88,10 @@ type Player struct {
 	name           string
 	loginComplete  bool
 	spawnComplete  bool
+	placePending   bool // Waiting for the shard to find where the player can stand.
 
-	game gamerules.IGame
+	game  gamerules.IGame
+	clock clock.Clock
 
 	// ping is used to determine the player's current roundtrip latency, and to
 	// determine if the player should be disconnected for not responding.
@@ -66,25 +99,34 @@ type Player struct {
 		running     bool
 		id          int32       // Last ID sent in keep-alive, or 0 if no current ping.
 		timestampNs int64       // Nanoseconds since epoch since last keep-alive sent.
-		timer       *time.Timer // Time until next ping, or timeout of current.
+		timer       clock.Timer // Time until next ping, or timeout of current.
+		latencyMs   int32       // Smoothed roundtrip latency. Use atomically.
+		measured    bool        // Whether latencyMs holds a measurement yet.
 	}
+	lastReceivedNs int64 // When a packet was last received. Use atomically.
 
 	// TODO remove this lock, packet handling shouldn't use a lock, it should use
 	// a channel instead (ideally).
 	lock sync.Mutex
 
-	onDisconnect chan<- EntityId
-	mainQueue    chan func(*Player)
-	txQueue      chan []byte
-	txErrChan    chan error
-	rxErrChan    chan error
-	rxRunning    bool // Only used by the receiveLoop.
-	stopPlayer   chan bool
+	onDisconnect   chan<- EntityId
+	disconnected   chan struct{} // Closed once the player has disconnected.
+	disconnectOnce sync.Once
+	mainQueue      chan func(*Player)
+	txQueue        txQueue
+	txErrChan      chan error
+	rxErrChan      chan error
+	rxRunning      bool // Only used by the receiveLoop.
+	stopPlayer     chan bool
+	kickPlayer     chan string
+	kickReason     string // Only used by the mainLoop.
 
 	// The following attributes are game-logic related.
 
 	// Data entries that may change
-	spawnBlock BlockXyz
+	spawnBlock BlockXyz // World spawn.
+	homeBed    BlockXyz // Bed to respawn at, if hasHomeBed.
+	hasHomeBed bool
 	position   AbsXyz
 	height     AbsCoord
 	look       LookDegrees
@@ -92,40 +134,44 @@ type Player struct {
 	health     Health
 	food       FoodUnits
 
-	// The following data fields are loaded, but not used yet
-	dimension    int32
-	onGround     int8
-	sleeping     int8
+	// fallDistance is how far the player has fallen since they were last on
+	// the ground.
 	fallDistance float32
-	sleepTimer   int16
-	attackTime   int16
-	deathTime    int16
-	hurtTime     int16
-	motion       AbsVelocity
-	air          int16
-	fire         int16
+
+	lastVoidDamage time.Time
+	borderWarned   bool // Near the world border, and told so.
+	selection      selection
+
+	// The following data fields are loaded, but not used yet
+	dimension  int32
+	onGround   int8
+	sleeping   int8
+	sleepTimer int16
+	attackTime int16
+	deathTime  int16
+	hurtTime   int16
+	motion     AbsVelocity
+	air        int16
+	fire       int16
 
 	cursor       gamerules.Slot // Item being moved by mouse cursor.
 	inventory    window.PlayerInventory
+	equipment    gamerules.PlayerEquipment // As last shown to other players.
 	curWindow    window.IWindow
 	nextWindowId WindowId
 	remoteInv    *RemoteInventory
 }
 
-func NewPlayer(entityId EntityId, shardConnecter gamerules.IShardConnecter, conn net.Conn, name string, spawnBlock BlockXyz, onDisconnect chan<- EntityId, game gamerules.IGame) *Player {
+func NewPlayer(entityId EntityId, shardConnecter gamerules.IShardConnecter, conn net.Conn, name string, spawnBlock BlockXyz, onDisconnect chan<- EntityId, game gamerules.IGame, clk clock.Clock) *Player {
 	player := &Player{
 		EntityId:       entityId,
 		shardConnecter: shardConnecter,
 		conn:           conn,
 		name:           name,
 		spawnBlock:     spawnBlock,
-		position: AbsXyz{
-			X: AbsCoord(spawnBlock.X),
-			Y: AbsCoord(spawnBlock.Y),
-			Z: AbsCoord(spawnBlock.Z),
-		},
-		height: StanceNormal,
-		look:   LookDegrees{0, 0},
+		position:       *spawnBlock.ToAbsXyz(),
+		height:         StanceNormal,
+		look:           LookDegrees{0, 0},
 
 		health: MaxHealth,
 		food:   MaxFoodUnits, // TODO: Check what initial level should be.
@@ -133,17 +179,21 @@ func NewPlayer(entityId EntityId, shardConnecter gamerules.IShardConnecter, conn
 		curWindow:    nil,
 		nextWindowId: WindowIdFreeMin,
 
-		mainQueue:  make(chan func(*Player), 128),
-		txQueue:    make(chan []byte, 128),
-		txErrChan:  make(chan error, 1),
-		rxErrChan:  make(chan error, 1),
-		stopPlayer: make(chan bool, 1),
+		mainQueue:    make(chan func(*Player), 128),
+		disconnected: make(chan struct{}),
+		txErrChan:    make(chan error, 1),
+		rxErrChan:    make(chan error, 1),
+		stopPlayer:   make(chan bool, 1),
+		kickPlayer:   make(chan string, 1),
 
-		game: game,
+		game:  game,
+		clock: clk,
 
 		onDisconnect: onDisconnect,
 	}
 
+	player.lastReceivedNs = clk.Now().UnixNano()
+	player.txQueue.Init(clk)
 	player.playerClient.Init(player)
 	player.inventory.Init(player.EntityId, player)
 
@@ -166,6 +216,22 @@ func (player *Player) SetPosition(pos AbsXyz) {
 	player.position = pos
 }
 
+// PositionSnapshot returns the player's position from outside of the player's
+// goroutines, waiting for the player lock. It must not be called with the
+// player lock held, or from the game's main loop, which players wait on.
+func (player *Player) PositionSnapshot() AbsXyz {
+	player.lock.Lock()
+	defer player.lock.Unlock()
+	return player.position
+}
+
+// Ping returns the player's smoothed roundtrip latency in milliseconds, as
+// shown in the player list. It is safe and cheap to call from other
+// goroutines.
+func (player *Player) Ping() int16 {
+	return int16(atomic.LoadInt32(&player.ping.latencyMs))
+}
+
 func (player *Player) Client() gamerules.IPlayerClient {
 	return &player.playerClient
 }
@@ -191,10 +257,19 @@ func (player *Player) UnmarshalNbt(tag *nbt.Compound) (err error) {
 	}
 	player.health = Health(health)
 
-	if err = player.inventory.UnmarshalNbt(tag.Lookup("Inventory")); err != nil {
+	inventory, err := nbt.LookupType(tag, "Inventory", nbt.TagList)
+	if err != nil {
+		return
+	}
+	if err = player.inventory.UnmarshalNbt(inventory); err != nil {
 		return
 	}
 
+	// Older player data doesn't record the held slot.
+	if held, ok := nbt.GetInt(tag, "SelectedItemSlot"); ok {
+		player.inventory.SetHolding(SlotId(held))
+	}
+
 	if player.onGround, err = nbtutil.ReadByte(tag, "OnGround"); err != nil {
 		return
 	}
@@ -239,6 +314,22 @@ func (player *Player) UnmarshalNbt(tag *nbt.Compound) (err error) {
 		return
 	}
 
+	// The home bed is only present once the player has used a bed.
+	if _, ok := tag.Lookup("SpawnX").(*nbt.Int); ok {
+		var x, y, z int32
+		if x, err = nbtutil.ReadInt(tag, "SpawnX"); err != nil {
+			return
+		}
+		if y, err = nbtutil.ReadInt(tag, "SpawnY"); err != nil {
+			return
+		}
+		if z, err = nbtutil.ReadInt(tag, "SpawnZ"); err != nil {
+			return
+		}
+		player.homeBed = BlockXyz{BlockCoord(x), BlockYCoord(y), BlockCoord(z)}
+		player.hasHomeBed = true
+	}
+
 	return nil
 }
 
@@ -249,42 +340,85 @@ func (player *Player) MarshalNbt(tag *nbt.Compound) (err error) {
 		return
 	}
 
-	tag.Set("OnGround", &nbt.Byte{player.onGround})
-	tag.Set("Dimension", &nbt.Int{player.dimension})
-	tag.Set("Sleeping", &nbt.Byte{player.sleeping})
-	tag.Set("FallDistance", &nbt.Float{player.fallDistance})
-	tag.Set("SleepTimer", &nbt.Short{player.sleepTimer})
-	tag.Set("AttackTime", &nbt.Short{player.attackTime})
-	tag.Set("DeathTime", &nbt.Short{player.deathTime})
-	tag.Set("Motion", &nbt.List{nbt.TagDouble, []nbt.ITag{
-		&nbt.Double{float64(player.motion.X)},
-		&nbt.Double{float64(player.motion.Y)},
-		&nbt.Double{float64(player.motion.Z)},
-	}})
-	tag.Set("HurtTime", &nbt.Short{player.hurtTime})
-	tag.Set("Air", &nbt.Short{player.air})
-	tag.Set("Rotation", &nbt.List{nbt.TagFloat, []nbt.ITag{
-		&nbt.Float{float32(player.look.Yaw)},
-		&nbt.Float{float32(player.look.Pitch)},
-	}})
-	tag.Set("Pos", &nbt.List{nbt.TagDouble, []nbt.ITag{
-		&nbt.Double{float64(player.position.X)},
-		&nbt.Double{float64(player.position.Y)},
-		&nbt.Double{float64(player.position.Z)},
-	}})
-	tag.Set("Fire", &nbt.Short{player.fire})
-	tag.Set("Health", &nbt.Short{int16(player.health)})
+	if player.hasHomeBed {
+		err = nbt.BuildInto(tag).
+			PutInt("SpawnX", int32(player.homeBed.X)).
+			PutInt("SpawnY", int32(player.homeBed.Y)).
+			PutInt("SpawnZ", int32(player.homeBed.Z)).
+			Err()
+		if err != nil {
+			return
+		}
+	}
+
+	_, held := player.inventory.HeldItem()
+
+	return nbt.BuildInto(tag).
+		PutInt("SelectedItemSlot", int32(held)).
+		PutByte("OnGround", player.onGround).
+		PutInt("Dimension", player.dimension).
+		PutByte("Sleeping", player.sleeping).
+		PutFloat("FallDistance", player.fallDistance).
+		PutShort("SleepTimer", player.sleepTimer).
+		PutShort("AttackTime", player.attackTime).
+		PutShort("DeathTime", player.deathTime).
+		PutDoubleList("Motion",
+			float64(player.motion.X),
+			float64(player.motion.Y),
+			float64(player.motion.Z)).
+		PutShort("HurtTime", player.hurtTime).
+		PutShort("Air", player.air).
+		PutFloatList("Rotation",
+			float32(player.look.Yaw),
+			float32(player.look.Pitch)).
+		PutDoubleList("Pos",
+			float64(player.position.X),
+			float64(player.position.Y),
+			float64(player.position.Z)).
+		PutShort("Fire", player.fire).
+		PutShort("Health", int16(player.health)).
+		Err()
+}
+
+// SaveSnapshot marshals the player data from outside of the player's
+// goroutines, waiting for the player lock, and passes it to save. The lock is
+// held until save returns, so that the data is saved before any later data of
+// the player. It must not be called with the player lock held, or from the
+// game's main loop, which players wait on.
+func (player *Player) SaveSnapshot(save func(data *nbt.Compound)) (err error) {
+	player.lock.Lock()
+	defer player.lock.Unlock()
 
+	data := nbt.NewCompound()
+	if err = player.MarshalNbt(data); err != nil {
+		return
+	}
+	save(data)
 	return nil
 }
 
-func (player *Player) getHeldItemTypeId() ItemTypeId {
-	heldSlot, _ := player.inventory.HeldItem()
-	heldItemId := heldSlot.ItemTypeId
-	if heldItemId < 0 {
-		return 0
+// currentEquipment returns the player's equipment, and records it as shown to
+// other players.
+func (player *Player) currentEquipment() gamerules.PlayerEquipment {
+	player.equipment = player.inventory.Equipment()
+	return player.equipment
+}
+
+// updateEquipment shows other players any changes to the held item or armor
+// since they were last shown.
+func (player *Player) updateEquipment() {
+	shardClient, ok := player.chunkSubs.CurrentShardClient()
+	if !ok {
+		return
 	}
-	return heldItemId
+
+	equipment := player.inventory.Equipment()
+	for i := range equipment {
+		if !equipment[i].Equals(&player.equipment[i]) {
+			shardClient.ReqSetPlayerEquipment(player.chunkSubs.curChunkLoc, SlotId(i), equipment[i])
+		}
+	}
+	player.equipment = equipment
 }
 
 func (player *Player) Run() {
@@ -312,12 +446,25 @@ func (player *Player) Stop() {
 	}
 }
 
+// Kick disconnects the player, telling their client the reason.
+func (player *Player) Kick(reason string) {
+	select {
+	case player.kickPlayer <- reason:
+	default:
+	}
+}
+
 // Start of packet handling code
 // Note: any packet handlers that could change the player state or read a
 // changeable state must use player.lock
 
 func (player *Player) PacketKeepAlive(id int32) {
-	player.pingReceived(id)
+	// The ping state belongs to the main loop, but the response is timed on
+	// arrival so that waiting in the queue doesn't count as latency.
+	receivedNs := player.clock.Now().UnixNano()
+	player.Enqueue(func(player *Player) {
+		player.pingReceived(id, receivedNs)
+	})
 }
 
 func (player *Player) PacketServerLogin(username string) {
@@ -337,20 +484,25 @@ func (player *Player) PacketChatMessage(message string) {
 		// to fetch it as the first part of every command.
 		gamerules.CommandFramework.Process(&player.playerClient, message, player.game)
 	} else {
-		player.sendChatMessage(fmt.Sprintf("<%s> %s", player.name, message), true)
+		player.sendChat(chat.Player, message, true)
 	}
 }
 
 func (player *Player) PacketEntityAction(entityId EntityId, action EntityAction) {
 }
 
-func (player *Player) PacketUseEntity(user EntityId, target EntityId, leftClick bool) {
-}
-
 func (player *Player) PacketRespawn(dimension DimensionId, unknown int8, gameType GameType, worldHeight int16, mapSeed RandomSeed) {
+	player.lock.Lock()
+	defer player.lock.Unlock()
+
+	player.respawn()
 }
 
 func (player *Player) PacketPlayer(onGround bool) {
+	player.lock.Lock()
+	defer player.lock.Unlock()
+
+	player.updateFall(player.position.Y, onGround)
 }
 
 func (player *Player) PacketPlayerPosition(position *AbsXyz, stance AbsCoord, onGround bool) {
@@ -363,14 +515,20 @@ func (player *Player) PacketPlayerPosition(position *AbsXyz, stance AbsCoord, on
 		return
 	}
 
-	if !player.position.IsWithinDistanceOf(position, 10) {
-		log.Printf("Discarding player position that is too far removed (%.2f, %.2f, %.2f)",
-			position.X, position.Y, position.Z)
+	if !player.position.WithinSphere(position, 10) {
+		logger.Entity.Warn("Discarding player position that is too far removed", "player", player.name, "position", *position)
+		return
+	}
+	if player.keepWithinBorder(position) {
 		return
 	}
+	prevY := player.position.Y
 	player.position = *position
 	player.height = stance - position.Y
 	player.chunkSubs.Move(position)
+	player.updateFall(prevY, onGround)
+	player.checkVoid(player.clock.Now())
+	player.warnNearBorder()
 
 	// TODO: Should keep track of when players enter/leave their mutual radius
 	// of "awareness". I.e a client should receive a RemoveEntity packet when
@@ -383,12 +541,13 @@ func (player *Player) PacketPlayerLook(look *LookDegrees, onGround bool) {
 	player.lock.Lock()
 	defer player.lock.Unlock()
 
-	// TODO input validation
 	player.look = *look
+	player.look.Normalize()
+	player.updateFall(player.position.Y, onGround)
 
 	// Update playerData on current chunk.
 	if shard, ok := player.chunkSubs.CurrentShardClient(); ok {
-		shard.ReqSetPlayerLook(player.chunkSubs.curChunkLoc, *look.ToLookBytes())
+		shard.ReqSetPlayerLook(player.chunkSubs.curChunkLoc, *player.look.ToLookBytes())
 	}
 }
 
@@ -412,14 +571,37 @@ func (player *Player) PacketPlayerBlockHit(status DigStatus, target *BlockXyz, f
 			position := player.position
 			position.Y += player.height
 			shardClient.ReqDropItem(itemToThrow, position, velocity, TicksPerSecond/2)
+			player.updateEquipment()
 		}
 		return
 	}
 
+	if !face.Valid() {
+		logger.Entity.Debug("Ignoring player dig: invalid face", "player", player.name, "block", target, "face", face)
+		return
+	}
+
 	// Validate that the player is actually somewhere near the block.
 	targetAbsPos := target.MidPointToAbsXyz()
-	if !targetAbsPos.IsWithinDistanceOf(&player.position, MaxInteractDistance) {
-		log.Printf("Player/PacketPlayerBlockHit: ignoring player dig at %v (too far away)", target)
+	if !targetAbsPos.WithinSphere(&player.position, MaxInteractDistance) {
+		logger.Entity.Debug("Ignoring player dig: too far away", "player", player.name, "block", target)
+		return
+	}
+
+	// Digging with the wand selects the first corner of a region rather than
+	// digging the block.
+	if player.holdingWand() {
+		if status == DigStarted {
+			player.selectCorner(0, *target)
+		}
+		return
+	}
+
+	if player.spawnProtected(target) {
+		// The client only removes the block once it has been dug.
+		if status == DigBlockBroke {
+			player.refuseBlockChange(target)
+		}
 		return
 	}
 
@@ -434,9 +616,9 @@ func (player *Player) PacketPlayerBlockHit(status DigStatus, target *BlockXyz, f
 }
 
 func (player *Player) PacketPlayerBlockInteract(itemId ItemTypeId, target *BlockXyz, face Face, amount ItemCount, uses ItemData) {
-	if face < FaceMinValid || face > FaceMaxValid {
+	if !face.Valid() {
 		// TODO sometimes FaceNull means something. This case should be covered.
-		log.Printf("Player/PacketPlayerBlockInteract: invalid face %d", face)
+		logger.Entity.Debug("Ignoring player interact: invalid face", "player", player.name, "face", face)
 		return
 	}
 
@@ -445,8 +627,13 @@ func (player *Player) PacketPlayerBlockInteract(itemId ItemTypeId, target *Block
 
 	// Validate that the player is actually somewhere near the block.
 	targetAbsPos := target.MidPointToAbsXyz()
-	if !targetAbsPos.IsWithinDistanceOf(&player.position, MaxInteractDistance) {
-		log.Printf("Player/PacketPlayerBlockInteract: ignoring player interact at %v (too far away)", target)
+	if !targetAbsPos.WithinSphere(&player.position, MaxInteractDistance) {
+		logger.Entity.Debug("Ignoring player interact: too far away", "player", player.name, "block", target)
+		return
+	}
+
+	if player.holdingWand() {
+		player.selectCorner(1, *target)
 		return
 	}
 
@@ -460,7 +647,11 @@ func (player *Player) PacketPlayerBlockInteract(itemId ItemTypeId, target *Block
 func (player *Player) PacketHoldingChange(slotId SlotId) {
 	player.lock.Lock()
 	defer player.lock.Unlock()
-	player.inventory.SetHolding(slotId)
+	if !player.inventory.SetHolding(slotId) {
+		logger.Entity.Debug("Ignoring holding change: slot out of range", "player", player.name, "slot", slotId)
+		return
+	}
+	player.updateEquipment()
 }
 
 func (player *Player) PacketEntityAnimation(entityId EntityId, animation EntityAnimation) {
@@ -477,13 +668,10 @@ func (player *Player) PacketWindowClick(windowId WindowId, slotId SlotId, rightC
 	player.lock.Lock()
 	defer player.lock.Unlock()
 
-	// Note that the expectedSlot parameter is currently ignored. The item(s)
-	// involved are worked out from the server-side data.
-	// TODO use the expectedSlot as a conditions for the click, and base the
-	// transaction result on that.
+	// The inventories refuse the click if the expected slot contents differ
+	// from their own, as the client's view of the window is then wrong.
 
 	// Determine which inventory window is involved.
-	// TODO support for more windows
 
 	var clickedWindow window.IWindow
 	if windowId == WindowIdInventory {
@@ -491,19 +679,9 @@ func (player *Player) PacketWindowClick(windowId WindowId, slotId SlotId, rightC
 	} else if player.curWindow != nil && player.curWindow.WindowId() == windowId {
 		clickedWindow = player.curWindow
 	} else {
-		log.Printf(
-			"Warning: ignored window click on unknown window ID %d",
-			windowId)
+		logger.Entity.Warn("Ignored window click on unknown window", "player", player.name, "window", windowId)
 	}
 
-	expectedSlotContent := &gamerules.Slot{
-		ItemTypeId: expectedSlot.ItemTypeId,
-		Count:      expectedSlot.Count,
-		Data:       expectedSlot.Data,
-	}
-	// The client tends to send item IDs even when the count is zero.
-	expectedSlotContent.Normalize()
-
 	txState := TxStateRejected
 
 	click := gamerules.Click{
@@ -514,6 +692,8 @@ func (player *Player) PacketWindowClick(windowId WindowId, slotId SlotId, rightC
 		TxId:       txId,
 	}
 	click.ExpectedSlot.SetWindowSlot(expectedSlot)
+	// The client tends to send item IDs even when the count is zero.
+	click.ExpectedSlot.Normalize()
 
 	if clickedWindow != nil {
 		txState = clickedWindow.Click(&click)
@@ -524,23 +704,38 @@ func (player *Player) PacketWindowClick(windowId WindowId, slotId SlotId, rightC
 		// Inform client of operation status.
 		buf := new(bytes.Buffer)
 		proto.WriteWindowTransaction(buf, windowId, txId, txState == TxStateAccepted)
+		if txState == TxStateRejected && clickedWindow != nil {
+			// Put the client's view of the window right.
+			clickedWindow.WriteWindowItems(buf)
+		}
 		player.cursor = click.Cursor
 		player.cursor.SendUpdate(buf, WindowIdCursor, SlotIdCursor)
 		player.TransmitPacket(buf.Bytes())
 	case TxStateDeferred:
 		// The remote inventory should send the transaction outcome.
 	}
+
+	player.updateEquipment()
 }
 
 func (player *Player) PacketWindowTransaction(windowId WindowId, txId TxId, accepted bool) {
 	// TODO investigate when this packet is sent from the client and what it
 	// means when it does get sent.
-	log.Printf(
-		"Got PacketWindowTransaction from player %q: windowId=%d txId=%d accepted=%t",
-		player.name, windowId, txId, accepted)
+	logger.Entity.Debug("Got PacketWindowTransaction", "player", player.name, "window", windowId, "tx", txId, "accepted", accepted)
 }
 
 func (player *Player) PacketSignUpdate(position *BlockXyz, lines [4]string) {
+	player.lock.Lock()
+	defer player.lock.Unlock()
+
+	shardClient, _, ok := player.chunkSubs.ShardClientForBlockXyz(position)
+	if ok {
+		shardClient.ReqSetSignText(*position, lines)
+	}
+}
+
+func (player *Player) PacketEncryptionKeyResponse(sharedSecret, verifyToken []byte) {
+	// Shouldn't receive this packet once logged in.
 }
 
 func (player *Player) PacketServerListPing() {
@@ -548,9 +743,9 @@ func (player *Player) PacketServerListPing() {
 }
 
 func (player *Player) PacketDisconnect(reason string) {
-	log.Printf("Player %s disconnected reason=%s", player.name, reason)
+	logger.Net.Info("Player disconnected", "player", player.name, "reason", reason)
 
-	player.sendChatMessage(fmt.Sprintf("%s has left", player.name), false)
+	player.sendChat(chat.Reply, player.name+" has left", false)
 
 	player.Stop()
 }
@@ -560,9 +755,13 @@ func (player *Player) receiveLoop() {
 	for player.rxRunning {
 		err := proto.ServerReadPacket(player.conn, player)
 		if err != nil {
+			// Closing the connection stops the transmitLoop too, if it's
+			// blocked writing to a dead connection.
+			player.conn.Close()
 			player.rxErrChan <- err
 			return
 		}
+		atomic.StoreInt64(&player.lastReceivedNs, player.clock.Now().UnixNano())
 	}
 }
 
@@ -570,25 +769,39 @@ func (player *Player) receiveLoop() {
 
 func (player *Player) transmitLoop() {
 	for {
-		bs := <-player.txQueue
+		bs, ok := player.txQueue.pop()
 
-		if bs == nil {
+		if !ok {
 			player.txErrChan <- nil
 			return // txQueue closed
 		}
 		_, err := player.conn.Write(bs)
 		if err != nil {
+			// Closing the connection stops the receiveLoop too.
+			player.conn.Close()
 			player.txErrChan <- err
 			return
 		}
 	}
 }
 
+// TransmitPacket queues the packet for sending to the player. The packet slice
+// is queued as-is rather than copied, and may be shared with other players
+// (e.g chunk data packets), so it must not be modified afterwards. It does not
+// block; low priority packets may be dropped if the player is lagging.
 func (player *Player) TransmitPacket(packet []byte) {
-	if packet == nil {
+	if len(packet) == 0 {
 		return // skip empty packets
 	}
-	player.txQueue <- packet
+	if !player.txQueue.push(packet) {
+		logger.Net.Warn("Outbound queue stalled or full, disconnecting", "player", player.name)
+		player.Kick(slowConnectionKickMsg)
+	}
+}
+
+// TxQueueStats returns statistics about the player's outbound packet queue.
+func (player *Player) TxQueueStats() TxQueueStats {
+	return player.txQueue.Stats()
 }
 
 func (player *Player) runQueuedCall(f func(*Player)) {
@@ -600,7 +813,7 @@ func (player *Player) runQueuedCall(f func(*Player)) {
 // pingNew starts a new "keep-alive" ping.
 func (player *Player) pingNew() {
 	if player.ping.running {
-		log.Printf("%v: Attempted to start a ping while another is running.", player)
+		logger.Net.Warn("Attempted to start a ping while another is running", "player", player.name)
 	} else {
 		if player.ping.timer != nil {
 			player.ping.timer.Stop()
@@ -613,20 +826,28 @@ func (player *Player) pingNew() {
 			// avoid misreading keep alive IDs.
 			player.ping.id = 1
 		}
-		player.ping.timestampNs = time.Now().Unix()
+		player.ping.timestampNs = player.clock.Now().UnixNano()
 
 		buf := new(bytes.Buffer)
 		proto.WriteKeepAlive(buf, player.ping.id)
 		player.TransmitPacket(buf.Bytes())
 
-		player.ping.timer = time.NewTimer(PingTimeoutNs)
+		player.ping.timer = player.clock.NewTimer(*connectionTimeout)
 	}
 }
 
-// pingTimeout handles pinging the client, or timing out the connection.
+// pingTimeout handles pinging the client, or timing out the connection. The
+// connection times out once nothing at all has been received from the client
+// for the -connection_timeout, so that a slow keep-alive response from a
+// client that is otherwise busy sending doesn't disconnect it.
 func (player *Player) pingTimeout() {
 	if player.ping.running {
-		// Current ping timed out. Disconnect the player.
+		idle := time.Duration(player.clock.Now().UnixNano() - atomic.LoadInt64(&player.lastReceivedNs))
+		if idle < *connectionTimeout {
+			player.ping.timer = player.clock.NewTimer(*connectionTimeout - idle)
+			return
+		}
+		logger.Net.Info("Connection timed out", "player", player.name, "idle", idle)
 		player.Stop()
 	} else {
 		// No ping in progress. Send a new one.
@@ -634,8 +855,11 @@ func (player *Player) pingTimeout() {
 	}
 }
 
-// pingReceived is called when a keep alive packet is received.
-func (player *Player) pingReceived(id int32) {
+// pingReceived is called when a keep alive packet is received at receivedNs.
+// Responses that don't match the running ping are ignored, so that buggy or
+// malicious clients can't corrupt the latency estimate. Clients that never
+// respond properly are still disconnected by the ping timeout.
+func (player *Player) pingReceived(id int32, receivedNs int64) {
 	if id == 0 {
 		// Client-initiated keep-alive.
 		return
@@ -647,64 +871,90 @@ func (player *Player) pingReceived(id int32) {
 		}
 	} else {
 		if !player.ping.running {
-			log.Printf("%v: Received keep-alive id=%d when none was running", player, id)
-			player.Stop()
+			logger.Net.Debug("Ignoring keep-alive when none was running", "player", player.name, "id", id)
 			return
 		} else if id != player.ping.id {
-			log.Printf("%v: Bad keep alive ID received", player)
-			player.Stop()
+			logger.Net.Debug("Ignoring bad keep-alive", "player", player.name, "id", id)
 			return
 		}
 	}
 
 	// Received valid keep-alive.
-	now := time.Now().Unix()
-
 	if player.ping.timer != nil {
 		player.ping.timer.Stop()
 	}
 
-	latencyNs := now - player.ping.timestampNs
-	// Check that there wasn't an apparent time-shift on this before broadcasting
+	latencyNs := receivedNs - player.ping.timestampNs
+	// Check that there wasn't an apparent time-shift on this before recording
 	// this latency value.
-	if latencyNs >= 0 && latencyNs < PingTimeoutNs {
-		buf := new(bytes.Buffer)
-		proto.WriteUserListItem(buf, player.name, true, int16(latencyNs/1e6))
-		player.game.BroadcastPacket(buf.Bytes())
+	if latencyNs >= 0 && latencyNs < int64(*connectionTimeout) {
+		latencyMs := int32(latencyNs / 1e6)
+		if player.ping.measured {
+			prevMs := atomic.LoadInt32(&player.ping.latencyMs)
+			latencyMs = prevMs + int32(pingSmoothing*float64(latencyMs-prevMs))
+		}
+		atomic.StoreInt32(&player.ping.latencyMs, latencyMs)
+		player.ping.measured = true
 	}
 
 	player.ping.running = false
 	player.ping.id = 0
-	player.ping.timer = time.NewTimer(PingIntervalNs)
+	player.ping.timer = player.clock.NewTimer(*keepAliveInterval)
 }
 
-func (player *Player) mainLoop() {
-	defer func() {
+// disconnect closes the connection, which stops the receiveLoop and
+// transmitLoop, and has the game remove the player. Only the first call has
+// any effect, so that the player is removed once when both sides of the
+// connection fail together.
+func (player *Player) disconnect() {
+	player.disconnectOnce.Do(func() {
+		close(player.disconnected)
+
 		// Close the transmitLoop and receiveLoop cleanly.
-		player.txQueue <- nil
-		player.conn.Close()
+		if player.kickReason != "" {
+			buf := new(bytes.Buffer)
+			proto.WriteDisconnect(buf, player.kickReason)
+			player.txQueue.closeAfter(buf.Bytes())
+			time.AfterFunc(kickCloseDelay, func() {
+				player.conn.Close()
+			})
+		} else {
+			player.txQueue.close()
+			player.conn.Close()
+		}
 
 		player.onDisconnect <- player.EntityId
+	})
+}
+
+func (player *Player) mainLoop() {
+	defer func() {
+		player.disconnect()
 
 		if player.ping.timer != nil {
 			player.ping.timer.Stop()
 		}
-
-		buf := new(bytes.Buffer)
-		proto.WriteUserListItem(buf, player.name, false, 0)
-		player.game.BroadcastPacket(buf.Bytes())
 	}()
 
 	expVarPlayerConnectionCount.Add(1)
 	defer expVarPlayerDisconnectionCount.Add(1)
 
+	// Keyed by entity ID, as a player logging in again may start before the
+	// session that they replace has finished.
+	expVarKey := strconv.Itoa(int(player.EntityId))
+	expVarPlayerTxQueue.Set(expVarKey, expvar.Func(func() interface{} {
+		return playerTxQueueVar{player.name, player.TxQueueStats()}
+	}))
+	defer expVarPlayerTxQueue.Delete(expVarKey)
+
 	player.chunkSubs.Init(player)
 	defer player.chunkSubs.Close()
+	player.checkSpawnPosition()
 
 	// Start the keep-alive/latency pings.
 	player.pingNew()
 
-	player.sendChatMessage(fmt.Sprintf("%s has joined", player.name), false)
+	player.sendChat(chat.Reply, player.name+" has joined", false)
 
 MAINLOOP:
 	for {
@@ -712,44 +962,74 @@ MAINLOOP:
 		case _ = <-player.stopPlayer:
 			break MAINLOOP
 
+		case reason := <-player.kickPlayer:
+			logger.Net.Info("Kicked", "player", player.name, "reason", reason)
+			player.kickReason = reason
+			break MAINLOOP
+
 		case f, ok := <-player.mainQueue:
 			if !ok {
 				return
 			}
 			player.runQueuedCall(f)
 
-		case _ = <-player.ping.timer.C:
+		case _ = <-player.ping.timer.C():
 			player.pingTimeout()
 
+		case _ = <-player.txQueue.resume:
+			player.runQueuedCall(func(player *Player) {
+				player.chunkSubs.resumeChunks()
+			})
+
 		case err := <-player.rxErrChan:
-			log.Printf("%v: receive loop failed: %v", player, err)
-			player.Stop()
+			logger.Net.Info("Receive loop failed", "player", player.name, "err", err)
+			break MAINLOOP
 
 		case err := <-player.txErrChan:
-			log.Printf("%v: send loop failed: %v", player, err)
-			player.Stop()
+			logger.Net.Info("Send loop failed", "player", player.name, "err", err)
+			break MAINLOOP
 		}
 	}
 }
 
-func (player *Player) notifyChunkLoad() {
-	if !player.spawnComplete {
-		player.spawnComplete = true
+func (player *Player) notifyChunkLoad(chunkLoc ChunkXz, loaded bool) {
+	if !player.chunkSubs.chunkLoaded(chunkLoc, loaded) {
+		// Still waiting for chunks around the player.
+		return
+	}
 
-		// Player seems to fall through block unless elevated very slightly.
-		player.position.Y += 0.01
+	if !player.spawnComplete && !player.placePending {
+		player.place()
+	}
+}
 
-		// Send player start position etc.
-		buf := new(bytes.Buffer)
-		proto.ServerWritePlayerPositionLook(
-			buf,
-			&player.position, player.position.Y+player.height,
-			&player.look, false)
-		player.inventory.WriteWindowItems(buf)
-		proto.WriteUpdateHealth(buf, player.health, player.food, 0)
+// place puts the player into the world at their position, once the chunks
+// around them have been sent.
+func (player *Player) place() {
+	player.spawnComplete = true
+	player.fallDistance = 0
 
-		player.TransmitPacket(buf.Bytes())
+	// Player seems to fall through block unless elevated very slightly.
+	player.position.Y += 0.01
+
+	buf := new(bytes.Buffer)
+
+	// Rather than drop the player into nothing, give them something to
+	// stand on.
+	if curChunkLoc := player.position.ToChunkXz(); player.chunkSubs.isUnloaded(curChunkLoc) {
+		logger.Chunk.Warn("Chunk failed to load, spawning on a glass platform", "player", player.name, "chunk", curChunkLoc)
+		writeGlassPlatform(buf, &player.position)
 	}
+
+	// Send player start position etc.
+	proto.ServerWritePlayerPositionLook(
+		buf,
+		&player.position, player.position.Y+player.height,
+		&player.look, false)
+	player.inventory.WriteWindowItems(buf)
+	proto.WriteUpdateHealth(buf, player.health, player.food, 0)
+
+	player.TransmitPacket(buf.Bytes())
 }
 
 func (player *Player) inventorySubscribed(block *BlockXyz, invTypeId InvTypeId, slots []proto.WindowSlot) {
@@ -806,6 +1086,20 @@ func (player *Player) inventoryCursorUpdate(block *BlockXyz, cursor *gamerules.S
 	player.TransmitPacket(buf.Bytes())
 }
 
+func (player *Player) inventoryTakeItem(block *BlockXyz, item *gamerules.Slot) {
+	if player.inventory.AddStack(item) {
+		player.updateEquipment()
+	}
+
+	if item.Count > 0 {
+		// Put back what there was no room for.
+		shardClient, _, ok := player.chunkSubs.ShardClientForBlockXyz(block)
+		if ok {
+			shardClient.ReqInventoryPutItem(*block, *item)
+		}
+	}
+}
+
 func (player *Player) inventoryTxState(block *BlockXyz, txId TxId, accepted bool) {
 	if player.remoteInv == nil || !player.remoteInv.IsForBlock(block) || player.curWindow == nil {
 		return
@@ -813,6 +1107,10 @@ func (player *Player) inventoryTxState(block *BlockXyz, txId TxId, accepted bool
 
 	buf := new(bytes.Buffer)
 	proto.WriteWindowTransaction(buf, player.curWindow.WindowId(), txId, accepted)
+	if !accepted {
+		// Put the client's view of the window right.
+		player.curWindow.WriteWindowItems(buf)
+	}
 	player.TransmitPacket(buf.Bytes())
 }
 
@@ -831,6 +1129,12 @@ func (player *Player) placeHeldItem(target *BlockXyz, wasHeld *gamerules.Slot) {
 	// TODO think about having the slot index passed as well so if that changes,
 	// we can still track the original item and improve placement success rate.
 	if !curHeld.IsSameType(wasHeld) {
+		player.refuseBlockChange(target)
+		return
+	}
+
+	if player.spawnProtected(target) {
+		player.refuseBlockChange(target)
 		return
 	}
 
@@ -839,6 +1143,7 @@ func (player *Player) placeHeldItem(target *BlockXyz, wasHeld *gamerules.Slot) {
 		var into gamerules.Slot
 
 		player.inventory.TakeOneHeldItem(&into)
+		player.updateEquipment()
 
 		shardClient.ReqPlaceItem(*target, into)
 	}
@@ -871,23 +1176,30 @@ func (player *Player) giveItem(atPosition *AbsXyz, item *gamerules.Slot) {
 		}
 	}()
 
-	player.inventory.PutItem(item)
+	if player.inventory.AddStack(item) {
+		player.updateEquipment()
+	}
 }
 
 // Enqueue queues a function to run with the player lock within the player's
-// mainloop.
+// mainloop. Functions enqueued once the player has disconnected are dropped.
 func (player *Player) Enqueue(f func(*Player)) {
 	if f == nil {
 		return
 	}
-	player.mainQueue <- f
+	select {
+	case player.mainQueue <- f:
+	case <-player.disconnected:
+	}
 }
 
-func (player *Player) sendChatMessage(message string, sendToSelf bool) {
-	buf := new(bytes.Buffer)
-	proto.WriteChatMessage(buf, message)
-
-	packet := buf.Bytes()
+// sendChat sends a chat message of the kind from the player to the players
+// nearby.
+func (player *Player) sendChat(kind chat.Kind, message string, sendToSelf bool) {
+	packet := chat.Packet(kind, player.name, message)
+	if packet == nil {
+		return
+	}
 
 	if sendToSelf {
 		player.TransmitPacket(packet)
@@ -917,14 +1229,19 @@ func (player *Player) closeCurrentWindow(sendClosePacket bool) {
 }
 
 // setPositionLook sets the player's position and look angle. It also notifies
-// other players in the area of interest that the player has moved.
+// other players in the area of interest that the player has moved. Positions
+// outside the world border are moved inside it.
 func (player *Player) setPositionLook(pos AbsXyz, look LookDegrees) {
+	border := player.game.WorldBorder()
+	border.Clamp(&pos)
+
 	player.position = pos
 	player.look = look
 	player.height = StanceNormal - pos.Y
+	player.fallDistance = 0
 
 	if player.chunkSubs.Move(&player.position) {
-		// The destination chunk isn't loaded. Wait for it.
+		// The chunks around the destination aren't loaded. Wait for them.
 		player.spawnComplete = false
 	} else {
 		// Notify the player about their new position
@@ -1,7 +1,7 @@
 package player
 
 import (
-	"bytes"
+	"chunkymonkey/chat"
 	"chunkymonkey/gamerules"
 	"chunkymonkey/proto"
 	. "chunkymonkey/types"
@@ -21,13 +21,42 @@ func (p *playerClient) GetEntityId() EntityId {
 	return p.player.EntityId
 }
 
+// Name returns the player's name, which never changes.
+func (p *playerClient) Name() string {
+	return p.player.name
+}
+
 func (p *playerClient) TransmitPacket(packet []byte) {
 	p.player.TransmitPacket(packet)
 }
 
-func (p *playerClient) NotifyChunkLoad() {
+func (p *playerClient) NotifyChunkLoad(chunkLoc ChunkXz, loaded bool) {
+	p.player.Enqueue(func(_ *Player) {
+		p.player.notifyChunkLoad(chunkLoc, loaded)
+	})
+}
+
+func (p *playerClient) NotifyBedSpawn(position AbsXyz, ok bool) {
+	p.player.Enqueue(func(_ *Player) {
+		p.player.notifyBedSpawn(&position, ok)
+	})
+}
+
+func (p *playerClient) NotifySpawnPosition(position AbsXyz) {
 	p.player.Enqueue(func(_ *Player) {
-		p.player.notifyChunkLoad()
+		p.player.notifySpawnPosition(&position)
+	})
+}
+
+func (p *playerClient) NotifyFall(fallDistance float32) {
+	p.player.Enqueue(func(_ *Player) {
+		p.player.fallen(fallDistance)
+	})
+}
+
+func (p *playerClient) UseBed(bed BlockXyz) {
+	p.player.Enqueue(func(_ *Player) {
+		p.player.useBed(&bed, p.player.game.Time())
 	})
 }
 
@@ -55,6 +84,12 @@ func (p *playerClient) InventoryCursorUpdate(block BlockXyz, cursor gamerules.Sl
 	})
 }
 
+func (p *playerClient) InventoryTakeItem(block BlockXyz, item gamerules.Slot) {
+	p.player.Enqueue(func(_ *Player) {
+		p.player.inventoryTakeItem(&block, &item)
+	})
+}
+
 func (p *playerClient) InventoryTxState(block BlockXyz, txId TxId, accepted bool) {
 	p.player.Enqueue(func(_ *Player) {
 		p.player.inventoryTxState(&block, txId, accepted)
@@ -85,6 +120,14 @@ func (p *playerClient) GiveItemAtPosition(atPosition AbsXyz, item gamerules.Slot
 	})
 }
 
+// SetViewDistance changes the "square radius" of chunks around the player
+// that they are sent, within the radii allowed, and tells them the radius.
+func (p *playerClient) SetViewDistance(chunks int) {
+	p.player.Enqueue(func(_ *Player) {
+		p.player.setViewDistance(chunks)
+	})
+}
+
 func (p *playerClient) GiveItem(item gamerules.Slot) {
 	p.player.Enqueue(func(_ *Player) {
 		p.player.giveItem(&p.player.position, &item)
@@ -92,11 +135,26 @@ func (p *playerClient) GiveItem(item gamerules.Slot) {
 }
 
 func (p *playerClient) EchoMessage(msg string) {
-	p.player.Enqueue(func(_ *Player) {
-		buf := new(bytes.Buffer)
-		proto.WriteChatMessage(buf, msg)
-		p.TransmitPacket(buf.Bytes())
+	p.SendChat(chat.Reply, "", msg)
+}
+
+func (p *playerClient) SendChat(kind chat.Kind, from, message string) {
+	if packet := chat.Packet(kind, from, message); packet != nil {
+		p.TransmitPacket(packet)
+	}
+}
+
+// Selection returns the opposite corners of the region that the player has
+// selected with the wand. ok is false unless both corners have been selected.
+func (p *playerClient) Selection() (from, to BlockXyz, ok bool) {
+	result := make(chan bool)
+	p.player.Enqueue(func(player *Player) {
+		from, to = player.selection.corners[0], player.selection.corners[1]
+		ok = player.selection.isSet[0] && player.selection.isSet[1]
+		close(result)
 	})
+	<-result
+	return
 }
 
 func (p *playerClient) PositionLook() (AbsXyz, LookDegrees) {
@@ -121,3 +179,18 @@ func (p *playerClient) SetPositionLook(pos AbsXyz, look LookDegrees) {
 		player.setPositionLook(pos, look)
 	})
 }
+
+func (p *playerClient) AttackedByPlayer(attacker EntityId, damage Health, knockback AbsVelocity) {
+	p.player.Enqueue(func(_ *Player) {
+		p.player.attackedByPlayer(attacker, damage, &knockback)
+	})
+}
+
+// Kick disconnects the player, telling their client the reason.
+func (p *playerClient) Kick(reason string) {
+	p.player.Kick(reason)
+}
+
+func (p *playerClient) Ping() int16 {
+	return p.player.Ping()
+}
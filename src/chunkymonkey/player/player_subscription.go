@@ -1,12 +1,41 @@
 package player
 
 import (
-	"log"
+	"flag"
+	"fmt"
+	"sort"
 
 	"chunkymonkey/gamerules"
+	"chunkymonkey/logger"
 	. "chunkymonkey/types"
 )
 
+// spawnChunkRadius is the "square radius" of chunks around the player that
+// must be sent before the player is placed in the world.
+const spawnChunkRadius = ChunkCoord(1)
+
+// maxChunkRadius is the largest "square radius" of chunks around the player
+// that they may be sent, beyond which clients draw nothing.
+const maxChunkRadius = ChunkCoord(16)
+
+var viewDistance = flag.Int(
+	"view_distance", ChunkRadius,
+	fmt.Sprintf("The \"square radius\" of chunks around each player that they "+
+		"are sent, from %d to %d. Players may choose a different distance "+
+		"with /viewdistance.", MinChunkRadius, maxChunkRadius))
+
+// clampChunkRadius returns the radius limited to those that players may be
+// sent.
+func clampChunkRadius(radius int) ChunkCoord {
+	switch {
+	case radius < MinChunkRadius:
+		return MinChunkRadius
+	case radius > int(maxChunkRadius):
+		return maxChunkRadius
+	}
+	return ChunkCoord(radius)
+}
+
 // shardRef holds a reference to a shard connection and context for the number
 // of subscribed chunks inside the shard.
 type shardRef struct {
@@ -27,6 +56,11 @@ type chunkSubscriptions struct {
 	curChunkLoc    ChunkXz                      // Chunk the player is currently in.
 	curShard       gamerules.IPlayerShardClient // Shard the player is hosted on.
 	shardClients   map[uint64]*shardRef         // Connections to shards.
+	pendingChunks  []ChunkXz                    // Subscriptions held back while the player lags.
+	spawnChunks    []ChunkXz                    // Chunks to be sent before the player is placed.
+	unloadedChunks []ChunkXz                    // Chunks that couldn't be sent before the player is placed.
+	sentChunks     map[ChunkXz]bool             // Chunks that the client has been sent.
+	radius         ChunkCoord                   // "Square radius" of chunks sent.
 }
 
 func (sub *chunkSubscriptions) Init(player *Player) {
@@ -34,28 +68,49 @@ func (sub *chunkSubscriptions) Init(player *Player) {
 	sub.playerClient = &player.playerClient
 	sub.shardConnecter = player.shardConnecter
 	sub.entityId = player.EntityId
-	sub.curShardLoc = player.position.ToShardXz()
-	sub.curChunkLoc = player.position.ToChunkXz()
+	if sub.radius == 0 {
+		sub.radius = clampChunkRadius(*viewDistance)
+	}
+	sub.start(&player.position)
+}
+
+// start subscribes to the chunks around the location, and adds the player to
+// the chunk there. The player should be placed in the world once
+// chunkLoaded returns true.
+func (sub *chunkSubscriptions) start(loc *AbsXyz) {
+	sub.curShardLoc = loc.ToShardXz()
+	sub.curChunkLoc = loc.ToChunkXz()
 	sub.shardClients = make(map[uint64]*shardRef)
+	sub.pendingChunks = nil
+	sub.spawnChunks = nil
+	sub.unloadedChunks = nil
+	sub.sentChunks = make(map[ChunkXz]bool)
 
-	initialChunkLocs := orderedChunkSquare(sub.curChunkLoc, ChunkRadius)
+	initialChunkLocs := orderedChunkSquare(sub.curChunkLoc, sub.radius)
 	sub.subscribeToChunks(sub.curChunkLoc, initialChunkLocs)
 
 	sub.curShard = sub.shardClients[sub.curShardLoc.Key()].shard
 	sub.curShard.ReqAddPlayerData(
 		sub.curChunkLoc,
-		player.name,
-		player.position,
-		*player.look.ToLookBytes(),
-		player.getHeldItemTypeId(),
+		sub.player.name,
+		*loc,
+		*sub.player.look.ToLookBytes(),
+		sub.player.currentEquipment(),
 	)
 }
 
+// Respawn drops all subscriptions and starts again at the new location. Use
+// when the client has forgotten its chunks, as it does on respawning.
+func (sub *chunkSubscriptions) Respawn(newLoc *AbsXyz) {
+	sub.Close()
+	sub.start(newLoc)
+}
+
 // Move should be called as the player moves around the world. It replicates
 // the player's position to the chunk they are in, and adjusts chunk
-// subscriptions as necessary. Returns true if the new location is not yet
-// subscribed to by a chunk, indicating that the player will receive a
-// notifyChunkLoad when that chunk has been sent to the client.
+// subscriptions as necessary. Returns true if chunks around the new location
+// are not yet subscribed to, indicating that the player will receive a
+// notifyChunkLoad as each has been sent to the client.
 func (sub *chunkSubscriptions) Move(newLoc *AbsXyz) (notify bool) {
 	newChunkLoc := newLoc.ToChunkXz()
 	if newChunkLoc.X != sub.curChunkLoc.X || newChunkLoc.Z != sub.curChunkLoc.Z {
@@ -69,6 +124,10 @@ func (sub *chunkSubscriptions) Move(newLoc *AbsXyz) (notify bool) {
 		sub.curShard.ReqSetPlayerPosition(sub.curChunkLoc, *newLoc)
 	}
 
+	for _, ref := range sub.shardClients {
+		ref.shard.ReqSetTrackingPosition(*newLoc)
+	}
+
 	return
 }
 
@@ -84,6 +143,7 @@ func (sub *chunkSubscriptions) Close() {
 		ref.shard.Disconnect()
 		delete(sub.shardClients, key)
 	}
+	sub.sentChunks = make(map[ChunkXz]bool)
 }
 
 // CurrentShardClient is a convenience function to get a client shard
@@ -136,6 +196,10 @@ func (sub *chunkSubscriptions) ShardClientForChunkXz(chunkLoc *ChunkXz) (conn ga
 // subscribeToChunks connects to shards and subscribes to chunks for the chunk
 // locations given.
 func (sub *chunkSubscriptions) subscribeToChunks(destLoc ChunkXz, chunkLocs []ChunkXz) (notify bool) {
+	if len(sub.spawnChunks) == 0 {
+		sub.unloadedChunks = nil
+	}
+
 	for _, chunkLoc := range chunkLocs {
 		shardLoc := chunkLoc.ToShardXz()
 		shardKey := shardLoc.Key()
@@ -146,25 +210,125 @@ func (sub *chunkSubscriptions) subscribeToChunks(destLoc ChunkXz, chunkLocs []Ch
 				count: 0,
 			}
 			sub.shardClients[shardKey] = ref
+			ref.shard.ReqSetTrackingPosition(sub.player.position)
 		}
 
-		isDestChunk := chunkLoc.X == destLoc.X && chunkLoc.Z == destLoc.Z
-		notify = notify || isDestChunk
-		ref.shard.ReqSubscribeChunk(chunkLoc, isDestChunk)
+		isSpawnChunk := chunkLoc.WithinRadius(&destLoc, spawnChunkRadius)
 		ref.count++
+
+		// The chunks around the player are always sent, but others are held
+		// back while the player's connection is lagging.
+		if !isSpawnChunk && (len(sub.pendingChunks) > 0 || sub.player.txQueue.ChunksPaused()) {
+			sub.pendingChunks = append(sub.pendingChunks, chunkLoc)
+			continue
+		}
+		if isSpawnChunk {
+			notify = true
+			sub.spawnChunks = append(sub.spawnChunks, chunkLoc)
+		}
+		ref.shard.ReqSubscribeChunk(chunkLoc, true)
+	}
+
+	// Chunks around the player that were held back earlier are needed now.
+	for i := 0; i < len(sub.pendingChunks); {
+		chunkLoc := sub.pendingChunks[i]
+		if !chunkLoc.WithinRadius(&destLoc, spawnChunkRadius) {
+			i++
+			continue
+		}
+		sub.pendingChunks = append(sub.pendingChunks[:i], sub.pendingChunks[i+1:]...)
+		shardLoc := chunkLoc.ToShardXz()
+		if ref, ok := sub.shardClients[shardLoc.Key()]; ok {
+			notify = true
+			sub.spawnChunks = append(sub.spawnChunks, chunkLoc)
+			ref.shard.ReqSubscribeChunk(chunkLoc, true)
+		}
 	}
 
 	return
 }
 
+// chunkLoaded records that a chunk subscribed to has been sent, or couldn't be
+// loaded. Returns true when the last of the chunks around the player has been
+// accounted for.
+func (sub *chunkSubscriptions) chunkLoaded(chunkLoc ChunkXz, loaded bool) (complete bool) {
+	// The chunk may have gone out of range while it was being sent, in which
+	// case the client has since been told to unload it.
+	if loaded && chunkLoc.WithinRadius(&sub.curChunkLoc, sub.radius) {
+		sub.sentChunks[chunkLoc] = true
+	}
+
+	for i := range sub.spawnChunks {
+		if sub.spawnChunks[i].Equals(chunkLoc) {
+			sub.spawnChunks = append(sub.spawnChunks[:i], sub.spawnChunks[i+1:]...)
+			if !loaded {
+				sub.unloadedChunks = append(sub.unloadedChunks, chunkLoc)
+			}
+			return len(sub.spawnChunks) == 0
+		}
+	}
+	return false
+}
+
+// spawnChunksSent returns true if the chunks around the player have all been
+// accounted for since the last start.
+func (sub *chunkSubscriptions) spawnChunksSent() bool {
+	return len(sub.spawnChunks) == 0
+}
+
+// IsChunkSent returns true if the client currently has the chunk.
+func (sub *chunkSubscriptions) IsChunkSent(chunkLoc ChunkXz) bool {
+	return sub.sentChunks[chunkLoc]
+}
+
+// isUnloaded returns true if the chunk couldn't be sent when the player was
+// last placed.
+func (sub *chunkSubscriptions) isUnloaded(chunkLoc ChunkXz) bool {
+	for i := range sub.unloadedChunks {
+		if sub.unloadedChunks[i].Equals(chunkLoc) {
+			return true
+		}
+	}
+	return false
+}
+
+// resumeChunks sends subscription requests that were held back by
+// subscribeToChunks, until the player's connection lags again.
+func (sub *chunkSubscriptions) resumeChunks() {
+	for len(sub.pendingChunks) > 0 && !sub.player.txQueue.ChunksPaused() {
+		chunkLoc := sub.pendingChunks[0]
+		sub.pendingChunks = sub.pendingChunks[1:]
+
+		shardLoc := chunkLoc.ToShardXz()
+		if ref, ok := sub.shardClients[shardLoc.Key()]; ok {
+			ref.shard.ReqSubscribeChunk(chunkLoc, true)
+		}
+	}
+}
+
+// removePending removes the chunk location from the held back subscriptions.
+// Returns true if it was present.
+func (sub *chunkSubscriptions) removePending(chunkLoc ChunkXz) bool {
+	for i := range sub.pendingChunks {
+		if sub.pendingChunks[i].Equals(chunkLoc) {
+			sub.pendingChunks = append(sub.pendingChunks[:i], sub.pendingChunks[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
 // unsubscribeFromChunks unsubscribes from chunks for the chunk locations
 // given, and disconnects from shards where there are no subscribed chunks.
 func (sub *chunkSubscriptions) unsubscribeFromChunks(chunkLocs []ChunkXz) {
 	for _, chunkLoc := range chunkLocs {
 		shardLoc := chunkLoc.ToShardXz()
 		shardKey := shardLoc.Key()
+		delete(sub.sentChunks, chunkLoc)
 		if ref, ok := sub.shardClients[shardKey]; ok {
-			ref.shard.ReqUnsubscribeChunk(chunkLoc)
+			if !sub.removePending(chunkLoc) {
+				ref.shard.ReqUnsubscribeChunk(chunkLoc)
+			}
 			ref.count--
 			if ref.count <= 0 {
 				ref.shard.Disconnect()
@@ -172,8 +336,7 @@ func (sub *chunkSubscriptions) unsubscribeFromChunks(chunkLocs []ChunkXz) {
 			}
 		} else {
 			// Odd - we don't have a shard connection for that chunk.
-			log.Printf("chunkSubscriptions.unsubscribeFromChunks() attempted to "+
-				"unsubscribe from chunk @%v in unconnected shard @%v.", chunkLoc, shardLoc)
+			logger.Chunk.Warn("unsubscribeFromChunks: chunk is in unconnected shard", "chunk", chunkLoc, "shard", shardLoc)
 		}
 	}
 }
@@ -181,7 +344,9 @@ func (sub *chunkSubscriptions) unsubscribeFromChunks(chunkLocs []ChunkXz) {
 // moveToChunk subscribes to chunks that are newly in range, and unsubscribes
 // to those that have just left.
 func (sub *chunkSubscriptions) moveToChunk(newChunkLoc ChunkXz, newLoc *AbsXyz) (notify bool) {
-	addChunkLocs := squareDifference(newChunkLoc, sub.curChunkLoc, ChunkRadius)
+	// The chunks nearest the player are sent first.
+	addChunkLocs := squareDifference(newChunkLoc, sub.curChunkLoc, sub.radius)
+	sortNearest(newChunkLoc, addChunkLocs)
 	notify = sub.subscribeToChunks(newChunkLoc, addChunkLocs)
 
 	newShardLoc := newChunkLoc.ToShardXz()
@@ -191,7 +356,7 @@ func (sub *chunkSubscriptions) moveToChunk(newChunkLoc ChunkXz, newLoc *AbsXyz)
 			sub.player.name,
 			sub.player.position,
 			*sub.player.look.ToLookBytes(),
-			sub.player.getHeldItemTypeId(),
+			sub.player.currentEquipment(),
 		)
 	}
 
@@ -200,7 +365,7 @@ func (sub *chunkSubscriptions) moveToChunk(newChunkLoc ChunkXz, newLoc *AbsXyz)
 		ref.shard.ReqRemovePlayerData(sub.curChunkLoc, false)
 	}
 
-	delChunkLocs := squareDifference(sub.curChunkLoc, newChunkLoc, ChunkRadius)
+	delChunkLocs := squareDifference(sub.curChunkLoc, newChunkLoc, sub.radius)
 	sub.unsubscribeFromChunks(delChunkLocs)
 
 	sub.curChunkLoc = newChunkLoc
@@ -208,6 +373,37 @@ func (sub *chunkSubscriptions) moveToChunk(newChunkLoc ChunkXz, newLoc *AbsXyz)
 	return
 }
 
+// setRadius changes the "square radius" of chunks around the player that they
+// are sent, subscribing to the chunks brought into range nearest first, or
+// unsubscribing from those taken out of range.
+func (sub *chunkSubscriptions) setRadius(radius ChunkCoord) {
+	oldRadius := sub.radius
+	sub.radius = radius
+	if sub.shardClients == nil {
+		// Not started yet.
+		return
+	}
+
+	// Chunk squares are ordered nearest first, so the chunks between the radii
+	// come after those within the smaller one.
+	switch {
+	case radius > oldRadius:
+		edge := oldRadius*2 + 1
+		sub.subscribeToChunks(sub.curChunkLoc, orderedChunkSquare(sub.curChunkLoc, radius)[edge*edge:])
+	case radius < oldRadius:
+		edge := radius*2 + 1
+		sub.unsubscribeFromChunks(orderedChunkSquare(sub.curChunkLoc, oldRadius)[edge*edge:])
+	}
+}
+
+// setViewDistance changes the "square radius" of chunks that the player is
+// sent, within the radii allowed, and tells them the radius.
+func (player *Player) setViewDistance(chunks int) {
+	radius := clampChunkRadius(chunks)
+	player.chunkSubs.setRadius(radius)
+	player.playerClient.EchoMessage(fmt.Sprintf("View distance set to %d chunks", radius))
+}
+
 func (sub *chunkSubscriptions) moveToShard(newShardLoc ShardXz) {
 	// The new current shard is assumed to be present in sub.shardClients already.
 	sub.curShard = sub.shardClients[newShardLoc.Key()].shard
@@ -241,16 +437,38 @@ func squareDifference(centerA, centerB ChunkXz, radius ChunkCoord) []ChunkXz {
 	result := make([]ChunkXz, 0, areaEdgeSize)
 	for x := centerA.X - radius; x <= centerA.X+radius; x++ {
 		for z := centerA.Z - radius; z <= centerA.Z+radius; z++ {
-			if x >= centerB.X-radius && x <= centerB.X+radius && z >= centerB.Z-radius && z <= centerB.Z+radius {
+			loc := ChunkXz{x, z}
+			if loc.WithinRadius(&centerB, radius) {
 				// {x, z} is within square B. Don't include this.
 				continue
 			}
-			result = append(result, ChunkXz{x, z})
+			result = append(result, loc)
 		}
 	}
 	return result
 }
 
+// sortNearest sorts the chunk locations by their "square distance" from
+// center, nearest first.
+func sortNearest(center ChunkXz, locs []ChunkXz) {
+	distance := func(loc ChunkXz) ChunkCoord {
+		dx, dz := loc.X-center.X, loc.Z-center.Z
+		if dx < 0 {
+			dx = -dx
+		}
+		if dz < 0 {
+			dz = -dz
+		}
+		if dx > dz {
+			return dx
+		}
+		return dz
+	}
+	sort.SliceStable(locs, func(i, j int) bool {
+		return distance(locs[i]) < distance(locs[j])
+	})
+}
+
 // orderedChunkSquare creates a slice of chunk locations in a square centered
 // on `center`, with sides `radius` chunks away from the center. The chunk
 // locations are output in approx this order for radius=2 (where lower numbered
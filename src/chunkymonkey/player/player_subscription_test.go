@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"testing"
 
+	"chunkymonkey/proto"
 	. "chunkymonkey/types"
 )
 
@@ -155,3 +156,102 @@ func Test_squareDifference(t *testing.T) {
 		}
 	}
 }
+
+func TestChunkSubscriptions_SentChunks(t *testing.T) {
+	player := newTestPlayer(BlockXyz{8, 70, 8})
+	player.chunkSubs.Init(player)
+	player.serveChunks()
+
+	for _, loc := range orderedChunkSquare(ChunkXz{0, 0}, ChunkRadius) {
+		if !player.chunkSubs.IsChunkSent(loc) {
+			t.Errorf("Expected chunk %v to be sent", loc)
+		}
+	}
+
+	// Moving a chunk east unloads the column of chunks to the west, including
+	// one that is sent after the player has moved.
+	player.sentPackets()
+	player.chunkSubs.Move(&AbsXyz{24, 70, 8})
+	player.chunkSubs.chunkLoaded(ChunkXz{-ChunkRadius, 0}, true)
+	player.serveChunks()
+
+	for _, loc := range orderedChunkSquare(ChunkXz{0, 0}, ChunkRadius) {
+		if expected := loc.X > -ChunkRadius; player.chunkSubs.IsChunkSent(loc) != expected {
+			t.Errorf("Expected chunk %v sent=%t", loc, expected)
+		}
+	}
+	for _, loc := range orderedChunkSquare(ChunkXz{1, 0}, ChunkRadius) {
+		if !player.chunkSubs.IsChunkSent(loc) {
+			t.Errorf("Expected chunk %v to be sent", loc)
+		}
+	}
+}
+
+func TestChunkSubscriptions_SetRadius(t *testing.T) {
+	player := newTestPlayer(BlockXyz{8, 70, 8})
+	player.chunkSubs.setRadius(3)
+	player.chunkSubs.Init(player)
+	player.serveChunks()
+
+	checkSent := func(radius ChunkCoord) {
+		for _, loc := range orderedChunkSquare(ChunkXz{0, 0}, maxChunkRadius) {
+			if expected := loc.WithinRadius(&ChunkXz{0, 0}, radius); player.chunkSubs.IsChunkSent(loc) != expected {
+				t.Errorf("Radius %d: expected chunk %v sent=%t", radius, loc, expected)
+			}
+		}
+		count := 0
+		for _, ref := range player.chunkSubs.shardClients {
+			count += ref.count
+		}
+		if edge := int(radius*2 + 1); count != edge*edge {
+			t.Errorf("Radius %d: expected %d chunks subscribed, got %d", radius, edge*edge, count)
+		}
+	}
+
+	checkSent(3)
+
+	// The client keeps up, so that no chunks are held back.
+	player.sentPackets()
+	player.chunkSubs.setRadius(5)
+	player.serveChunks()
+	checkSent(5)
+
+	player.chunkSubs.setRadius(2)
+	player.serveChunks()
+	checkSent(2)
+}
+
+func TestChunkSubscriptions_MoveNearestFirst(t *testing.T) {
+	player := newTestPlayer(BlockXyz{8, 70, 8})
+	player.chunkSubs.setRadius(3)
+	player.chunkSubs.Init(player)
+	player.serveChunks()
+	player.sentPackets()
+
+	// Moving two chunks east brings two columns into range.
+	player.chunkSubs.Move(&AbsXyz{40, 70, 8})
+	player.serveChunks()
+
+	var distances []int
+	for _, packet := range player.sentPackets() {
+		if packet[0] != proto.PacketIdMapChunk {
+			continue
+		}
+		dx, dz := int(int8(packet[1]))-2, int(int8(packet[2]))
+		if dz < 0 {
+			dz = -dz
+		}
+		if dz > dx {
+			dx = dz
+		}
+		distances = append(distances, dx)
+	}
+	if len(distances) != 14 {
+		t.Fatalf("Expected 14 chunks to be sent, got %d", len(distances))
+	}
+	for i := 1; i < len(distances); i++ {
+		if distances[i] < distances[i-1] {
+			t.Fatalf("Expected chunks to be sent nearest first, got distances %v", distances)
+		}
+	}
+}
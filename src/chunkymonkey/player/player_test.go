@@ -0,0 +1,285 @@
+package player
+
+import (
+	"testing"
+	"time"
+
+	"chunkymonkey/clock"
+	"chunkymonkey/gamerules"
+	"chunkymonkey/proto"
+	. "chunkymonkey/types"
+	"nbt"
+)
+
+// pingAfter completes a ping that the client responded to after delay.
+func (player *Player) pingAfter(delay time.Duration) {
+	player.pingNew()
+	player.pingReceived(player.ping.id, player.ping.timestampNs+int64(delay))
+	player.ping.timer.Stop()
+}
+
+func TestPlayer_PingLatency(t *testing.T) {
+	player := newTestPlayer(BlockXyz{8, 70, 8})
+
+	player.pingNew()
+	if !player.ping.running {
+		t.Fatalf("Expected a ping to be running")
+	}
+	player.clock.(*clock.Fake).Advance(250 * time.Millisecond)
+	player.pingReceived(player.ping.id, player.clock.Now().UnixNano())
+
+	if player.ping.running {
+		t.Errorf("Expected the ping to have finished")
+	}
+	if ping := player.Ping(); ping != 250 {
+		t.Errorf("Expected ping of 250ms, got %dms", ping)
+	}
+	player.ping.timer.Stop()
+}
+
+func TestPlayer_PingTimer(t *testing.T) {
+	player := newTestPlayer(BlockXyz{8, 70, 8})
+	fakeClock := player.clock.(*clock.Fake)
+
+	// The next ping is due an interval after a response.
+	player.pingNew()
+	player.pingReceived(player.ping.id, fakeClock.Now().UnixNano())
+	fakeClock.Advance(*keepAliveInterval - time.Millisecond)
+	select {
+	case <-player.ping.timer.C():
+		t.Fatalf("Ping timer fired before the interval")
+	default:
+	}
+	fakeClock.Advance(time.Millisecond)
+	<-player.ping.timer.C()
+	player.pingTimeout()
+	if !player.ping.running {
+		t.Fatalf("Expected a new ping to be running")
+	}
+
+	// A ping that isn't answered times out.
+	fakeClock.Advance(*connectionTimeout)
+	select {
+	case <-player.ping.timer.C():
+	default:
+		t.Errorf("Expected the ping to time out")
+	}
+}
+
+func TestPlayer_ConnectionTimeout(t *testing.T) {
+	player := newTestPlayer(BlockXyz{8, 70, 8})
+	fakeClock := player.clock.(*clock.Fake)
+	stopped := func() bool { return len(player.stopPlayer) > 0 }
+
+	// Anything received from the client keeps the connection alive while a
+	// keep-alive is unanswered.
+	player.pingNew()
+	fakeClock.Advance(*connectionTimeout / 2)
+	player.lastReceivedNs = fakeClock.Now().UnixNano()
+	fakeClock.Advance(*connectionTimeout / 2)
+	<-player.ping.timer.C()
+	player.pingTimeout()
+	if stopped() {
+		t.Fatalf("Expected a client that sent a packet to stay connected")
+	}
+
+	// The timeout is then from the last packet received.
+	fakeClock.Advance(*connectionTimeout/2 - time.Millisecond)
+	select {
+	case <-player.ping.timer.C():
+		t.Fatalf("Timed out before the timeout since the last packet")
+	default:
+	}
+	fakeClock.Advance(time.Millisecond)
+	<-player.ping.timer.C()
+	player.pingTimeout()
+	if !stopped() {
+		t.Errorf("Expected a silent client to be disconnected")
+	}
+}
+
+func TestPlayer_TransmitQueueFullKicks(t *testing.T) {
+	player := newTestPlayer(BlockXyz{8, 70, 8})
+
+	packet := []byte{proto.PacketIdChatMessage}
+	for i := 0; i < txMaxDepth; i++ {
+		player.TransmitPacket(packet)
+	}
+	if len(player.kickPlayer) != 0 {
+		t.Fatalf("Expected a player with a queue that isn't full to stay connected")
+	}
+
+	player.TransmitPacket(packet)
+	select {
+	case reason := <-player.kickPlayer:
+		if reason != slowConnectionKickMsg {
+			t.Errorf("Expected kick reason %q, got %q", slowConnectionKickMsg, reason)
+		}
+	default:
+		t.Errorf("Expected a player with a full queue to be kicked")
+	}
+}
+
+func TestPlayer_TransmitQueueStallKicks(t *testing.T) {
+	player := newTestPlayer(BlockXyz{8, 70, 8})
+	fakeClock := player.clock.(*clock.Fake)
+
+	packet := []byte{proto.PacketIdChatMessage}
+	for i := 0; i <= txEssentialLimit; i++ {
+		player.TransmitPacket(packet)
+	}
+	if stalled := player.TxQueueStats().StalledForSec; stalled != 0 {
+		t.Fatalf("Expected the queue to have just stalled, got %ds", stalled)
+	}
+
+	// Essential packets are still queued until the stall times out.
+	fakeClock.Advance(txStallTimeoutNs)
+	player.TransmitPacket(packet)
+	if len(player.kickPlayer) != 0 {
+		t.Fatalf("Expected a player stalled for the timeout to stay connected")
+	}
+	if stalled := player.TxQueueStats().StalledForSec; stalled != txStallTimeoutNs/1e9 {
+		t.Errorf("Expected the queue to be stalled for %ds, got %ds", int64(txStallTimeoutNs/1e9), stalled)
+	}
+
+	fakeClock.Advance(time.Millisecond)
+	player.TransmitPacket(packet)
+	select {
+	case reason := <-player.kickPlayer:
+		if reason != slowConnectionKickMsg {
+			t.Errorf("Expected kick reason %q, got %q", slowConnectionKickMsg, reason)
+		}
+	default:
+		t.Errorf("Expected a player stalled beyond the timeout to be kicked")
+	}
+}
+
+func TestPlayer_PingSmoothed(t *testing.T) {
+	type Test struct {
+		delays   []time.Duration
+		expected int16
+	}
+
+	var tests = []Test{
+		{[]time.Duration{100 * time.Millisecond}, 100},
+		{[]time.Duration{100 * time.Millisecond, 500 * time.Millisecond}, 200},
+		{[]time.Duration{100 * time.Millisecond, 500 * time.Millisecond, 100 * time.Millisecond}, 175},
+		{[]time.Duration{100 * time.Millisecond, -time.Second}, 100},
+	}
+
+	for _, test := range tests {
+		player := newTestPlayer(BlockXyz{8, 70, 8})
+		for _, delay := range test.delays {
+			player.pingAfter(delay)
+		}
+		if ping := player.Ping(); ping != test.expected {
+			t.Errorf("Pings after %v: expected %dms got %dms", test.delays, test.expected, ping)
+		}
+	}
+}
+
+func TestPlayer_PingIgnoresUnmatched(t *testing.T) {
+	player := newTestPlayer(BlockXyz{8, 70, 8})
+	player.pingAfter(100 * time.Millisecond)
+
+	// A duplicate of the response, when no ping is running.
+	player.pingReceived(player.ping.id, player.ping.timestampNs+int64(time.Second))
+
+	player.pingNew()
+	defer player.ping.timer.Stop()
+	player.pingReceived(player.ping.id+1, player.ping.timestampNs+int64(time.Second))
+
+	if !player.ping.running {
+		t.Errorf("Expected the ping to still be running after a bad response")
+	}
+	if ping := player.Ping(); ping != 100 {
+		t.Errorf("Expected ping of 100ms, got %dms", ping)
+	}
+}
+
+func TestPlayer_NbtRoundTrip(t *testing.T) {
+	player := newTestPlayer(BlockXyz{8, 70, 8})
+	player.position = AbsXyz{1.5, 80, -2.5}
+	player.health = 7
+	player.inventory.SetHolding(4)
+
+	var data *nbt.Compound
+	err := player.SaveSnapshot(func(saved *nbt.Compound) {
+		data = saved
+	})
+	if err != nil {
+		t.Fatalf("SaveSnapshot error: %v", err)
+	}
+
+	loaded := newTestPlayer(BlockXyz{8, 70, 8})
+	if err = loaded.UnmarshalNbt(data); err != nil {
+		t.Fatalf("UnmarshalNbt error: %v", err)
+	}
+	if loaded.position != player.position {
+		t.Errorf("Expected position %v, got %v", player.position, loaded.position)
+	}
+	if loaded.health != 7 {
+		t.Errorf("Expected health 7, got %d", loaded.health)
+	}
+	if _, held := loaded.inventory.HeldItem(); held != 4 {
+		t.Errorf("Expected held slot 4, got %d", held)
+	}
+
+	// Player data written before the held slot was saved selects the first.
+	data.Delete("SelectedItemSlot")
+	loaded = newTestPlayer(BlockXyz{8, 70, 8})
+	if err = loaded.UnmarshalNbt(data); err != nil {
+		t.Fatalf("UnmarshalNbt error: %v", err)
+	}
+	if _, held := loaded.inventory.HeldItem(); held != 0 {
+		t.Errorf("Expected held slot 0, got %d", held)
+	}
+}
+
+func TestPlayer_ShiftClickInventory(t *testing.T) {
+	player := newTestPlayer(BlockXyz{8, 70, 8})
+	player.chunkSubs.Init(player)
+	player.serveChunks()
+	player.inventory.AddStack(&gamerules.Slot{ItemTypeId: 1, Count: 10})
+
+	// The first hotbar slot is window slot 36, and the first main inventory
+	// slot is window slot 9.
+	player.PacketWindowClick(WindowIdInventory, 36, false, 1, true, &proto.WindowSlot{ItemTypeId: 1, Count: 9})
+	if held, _ := player.inventory.HeldItem(); held.Count != 10 {
+		t.Fatalf("Expected click with wrong expected slot to be refused, holding %v", held)
+	}
+
+	player.PacketWindowClick(WindowIdInventory, 36, false, 2, true, &proto.WindowSlot{ItemTypeId: 1, Count: 10})
+	if held, _ := player.inventory.HeldItem(); !held.IsEmpty() {
+		t.Errorf("Expected hotbar slot to be emptied, holding %v", held)
+	}
+	if moved := player.inventory.RemoveFromSlot(9, 64); moved.ItemTypeId != 1 || moved.Count != 10 {
+		t.Errorf("Expected items moved into the main inventory, got %v", moved)
+	}
+}
+
+func TestPlayer_InventoryTakeItem(t *testing.T) {
+	player := newTestPlayer(BlockXyz{8, 70, 8})
+	player.chunkSubs.Init(player)
+	player.serveChunks()
+	connecter := player.shardConnecter.(*fakeShardConnecter)
+
+	block := BlockXyz{9, 70, 8}
+
+	player.inventoryTakeItem(&block, &gamerules.Slot{ItemTypeId: 1, Count: 10})
+	if held, _ := player.inventory.HeldItem(); held.ItemTypeId != 1 || held.Count != 10 {
+		t.Errorf("Expected to hold the item taken, holding %v", held)
+	}
+	if len(connecter.puts) != 0 {
+		t.Errorf("Expected nothing put back, got %v", connecter.puts)
+	}
+
+	// Once the inventory is full, items are put back.
+	for i := 0; i < 36; i++ {
+		player.inventory.AddStack(&gamerules.Slot{ItemTypeId: 4, Count: 64})
+	}
+	player.inventoryTakeItem(&block, &gamerules.Slot{ItemTypeId: 3, Count: 5})
+	if len(connecter.puts) != 1 || connecter.puts[0].ItemTypeId != 3 || connecter.puts[0].Count != 5 {
+		t.Errorf("Expected the item to be put back, got %v", connecter.puts)
+	}
+}
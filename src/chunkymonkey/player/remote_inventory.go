@@ -27,6 +27,13 @@ func (inv *RemoteInventory) IsForBlock(block *BlockXyz) bool {
 }
 
 func (inv *RemoteInventory) slotUpdate(slot *gamerules.Slot, slotId SlotId) {
+	if slotId >= 0 && int(slotId) < len(inv.slots) {
+		inv.slots[slotId] = proto.WindowSlot{
+			ItemTypeId: slot.ItemTypeId,
+			Count:      slot.Count,
+			Data:       slot.Data,
+		}
+	}
 	if inv.subscriber != nil {
 		inv.subscriber.SlotUpdate(slot, slotId)
 	}
@@ -62,13 +69,32 @@ func (inv *RemoteInventory) Click(click *gamerules.Click) (txState TxState) {
 	return TxStateDeferred
 }
 
+// ShiftClick requests that the shard take the stack from the slot. The
+// shard gives the stack to the player, so nothing is taken here.
+func (inv *RemoteInventory) ShiftClick(click *gamerules.Click) (taken gamerules.Slot, txState TxState) {
+	return taken, inv.Click(click)
+}
+
+// PutItem requests that the shard put the whole item into the inventory. The
+// shard gives back whatever doesn't fit.
+func (inv *RemoteInventory) PutItem(item *gamerules.Slot) (changed bool) {
+	shard, _, ok := inv.chunkSubs.ShardClientForBlockXyz(&inv.blockLoc)
+
+	if ok && !item.IsEmpty() {
+		shard.ReqInventoryPutItem(inv.blockLoc, *item)
+		item.Clear()
+		changed = true
+	}
+
+	return
+}
+
 func (inv *RemoteInventory) SetSubscriber(subscriber gamerules.IInventorySubscriber) {
 	inv.subscriber = subscriber
 }
 
 func (inv *RemoteInventory) WriteProtoSlots(slots []proto.WindowSlot) {
-	// Note that this only produces accurate results before any slot updates come
-	// through. inv.slots contains only a snapshot of the state when the window
-	// opened.
+	// Note that inv.slots is only as up to date as the slot updates that have
+	// come through from the shard.
 	copy(slots, inv.slots)
 }
@@ -0,0 +1,48 @@
+package player
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+
+	"chunkymonkey/gamerules"
+	"chunkymonkey/proto"
+	. "chunkymonkey/types"
+)
+
+var wandItem = flag.Int(
+	"wand_item", 271,
+	"The item that players who may use /copy hold to select a region, left "+
+		"clicking a block for one corner and right clicking another for the "+
+		"opposite corner. 271 is a wooden axe.")
+
+// wandPermission is needed by players to select regions with the wand. It is
+// the same as the permission for /copy, which is what the selections are for.
+const wandPermission = "admin.commands.copy"
+
+// selection is the region that a player has selected with the wand, between
+// two opposite corners.
+type selection struct {
+	corners [2]BlockXyz
+	isSet   [2]bool
+}
+
+// holdingWand returns true if the player is holding the wand and may use it.
+func (player *Player) holdingWand() bool {
+	held, _ := player.inventory.HeldItem()
+	if held.IsEmpty() || int(held.ItemTypeId) != *wandItem {
+		return false
+	}
+	return gamerules.Permissions != nil && gamerules.Permissions.UserPermissions(player.name).Has(wandPermission)
+}
+
+// selectCorner sets one of the corners of the player's selection, and tells
+// them.
+func (player *Player) selectCorner(corner int, loc BlockXyz) {
+	player.selection.corners[corner] = loc
+	player.selection.isSet[corner] = true
+
+	buf := new(bytes.Buffer)
+	proto.WriteChatMessage(buf, fmt.Sprintf("Corner %d set to %d,%d,%d", corner+1, loc.X, loc.Y, loc.Z))
+	player.TransmitPacket(buf.Bytes())
+}
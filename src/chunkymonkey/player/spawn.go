@@ -0,0 +1,84 @@
+package player
+
+import (
+	"io"
+
+	"chunkymonkey/logger"
+	"chunkymonkey/proto"
+	. "chunkymonkey/types"
+)
+
+const (
+	// glassPlatformBlockId is the block that the glass platform is made of.
+	glassPlatformBlockId = 20
+	// glassPlatformRadius is the number of blocks that the platform extends
+	// either side of the player.
+	glassPlatformRadius = 1
+)
+
+// writeGlassPlatform writes packets for a chunk that is empty except for a
+// small glass platform under the position. It is for when the chunk at the
+// position can't be loaded, so that the player doesn't fall into the void. The
+// chunk only exists on the client, so it goes when the chunk is next sent.
+func writeGlassPlatform(writer io.Writer, pos *AbsXyz) {
+	blockLoc := pos.ToBlockXyz()
+	chunkLoc, subLoc := blockLoc.ToChunkLocal()
+	if subLoc.Y == 0 {
+		return
+	}
+
+	const numBlocks = ChunkSizeH * ChunkSizeH * ChunkSizeY
+	blocks := make([]byte, numBlocks)
+	blockData := make([]byte, numBlocks>>1)
+	blockLight := make([]byte, numBlocks>>1)
+	skyLight := make([]byte, numBlocks>>1)
+	for i := range skyLight {
+		skyLight[i] = 0xff
+	}
+
+	for dx := -glassPlatformRadius; dx <= glassPlatformRadius; dx++ {
+		for dz := -glassPlatformRadius; dz <= glassPlatformRadius; dz++ {
+			x, z := int(subLoc.X)+dx, int(subLoc.Z)+dz
+			if x < 0 || z < 0 || x >= ChunkSizeH || z >= ChunkSizeH {
+				// Blocks in other chunks would be overwritten by them.
+				continue
+			}
+			loc := SubChunkXyz{SubChunkCoord(x), subLoc.Y - 1, SubChunkCoord(z)}
+			if index, ok := loc.BlockIndex(); ok {
+				blocks[index] = glassPlatformBlockId
+			}
+		}
+	}
+
+	packet, err := proto.MapChunkPacket(chunkLoc, blocks, blockData, blockLight, skyLight)
+	if err != nil {
+		logger.Chunk.Error("writeGlassPlatform: failed to create packet", "err", err)
+		return
+	}
+	proto.WritePreChunk(writer, chunkLoc, ChunkInit)
+	writer.Write(packet)
+}
+
+// checkSpawnPosition asks the shard to move the player's position up out of
+// any solid blocks, such as when the world has changed around their saved
+// position. The player isn't placed until the shard replies.
+func (player *Player) checkSpawnPosition() {
+	if shardClient, ok := player.chunkSubs.CurrentShardClient(); ok {
+		player.placePending = true
+		shardClient.ReqSpawnPosition(player.position)
+	}
+}
+
+// notifySpawnPosition places the player at the position that the shard found
+// for them to stand at.
+func (player *Player) notifySpawnPosition(position *AbsXyz) {
+	if !player.placePending {
+		return
+	}
+	player.placePending = false
+
+	player.position = *position
+	if player.chunkSubs.spawnChunksSent() {
+		player.place()
+	}
+}
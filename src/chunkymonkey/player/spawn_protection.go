@@ -0,0 +1,45 @@
+package player
+
+import (
+	"flag"
+
+	"chunkymonkey/gamerules"
+	. "chunkymonkey/types"
+)
+
+var spawnProtectionRadius = flag.Int(
+	"spawn_protection", 16,
+	"The distance in blocks from the world spawn within which only players "+
+		"with the "+spawnBuildPermission+" permission may break and place "+
+		"blocks. 0 disables spawn protection.")
+
+// spawnBuildPermission lets players break and place blocks near the world
+// spawn.
+const spawnBuildPermission = "world.build.spawn"
+
+// spawnProtected returns true if the player may not break or place the block
+// because it is near the world spawn. The spawn is looked up each time, as it
+// may have moved.
+func (player *Player) spawnProtected(loc *BlockXyz) bool {
+	radius := int64(*spawnProtectionRadius)
+	if radius <= 0 {
+		return false
+	}
+
+	spawn := player.game.SpawnBlock()
+	dx, dz := int64(loc.X)-int64(spawn.X), int64(loc.Z)-int64(spawn.Z)
+	if dx < -radius || dx > radius || dz < -radius || dz > radius {
+		return false
+	}
+
+	return gamerules.Permissions == nil || !gamerules.Permissions.UserPermissions(player.name).Has(spawnBuildPermission)
+}
+
+// refuseBlockChange undoes the change to the block that the player's client
+// made before the server refused it.
+func (player *Player) refuseBlockChange(loc *BlockXyz) {
+	shardClient, _, ok := player.chunkSubs.ShardClientForBlockXyz(loc)
+	if ok {
+		shardClient.ReqResendBlock(*loc)
+	}
+}
@@ -0,0 +1,98 @@
+package player
+
+import (
+	"testing"
+
+	"chunkymonkey/gamerules"
+	"chunkymonkey/permission"
+	. "chunkymonkey/types"
+)
+
+// fakeGame is the game as seen by a player, with only the world spawn and
+// border.
+type fakeGame struct {
+	gamerules.IGame
+	spawn  BlockXyz
+	border WorldBorder
+}
+
+func (game *fakeGame) SpawnBlock() BlockXyz {
+	return game.spawn
+}
+
+func (game *fakeGame) WorldBorder() WorldBorder {
+	return game.border
+}
+
+// fakePermissions gives each user the listed permissions.
+type fakePermissions map[string][]string
+
+func (p fakePermissions) UserPermissions(username string) permission.IUserPermissions {
+	return fakeUserPermissions(p[username])
+}
+
+type fakeUserPermissions []string
+
+func (u fakeUserPermissions) Has(node string) bool {
+	for _, p := range u {
+		if p == node {
+			return true
+		}
+	}
+	return false
+}
+
+func TestPlayer_SpawnProtection(t *testing.T) {
+	defer func(radius int) { *spawnProtectionRadius = radius }(*spawnProtectionRadius)
+	defer func(p permission.IPermissions) { gamerules.Permissions = p }(gamerules.Permissions)
+	gamerules.Permissions = fakePermissions{"Op": {spawnBuildPermission}}
+
+	type Test struct {
+		desc      string
+		name      string
+		radius    int
+		spawn     BlockXyz
+		protected bool
+	}
+
+	var tests = []Test{
+		{"at spawn", "Steve", 16, BlockXyz{8, 64, 8}, true},
+		{"at edge", "Steve", 16, BlockXyz{-8, 64, 24}, true},
+		{"beyond edge", "Steve", 16, BlockXyz{-9, 64, 8}, false},
+		{"spawn moved away", "Steve", 16, BlockXyz{1000, 64, 1000}, false},
+		{"disabled", "Steve", 0, BlockXyz{8, 64, 8}, false},
+		{"with permission", "Op", 16, BlockXyz{8, 64, 8}, false},
+	}
+
+	target := BlockXyz{8, 69, 8}
+	for _, test := range tests {
+		*spawnProtectionRadius = test.radius
+		player := newTestPlayer(BlockXyz{8, 70, 8})
+		player.name = test.name
+		player.game = &fakeGame{spawn: test.spawn}
+		player.chunkSubs.Init(player)
+		player.serveChunks()
+		connecter := player.shardConnecter.(*fakeShardConnecter)
+
+		player.PacketPlayerBlockHit(DigStarted, &target, FaceTop)
+		player.PacketPlayerBlockHit(DigBlockBroke, &target, FaceTop)
+		player.placeHeldItem(&target, &gamerules.Slot{})
+
+		if test.protected {
+			if len(connecter.hits) != 0 || len(connecter.places) != 0 {
+				t.Errorf("%s: expected no block changes, got hits %v and places %v", test.desc, connecter.hits, connecter.places)
+			}
+			// The broken and the placed block are sent again.
+			if len(connecter.resends) != 2 || connecter.resends[0] != target || connecter.resends[1] != target {
+				t.Errorf("%s: expected the block to be sent again twice, got %v", test.desc, connecter.resends)
+			}
+		} else {
+			if len(connecter.hits) != 2 || len(connecter.places) != 1 {
+				t.Errorf("%s: expected block changes, got hits %v and places %v", test.desc, connecter.hits, connecter.places)
+			}
+			if len(connecter.resends) != 0 {
+				t.Errorf("%s: expected no blocks sent again, got %v", test.desc, connecter.resends)
+			}
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package player
+
+import (
+	"testing"
+	"time"
+
+	"chunkymonkey/clock"
+	"chunkymonkey/gamerules"
+	"chunkymonkey/proto"
+	. "chunkymonkey/types"
+)
+
+// fakeShardConnecter connects players to fakeShardClients, which send stand-in
+// chunk packets straight back to the player. The stand-in map chunk packets
+// hold the low bytes of the chunk's coordinates.
+type fakeShardConnecter struct {
+	unloaded      map[ChunkXz]bool // Chunks that fail to load.
+	subscriptions []func()         // Chunk subscriptions and spawn checks yet to be served.
+	entityUses    []ChunkXz        // Chunks asked to use an entity.
+	bedRequests   []BlockXyz       // Beds asked for a spawn position.
+	hits          []BlockXyz       // Blocks hit.
+	places        []BlockXyz       // Blocks asked to have items placed at.
+	resends       []BlockXyz       // Blocks asked to be sent again.
+	landings      []float32        // Fall distances of landings reported.
+	drops         []gamerules.Slot // Items dropped.
+	puts          []gamerules.Slot // Items put into block inventories.
+}
+
+func (c *fakeShardConnecter) PlayerShardConnect(entityId EntityId, player gamerules.IPlayerClient, shardLoc ShardXz) gamerules.IPlayerShardClient {
+	return &fakeShardClient{c, player}
+}
+
+func (c *fakeShardConnecter) ShardShardConnect(shardLoc ShardXz) gamerules.IShardShardClient {
+	return nil
+}
+
+type fakeShardClient struct {
+	connecter *fakeShardConnecter
+	player    gamerules.IPlayerClient
+}
+
+func (c *fakeShardClient) Disconnect() {}
+
+func (c *fakeShardClient) ReqSubscribeChunk(chunkLoc ChunkXz, notify bool) {
+	c.connecter.subscriptions = append(c.connecter.subscriptions, func() {
+		loaded := !c.connecter.unloaded[chunkLoc]
+		if loaded {
+			c.player.TransmitPacket([]byte{proto.PacketIdPreChunk})
+			c.player.TransmitPacket([]byte{proto.PacketIdMapChunk, byte(chunkLoc.X), byte(chunkLoc.Z)})
+		}
+		if notify {
+			c.player.NotifyChunkLoad(chunkLoc, loaded)
+		}
+	})
+}
+
+func (c *fakeShardClient) ReqUnsubscribeChunk(chunkLoc ChunkXz)                                  {}
+func (c *fakeShardClient) ReqMulticastPlayers(chunkLoc ChunkXz, exclude EntityId, packet []byte) {}
+func (c *fakeShardClient) ReqAddPlayerData(chunkLoc ChunkXz, name string, position AbsXyz, look LookBytes, equipment gamerules.PlayerEquipment) {
+}
+func (c *fakeShardClient) ReqRemovePlayerData(chunkLoc ChunkXz, isDisconnect bool) {}
+func (c *fakeShardClient) ReqSetPlayerPosition(chunkLoc ChunkXz, position AbsXyz)  {}
+func (c *fakeShardClient) ReqSetTrackingPosition(position AbsXyz)                  {}
+func (c *fakeShardClient) ReqSetPlayerLook(chunkLoc ChunkXz, look LookBytes)       {}
+func (c *fakeShardClient) ReqHitBlock(held gamerules.Slot, target BlockXyz, digStatus DigStatus, face Face) {
+	c.connecter.hits = append(c.connecter.hits, target)
+}
+func (c *fakeShardClient) ReqInteractBlock(held gamerules.Slot, target BlockXyz, face Face) {}
+func (c *fakeShardClient) ReqPlaceItem(target BlockXyz, slot gamerules.Slot) {
+	c.connecter.places = append(c.connecter.places, target)
+}
+func (c *fakeShardClient) ReqSetSignText(target BlockXyz, lines [4]string) {}
+func (c *fakeShardClient) ReqResendBlock(target BlockXyz) {
+	c.connecter.resends = append(c.connecter.resends, target)
+}
+func (c *fakeShardClient) ReqBedSpawn(bed BlockXyz) {
+	c.connecter.bedRequests = append(c.connecter.bedRequests, bed)
+}
+func (c *fakeShardClient) ReqSpawnPosition(position AbsXyz) {
+	c.connecter.subscriptions = append(c.connecter.subscriptions, func() {
+		c.player.NotifySpawnPosition(position)
+	})
+}
+func (c *fakeShardClient) ReqLanded(position AbsXyz, fallDistance float32) {
+	c.connecter.landings = append(c.connecter.landings, fallDistance)
+}
+func (c *fakeShardClient) ReqTakeItem(chunkLoc ChunkXz, entityId EntityId) {}
+func (c *fakeShardClient) ReqUseEntity(chunkLoc ChunkXz, held gamerules.Slot, position AbsXyz, target EntityId, leftClick bool) {
+	c.connecter.entityUses = append(c.connecter.entityUses, chunkLoc)
+}
+func (c *fakeShardClient) ReqDropItem(content gamerules.Slot, position AbsXyz, velocity AbsVelocity, pickupImmunity Ticks) {
+	c.connecter.drops = append(c.connecter.drops, content)
+}
+func (c *fakeShardClient) ReqInventoryClick(block BlockXyz, click gamerules.Click) {}
+func (c *fakeShardClient) ReqInventoryPutItem(block BlockXyz, item gamerules.Slot) {
+	c.connecter.puts = append(c.connecter.puts, item)
+}
+func (c *fakeShardClient) ReqInventoryUnsubscribed(block BlockXyz) {}
+func (c *fakeShardClient) ReqSetPlayerEquipment(chunkLoc ChunkXz, slotId SlotId, item gamerules.Slot) {
+}
+
+// newTestPlayer creates a player at spawnBlock, in a game whose world spawn
+// is there, that is connected to fake shards, but not to a client.
+func newTestPlayer(spawnBlock BlockXyz, unloaded ...ChunkXz) *Player {
+	connecter := &fakeShardConnecter{unloaded: make(map[ChunkXz]bool)}
+	for _, loc := range unloaded {
+		connecter.unloaded[loc] = true
+	}
+	game := &fakeGame{spawn: spawnBlock}
+	return NewPlayer(1, connecter, nil, "Steve", spawnBlock, nil, game, clock.NewFake(time.Unix(1000, 0)))
+}
+
+// serveChunks serves the player's chunk subscriptions one at a time, running
+// the calls that each queues for the player's main loop in between, as if the
+// player's main loop were keeping up with the shards.
+func (player *Player) serveChunks() {
+	connecter := player.shardConnecter.(*fakeShardConnecter)
+	for len(connecter.subscriptions) > 0 {
+		serve := connecter.subscriptions[0]
+		connecter.subscriptions = connecter.subscriptions[1:]
+		serve()
+
+		for len(player.mainQueue) > 0 {
+			player.runQueuedCall(<-player.mainQueue)
+		}
+	}
+}
+
+// sentPackets returns the packets sent to the player.
+func (player *Player) sentPackets() (packets [][]byte) {
+	for player.txQueue.Stats().Depth > 0 {
+		packet, _ := player.txQueue.pop()
+		packets = append(packets, packet)
+	}
+	return
+}
+
+func isPositionLook(packet []byte) bool {
+	return packet[0] == proto.PacketIdPlayerPositionLook
+}
+
+// isGlassPlatform matches the glass platform chunk, which is sent along with
+// the player's position. The fake shards send single byte pre-chunk packets.
+func isGlassPlatform(packet []byte) bool {
+	return len(packet) > 1 && packet[0] == proto.PacketIdPreChunk
+}
+
+// checkPlacedAfterSpawnChunks checks that the player was placed exactly once,
+// after the 3x3 chunks around centre were sent, except for those that are
+// unloaded.
+func checkPlacedAfterSpawnChunks(t *testing.T, packets [][]byte, isPlacement func(packet []byte) bool, centre ChunkXz, unloaded ...ChunkXz) {
+	placed := -1
+	sent := make(map[ChunkXz]bool)
+	for i, packet := range packets {
+		switch {
+		case isPlacement(packet) && placed == -1:
+			placed = i
+		case isPlacement(packet):
+			t.Fatalf("Player placed twice, at packets %d and %d", placed, i)
+		case packet[0] == proto.PacketIdMapChunk && placed == -1:
+			sent[ChunkXz{ChunkCoord(int8(packet[1])), ChunkCoord(int8(packet[2]))}] = true
+		}
+	}
+	if placed == -1 {
+		t.Fatalf("Player never placed")
+	}
+
+	for _, loc := range unloaded {
+		sent[loc] = true
+	}
+	for _, loc := range orderedChunkSquare(centre, 1) {
+		if !sent[loc] {
+			t.Errorf("Player placed before chunk %v was sent", loc)
+		}
+	}
+}
+
+func TestPlayer_SpawnAfterChunks(t *testing.T) {
+	player := newTestPlayer(BlockXyz{8, 70, 8})
+	player.chunkSubs.Init(player)
+
+	if player.spawnComplete {
+		t.Fatalf("Player placed before any chunks were sent")
+	}
+	player.serveChunks()
+	if !player.spawnComplete {
+		t.Fatalf("Player not placed after chunks were sent")
+	}
+
+	checkPlacedAfterSpawnChunks(t, player.sentPackets(), isPositionLook, ChunkXz{0, 0})
+}
+
+func TestPlayer_SpawnOnGlassPlatform(t *testing.T) {
+	player := newTestPlayer(BlockXyz{8, 70, 8}, ChunkXz{0, 0}, ChunkXz{1, 1})
+	player.chunkSubs.Init(player)
+	player.serveChunks()
+	if !player.spawnComplete {
+		t.Fatalf("Player not placed after chunks failed to load")
+	}
+
+	// The glass platform chunk is sent along with the player's position.
+	checkPlacedAfterSpawnChunks(t, player.sentPackets(), isGlassPlatform, ChunkXz{0, 0}, ChunkXz{0, 0}, ChunkXz{1, 1})
+}
+
+func TestPlayer_RespawnAfterChunks(t *testing.T) {
+	player := newTestPlayer(BlockXyz{8, 70, 8})
+	player.chunkSubs.Init(player)
+	player.serveChunks()
+	player.sentPackets()
+
+	player.health = 0
+	player.position = AbsXyz{500, 70, 500}
+	player.respawn()
+	if player.spawnComplete {
+		t.Fatalf("Player placed before any chunks were sent")
+	}
+	player.serveChunks()
+
+	packets := player.sentPackets()
+	if len(packets) == 0 || packets[0][0] != proto.PacketIdRespawn {
+		t.Fatalf("Expected respawn packet first")
+	}
+	checkPlacedAfterSpawnChunks(t, packets, isPositionLook, ChunkXz{0, 0})
+	if !player.position.ToChunkXz().Equals(ChunkXz{0, 0}) {
+		t.Errorf("Expected player at spawn, got %v", player.position)
+	}
+}
+
+func TestPlayer_CheckSpawnPosition(t *testing.T) {
+	player := newTestPlayer(BlockXyz{8, 70, 8})
+	player.chunkSubs.Init(player)
+	player.checkSpawnPosition()
+	if !player.placePending {
+		t.Fatalf("Expected the spawn position to be checked")
+	}
+
+	player.serveChunks()
+	if !player.spawnComplete {
+		t.Fatalf("Player not placed after the spawn position was checked")
+	}
+	checkPlacedAfterSpawnChunks(t, player.sentPackets(), isPositionLook, ChunkXz{0, 0})
+}
+
+func TestPlayer_NotifySpawnPosition(t *testing.T) {
+	player := newTestPlayer(BlockXyz{8, 70, 8})
+	player.chunkSubs.Init(player)
+	player.placePending = true
+	player.serveChunks()
+	if player.spawnComplete {
+		t.Fatalf("Player placed before the spawn position was checked")
+	}
+
+	player.notifySpawnPosition(&AbsXyz{8.5, 75, 8.5})
+	if !player.spawnComplete {
+		t.Fatalf("Player not placed after the spawn position was checked")
+	}
+	if expected := (AbsXyz{8.5, 75.01, 8.5}); player.position != expected {
+		t.Errorf("Expected player at %v, got %v", expected, player.position)
+	}
+}
@@ -0,0 +1,214 @@
+package player
+
+import (
+	"sync"
+
+	"chunkymonkey/clock"
+	"chunkymonkey/proto"
+)
+
+const (
+	// Queue depths (in packets) at which the degradation policy kicks in.
+	txLowPriorityLimit = 64   // Low priority packets are dropped beyond this.
+	txChunkPauseLimit  = 96   // New chunk subscriptions are paused beyond this.
+	txChunkResumeLimit = 32   // Paused chunk subscriptions resume below this.
+	txEssentialLimit   = 256  // Essential packets are still queued beyond this, but the queue is considered stalled.
+	txMaxDepth         = 1024 // Nothing more is queued beyond this, and the player is disconnected.
+
+	// txStallTimeoutNs is how long the queue may stay stalled before the
+	// player is disconnected.
+	txStallTimeoutNs = 1e9 * 30
+)
+
+// txPriority classifies outbound packets for the degradation policy applied
+// when a player isn't draining their outbound queue fast enough.
+type txPriority int
+
+const (
+	// txPriorityLow packets are dropped when the queue backs up. Their loss is
+	// corrected by later packets (e.g entity movement).
+	txPriorityLow = txPriority(iota)
+	// txPriorityChunk packets carry chunk data. They are never dropped once
+	// queued, but new chunk subscriptions are paused when the queue backs up.
+	txPriorityChunk
+	// txPriorityEssential packets are always queued.
+	txPriorityEssential
+)
+
+// packetPriority classifies a packet (or a buffer of concatenated packets of
+// the same kind) by its leading packet ID.
+func packetPriority(packet []byte) txPriority {
+	switch packet[0] {
+	case proto.PacketIdEntity,
+		proto.PacketIdEntityRelMove,
+		proto.PacketIdEntityLook,
+		proto.PacketIdEntityLookAndRelMove,
+		proto.PacketIdEntityTeleport,
+		proto.PacketIdEntityVelocity,
+		proto.PacketIdEntityAnimation,
+		proto.PacketIdSoundEffect,
+		proto.PacketIdExplosion:
+		return txPriorityLow
+	case proto.PacketIdPreChunk, proto.PacketIdMapChunk:
+		return txPriorityChunk
+	}
+	return txPriorityEssential
+}
+
+// TxQueueStats reports the state of a player's outbound packet queue.
+type TxQueueStats struct {
+	Depth         int   // Packets currently queued.
+	MaxDepth      int   // Largest depth seen.
+	Sent          int64 // Packets written to the connection.
+	Dropped       int64 // Packets dropped, being low priority or beyond txMaxDepth.
+	ChunksPaused  bool  // Whether new chunk subscriptions are paused.
+	StalledForSec int64 // Seconds the queue has been stalled, or 0.
+}
+
+// txQueue is a player's outbound packet queue. Pushing never blocks the
+// caller (typically a shard goroutine). Instead the queue degrades service to
+// a slow client: low priority packets are dropped first, then new chunk sends
+// are paused, and only if essential packets back up for txStallTimeoutNs, or
+// up to txMaxDepth, is the player considered lost.
+type txQueue struct {
+	clock        clock.Clock
+	lock         sync.Mutex
+	cond         sync.Cond
+	packets      [][]byte
+	closed       bool
+	chunksPaused bool
+	stalledSince int64 // Nanoseconds since epoch that the queue stalled, or 0.
+	stats        TxQueueStats
+
+	// resume receives a value when paused chunk subscriptions may resume.
+	resume chan bool
+}
+
+func (q *txQueue) Init(clk clock.Clock) {
+	q.clock = clk
+	q.cond.L = &q.lock
+	q.resume = make(chan bool, 1)
+}
+
+// push queues a packet according to its priority. It returns false if the
+// queue has been stalled for too long or is full, and the player should be
+// disconnected. Packets aren't queued once it is full.
+func (q *txQueue) push(packet []byte) (ok bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.closed {
+		return true
+	}
+
+	depth := len(q.packets)
+	priority := packetPriority(packet)
+
+	if priority == txPriorityLow && depth >= txLowPriorityLimit {
+		q.stats.Dropped++
+		return true
+	}
+
+	if depth >= txMaxDepth {
+		q.stats.Dropped++
+		return false
+	}
+
+	if depth >= txChunkPauseLimit {
+		q.chunksPaused = true
+	}
+
+	ok = true
+	if depth >= txEssentialLimit {
+		now := q.clock.Now().UnixNano()
+		if q.stalledSince == 0 {
+			q.stalledSince = now
+		} else if now-q.stalledSince > txStallTimeoutNs {
+			ok = false
+		}
+	}
+
+	q.packets = append(q.packets, packet)
+	if depth+1 > q.stats.MaxDepth {
+		q.stats.MaxDepth = depth + 1
+	}
+	q.cond.Signal()
+
+	return
+}
+
+// pop waits for and removes the next packet from the queue. ok=false is
+// returned when the queue has been closed.
+func (q *txQueue) pop() (packet []byte, ok bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for len(q.packets) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+
+	if len(q.packets) == 0 {
+		return nil, false
+	}
+
+	packet = q.packets[0]
+	q.packets[0] = nil
+	q.packets = q.packets[1:]
+	q.stats.Sent++
+
+	depth := len(q.packets)
+	if depth < txEssentialLimit {
+		q.stalledSince = 0
+	}
+	if q.chunksPaused && depth < txChunkResumeLimit {
+		q.chunksPaused = false
+		select {
+		case q.resume <- true:
+		default:
+		}
+	}
+
+	return packet, true
+}
+
+// close stops the queue, discarding any packets not yet sent.
+func (q *txQueue) close() {
+	q.closeAfter(nil)
+}
+
+// closeAfter stops the queue as close does, except that the given packet is
+// still sent before the queue reports that it is closed.
+func (q *txQueue) closeAfter(packet []byte) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.closed = true
+	q.packets = nil
+	if packet != nil {
+		q.packets = append(q.packets, packet)
+	}
+	q.cond.Broadcast()
+}
+
+// ChunksPaused returns true if new chunk subscriptions should be held back.
+func (q *txQueue) ChunksPaused() bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.chunksPaused
+}
+
+// Stats returns a snapshot of the queue statistics.
+func (q *txQueue) Stats() (stats TxQueueStats) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	stats = q.stats
+	stats.Depth = len(q.packets)
+	stats.ChunksPaused = q.chunksPaused
+	if q.stalledSince != 0 {
+		stats.StalledForSec = (q.clock.Now().UnixNano() - q.stalledSince) / 1e9
+	}
+
+	return
+}
@@ -0,0 +1,108 @@
+package player
+
+import (
+	"testing"
+
+	"chunkymonkey/clock"
+	"chunkymonkey/proto"
+)
+
+func TestTxQueue_DropsLowPriority(t *testing.T) {
+	var q txQueue
+	q.Init(clock.Real)
+
+	essential := []byte{proto.PacketIdChatMessage}
+	movement := []byte{proto.PacketIdEntityTeleport}
+
+	for i := 0; i < txLowPriorityLimit; i++ {
+		q.push(essential)
+	}
+
+	q.push(movement)
+	q.push(essential)
+
+	stats := q.Stats()
+	if stats.Dropped != 1 {
+		t.Errorf("Expected 1 dropped packet, got %d", stats.Dropped)
+	}
+	if stats.Depth != txLowPriorityLimit+1 {
+		t.Errorf("Expected depth %d, got %d", txLowPriorityLimit+1, stats.Depth)
+	}
+}
+
+func TestTxQueue_PausesAndResumesChunks(t *testing.T) {
+	var q txQueue
+	q.Init(clock.Real)
+
+	packet := []byte{proto.PacketIdMapChunk}
+	for i := 0; i <= txChunkPauseLimit; i++ {
+		q.push(packet)
+	}
+
+	if !q.ChunksPaused() {
+		t.Fatalf("Expected chunks to be paused at depth %d", q.Stats().Depth)
+	}
+
+	for q.Stats().Depth >= txChunkResumeLimit {
+		if _, ok := q.pop(); !ok {
+			t.Fatalf("pop failed")
+		}
+	}
+
+	if q.ChunksPaused() {
+		t.Errorf("Expected chunks to be resumed at depth %d", q.Stats().Depth)
+	}
+
+	select {
+	case <-q.resume:
+	default:
+		t.Errorf("Expected resume to be signalled")
+	}
+}
+
+func TestTxQueue_Full(t *testing.T) {
+	var q txQueue
+	q.Init(clock.Real)
+
+	packet := []byte{proto.PacketIdChatMessage}
+	for i := 0; i < txMaxDepth; i++ {
+		if !q.push(packet) {
+			t.Fatalf("Expected push %d to succeed", i)
+		}
+	}
+
+	if q.push(packet) {
+		t.Errorf("Expected push to fail on a full queue")
+	}
+	if depth := q.Stats().Depth; depth != txMaxDepth {
+		t.Errorf("Expected depth to stay at %d, got %d", txMaxDepth, depth)
+	}
+}
+
+func TestTxQueue_Close(t *testing.T) {
+	var q txQueue
+	q.Init(clock.Real)
+
+	q.push([]byte{proto.PacketIdChatMessage})
+	q.close()
+
+	if _, ok := q.pop(); ok {
+		t.Errorf("Expected pop to fail on closed queue")
+	}
+}
+
+func TestTxQueue_CloseAfter(t *testing.T) {
+	var q txQueue
+	q.Init(clock.Real)
+
+	q.push([]byte{proto.PacketIdChatMessage})
+	q.closeAfter([]byte{proto.PacketIdDisconnect})
+	q.push([]byte{proto.PacketIdChatMessage})
+
+	if packet, ok := q.pop(); !ok || packet[0] != proto.PacketIdDisconnect {
+		t.Errorf("Expected the final packet, got %v, %t", packet, ok)
+	}
+	if _, ok := q.pop(); ok {
+		t.Errorf("Expected pop to fail after the final packet")
+	}
+}
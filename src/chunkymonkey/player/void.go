@@ -0,0 +1,27 @@
+package player
+
+import (
+	"time"
+
+	. "chunkymonkey/types"
+)
+
+const (
+	// VoidDamage is the damage taken by a player below the bottom of the
+	// world, every VoidDamageInterval, until they die.
+	VoidDamage         = Health(4)
+	VoidDamageInterval = time.Second / 2
+)
+
+// checkVoid damages the player if they are below the bottom of the world and
+// haven't been damaged by the void recently.
+func (player *Player) checkVoid(now time.Time) {
+	if player.position.Y >= 0 || player.health <= 0 {
+		return
+	}
+	if now.Sub(player.lastVoidDamage) < VoidDamageInterval {
+		return
+	}
+	player.lastVoidDamage = now
+	player.damage(VoidDamage)
+}
@@ -0,0 +1,45 @@
+package player
+
+import (
+	"testing"
+	"time"
+
+	"chunkymonkey/proto"
+	. "chunkymonkey/types"
+)
+
+func TestPlayer_CheckVoid(t *testing.T) {
+	player := newTestPlayer(BlockXyz{8, 70, 8})
+	player.chunkSubs.Init(player)
+	player.serveChunks()
+	player.sentPackets()
+	now := time.Unix(1000, 0)
+
+	player.position.Y = 1
+	player.checkVoid(now)
+	if player.health != MaxHealth {
+		t.Fatalf("Player above the void took damage, health %d", player.health)
+	}
+
+	player.position.Y = -5
+	player.checkVoid(now)
+	if expected := MaxHealth - VoidDamage; player.health != expected {
+		t.Fatalf("Expected health %d after falling into the void, got %d", expected, player.health)
+	}
+
+	player.checkVoid(now.Add(VoidDamageInterval / 2))
+	if expected := MaxHealth - VoidDamage; player.health != expected {
+		t.Errorf("Expected no damage within the interval, health %d", player.health)
+	}
+
+	for i := 2; i < 10; i++ {
+		player.checkVoid(now.Add(time.Duration(i) * VoidDamageInterval))
+	}
+	if player.health != 0 {
+		t.Errorf("Expected player to die in the void, health %d", player.health)
+	}
+
+	if updates := countPackets(player.sentPackets(), proto.PacketIdUpdateHealth); updates != 5 {
+		t.Errorf("Expected 5 health updates sent, got %d", updates)
+	}
+}
@@ -0,0 +1,119 @@
+package proto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// maxByteArray16Length is the longest byte array accepted in the encryption
+// packets, which is ample for the keys and tokens that they carry.
+const maxByteArray16Length = 1024
+
+// Byte arrays prefixed with their 16-bit length.
+
+func readByteArray16(reader io.Reader) (bs []byte, err error) {
+	var length int16
+	if err = binary.Read(reader, binary.BigEndian, &length); err != nil {
+		return
+	}
+	if length < 0 || length > maxByteArray16Length {
+		err = fmt.Errorf("bad byte array length %d", length)
+		return
+	}
+
+	bs = make([]byte, length)
+	_, err = io.ReadFull(reader, bs)
+	return
+}
+
+func writeByteArray16(writer io.Writer, bs []byte) (err error) {
+	if len(bs) > maxByteArray16Length {
+		return fmt.Errorf("byte array of length %d is too long", len(bs))
+	}
+
+	if err = binary.Write(writer, binary.BigEndian, int16(len(bs))); err != nil {
+		return
+	}
+
+	_, err = writer.Write(bs)
+	return
+}
+
+// cfb8 is AES in 8-bit cipher feedback mode, as used for encrypted
+// connections. The standard library only has the full block size variant.
+type cfb8 struct {
+	block   cipher.Block
+	iv      []byte
+	tmp     []byte
+	decrypt bool
+}
+
+func newCFB8(block cipher.Block, iv []byte, decrypt bool) *cfb8 {
+	return &cfb8{
+		block:   block,
+		iv:      append([]byte(nil), iv...),
+		tmp:     make([]byte, block.BlockSize()),
+		decrypt: decrypt,
+	}
+}
+
+func (x *cfb8) XORKeyStream(dst, src []byte) {
+	for i, in := range src {
+		x.block.Encrypt(x.tmp, x.iv)
+		out := in ^ x.tmp[0]
+
+		// The ciphertext byte is shifted into the feedback register.
+		copy(x.iv, x.iv[1:])
+		if x.decrypt {
+			x.iv[len(x.iv)-1] = in
+		} else {
+			x.iv[len(x.iv)-1] = out
+		}
+		dst[i] = out
+	}
+}
+
+// encryptedConn encrypts everything written to, and decrypts everything read
+// from, the connection that it wraps.
+type encryptedConn struct {
+	net.Conn
+
+	readLock  sync.Mutex
+	reader    cipher.StreamReader
+	writeLock sync.Mutex
+	writer    cipher.StreamWriter
+}
+
+// WrapConn returns conn wrapped with AES/CFB8 encryption in both directions,
+// keyed by the shared secret as agreed with the encryption key packets. The
+// secret is also the initial vector. It must be called once the last
+// unencrypted packet has been read from and written to conn.
+func WrapConn(conn net.Conn, sharedSecret []byte) (wrapped net.Conn, err error) {
+	block, err := aes.NewCipher(sharedSecret)
+	if err != nil {
+		return
+	}
+
+	return &encryptedConn{
+		Conn:   conn,
+		reader: cipher.StreamReader{S: newCFB8(block, sharedSecret, true), R: conn},
+		writer: cipher.StreamWriter{S: newCFB8(block, sharedSecret, false), W: conn},
+	}, nil
+}
+
+func (conn *encryptedConn) Read(p []byte) (n int, err error) {
+	conn.readLock.Lock()
+	defer conn.readLock.Unlock()
+	return conn.reader.Read(p)
+}
+
+func (conn *encryptedConn) Write(p []byte) (n int, err error) {
+	conn.writeLock.Lock()
+	defer conn.writeLock.Unlock()
+	return conn.writer.Write(p)
+}
@@ -0,0 +1,77 @@
+package proto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/hex"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestCFB8(t *testing.T) {
+	// From NIST SP 800-38A, F.3.7 CFB8-AES128.Encrypt.
+	key, _ := hex.DecodeString("2b7e151628aed2a6abf7158809cf4f3c")
+	iv, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	plaintext, _ := hex.DecodeString("6bc1bee22e409f96e93d7e117393172aae2d")
+	ciphertext, _ := hex.DecodeString("3b79424c9c0dd436bace9e0ed4586a4f32b9")
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := make([]byte, len(plaintext))
+	newCFB8(block, iv, false).XORKeyStream(result, plaintext)
+	if !bytes.Equal(result, ciphertext) {
+		t.Errorf("Expected ciphertext %x, got %x", ciphertext, result)
+	}
+
+	// Decrypting in place, a byte at a time.
+	decrypter := newCFB8(block, iv, true)
+	for i := range result {
+		decrypter.XORKeyStream(result[i:i+1], result[i:i+1])
+	}
+	if !bytes.Equal(result, plaintext) {
+		t.Errorf("Expected plaintext %x, got %x", plaintext, result)
+	}
+}
+
+func TestWrapConn(t *testing.T) {
+	secret := []byte("0123456789abcdef")
+	message := []byte("hello, hello")
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	wrappedServer, err := WrapConn(server, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrappedClient, err := WrapConn(client, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each direction is decrypted by the other end.
+	for _, ends := range [][2]net.Conn{{wrappedServer, wrappedClient}, {wrappedClient, wrappedServer}} {
+		go ends[0].Write(message)
+		received := make([]byte, len(message))
+		if _, err = io.ReadFull(ends[1], received); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(received, message) {
+			t.Errorf("Expected %q, got %q", message, received)
+		}
+	}
+
+	// The message is encrypted on the wire.
+	go wrappedServer.Write(message)
+	onWire := make([]byte, len(message))
+	if _, err = io.ReadFull(client, onWire); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(onWire, message) {
+		t.Errorf("Expected the message to be encrypted on the wire")
+	}
+}
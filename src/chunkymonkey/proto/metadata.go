@@ -0,0 +1,131 @@
+package proto
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	. "chunkymonkey/types"
+)
+
+// Metadata holds the metadata of an entity, such as whether it is on fire or
+// the colour of a sheep's wool. It tracks which entries have changed, so that
+// metadata update packets need only contain those.
+type Metadata struct {
+	entries []EntityMetadata // In order of index.
+	dirty   uint32           // A bit for each index changed since ClearDirty.
+}
+
+// SetByte sets the entry at index to a byte value.
+func (m *Metadata) SetByte(index byte, value byte) {
+	m.set(EntityMetadataByte, index, value)
+}
+
+// SetShort sets the entry at index to a short value.
+func (m *Metadata) SetShort(index byte, value int16) {
+	m.set(EntityMetadataShort, index, value)
+}
+
+// SetInt sets the entry at index to an int value.
+func (m *Metadata) SetInt(index byte, value int32) {
+	m.set(EntityMetadataInt, index, value)
+}
+
+// SetFloat sets the entry at index to a float value.
+func (m *Metadata) SetFloat(index byte, value float32) {
+	m.set(EntityMetadataFloat, index, value)
+}
+
+// SetString sets the entry at index to a string value.
+func (m *Metadata) SetString(index byte, value string) {
+	m.set(EntityMetadataString, index, value)
+}
+
+// SetItemStack sets the entry at index to an item stack value.
+func (m *Metadata) SetItemStack(index byte, itemTypeId ItemTypeId, count ItemCount, data ItemData) {
+	m.set(EntityMetadataItemStack, index, MetadataItemStack{itemTypeId, count, data})
+}
+
+// SetPosition sets the entry at index to a position value.
+func (m *Metadata) SetPosition(index byte, x, y, z int32) {
+	m.set(EntityMetadataPosition, index, MetadataPosition{x, y, z})
+}
+
+// Byte returns the value of a byte entry. ok is false if there is no entry at
+// index, or it isn't a byte.
+func (m *Metadata) Byte(index byte) (value byte, ok bool) {
+	i := m.search(index)
+	if i < len(m.entries) && m.entries[i].Field2 == index {
+		value, ok = m.entries[i].Field3.(byte)
+	}
+	return
+}
+
+// Entries returns all of the entries, in order of index. The slice must not
+// be modified.
+func (m *Metadata) Entries() []EntityMetadata {
+	return m.entries
+}
+
+// IsDirty returns true if any entries have changed since ClearDirty.
+func (m *Metadata) IsDirty() bool {
+	return m.dirty != 0
+}
+
+// DirtyEntries returns the entries that have changed since ClearDirty, in
+// order of index.
+func (m *Metadata) DirtyEntries() (entries []EntityMetadata) {
+	for i := range m.entries {
+		if m.dirty&(1<<m.entries[i].Field2) != 0 {
+			entries = append(entries, m.entries[i])
+		}
+	}
+	return
+}
+
+// ClearDirty marks all entries as unchanged.
+func (m *Metadata) ClearDirty() {
+	m.dirty = 0
+}
+
+// WriteUpdate writes an entity metadata packet of the entries that have
+// changed, and marks them as unchanged. Nothing is written if none have
+// changed.
+func (m *Metadata) WriteUpdate(writer io.Writer, entityId EntityId) (err error) {
+	if !m.IsDirty() {
+		return
+	}
+	if err = WriteEntityMetadata(writer, entityId, m.DirtyEntries()); err != nil {
+		return
+	}
+	m.ClearDirty()
+	return
+}
+
+// search returns the position in entries of the entry at index, or where it
+// would be inserted.
+func (m *Metadata) search(index byte) int {
+	return sort.Search(len(m.entries), func(i int) bool {
+		return m.entries[i].Field2 >= index
+	})
+}
+
+func (m *Metadata) set(entryType byte, index byte, value interface{}) {
+	if index > EntityMetadataMaxIndex {
+		panic(fmt.Sprintf("entity metadata index %d out of range", index))
+	}
+
+	entry := EntityMetadata{entryType, index, value}
+	i := m.search(index)
+	if i < len(m.entries) && m.entries[i].Field2 == index {
+		if m.entries[i] == entry {
+			return
+		}
+		m.entries[i] = entry
+	} else {
+		m.entries = append(m.entries, EntityMetadata{})
+		copy(m.entries[i+1:], m.entries[i:])
+		m.entries[i] = entry
+	}
+	m.dirty |= 1 << index
+}
@@ -0,0 +1,113 @@
+package proto
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestMetadata_WriteEntityMetadata(t *testing.T) {
+	type Test struct {
+		desc     string
+		set      func(m *Metadata)
+		expected string
+	}
+
+	var tests = []Test{
+		{
+			"entity on fire",
+			func(m *Metadata) { m.SetByte(0, 0x01) },
+			"\x28\x00\x00\x00\x2a" + "\x00\x01" + "\x7f",
+		},
+		{
+			"sheared white sheep",
+			func(m *Metadata) {
+				m.SetByte(16, 0x10)
+				m.SetByte(0, 0x00)
+			},
+			"\x28\x00\x00\x00\x2a" + "\x00\x00" + "\x10\x10" + "\x7f",
+		},
+		{
+			"every type",
+			func(m *Metadata) {
+				m.SetPosition(31, 1, -2, 3)
+				m.SetItemStack(10, 276, 1, 5)
+				m.SetString(17, "Notch")
+				m.SetFloat(3, 1.5)
+				m.SetInt(2, -2)
+				m.SetShort(1, 300)
+				m.SetByte(0, 0xff)
+			},
+			"\x28\x00\x00\x00\x2a" +
+				"\x00\xff" + // byte 0
+				"\x21\x01\x2c" + // short 1
+				"\x42\xff\xff\xff\xfe" + // int 2
+				"\x63\x3f\xc0\x00\x00" + // float 3
+				"\xaa\x01\x14\x01\x00\x05" + // item stack 10
+				"\x91\x00\x05\x00N\x00o\x00t\x00c\x00h" + // string 17
+				"\xdf\x00\x00\x00\x01\xff\xff\xff\xfe\x00\x00\x00\x03" + // position 31
+				"\x7f",
+		},
+	}
+
+	for _, r := range tests {
+		var m Metadata
+		r.set(&m)
+
+		buf := new(bytes.Buffer)
+		if err := WriteEntityMetadata(buf, 42, m.Entries()); err != nil {
+			t.Errorf("%s: unexpected error: %v", r.desc, err)
+			continue
+		}
+		if result := buf.String(); result != r.expected {
+			t.Errorf("%s: expected % x\ngot      % x", r.desc, r.expected, result)
+		}
+
+		// The entries read back the same, after the packet ID and EntityId.
+		buf.Next(5)
+		data, err := readEntityMetadataField(buf)
+		if err != nil {
+			t.Errorf("%s: unexpected error reading back: %v", r.desc, err)
+		} else if !reflect.DeepEqual(data, m.Entries()) {
+			t.Errorf("%s: read back %+v, expected %+v", r.desc, data, m.Entries())
+		}
+	}
+}
+
+func TestMetadata_Dirty(t *testing.T) {
+	var m Metadata
+	m.SetByte(0, 0)
+	m.SetByte(16, 3)
+	m.ClearDirty()
+
+	buf := new(bytes.Buffer)
+	if err := m.WriteUpdate(buf, 42); err != nil || buf.Len() != 0 {
+		t.Fatalf("Expected nothing written when unchanged, got % x, %v", buf.Bytes(), err)
+	}
+
+	// Setting an entry to the same value doesn't change it.
+	m.SetByte(16, 3)
+	if m.IsDirty() {
+		t.Errorf("Expected unchanged after setting the same value")
+	}
+
+	m.SetByte(16, 4)
+	m.SetShort(18, 2)
+	if err := m.WriteUpdate(buf, 42); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "\x28\x00\x00\x00\x2a" + "\x10\x04" + "\x32\x00\x02" + "\x7f"
+	if result := buf.String(); result != expected {
+		t.Errorf("Expected update % x\ngot             % x", expected, result)
+	}
+	if m.IsDirty() {
+		t.Errorf("Expected unchanged after writing the update")
+	}
+
+	if value, ok := m.Byte(16); !ok || value != 4 {
+		t.Errorf("Expected Byte(16) = 4, true got %d, %t", value, ok)
+	}
+	if _, ok := m.Byte(18); ok {
+		t.Errorf("Expected Byte(18) of a short entry to fail")
+	}
+}
@@ -14,75 +14,82 @@ import (
 )
 
 const (
-	// Currently only this protocol version is supported.
-	protocolVersion = 17
+	// Clients may log in with protocol versions from MinProtocolVersion to
+	// MaxProtocolVersion. Currently only one version is supported.
+	MinProtocolVersion = 17
+	MaxProtocolVersion = 17
+
+	// protocolVersion is the version that the client side writes.
+	protocolVersion = MaxProtocolVersion
 
 	maxUcs2Char  = 0xffff
 	ucs2ReplChar = 0xfffd
 
 	// Packet type IDs
-	PacketIdKeepAlive            = 0x00
-	PacketIdLogin                = 0x01
-	PacketIdHandshake            = 0x02
-	PacketIdChatMessage          = 0x03
-	PacketIdTimeUpdate           = 0x04
-	PacketIdEntityEquipment      = 0x05
-	PacketIdSpawnPosition        = 0x06
-	PacketIdUseEntity            = 0x07
-	PacketIdUpdateHealth         = 0x08
-	PacketIdRespawn              = 0x09
-	PacketIdPlayer               = 0x0a
-	PacketIdPlayerPosition       = 0x0b
-	PacketIdPlayerLook           = 0x0c
-	PacketIdPlayerPositionLook   = 0x0d
-	PacketIdPlayerBlockHit       = 0x0e
-	PacketIdPlayerBlockInteract  = 0x0f
-	PacketIdHoldingChange        = 0x10
-	PacketIdBedUse               = 0x11
-	PacketIdEntityAnimation      = 0x12
-	PacketIdEntityAction         = 0x13
-	PacketIdNamedEntitySpawn     = 0x14
-	PacketIdItemSpawn            = 0x15
-	PacketIdItemCollect          = 0x16
-	PacketIdObjectSpawn          = 0x17
-	PacketIdEntitySpawn          = 0x18
-	PacketIdPaintingSpawn        = 0x19
-	PacketIdExperienceOrb        = 0x1a
-	PacketIdEntityVelocity       = 0x1c
-	PacketIdEntityDestroy        = 0x1d
-	PacketIdEntity               = 0x1e
-	PacketIdEntityRelMove        = 0x1f
-	PacketIdEntityLook           = 0x20
-	PacketIdEntityLookAndRelMove = 0x21
-	PacketIdEntityTeleport       = 0x22
-	PacketIdEntityStatus         = 0x26
-	PacketIdEntityMetadata       = 0x28
-	PacketIdEntityEffect         = 0x29
-	PacketIdEntityRemoveEffect   = 0x2a
-	PacketIdPlayerExperience     = 0x2b
-	PacketIdPreChunk             = 0x32
-	PacketIdMapChunk             = 0x33
-	PacketIdBlockChangeMulti     = 0x34
-	PacketIdBlockChange          = 0x35
-	PacketIdNoteBlockPlay        = 0x36
-	PacketIdExplosion            = 0x3c
-	PacketIdSoundEffect          = 0x3d
-	PacketIdState                = 0x46
-	PacketIdWeather              = 0x47
-	PacketIdWindowOpen           = 0x64
-	PacketIdWindowClose          = 0x65
-	PacketIdWindowClick          = 0x66
-	PacketIdWindowSetSlot        = 0x67
-	PacketIdWindowItems          = 0x68
-	PacketIdWindowProgressBar    = 0x69
-	PacketIdWindowTransaction    = 0x6a
-	PacketIdQuickbarSlotUpdate   = 0x6b
-	PacketIdSignUpdate           = 0x82
-	PacketIdItemData             = 0x83
-	PacketIdIncrementStatistic   = 0xc8
-	PacketIdUserListItem         = 0xc9
-	PacketIdServerListPing       = 0xfe
-	PacketIdDisconnect           = 0xff
+	PacketIdKeepAlive             = 0x00
+	PacketIdLogin                 = 0x01
+	PacketIdHandshake             = 0x02
+	PacketIdChatMessage           = 0x03
+	PacketIdTimeUpdate            = 0x04
+	PacketIdEntityEquipment       = 0x05
+	PacketIdSpawnPosition         = 0x06
+	PacketIdUseEntity             = 0x07
+	PacketIdUpdateHealth          = 0x08
+	PacketIdRespawn               = 0x09
+	PacketIdPlayer                = 0x0a
+	PacketIdPlayerPosition        = 0x0b
+	PacketIdPlayerLook            = 0x0c
+	PacketIdPlayerPositionLook    = 0x0d
+	PacketIdPlayerBlockHit        = 0x0e
+	PacketIdPlayerBlockInteract   = 0x0f
+	PacketIdHoldingChange         = 0x10
+	PacketIdBedUse                = 0x11
+	PacketIdEntityAnimation       = 0x12
+	PacketIdEntityAction          = 0x13
+	PacketIdNamedEntitySpawn      = 0x14
+	PacketIdItemSpawn             = 0x15
+	PacketIdItemCollect           = 0x16
+	PacketIdObjectSpawn           = 0x17
+	PacketIdEntitySpawn           = 0x18
+	PacketIdPaintingSpawn         = 0x19
+	PacketIdExperienceOrb         = 0x1a
+	PacketIdEntityVelocity        = 0x1c
+	PacketIdEntityDestroy         = 0x1d
+	PacketIdEntity                = 0x1e
+	PacketIdEntityRelMove         = 0x1f
+	PacketIdEntityLook            = 0x20
+	PacketIdEntityLookAndRelMove  = 0x21
+	PacketIdEntityTeleport        = 0x22
+	PacketIdEntityStatus          = 0x26
+	PacketIdEntityMetadata        = 0x28
+	PacketIdEntityEffect          = 0x29
+	PacketIdEntityRemoveEffect    = 0x2a
+	PacketIdPlayerExperience      = 0x2b
+	PacketIdPreChunk              = 0x32
+	PacketIdMapChunk              = 0x33
+	PacketIdBlockChangeMulti      = 0x34
+	PacketIdBlockChange           = 0x35
+	PacketIdNoteBlockPlay         = 0x36
+	PacketIdExplosion             = 0x3c
+	PacketIdSoundEffect           = 0x3d
+	PacketIdState                 = 0x46
+	PacketIdWeather               = 0x47
+	PacketIdWindowOpen            = 0x64
+	PacketIdWindowClose           = 0x65
+	PacketIdWindowClick           = 0x66
+	PacketIdWindowSetSlot         = 0x67
+	PacketIdWindowItems           = 0x68
+	PacketIdWindowProgressBar     = 0x69
+	PacketIdWindowTransaction     = 0x6a
+	PacketIdQuickbarSlotUpdate    = 0x6b
+	PacketIdSignUpdate            = 0x82
+	PacketIdItemData              = 0x83
+	PacketIdIncrementStatistic    = 0xc8
+	PacketIdUserListItem          = 0xc9
+	PacketIdEncryptionKeyResponse = 0xfc
+	PacketIdEncryptionKeyRequest  = 0xfd
+	PacketIdServerListPing        = 0xfe
+	PacketIdDisconnect            = 0xff
 )
 
 type UnexpectedPacketIdError byte
@@ -91,6 +98,20 @@ func (err UnexpectedPacketIdError) Error() string {
 	return fmt.Sprintf("unexpected packet ID: 0x%02x", byte(err))
 }
 
+// ProtocolVersionError is the error reading a login from a client whose
+// protocol version is not supported.
+type ProtocolVersionError int32
+
+func (err ProtocolVersionError) Error() string {
+	return fmt.Sprintf("serverLogin: unsupported protocol version %d", int32(err))
+}
+
+// ClientOutdated is true if the client is older than the server supports,
+// rather than newer.
+func (err ProtocolVersionError) ClientOutdated() bool {
+	return err < MinProtocolVersion
+}
+
 type UnknownPacketIdError byte
 
 func (err UnknownPacketIdError) Error() string {
@@ -119,6 +140,7 @@ type IPacketHandler interface {
 	PacketEntityAnimation(entityId EntityId, animation EntityAnimation)
 	PacketWindowTransaction(windowId WindowId, txId TxId, accepted bool)
 	PacketSignUpdate(position *BlockXyz, lines [4]string)
+	PacketEncryptionKeyResponse(sharedSecret, verifyToken []byte)
 	PacketDisconnect(reason string)
 }
 
@@ -184,6 +206,7 @@ type IClientPacketHandler interface {
 	PacketItemData(itemTypeId ItemTypeId, itemDataId ItemData, data []byte)
 	PacketIncrementStatistic(statisticId StatisticId, delta int8)
 	PacketUserListItem(username string, unknown bool, ping int16)
+	PacketEncryptionKeyRequest(serverId string, publicKey, verifyToken []byte)
 }
 
 // Common protocol helper functions
@@ -267,42 +290,71 @@ type WindowSlot struct {
 	Data       ItemData
 }
 
+// EntityMetadata is a single entry of entity metadata. Field1 is the type of
+// the value (one of the EntityMetadata* constants), Field2 is the index of the
+// entry, and Field3 is the value.
 type EntityMetadata struct {
 	Field1 byte
 	Field2 byte
 	Field3 interface{}
 }
 
+// Types of entity metadata values, and the Go types of their values.
+const (
+	EntityMetadataByte      = byte(0) // byte
+	EntityMetadataShort     = byte(1) // int16
+	EntityMetadataInt       = byte(2) // int32
+	EntityMetadataFloat     = byte(3) // float32
+	EntityMetadataString    = byte(4) // string
+	EntityMetadataItemStack = byte(5) // MetadataItemStack
+	EntityMetadataPosition  = byte(6) // MetadataPosition
+
+	// EntityMetadataMaxIndex is the largest index that an entry may have.
+	EntityMetadataMaxIndex = 0x1f
+
+	entityMetadataEnd = byte(0x7f)
+)
+
+// MetadataItemStack is the value of an EntityMetadataItemStack entry.
+type MetadataItemStack struct {
+	ItemTypeId ItemTypeId
+	Count      ItemCount
+	Data       ItemData
+}
+
+// MetadataPosition is the value of an EntityMetadataPosition entry.
+type MetadataPosition struct {
+	X, Y, Z int32
+}
+
 func writeEntityMetadataField(writer io.Writer, data []EntityMetadata) (err error) {
 	// NOTE that no checking is done upon the form of the data, so it's
 	// possible to form bad data packets with this.
 	var entryType byte
 
 	for _, item := range data {
+		// The type is packed into the top 3 bits, and the index into the rest.
 		entryType = (item.Field1 << 5) & 0xe0
-		entryType |= (item.Field2 & 0x1f)
+		entryType |= (item.Field2 & EntityMetadataMaxIndex)
 
 		if err = binary.Write(writer, binary.BigEndian, entryType); err != nil {
 			return
 		}
 		switch item.Field1 {
-		case 0:
+		case EntityMetadataByte:
 			err = binary.Write(writer, binary.BigEndian, item.Field3.(byte))
-		case 1:
+		case EntityMetadataShort:
 			err = binary.Write(writer, binary.BigEndian, item.Field3.(int16))
-		case 2:
+		case EntityMetadataInt:
 			err = binary.Write(writer, binary.BigEndian, item.Field3.(int32))
-		case 3:
+		case EntityMetadataFloat:
 			err = binary.Write(writer, binary.BigEndian, item.Field3.(float32))
-		case 4:
+		case EntityMetadataString:
 			err = writeString16(writer, item.Field3.(string))
-		case 5:
-			type position struct {
-				X int16
-				Y byte
-				Z int16
-			}
-			err = binary.Write(writer, binary.BigEndian, item.Field3.(position))
+		case EntityMetadataItemStack:
+			err = binary.Write(writer, binary.BigEndian, item.Field3.(MetadataItemStack))
+		case EntityMetadataPosition:
+			err = binary.Write(writer, binary.BigEndian, item.Field3.(MetadataPosition))
 		}
 		if err != nil {
 			return
@@ -310,7 +362,7 @@ func writeEntityMetadataField(writer io.Writer, data []EntityMetadata) (err erro
 	}
 
 	// Mark end of metadata
-	return binary.Write(writer, binary.BigEndian, byte(127))
+	return binary.Write(writer, binary.BigEndian, entityMetadataEnd)
 }
 
 // Reads entity metadata from the end of certain packets. Most of the meaning
@@ -327,40 +379,43 @@ func readEntityMetadataField(reader io.Reader) (data []EntityMetadata, err error
 		if err != nil {
 			return
 		}
-		if entryType == 127 {
+		if entryType == entityMetadataEnd {
 			break
 		}
-		field2 = entryType & 0x1f
+		field1 = (entryType & 0xe0) >> 5
+		field2 = entryType & EntityMetadataMaxIndex
 
-		switch field1 := (entryType & 0xe0) >> 5; field1 {
-		case 0:
+		switch field1 {
+		case EntityMetadataByte:
 			var byteVal byte
 			err = binary.Read(reader, binary.BigEndian, &byteVal)
 			field3 = byteVal
-		case 1:
+		case EntityMetadataShort:
 			var int16Val int16
 			err = binary.Read(reader, binary.BigEndian, &int16Val)
 			field3 = int16Val
-		case 2:
+		case EntityMetadataInt:
 			var int32Val int32
 			err = binary.Read(reader, binary.BigEndian, &int32Val)
 			field3 = int32Val
-		case 3:
+		case EntityMetadataFloat:
 			var floatVal float32
 			err = binary.Read(reader, binary.BigEndian, &floatVal)
 			field3 = floatVal
-		case 4:
+		case EntityMetadataString:
 			var stringVal string
 			stringVal, err = readString16(reader)
 			field3 = stringVal
-		case 5:
-			var position struct {
-				X int16
-				Y byte
-				Z int16
-			}
+		case EntityMetadataItemStack:
+			var itemStack MetadataItemStack
+			err = binary.Read(reader, binary.BigEndian, &itemStack)
+			field3 = itemStack
+		case EntityMetadataPosition:
+			var position MetadataPosition
 			err = binary.Read(reader, binary.BigEndian, &position)
 			field3 = position
+		default:
+			return data, fmt.Errorf("unknown entity metadata type %d", field1)
 		}
 
 		data = append(data, EntityMetadata{field1, field2, field3})
@@ -439,11 +494,17 @@ func ServerWriteLogin(writer io.Writer, entityId EntityId, mapSeed RandomSeed, s
 }
 
 func ClientWriteLogin(writer io.Writer, username, password string) (err error) {
+	return ClientWriteLoginVersion(writer, protocolVersion, username, password)
+}
+
+// ClientWriteLoginVersion writes a login claiming the given protocol version,
+// for testing clients that the server doesn't support.
+func ClientWriteLoginVersion(writer io.Writer, version int32, username, password string) (err error) {
 	if err = binary.Write(writer, binary.BigEndian, byte(PacketIdLogin)); err != nil {
 		return
 	}
 
-	return commonWriteLogin(writer, protocolVersion, username, 0, 0, 0, 0, 0, 0)
+	return commonWriteLogin(writer, version, username, 0, 0, 0, 0, 0, 0)
 }
 
 func commonReadLogin(reader io.Reader) (versionOrEntityId int32, str string, mapSeed RandomSeed, serverMode int32, dimension DimensionId, unknown int8, worldHeight, maxPlayers byte, err error) {
@@ -482,8 +543,8 @@ func serverReadLogin(reader io.Reader, handler IServerPacketHandler) (err error)
 		return
 	}
 
-	if version != protocolVersion {
-		err = fmt.Errorf("serverLogin: unsupported protocol version %#x", version)
+	if version < MinProtocolVersion || version > MaxProtocolVersion {
+		err = ProtocolVersionError(version)
 		return
 	}
 
@@ -513,6 +574,14 @@ func ServerWriteHandshake(writer io.Writer, reply string) (err error) {
 	return writeString16(writer, reply)
 }
 
+func ClientWriteHandshake(writer io.Writer, username string) (err error) {
+	if err = binary.Write(writer, binary.BigEndian, byte(PacketIdHandshake)); err != nil {
+		return
+	}
+
+	return writeString16(writer, username)
+}
+
 func serverReadHandshake(reader io.Reader, handler IServerPacketHandler) (err error) {
 	var username string
 	if username, err = readString16(reader); err != nil {
@@ -2057,20 +2126,44 @@ func readPreChunk(reader io.Reader, handler IClientPacketHandler) (err error) {
 
 // PacketIdMapChunk
 
+// mapChunkHeaderSize is the size in bytes of the PacketIdMapChunk header
+// that precedes the compressed chunk data.
+const mapChunkHeaderSize = 18
+
 func WriteMapChunk(writer io.Writer, chunkLoc *ChunkXz, blocks, blockData, blockLight, skyLight []byte) (err error) {
-	buf := &bytes.Buffer{}
-	compressed := zlib.NewWriter(buf)
+	packet, err := MapChunkPacket(chunkLoc, blocks, blockData, blockLight, skyLight)
+	if err != nil {
+		return
+	}
+	_, err = writer.Write(packet)
+	return
+}
+
+// MapChunkPacket produces a complete PacketIdMapChunk packet. The chunk data
+// is compressed directly into the returned slice after space reserved for the
+// packet header, so the payload is not copied again after compression. The
+// result is intended to be treated as immutable so that it can be shared
+// between all recipients of the chunk.
+func MapChunkPacket(chunkLoc *ChunkXz, blocks, blockData, blockLight, skyLight []byte) (packet []byte, err error) {
+	rawSize := len(blocks) + len(blockData) + len(blockLight) + len(skyLight)
+	// Reserve room for the packet header at the start. Chunk data typically
+	// compresses well, so a quarter of the raw size is a reasonable guess.
+	buf := bytes.NewBuffer(make([]byte, mapChunkHeaderSize, mapChunkHeaderSize+rawSize/4))
 
-	compressed.Write(blocks)
-	compressed.Write(blockData)
-	compressed.Write(blockLight)
-	compressed.Write(skyLight)
-	compressed.Close()
-	bs := buf.Bytes()
+	compressed := zlib.NewWriter(buf)
+	for _, data := range [][]byte{blocks, blockData, blockLight, skyLight} {
+		if _, err = compressed.Write(data); err != nil {
+			return
+		}
+	}
+	if err = compressed.Close(); err != nil {
+		return
+	}
+	packet = buf.Bytes()
 
 	chunkCornerLoc := chunkLoc.ChunkCornerBlockXY()
 
-	var packet = struct {
+	var header = struct {
 		PacketId         byte
 		X                BlockCoord
 		Y                int16
@@ -2087,15 +2180,16 @@ func WriteMapChunk(writer io.Writer, chunkLoc *ChunkXz, blocks, blockData, block
 		ChunkSizeH - 1,
 		ChunkSizeY - 1,
 		ChunkSizeH - 1,
-		int32(len(bs)),
+		int32(len(packet) - mapChunkHeaderSize),
 	}
 
-	err = binary.Write(writer, binary.BigEndian, &packet)
-	if err != nil {
-		return
+	// Fill in the header in the reserved space.
+	buf = bytes.NewBuffer(packet[:0])
+	if err = binary.Write(buf, binary.BigEndian, &header); err != nil {
+		return nil, err
 	}
-	err = binary.Write(writer, binary.BigEndian, bs)
-	return
+
+	return packet, nil
 }
 
 func readMapChunk(reader io.Reader, handler IClientPacketHandler) (err error) {
@@ -2152,13 +2246,19 @@ func WriteBlockChangeMulti(writer io.Writer, chunkLoc *ChunkXz, blockCoords []Su
 	rawBlockLocs := make([]int16, packet.Count)
 	for index, blockCoord := range blockCoords {
 		rawBlockCoord := int16(0)
-		rawBlockCoord |= int16((blockCoord.X & 0x0f) << 12)
-		rawBlockCoord |= int16((blockCoord.Y & 0xff))
-		rawBlockCoord |= int16((blockCoord.Z & 0x0f) << 8)
+		rawBlockCoord |= int16(blockCoord.X&0x0f) << 12
+		rawBlockCoord |= int16(blockCoord.Y & 0xff)
+		rawBlockCoord |= int16(blockCoord.Z&0x0f) << 8
 		rawBlockLocs[index] = rawBlockCoord
 	}
 
-	binary.Write(writer, binary.BigEndian, rawBlockLocs)
+	if err = binary.Write(writer, binary.BigEndian, rawBlockLocs); err != nil {
+		return
+	}
+	if err = binary.Write(writer, binary.BigEndian, blockTypes); err != nil {
+		return
+	}
+	err = binary.Write(writer, binary.BigEndian, blockMetaData)
 
 	return
 }
@@ -2186,7 +2286,7 @@ func readBlockChangeMulti(reader io.Reader, handler IClientPacketHandler) (err e
 	blockLocs := make([]SubChunkXyz, packet.Count)
 	for index, rawLoc := range rawBlockLocs {
 		blockLocs[index] = SubChunkXyz{
-			X: SubChunkCoord(rawLoc >> 12),
+			X: SubChunkCoord((rawLoc >> 12) & 0x0f),
 			Y: SubChunkCoord(rawLoc & 0xff),
 			Z: SubChunkCoord((rawLoc >> 8) & 0x0f),
 		}
@@ -3050,6 +3150,77 @@ func readUserListItem(reader io.Reader, handler IClientPacketHandler) (err error
 	return
 }
 
+// PacketIdEncryptionKeyResponse
+
+// WriteEncryptionKeyResponse writes the client's shared secret and verify
+// token, each encrypted with the server's public key. The server replies with
+// both empty once it has accepted them.
+func WriteEncryptionKeyResponse(writer io.Writer, sharedSecret, verifyToken []byte) (err error) {
+	if err = binary.Write(writer, binary.BigEndian, byte(PacketIdEncryptionKeyResponse)); err != nil {
+		return
+	}
+
+	if err = writeByteArray16(writer, sharedSecret); err != nil {
+		return
+	}
+
+	return writeByteArray16(writer, verifyToken)
+}
+
+func readEncryptionKeyResponse(reader io.Reader, handler IPacketHandler) (err error) {
+	var sharedSecret, verifyToken []byte
+	if sharedSecret, err = readByteArray16(reader); err != nil {
+		return
+	}
+	if verifyToken, err = readByteArray16(reader); err != nil {
+		return
+	}
+
+	handler.PacketEncryptionKeyResponse(sharedSecret, verifyToken)
+
+	return
+}
+
+// PacketIdEncryptionKeyRequest
+
+// ServerWriteEncryptionKeyRequest writes the server's id, its public key
+// (ASN.1 DER encoded) and a verify token, which the client returns encrypted
+// with the key.
+func ServerWriteEncryptionKeyRequest(writer io.Writer, serverId string, publicKey, verifyToken []byte) (err error) {
+	if err = binary.Write(writer, binary.BigEndian, byte(PacketIdEncryptionKeyRequest)); err != nil {
+		return
+	}
+
+	if err = writeString16(writer, serverId); err != nil {
+		return
+	}
+
+	if err = writeByteArray16(writer, publicKey); err != nil {
+		return
+	}
+
+	return writeByteArray16(writer, verifyToken)
+}
+
+func clientReadEncryptionKeyRequest(reader io.Reader, handler IClientPacketHandler) (err error) {
+	var serverId string
+	if serverId, err = readString16(reader); err != nil {
+		return
+	}
+
+	var publicKey, verifyToken []byte
+	if publicKey, err = readByteArray16(reader); err != nil {
+		return
+	}
+	if verifyToken, err = readByteArray16(reader); err != nil {
+		return
+	}
+
+	handler.PacketEncryptionKeyRequest(serverId, publicKey, verifyToken)
+
+	return
+}
+
 // PacketIdServerListPing
 
 func WriteServerListPing(writer io.Writer) (err error) {
@@ -3093,19 +3264,20 @@ type clientPacketReaderMap map[byte]clientPacketHandler
 
 // Common packet mapping
 var commonReadFns = commonPacketReaderMap{
-	PacketIdKeepAlive:           readKeepAlive,
-	PacketIdChatMessage:         readChatMessage,
-	PacketIdEntityAction:        readEntityAction,
-	PacketIdUseEntity:           readUseEntity,
-	PacketIdRespawn:             readRespawn,
-	PacketIdPlayerPosition:      readPlayerPosition,
-	PacketIdPlayerLook:          readPlayerLook,
-	PacketIdPlayerBlockHit:      readPlayerBlockHit,
-	PacketIdPlayerBlockInteract: readPlayerBlockInteract,
-	PacketIdEntityAnimation:     readEntityAnimation,
-	PacketIdWindowTransaction:   readWindowTransaction,
-	PacketIdSignUpdate:          readSignUpdate,
-	PacketIdDisconnect:          readDisconnect,
+	PacketIdKeepAlive:             readKeepAlive,
+	PacketIdChatMessage:           readChatMessage,
+	PacketIdEntityAction:          readEntityAction,
+	PacketIdUseEntity:             readUseEntity,
+	PacketIdRespawn:               readRespawn,
+	PacketIdPlayerPosition:        readPlayerPosition,
+	PacketIdPlayerLook:            readPlayerLook,
+	PacketIdPlayerBlockHit:        readPlayerBlockHit,
+	PacketIdPlayerBlockInteract:   readPlayerBlockInteract,
+	PacketIdEntityAnimation:       readEntityAnimation,
+	PacketIdWindowTransaction:     readWindowTransaction,
+	PacketIdSignUpdate:            readSignUpdate,
+	PacketIdEncryptionKeyResponse: readEncryptionKeyResponse,
+	PacketIdDisconnect:            readDisconnect,
 }
 
 // Client->server specific packet mapping
@@ -3165,6 +3337,8 @@ var clientReadFns = clientPacketReaderMap{
 	PacketIdQuickbarSlotUpdate:   readQuickbarSlotUpdate,
 	PacketIdItemData:             readItemData,
 	PacketIdIncrementStatistic:   readIncrementStatistic,
+	PacketIdUserListItem:         readUserListItem,
+	PacketIdEncryptionKeyRequest: clientReadEncryptionKeyRequest,
 }
 
 func readPacketId(reader io.Reader) (packetId byte, err error) {
@@ -1,7 +1,13 @@
 package proto
 
 import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io/ioutil"
 	"testing"
+
+	. "chunkymonkey/types"
 )
 
 type NullWriter struct{}
@@ -38,3 +44,74 @@ func TestWriteChatMessage(t *testing.T) {
 		t.Errorf("correctColorTagMsg shouldn't generate any errors: %s", err)
 	}
 }
+
+func TestMapChunkPacket(t *testing.T) {
+	chunkLoc := ChunkXz{X: -2, Z: 3}
+	blocks := bytes.Repeat([]byte{1}, ChunkSizeH*ChunkSizeH*ChunkSizeY)
+	nibbles := bytes.Repeat([]byte{0xf0}, len(blocks)>>1)
+
+	packet, err := MapChunkPacket(&chunkLoc, blocks, nibbles, nibbles, nibbles)
+	if err != nil {
+		t.Fatalf("MapChunkPacket returned error: %v", err)
+	}
+
+	var header struct {
+		PacketId         byte
+		X                BlockCoord
+		Y                int16
+		Z                BlockCoord
+		SizeX            SubChunkSizeCoord
+		SizeY            SubChunkSizeCoord
+		SizeZ            SubChunkSizeCoord
+		CompressedLength int32
+	}
+	reader := bytes.NewReader(packet)
+	if err = binary.Read(reader, binary.BigEndian, &header); err != nil {
+		t.Fatalf("Failed to read header: %v", err)
+	}
+
+	if header.PacketId != PacketIdMapChunk || header.X != -32 || header.Z != 48 {
+		t.Errorf("Unexpected header: %+v", header)
+	}
+	if int(header.CompressedLength) != reader.Len() {
+		t.Errorf("Expected compressed length %d, got %d", reader.Len(), header.CompressedLength)
+	}
+
+	zlibReader, err := zlib.NewReader(reader)
+	if err != nil {
+		t.Fatalf("Failed to open compressed data: %v", err)
+	}
+	data, err := ioutil.ReadAll(zlibReader)
+	if err != nil {
+		t.Fatalf("Failed to decompress data: %v", err)
+	}
+
+	expected := bytes.Join([][]byte{blocks, nibbles, nibbles, nibbles}, nil)
+	if !bytes.Equal(expected, data) {
+		t.Errorf("Decompressed chunk data did not match input")
+	}
+}
+
+func TestWriteBlockChangeMulti(t *testing.T) {
+	buf := new(bytes.Buffer)
+	err := WriteBlockChangeMulti(buf, &ChunkXz{X: -1, Z: 2},
+		[]SubChunkXyz{{X: 1, Y: 64, Z: 15}, {X: 15, Y: 0, Z: 0}},
+		[]BlockId{1, 54},
+		[]byte{0, 3})
+	if err != nil {
+		t.Fatalf("WriteBlockChangeMulti returned error: %v", err)
+	}
+
+	expected := []byte{
+		PacketIdBlockChangeMulti,
+		0xff, 0xff, 0xff, 0xff, // chunk X
+		0, 0, 0, 2, // chunk Z
+		0, 2, // count
+		0x1f, 64, 0xf0, 0, // coordinates
+		1, 54, // block types
+		0, 3, // block data
+	}
+	if !bytes.Equal(expected, buf.Bytes()) {
+		t.Errorf("expected % x, got % x", expected, buf.Bytes())
+	}
+}
@@ -0,0 +1,246 @@
+package proto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ProtocolVersionName is the name of the client release that speaks
+// MaxProtocolVersion, as shown to newer clients in the server list.
+const ProtocolVersionName = "Beta 1.8"
+
+// maxStatusPacketLength is the longest packet accepted in the status query
+// of newer clients.
+const maxStatusPacketLength = 1 << 12
+
+const (
+	statusPacketIdHandshake = 0x00 // Also the request, and the response.
+	statusPacketIdPing      = 0x01 // Also the pong.
+
+	statusNextStateStatus = 1
+)
+
+var errStatusNotQuery = errors.New("newer client handshake is not a status query")
+
+// ServerListStatus is what a client's multiplayer screen shows about the
+// server.
+type ServerListStatus struct {
+	Motd        string
+	PlayerCount int
+	MaxPlayers  int
+}
+
+// legacy returns the status in the form that older clients read from a
+// disconnect packet. The fields are separated by '§', so it is removed from
+// the MOTD.
+func (status *ServerListStatus) legacy() string {
+	return strings.Replace(status.Motd, "§", "", -1) +
+		"§" + strconv.Itoa(status.PlayerCount) +
+		"§" + strconv.Itoa(status.MaxPlayers)
+}
+
+// JSON returns the status document of newer clients' status queries.
+func (status *ServerListStatus) JSON() ([]byte, error) {
+	type version struct {
+		Name     string `json:"name"`
+		Protocol int    `json:"protocol"`
+	}
+	type players struct {
+		Max    int `json:"max"`
+		Online int `json:"online"`
+	}
+	type description struct {
+		Text string `json:"text"`
+	}
+
+	return json.Marshal(struct {
+		Version     version     `json:"version"`
+		Players     players     `json:"players"`
+		Description description `json:"description"`
+	}{
+		version{ProtocolVersionName, MaxProtocolVersion},
+		players{status.MaxPlayers, status.PlayerCount},
+		description{status.Motd},
+	})
+}
+
+// WriteServerListStatus answers a PacketIdServerListPing with the status. The
+// client expects the connection to be closed afterwards.
+func WriteServerListStatus(writer io.Writer, status *ServerListStatus) error {
+	return WriteDisconnect(writer, status.legacy())
+}
+
+// StatusHandshakePrefixLength is the number of bytes that IsStatusHandshake
+// needs to tell the handshake of a newer client apart.
+const StatusHandshakePrefixLength = 2
+
+// minStatusHandshakeLength is the length of the shortest handshake of a newer
+// client: the packet ID, a one byte protocol version, an empty server address,
+// the port and the next state.
+const minStatusHandshakeLength = 6
+
+// IsStatusHandshake is true if prefix, the first StatusHandshakePrefixLength
+// bytes sent by a client, begins the handshake of a newer client. Its packet
+// length must fit in a single byte, which it does for any reasonable server
+// address, and be followed by the handshake packet ID. Anything else is not
+// spoken by any client.
+func IsStatusHandshake(prefix []byte) bool {
+	if len(prefix) < StatusHandshakePrefixLength {
+		return false
+	}
+	length := prefix[0]
+	return length >= minStatusHandshakeLength && length&0x80 == 0 &&
+		prefix[1] == statusPacketIdHandshake
+}
+
+// ServerAnswerStatusQuery answers the status query of a newer client, whose
+// handshake began with prefix, with the status. Such clients then show the
+// server as incompatible, but with its MOTD and player counts. The client's
+// ping is answered if it sends one.
+func ServerAnswerStatusQuery(rw io.ReadWriter, prefix []byte, status *ServerListStatus) (err error) {
+	handshake, err := readStatusPacket(io.MultiReader(bytes.NewReader(prefix), rw), statusPacketIdHandshake)
+	if err != nil {
+		return
+	}
+	// The protocol version, server address and port come before the state
+	// that the client wants.
+	if _, err = readVarInt(handshake); err != nil {
+		return
+	}
+	if _, err = readStatusString(handshake); err != nil {
+		return
+	}
+	var port uint16
+	if err = binary.Read(handshake, binary.BigEndian, &port); err != nil {
+		return
+	}
+	nextState, err := readVarInt(handshake)
+	if err != nil {
+		return
+	}
+	if nextState != statusNextStateStatus {
+		return errStatusNotQuery
+	}
+
+	if _, err = readStatusPacket(rw, statusPacketIdHandshake); err != nil {
+		return
+	}
+	statusJson, err := status.JSON()
+	if err != nil {
+		return
+	}
+	response := new(bytes.Buffer)
+	writeVarInt(response, statusPacketIdHandshake)
+	writeVarInt(response, int32(len(statusJson)))
+	response.Write(statusJson)
+	if err = writeStatusPacket(rw, response.Bytes()); err != nil {
+		return
+	}
+
+	ping, err := readStatusPacket(rw, statusPacketIdPing)
+	if err == io.EOF {
+		// The client didn't ping.
+		return nil
+	} else if err != nil {
+		return
+	}
+	pong := new(bytes.Buffer)
+	writeVarInt(pong, statusPacketIdPing)
+	io.Copy(pong, ping)
+	return writeStatusPacket(rw, pong.Bytes())
+}
+
+// readStatusPacket reads a length-prefixed packet of a newer client, which
+// must have the given ID, and returns the rest of its body.
+func readStatusPacket(reader io.Reader, id int32) (body *bytes.Reader, err error) {
+	length, err := readVarInt(byteReader{reader})
+	if err != nil {
+		return
+	}
+	if length < 1 || length > maxStatusPacketLength {
+		err = fmt.Errorf("bad status packet length %d", length)
+		return
+	}
+
+	data := make([]byte, length)
+	if _, err = io.ReadFull(reader, data); err != nil {
+		return
+	}
+	body = bytes.NewReader(data)
+
+	packetId, err := readVarInt(body)
+	if err != nil {
+		return
+	}
+	if packetId != id {
+		err = fmt.Errorf("unexpected status packet ID: 0x%02x", packetId)
+	}
+	return
+}
+
+func writeStatusPacket(writer io.Writer, packet []byte) (err error) {
+	buf := new(bytes.Buffer)
+	writeVarInt(buf, int32(len(packet)))
+	buf.Write(packet)
+	_, err = writer.Write(buf.Bytes())
+	return
+}
+
+func readStatusString(reader *bytes.Reader) (s string, err error) {
+	length, err := readVarInt(reader)
+	if err != nil {
+		return
+	}
+	if length < 0 || int(length) > reader.Len() {
+		err = fmt.Errorf("bad status string length %d", length)
+		return
+	}
+
+	bs := make([]byte, length)
+	_, err = io.ReadFull(reader, bs)
+	return string(bs), err
+}
+
+// Variable length integers, as used by newer clients.
+
+func readVarInt(reader io.ByteReader) (value int32, err error) {
+	var result uint32
+	for shift := uint(0); shift < 35; shift += 7 {
+		var b byte
+		if b, err = reader.ReadByte(); err != nil {
+			return
+		}
+		result |= uint32(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return int32(result), nil
+		}
+	}
+	return 0, errors.New("varint too long")
+}
+
+func writeVarInt(buf *bytes.Buffer, value int32) {
+	v := uint32(value)
+	for v >= 0x80 {
+		buf.WriteByte(byte(v) | 0x80)
+		v >>= 7
+	}
+	buf.WriteByte(byte(v))
+}
+
+// byteReader reads single bytes from a reader without buffering, so that
+// nothing past the packets read is consumed.
+type byteReader struct {
+	io.Reader
+}
+
+func (r byteReader) ReadByte() (byte, error) {
+	var b [1]byte
+	_, err := io.ReadFull(r.Reader, b[:])
+	return b[0], err
+}
@@ -0,0 +1,125 @@
+package proto
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestServerListStatus_Legacy(t *testing.T) {
+	status := &ServerListStatus{"A §cserver", 3, 16}
+	if result := status.legacy(); result != "A cserver§3§16" {
+		t.Errorf("Expected the MOTD without separators, got %q", result)
+	}
+}
+
+func TestServerListStatus_JSON(t *testing.T) {
+	status := &ServerListStatus{"A server", 3, 16}
+	data, err := status.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result interface{}
+	if err = json.Unmarshal(data, &result); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"version":     map[string]interface{}{"name": ProtocolVersionName, "protocol": float64(MaxProtocolVersion)},
+		"players":     map[string]interface{}{"max": float64(16), "online": float64(3)},
+		"description": map[string]interface{}{"text": "A server"},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
+
+func TestIsStatusHandshake(t *testing.T) {
+	tests := []struct {
+		prefix   []byte
+		expected bool
+	}{
+		{[]byte{16, statusPacketIdHandshake}, true},
+		{[]byte{minStatusHandshakeLength, statusPacketIdHandshake}, true},
+		{[]byte{minStatusHandshakeLength - 1, statusPacketIdHandshake}, false},
+		{[]byte{16, statusPacketIdPing}, false},
+		{[]byte{0x80, statusPacketIdHandshake}, false},
+		{[]byte("GE"), false},
+		{[]byte{16}, false},
+	}
+	for _, test := range tests {
+		if result := IsStatusHandshake(test.prefix); result != test.expected {
+			t.Errorf("IsStatusHandshake(% x): expected %v, got %v", test.prefix, test.expected, result)
+		}
+	}
+}
+
+// statusPacket returns a length-prefixed packet of a newer client.
+func statusPacket(id int32, body ...[]byte) []byte {
+	packet := new(bytes.Buffer)
+	writeVarInt(packet, id)
+	for _, b := range body {
+		packet.Write(b)
+	}
+	buf := new(bytes.Buffer)
+	writeVarInt(buf, int32(packet.Len()))
+	buf.Write(packet.Bytes())
+	return buf.Bytes()
+}
+
+func TestServerAnswerStatusQuery(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	status := &ServerListStatus{"A server", 3, 16}
+	done := make(chan error, 1)
+	go func() {
+		prefix := make([]byte, StatusHandshakePrefixLength)
+		if _, err := io.ReadFull(server, prefix); err != nil {
+			done <- err
+			return
+		}
+		if !IsStatusHandshake(prefix) {
+			t.Errorf("Expected % x to begin a status handshake", prefix)
+		}
+		done <- ServerAnswerStatusQuery(server, prefix, status)
+		server.Close()
+	}()
+
+	// Protocol version 4, "localhost", port 25565, next state status.
+	handshake := statusPacket(statusPacketIdHandshake, []byte{4, 9}, []byte("localhost"), []byte{0x63, 0xdd, statusNextStateStatus})
+	go func() {
+		client.Write(handshake)
+		client.Write(statusPacket(statusPacketIdHandshake))
+	}()
+
+	response, err := readStatusPacket(client, statusPacketIdHandshake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statusJson, err := readStatusString(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, _ := status.JSON(); statusJson != string(expected) {
+		t.Errorf("Expected status %s, got %s", expected, statusJson)
+	}
+
+	payload := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	go client.Write(statusPacket(statusPacketIdPing, payload))
+	pong, err := readStatusPacket(client, statusPacketIdPing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result, _ := ioutil.ReadAll(pong); !bytes.Equal(result, payload) {
+		t.Errorf("Expected pong %v, got %v", payload, result)
+	}
+
+	if err = <-done; err != nil {
+		t.Errorf("ServerAnswerStatusQuery error: %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package chunkymonkey
+
+import (
+	"chunkymonkey/logger"
+	. "chunkymonkey/types"
+	"chunkymonkey/worldstore"
+)
+
+// PruneChunks implements IGame.PruneChunks.
+func (game *Game) PruneChunks(radius int, dryRun bool, done func(chunks int, bytes int64, err error)) {
+	go func() {
+		// Shards don't save while the region files are rewritten, and chunks
+		// that they have loaded are kept so that saving them later doesn't
+		// bring them back.
+		game.shardManager.SetSaving(false)
+		defer game.shardManager.SetSaving(true)
+
+		loaded := make(map[ChunkXz]bool)
+		for _, loc := range game.shardManager.LoadedChunks() {
+			loaded[loc] = true
+		}
+
+		options := worldstore.PruneOptions{Radius: radius, DryRun: dryRun}
+		stats, err := game.worldStore.PruneChunks(options, func(loc ChunkXz) bool {
+			return loaded[loc]
+		})
+		switch {
+		case err != nil:
+			logger.World.Error("Pruning chunks failed", "radius", radius, "err", err)
+		case dryRun:
+			logger.World.Info("Chunks would be pruned", "radius", radius, "kept", stats.Kept, "removed", stats.Removed, "bytes", stats.Bytes)
+		default:
+			logger.World.Info("Pruned chunks", "radius", radius, "kept", stats.Kept, "removed", stats.Removed, "bytes", stats.Bytes)
+		}
+		done(stats.Removed, stats.Bytes, err)
+	}()
+}
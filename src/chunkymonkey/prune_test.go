@@ -0,0 +1,26 @@
+package chunkymonkey
+
+import (
+	"testing"
+)
+
+func TestGame_PruneChunks(t *testing.T) {
+	game, listener := newTestGame(t)
+	loginPlaced(t, listener, "alice")
+
+	type Result struct {
+		chunks int
+		bytes  int64
+		err    error
+	}
+	result := make(chan Result, 1)
+	game.PruneChunks(0, false, func(chunks int, bytes int64, err error) {
+		result <- Result{chunks, bytes, err}
+	})
+
+	// The chunks around alice are loaded, so are kept however small the
+	// radius.
+	if r := <-result; r.chunks != 0 || r.err != nil {
+		t.Errorf("Expected no chunks pruned, got %+v", r)
+	}
+}
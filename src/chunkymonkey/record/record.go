@@ -3,6 +3,7 @@
 package record
 
 import (
+	"bytes"
 	"encoding/binary"
 	"io"
 	"time"
@@ -73,7 +74,7 @@ func (replayer *ReaderReplayer) Replay() {
 		if header.Length > int32(len(buf)) {
 			buf = make([]byte, header.Length)
 		}
-		if _, err = replayer.log.Read(buf[:header.Length]); err != nil {
+		if _, err = io.ReadFull(replayer.log, buf[:header.Length]); err != nil {
 			break
 		}
 
@@ -93,3 +94,24 @@ func (replayer *ReaderReplayer) Replay() {
 
 	return
 }
+
+// ReadLog returns all of the data recorded in a log, without the timings. This
+// lets recorded sessions be fed straight into packet readers, e.g in tests.
+func ReadLog(log io.Reader) (data []byte, err error) {
+	var buf bytes.Buffer
+	var header header
+
+	for {
+		if err = binary.Read(log, binary.BigEndian, &header); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			break
+		}
+		if _, err = io.CopyN(&buf, log, int64(header.Length)); err != nil {
+			break
+		}
+	}
+
+	return buf.Bytes(), err
+}
@@ -0,0 +1,44 @@
+package record
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+type closingBuffer struct {
+	bytes.Buffer
+}
+
+func (b *closingBuffer) Close() error { return nil }
+
+func TestReadLog(t *testing.T) {
+	log := new(closingBuffer)
+	recorder := NewReaderRecorder(log, io.MultiReader(
+		bytes.NewBufferString("first"),
+		bytes.NewBufferString("second chunk"),
+		bytes.NewBufferString("third")))
+	if _, err := ioutil.ReadAll(recorder); err != nil {
+		t.Fatalf("Reading through recorder: %v", err)
+	}
+
+	data, err := ReadLog(log)
+	if err != nil {
+		t.Fatalf("ReadLog: %v", err)
+	}
+	if expected := "firstsecond chunkthird"; string(data) != expected {
+		t.Errorf("Expected %q, got %q", expected, data)
+	}
+}
+
+func TestReadLog_Truncated(t *testing.T) {
+	log := new(closingBuffer)
+	recorder := NewReaderRecorder(log, bytes.NewBufferString("data"))
+	ioutil.ReadAll(recorder)
+
+	truncated := bytes.NewReader(log.Bytes()[:log.Len()-1])
+	if _, err := ReadLog(truncated); err == nil {
+		t.Errorf("Expected error reading truncated log")
+	}
+}
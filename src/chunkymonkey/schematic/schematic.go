@@ -0,0 +1,216 @@
+// The schematic package reads and writes .schematic files, as saved by MCEdit
+// and other world editors, so that structures can be copied out of and pasted
+// into the world.
+package schematic
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	. "chunkymonkey/types"
+	"nbt"
+)
+
+var ErrBadSize = errors.New("Schematic dimensions don't match its block data.")
+
+// Schematic is a box of blocks, Width along X, Height along Y and Length
+// along Z.
+type Schematic struct {
+	Width, Height, Length int
+	// Blocks and Data hold the type and data of each block, ordered by Y,
+	// then Z, then X.
+	Blocks []byte
+	Data   []byte
+}
+
+// New returns a schematic of the given size, filled with air.
+func New(width, height, length int) (s *Schematic, err error) {
+	if width < 0 || height < 0 || length < 0 ||
+		width > math.MaxInt16 || height > math.MaxInt16 || length > math.MaxInt16 {
+		return nil, ErrBadSize
+	}
+	size := width * height * length
+	return &Schematic{
+		Width:  width,
+		Height: height,
+		Length: length,
+		Blocks: make([]byte, size),
+		Data:   make([]byte, size),
+	}, nil
+}
+
+// Read reads a schematic from NBT data, which may be compressed.
+func Read(reader io.Reader) (s *Schematic, err error) {
+	root, err := nbt.ReadCompressed(reader)
+	if err != nil {
+		return
+	}
+
+	width, okW := nbt.GetShort(root, "Schematic/Width")
+	height, okH := nbt.GetShort(root, "Schematic/Height")
+	length, okL := nbt.GetShort(root, "Schematic/Length")
+	if !okW || !okH || !okL {
+		return nil, errors.New("Schematic is missing its Width, Height or Length.")
+	}
+	if materials, ok := nbt.GetString(root, "Schematic/Materials"); ok && materials != "Alpha" {
+		return nil, fmt.Errorf("Unsupported schematic materials %q.", materials)
+	}
+
+	s = &Schematic{Width: int(width), Height: int(height), Length: int(length)}
+	var ok bool
+	if s.Blocks, ok = nbt.GetByteArray(root, "Schematic/Blocks"); !ok {
+		return nil, errors.New("Schematic is missing its Blocks.")
+	}
+	if s.Data, ok = nbt.GetByteArray(root, "Schematic/Data"); !ok {
+		return nil, errors.New("Schematic is missing its Data.")
+	}
+
+	if s.Width < 0 || s.Height < 0 || s.Length < 0 ||
+		len(s.Blocks) != s.Width*s.Height*s.Length || len(s.Data) != len(s.Blocks) {
+		return nil, ErrBadSize
+	}
+	return
+}
+
+// Load reads a schematic from a file.
+func Load(filename string) (s *Schematic, err error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	if s, err = Read(file); err != nil {
+		err = fmt.Errorf("%s: %v", filename, err)
+	}
+	return
+}
+
+// Write writes the schematic as gzipped NBT data.
+func (s *Schematic) Write(writer io.Writer) (err error) {
+	root, err := s.build()
+	if err != nil {
+		return
+	}
+	return nbt.WriteCompressed(writer, root, nbt.CompressionGzip)
+}
+
+// Save writes the schematic to a file, replacing it without ever leaving it
+// partially written.
+func (s *Schematic) Save(filename string) (err error) {
+	root, err := s.build()
+	if err != nil {
+		return
+	}
+	return nbt.WriteFileAtomic(filename, root, nbt.CompressionGzip)
+}
+
+func (s *Schematic) build() (*nbt.Compound, error) {
+	if s.Width > math.MaxInt16 || s.Height > math.MaxInt16 || s.Length > math.MaxInt16 ||
+		len(s.Blocks) != s.Width*s.Height*s.Length || len(s.Data) != len(s.Blocks) {
+		return nil, ErrBadSize
+	}
+	// Entities and tile entities aren't copied, but other editors expect the
+	// lists to be there.
+	return nbt.NewBuilder().
+		PutCompound("Schematic", nbt.NewBuilder().
+			PutShort("Width", int16(s.Width)).
+			PutShort("Height", int16(s.Height)).
+			PutShort("Length", int16(s.Length)).
+			PutString("Materials", "Alpha").
+			PutByteArray("Blocks", s.Blocks).
+			PutByteArray("Data", s.Data).
+			PutList("Entities", nbt.TagCompound).
+			PutList("TileEntities", nbt.TagCompound)).
+		Build()
+}
+
+// Set sets the type and data of the block at x, y, z within the schematic.
+func (s *Schematic) Set(x, y, z int, blockId BlockId, blockData byte) {
+	i := s.index(x, y, z)
+	s.Blocks[i] = byte(blockId)
+	s.Data[i] = blockData
+}
+
+// Block returns the type and data of the block at x, y, z within the
+// schematic.
+func (s *Schematic) Block(x, y, z int) (blockId BlockId, blockData byte) {
+	i := s.index(x, y, z)
+	return BlockId(s.Blocks[i]), s.Data[i]
+}
+
+func (s *Schematic) index(x, y, z int) int {
+	return (y*s.Length+z)*s.Width + x
+}
+
+// Rotate returns the schematic turned clockwise, looking down, by the given
+// number of quarter turns. Negative turns are anticlockwise. Only the
+// positions of blocks change, not their data, so blocks that face a direction
+// (such as stairs and torches) keep facing the same way.
+func (s *Schematic) Rotate(quarterTurns int) *Schematic {
+	quarterTurns = ((quarterTurns % 4) + 4) % 4
+	rotated := s
+	for i := 0; i < quarterTurns; i++ {
+		rotated = rotated.rotateOnce()
+	}
+	return rotated
+}
+
+// rotateOnce turns the schematic a quarter turn clockwise, so that its north
+// edge (Z = 0) becomes its east edge.
+func (s *Schematic) rotateOnce() *Schematic {
+	rotated := &Schematic{
+		Width:  s.Length,
+		Height: s.Height,
+		Length: s.Width,
+		Blocks: make([]byte, len(s.Blocks)),
+		Data:   make([]byte, len(s.Data)),
+	}
+	for y := 0; y < s.Height; y++ {
+		for z := 0; z < s.Length; z++ {
+			for x := 0; x < s.Width; x++ {
+				from := s.index(x, y, z)
+				to := rotated.index(s.Length-1-z, y, x)
+				rotated.Blocks[to] = s.Blocks[from]
+				rotated.Data[to] = s.Data[from]
+			}
+		}
+	}
+	return rotated
+}
+
+// Each calls fn with the position and contents of each block of the
+// schematic, with its lowest north-west corner at origin. Blocks above or
+// below the world are left out, as are air blocks if skipAir is set.
+func (s *Schematic) Each(origin BlockXyz, skipAir bool, fn func(loc BlockXyz, blockId BlockId, blockData byte)) {
+	for y := 0; y < s.Height; y++ {
+		worldY := int(origin.Y) + y
+		if worldY < 0 || worldY > MaxYCoord {
+			continue
+		}
+		for z := 0; z < s.Length; z++ {
+			for x := 0; x < s.Width; x++ {
+				i := s.index(x, y, z)
+				blockId := BlockId(s.Blocks[i])
+				if skipAir && blockId == BlockIdAir {
+					continue
+				}
+				loc := BlockXyz{origin.X + BlockCoord(x), BlockYCoord(worldY), origin.Z + BlockCoord(z)}
+				fn(loc, blockId, s.Data[i]&0xf)
+			}
+		}
+	}
+}
+
+// PasteOptions control how a schematic is pasted into the world.
+type PasteOptions struct {
+	// Rotation is the number of quarter turns clockwise, looking down, to
+	// rotate the schematic by, as for Rotate.
+	Rotation int
+	// SkipAir leaves the world unchanged where the schematic has air, rather
+	// than clearing it.
+	SkipAir bool
+}
@@ -0,0 +1,158 @@
+package schematic
+
+import (
+	"bytes"
+	"testing"
+
+	. "chunkymonkey/types"
+	"nbt"
+)
+
+// writeSchematic writes a schematic file with the given contents.
+func writeSchematic(t *testing.T, width, height, length int16, blocks, data []byte) *bytes.Buffer {
+	root, err := nbt.NewBuilder().
+		PutCompound("Schematic", nbt.NewBuilder().
+			PutShort("Width", width).
+			PutShort("Height", height).
+			PutShort("Length", length).
+			PutString("Materials", "Alpha").
+			PutByteArray("Blocks", blocks).
+			PutByteArray("Data", data)).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err = nbt.WriteCompressed(buf, root, nbt.CompressionGzip); err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+// testSchematic is 3 wide, 2 high and 2 long. Each block's type is its
+// index, apart from an air block.
+func testSchematic() *Schematic {
+	return &Schematic{
+		Width: 3, Height: 2, Length: 2,
+		Blocks: []byte{1, 2, 3, 4, 5, 6, 7, 0, 9, 10, 11, 12},
+		Data:   []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	}
+}
+
+func TestRead(t *testing.T) {
+	expected := testSchematic()
+	s, err := Read(writeSchematic(t, 3, 2, 2, expected.Blocks, expected.Data))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if s.Width != 3 || s.Height != 2 || s.Length != 2 ||
+		!bytes.Equal(s.Blocks, expected.Blocks) || !bytes.Equal(s.Data, expected.Data) {
+		t.Errorf("Expected %+v, got %+v", expected, s)
+	}
+
+	if _, err = Read(writeSchematic(t, 3, 2, 3, expected.Blocks, expected.Data)); err != ErrBadSize {
+		t.Errorf("Expected ErrBadSize, got %v", err)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	expected, err := New(3, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range expected.Blocks {
+		expected.Set(i%3, i/6, (i/3)%2, BlockId(i+1), byte(i))
+	}
+	if blockId, data := expected.Block(2, 1, 0); blockId != 9 || data != 8 {
+		t.Errorf("Expected block 9/8, got %d/%d", blockId, data)
+	}
+
+	buf := new(bytes.Buffer)
+	if err = expected.Write(buf); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	s, err := Read(buf)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if s.Width != 3 || s.Height != 2 || s.Length != 2 ||
+		!bytes.Equal(s.Blocks, expected.Blocks) || !bytes.Equal(s.Data, expected.Data) {
+		t.Errorf("Expected %+v, got %+v", expected, s)
+	}
+
+	if _, err = New(1<<15, 1, 1); err != ErrBadSize {
+		t.Errorf("Expected ErrBadSize, got %v", err)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	s := testSchematic()
+
+	once := s.Rotate(1)
+	if once.Width != 2 || once.Length != 3 || once.Height != 2 {
+		t.Fatalf("Expected 2x2x3 after rotating, got %dx%dx%d", once.Width, once.Height, once.Length)
+	}
+
+	type Test struct {
+		x, y, z  int
+		expected byte
+	}
+
+	// The north-west corner turns to the north-east, and the south-west
+	// corner to the north-west.
+	var tests = []Test{
+		{1, 0, 0, 1},
+		{0, 0, 0, 4},
+		{0, 0, 2, 6},
+		{1, 1, 2, 9},
+	}
+
+	for _, test := range tests {
+		if id := once.Blocks[once.index(test.x, test.y, test.z)]; id != test.expected {
+			t.Errorf("Block at %d,%d,%d: expected %d, got %d", test.x, test.y, test.z, test.expected, id)
+		}
+	}
+
+	// A full turn, either way, goes back to the start.
+	for _, turns := range []int{4, -4, 0} {
+		if full := s.Rotate(turns); !bytes.Equal(full.Blocks, s.Blocks) || full.Width != s.Width {
+			t.Errorf("Rotate(%d): expected original schematic, got %+v", turns, full)
+		}
+	}
+	if back := s.Rotate(1).Rotate(-1); !bytes.Equal(back.Blocks, s.Blocks) || !bytes.Equal(back.Data, s.Data) {
+		t.Errorf("Expected rotating back to give the original schematic, got %+v", back)
+	}
+}
+
+func TestEach(t *testing.T) {
+	s := testSchematic()
+
+	type Block struct {
+		loc     BlockXyz
+		blockId BlockId
+		data    byte
+	}
+	collect := func(origin BlockXyz, skipAir bool) (blocks []Block) {
+		s.Each(origin, skipAir, func(loc BlockXyz, blockId BlockId, data byte) {
+			blocks = append(blocks, Block{loc, blockId, data})
+		})
+		return
+	}
+
+	blocks := collect(BlockXyz{10, 64, -5}, false)
+	if len(blocks) != 12 {
+		t.Fatalf("Expected 12 blocks, got %d", len(blocks))
+	}
+	if blocks[0] != (Block{BlockXyz{10, 64, -5}, 1, 0}) || blocks[11] != (Block{BlockXyz{12, 65, -4}, 12, 11}) {
+		t.Errorf("Unexpected blocks %v", blocks)
+	}
+
+	if blocks = collect(BlockXyz{0, 64, 0}, true); len(blocks) != 11 {
+		t.Errorf("Expected air to be skipped, got %d blocks", len(blocks))
+	}
+
+	// Blocks above the world are left out.
+	if blocks = collect(BlockXyz{0, MaxYCoord, 0}, false); len(blocks) != 6 {
+		t.Errorf("Expected the top layer to be left out, got %d blocks", len(blocks))
+	}
+}
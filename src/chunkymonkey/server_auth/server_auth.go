@@ -1,13 +1,29 @@
 package server_auth
 
 import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
 	"expvar"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
 	"time"
+
+	"chunkymonkey/clock"
+	"chunkymonkey/logger"
 )
 
+// OfflineServerId is sent as the server id in the handshake to tell clients
+// that they aren't authenticated with minecraft.net.
+const OfflineServerId = "-"
+
+// authTimeout is how long ServerAuth waits for the session server to answer.
+const authTimeout = 10 * time.Second
+
 var (
 	expVarServerAuthSuccessCount *expvar.Int
 	expVarServerAuthFailCount    *expvar.Int
@@ -20,11 +36,59 @@ func init() {
 	expVarServerAuthTimeNs = expvar.NewInt("server-auth-time-ns")
 }
 
-// An IAuthenticator takes a serverId and a user string and attempts to
-// authenticate against a server. This interface allows for the use of a dummy
-// authentication server for testing purposes.
+// NewServerId returns a random server id for a connection's handshake. The
+// client authenticates with minecraft.net using it, and the server then checks
+// the same id with Authenticate. OfflineServerId is returned if online is
+// false.
+func NewServerId(online bool) (serverId string, err error) {
+	if !online {
+		return OfflineServerId, nil
+	}
+
+	var id [8]byte
+	if _, err = rand.Read(id[:]); err != nil {
+		return
+	}
+	return hex.EncodeToString(id[:]), nil
+}
+
+// EncryptedServerId returns the server id that clients of an encrypted
+// connection authenticate with, which is a digest of the id sent to them, the
+// shared secret and the server's public key. The digest is the SHA-1 hash as a
+// signed hexadecimal number, without leading zeros.
+func EncryptedServerId(serverId string, sharedSecret, publicKey []byte) string {
+	hash := sha1.New()
+	hash.Write([]byte(serverId))
+	hash.Write(sharedSecret)
+	hash.Write(publicKey)
+	digest := hash.Sum(nil)
+
+	negative := digest[0]&0x80 != 0
+	if negative {
+		// Two's complement negation.
+		carry := true
+		for i := len(digest) - 1; i >= 0; i-- {
+			digest[i] = ^digest[i]
+			if carry {
+				digest[i]++
+				carry = digest[i] == 0
+			}
+		}
+	}
+
+	id := strings.TrimLeft(hex.EncodeToString(digest), "0")
+	if negative {
+		id = "-" + id
+	}
+	return id
+}
+
+// An IAuthenticator takes a serverId, a user string and the IP address that
+// the user connects from, and attempts to authenticate against a server. This
+// interface allows for the use of a dummy authentication server for testing
+// purposes.
 type IAuthenticator interface {
-	Authenticate(string, string) (bool, error)
+	Authenticate(serverId, user, addr string) (bool, error)
 }
 
 // DummyAuth is a no-op authentication server, always returning the value of
@@ -34,7 +98,7 @@ type DummyAuth struct {
 }
 
 // Authenticate implements the IAuthenticator.Authenticate method
-func (d *DummyAuth) Authenticate(serverId, user string) (authenticated bool, err error) {
+func (d *DummyAuth) Authenticate(serverId, user, addr string) (authenticated bool, err error) {
 	return d.Result, nil
 }
 
@@ -42,6 +106,7 @@ func (d *DummyAuth) Authenticate(serverId, user string) (authenticated bool, err
 // main minecraft server at http://www.minecraft.net/game/checkserver.jsp.
 type ServerAuth struct {
 	baseUrl url.URL
+	client  http.Client
 }
 
 func NewServerAuth(baseUrlStr string) (s *ServerAuth, err error) {
@@ -51,6 +116,7 @@ func NewServerAuth(baseUrlStr string) (s *ServerAuth, err error) {
 	}
 	s = &ServerAuth{
 		baseUrl: *baseUrl,
+		client:  http.Client{Timeout: authTimeout},
 	}
 	return
 }
@@ -69,12 +135,14 @@ func (s *ServerAuth) BuildQuery(serverId, user string) (query string) {
 	return queryUrl.String()
 }
 
-// Authenticate implements the IAuthenticator.Authenticate method
-func (s *ServerAuth) Authenticate(serverId, user string) (authenticated bool, err error) {
+// Authenticate implements the IAuthenticator.Authenticate method. An error is
+// returned if the session server can't be reached or doesn't answer properly,
+// as opposed to answering that the user isn't authenticated. The address
+// isn't checked by the session server.
+func (s *ServerAuth) Authenticate(serverId, user, addr string) (authenticated bool, err error) {
 	before := time.Now()
 	defer func() {
-		after := time.Now()
-		expVarServerAuthTimeNs.Add(after.Unix() - before.Unix())
+		expVarServerAuthTimeNs.Add(time.Since(before).Nanoseconds())
 		if authenticated {
 			expVarServerAuthSuccessCount.Add(1)
 		} else {
@@ -86,10 +154,11 @@ func (s *ServerAuth) Authenticate(serverId, user string) (authenticated bool, er
 
 	url_ := s.BuildQuery(serverId, user)
 
-	response, err := http.Get(url_)
+	response, err := s.client.Get(url_)
 	if err != nil {
 		return
 	}
+	defer response.Body.Close()
 
 	if response.StatusCode == 200 {
 		// We only need to read up to 3 bytes for "YES" or "NO"
@@ -105,11 +174,92 @@ func (s *ServerAuth) Authenticate(serverId, user string) (authenticated bool, er
 			bufferPos += numBytesRead
 		}
 
+		// The response may end along with the last bytes read.
+		err = nil
 		result := string(buf[0:bufferPos])
 		authenticated = (result == "YES")
 	} else {
+		err = fmt.Errorf("session server responded %q", response.Status)
+	}
+
+	return
+}
+
+// CachingAuth wraps an IAuthenticator, remembering the users that it
+// authenticates and the addresses they connected from. When the session
+// server can't be reached, users that it authenticated within CacheTime are
+// authenticated from the cache, but only from the same address, so that
+// anyone else sending their name isn't let in as them. If
+// FallbackOffline is set, other users are then let in unauthenticated, as if
+// the server were in offline mode, rather than being rejected. Users for whom
+// FallbackDenied returns true, such as operators, are never let in
+// unauthenticated, as anyone could claim their names.
+type CachingAuth struct {
+	Auth            IAuthenticator
+	CacheTime       time.Duration
+	FallbackOffline bool
+	FallbackDenied  func(user string) bool
+	Clock           clock.Clock
+
+	lock     sync.Mutex
+	verified map[cacheKey]time.Time // The time each user was verified from an address.
+}
+
+// cacheKey is a lower case username and the address it was verified from.
+type cacheKey struct {
+	user, addr string
+}
+
+// NewCachingAuth creates a CachingAuth timed by the real clock.
+func NewCachingAuth(auth IAuthenticator, cacheTime time.Duration, fallbackOffline bool) *CachingAuth {
+	return &CachingAuth{
+		Auth:            auth,
+		CacheTime:       cacheTime,
+		FallbackOffline: fallbackOffline,
+		Clock:           clock.Real,
+		verified:        make(map[cacheKey]time.Time),
+	}
+}
+
+// Authenticate implements the IAuthenticator.Authenticate method. The error
+// of the wrapped IAuthenticator is only returned if the user could not be let
+// in by the cache or the offline fallback.
+func (c *CachingAuth) Authenticate(serverId, user, addr string) (authenticated bool, err error) {
+	key := cacheKey{strings.ToLower(user), addr}
+	authenticated, err = c.Auth.Authenticate(serverId, user, addr)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := c.Clock.Now()
+	if err == nil {
+		if authenticated {
+			c.verified[key] = now
+		} else {
+			// The user isn't let in from the cache at any address.
+			for cached := range c.verified {
+				if cached.user == key.user {
+					delete(c.verified, cached)
+				}
+			}
+		}
 		return
 	}
 
+	if verified, ok := c.verified[key]; ok {
+		if now.Sub(verified) < c.CacheTime {
+			logger.Net.Warn("Session server unavailable, user authenticated from cache", "player", user, "addr", addr, "err", err)
+			return true, nil
+		}
+		delete(c.verified, key)
+	}
+	if c.FallbackOffline {
+		if c.FallbackDenied != nil && c.FallbackDenied(user) {
+			logger.Net.Warn("Session server unavailable, privileged user not let in unauthenticated", "player", user, "err", err)
+			return
+		}
+		logger.Net.Warn("Session server unavailable, user let in unauthenticated", "player", user, "err", err)
+		return true, nil
+	}
 	return
 }
@@ -0,0 +1,154 @@
+package server_auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"chunkymonkey/clock"
+)
+
+func TestNewServerId(t *testing.T) {
+	if serverId, err := NewServerId(false); err != nil || serverId != OfflineServerId {
+		t.Errorf("Expected %q offline, got %q, %v", OfflineServerId, serverId, err)
+	}
+
+	validId := regexp.MustCompile(`^[0-9a-f]{16}$`)
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		serverId, err := NewServerId(true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !validId.MatchString(serverId) {
+			t.Fatalf("Expected 16 hex digits, got %q", serverId)
+		}
+		if seen[serverId] {
+			t.Fatalf("Server id %q repeated after %d ids", serverId, i)
+		}
+		seen[serverId] = true
+	}
+}
+
+func TestEncryptedServerId(t *testing.T) {
+	// The digests of names, as computed by the standard server.
+	tests := map[string]string{
+		"Notch": "4ed1f46bbe04bc756bcb17c0c7ce3e4632f06a48",
+		"jeb_":  "-7c9d5b0044c130109a5d7b5fb5c317c02b4e28c1",
+		"simon": "88e16a1019277b15d58faf0541e11910eb756f6",
+	}
+	for name, expected := range tests {
+		if id := EncryptedServerId(name, nil, nil); id != expected {
+			t.Errorf("%s: expected %q, got %q", name, expected, id)
+		}
+	}
+
+	// The id, secret and key are digested together.
+	if EncryptedServerId("No", []byte("t"), []byte("ch")) != tests["Notch"] {
+		t.Errorf("Expected the id, secret and key to be digested in order")
+	}
+}
+
+func TestServerAuth_Authenticate(t *testing.T) {
+	var query map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Write([]byte("YES"))
+	}))
+	defer server.Close()
+
+	auth, err := NewServerAuth(server.URL + "/game/checkserver.jsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverId, _ := NewServerId(true)
+	authenticated, err := auth.Authenticate(serverId, "alice", "127.0.0.1")
+	if err != nil || !authenticated {
+		t.Fatalf("Expected authentication, got %v, %v", authenticated, err)
+	}
+	if got := query["serverId"]; len(got) != 1 || got[0] != serverId {
+		t.Errorf("Expected serverId %q in the query, got %q", serverId, got)
+	}
+	if got := query["user"]; len(got) != 1 || got[0] != "alice" {
+		t.Errorf("Expected user alice in the query, got %q", got)
+	}
+}
+
+func TestServerAuth_AuthenticateServerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	auth, err := NewServerAuth(server.URL + "/game/checkserver.jsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authenticated, err := auth.Authenticate("0123456789abcdef", "alice", "127.0.0.1"); authenticated || err == nil {
+		t.Errorf("Expected an error, got %v, %v", authenticated, err)
+	}
+}
+
+// stubAuth answers with Result, or Err if it is set.
+type stubAuth struct {
+	Result bool
+	Err    error
+}
+
+func (auth *stubAuth) Authenticate(serverId, user, addr string) (bool, error) {
+	if auth.Err != nil {
+		return false, auth.Err
+	}
+	return auth.Result, nil
+}
+
+func TestCachingAuth_Authenticate(t *testing.T) {
+	unavailable := errors.New("unavailable")
+
+	type Step struct {
+		desc          string
+		advance       time.Duration
+		user          string
+		addr          string
+		result        bool
+		err           error
+		fallback      bool
+		authenticated bool
+		expectErr     bool
+	}
+
+	var steps = []Step{
+		{"rejected users are rejected", 0, "alice", "10.0.0.1", false, nil, false, false, false},
+		{"unknown users aren't let in while unavailable", 0, "alice", "10.0.0.1", false, unavailable, false, false, true},
+		{"authenticated users are let in", 0, "alice", "10.0.0.1", true, nil, false, true, false},
+		{"and are let in from the cache", time.Minute, "Alice", "10.0.0.1", false, unavailable, false, true, false},
+		{"but not from another address", 0, "alice", "10.0.0.2", false, unavailable, false, false, true},
+		{"other users aren't", 0, "bob", "10.0.0.1", false, unavailable, false, false, true},
+		{"unless falling back to offline", 0, "bob", "10.0.0.1", false, unavailable, true, true, false},
+		{"except for denied users", 0, "root", "10.0.0.1", false, unavailable, true, false, true},
+		{"cached users expire", time.Hour, "alice", "10.0.0.1", false, unavailable, false, false, true},
+		{"the session server overrides the cache", 0, "bob", "10.0.0.1", true, nil, false, true, false},
+		{"both ways", 0, "bob", "10.0.0.2", false, nil, false, false, false},
+		{"so rejected users aren't cached at any address", 0, "bob", "10.0.0.1", false, unavailable, false, false, true},
+	}
+
+	stub := &stubAuth{}
+	clk := clock.NewFake(time.Unix(0, 0))
+	auth := NewCachingAuth(stub, time.Hour, false)
+	auth.Clock = clk
+	auth.FallbackDenied = func(user string) bool { return user == "root" }
+
+	for _, step := range steps {
+		clk.Advance(step.advance)
+		stub.Result, stub.Err = step.result, step.err
+		auth.FallbackOffline = step.fallback
+		authenticated, err := auth.Authenticate("0123456789abcdef", step.user, step.addr)
+		if authenticated != step.authenticated || (err != nil) != step.expectErr {
+			t.Errorf("%s: expected %v with error %v, got %v, %v",
+				step.desc, step.authenticated, step.expectErr, authenticated, err)
+		}
+	}
+}
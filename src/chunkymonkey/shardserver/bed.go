@@ -0,0 +1,55 @@
+package shardserver
+
+import (
+	"chunkymonkey/gamerules"
+	. "chunkymonkey/types"
+)
+
+// bedStandOffsets are the offsets from a bed of the blocks that a player
+// respawning at it may stand in, in order of preference.
+var bedStandOffsets = []BlockXyz{
+	{-1, 0, 0}, {1, 0, 0}, {0, 0, -1}, {0, 0, 1},
+	{-1, 0, -1}, {-1, 0, 1}, {1, 0, -1}, {1, 0, 1},
+	{-1, 1, 0}, {1, 1, 0}, {0, 1, -1}, {0, 1, 1},
+	{-1, -1, 0}, {1, -1, 0}, {0, -1, -1}, {0, -1, 1},
+}
+
+// bedSpawnPosition returns a position beside the bed at which a player can
+// stand. ok is false if there is no longer a bed there, or there is nowhere
+// to stand beside it.
+func (shard *ChunkShard) bedSpawnPosition(bed BlockXyz) (position AbsXyz, ok bool) {
+	if blockId, _, loaded := shard.BlockAt(bed); !loaded || blockId != BlockIdBed {
+		return
+	}
+
+	for _, offset := range bedStandOffsets {
+		feet := bed.AddXyz(offset.X, offset.Y, offset.Z)
+		if feet == nil {
+			continue
+		}
+		if shard.isSolidAt(feet, -1) && !shard.isSolidAt(feet, 0) && !shard.isSolidAt(feet, 1) {
+			return AbsXyz{
+				AbsCoord(feet.X) + 0.5,
+				AbsCoord(feet.Y),
+				AbsCoord(feet.Z) + 0.5,
+			}, true
+		}
+	}
+	return
+}
+
+// isSolidAt returns true if the block dy above loc is solid. Blocks that
+// can't be looked at, such as those outside the shard, are assumed to be
+// solid.
+func (shard *ChunkShard) isSolidAt(loc *BlockXyz, dy BlockYCoord) bool {
+	at := loc.AddXyz(0, dy, 0)
+	if at == nil {
+		return true
+	}
+	blockId, _, ok := shard.BlockAt(*at)
+	if !ok {
+		return true
+	}
+	blockType, ok := gamerules.Blocks.Get(blockId)
+	return !ok || blockType.Solid
+}
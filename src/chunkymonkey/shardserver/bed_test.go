@@ -0,0 +1,49 @@
+package shardserver
+
+import (
+	"testing"
+
+	. "chunkymonkey/types"
+)
+
+func TestChunkShard_BedSpawnPosition(t *testing.T) {
+	const stone = BlockId(1)
+	bed := BlockXyz{8, 65, 8}
+
+	type Test struct {
+		desc       string
+		blocks     []BlockXyz // Blocks to set to stone.
+		noBed      bool
+		expected   AbsXyz
+		expectedOk bool
+	}
+
+	var ring []BlockXyz
+	for _, offset := range bedStandOffsets[:8] {
+		for dy := BlockYCoord(0); dy <= 1; dy++ {
+			ring = append(ring, BlockXyz{bed.X + offset.X, bed.Y + dy, bed.Z + offset.Z})
+		}
+	}
+
+	var tests = []Test{
+		{"open", nil, false, AbsXyz{7.5, 65, 8.5}, true},
+		{"one side blocked", []BlockXyz{{7, 66, 8}}, false, AbsXyz{9.5, 65, 8.5}, true},
+		{"missing", nil, true, AbsXyz{}, false},
+		{"obstructed", ring, false, AbsXyz{}, false},
+	}
+
+	for _, test := range tests {
+		shard := newTestShard(t, ChunkXz{0, 0})
+		if !test.noBed {
+			shard.SetBlockAt(bed, BlockIdBed, 0)
+		}
+		for _, loc := range test.blocks {
+			shard.SetBlockAt(loc, stone, 0)
+		}
+
+		position, ok := shard.bedSpawnPosition(bed)
+		if position != test.expected || ok != test.expectedOk {
+			t.Errorf("%s: expected (%v, %t) got (%v, %t)", test.desc, test.expected, test.expectedOk, position, ok)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package shardserver
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"chunkymonkey/gamerules"
+	. "chunkymonkey/types"
+)
+
+var (
+	ErrBlockOutOfRange   = errors.New("Block position is outside of the world height.")
+	ErrChunkOutsideShard = errors.New("Chunk is not within the shard.")
+	ErrChunkNotLoaded    = errors.New("Chunk is not loaded.")
+)
+
+// BlockChange is a change to a single block, as made by SetBlocksAt.
+type BlockChange struct {
+	Loc       BlockXyz
+	BlockId   BlockId
+	BlockData byte
+}
+
+// chunkBlockChanges are the block changes within a single chunk, in the form
+// needed for a multi block change packet.
+type chunkBlockChanges struct {
+	chunk     *Chunk
+	indices   []BlockIndex
+	subLocs   []SubChunkXyz
+	blockIds  []BlockId
+	blockData []byte
+}
+
+// loadedBlock returns the loaded chunk containing the block, and the index of
+// the block within it. Chunks are never loaded by it.
+func (shard *ChunkShard) loadedBlock(loc *BlockXyz) (chunk *Chunk, index BlockIndex, subLoc *SubChunkXyz, err error) {
+	chunkLoc, subLoc := loc.ToChunkLocal()
+
+	index, ok := subLoc.BlockIndex()
+	if !ok {
+		err = ErrBlockOutOfRange
+		return
+	}
+
+	chunkIndex, _, _, ok := shard.chunkIndexAndRelLoc(*chunkLoc)
+	if !ok {
+		err = ErrChunkOutsideShard
+		return
+	}
+
+	if chunk = shard.chunks[chunkIndex]; chunk == nil {
+		err = ErrChunkNotLoaded
+	}
+	return
+}
+
+// BlockAt returns the type and data of the block at loc. ok is false if the
+// block is outside of the world height, or its chunk is not loaded within the
+// shard.
+func (shard *ChunkShard) BlockAt(loc BlockXyz) (blockId BlockId, blockData byte, ok bool) {
+	chunk, index, _, err := shard.loadedBlock(&loc)
+	if err != nil {
+		return
+	}
+
+	return index.BlockId(chunk.blocks), index.BlockData(chunk.blockData), true
+}
+
+// SetBlockAt sets the type and data of the block at loc, tells subscribed
+// players, and makes the block and its neighbours active so that they can
+// react to the change. An error is returned if the chunk is not loaded, rather
+// than loading it, so callers decide whether to load chunks with chunkAt.
+func (shard *ChunkShard) SetBlockAt(loc BlockXyz, blockId BlockId, blockData byte) error {
+	if _, ok := gamerules.Blocks.Get(blockId); !ok {
+		return fmt.Errorf("Unknown block type %d.", blockId)
+	}
+
+	chunk, index, subLoc, err := shard.loadedBlock(&loc)
+	if err != nil {
+		return err
+	}
+
+	chunk.setBlock(&loc, subLoc, index, blockId, blockData)
+	shard.activateNeighbours(&loc)
+
+	return nil
+}
+
+// SetBlocksAt makes several block changes as SetBlockAt does. Either all of
+// the changes are made, or none are and an error is returned. Subscribed
+// players are sent one packet for each chunk changed, rather than for each
+// block.
+func (shard *ChunkShard) SetBlocksAt(changes []BlockChange) error {
+	chunkChanges, err := shard.groupBlockChanges(changes)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range chunkChanges {
+		c.chunk.setBlocks(c)
+	}
+	for i := range changes {
+		shard.activateNeighbours(&changes[i].Loc)
+	}
+
+	return nil
+}
+
+// loadAndSetBlocksAt makes the block changes as SetBlocksAt does, first
+// loading the chunks that they are in.
+func (shard *ChunkShard) loadAndSetBlocksAt(changes []BlockChange) error {
+	for i := range changes {
+		chunkLoc, _ := changes[i].Loc.ToChunkLocal()
+		if shard.chunkAt(*chunkLoc) == nil {
+			return fmt.Errorf("Chunk %d,%d could not be loaded.", chunkLoc.X, chunkLoc.Z)
+		}
+	}
+	return shard.SetBlocksAt(changes)
+}
+
+// readBlocks calls fn with the type and data of each block within the box
+// from min to max inclusive that is in the shard, loading chunks as needed.
+func (shard *ChunkShard) readBlocks(min, max BlockXyz, fn func(loc BlockXyz, blockId BlockId, blockData byte)) error {
+	shardMin := shard.originChunkLoc.ChunkCornerBlockXY()
+	shardMax := BlockXyz{
+		shardMin.X + ShardSize*ChunkSizeH - 1,
+		MaxYCoord,
+		shardMin.Z + ShardSize*ChunkSizeH - 1,
+	}
+	if min.X < shardMin.X {
+		min.X = shardMin.X
+	}
+	if min.Z < shardMin.Z {
+		min.Z = shardMin.Z
+	}
+	if max.X > shardMax.X {
+		max.X = shardMax.X
+	}
+	if max.Z > shardMax.Z {
+		max.Z = shardMax.Z
+	}
+
+	for x := min.X; x <= max.X; x++ {
+		for z := min.Z; z <= max.Z; z++ {
+			for y := int(min.Y); y <= int(max.Y); y++ {
+				loc := BlockXyz{x, BlockYCoord(y), z}
+				chunkLoc, subLoc := loc.ToChunkLocal()
+				index, ok := subLoc.BlockIndex()
+				if !ok {
+					return ErrBlockOutOfRange
+				}
+				chunk := shard.chunkAt(*chunkLoc)
+				if chunk == nil {
+					return fmt.Errorf("Chunk %d,%d could not be loaded.", chunkLoc.X, chunkLoc.Z)
+				}
+				fn(loc, index.BlockId(chunk.blocks), index.BlockData(chunk.blockData))
+			}
+		}
+	}
+
+	return nil
+}
+
+// groupBlockChanges checks the changes, and groups them by chunk in the order
+// that each chunk is first changed.
+func (shard *ChunkShard) groupBlockChanges(changes []BlockChange) (chunkChanges []*chunkBlockChanges, err error) {
+	byChunk := make(map[*Chunk]*chunkBlockChanges)
+
+	for i := range changes {
+		change := &changes[i]
+		if _, ok := gamerules.Blocks.Get(change.BlockId); !ok {
+			return nil, fmt.Errorf("Unknown block type %d.", change.BlockId)
+		}
+
+		chunk, index, subLoc, err := shard.loadedBlock(&change.Loc)
+		if err != nil {
+			return nil, err
+		}
+
+		c, ok := byChunk[chunk]
+		if !ok {
+			c = &chunkBlockChanges{chunk: chunk}
+			byChunk[chunk] = c
+			chunkChanges = append(chunkChanges, c)
+		}
+		c.indices = append(c.indices, index)
+		c.subLocs = append(c.subLocs, *subLoc)
+		c.blockIds = append(c.blockIds, change.BlockId)
+		c.blockData = append(c.blockData, change.BlockData)
+	}
+
+	return
+}
+
+// activateNeighbours makes the block and the six blocks next to it active.
+func (shard *ChunkShard) activateNeighbours(loc *BlockXyz) {
+	shard.addActiveBlock(loc)
+	for _, face := range AllFaces() {
+		d := face.Offset()
+		if neighbour := loc.AddXyz(d.X, d.Y, d.Z); neighbour != nil {
+			shard.addActiveBlock(neighbour)
+		}
+	}
+}
+
+// BlockCollision is a block that a box collides with.
+type BlockCollision struct {
+	Loc     BlockXyz
+	BlockId BlockId
+	Box     AABB
+}
+
+// CollidingBlocks returns the solid blocks whose collision boxes intersect
+// box. complete is false if some of the blocks that the box covers are not
+// loaded in the shard, in which case callers should treat the space as solid
+// rather than let entities move into it.
+func (shard *ChunkShard) CollidingBlocks(box AABB) (collisions []BlockCollision, complete bool) {
+	complete = true
+
+	minX := BlockCoord(math.Floor(float64(box.Min.X)))
+	minZ := BlockCoord(math.Floor(float64(box.Min.Z)))
+	maxX := BlockCoord(math.Ceil(float64(box.Max.X))) - 1
+	maxY := int(math.Ceil(float64(box.Max.Y))) - 1
+	maxZ := BlockCoord(math.Ceil(float64(box.Max.Z))) - 1
+
+	// Blocks such as fences are taller than a block, so check a block lower.
+	minY := int(math.Floor(float64(box.Min.Y))) - 1
+	if minY < 0 {
+		minY = 0
+	}
+	if maxY > MaxYCoord {
+		maxY = MaxYCoord
+	}
+
+	for x := minX; x <= maxX; x++ {
+		for z := minZ; z <= maxZ; z++ {
+			for y := minY; y <= maxY; y++ {
+				loc := BlockXyz{x, BlockYCoord(y), z}
+				blockId, blockData, ok := shard.BlockAt(loc)
+				if !ok {
+					complete = false
+					continue
+				}
+				blockType, ok := gamerules.Blocks.Get(blockId)
+				if !ok {
+					continue
+				}
+				if blockBox, ok := blockType.CollisionBox(&loc, blockData); ok && blockBox.Intersects(&box) {
+					collisions = append(collisions, BlockCollision{loc, blockId, blockBox})
+				}
+			}
+		}
+	}
+
+	return
+}
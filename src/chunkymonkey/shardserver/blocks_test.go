@@ -0,0 +1,395 @@
+package shardserver
+
+import (
+	"sync"
+	"testing"
+
+	"chunkymonkey/clock"
+	"chunkymonkey/entity"
+	"chunkymonkey/gamerules"
+	"chunkymonkey/generation"
+	. "chunkymonkey/types"
+)
+
+// testShardConnecter records the blocks that shards make active in other
+// shards.
+type testShardConnecter struct {
+	activeBlocks map[ShardXz][]BlockXyz
+}
+
+func (c *testShardConnecter) PlayerShardConnect(entityId EntityId, player gamerules.IPlayerClient, shardLoc ShardXz) gamerules.IPlayerShardClient {
+	return nil
+}
+
+func (c *testShardConnecter) ShardShardConnect(shardLoc ShardXz) gamerules.IShardShardClient {
+	return &testShardShardClient{c, shardLoc}
+}
+
+type testShardShardClient struct {
+	connecter *testShardConnecter
+	loc       ShardXz
+}
+
+func (client *testShardShardClient) Disconnect() {
+}
+
+func (client *testShardShardClient) ReqSetActiveBlocks(blocks []BlockXyz) {
+	client.connecter.activeBlocks[client.loc] = append(client.connecter.activeBlocks[client.loc], blocks...)
+}
+
+func (client *testShardShardClient) ReqScheduleUpdate(block BlockXyz, delay Ticks) {
+}
+
+func (client *testShardShardClient) ReqTransferEntity(loc ChunkXz, entity gamerules.INonPlayerEntity) {
+}
+
+// newTestShard returns the shard at the origin of a flatgrass world kept in
+// memory, with the given chunks loaded.
+func newTestShard(t *testing.T, loaded ...ChunkXz) *ChunkShard {
+	entityMgr := new(entity.EntityManager)
+	entityMgr.Init()
+	connecter := &testShardConnecter{make(map[ShardXz][]BlockXyz)}
+	shard := NewChunkShard(connecter, generation.NewFlatgrassWorld(), entityMgr, ShardXz{0, 0}, clock.Real)
+
+	for _, loc := range loaded {
+		if shard.chunkAt(loc) == nil {
+			t.Fatalf("failed to load chunk %#v", loc)
+		}
+	}
+	return shard
+}
+
+func isActive(shard *ChunkShard, loc BlockXyz) bool {
+	for _, block := range shard.newActiveBlocks {
+		if block == loc {
+			return true
+		}
+	}
+	return false
+}
+
+func TestChunkShard_BlockAt(t *testing.T) {
+	shard := newTestShard(t, ChunkXz{0, 0}, ChunkXz{15, 15})
+
+	type Test struct {
+		loc   BlockXyz
+		expId BlockId
+		expOk bool
+	}
+
+	var tests = []Test{
+		{BlockXyz{0, 0, 0}, BlockIdBedrock, true},
+		{BlockXyz{3, 63, 12}, 3, true},  // dirt
+		{BlockXyz{15, 64, 15}, 2, true}, // grass
+		{BlockXyz{8, 65, 8}, BlockIdAir, true},
+		{BlockXyz{8, 127, 8}, BlockIdAir, true},
+		{BlockXyz{255, 64, 255}, 2, true},
+		{BlockXyz{8, -1, 8}, 0, false},   // below the world
+		{BlockXyz{16, 64, 8}, 0, false},  // not loaded
+		{BlockXyz{-1, 64, 8}, 0, false},  // another shard
+		{BlockXyz{256, 64, 8}, 0, false}, // another shard
+	}
+
+	for _, r := range tests {
+		blockId, _, ok := shard.BlockAt(r.loc)
+		if blockId != r.expId || ok != r.expOk {
+			t.Errorf("BlockAt(%v) expected (%d, %t) got (%d, %t)", r.loc, r.expId, r.expOk, blockId, ok)
+		}
+	}
+}
+
+func TestChunkShard_SetBlockAt(t *testing.T) {
+	shard := newTestShard(t, ChunkXz{0, 0})
+	chunk := shard.chunks[0]
+	chunk.chunkPacket()
+
+	loc := BlockXyz{15, 65, 0}
+	if err := shard.SetBlockAt(loc, 35, 14); err != nil {
+		t.Fatalf("SetBlockAt(%v) returned error: %v", loc, err)
+	}
+
+	if blockId, blockData, ok := shard.BlockAt(loc); blockId != 35 || blockData != 14 || !ok {
+		t.Errorf("BlockAt(%v) expected (35, 14, true) got (%d, %d, %t)", loc, blockId, blockData, ok)
+	}
+	if !chunk.storeDirty {
+		t.Errorf("chunk not marked dirty")
+	}
+	if chunk.cachedPacket != nil {
+		t.Errorf("cached chunk packet not invalidated")
+	}
+
+	// The block and its neighbours are active, including the one in the next
+	// chunk.
+	for _, active := range []BlockXyz{loc, {14, 65, 0}, {16, 65, 0}, {15, 64, 0}, {15, 66, 0}, {15, 65, -1}, {15, 65, 1}} {
+		if !isActive(shard, active) {
+			t.Errorf("block %v not made active", active)
+		}
+	}
+	shard.transferActiveBlocks()
+	if len(shard.newActiveBlocks) != 0 || len(shard.newActiveShards) != 0 {
+		t.Errorf("active blocks not cleared after transfer")
+	}
+	if index, _ := (&SubChunkXyz{15, 65, 0}).BlockIndex(); !chunk.newActiveBlocks[index] {
+		t.Errorf("chunk did not receive active block")
+	}
+	connecter := shard.shardConnecter.(*testShardConnecter)
+	if blocks := connecter.activeBlocks[ShardXz{0, -1}]; len(blocks) != 1 || blocks[0] != (BlockXyz{15, 65, -1}) {
+		t.Errorf("expected block made active in neighbouring shard, got %v", blocks)
+	}
+}
+
+func TestChunkShard_SetBlockAt_Errors(t *testing.T) {
+	shard := newTestShard(t, ChunkXz{0, 0})
+
+	type Test struct {
+		loc     BlockXyz
+		blockId BlockId
+		expErr  error
+	}
+
+	var tests = []Test{
+		{BlockXyz{0, -1, 0}, 1, ErrBlockOutOfRange},
+		{BlockXyz{0, -128, 0}, 1, ErrBlockOutOfRange},
+		{BlockXyz{16, 64, 0}, 1, ErrChunkNotLoaded},
+		{BlockXyz{0, 64, -1}, 1, ErrChunkOutsideShard},
+	}
+
+	for _, r := range tests {
+		if err := shard.SetBlockAt(r.loc, r.blockId, 0); err != r.expErr {
+			t.Errorf("SetBlockAt(%v) expected error %v got %v", r.loc, r.expErr, err)
+		}
+	}
+
+	if err := shard.SetBlockAt(BlockXyz{0, 64, 0}, 255, 0); err == nil {
+		t.Errorf("SetBlockAt with unknown block type succeeded")
+	}
+	if shard.chunks[0].storeDirty || len(shard.newActiveBlocks) != 0 {
+		t.Errorf("failed SetBlockAt changed the shard")
+	}
+}
+
+func TestChunkShard_SetBlocksAt(t *testing.T) {
+	shard := newTestShard(t, ChunkXz{0, 0}, ChunkXz{1, 0})
+
+	changes := []BlockChange{
+		{BlockXyz{1, 65, 1}, 1, 0},
+		{BlockXyz{17, 65, 1}, 4, 0},
+		{BlockXyz{2, 65, 1}, 35, 3},
+		{BlockXyz{40, 65, 1}, 1, 0}, // not loaded
+	}
+
+	if err := shard.SetBlocksAt(changes); err != ErrChunkNotLoaded {
+		t.Fatalf("SetBlocksAt expected error %v got %v", ErrChunkNotLoaded, err)
+	}
+	for _, change := range changes {
+		if blockId, _, _ := shard.BlockAt(change.Loc); blockId != BlockIdAir {
+			t.Errorf("failed SetBlocksAt changed block at %v", change.Loc)
+		}
+	}
+
+	changes = changes[:3]
+	chunkChanges, err := shard.groupBlockChanges(changes)
+	if err != nil {
+		t.Fatalf("groupBlockChanges returned error: %v", err)
+	}
+	if len(chunkChanges) != 2 {
+		t.Fatalf("expected changes for 2 chunks, got %d", len(chunkChanges))
+	}
+	first := chunkChanges[0]
+	if !first.chunk.loc.Equals(ChunkXz{0, 0}) ||
+		len(first.subLocs) != 2 ||
+		first.subLocs[1] != (SubChunkXyz{2, 65, 1}) ||
+		first.blockIds[1] != 35 || first.blockData[1] != 3 {
+		t.Errorf("unexpected changes for first chunk: %+v", first)
+	}
+	if second := chunkChanges[1]; !second.chunk.loc.Equals(ChunkXz{1, 0}) || second.subLocs[0] != (SubChunkXyz{1, 65, 1}) {
+		t.Errorf("unexpected changes for second chunk: %+v", second)
+	}
+
+	if err := shard.SetBlocksAt(changes); err != nil {
+		t.Fatalf("SetBlocksAt returned error: %v", err)
+	}
+	for _, change := range changes {
+		blockId, blockData, _ := shard.BlockAt(change.Loc)
+		if blockId != change.BlockId || blockData != change.BlockData {
+			t.Errorf("block at %v is (%d, %d), expected (%d, %d)",
+				change.Loc, blockId, blockData, change.BlockId, change.BlockData)
+		}
+		if !isActive(shard, change.Loc) {
+			t.Errorf("block %v not made active", change.Loc)
+		}
+	}
+}
+
+func TestChunkShard_loadAndSetBlocksAt(t *testing.T) {
+	shard := newTestShard(t)
+
+	loc := BlockXyz{20, 70, 3}
+	if err := shard.loadAndSetBlocksAt([]BlockChange{{loc, 4, 0}}); err != nil {
+		t.Fatalf("loadAndSetBlocksAt returned error: %v", err)
+	}
+	if blockId, _, ok := shard.BlockAt(loc); !ok || blockId != 4 {
+		t.Errorf("expected block 4 at %v in loaded chunk, got %d, %v", loc, blockId, ok)
+	}
+}
+
+func TestLocalShardManager_SetBlocks(t *testing.T) {
+	entityMgr := new(entity.EntityManager)
+	entityMgr.Init()
+	mgr := NewLocalShardManager(generation.NewFlatgrassWorld(), entityMgr, clock.Real)
+	t.Cleanup(mgr.Stop)
+
+	// The changes span two shards.
+	edge := BlockCoord(ShardSize * ChunkSizeH)
+	changes := []BlockChange{
+		{BlockXyz{edge - 1, 70, 0}, 1, 0},
+		{BlockXyz{edge, 70, 0}, 4, 0},
+		{BlockXyz{edge + 1, 70, 0}, 35, 2},
+	}
+
+	type Result struct {
+		changed int
+		err     error
+	}
+	result := make(chan Result)
+	mgr.SetBlocks(changes, func(changed int, err error) {
+		result <- Result{changed, err}
+	})
+	if r := <-result; r.changed != len(changes) || r.err != nil {
+		t.Fatalf("expected %d blocks changed, got %d, %v", len(changes), r.changed, r.err)
+	}
+
+	for _, change := range changes {
+		chunkLoc, _ := change.Loc.ToChunkLocal()
+		shard := mgr.getShard(chunkLoc.ToShardXz(), false)
+		found := make(chan BlockId)
+		shard.enqueue(func() {
+			blockId, _, _ := shard.BlockAt(change.Loc)
+			found <- blockId
+		})
+		if blockId := <-found; blockId != change.BlockId {
+			t.Errorf("block at %v is %d, expected %d", change.Loc, blockId, change.BlockId)
+		}
+	}
+
+	// Bad changes fail the shard that they are in.
+	mgr.SetBlocks([]BlockChange{{BlockXyz{0, 70, 0}, 255, 0}}, func(changed int, err error) {
+		result <- Result{changed, err}
+	})
+	if r := <-result; r.changed != 0 || r.err == nil {
+		t.Errorf("expected unknown block type to fail, got %d, %v", r.changed, r.err)
+	}
+}
+
+func TestLocalShardManager_ReadBlocks(t *testing.T) {
+	entityMgr := new(entity.EntityManager)
+	entityMgr.Init()
+	mgr := NewLocalShardManager(generation.NewFlatgrassWorld(), entityMgr, clock.Real)
+	t.Cleanup(mgr.Stop)
+
+	// The box spans two shards.
+	edge := BlockCoord(ShardSize * ChunkSizeH)
+	changes := []BlockChange{
+		{BlockXyz{edge - 1, 70, 0}, 1, 0},
+		{BlockXyz{edge, 70, 1}, 35, 2},
+	}
+	changed := make(chan error)
+	mgr.SetBlocks(changes, func(_ int, err error) {
+		changed <- err
+	})
+	if err := <-changed; err != nil {
+		t.Fatal(err)
+	}
+
+	type Block struct {
+		blockId   BlockId
+		blockData byte
+	}
+	var lock sync.Mutex
+	found := make(map[BlockXyz]Block)
+	done := make(chan error)
+	mgr.ReadBlocks(BlockXyz{edge - 2, 69, 0}, BlockXyz{edge + 1, 70, 1}, func(loc BlockXyz, blockId BlockId, blockData byte) {
+		lock.Lock()
+		defer lock.Unlock()
+		if _, ok := found[loc]; ok {
+			t.Errorf("block at %v read twice", loc)
+		}
+		found[loc] = Block{blockId, blockData}
+	}, func(err error) {
+		done <- err
+	})
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if len(found) != 4*2*2 {
+		t.Errorf("expected %d blocks read, got %d", 4*2*2, len(found))
+	}
+	for _, change := range changes {
+		if b := found[change.Loc]; b.blockId != change.BlockId || b.blockData != change.BlockData {
+			t.Errorf("block at %v read as %v, expected %d/%d", change.Loc, b, change.BlockId, change.BlockData)
+		}
+	}
+	if b := found[BlockXyz{edge + 1, 70, 0}]; b.blockId != BlockIdAir {
+		t.Errorf("expected air above the ground, got %v", b)
+	}
+}
+
+func TestChunkShard_CollidingBlocks(t *testing.T) {
+	shard := newTestShard(t, ChunkXz{0, 0})
+
+	// Grass is at y=64. A slab, a fence, a torch and an open fence gate stand
+	// on it.
+	changes := []BlockChange{
+		{BlockXyz{1, 65, 1}, 44, 0},  // slab
+		{BlockXyz{3, 65, 1}, 85, 0},  // fence
+		{BlockXyz{5, 65, 1}, 50, 0},  // torch
+		{BlockXyz{7, 65, 1}, 107, 4}, // open fence gate
+	}
+	if err := shard.SetBlocksAt(changes); err != nil {
+		t.Fatal(err)
+	}
+
+	type Test struct {
+		desc     string
+		box      AABB
+		expected []BlockXyz
+		complete bool
+	}
+
+	var tests = []Test{
+		{"standing on grass", NewEntityAABB(&AbsXyz{8.5, 65, 8.5}, PlayerBoxSize), nil, true},
+		{"sunk into grass", NewEntityAABB(&AbsXyz{8.5, 64.9, 8.5}, PlayerBoxSize), []BlockXyz{{8, 64, 8}}, true},
+		{"across blocks", AABB{AbsXyz{8.5, 64.5, 8.5}, AbsXyz{9.5, 65, 8.9}}, []BlockXyz{{8, 64, 8}, {9, 64, 8}}, true},
+		{"standing on a slab", NewEntityAABB(&AbsXyz{1.5, 65.5, 1.5}, PlayerBoxSize), nil, true},
+		{"in the top of a slab", NewEntityAABB(&AbsXyz{1.5, 65.25, 1.5}, PlayerBoxSize), []BlockXyz{{1, 65, 1}}, true},
+		{"above a slab", AABB{AbsXyz{1.2, 65.6, 1.2}, AbsXyz{1.8, 65.9, 1.8}}, nil, true},
+		{"above a fence", AABB{AbsXyz{3.2, 66.2, 1.2}, AbsXyz{3.8, 66.8, 1.8}}, []BlockXyz{{3, 65, 1}}, true},
+		{"on top of a fence", AABB{AbsXyz{3.2, 66.5, 1.2}, AbsXyz{3.8, 67, 1.8}}, nil, true},
+		{"in a torch", AABB{AbsXyz{5.2, 65.2, 1.2}, AbsXyz{5.8, 65.8, 1.8}}, nil, true},
+		{"in an open fence gate", AABB{AbsXyz{7.2, 65.2, 1.2}, AbsXyz{7.8, 65.8, 1.8}}, nil, true},
+		{"into an unloaded chunk", AABB{AbsXyz{15.5, 64.5, 0.5}, AbsXyz{16.5, 65, 0.9}}, []BlockXyz{{15, 64, 0}}, false},
+		{"below the world", AABB{AbsXyz{0.5, -1, 0.5}, AbsXyz{0.9, 0.5, 0.9}}, []BlockXyz{{0, 0, 0}}, true},
+	}
+
+	for _, r := range tests {
+		collisions, complete := shard.CollidingBlocks(r.box)
+		var locs []BlockXyz
+		for _, c := range collisions {
+			locs = append(locs, c.Loc)
+			if !c.Box.Intersects(&r.box) {
+				t.Errorf("%s: returned block %v that doesn't intersect", r.desc, c.Loc)
+			}
+		}
+		if len(locs) != len(r.expected) || complete != r.complete {
+			t.Errorf("%s: expected (%v, %t) got (%v, %t)", r.desc, r.expected, r.complete, locs, complete)
+			continue
+		}
+		for i := range locs {
+			if locs[i] != r.expected[i] {
+				t.Errorf("%s: expected (%v, %t) got (%v, %t)", r.desc, r.expected, r.complete, locs, complete)
+				break
+			}
+		}
+	}
+}
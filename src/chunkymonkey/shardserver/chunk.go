@@ -3,12 +3,12 @@ package shardserver
 import (
 	"bytes"
 	"fmt"
-	"log"
 	"math/rand"
 	"time"
 
 	"chunkymonkey/chunkstore"
 	"chunkymonkey/gamerules"
+	"chunkymonkey/logger"
 	"chunkymonkey/proto"
 	. "chunkymonkey/types"
 )
@@ -22,6 +22,7 @@ type Chunk struct {
 	blockLight   []byte
 	skyLight     []byte
 	heightMap    []byte
+	biomes       []byte
 	entities     map[EntityId]gamerules.INonPlayerEntity // Entities (mobs, items, etc)
 	tileEntities map[BlockIndex]gamerules.ITileEntity    // Used by IBlockAspect to store private specific data.
 	rand         *rand.Rand
@@ -34,17 +35,64 @@ type Chunk struct {
 	activeBlocks    map[BlockIndex]bool // Blocks that need to "tick".
 	newActiveBlocks map[BlockIndex]bool // Blocks added as active for next "tick".
 	tickAll         bool                // Whether or not all blocks should be allowed to "tick" once
+
+	ticks   Ticks        // Ticks run since the chunk was loaded.
+	updates *updateQueue // Scheduled block updates. These aren't saved.
+}
+
+const (
+	chunkBlocksSize    = ChunkSizeH * ChunkSizeH * ChunkSizeY
+	chunkNibblesSize   = chunkBlocksSize >> 1
+	chunkHeightMapSize = ChunkSizeH * ChunkSizeH
+)
+
+// chunkArray returns data for use as one of the chunk's arrays. The slice
+// passed in is used directly when owned is true, meaning that the reader's
+// arrays have been claimed by the chunk, and it has the expected size.
+// Otherwise a copy is made: other readers' arrays may be shared, such as with
+// a store's cached copy or a generator's template, so the chunk never modifies
+// them. The copy is always correctly sized so that malformed chunk data can't
+// cause out of range accesses.
+func chunkArray(data []byte, size int, owned bool) []byte {
+	if owned && len(data) == size {
+		return data
+	}
+	out := make([]byte, size)
+	copy(out, data)
+	return out
+}
+
+// chunkBiomes returns the biomes for a chunk, copied unless owned. Chunks
+// saved without biome data are treated as plains.
+func chunkBiomes(biomes []byte, owned bool) []byte {
+	if len(biomes) == ChunkBiomesSize {
+		return chunkArray(biomes, ChunkBiomesSize, owned)
+	}
+	out := make([]byte, ChunkBiomesSize)
+	for i := range out {
+		out[i] = byte(BiomePlains)
+	}
+	return out
+}
+
+// readerOwned claims the reader's arrays for a new chunk, if the reader
+// allows it.
+func readerOwned(reader chunkstore.IChunkReader) bool {
+	owner, ok := reader.(chunkstore.IChunkArrayOwner)
+	return ok && owner.ClaimArrays()
 }
 
 func newChunkFromReader(reader chunkstore.IChunkReader, shard *ChunkShard) (chunk *Chunk) {
+	owned := readerOwned(reader)
 	chunk = &Chunk{
 		shard:        shard,
 		loc:          reader.ChunkLoc(),
-		blocks:       reader.Blocks(),
-		blockData:    reader.BlockData(),
-		skyLight:     reader.SkyLight(),
-		blockLight:   reader.BlockLight(),
-		heightMap:    reader.HeightMap(),
+		blocks:       chunkArray(reader.Blocks(), chunkBlocksSize, owned),
+		blockData:    chunkArray(reader.BlockData(), chunkNibblesSize, owned),
+		skyLight:     chunkArray(reader.SkyLight(), chunkNibblesSize, owned),
+		blockLight:   chunkArray(reader.BlockLight(), chunkNibblesSize, owned),
+		heightMap:    chunkArray(reader.HeightMap(), chunkHeightMapSize, owned),
+		biomes:       chunkBiomes(reader.Biomes(), owned),
 		entities:     make(map[EntityId]gamerules.INonPlayerEntity),
 		tileEntities: make(map[BlockIndex]gamerules.ITileEntity),
 		rand:         rand.New(rand.NewSource(time.Now().Unix())),
@@ -56,6 +104,8 @@ func newChunkFromReader(reader chunkstore.IChunkReader, shard *ChunkShard) (chun
 		activeBlocks:    make(map[BlockIndex]bool),
 		newActiveBlocks: make(map[BlockIndex]bool),
 		tickAll:         true,
+
+		updates: newUpdateQueue(),
 	}
 
 	entities := reader.Entities()
@@ -71,19 +121,25 @@ func newChunkFromReader(reader chunkstore.IChunkReader, shard *ChunkShard) (chun
 		blockLoc := tileEntity.Block()
 		chunkLoc, subChunk := blockLoc.ToChunkLocal()
 		if !chunk.loc.Equals(*chunkLoc) {
-			log.Printf("%v: loaded tile entity not in this chunk, but at location %#v", chunk, blockLoc)
+			logger.Chunk.Warn("Loaded tile entity not in this chunk", "chunk", chunk, "block", blockLoc)
 		} else if index, ok := subChunk.BlockIndex(); !ok {
-			log.Printf("%v: loaded tile entity at bad location %#v", chunk, blockLoc)
+			logger.Chunk.Warn("Loaded tile entity at bad location", "chunk", chunk, "block", blockLoc)
 		} else {
 			tileEntity.SetChunk(chunk)
 			chunk.tileEntities[index] = tileEntity
+			// The block is ticked once so that any that were running when the
+			// chunk was saved, such as lit furnaces, carry on.
+			chunk.AddActiveBlockIndex(index)
 		}
 	}
 
 	return
 }
 
-func (chunk *Chunk) save(chunkStore chunkstore.IChunkStore) {
+// save submits the chunk for writing to the chunk store if it has been
+// modified since it was last written, returning the result of the write, or
+// nil if there was nothing to write.
+func (chunk *Chunk) save(chunkStore chunkstore.IChunkStore) (result <-chan error) {
 	if chunk.storeDirty {
 		writer := chunkStore.Writer()
 		writer.SetChunkLoc(chunk.loc)
@@ -92,11 +148,13 @@ func (chunk *Chunk) save(chunkStore chunkstore.IChunkStore) {
 		writer.SetBlockLight(chunk.blockLight)
 		writer.SetSkyLight(chunk.skyLight)
 		writer.SetHeightMap(chunk.heightMap)
+		writer.SetBiomes(chunk.biomes)
 		writer.SetEntities(chunk.entities)
 		writer.SetTileEntities(chunk.tileEntities)
-		chunkStore.WriteChunk(writer)
+		result = chunkStore.WriteChunk(writer)
 		chunk.storeDirty = false
 	}
+	return
 }
 
 func (chunk *Chunk) String() string {
@@ -106,6 +164,47 @@ func (chunk *Chunk) String() string {
 // Sets a block and its data. Returns true if the block was not changed.
 func (chunk *Chunk) setBlock(blockLoc *BlockXyz, subLoc *SubChunkXyz, index BlockIndex, blockType BlockId, blockData byte) {
 
+	chunk.changeBlock(index, blockType, blockData)
+	chunk.shard.relight([]BlockXyz{*blockLoc})
+
+	// Tell players that the block changed.
+	packet := new(bytes.Buffer)
+	proto.WriteBlockChange(packet, blockLoc, blockType, blockData)
+	chunk.reqMulticastPlayers(-1, packet.Bytes())
+
+	return
+}
+
+// maxMultiBlockChanges is the most block changes within a chunk that players
+// are told about in a multi block change packet, at 4 bytes per change.
+// Beyond this, the whole compressed chunk is sent again instead, which is
+// typically smaller.
+const maxMultiBlockChanges = 1024
+
+// setBlocks makes several block changes within the chunk, and tells players
+// about them in a single packet.
+func (chunk *Chunk) setBlocks(changes *chunkBlockChanges) {
+	locs := make([]BlockXyz, len(changes.indices))
+	for i, index := range changes.indices {
+		chunk.changeBlock(index, changes.blockIds[i], changes.blockData[i])
+		locs[i] = *chunk.loc.ToBlockXyz(&changes.subLocs[i])
+	}
+	chunk.shard.relight(locs)
+
+	if len(changes.indices) > maxMultiBlockChanges {
+		if packet := chunk.chunkPacket(); packet != nil {
+			chunk.reqMulticastPlayers(-1, packet)
+			return
+		}
+	}
+
+	packet := new(bytes.Buffer)
+	proto.WriteBlockChangeMulti(packet, &chunk.loc, changes.subLocs, changes.blockIds, changes.blockData)
+	chunk.reqMulticastPlayers(-1, packet.Bytes())
+}
+
+// changeBlock sets a block and its data, without telling players.
+func (chunk *Chunk) changeBlock(index BlockIndex, blockType BlockId, blockData byte) {
 	// Invalidate cached packet.
 	chunk.cachedPacket = nil
 
@@ -114,19 +213,33 @@ func (chunk *Chunk) setBlock(blockLoc *BlockXyz, subLoc *SubChunkXyz, index Bloc
 
 	index.SetBlockId(chunk.blocks, blockType)
 	index.SetBlockData(chunk.blockData, blockData)
+	chunk.updateHeight(index)
 
 	delete(chunk.tileEntities, index)
+}
 
-	// Tell players that the block changed.
-	packet := new(bytes.Buffer)
-	proto.WriteBlockChange(packet, blockLoc, blockType, blockData)
-	chunk.reqMulticastPlayers(-1, packet.Bytes())
-
-	return
+// updateHeight keeps the height map, which is one above the highest block that
+// isn't air in each column, up to date with a change to the block.
+func (chunk *Chunk) updateHeight(index BlockIndex) {
+	column := int(index >> ChunkYShift)
+	height := int(chunk.heightMap[column])
+	y := int(index & ChunkYMask)
+
+	switch {
+	case chunk.blockId(index) != BlockIdAir:
+		if y >= height {
+			chunk.heightMap[column] = byte(y + 1)
+		}
+	case y == height-1:
+		top := index &^ ChunkYMask
+		for height = y; height > 0 && chunk.blockId(top+BlockIndex(height-1)) == BlockIdAir; height-- {
+		}
+		chunk.heightMap[column] = byte(height)
+	}
 }
 
 func (chunk *Chunk) blockId(index BlockIndex) BlockId {
-	return BlockId(index.BlockData(chunk.blocks))
+	return index.BlockId(chunk.blocks)
 }
 
 func (chunk *Chunk) SetBlockByIndex(blockIndex BlockIndex, blockId BlockId, blockData byte) {
@@ -141,6 +254,22 @@ func (chunk *Chunk) SetBlockByIndex(blockIndex BlockIndex, blockId BlockId, bloc
 		blockData)
 }
 
+// BlockAt implements IChunkBlock.BlockAt.
+func (chunk *Chunk) BlockAt(blockXyz *BlockXyz) (blockId BlockId, blockData byte, ok bool) {
+	return chunk.shard.BlockAt(*blockXyz)
+}
+
+// SetBlockAt implements IChunkBlock.SetBlockAt.
+func (chunk *Chunk) SetBlockAt(blockXyz *BlockXyz, blockId BlockId, blockData byte) (ok bool) {
+	return chunk.shard.SetBlockAt(*blockXyz, blockId, blockData) == nil
+}
+
+// Biome returns the biome of the column containing the block.
+func (chunk *Chunk) Biome(blockIndex BlockIndex) BiomeId {
+	subLoc := blockIndex.ToSubChunkXyz()
+	return BiomeId(chunk.biomes[subLoc.BiomeIndex()])
+}
+
 func (chunk *Chunk) Rand() *rand.Rand {
 	return chunk.rand
 }
@@ -156,17 +285,22 @@ func (chunk *Chunk) transferEntity(s gamerules.INonPlayerEntity) {
 	chunk.storeDirty = true
 }
 
-// AddEntity creates a mob or item in this chunk and notifies all chunk
-// subscribers of the new entity
+// AddEntity creates a mob or item in this chunk and notifies the chunk
+// subscribers within range of the new entity
 func (chunk *Chunk) AddEntity(s gamerules.INonPlayerEntity) {
 	newEntityId := chunk.shard.entityMgr.NewEntity()
 	s.SetEntityId(newEntityId)
 	chunk.entities[newEntityId] = s
 
 	// Spawn new item/mob for players.
-	buf := &bytes.Buffer{}
-	s.SendSpawn(buf)
-	chunk.reqMulticastPlayers(-1, buf.Bytes())
+	trackingRange := entityTrackingRange(s)
+	for entityId, player := range chunk.subscribers {
+		buf := new(bytes.Buffer)
+		chunk.shard.tracker(entityId).update(buf, newEntityId, s.Position(), trackingRange, s.SendSpawn)
+		if buf.Len() > 0 {
+			player.TransmitPacket(buf.Bytes())
+		}
+	}
 
 	chunk.storeDirty = true
 }
@@ -175,14 +309,36 @@ func (chunk *Chunk) removeEntity(s gamerules.INonPlayerEntity) {
 	e := s.GetEntityId()
 	chunk.shard.entityMgr.RemoveEntityById(e)
 	delete(chunk.entities, e)
-	// Tell all subscribers that the spawn's entity is destroyed.
+	// Tell the subscribers that were shown the entity that it is destroyed.
 	buf := new(bytes.Buffer)
 	proto.WriteEntityDestroy(buf, e)
-	chunk.reqMulticastPlayers(-1, buf.Bytes())
+	chunk.multicastTracked(e, buf.Bytes())
+	chunk.forgetEntity(e)
 
 	chunk.storeDirty = true
 }
 
+// forgetEntity stops the players tracking the entity, without telling their
+// clients.
+func (chunk *Chunk) forgetEntity(entityId EntityId) {
+	for _, t := range chunk.shard.trackers {
+		t.forget(entityId)
+	}
+}
+
+// multicastTracked sends the packet about the entity to the subscribers whose
+// clients have it, other than the entity itself.
+func (chunk *Chunk) multicastTracked(entityId EntityId, packet []byte) {
+	for subscriberId, player := range chunk.subscribers {
+		if subscriberId == entityId {
+			continue
+		}
+		if t, ok := chunk.shard.trackers[subscriberId]; ok && t.tracked[entityId] {
+			player.TransmitPacket(packet)
+		}
+	}
+}
+
 func (chunk *Chunk) TileEntity(index BlockIndex) gamerules.ITileEntity {
 	if tileEntity, ok := chunk.tileEntities[index]; ok {
 		return tileEntity
@@ -203,17 +359,13 @@ func (chunk *Chunk) getBlockIndexByBlockXyz(blockLoc *BlockXyz) (index BlockInde
 	chunkLoc, subLoc := blockLoc.ToChunkLocal()
 
 	if chunkLoc.X != chunk.loc.X || chunkLoc.Z != chunk.loc.Z {
-		log.Printf(
-			"%v.getBlockIndexByBlockXyz: position (%T%#v) is not within chunk",
-			chunk, blockLoc, blockLoc)
+		logger.Chunk.Warn("getBlockIndexByBlockXyz: position is not within chunk", "chunk", chunk, "block", blockLoc)
 		return 0, nil, false
 	}
 
 	index, ok = subLoc.BlockIndex()
 	if !ok {
-		log.Printf(
-			"%v.getBlockIndexByBlockXyz: invalid position (%T%#v) within chunk",
-			chunk, blockLoc, blockLoc)
+		logger.Chunk.Warn("getBlockIndexByBlockXyz: invalid position within chunk", "chunk", chunk, "block", blockLoc)
 	}
 
 	return
@@ -224,10 +376,7 @@ func (chunk *Chunk) blockTypeAndData(index BlockIndex) (blockType *gamerules.Blo
 
 	blockType, ok = gamerules.Blocks.Get(blockTypeId)
 	if !ok {
-		log.Printf(
-			"%v.blockTypeAndData: unknown block type %d at index %d",
-			chunk, blockTypeId, index,
-		)
+		logger.Chunk.Warn("blockTypeAndData: unknown block type", "chunk", chunk, "type", blockTypeId, "index", index)
 		return nil, 0, false
 	}
 
@@ -265,7 +414,18 @@ func (chunk *Chunk) reqHitBlock(player gamerules.IPlayerClient, held gamerules.S
 		return
 	}
 
-	if blockType.Destructable && blockType.Aspect.Hit(blockInstance, player, digStatus) {
+	// Bedrock is all that keeps players out of the void, so it is never
+	// broken whatever the block definitions say. There is no creative mode in
+	// which it could be.
+	if index := blockInstance.Index; index.BlockId(chunk.blocks) == BlockIdBedrock || !blockType.Destructable {
+		// The client removes the block once it thinks it has been dug.
+		if digStatus == DigBlockBroke {
+			chunk.reqResendBlock(player, target)
+		}
+		return
+	}
+
+	if blockType.Aspect.Hit(blockInstance, player, digStatus) {
 		blockType.Aspect.Destroy(blockInstance)
 		chunk.setBlock(target, &blockInstance.SubLoc, blockInstance.Index, BlockIdAir, 0)
 	}
@@ -304,12 +464,31 @@ func (chunk *Chunk) reqInteractBlock(player gamerules.IPlayerClient, held gameru
 	return
 }
 
+// reqResendBlock sends the player the block as it is, undoing a change that
+// their client made before it was refused.
+func (chunk *Chunk) reqResendBlock(player gamerules.IPlayerClient, target *BlockXyz) {
+	index, _, ok := chunk.getBlockIndexByBlockXyz(target)
+	if !ok {
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	proto.WriteBlockChange(buf, target, index.BlockId(chunk.blocks), index.BlockData(chunk.blockData))
+	player.TransmitPacket(buf.Bytes())
+}
+
 // placeBlock attempts to place a block. This is called by PlayerBlockInteract
 // in the situation where the player interacts with an attachable block
 // (potentially in a different chunk to the one where the block gets placed).
 func (chunk *Chunk) reqPlaceItem(player gamerules.IPlayerClient, target *BlockXyz, slot *gamerules.Slot) {
-	// TODO defer a check for remaining items in slot, and do something with them
-	// (send to player or drop on the ground).
+	// An item that isn't placed goes back to the player, and their client,
+	// which shows the block placed already, is told the block as it is.
+	defer func() {
+		if slot.Count > 0 {
+			chunk.reqResendBlock(player, target)
+			player.GiveItemAtPosition(target.MidPointToAbsXyz(), *slot)
+		}
+	}()
 
 	// TODO more flexible item checking for block placement (e.g placing seed
 	// items on farmland doesn't fit this current simplistic model). The block
@@ -338,9 +517,46 @@ func (chunk *Chunk) reqPlaceItem(player gamerules.IPlayerClient, target *BlockXy
 	// Allow this block to tick once
 	chunk.AddActiveBlockIndex(index)
 
+	// Only the player placing a sign may write it.
+	if blockInstance, placedType, ok := chunk.blockInstanceAndType(target); ok {
+		if aspect, ok := placedType.Aspect.(*gamerules.SignAspect); ok {
+			aspect.Placed(blockInstance, player.GetEntityId())
+		}
+	}
+
 	slot.Decrement()
 }
 
+// reqSetSignText writes the text on a sign that the player placed. Everyone
+// subscribed to the chunk is sent the sign's text, or just the player if the
+// sign couldn't be written, such as when someone else placed it.
+func (chunk *Chunk) reqSetSignText(player gamerules.IPlayerClient, target *BlockXyz, lines [4]string) {
+	blockInstance, blockType, ok := chunk.blockInstanceAndType(target)
+	if !ok {
+		return
+	}
+	aspect, ok := blockType.Aspect.(*gamerules.SignAspect)
+	if !ok {
+		return
+	}
+
+	sign, ok := aspect.SetText(blockInstance, player.GetEntityId(), lines)
+	if sign == nil {
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	if err := sign.SendUpdate(buf); err != nil {
+		logger.Chunk.Warn("Failed to write sign update", "chunk", chunk, "block", target, "err", err)
+		return
+	}
+	if ok {
+		chunk.reqMulticastPlayers(-1, buf.Bytes())
+	} else {
+		player.TransmitPacket(buf.Bytes())
+	}
+}
+
 func (chunk *Chunk) reqTakeItem(player gamerules.IPlayerClient, entityId EntityId) {
 	if entity, ok := chunk.entities[entityId]; ok {
 		if item, ok := entity.(*gamerules.Item); ok {
@@ -356,6 +572,62 @@ func (chunk *Chunk) reqTakeItem(player gamerules.IPlayerClient, entityId EntityI
 	}
 }
 
+// reqUseEntity attacks or interacts with the target entity on behalf of the
+// player at position. Targets that aren't in this chunk are ignored, as the
+// player asks every chunk within reach.
+func (chunk *Chunk) reqUseEntity(player gamerules.IPlayerClient, held *gamerules.Slot, position *AbsXyz, target EntityId, leftClick bool) {
+	if data, ok := chunk.playersData[target]; ok {
+		if !leftClick {
+			return
+		}
+		if !data.position.WithinSphere(position, MaxInteractDistance) {
+			logger.Entity.Debug("Ignoring attack on player: too far away", "chunk", chunk, "player", player.GetEntityId(), "target", target)
+			return
+		}
+		if targetPlayer, ok := chunk.subscribers[target]; ok {
+			knockback := gamerules.Knockback(position, &data.position)
+			targetPlayer.AttackedByPlayer(player.GetEntityId(), held.AttackDamage(), knockback)
+		}
+		return
+	}
+
+	entity, ok := chunk.entities[target]
+	if !ok {
+		return
+	}
+	if !entity.Position().WithinSphere(position, MaxInteractDistance) {
+		logger.Entity.Debug("Ignoring use of entity: too far away", "chunk", chunk, "player", player.GetEntityId(), "target", target)
+		return
+	}
+
+	if leftClick {
+		attackable, ok := entity.(gamerules.IAttackable)
+		if !ok {
+			return
+		}
+		knockback := gamerules.Knockback(position, entity.Position())
+		killed := attackable.Attacked(held.AttackDamage(), &knockback)
+
+		buf := new(bytes.Buffer)
+		if killed {
+			proto.WriteEntityStatus(buf, target, EntityStatusDead)
+		} else {
+			proto.WriteEntityStatus(buf, target, EntityStatusHurt)
+		}
+		chunk.reqMulticastPlayers(-1, buf.Bytes())
+		if killed {
+			chunk.removeEntity(entity)
+		}
+	} else {
+		interactable, ok := entity.(gamerules.IInteractable)
+		if !ok {
+			return
+		}
+		interactable.Interact(player, held, chunk)
+	}
+	chunk.storeDirty = true
+}
+
 func (chunk *Chunk) reqDropItem(player gamerules.IPlayerClient, content *gamerules.Slot, position *AbsXyz, velocity *AbsVelocity, pickupImmunity Ticks) {
 	spawnedItem := gamerules.NewItem(
 		content.ItemTypeId,
@@ -378,6 +650,16 @@ func (chunk *Chunk) reqInventoryClick(player gamerules.IPlayerClient, blockLoc *
 	blockType.Aspect.InventoryClick(blockInstance, player, click)
 }
 
+func (chunk *Chunk) reqInventoryPutItem(player gamerules.IPlayerClient, blockLoc *BlockXyz, item *gamerules.Slot) {
+	blockInstance, blockType, ok := chunk.blockInstanceAndType(blockLoc)
+	if !ok {
+		player.GiveItemAtPosition(blockLoc.MidPointToAbsXyz(), *item)
+		return
+	}
+
+	blockType.Aspect.InventoryPutItem(blockInstance, player, item)
+}
+
 func (chunk *Chunk) reqInventoryUnsubscribed(player gamerules.IPlayerClient, blockLoc *BlockXyz) {
 	blockInstance, blockType, ok := chunk.blockInstanceAndType(blockLoc)
 	if !ok {
@@ -401,7 +683,7 @@ func (chunk *Chunk) BlockQuery(blockLoc BlockXyz) (isSolid bool, isWithinChunk b
 		// The item is asking about this chunk.
 		index, ok := subLoc.BlockIndex()
 		if !ok {
-			log.Printf("%s.PhysicsBlockQuery(%#v) got bad block index", chunk, blockLoc)
+			logger.Entity.Warn("PhysicsBlockQuery got bad block index", "chunk", chunk, "block", blockLoc)
 			isSolid = true
 			return
 		}
@@ -424,9 +706,7 @@ func (chunk *Chunk) BlockQuery(blockLoc BlockXyz) (isSolid bool, isWithinChunk b
 	if blockType, ok := gamerules.Blocks.Get(blockTypeId); ok {
 		isSolid = blockType.Solid
 	} else {
-		log.Printf(
-			"%s.PhysicsBlockQuery found unknown block type Id %d at %+v",
-			chunk, blockTypeId, blockLoc)
+		logger.Entity.Warn("PhysicsBlockQuery found unknown block type", "chunk", chunk, "type", blockTypeId, "block", blockLoc)
 		// The block type isn't known.
 		isSolid = true
 	}
@@ -435,7 +715,9 @@ func (chunk *Chunk) BlockQuery(blockLoc BlockXyz) (isSolid bool, isWithinChunk b
 }
 
 func (chunk *Chunk) tick() {
+	chunk.ticks++
 	chunk.spawnTick()
+	chunk.updateTick()
 	if chunk.tickAll {
 		chunk.tickAll = false
 		chunk.blockTickAll()
@@ -461,6 +743,9 @@ func (chunk *Chunk) spawnTick() {
 			} else {
 				outgoingEntities = append(outgoingEntities, e)
 			}
+		} else if lander, ok := e.(gamerules.ILandingEntity); ok && lander.OnGround() {
+			lander.Land(chunk)
+			chunk.removeEntity(e)
 		}
 	}
 
@@ -566,9 +851,8 @@ func (chunk *Chunk) AddActiveBlockIndex(blockIndex BlockIndex) {
 func (chunk *Chunk) mobs() (s []*gamerules.Mob) {
 	s = make([]*gamerules.Mob, 0, 3)
 	for _, e := range chunk.entities {
-		switch e.(type) {
-		case *gamerules.Mob:
-			s = append(s, e.(*gamerules.Mob))
+		if mob, ok := e.(gamerules.IMob); ok {
+			s = append(s, mob.GetMob())
 		}
 	}
 	return
@@ -588,6 +872,9 @@ func (chunk *Chunk) items() (s []*gamerules.Item) {
 func (chunk *Chunk) reqSubscribeChunk(entityId EntityId, player gamerules.IPlayerClient, notify bool) {
 	if _, ok := chunk.subscribers[entityId]; ok {
 		// Already subscribed.
+		if notify {
+			player.NotifyChunkLoad(chunk.loc, true)
+		}
 		return
 	}
 
@@ -598,17 +885,34 @@ func (chunk *Chunk) reqSubscribeChunk(entityId EntityId, player gamerules.IPlaye
 	player.TransmitPacket(buf.Bytes())
 
 	player.TransmitPacket(chunk.chunkPacket())
+
+	// Send the tile entities that clients show, such as the text of signs.
+	if len(chunk.tileEntities) > 0 {
+		buf := new(bytes.Buffer)
+		for _, tileEntity := range chunk.tileEntities {
+			if sent, ok := tileEntity.(gamerules.ISentTileEntity); ok {
+				sent.SendUpdate(buf)
+			}
+		}
+		if buf.Len() > 0 {
+			player.TransmitPacket(buf.Bytes())
+		}
+	}
+
 	if notify {
-		player.NotifyChunkLoad()
+		player.NotifyChunkLoad(chunk.loc, true)
 	}
 
-	// Send spawns packets for all entities in the chunk.
+	// Send spawns packets for the entities in the chunk within range.
+	t := chunk.shard.tracker(entityId)
 	if len(chunk.entities) > 0 {
 		buf := new(bytes.Buffer)
 		for _, e := range chunk.entities {
-			e.SendSpawn(buf)
+			t.update(buf, e.GetEntityId(), e.Position(), entityTrackingRange(e), e.SendSpawn)
+		}
+		if buf.Len() > 0 {
+			player.TransmitPacket(buf.Bytes())
 		}
-		player.TransmitPacket(buf.Bytes())
 	}
 
 	// Spawn existing players for new player.
@@ -616,10 +920,12 @@ func (chunk *Chunk) reqSubscribeChunk(entityId EntityId, player gamerules.IPlaye
 		playersPacket := new(bytes.Buffer)
 		for _, existing := range chunk.playersData {
 			if existing.entityId != entityId {
-				existing.sendSpawn(playersPacket)
+				t.update(playersPacket, existing.entityId, &existing.position, AbsCoord(*playerTrackingRange), existing.sendSpawn)
 			}
 		}
-		player.TransmitPacket(playersPacket.Bytes())
+		if playersPacket.Len() > 0 {
+			player.TransmitPacket(playersPacket.Bytes())
+		}
 	}
 }
 
@@ -635,10 +941,23 @@ func (chunk *Chunk) reqUnsubscribeChunk(entityId EntityId, sendPacket bool) {
 			}
 		}
 
+		// The client forgets the entities in the chunk along with it.
+		buf := new(bytes.Buffer)
+		if t, ok := chunk.shard.trackers[entityId]; ok {
+			for _, e := range chunk.entities {
+				if t.forget(e.GetEntityId()) {
+					proto.WriteEntityDestroy(buf, e.GetEntityId())
+				}
+			}
+			for _, other := range chunk.playersData {
+				if other.entityId != entityId && t.forget(other.entityId) {
+					proto.WriteEntityDestroy(buf, other.entityId)
+				}
+			}
+		}
+
 		if sendPacket {
-			buf := new(bytes.Buffer)
 			proto.WritePreChunk(buf, &chunk.loc, ChunkUnload)
-			// TODO send PacketEntityDestroy packets for spawns in this chunk.
 			player.TransmitPacket(buf.Bytes())
 		}
 	}
@@ -687,21 +1006,40 @@ func (chunk *Chunk) reqMulticastPlayers(exclude EntityId, packet []byte) {
 	}
 }
 
-func (chunk *Chunk) reqAddPlayerData(entityId EntityId, name string, pos AbsXyz, look LookBytes, held ItemTypeId) {
+func (chunk *Chunk) reqAddPlayerData(entityId EntityId, name string, pos AbsXyz, look LookBytes, equipment *gamerules.PlayerEquipment) {
 	// TODO add other initial data in here.
 	newPlayerData := &playerData{
-		entityId:   entityId,
-		name:       name,
-		position:   pos,
-		look:       look,
-		heldItemId: held,
+		entityId:  entityId,
+		name:      name,
+		position:  pos,
+		look:      look,
+		equipment: *equipment,
 	}
 	chunk.playersData[entityId] = newPlayerData
 
-	// Spawn new player for existing players.
-	newPlayerPacket := new(bytes.Buffer)
-	newPlayerData.sendSpawn(newPlayerPacket)
-	chunk.reqMulticastPlayers(entityId, newPlayerPacket.Bytes())
+	// Spawn new player for existing players within range. Those already
+	// shown the player from a neighbouring chunk don't need it again.
+	chunk.updatePlayerTracking(newPlayerData, false)
+}
+
+// updatePlayerTracking spawns and destroys the player for subscribers as they
+// come into and go out of range, and sends the player's position and look to
+// those in range if sendPositionLook is set.
+func (chunk *Chunk) updatePlayerTracking(data *playerData, sendPositionLook bool) {
+	trackingRange := AbsCoord(*playerTrackingRange)
+	for entityId, player := range chunk.subscribers {
+		if entityId == data.entityId {
+			continue
+		}
+		buf := new(bytes.Buffer)
+		tracked := chunk.shard.tracker(entityId).update(buf, data.entityId, &data.position, trackingRange, data.sendSpawn)
+		if tracked && sendPositionLook {
+			data.sendPositionLook(buf)
+		}
+		if buf.Len() > 0 {
+			player.TransmitPacket(buf.Bytes())
+		}
+	}
 }
 
 func (chunk *Chunk) reqRemovePlayerData(entityId EntityId, isDisconnect bool) {
@@ -710,7 +1048,8 @@ func (chunk *Chunk) reqRemovePlayerData(entityId EntityId, isDisconnect bool) {
 	if isDisconnect {
 		buf := new(bytes.Buffer)
 		proto.WriteEntityDestroy(buf, entityId)
-		chunk.reqMulticastPlayers(entityId, buf.Bytes())
+		chunk.multicastTracked(entityId, buf.Bytes())
+		chunk.forgetEntity(entityId)
 	}
 }
 
@@ -718,19 +1057,14 @@ func (chunk *Chunk) reqSetPlayerPosition(entityId EntityId, pos AbsXyz) {
 	data, ok := chunk.playersData[entityId]
 
 	if !ok {
-		log.Printf(
-			"%v.reqSetPlayerPosition: called for EntityId (%d) not present as playerData.",
-			chunk, entityId,
-		)
+		logger.Entity.Warn("reqSetPlayerPosition: player not present in chunk", "chunk", chunk, "player", entityId)
 		return
 	}
 
 	data.position = pos
 
 	// Update subscribers.
-	buf := new(bytes.Buffer)
-	data.sendPositionLook(buf)
-	chunk.reqMulticastPlayers(entityId, buf.Bytes())
+	chunk.updatePlayerTracking(data, true)
 
 	player, ok := chunk.subscribers[entityId]
 
@@ -754,10 +1088,7 @@ func (chunk *Chunk) reqSetPlayerLook(entityId EntityId, look LookBytes) {
 	data, ok := chunk.playersData[entityId]
 
 	if !ok {
-		log.Printf(
-			"%v.reqSetPlayerLook: called for EntityId (%d) not present as playerData.",
-			chunk, entityId,
-		)
+		logger.Entity.Warn("reqSetPlayerLook: player not present in chunk", "chunk", chunk, "player", entityId)
 		return
 	}
 
@@ -766,25 +1097,77 @@ func (chunk *Chunk) reqSetPlayerLook(entityId EntityId, look LookBytes) {
 	// Update subscribers.
 	buf := new(bytes.Buffer)
 	data.sendPositionLook(buf)
-	chunk.reqMulticastPlayers(entityId, buf.Bytes())
+	chunk.multicastTracked(entityId, buf.Bytes())
 }
 
+func (chunk *Chunk) reqSetPlayerEquipment(entityId EntityId, slotId SlotId, item *gamerules.Slot) {
+	data, ok := chunk.playersData[entityId]
+
+	if !ok {
+		logger.Entity.Warn("reqSetPlayerEquipment: player not present in chunk", "chunk", chunk, "player", entityId)
+		return
+	}
+
+	if slotId < 0 || slotId >= gamerules.NumEquipmentSlots {
+		return
+	}
+
+	data.equipment[slotId] = *item
+
+	// Update subscribers.
+	buf := new(bytes.Buffer)
+	item.SendEquipmentUpdate(buf, entityId, slotId)
+	chunk.multicastTracked(entityId, buf.Bytes())
+}
+
+// chunkPacket returns the map chunk packet for the chunk. The packet is
+// compressed once and the same slice is queued directly for every subscriber,
+// so it must not be modified. Changes to the chunk replace the cached packet
+// rather than altering it.
 func (chunk *Chunk) chunkPacket() []byte {
 	if chunk.cachedPacket == nil {
-		buf := new(bytes.Buffer)
-		proto.WriteMapChunk(buf, &chunk.loc, chunk.blocks, chunk.blockData, chunk.blockLight, chunk.skyLight)
-		chunk.cachedPacket = buf.Bytes()
+		packet, err := proto.MapChunkPacket(&chunk.loc, chunk.blocks, chunk.blockData, chunk.blockLight, chunk.skyLight)
+		if err != nil {
+			logger.Chunk.Error("Failed to create chunk packet", "chunk", chunk, "err", err)
+			return nil
+		}
+		chunk.cachedPacket = packet
 	}
 
 	return chunk.cachedPacket
 }
 
+// sendUpdate sends each subscriber the movements of the entities in range of
+// them, and spawns and destroys entities and players that have come into or
+// gone out of range.
 func (chunk *Chunk) sendUpdate() {
-	buf := &bytes.Buffer{}
-	for _, e := range chunk.entities {
+	// Entities keep track of what they last sent, so their updates must only
+	// be made once.
+	updates := make(map[EntityId][]byte, len(chunk.entities))
+	for entityId, e := range chunk.entities {
+		buf := new(bytes.Buffer)
 		e.SendUpdate(buf)
+		updates[entityId] = buf.Bytes()
+	}
+
+	playerRange := AbsCoord(*playerTrackingRange)
+	for entityId, player := range chunk.subscribers {
+		t := chunk.shard.tracker(entityId)
+		buf := new(bytes.Buffer)
+		for otherId, e := range chunk.entities {
+			if t.update(buf, otherId, e.Position(), entityTrackingRange(e), e.SendSpawn) {
+				buf.Write(updates[otherId])
+			}
+		}
+		for _, other := range chunk.playersData {
+			if other.entityId != entityId {
+				t.update(buf, other.entityId, &other.position, playerRange, other.sendSpawn)
+			}
+		}
+		if buf.Len() > 0 {
+			player.TransmitPacket(buf.Bytes())
+		}
 	}
-	chunk.reqMulticastPlayers(-1, buf.Bytes())
 }
 
 func (chunk *Chunk) isSameChunk(otherChunkLoc *ChunkXz) bool {
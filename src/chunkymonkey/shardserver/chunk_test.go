@@ -0,0 +1,291 @@
+package shardserver
+
+import (
+	"bytes"
+	"testing"
+
+	"chunkymonkey/chunkstore"
+	"chunkymonkey/clock"
+	"chunkymonkey/entity"
+	"chunkymonkey/gamerules"
+	"chunkymonkey/generation"
+	"chunkymonkey/proto"
+	. "chunkymonkey/types"
+)
+
+func init() {
+	// The data files are at the root of the repository.
+	err := gamerules.LoadGameRules(
+		"../../../blocks.json", "../../../items.json", "../../../recipes.json",
+		"../../../furnace.json", "../../../users.json", "../../../groups.json")
+	if err != nil {
+		panic(err)
+	}
+}
+
+func newTestChunk(t *testing.T, store chunkstore.IChunkStoreForeground, loc ChunkXz) *Chunk {
+	reader, err := store.ReadChunk(loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entityMgr := new(entity.EntityManager)
+	entityMgr.Init()
+	shard := NewChunkShard(nil, chunkstore.NewChunkService(store), entityMgr, loc.ToShardXz(), clock.Real)
+
+	return newChunkFromReader(reader, shard)
+}
+
+// TestChunk_LoadCopiesArrays checks that changing a loaded chunk doesn't
+// change the arrays of the reader it was loaded from, which belong to the
+// store or generator.
+func TestChunk_LoadCopiesArrays(t *testing.T) {
+	loc := ChunkXz{0, 0}
+	memStore := chunkstore.NewMemoryStore()
+	writer := memStore.Writer()
+	writer.SetChunkLoc(loc)
+	blocks := make([]byte, ChunkSizeH*ChunkSizeH*ChunkSizeY)
+	for i := range blocks {
+		blocks[i] = 1 // Stone.
+	}
+	writer.SetBlocks(blocks)
+	if err := memStore.WriteChunk(writer); err != nil {
+		t.Fatal(err)
+	}
+
+	stores := []struct {
+		name  string
+		store chunkstore.IChunkStoreForeground
+	}{
+		{"memory store", memStore},
+		{"flatgrass generator", generation.NewFlatgrassGenerator(generation.SeaLevel)},
+	}
+
+	for _, test := range stores {
+		// The bottom block is stone or bedrock.
+		chunk := newTestChunk(t, test.store, loc)
+		chunk.SetBlockByIndex(0, BlockIdAir, 0)
+
+		reader, err := test.store.ReadChunk(loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if blockId := BlockIndex(0).BlockId(reader.Blocks()); blockId == BlockIdAir {
+			t.Errorf("%s: stored block changed along with the loaded chunk", test.name)
+		}
+	}
+}
+
+// claimableReader is a reader whose arrays can be claimed, as if they were
+// freshly decoded.
+type claimableReader struct {
+	chunkstore.IChunkReader
+	claimed bool
+}
+
+func (r *claimableReader) ClaimArrays() bool {
+	claimable := !r.claimed
+	r.claimed = true
+	return claimable
+}
+
+// TestChunk_LoadClaimsArrays checks that a chunk uses the arrays of a reader
+// that it can claim them from, rather than copying them.
+func TestChunk_LoadClaimsArrays(t *testing.T) {
+	loc := ChunkXz{0, 0}
+	stored, err := generation.NewFlatgrassGenerator(generation.SeaLevel).ReadChunk(loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := &claimableReader{IChunkReader: stored}
+
+	entityMgr := new(entity.EntityManager)
+	entityMgr.Init()
+	shard := NewChunkShard(nil, chunkstore.NewChunkService(chunkstore.NewMemoryStore()), entityMgr, loc.ToShardXz(), clock.Real)
+	chunk := newChunkFromReader(reader, shard)
+
+	if !reader.claimed {
+		t.Fatal("Expected the chunk to claim the reader's arrays")
+	}
+	if &chunk.blocks[0] != &reader.Blocks()[0] {
+		t.Errorf("Expected the chunk to use the claimed blocks rather than a copy")
+	}
+}
+
+// TestChunk_DigToVoid digs down through generated columns and checks that
+// every solid block is dug except the bedrock.
+func TestChunk_DigToVoid(t *testing.T) {
+	chunk := newTestChunk(t, generation.NewTestGenerator(0), ChunkXz{0, 0})
+	player := &testPlayerClient{entityId: 100}
+
+	for x := BlockCoord(0); x < ChunkSizeH; x++ {
+		for y := BlockYCoord(ChunkSizeY - 1); y >= 0; y-- {
+			target := BlockXyz{X: x, Y: y, Z: 3}
+			chunk.reqHitBlock(player, gamerules.Slot{}, DigBlockBroke, &target, FaceTop)
+		}
+
+		for y := 0; y < ChunkSizeY; y++ {
+			subLoc := SubChunkXyz{X: SubChunkCoord(x), Y: SubChunkCoord(y), Z: 3}
+			index, _ := subLoc.BlockIndex()
+			blockId := index.BlockId(chunk.blocks)
+			blockType, _ := gamerules.Blocks.Get(blockId)
+			switch {
+			case y == 0 && blockId != BlockIdBedrock:
+				t.Fatalf("column %d: block at y=0 is %d after digging, want bedrock", x, blockId)
+			case blockId != BlockIdBedrock && blockType.Solid:
+				t.Fatalf("column %d: block %d at y=%d not dug", x, blockId, y)
+			}
+		}
+	}
+}
+
+// testPlayerClient records the packets sent to a player, and the items given
+// to them. Calls to other IPlayerClient methods panic.
+type testPlayerClient struct {
+	gamerules.IPlayerClient
+	entityId EntityId
+	packets  [][]byte
+	given    []gamerules.Slot
+}
+
+func (p *testPlayerClient) GetEntityId() EntityId {
+	return p.entityId
+}
+
+func (p *testPlayerClient) TransmitPacket(packet []byte) {
+	p.packets = append(p.packets, packet)
+}
+
+func (p *testPlayerClient) GiveItemAtPosition(atPosition AbsXyz, item gamerules.Slot) {
+	p.given = append(p.given, item)
+}
+
+func TestChunk_UnsubscribeDestroysEntities(t *testing.T) {
+	chunk := newTestChunk(t, generation.NewTestGenerator(0), ChunkXz{0, 0})
+	player := &testPlayerClient{entityId: 100}
+	chunk.reqSubscribeChunk(player.entityId, player, false)
+
+	item := gamerules.NewItem(1, 1, 0, &AbsXyz{8, 70, 8}, &AbsVelocity{}, 0)
+	chunk.AddEntity(item)
+	chunk.reqAddPlayerData(101, "other", AbsXyz{4, 70, 4}, LookBytes{}, &gamerules.PlayerEquipment{})
+	chunk.reqAddPlayerData(player.entityId, "self", AbsXyz{8, 70, 8}, LookBytes{}, &gamerules.PlayerEquipment{})
+
+	player.packets = nil
+	chunk.reqUnsubscribeChunk(player.entityId, true)
+	if len(player.packets) != 1 {
+		t.Fatalf("expected 1 packet, got %d", len(player.packets))
+	}
+
+	expected := new(bytes.Buffer)
+	proto.WriteEntityDestroy(expected, item.EntityId)
+	proto.WriteEntityDestroy(expected, 101)
+	proto.WritePreChunk(expected, &chunk.loc, ChunkUnload)
+	if !bytes.Equal(player.packets[0], expected.Bytes()) {
+		t.Errorf("expected packets %x, got %x", expected.Bytes(), player.packets[0])
+	}
+}
+
+func TestChunk_SetBlocksResend(t *testing.T) {
+	chunk := newTestChunk(t, generation.NewTestGenerator(0), ChunkXz{0, 0})
+	player := &testPlayerClient{entityId: 100}
+	chunk.reqSubscribeChunk(player.entityId, player, false)
+
+	changesFor := func(count int) *chunkBlockChanges {
+		changes := &chunkBlockChanges{chunk: chunk}
+		for i := 0; i < count; i++ {
+			subLoc := SubChunkXyz{SubChunkCoord(i % ChunkSizeH), SubChunkCoord(100 + i/(ChunkSizeH*ChunkSizeH)), SubChunkCoord(i / ChunkSizeH % ChunkSizeH)}
+			index, _ := subLoc.BlockIndex()
+			changes.indices = append(changes.indices, index)
+			changes.subLocs = append(changes.subLocs, subLoc)
+			changes.blockIds = append(changes.blockIds, 1)
+			changes.blockData = append(changes.blockData, 0)
+		}
+		return changes
+	}
+
+	type Test struct {
+		count    int
+		packetId byte
+	}
+
+	var tests = []Test{
+		{1, proto.PacketIdBlockChangeMulti},
+		{maxMultiBlockChanges, proto.PacketIdBlockChangeMulti},
+		{maxMultiBlockChanges + 1, proto.PacketIdMapChunk},
+	}
+
+	for _, test := range tests {
+		player.packets = nil
+		chunk.setBlocks(changesFor(test.count))
+		if len(player.packets) != 1 || player.packets[0][0] != test.packetId {
+			t.Errorf("%d changes: expected a packet 0x%02x, got %d packets", test.count, test.packetId, len(player.packets))
+		}
+		if !chunk.storeDirty {
+			t.Errorf("%d changes: expected chunk to be marked to be stored", test.count)
+		}
+	}
+}
+
+func TestChunk_ResendBlock(t *testing.T) {
+	chunk := newTestChunk(t, generation.NewTestGenerator(0), ChunkXz{0, 0})
+	player := &testPlayerClient{entityId: 100}
+
+	target := BlockXyz{3, 0, 5}
+	chunk.reqResendBlock(player, &target)
+
+	expected := new(bytes.Buffer)
+	proto.WriteBlockChange(expected, &target, BlockIdBedrock, 0)
+	if len(player.packets) != 1 || !bytes.Equal(player.packets[0], expected.Bytes()) {
+		t.Errorf("expected packet %x, got %x", expected.Bytes(), player.packets)
+	}
+}
+
+func TestChunk_PlaceItem(t *testing.T) {
+	chunk := newTestChunk(t, generation.NewFlatgrassGenerator(generation.SeaLevel), ChunkXz{0, 0})
+	player := &testPlayerClient{entityId: 100}
+
+	// Placed in the air above the grass.
+	height := BlockYCoord(chunk.heightMap[3<<ChunkHShift|5])
+	target := BlockXyz{3, height, 5}
+	slot := gamerules.Slot{ItemTypeId: 1, Count: 1}
+	chunk.reqPlaceItem(player, &target, &slot)
+	index, _, _ := chunk.getBlockIndexByBlockXyz(&target)
+	if blockId := index.BlockId(chunk.blocks); blockId != 1 {
+		t.Errorf("Expected block 1 to be placed, got %d", blockId)
+	}
+	if slot.Count != 0 || len(player.given) != 0 {
+		t.Errorf("Expected the item to be used, got %v and %v given back", slot, player.given)
+	}
+
+	// Blocks that can't be replaced are left, and the item given back.
+	target = BlockXyz{3, height - 1, 5}
+	slot = gamerules.Slot{ItemTypeId: 1, Count: 1}
+	chunk.reqPlaceItem(player, &target, &slot)
+	index, _, _ = chunk.getBlockIndexByBlockXyz(&target)
+	expected := new(bytes.Buffer)
+	proto.WriteBlockChange(expected, &target, index.BlockId(chunk.blocks), index.BlockData(chunk.blockData))
+	if len(player.packets) != 1 || !bytes.Equal(player.packets[0], expected.Bytes()) {
+		t.Errorf("Expected block to be resent, got %x", player.packets)
+	}
+	if len(player.given) != 1 || player.given[0].ItemTypeId != 1 || player.given[0].Count != 1 {
+		t.Errorf("Expected the item to be given back, got %v", player.given)
+	}
+}
+
+func TestChunk_HitBedrockResends(t *testing.T) {
+	chunk := newTestChunk(t, generation.NewTestGenerator(0), ChunkXz{0, 0})
+	player := &testPlayerClient{entityId: 100}
+
+	target := BlockXyz{3, 0, 5}
+	chunk.reqHitBlock(player, gamerules.Slot{}, DigStarted, &target, FaceTop)
+	if len(player.packets) != 0 {
+		t.Errorf("Expected nothing to be sent when starting to dig, got %x", player.packets)
+	}
+
+	chunk.reqHitBlock(player, gamerules.Slot{}, DigBlockBroke, &target, FaceTop)
+	expected := new(bytes.Buffer)
+	proto.WriteBlockChange(expected, &target, BlockIdBedrock, 0)
+	if len(player.packets) != 1 || !bytes.Equal(player.packets[0], expected.Bytes()) {
+		t.Errorf("Expected bedrock to be resent, got %x", player.packets)
+	}
+}
@@ -0,0 +1,13 @@
+package shardserver
+
+import (
+	. "chunkymonkey/types"
+)
+
+// fallBrokenAt returns true if a player landing at position doesn't take fall
+// damage, because their feet are in water. Blocks that can't be looked at are
+// assumed not to break the fall.
+func (shard *ChunkShard) fallBrokenAt(position *AbsXyz) bool {
+	blockId, _, ok := shard.BlockAt(*position.ToBlockXyz())
+	return ok && (blockId == BlockIdWater || blockId == BlockIdStationaryWater)
+}
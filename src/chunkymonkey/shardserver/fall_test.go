@@ -0,0 +1,33 @@
+package shardserver
+
+import (
+	"testing"
+
+	. "chunkymonkey/types"
+)
+
+func TestChunkShard_FallBrokenAt(t *testing.T) {
+	shard := newTestShard(t, ChunkXz{0, 0})
+	shard.SetBlockAt(BlockXyz{8, 64, 8}, BlockIdStationaryWater, 0)
+	shard.SetBlockAt(BlockXyz{9, 64, 8}, BlockIdWater, 0)
+
+	type Test struct {
+		position AbsXyz
+		expected bool
+	}
+
+	var tests = []Test{
+		{AbsXyz{8.5, 64, 8.5}, true},
+		{AbsXyz{9.5, 64.5, 8.5}, true},
+		{AbsXyz{10.5, 64, 8.5}, false},
+		{AbsXyz{8.5, 65, 8.5}, false},
+		// Outside the shard.
+		{AbsXyz{-100, 64, 8.5}, false},
+	}
+
+	for _, test := range tests {
+		if result := shard.fallBrokenAt(&test.position); result != test.expected {
+			t.Errorf("fallBrokenAt(%v) expected %t got %t", test.position, test.expected, result)
+		}
+	}
+}
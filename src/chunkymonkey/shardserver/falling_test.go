@@ -0,0 +1,71 @@
+package shardserver
+
+import (
+	"testing"
+
+	"chunkymonkey/gamerules"
+	. "chunkymonkey/types"
+)
+
+const testSand = BlockId(12)
+
+func runShard(shard *ChunkShard, ticks Ticks) {
+	for i := Ticks(0); i < ticks; i++ {
+		shard.tick()
+	}
+}
+
+func fallingBlocks(chunk *Chunk) (n int) {
+	for _, e := range chunk.entities {
+		if _, ok := e.(*gamerules.FallingBlock); ok {
+			n++
+		}
+	}
+	return
+}
+
+func TestFallingBlock_Lands(t *testing.T) {
+	shard := newTestShard(t, ChunkXz{0, 0})
+	chunk := shard.chunkAt(ChunkXz{0, 0})
+
+	setTestBlock(t, shard, BlockXyz{8, 70, 8}, testStone)
+	setTestBlock(t, shard, BlockXyz{8, 71, 8}, testSand)
+	runShard(shard, TicksPerSecond)
+	if blockId, _, _ := shard.BlockAt(BlockXyz{8, 71, 8}); blockId != testSand {
+		t.Fatalf("supported sand fell")
+	}
+
+	setTestBlock(t, shard, BlockXyz{8, 70, 8}, BlockIdAir)
+	runShard(shard, 5)
+	if blockId, _, _ := shard.BlockAt(BlockXyz{8, 71, 8}); blockId != BlockIdAir {
+		t.Errorf("unsupported sand didn't fall, found block %d", blockId)
+	}
+	if n := fallingBlocks(chunk); n != 1 {
+		t.Errorf("expected 1 falling block, got %d", n)
+	}
+
+	runShard(shard, 5*TicksPerSecond)
+	if blockId, _, _ := shard.BlockAt(BlockXyz{8, 65, 8}); blockId != testSand {
+		t.Errorf("expected sand to land on the ground, found block %d", blockId)
+	}
+	if n := fallingBlocks(chunk); n != 0 {
+		t.Errorf("expected falling block to be removed, got %d", n)
+	}
+}
+
+func TestFallingBlock_Drops(t *testing.T) {
+	shard := newTestShard(t, ChunkXz{0, 0})
+	chunk := shard.chunkAt(ChunkXz{0, 0})
+
+	setTestBlock(t, shard, BlockXyz{4, 65, 4}, testTorch)
+	setTestBlock(t, shard, BlockXyz{4, 70, 4}, testSand)
+	runShard(shard, 5*TicksPerSecond)
+
+	if blockId, _, _ := shard.BlockAt(BlockXyz{4, 65, 4}); blockId != testTorch {
+		t.Errorf("expected the torch to remain, found block %d", blockId)
+	}
+	items := chunk.items()
+	if len(items) != 1 || items[0].ItemTypeId != ItemTypeId(testSand) || items[0].Count != 1 {
+		t.Errorf("expected sand to drop as an item, got %v", items)
+	}
+}
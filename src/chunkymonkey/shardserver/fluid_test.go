@@ -0,0 +1,111 @@
+package shardserver
+
+import (
+	"testing"
+
+	. "chunkymonkey/types"
+)
+
+const (
+	testStationaryLava = BlockId(11)
+	testLava           = BlockId(10)
+	testObsidian       = BlockId(49)
+	testCobblestone    = BlockId(4)
+)
+
+// settleFluids runs the shard for long enough that fluids near each other stop
+// flowing.
+func settleFluids(shard *ChunkShard) {
+	for i := 0; i < 40*TicksPerSecond; i++ {
+		shard.tick()
+	}
+}
+
+func setTestBlock(t *testing.T, shard *ChunkShard, loc BlockXyz, blockId BlockId) {
+	if err := shard.SetBlockAt(loc, blockId, 0); err != nil {
+		t.Fatalf("SetBlockAt(%v) returned error: %v", loc, err)
+	}
+}
+
+type fluidTest struct {
+	loc       BlockXyz
+	blockId   BlockId
+	blockData byte
+}
+
+func checkBlocks(t *testing.T, shard *ChunkShard, tests []fluidTest) {
+	for _, test := range tests {
+		blockId, blockData, _ := shard.BlockAt(test.loc)
+		if blockId != test.blockId || blockData != test.blockData {
+			t.Errorf("block at %v expected (%d, %d) got (%d, %d)", test.loc, test.blockId, test.blockData, blockId, blockData)
+		}
+	}
+}
+
+func TestFluid_Spread(t *testing.T) {
+	shard := newTestShard(t, ChunkXz{0, 0})
+
+	// A pit for water to fall into.
+	setTestBlock(t, shard, BlockXyz{8, 64, 11}, BlockIdAir)
+	setTestBlock(t, shard, BlockXyz{8, 65, 8}, BlockIdWater)
+	settleFluids(shard)
+
+	checkBlocks(t, shard, []fluidTest{
+		{BlockXyz{8, 65, 8}, BlockIdStationaryWater, 0},
+		{BlockXyz{9, 65, 8}, BlockIdStationaryWater, 1},
+		{BlockXyz{9, 65, 9}, BlockIdStationaryWater, 2},
+		{BlockXyz{15, 65, 8}, BlockIdStationaryWater, 7},
+		{BlockXyz{1, 65, 8}, BlockIdStationaryWater, 7},
+		{BlockXyz{0, 65, 8}, BlockIdAir, 0},
+		{BlockXyz{8, 65, 1}, BlockIdStationaryWater, 7},
+		{BlockXyz{8, 64, 11}, BlockIdStationaryWater, 0x8 | 3},
+		{BlockXyz{8, 66, 8}, BlockIdAir, 0},
+	})
+
+	// Without its source, the water dries up.
+	setTestBlock(t, shard, BlockXyz{8, 65, 8}, BlockIdAir)
+	settleFluids(shard)
+
+	checkBlocks(t, shard, []fluidTest{
+		{BlockXyz{9, 65, 8}, BlockIdAir, 0},
+		{BlockXyz{15, 65, 8}, BlockIdAir, 0},
+		{BlockXyz{8, 64, 11}, BlockIdAir, 0},
+	})
+}
+
+func TestFluid_InfiniteWater(t *testing.T) {
+	shard := newTestShard(t, ChunkXz{0, 0})
+
+	setTestBlock(t, shard, BlockXyz{2, 65, 2}, BlockIdWater)
+	setTestBlock(t, shard, BlockXyz{4, 65, 2}, BlockIdWater)
+	settleFluids(shard)
+
+	checkBlocks(t, shard, []fluidTest{
+		{BlockXyz{3, 65, 2}, BlockIdStationaryWater, 0},
+		{BlockXyz{5, 65, 2}, BlockIdStationaryWater, 1},
+	})
+}
+
+func TestFluid_Lava(t *testing.T) {
+	shard := newTestShard(t, ChunkXz{0, 0})
+
+	setTestBlock(t, shard, BlockXyz{8, 65, 8}, testLava)
+	settleFluids(shard)
+
+	checkBlocks(t, shard, []fluidTest{
+		{BlockXyz{8, 65, 8}, testStationaryLava, 0},
+		{BlockXyz{9, 65, 8}, testStationaryLava, 2},
+		{BlockXyz{11, 65, 8}, testStationaryLava, 6},
+		{BlockXyz{12, 65, 8}, BlockIdAir, 0},
+	})
+
+	// Water touching the lava source turns it to obsidian, and flowing lava to
+	// cobblestone.
+	setTestBlock(t, shard, BlockXyz{8, 66, 8}, BlockIdWater)
+	settleFluids(shard)
+
+	checkBlocks(t, shard, []fluidTest{
+		{BlockXyz{8, 65, 8}, testObsidian, 0},
+		{BlockXyz{8, 65, 9}, testCobblestone, 0},
+	})
+}
@@ -0,0 +1,202 @@
+package shardserver
+
+import (
+	"chunkymonkey/gamerules"
+	. "chunkymonkey/types"
+)
+
+const maxLight = 15
+
+// lightKind is one of the two kinds of light held for each block.
+type lightKind int
+
+const (
+	blockLightKind = lightKind(iota) // Given off by blocks such as torches.
+	skyLightKind                     // Shining down from the sky.
+)
+
+// lightNode is a block queued for relighting.
+type lightNode struct {
+	chunk *Chunk
+	index BlockIndex
+	loc   BlockXyz
+	level byte // The light that the block had, when it is being darkened.
+}
+
+// light returns the light of the given kind at the block.
+func (chunk *Chunk) light(kind lightKind, index BlockIndex) byte {
+	if kind == skyLightKind {
+		return index.BlockData(chunk.skyLight)
+	}
+	return index.BlockData(chunk.blockLight)
+}
+
+// setLight sets the light of the given kind at the block. The chunk packet
+// includes the light, so it must be made again.
+func (chunk *Chunk) setLight(kind lightKind, index BlockIndex, level byte) {
+	if kind == skyLightKind {
+		index.SetBlockData(chunk.skyLight, level)
+	} else {
+		index.SetBlockData(chunk.blockLight, level)
+	}
+	chunk.cachedPacket = nil
+	chunk.storeDirty = true
+}
+
+// blockLightAttrs returns the opacity and emission of the block.
+func (chunk *Chunk) blockLightAttrs(index BlockIndex) (opacity, emission byte) {
+	if blockType, ok := gamerules.Blocks.Get(chunk.blockId(index)); ok {
+		return byte(blockType.Opacity), byte(blockType.Emission)
+	}
+	return maxLight, 0
+}
+
+// lightNode returns the block at loc for relighting, if its chunk is loaded.
+func (shard *ChunkShard) lightNode(loc *BlockXyz) (node lightNode, ok bool) {
+	chunk, index, _, err := shard.loadedBlock(loc)
+	if err != nil {
+		return
+	}
+	return lightNode{chunk: chunk, index: index, loc: *loc}, true
+}
+
+// relight updates the light of both kinds around the blocks, which have
+// changed. The light is spread to and from the chunks loaded within the shard.
+// Clients work out the light themselves as blocks change, so they aren't
+// told about it, but it is in the chunk data sent to them.
+func (shard *ChunkShard) relight(locs []BlockXyz) {
+	shard.relightKind(blockLightKind, locs)
+	shard.relightKind(skyLightKind, locs)
+}
+
+// relightKind updates the light of the given kind around the blocks. Light
+// that came from or through the blocks is first taken away, spreading
+// outwards until light from elsewhere is met. That light, and any that the
+// blocks themselves give, is then spread back into the darkened blocks.
+func (shard *ChunkShard) relightKind(kind lightKind, locs []BlockXyz) {
+	var darkened, lit []lightNode
+
+	for i := range locs {
+		node, ok := shard.lightNode(&locs[i])
+		if !ok {
+			continue
+		}
+		if level := node.chunk.light(kind, node.index); level > 0 {
+			node.chunk.setLight(kind, node.index, 0)
+			node.level = level
+			darkened = append(darkened, node)
+		}
+		lit = shard.lightSource(kind, node, lit)
+		for _, face := range AllFaces() {
+			d := face.Offset()
+			if neighbourLoc := node.loc.AddXyz(d.X, d.Y, d.Z); neighbourLoc != nil {
+				if neighbour, ok := shard.lightNode(neighbourLoc); ok {
+					lit = append(lit, neighbour)
+				}
+			}
+		}
+	}
+
+	for len(darkened) > 0 {
+		node := darkened[len(darkened)-1]
+		darkened = darkened[:len(darkened)-1]
+
+		for _, face := range AllFaces() {
+			d := face.Offset()
+			neighbourLoc := node.loc.AddXyz(d.X, d.Y, d.Z)
+			if neighbourLoc == nil {
+				continue
+			}
+			neighbour, ok := shard.lightNode(neighbourLoc)
+			if !ok {
+				continue
+			}
+			level := neighbour.chunk.light(kind, neighbour.index)
+			if level == 0 {
+				continue
+			}
+			if level < node.level || skyShaft(kind, face, node.level, level) {
+				// The neighbour was lit from this block.
+				neighbour.chunk.setLight(kind, neighbour.index, 0)
+				neighbour.level = level
+				darkened = append(darkened, neighbour)
+				lit = shard.lightSource(kind, neighbour, lit)
+			} else {
+				// The neighbour is lit from elsewhere, and can light this block
+				// again.
+				lit = append(lit, neighbour)
+			}
+		}
+	}
+
+	for len(lit) > 0 {
+		node := lit[len(lit)-1]
+		lit = lit[:len(lit)-1]
+
+		level := node.chunk.light(kind, node.index)
+		if level <= 1 {
+			continue
+		}
+		for _, face := range AllFaces() {
+			d := face.Offset()
+			neighbourLoc := node.loc.AddXyz(d.X, d.Y, d.Z)
+			if neighbourLoc == nil {
+				continue
+			}
+			neighbour, ok := shard.lightNode(neighbourLoc)
+			if !ok {
+				continue
+			}
+			opacity, _ := neighbour.chunk.blockLightAttrs(neighbour.index)
+			spread := spreadLight(kind, face, level, opacity)
+			if spread > neighbour.chunk.light(kind, neighbour.index) {
+				neighbour.chunk.setLight(kind, neighbour.index, spread)
+				lit = append(lit, neighbour)
+			}
+		}
+	}
+}
+
+// lightSource gives the block any light that it has of its own: the light
+// that it gives off for block light, or that of the sky above it at the top of
+// the world for sky light. It is queued to spread the light if so.
+func (shard *ChunkShard) lightSource(kind lightKind, node lightNode, lit []lightNode) []lightNode {
+	opacity, emission := node.chunk.blockLightAttrs(node.index)
+
+	var level byte
+	if kind == blockLightKind {
+		level = emission
+	} else if node.loc.Y == MaxYCoord {
+		level = spreadLight(kind, FaceBottom, maxLight, opacity)
+	}
+
+	if level > node.chunk.light(kind, node.index) {
+		node.chunk.setLight(kind, node.index, level)
+		return append(lit, node)
+	}
+	return lit
+}
+
+// spreadLight returns the light that a block of the given opacity gets from a
+// neighbour with the given light, in the direction of face from the
+// neighbour. Light loses at least one level with each block that it spreads
+// to, except that full sky light shines straight down through clear blocks.
+func spreadLight(kind lightKind, face Face, level, opacity byte) byte {
+	if opacity == 0 && skyShaft(kind, face, level, maxLight) {
+		return maxLight
+	}
+	if opacity < 1 {
+		opacity = 1
+	}
+	if level <= opacity {
+		return 0
+	}
+	return level - opacity
+}
+
+// skyShaft returns true if light spreading down in the direction of face from a
+// block with light level to one with light below is full sky light shining
+// straight down.
+func skyShaft(kind lightKind, face Face, level, below byte) bool {
+	return kind == skyLightKind && face == FaceBottom && level == maxLight && below == maxLight
+}
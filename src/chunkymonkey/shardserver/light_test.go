@@ -0,0 +1,130 @@
+package shardserver
+
+import (
+	"testing"
+
+	. "chunkymonkey/types"
+)
+
+const (
+	testStone = BlockId(1)
+	testTorch = BlockId(50)
+	testGlass = BlockId(20)
+)
+
+type lightTest struct {
+	loc   BlockXyz
+	level byte
+}
+
+func checkLight(t *testing.T, shard *ChunkShard, kind lightKind, tests []lightTest) {
+	for _, test := range tests {
+		node, ok := shard.lightNode(&test.loc)
+		if !ok {
+			t.Fatalf("block %v not loaded", test.loc)
+		}
+		if level := node.chunk.light(kind, node.index); level != test.level {
+			t.Errorf("light %d at %v expected %d got %d", kind, test.loc, test.level, level)
+		}
+	}
+}
+
+func TestChunkShard_BlockLight(t *testing.T) {
+	shard := newTestShard(t, ChunkXz{0, 0}, ChunkXz{1, 0})
+	chunk := shard.chunkAt(ChunkXz{0, 0})
+	chunk.chunkPacket()
+
+	setTestBlock(t, shard, BlockXyz{14, 65, 8}, testTorch)
+	if chunk.cachedPacket != nil {
+		t.Errorf("cached chunk packet not invalidated")
+	}
+
+	// The light spreads into the next chunk, but not through the ground.
+	checkLight(t, shard, blockLightKind, []lightTest{
+		{BlockXyz{14, 65, 8}, 14},
+		{BlockXyz{15, 65, 8}, 13},
+		{BlockXyz{17, 65, 8}, 11},
+		{BlockXyz{14, 67, 10}, 10},
+		{BlockXyz{14, 64, 8}, 0},
+		{BlockXyz{0, 65, 8}, 0},
+	})
+
+	setTestBlock(t, shard, BlockXyz{14, 65, 8}, BlockIdAir)
+
+	checkLight(t, shard, blockLightKind, []lightTest{
+		{BlockXyz{14, 65, 8}, 0},
+		{BlockXyz{15, 65, 8}, 0},
+		{BlockXyz{17, 65, 8}, 0},
+		{BlockXyz{14, 67, 10}, 0},
+	})
+}
+
+func TestChunkShard_SkyLight(t *testing.T) {
+	shard := newTestShard(t, ChunkXz{0, 0})
+
+	var roof []BlockChange
+	for x := BlockCoord(6); x <= 10; x++ {
+		for z := BlockCoord(6); z <= 10; z++ {
+			roof = append(roof, BlockChange{BlockXyz{x, 70, z}, testStone, 0})
+		}
+	}
+	if err := shard.SetBlocksAt(roof); err != nil {
+		t.Fatal(err)
+	}
+
+	checkLight(t, shard, skyLightKind, []lightTest{
+		{BlockXyz{8, 71, 8}, 15},
+		{BlockXyz{8, 70, 8}, 0},
+		{BlockXyz{8, 69, 8}, 12},
+		{BlockXyz{8, 65, 8}, 12},
+		{BlockXyz{6, 65, 8}, 14},
+		{BlockXyz{5, 65, 8}, 15},
+	})
+
+	// Sky light shines through glass, and loses some in water.
+	setTestBlock(t, shard, BlockXyz{8, 70, 8}, testGlass)
+	setTestBlock(t, shard, BlockXyz{8, 68, 8}, BlockIdStationaryWater)
+
+	checkLight(t, shard, skyLightKind, []lightTest{
+		{BlockXyz{8, 70, 8}, 15},
+		{BlockXyz{8, 69, 8}, 15},
+		{BlockXyz{8, 68, 8}, 12},
+		{BlockXyz{8, 67, 8}, 12},
+		{BlockXyz{7, 69, 8}, 14},
+	})
+
+	setTestBlock(t, shard, BlockXyz{8, 68, 8}, BlockIdAir)
+
+	checkLight(t, shard, skyLightKind, []lightTest{
+		{BlockXyz{8, 68, 8}, 15},
+		{BlockXyz{8, 65, 8}, 15},
+		{BlockXyz{8, 64, 8}, 0},
+	})
+}
+
+func TestChunk_UpdateHeight(t *testing.T) {
+	shard := newTestShard(t, ChunkXz{0, 0})
+	chunk := shard.chunkAt(ChunkXz{0, 0})
+	column := 3<<ChunkHShift | 5
+
+	type Test struct {
+		loc     BlockXyz
+		blockId BlockId
+		height  byte
+	}
+
+	tests := []Test{
+		{BlockXyz{3, 80, 5}, testStone, 81},
+		{BlockXyz{3, 70, 5}, testStone, 81},
+		{BlockXyz{3, 80, 5}, BlockIdAir, 71},
+		{BlockXyz{3, 70, 5}, BlockIdAir, 65},
+		{BlockXyz{3, 64, 5}, BlockIdAir, 64},
+	}
+
+	for _, test := range tests {
+		setTestBlock(t, shard, test.loc, test.blockId)
+		if height := chunk.heightMap[column]; height != test.height {
+			t.Errorf("setting %d at %v expected height %d got %d", test.blockId, test.loc, test.height, height)
+		}
+	}
+}
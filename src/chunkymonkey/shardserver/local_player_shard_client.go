@@ -26,10 +26,27 @@ func (conn *localPlayerShardClient) Disconnect() {
 	conn.shard.enqueueAllChunks(func(chunk *Chunk) {
 		chunk.reqUnsubscribeChunk(conn.entityId, false)
 	})
+	conn.shard.enqueue(func() {
+		delete(conn.shard.trackers, conn.entityId)
+	})
+}
+
+func (conn *localPlayerShardClient) ReqSetTrackingPosition(position AbsXyz) {
+	conn.shard.enqueue(func() {
+		conn.shard.tracker(conn.entityId).setPosition(&position)
+	})
 }
 
 func (conn *localPlayerShardClient) ReqSubscribeChunk(chunkLoc ChunkXz, notify bool) {
-	conn.shard.enqueueOnChunk(chunkLoc, func(chunk *Chunk) {
+	conn.shard.enqueue(func() {
+		chunk := conn.shard.chunkAt(chunkLoc)
+		if chunk == nil {
+			// The player must still be told, so that they aren't left waiting.
+			if notify {
+				conn.player.NotifyChunkLoad(chunkLoc, false)
+			}
+			return
+		}
 		chunk.reqSubscribeChunk(conn.entityId, conn.player, notify)
 	})
 }
@@ -46,9 +63,9 @@ func (conn *localPlayerShardClient) ReqMulticastPlayers(chunkLoc ChunkXz, exclud
 	})
 }
 
-func (conn *localPlayerShardClient) ReqAddPlayerData(chunkLoc ChunkXz, name string, position AbsXyz, look LookBytes, held ItemTypeId) {
+func (conn *localPlayerShardClient) ReqAddPlayerData(chunkLoc ChunkXz, name string, position AbsXyz, look LookBytes, equipment gamerules.PlayerEquipment) {
 	conn.shard.enqueueOnChunk(chunkLoc, func(chunk *Chunk) {
-		chunk.reqAddPlayerData(conn.entityId, name, position, look, held)
+		chunk.reqAddPlayerData(conn.entityId, name, position, look, &equipment)
 	})
 }
 
@@ -70,6 +87,12 @@ func (conn *localPlayerShardClient) ReqSetPlayerLook(chunkLoc ChunkXz, look Look
 	})
 }
 
+func (conn *localPlayerShardClient) ReqSetPlayerEquipment(chunkLoc ChunkXz, slotId SlotId, item gamerules.Slot) {
+	conn.shard.enqueueOnChunk(chunkLoc, func(chunk *Chunk) {
+		chunk.reqSetPlayerEquipment(conn.entityId, slotId, &item)
+	})
+}
+
 func (conn *localPlayerShardClient) ReqHitBlock(held gamerules.Slot, target BlockXyz, digStatus DigStatus, face Face) {
 	chunkLoc := target.ToChunkXz()
 
@@ -86,6 +109,12 @@ func (conn *localPlayerShardClient) ReqInteractBlock(held gamerules.Slot, target
 	})
 }
 
+func (conn *localPlayerShardClient) ReqResendBlock(target BlockXyz) {
+	conn.shard.enqueueOnChunk(*target.ToChunkXz(), func(chunk *Chunk) {
+		chunk.reqResendBlock(conn.player, &target)
+	})
+}
+
 func (conn *localPlayerShardClient) ReqPlaceItem(target BlockXyz, slot gamerules.Slot) {
 	chunkLoc, _ := target.ToChunkLocal()
 
@@ -94,6 +123,43 @@ func (conn *localPlayerShardClient) ReqPlaceItem(target BlockXyz, slot gamerules
 	})
 }
 
+func (conn *localPlayerShardClient) ReqSetSignText(target BlockXyz, lines [4]string) {
+	chunkLoc := target.ToChunkXz()
+	conn.shard.enqueueOnChunk(*chunkLoc, func(chunk *Chunk) {
+		chunk.reqSetSignText(conn.player, &target, lines)
+	})
+}
+
+func (conn *localPlayerShardClient) ReqUseEntity(chunkLoc ChunkXz, held gamerules.Slot, position AbsXyz, target EntityId, leftClick bool) {
+	conn.shard.enqueueOnChunk(chunkLoc, func(chunk *Chunk) {
+		chunk.reqUseEntity(conn.player, &held, &position, target, leftClick)
+	})
+}
+
+func (conn *localPlayerShardClient) ReqBedSpawn(bed BlockXyz) {
+	conn.shard.enqueue(func() {
+		// The bed's chunk is loaded first, as the player must always be told.
+		conn.shard.chunkAt(*bed.ToChunkXz())
+		position, ok := conn.shard.bedSpawnPosition(bed)
+		conn.player.NotifyBedSpawn(position, ok)
+	})
+}
+
+func (conn *localPlayerShardClient) ReqSpawnPosition(position AbsXyz) {
+	conn.shard.enqueue(func() {
+		conn.shard.chunkAt(position.ToChunkXz())
+		conn.player.NotifySpawnPosition(conn.shard.spawnPosition(position))
+	})
+}
+
+func (conn *localPlayerShardClient) ReqLanded(position AbsXyz, fallDistance float32) {
+	conn.shard.enqueue(func() {
+		if !conn.shard.fallBrokenAt(&position) {
+			conn.player.NotifyFall(fallDistance)
+		}
+	})
+}
+
 func (conn *localPlayerShardClient) ReqTakeItem(chunkLoc ChunkXz, entityId EntityId) {
 	conn.shard.enqueueOnChunk(chunkLoc, func(chunk *Chunk) {
 		chunk.reqTakeItem(conn.player, entityId)
@@ -114,6 +180,13 @@ func (conn *localPlayerShardClient) ReqInventoryClick(block BlockXyz, click game
 	})
 }
 
+func (conn *localPlayerShardClient) ReqInventoryPutItem(block BlockXyz, item gamerules.Slot) {
+	chunkLoc := block.ToChunkXz()
+	conn.shard.enqueueOnChunk(*chunkLoc, func(chunk *Chunk) {
+		chunk.reqInventoryPutItem(conn.player, &block, &item)
+	})
+}
+
 func (conn *localPlayerShardClient) ReqInventoryUnsubscribed(block BlockXyz) {
 	chunkLoc := block.ToChunkXz()
 	conn.shard.enqueueOnChunk(*chunkLoc, func(chunk *Chunk) {
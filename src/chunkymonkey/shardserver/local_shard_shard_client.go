@@ -25,6 +25,12 @@ func (client *localShardShardClient) ReqSetActiveBlocks(blocks []BlockXyz) {
 	})
 }
 
+func (client *localShardShardClient) ReqScheduleUpdate(block BlockXyz, delay Ticks) {
+	client.serverShard.enqueue(func() {
+		client.serverShard.reqScheduleUpdate(&block, delay)
+	})
+}
+
 func (client *localShardShardClient) ReqTransferEntity(loc ChunkXz, entity gamerules.INonPlayerEntity) {
 	client.serverShard.enqueue(func() {
 		chunk := client.serverShard.chunkAt(loc)
@@ -4,6 +4,7 @@ import (
 	"sync"
 
 	"chunkymonkey/chunkstore"
+	"chunkymonkey/clock"
 	"chunkymonkey/entity"
 	"chunkymonkey/gamerules"
 	. "chunkymonkey/types"
@@ -15,14 +16,24 @@ import (
 type LocalShardManager struct {
 	entityMgr  *entity.EntityManager
 	chunkStore chunkstore.IChunkStore
+	clock      clock.Clock
 	shards     map[uint64]*ChunkShard
 	lock       sync.Mutex
+	// savesPaused stops new shards from saving, as set by SetSaving.
+	savesPaused bool
+	// border is the world border of new shards, as set by SetWorldBorder.
+	border WorldBorder
+	// worldTime is the time source of new shards, as set by SetWorldTime.
+	worldTime func() Ticks
+	// stopped is set by Stop, after which new shards aren't served.
+	stopped bool
 }
 
-func NewLocalShardManager(chunkStore chunkstore.IChunkStore, entityMgr *entity.EntityManager) *LocalShardManager {
+func NewLocalShardManager(chunkStore chunkstore.IChunkStore, entityMgr *entity.EntityManager, clk clock.Clock) *LocalShardManager {
 	return &LocalShardManager{
 		entityMgr:  entityMgr,
 		chunkStore: chunkStore,
+		clock:      clk,
 		shards:     make(map[uint64]*ChunkShard),
 	}
 }
@@ -39,13 +50,45 @@ func (mgr *LocalShardManager) getShard(loc ShardXz, create bool) *ChunkShard {
 	}
 
 	// Create shard.
-	shard := NewChunkShard(mgr, mgr.chunkStore, mgr.entityMgr, loc)
+	shard := NewChunkShard(mgr, mgr.chunkStore, mgr.entityMgr, loc, mgr.clock)
+	if mgr.savesPaused {
+		shard.saveChunks = false
+	}
+	shard.border = mgr.border
+	shard.worldTime = mgr.worldTime
 	mgr.shards[shardKey] = shard
-	go shard.serve()
+	if mgr.stopped {
+		close(shard.quit)
+		close(shard.done)
+	} else {
+		go shard.serve()
+	}
 
 	return shard
 }
 
+// Stop stops every shard, returning once they have stopped. Modified chunks
+// are not saved, so SaveChunks should be called first. The shards drop any
+// requests made afterwards, so methods that wait for the shards, such as
+// SaveChunks, must not be called after Stop.
+func (mgr *LocalShardManager) Stop() {
+	mgr.lock.Lock()
+	if mgr.stopped {
+		mgr.lock.Unlock()
+		return
+	}
+	mgr.stopped = true
+	shards := make([]*ChunkShard, 0, len(mgr.shards))
+	for _, shard := range mgr.shards {
+		shards = append(shards, shard)
+	}
+	mgr.lock.Unlock()
+
+	for _, shard := range shards {
+		shard.stop()
+	}
+}
+
 func (mgr *LocalShardManager) PlayerShardConnect(entityId EntityId, player gamerules.IPlayerClient, shardLoc ShardXz) gamerules.IPlayerShardClient {
 	mgr.lock.Lock()
 	defer mgr.lock.Unlock()
@@ -67,6 +110,213 @@ func (mgr *LocalShardManager) ShardShardConnect(shardLoc ShardXz) gamerules.ISha
 	return newLocalShardShardClient(shard)
 }
 
+// SetBlocks makes the block changes in the shards that they are in, loading
+// their chunks if need be. Each shard makes its changes as
+// ChunkShard.SetBlocksAt does, so either all or none of the changes within a
+// shard are made. done, if not nil, is called once all of the shards have
+// finished, with the number of blocks changed and the first error.
+func (mgr *LocalShardManager) SetBlocks(changes []BlockChange, done func(changed int, err error)) {
+	byShard := make(map[ShardXz][]BlockChange)
+	var shardLocs []ShardXz
+	for _, change := range changes {
+		chunkLoc, _ := change.Loc.ToChunkLocal()
+		shardLoc := chunkLoc.ToShardXz()
+		if _, ok := byShard[shardLoc]; !ok {
+			shardLocs = append(shardLocs, shardLoc)
+		}
+		byShard[shardLoc] = append(byShard[shardLoc], change)
+	}
+
+	var wg sync.WaitGroup
+	var resultLock sync.Mutex
+	var changed int
+	var firstErr error
+
+	mgr.lock.Lock()
+	for _, shardLoc := range shardLocs {
+		shard := mgr.getShard(shardLoc, true)
+		shardChanges := byShard[shardLoc]
+		wg.Add(1)
+		shard.enqueue(func() {
+			defer wg.Done()
+			err := shard.loadAndSetBlocksAt(shardChanges)
+
+			resultLock.Lock()
+			defer resultLock.Unlock()
+			if err == nil {
+				changed += len(shardChanges)
+			} else if firstErr == nil {
+				firstErr = err
+			}
+		})
+	}
+	mgr.lock.Unlock()
+
+	if done != nil {
+		go func() {
+			wg.Wait()
+			done(changed, firstErr)
+		}()
+	}
+}
+
+// ReadBlocks calls fn with the type and data of each block within the box
+// from min to max inclusive, loading chunks if need be. Each shard reads its
+// part of the box on its own goroutine, so fn may be called concurrently. done
+// is called once all of the shards have finished, with the first error.
+func (mgr *LocalShardManager) ReadBlocks(min, max BlockXyz, fn func(loc BlockXyz, blockId BlockId, blockData byte), done func(err error)) {
+	minShard := min.ToChunkXz().ToShardXz()
+	maxShard := max.ToChunkXz().ToShardXz()
+
+	var wg sync.WaitGroup
+	var resultLock sync.Mutex
+	var firstErr error
+
+	mgr.lock.Lock()
+	for x := minShard.X; x <= maxShard.X; x++ {
+		for z := minShard.Z; z <= maxShard.Z; z++ {
+			shard := mgr.getShard(ShardXz{x, z}, true)
+			wg.Add(1)
+			shard.enqueue(func() {
+				defer wg.Done()
+				if err := shard.readBlocks(min, max, fn); err != nil {
+					resultLock.Lock()
+					defer resultLock.Unlock()
+					if firstErr == nil {
+						firstErr = err
+					}
+				}
+			})
+		}
+	}
+	mgr.lock.Unlock()
+
+	go func() {
+		wg.Wait()
+		done(firstErr)
+	}()
+}
+
+// SetSaving pauses or resumes the periodic saving of chunks by the shards. It
+// returns once every shard has made the change, so no shard is part way
+// through saving when saves are paused, although writes already submitted to
+// the chunk store may not have finished.
+func (mgr *LocalShardManager) SetSaving(enabled bool) {
+	var wg sync.WaitGroup
+
+	mgr.lock.Lock()
+	mgr.savesPaused = !enabled
+	for _, shard := range mgr.shards {
+		wg.Add(1)
+		shard.enqueue(func() {
+			defer wg.Done()
+			shard.saveChunks = enabled && shard.chunkStore.SupportsWrite()
+		})
+	}
+	mgr.lock.Unlock()
+
+	wg.Wait()
+}
+
+// SaveChunks writes the modified chunks in every shard to the chunk store,
+// returning once the writes have finished, with the first error if any
+// failed. Shards whose saving is paused are skipped.
+func (mgr *LocalShardManager) SaveChunks() (err error) {
+	var wg sync.WaitGroup
+	var resultLock sync.Mutex
+	var results []<-chan error
+
+	mgr.lock.Lock()
+	for _, shard := range mgr.shards {
+		wg.Add(1)
+		shard.enqueue(func() {
+			defer wg.Done()
+			if !shard.saveChunks {
+				return
+			}
+			shardResults := shard.writeChunks()
+			shard.ticksSinceSave = 0
+			resultLock.Lock()
+			defer resultLock.Unlock()
+			results = append(results, shardResults...)
+		})
+	}
+	mgr.lock.Unlock()
+
+	wg.Wait()
+	for _, result := range results {
+		if writeErr := <-result; writeErr != nil && err == nil {
+			err = writeErr
+		}
+	}
+	return
+}
+
+// SetWorldBorder stops the shards loading or generating chunks that are
+// wholly outside the border. Chunks already loaded stay loaded. It returns
+// once every shard has made the change.
+func (mgr *LocalShardManager) SetWorldBorder(border WorldBorder) {
+	var wg sync.WaitGroup
+
+	mgr.lock.Lock()
+	mgr.border = border
+	for _, shard := range mgr.shards {
+		wg.Add(1)
+		shard.enqueue(func() {
+			defer wg.Done()
+			shard.border = border
+		})
+	}
+	mgr.lock.Unlock()
+
+	wg.Wait()
+}
+
+// SetWorldTime sets the function that the shards call for the time of day,
+// which decides where mobs spawn. It must be safe to call from any goroutine.
+// It returns once every shard has made the change.
+func (mgr *LocalShardManager) SetWorldTime(worldTime func() Ticks) {
+	var wg sync.WaitGroup
+
+	mgr.lock.Lock()
+	mgr.worldTime = worldTime
+	for _, shard := range mgr.shards {
+		wg.Add(1)
+		shard.enqueue(func() {
+			defer wg.Done()
+			shard.worldTime = worldTime
+		})
+	}
+	mgr.lock.Unlock()
+
+	wg.Wait()
+}
+
+// LoadedChunks returns the locations of the chunks loaded in all shards.
+func (mgr *LocalShardManager) LoadedChunks() (locs []ChunkXz) {
+	var wg sync.WaitGroup
+	var resultLock sync.Mutex
+
+	mgr.lock.Lock()
+	for _, shard := range mgr.shards {
+		wg.Add(1)
+		shard.enqueue(func() {
+			defer wg.Done()
+			resultLock.Lock()
+			defer resultLock.Unlock()
+			for _, chunk := range shard.chunks {
+				if chunk != nil {
+					locs = append(locs, chunk.loc)
+				}
+			}
+		})
+	}
+	mgr.lock.Unlock()
+
+	wg.Wait()
+	return
+}
+
 // TODO remove Enqueue* methods
 
 // EnqueueAllChunks runs a given function on all loaded chunks.
@@ -0,0 +1,177 @@
+package shardserver
+
+import (
+	"sort"
+	"testing"
+
+	"chunkymonkey/clock"
+	"chunkymonkey/entity"
+	"chunkymonkey/generation"
+	. "chunkymonkey/types"
+)
+
+func TestLocalShardManager_LoadedChunks(t *testing.T) {
+	entityMgr := new(entity.EntityManager)
+	entityMgr.Init()
+	mgr := NewLocalShardManager(generation.NewFlatgrassWorld(), entityMgr, clock.Real)
+	t.Cleanup(mgr.Stop)
+
+	if locs := mgr.LoadedChunks(); len(locs) != 0 {
+		t.Errorf("Expected no chunks loaded, got %v", locs)
+	}
+
+	// Reading blocks loads their chunks, in two shards.
+	edge := BlockCoord(ShardSize * ChunkSizeH)
+	done := make(chan error)
+	mgr.ReadBlocks(BlockXyz{edge - 1, 64, 0}, BlockXyz{edge, 64, 0}, func(BlockXyz, BlockId, byte) {}, func(err error) {
+		done <- err
+	})
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	locs := mgr.LoadedChunks()
+	sort.Slice(locs, func(i, j int) bool { return locs[i].X < locs[j].X })
+	if len(locs) != 2 || locs[0] != (ChunkXz{ShardSize - 1, 0}) || locs[1] != (ChunkXz{ShardSize, 0}) {
+		t.Errorf("Expected chunks %d,0 and %d,0 loaded, got %v", ShardSize-1, ShardSize, locs)
+	}
+}
+
+func TestLocalShardManager_SetSaving(t *testing.T) {
+	entityMgr := new(entity.EntityManager)
+	entityMgr.Init()
+	mgr := NewLocalShardManager(generation.NewFlatgrassWorld(), entityMgr, clock.Real)
+	t.Cleanup(mgr.Stop)
+
+	mgr.lock.Lock()
+	existing := mgr.getShard(ShardXz{0, 0}, true)
+	mgr.lock.Unlock()
+
+	mgr.SetSaving(false)
+
+	// New shards don't save either, until saving is resumed.
+	mgr.lock.Lock()
+	created := mgr.getShard(ShardXz{1, 0}, true)
+	mgr.lock.Unlock()
+
+	for _, shard := range []*ChunkShard{existing, created} {
+		saving := make(chan bool)
+		shard.enqueue(func() {
+			saving <- shard.saveChunks
+		})
+		if <-saving {
+			t.Errorf("Expected %v not to save", shard)
+		}
+	}
+
+	mgr.SetSaving(true)
+	mgr.lock.Lock()
+	if mgr.savesPaused {
+		t.Errorf("Expected saves to be resumed")
+	}
+	mgr.lock.Unlock()
+}
+
+func TestLocalShardManager_SetWorldBorder(t *testing.T) {
+	entityMgr := new(entity.EntityManager)
+	entityMgr.Init()
+	mgr := NewLocalShardManager(generation.NewFlatgrassWorld(), entityMgr, clock.Real)
+	t.Cleanup(mgr.Stop)
+
+	mgr.SetWorldBorder(WorldBorder{Center: BlockXyz{0, 64, 0}, Radius: 8})
+
+	mgr.lock.Lock()
+	shard := mgr.getShard(ShardXz{0, 0}, true)
+	mgr.lock.Unlock()
+
+	type Test struct {
+		loc    ChunkXz
+		loaded bool
+	}
+
+	var tests = []Test{
+		{ChunkXz{0, 0}, true},
+		{ChunkXz{1, 0}, false},
+		{ChunkXz{0, 5}, false},
+	}
+
+	for _, test := range tests {
+		loaded := make(chan bool)
+		shard.enqueue(func() {
+			loaded <- shard.chunkAt(test.loc) != nil
+		})
+		if result := <-loaded; result != test.loaded {
+			t.Errorf("Chunk %v: expected loaded=%t, got %t", test.loc, test.loaded, result)
+		}
+	}
+}
+
+func TestLocalShardManager_SaveChunks(t *testing.T) {
+	entityMgr := new(entity.EntityManager)
+	entityMgr.Init()
+	store := generation.NewFlatgrassWorld()
+	mgr := NewLocalShardManager(store, entityMgr, clock.Real)
+	t.Cleanup(mgr.Stop)
+
+	loc := BlockXyz{3, 70, -20}
+	changed := make(chan error)
+	mgr.SetBlocks([]BlockChange{{loc, 1, 0}}, func(_ int, err error) {
+		changed <- err
+	})
+	if err := <-changed; err != nil {
+		t.Fatal(err)
+	}
+	if err := mgr.SaveChunks(); err != nil {
+		t.Fatalf("SaveChunks error: %v", err)
+	}
+
+	// A new manager on the same store, as after a restart, sees the change.
+	restarted := NewLocalShardManager(store, entityMgr, clock.Real)
+	t.Cleanup(restarted.Stop)
+	var blockId BlockId
+	done := make(chan error)
+	restarted.ReadBlocks(loc, loc, func(_ BlockXyz, id BlockId, _ byte) {
+		blockId = id
+	}, func(err error) {
+		done <- err
+	})
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if blockId != 1 {
+		t.Errorf("Expected saved block 1 to be read back, got %d", blockId)
+	}
+}
+
+func TestLocalShardManager_Stop(t *testing.T) {
+	entityMgr := new(entity.EntityManager)
+	entityMgr.Init()
+	mgr := NewLocalShardManager(generation.NewFlatgrassWorld(), entityMgr, clock.Real)
+
+	mgr.lock.Lock()
+	existing := mgr.getShard(ShardXz{0, 0}, true)
+	mgr.lock.Unlock()
+
+	mgr.Stop()
+	// Stopping again is harmless.
+	mgr.Stop()
+
+	// Shards created after stopping aren't served either.
+	mgr.lock.Lock()
+	created := mgr.getShard(ShardXz{1, 0}, true)
+	mgr.lock.Unlock()
+
+	for _, shard := range []*ChunkShard{existing, created} {
+		select {
+		case <-shard.done:
+		default:
+			t.Errorf("Shard %v: expected to be stopped", shard.loc)
+		}
+		// Requests to a stopped shard are dropped rather than blocking.
+		for i := 0; i < cap(shard.requests)+1; i++ {
+			shard.enqueue(func() {
+				t.Errorf("Shard %v: expected request to be dropped", shard.loc)
+			})
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package shardserver
+
+import (
+	"flag"
+	"math"
+
+	"chunkymonkey/gamerules"
+	. "chunkymonkey/types"
+)
+
+var (
+	mobSpawning = flag.Bool(
+		"mob_spawning", true,
+		"Spawn mobs naturally in the chunks near players.")
+	hostileMobCap = flag.Int(
+		"mob_cap_hostile", 2,
+		"Number of hostile mobs in a chunk above which no more spawn there.")
+	passiveMobCap = flag.Int(
+		"mob_cap_passive", 2,
+		"Number of passive mobs in a chunk above which no more spawn there.")
+	waterMobCap = flag.Int(
+		"mob_cap_water", 1,
+		"Number of water mobs in a chunk above which no more spawn there.")
+	mobDespawnRange = flag.Int(
+		"mob_despawn_range", 128,
+		"Distance in blocks from every player beyond which mobs are removed. "+
+			"Mobs only spawn within this distance of a player.")
+)
+
+const (
+	// ticksBetweenMobSpawns is how often each chunk tries to spawn mobs, and
+	// removes those far from players.
+	ticksBetweenMobSpawns = TicksPerSecond * 5
+
+	// mobSpawnMinDistance is how close to a player mobs may spawn.
+	mobSpawnMinDistance = AbsCoord(24)
+
+	// nightSkyDarkness is how much less sky light there is at night.
+	nightSkyDarkness = 11
+
+	blockIdGrass      = BlockId(2)
+	blockIdWater      = BlockId(8)
+	blockIdStillWater = BlockId(9)
+)
+
+// mobCategoryCaps returns the spawn cap for each category of mob.
+func mobCategoryCaps() map[gamerules.MobCategory]int {
+	return map[gamerules.MobCategory]int{
+		gamerules.MobHostile: *hostileMobCap,
+		gamerules.MobPassive: *passiveMobCap,
+		gamerules.MobWater:   *waterMobCap,
+	}
+}
+
+// skyDarkness returns how much the sky light is reduced by at the time.
+func skyDarkness(time Ticks) int {
+	if time.IsNight() {
+		return nightSkyDarkness
+	}
+	return 0
+}
+
+// nearestPlayer returns the horizontal distance from the position to the
+// nearest player connected to the shard. known is false if the position of
+// any player isn't known yet.
+func (shard *ChunkShard) nearestPlayer(position *AbsXyz) (distance AbsCoord, found, known bool) {
+	known = true
+	for _, t := range shard.trackers {
+		if !t.positioned {
+			known = false
+			continue
+		}
+		d := AbsCoord(math.Max(
+			math.Abs(float64(t.position.X-position.X)),
+			math.Abs(float64(t.position.Z-position.Z))))
+		if !found || d < distance {
+			distance, found = d, true
+		}
+	}
+	return
+}
+
+// updateMobs spawns mobs in the shard's chunks near players, and removes
+// mobs that no player is near.
+func (shard *ChunkShard) updateMobs() {
+	darkness := 0
+	if shard.worldTime != nil {
+		darkness = skyDarkness(shard.worldTime())
+	}
+	caps := mobCategoryCaps()
+
+	for _, chunk := range shard.chunks {
+		if chunk != nil {
+			chunk.despawnMobs()
+			if *mobSpawning {
+				chunk.spawnMobs(caps, darkness)
+			}
+		}
+	}
+}
+
+// despawnMobs removes the mobs in the chunk that no player is near.
+func (chunk *Chunk) despawnMobs() {
+	for _, e := range chunk.entities {
+		if _, ok := e.(gamerules.IMob); !ok {
+			continue
+		}
+		distance, found, known := chunk.shard.nearestPlayer(e.Position())
+		if known && (!found || distance > AbsCoord(*mobDespawnRange)) {
+			chunk.removeEntity(e)
+		}
+	}
+}
+
+// spawnMobs tries to spawn a mob of each category that is below its cap in
+// the chunk, at a random place suitable for the category.
+func (chunk *Chunk) spawnMobs(caps map[gamerules.MobCategory]int, darkness int) {
+	counts := make(map[gamerules.MobCategory]int)
+	for _, e := range chunk.entities {
+		if mob, ok := e.(gamerules.IMob); ok {
+			counts[mob.GetMob().Category()]++
+		}
+	}
+
+	for category, limit := range caps {
+		if counts[category] >= limit {
+			continue
+		}
+
+		subLoc, ok := chunk.mobSpawnLoc(category, darkness)
+		if !ok {
+			continue
+		}
+		index, _ := subLoc.BlockIndex()
+		mobs := gamerules.NaturalMobs(category, chunk.Biome(index))
+		if len(mobs) == 0 {
+			continue
+		}
+
+		blockLoc := chunk.loc.ToBlockXyz(&subLoc)
+		position := AbsXyz{
+			AbsCoord(blockLoc.X) + 0.5,
+			AbsCoord(blockLoc.Y),
+			AbsCoord(blockLoc.Z) + 0.5,
+		}
+		distance, found, known := chunk.shard.nearestPlayer(&position)
+		if !known || !found || distance < mobSpawnMinDistance || distance > AbsCoord(*mobDespawnRange) {
+			continue
+		}
+
+		mob := mobs[chunk.rand.Intn(len(mobs))]().(gamerules.IMob)
+		mob.GetMob().PointObject.Init(&position, &AbsVelocity{})
+		mob.GetMob().SetLook(LookDegrees{Yaw: AngleDegrees(chunk.rand.Intn(360))})
+		chunk.AddEntity(mob)
+	}
+}
+
+// mobSpawnLoc picks a random place in the chunk, and returns it if a mob of
+// the category may spawn there.
+func (chunk *Chunk) mobSpawnLoc(category gamerules.MobCategory, darkness int) (subLoc SubChunkXyz, ok bool) {
+	subLoc.X = SubChunkCoord(chunk.rand.Intn(ChunkSizeH))
+	subLoc.Z = SubChunkCoord(chunk.rand.Intn(ChunkSizeH))
+	// The height map is ordered by X then Z, and holds the lowest block with
+	// full sky light in each column.
+	height := int(chunk.heightMap[int(subLoc.X)<<ChunkHShift|int(subLoc.Z)])
+	if height < 1 || height > ChunkSizeY-2 {
+		return
+	}
+
+	switch category {
+	case gamerules.MobPassive:
+		// On the surface.
+		subLoc.Y = SubChunkCoord(height)
+	default:
+		// Anywhere up to just above the surface.
+		subLoc.Y = SubChunkCoord(1 + chunk.rand.Intn(height))
+	}
+
+	below := subLoc
+	below.Y--
+	above := subLoc
+	above.Y++
+	floorId, floorSolid := chunk.spawnBlock(below)
+	feetId, feetSolid := chunk.spawnBlock(subLoc)
+	headId, headSolid := chunk.spawnBlock(above)
+
+	index, _ := subLoc.BlockIndex()
+	blockLight := int(index.BlockData(chunk.blockLight))
+	skyLight := int(index.BlockData(chunk.skyLight))
+
+	switch category {
+	case gamerules.MobHostile:
+		light := skyLight - darkness
+		if blockLight > light {
+			light = blockLight
+		}
+		ok = floorSolid && !feetSolid && !headSolid && !isWater(feetId) &&
+			light <= gamerules.HostileMobMaxLight
+	case gamerules.MobPassive:
+		ok = floorId == blockIdGrass && !feetSolid && !headSolid &&
+			skyLight >= gamerules.PassiveMobMinLight
+	case gamerules.MobWater:
+		ok = isWater(feetId) && isWater(headId)
+	}
+	return
+}
+
+// spawnBlock returns the type of the block in the chunk, and whether it is
+// solid. Unknown blocks are treated as solid.
+func (chunk *Chunk) spawnBlock(subLoc SubChunkXyz) (blockId BlockId, solid bool) {
+	index, ok := subLoc.BlockIndex()
+	if !ok {
+		return BlockIdAir, true
+	}
+	blockId = index.BlockId(chunk.blocks)
+	if blockType, ok := gamerules.Blocks.Get(blockId); ok {
+		return blockId, blockType.Solid
+	}
+	return blockId, true
+}
+
+func isWater(blockId BlockId) bool {
+	return blockId == blockIdWater || blockId == blockIdStillWater
+}
@@ -0,0 +1,119 @@
+package shardserver
+
+import (
+	"testing"
+
+	"chunkymonkey/gamerules"
+	"chunkymonkey/generation"
+	. "chunkymonkey/types"
+)
+
+// countMobs returns the number of mobs of each category in the chunk.
+func countMobs(chunk *Chunk) map[gamerules.MobCategory]int {
+	counts := make(map[gamerules.MobCategory]int)
+	for _, mob := range chunk.mobs() {
+		counts[mob.Category()]++
+	}
+	return counts
+}
+
+func TestChunk_SpawnMobs(t *testing.T) {
+	chunk := newTestChunk(t, generation.NewFlatgrassGenerator(generation.SeaLevel), ChunkXz{0, 0})
+	player := newTracker()
+	player.setPosition(&AbsXyz{40, 64, 8})
+	chunk.shard.trackers[1] = player
+
+	caps := map[gamerules.MobCategory]int{
+		gamerules.MobHostile: 2,
+		gamerules.MobPassive: 3,
+	}
+
+	// In daylight, only passive mobs spawn on the grass, up to their cap.
+	for i := 0; i < 500; i++ {
+		chunk.spawnMobs(caps, 0)
+	}
+	counts := countMobs(chunk)
+	if counts[gamerules.MobPassive] != 3 || counts[gamerules.MobHostile] != 0 {
+		t.Errorf("Expected 3 passive mobs by day, got %v", counts)
+	}
+	for _, mob := range chunk.mobs() {
+		if position := mob.Position(); position.Y < generation.SeaLevel {
+			t.Errorf("Expected mob to spawn on the surface, got %v", position)
+		}
+	}
+
+	// At night, hostile mobs spawn too.
+	for i := 0; i < 500; i++ {
+		chunk.spawnMobs(caps, nightSkyDarkness)
+	}
+	if counts = countMobs(chunk); counts[gamerules.MobHostile] != 2 {
+		t.Errorf("Expected 2 hostile mobs by night, got %v", counts)
+	}
+}
+
+func TestChunk_SpawnMobsNearPlayer(t *testing.T) {
+	chunk := newTestChunk(t, generation.NewFlatgrassGenerator(generation.SeaLevel), ChunkXz{0, 0})
+	caps := map[gamerules.MobCategory]int{gamerules.MobPassive: 1}
+
+	type Test struct {
+		desc     string
+		position AbsXyz
+	}
+
+	var tests = []Test{
+		{"too close to the player", AbsXyz{8, 64, 8}},
+		{"too far from the player", AbsXyz{1000, 64, 8}},
+	}
+
+	for _, test := range tests {
+		player := newTracker()
+		player.setPosition(&test.position)
+		chunk.shard.trackers[1] = player
+		for i := 0; i < 100; i++ {
+			chunk.spawnMobs(caps, 0)
+		}
+		if mobs := chunk.mobs(); len(mobs) != 0 {
+			t.Errorf("%s: expected no mobs to spawn, got %d", test.desc, len(mobs))
+		}
+	}
+
+	// No mobs spawn without a player to spawn them near.
+	delete(chunk.shard.trackers, 1)
+	for i := 0; i < 100; i++ {
+		chunk.spawnMobs(caps, 0)
+	}
+	if mobs := chunk.mobs(); len(mobs) != 0 {
+		t.Errorf("Expected no mobs to spawn without players, got %d", len(mobs))
+	}
+}
+
+func TestChunk_DespawnMobs(t *testing.T) {
+	chunk := newTestChunk(t, generation.NewFlatgrassGenerator(generation.SeaLevel), ChunkXz{0, 0})
+	mob := gamerules.NewPig()
+	mob.(gamerules.IMob).GetMob().PointObject.Init(&AbsXyz{8, 65, 8}, &AbsVelocity{})
+	chunk.AddEntity(mob)
+	item := gamerules.NewItem(1, 1, 0, &AbsXyz{8, 65, 8}, &AbsVelocity{}, 0)
+	chunk.AddEntity(item)
+
+	// A player whose position isn't known yet might be near.
+	chunk.shard.trackers[1] = newTracker()
+	chunk.despawnMobs()
+	if len(chunk.mobs()) != 1 {
+		t.Fatalf("Expected mob to stay while a player's position is unknown")
+	}
+
+	chunk.shard.trackers[1].setPosition(&AbsXyz{100, 64, 8})
+	chunk.despawnMobs()
+	if len(chunk.mobs()) != 1 {
+		t.Fatalf("Expected mob near a player to stay")
+	}
+
+	chunk.shard.trackers[1].setPosition(&AbsXyz{1000, 64, 8})
+	chunk.despawnMobs()
+	if len(chunk.mobs()) != 0 {
+		t.Errorf("Expected mob far from players to be removed")
+	}
+	if len(chunk.items()) != 1 {
+		t.Errorf("Expected items to be left")
+	}
+}
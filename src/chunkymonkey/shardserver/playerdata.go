@@ -9,8 +9,8 @@ import (
 )
 
 const (
-	// Assumed values for size of player axis-aligned bounding box (AAB).
-	playerAabH = AbsCoord(0.75) // Each side of player.
+	// Assumed reach of a player for picking up items.
+	playerAabH = AbsCoord(0.75) // Horizontally from the player.
 	playerAabY = AbsCoord(2.00) // From player's feet position upwards.
 )
 
@@ -18,23 +18,25 @@ const (
 // this data at a time. This data is occasionally updated from the frontend
 // server.
 type playerData struct {
-	entityId   EntityId
-	name       string
-	position   AbsXyz
-	look       LookBytes
-	heldItemId ItemTypeId
-	// TODO Armor data.
+	entityId  EntityId
+	name      string
+	position  AbsXyz
+	look      LookBytes
+	equipment gamerules.PlayerEquipment
 }
 
-func (player *playerData) sendSpawn(writer io.Writer) error {
-	return proto.WriteNamedEntitySpawn(
+func (player *playerData) sendSpawn(writer io.Writer) (err error) {
+	err = proto.WriteNamedEntitySpawn(
 		writer,
 		player.entityId, player.name,
 		player.position.ToAbsIntXyz(),
 		&player.look,
-		player.heldItemId,
+		player.equipment[0].ItemTypeId,
 	)
-	// TODO Armor packet(s).
+	if err != nil {
+		return
+	}
+	return player.equipment.SendUpdate(writer, player.entityId)
 }
 
 func (player *playerData) sendPositionLook(writer io.Writer) error {
@@ -46,17 +48,5 @@ func (player *playerData) sendPositionLook(writer io.Writer) error {
 }
 
 func (player *playerData) OverlapsItem(item *gamerules.Item) bool {
-	// TODO note that calling this function repeatedly is not as efficient as it
-	// could be.
-
-	minX := player.position.X - playerAabH
-	maxX := player.position.X + playerAabH
-	minZ := player.position.Z - playerAabH
-	maxZ := player.position.Z + playerAabH
-	minY := player.position.Y
-	maxY := player.position.Y + playerAabY
-
-	pos := item.Position()
-
-	return pos.X >= minX && pos.X <= maxX && pos.Y >= minY && pos.Y <= maxY && pos.Z >= minZ && pos.Z <= maxZ
+	return item.Position().WithinCylinder(&player.position, playerAabH, playerAabY)
 }
@@ -0,0 +1,37 @@
+package shardserver
+
+import (
+	"bytes"
+	"testing"
+
+	"chunkymonkey/gamerules"
+	"chunkymonkey/proto"
+	. "chunkymonkey/types"
+)
+
+func TestPlayerData_SendSpawn(t *testing.T) {
+	player := &playerData{
+		entityId: 5,
+		name:     "Steve",
+		position: AbsXyz{1.5, 65, 2.5},
+		look:     LookBytes{64, 0},
+	}
+	player.equipment[0] = gamerules.Slot{ItemTypeId: 276, Count: 1, Data: 3}
+	player.equipment[4] = gamerules.Slot{ItemTypeId: 310, Count: 1}
+
+	expected := new(bytes.Buffer)
+	proto.WriteNamedEntitySpawn(expected, 5, "Steve", player.position.ToAbsIntXyz(), &player.look, 276)
+	proto.WriteEntityEquipment(expected, 5, 0, 276, 3)
+	proto.WriteEntityEquipment(expected, 5, 1, -1, 0)
+	proto.WriteEntityEquipment(expected, 5, 2, -1, 0)
+	proto.WriteEntityEquipment(expected, 5, 3, -1, 0)
+	proto.WriteEntityEquipment(expected, 5, 4, 310, 0)
+
+	buf := new(bytes.Buffer)
+	if err := player.sendSpawn(buf); err != nil {
+		t.Fatalf("sendSpawn failed: %v", err)
+	}
+	if !bytes.Equal(expected.Bytes(), buf.Bytes()) {
+		t.Errorf("sendSpawn expected % x\ngot % x", expected.Bytes(), buf.Bytes())
+	}
+}
@@ -0,0 +1,143 @@
+package shardserver
+
+import (
+	"math"
+
+	"chunkymonkey/gamerules"
+	. "chunkymonkey/types"
+)
+
+// RayResult is the outcome of tracing a ray.
+type RayResult byte
+
+const (
+	// RayMissed means that the ray reached its maximum distance, or left the
+	// top or bottom of the world, without hitting anything.
+	RayMissed = RayResult(iota)
+	// RayHitBlock means that the ray hit a block.
+	RayHitBlock
+	// RayUnloaded means that the ray reached a block that isn't loaded, so
+	// what lies beyond is unknown.
+	RayUnloaded
+)
+
+// RayHit describes where a ray stopped.
+type RayHit struct {
+	Result RayResult
+	// Block is the block that was hit, or that isn't loaded.
+	Block BlockXyz
+	// Face is the face of Block that the ray entered through. It is FaceNull
+	// if the ray started inside the block.
+	Face Face
+	// Point is where the ray stopped, on the surface of Block unless the ray
+	// missed.
+	Point AbsXyz
+	// Distance is the distance along the ray to Point.
+	Distance AbsCoord
+}
+
+// TraceRay casts a ray from origin in the given direction, and returns the
+// first solid block that it hits within maxDistance. Liquids are also hit if
+// includeLiquids is true. The ray stops with RayUnloaded rather than
+// passing through blocks that aren't loaded in the shard.
+func (shard *ChunkShard) TraceRay(origin AbsXyz, direction AbsXyz, maxDistance AbsCoord, includeLiquids bool) RayHit {
+	return traceRay(origin, direction, maxDistance, func(loc *BlockXyz) (hit, known bool) {
+		blockId, _, ok := shard.BlockAt(*loc)
+		if !ok {
+			return false, false
+		}
+		if includeLiquids && isLiquid(blockId) {
+			return true, true
+		}
+		blockType, ok := gamerules.Blocks.Get(blockId)
+		return ok && blockType.Solid, true
+	})
+}
+
+func isLiquid(blockId BlockId) bool {
+	return blockId >= 8 && blockId <= 11 // water, lava
+}
+
+// traceRay steps along the ray one block at a time, in the manner of
+// Amanatides and Woo, asking isHit about each block that the ray passes
+// through.
+func traceRay(origin AbsXyz, direction AbsXyz, maxDistance AbsCoord, isHit func(loc *BlockXyz) (hit, known bool)) RayHit {
+	o := [3]float64{float64(origin.X), float64(origin.Y), float64(origin.Z)}
+	d := [3]float64{float64(direction.X), float64(direction.Y), float64(direction.Z)}
+
+	length := math.Sqrt(d[0]*d[0] + d[1]*d[1] + d[2]*d[2])
+	if length == 0 || math.IsNaN(length) || math.IsInf(length, 0) {
+		return RayHit{Result: RayMissed, Face: FaceNull, Point: origin}
+	}
+
+	var block [3]int
+	var step [3]int
+	var tMax, tDelta [3]float64
+	for i := range d {
+		d[i] /= length
+		block[i] = int(math.Floor(o[i]))
+		switch {
+		case d[i] > 0:
+			step[i] = 1
+			tMax[i] = (float64(block[i]+1) - o[i]) / d[i]
+			tDelta[i] = 1 / d[i]
+		case d[i] < 0:
+			step[i] = -1
+			tMax[i] = (float64(block[i]) - o[i]) / d[i]
+			tDelta[i] = -1 / d[i]
+		default:
+			tMax[i] = math.Inf(1)
+			tDelta[i] = math.Inf(1)
+		}
+	}
+
+	pointAt := func(t float64) AbsXyz {
+		return AbsXyz{AbsCoord(o[0] + d[0]*t), AbsCoord(o[1] + d[1]*t), AbsCoord(o[2] + d[2]*t)}
+	}
+
+	t := 0.0
+	face := Face(FaceNull)
+	for {
+		if block[1] < 0 || block[1] > MaxYCoord {
+			// Outside of the world is empty, and the ray can't come back.
+			if (block[1] < 0) == (step[1] <= 0) {
+				break
+			}
+		} else {
+			loc := BlockXyz{BlockCoord(block[0]), BlockYCoord(block[1]), BlockCoord(block[2])}
+			hit, known := isHit(&loc)
+			if !known {
+				return RayHit{RayUnloaded, loc, face, pointAt(t), AbsCoord(t)}
+			} else if hit {
+				return RayHit{RayHitBlock, loc, face, pointAt(t), AbsCoord(t)}
+			}
+		}
+
+		// Step into the next block along the axis with the nearest boundary.
+		axis := 0
+		if tMax[1] < tMax[axis] {
+			axis = 1
+		}
+		if tMax[2] < tMax[axis] {
+			axis = 2
+		}
+		t = tMax[axis]
+		if t > float64(maxDistance) {
+			break
+		}
+		block[axis] += step[axis]
+		tMax[axis] += tDelta[axis]
+		var back AbsXyz
+		switch axis {
+		case 0:
+			back.X = AbsCoord(-step[0])
+		case 1:
+			back.Y = AbsCoord(-step[1])
+		case 2:
+			back.Z = AbsCoord(-step[2])
+		}
+		face = FaceFromVector(&back)
+	}
+
+	return RayHit{Result: RayMissed, Face: FaceNull, Point: pointAt(float64(maxDistance)), Distance: maxDistance}
+}
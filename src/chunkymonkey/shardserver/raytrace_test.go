@@ -0,0 +1,114 @@
+package shardserver
+
+import (
+	"math"
+	"testing"
+
+	. "chunkymonkey/types"
+)
+
+func almostEqualXyz(a, b AbsXyz) bool {
+	const epsilon = 1e-9
+	return math.Abs(float64(a.X-b.X)) < epsilon &&
+		math.Abs(float64(a.Y-b.Y)) < epsilon &&
+		math.Abs(float64(a.Z-b.Z)) < epsilon
+}
+
+func Test_traceRay(t *testing.T) {
+	// Solid blocks are at y < 10, and at x=5 for y < 20. Blocks at z >= 100
+	// aren't known.
+	isHit := func(loc *BlockXyz) (hit, known bool) {
+		if loc.Z >= 100 {
+			return false, false
+		}
+		return loc.Y < 10 || (loc.X == 5 && loc.Y < 20), true
+	}
+
+	type Test struct {
+		desc      string
+		origin    AbsXyz
+		direction AbsXyz
+		maxDist   AbsCoord
+		expected  RayHit
+	}
+
+	var tests = []Test{
+		{"straight down", AbsXyz{0.5, 15, 0.5}, AbsXyz{0, -1, 0}, 20,
+			RayHit{RayHitBlock, BlockXyz{0, 9, 0}, FaceTop, AbsXyz{0.5, 10, 0.5}, 5}},
+		{"straight down, unnormalized", AbsXyz{0.5, 15, 0.5}, AbsXyz{0, -7, 0}, 20,
+			RayHit{RayHitBlock, BlockXyz{0, 9, 0}, FaceTop, AbsXyz{0.5, 10, 0.5}, 5}},
+		{"along +X", AbsXyz{0.5, 12.5, 0.5}, AbsXyz{1, 0, 0}, 20,
+			RayHit{RayHitBlock, BlockXyz{5, 12, 0}, FaceNorth, AbsXyz{5, 12.5, 0.5}, 4.5}},
+		{"along -X", AbsXyz{9.5, 12.5, -3.5}, AbsXyz{-1, 0, 0}, 20,
+			RayHit{RayHitBlock, BlockXyz{5, 12, -4}, FaceSouth, AbsXyz{6, 12.5, -3.5}, 3.5}},
+		{"along a block edge", AbsXyz{0, 12, 0}, AbsXyz{1, 0, 0}, 20,
+			RayHit{RayHitBlock, BlockXyz{5, 12, 0}, FaceNorth, AbsXyz{5, 12, 0}, 5}},
+		{"out of range", AbsXyz{0.5, 15, 0.5}, AbsXyz{0, -1, 0}, 4.9,
+			RayHit{RayMissed, BlockXyz{}, FaceNull, AbsXyz{0.5, 10.1, 0.5}, 4.9}},
+		{"exactly in range", AbsXyz{0.5, 15, 0.5}, AbsXyz{0, -1, 0}, 5,
+			RayHit{RayHitBlock, BlockXyz{0, 9, 0}, FaceTop, AbsXyz{0.5, 10, 0.5}, 5}},
+		{"inside a block", AbsXyz{0.5, 5.5, 0.5}, AbsXyz{0, 1, 0}, 20,
+			RayHit{RayHitBlock, BlockXyz{0, 5, 0}, FaceNull, AbsXyz{0.5, 5.5, 0.5}, 0}},
+		{"diagonally", AbsXyz{0.25, 13.5, 0.5}, AbsXyz{1, -1, 0}, 20,
+			RayHit{RayHitBlock, BlockXyz{3, 9, 0}, FaceTop, AbsXyz{3.75, 10, 0.5}, AbsCoord(3.5 * math.Sqrt2)}},
+		{"diagonally into a wall", AbsXyz{0.5, 12.25, 0.5}, AbsXyz{2, 1, 0}, 20,
+			RayHit{RayHitBlock, BlockXyz{5, 14, 0}, FaceNorth, AbsXyz{5, 14.5, 0.5}, AbsCoord(2.25 * math.Sqrt(5))}},
+		{"into the unknown", AbsXyz{0.5, 12.5, 98.5}, AbsXyz{0, 0, 1}, 20,
+			RayHit{RayUnloaded, BlockXyz{0, 12, 100}, FaceEast, AbsXyz{0.5, 12.5, 100}, 1.5}},
+		{"from negative coordinates", AbsXyz{-0.5, 12.5, -20.5}, AbsXyz{0, 0, -1}, 20,
+			RayHit{RayMissed, BlockXyz{}, FaceNull, AbsXyz{-0.5, 12.5, -40.5}, 20}},
+		{"out of the top of the world", AbsXyz{0.5, 120, 0.5}, AbsXyz{0, 1, 0}, 100,
+			RayHit{RayMissed, BlockXyz{}, FaceNull, AbsXyz{0.5, 220, 0.5}, 100}},
+		{"down from above the world", AbsXyz{0.5, 140, 0.5}, AbsXyz{0, -1, 0}, 200,
+			RayHit{RayHitBlock, BlockXyz{0, 9, 0}, FaceTop, AbsXyz{0.5, 10, 0.5}, 130}},
+		{"no direction", AbsXyz{0.5, 15, 0.5}, AbsXyz{0, 0, 0}, 20,
+			RayHit{RayMissed, BlockXyz{}, FaceNull, AbsXyz{0.5, 15, 0.5}, 0}},
+	}
+
+	for _, r := range tests {
+		result := traceRay(r.origin, r.direction, r.maxDist, isHit)
+		if result.Result != r.expected.Result || result.Block != r.expected.Block ||
+			result.Face != r.expected.Face || !almostEqualXyz(result.Point, r.expected.Point) ||
+			math.Abs(float64(result.Distance-r.expected.Distance)) > 1e-9 {
+			t.Errorf("%s: expected %+v got %+v", r.desc, r.expected, result)
+		}
+	}
+}
+
+func TestChunkShard_TraceRay(t *testing.T) {
+	shard := newTestShard(t, ChunkXz{0, 0})
+	if err := shard.SetBlocksAt([]BlockChange{
+		{BlockXyz{8, 65, 8}, 9, 0},   // water
+		{BlockXyz{8, 65, 10}, 50, 0}, // torch
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	type Test struct {
+		desc           string
+		origin         AbsXyz
+		direction      AbsXyz
+		includeLiquids bool
+		expected       RayHit
+	}
+
+	var tests = []Test{
+		{"onto water", AbsXyz{8.5, 70, 8.5}, AbsXyz{0, -1, 0}, true,
+			RayHit{RayHitBlock, BlockXyz{8, 65, 8}, FaceTop, AbsXyz{8.5, 66, 8.5}, 4}},
+		{"through water", AbsXyz{8.5, 70, 8.5}, AbsXyz{0, -1, 0}, false,
+			RayHit{RayHitBlock, BlockXyz{8, 64, 8}, FaceTop, AbsXyz{8.5, 65, 8.5}, 5}},
+		{"through a torch", AbsXyz{8.5, 70, 10.5}, AbsXyz{0, -1, 0}, true,
+			RayHit{RayHitBlock, BlockXyz{8, 64, 10}, FaceTop, AbsXyz{8.5, 65, 10.5}, 5}},
+		{"into an unloaded chunk", AbsXyz{14.5, 65.5, 8.5}, AbsXyz{1, 0, 0}, false,
+			RayHit{RayUnloaded, BlockXyz{16, 65, 8}, FaceNorth, AbsXyz{16, 65.5, 8.5}, 1.5}},
+	}
+
+	for _, r := range tests {
+		result := shard.TraceRay(r.origin, r.direction, 10, r.includeLiquids)
+		if result.Result != r.expected.Result || result.Block != r.expected.Block ||
+			result.Face != r.expected.Face || !almostEqualXyz(result.Point, r.expected.Point) ||
+			result.Distance != r.expected.Distance {
+			t.Errorf("%s: expected %+v got %+v", r.desc, r.expected, result)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package shardserver
+
+import (
+	"container/heap"
+
+	"chunkymonkey/gamerules"
+	. "chunkymonkey/types"
+)
+
+// scheduledUpdate is a block update that is due on a tick of its chunk.
+type scheduledUpdate struct {
+	due     Ticks
+	seq     uint64 // Orders updates that are due on the same tick.
+	index   BlockIndex
+	blockId BlockId // The block is only updated if it is still of this type.
+}
+
+// updateQueue holds a chunk's scheduled block updates, ordered by when they
+// are due. It implements heap.Interface.
+type updateQueue struct {
+	updates []scheduledUpdate
+	pending map[BlockIndex]bool // The blocks that have an update queued.
+	nextSeq uint64
+}
+
+func newUpdateQueue() *updateQueue {
+	return &updateQueue{
+		pending: make(map[BlockIndex]bool),
+	}
+}
+
+func (q *updateQueue) Len() int {
+	return len(q.updates)
+}
+
+func (q *updateQueue) Less(i, j int) bool {
+	if q.updates[i].due != q.updates[j].due {
+		return q.updates[i].due < q.updates[j].due
+	}
+	return q.updates[i].seq < q.updates[j].seq
+}
+
+func (q *updateQueue) Swap(i, j int) {
+	q.updates[i], q.updates[j] = q.updates[j], q.updates[i]
+}
+
+func (q *updateQueue) Push(x interface{}) {
+	q.updates = append(q.updates, x.(scheduledUpdate))
+}
+
+func (q *updateQueue) Pop() interface{} {
+	last := len(q.updates) - 1
+	update := q.updates[last]
+	q.updates = q.updates[:last]
+	return update
+}
+
+// schedule queues an update of the block, unless it already has one queued.
+func (q *updateQueue) schedule(due Ticks, index BlockIndex, blockId BlockId) {
+	if q.pending[index] {
+		return
+	}
+	q.pending[index] = true
+	heap.Push(q, scheduledUpdate{due, q.nextSeq, index, blockId})
+	q.nextSeq++
+}
+
+// popDue removes and returns the next update that is due by now, if any.
+func (q *updateQueue) popDue(now Ticks) (update scheduledUpdate, ok bool) {
+	if len(q.updates) == 0 || q.updates[0].due > now {
+		return
+	}
+	update = heap.Pop(q).(scheduledUpdate)
+	delete(q.pending, update.index)
+	return update, true
+}
+
+// ScheduleUpdate implements IChunkBlock.ScheduleUpdate. Blocks in other chunks
+// are scheduled through the shard.
+func (chunk *Chunk) ScheduleUpdate(blockXyz *BlockXyz, delay Ticks) {
+	chunkXz, subLoc := blockXyz.ToChunkLocal()
+	if !chunk.isSameChunk(chunkXz) {
+		chunk.shard.scheduleUpdate(blockXyz, delay)
+		return
+	}
+	if index, ok := subLoc.BlockIndex(); ok {
+		chunk.ScheduleUpdateIndex(index, delay)
+	}
+}
+
+// ScheduleUpdateIndex implements IChunkBlock.ScheduleUpdateIndex.
+func (chunk *Chunk) ScheduleUpdateIndex(blockIndex BlockIndex, delay Ticks) {
+	if delay < 1 {
+		// Updates never run on the tick that scheduled them.
+		delay = 1
+	}
+	chunk.updates.schedule(chunk.ticks+delay, blockIndex, chunk.blockId(blockIndex))
+}
+
+// updateTick runs the scheduled block updates that are due. Updates scheduled
+// by them for the same tick are run on the next one.
+func (chunk *Chunk) updateTick() {
+	var blockInstance gamerules.BlockInstance
+	blockInstance.Chunk = chunk
+
+	for {
+		update, ok := chunk.updates.popDue(chunk.ticks)
+		if !ok {
+			break
+		}
+		if chunk.blockId(update.index) != update.blockId {
+			// The block changed since the update was scheduled.
+			continue
+		}
+
+		blockInstance.BlockType, blockInstance.Data, ok = chunk.blockTypeAndData(update.index)
+		if !ok {
+			continue
+		}
+		updater, ok := blockInstance.BlockType.Aspect.(gamerules.IBlockUpdater)
+		if !ok {
+			continue
+		}
+
+		blockInstance.Index = update.index
+		blockInstance.SubLoc = update.index.ToSubChunkXyz()
+		blockInstance.BlockLoc = *chunk.loc.ToBlockXyz(&blockInstance.SubLoc)
+		updater.UpdateBlock(&blockInstance)
+	}
+}
@@ -0,0 +1,90 @@
+package shardserver
+
+import (
+	"reflect"
+	"testing"
+
+	"chunkymonkey/gamerules"
+	. "chunkymonkey/types"
+)
+
+// testUpdaterAspect records the block updates that it is given.
+type testUpdaterAspect struct {
+	gamerules.IBlockAspect
+	updated []BlockXyz
+}
+
+func (aspect *testUpdaterAspect) UpdateBlock(instance *gamerules.BlockInstance) {
+	aspect.updated = append(aspect.updated, instance.BlockLoc)
+}
+
+// withTestUpdater makes wool blocks record their updates until the returned
+// function is called.
+func withTestUpdater() (aspect *testUpdaterAspect, restore func()) {
+	blockType := &gamerules.Blocks[35]
+	original := blockType.Aspect
+	aspect = &testUpdaterAspect{IBlockAspect: original}
+	blockType.Aspect = aspect
+	return aspect, func() { blockType.Aspect = original }
+}
+
+func tickChunks(shard *ChunkShard, ticks int) {
+	for i := 0; i < ticks; i++ {
+		for _, chunk := range shard.chunks {
+			if chunk != nil {
+				chunk.tick()
+			}
+		}
+	}
+}
+
+func TestChunk_ScheduleUpdate(t *testing.T) {
+	aspect, restore := withTestUpdater()
+	defer restore()
+
+	shard := newTestShard(t, ChunkXz{0, 0}, ChunkXz{1, 0})
+	chunk := shard.chunkAt(ChunkXz{0, 0})
+
+	wool := []BlockXyz{{1, 65, 1}, {2, 65, 1}, {3, 65, 1}, {17, 65, 1}}
+	for _, loc := range wool {
+		if err := shard.SetBlockAt(loc, 35, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	chunk.ScheduleUpdate(&wool[0], 3)
+	chunk.ScheduleUpdate(&wool[0], 1) // Already pending.
+	chunk.ScheduleUpdate(&wool[1], 1)
+	chunk.ScheduleUpdate(&wool[2], 2)
+	chunk.ScheduleUpdate(&wool[3], 2) // In the neighbouring chunk.
+	chunk.ScheduleUpdate(&BlockXyz{1, 66, 1}, 1)
+	if err := shard.SetBlockAt(wool[2], 1, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	type Test struct {
+		ticks int
+		want  []BlockXyz
+	}
+
+	tests := []Test{
+		{1, []BlockXyz{wool[1]}},
+		{1, []BlockXyz{wool[1], wool[3]}},
+		{1, []BlockXyz{wool[1], wool[3], wool[0]}},
+		{5, []BlockXyz{wool[1], wool[3], wool[0]}},
+	}
+
+	for i, test := range tests {
+		tickChunks(shard, test.ticks)
+		if !reflect.DeepEqual(aspect.updated, test.want) {
+			t.Errorf("[%d] expected updates %v, got %v", i, test.want, aspect.updated)
+		}
+	}
+
+	// Once run, an update can be scheduled again.
+	chunk.ScheduleUpdate(&wool[0], 1)
+	tickChunks(shard, 1)
+	if n := len(aspect.updated); n != 4 || aspect.updated[n-1] != wool[0] {
+		t.Errorf("expected update to be rescheduled, got %v", aspect.updated)
+	}
+}
@@ -1,20 +1,31 @@
 package shardserver
 
 import (
+	"flag"
 	"fmt"
-	"log"
-	"time"
 
 	"chunkymonkey/chunkstore"
+	"chunkymonkey/clock"
 	"chunkymonkey/entity"
 	"chunkymonkey/gamerules"
+	"chunkymonkey/logger"
 	. "chunkymonkey/types"
 )
 
 const chunksPerShard = ShardSize * ShardSize
 
-// TODO Allow configuration of this.
-const ticksBetweenSaves = TicksPerSecond * 60
+var chunkSaveInterval = flag.Int(
+	"chunk_save_interval", 60,
+	"Seconds between each shard writing its modified chunks to the world.")
+
+// ticksBetweenSaves returns the number of ticks between each shard saving its
+// chunks.
+func ticksBetweenSaves() Ticks {
+	if *chunkSaveInterval < 1 {
+		return TicksPerSecond
+	}
+	return Ticks(*chunkSaveInterval) * TicksPerSecond
+}
 
 // chunkXzToChunkIndex assumes that locDelta is offset relative to the shard
 // origin.
@@ -28,38 +39,53 @@ type ChunkShard struct {
 	shardConnecter   gamerules.IShardConnecter
 	chunkStore       chunkstore.IChunkStore
 	entityMgr        *entity.EntityManager
+	clock            clock.Clock
 	loc              ShardXz
 	originChunkLoc   ChunkXz // The lowest X and Z located chunk in the shard.
 	chunks           [chunksPerShard]*Chunk
 	requests         chan iShardRequest
+	quit             chan struct{} // Closed to stop the shard.
+	done             chan struct{} // Closed once serve has returned.
 	ticksSinceUpdate Ticks
 	ticksSinceSave   Ticks
 	saveChunks       bool
+	border           WorldBorder  // Chunks wholly outside aren't loaded.
+	worldTime        func() Ticks // Returns the time of day, or nil if unknown.
+	ticksSinceMobs   Ticks
 
 	newActiveBlocks []BlockXyz
 	newActiveShards map[uint64]*destActiveShard
 
 	shardClients map[uint64]gamerules.IShardShardClient
 	selfClient   shardSelfClient
+
+	trackers map[EntityId]*tracker // Keyed by the player's entity ID.
+
+	stats shardStats
 }
 
-func NewChunkShard(shardConnecter gamerules.IShardConnecter, chunkStore chunkstore.IChunkStore, entityMgr *entity.EntityManager, loc ShardXz) (shard *ChunkShard) {
+func NewChunkShard(shardConnecter gamerules.IShardConnecter, chunkStore chunkstore.IChunkStore, entityMgr *entity.EntityManager, loc ShardXz, clk clock.Clock) (shard *ChunkShard) {
 	shard = &ChunkShard{
 		shardConnecter:   shardConnecter,
 		chunkStore:       chunkStore,
 		entityMgr:        entityMgr,
+		clock:            clk,
 		loc:              loc,
 		originChunkLoc:   loc.ToChunkXz(),
 		requests:         make(chan iShardRequest, 256),
+		quit:             make(chan struct{}),
+		done:             make(chan struct{}),
 		ticksSinceUpdate: 0,
 		saveChunks:       chunkStore.SupportsWrite(),
 
 		// Offset shard saves.
-		ticksSinceSave: (31 * Ticks(loc.Key())) % ticksBetweenSaves,
+		ticksSinceSave: (31 * Ticks(loc.Key())) % ticksBetweenSaves(),
 
 		newActiveShards: make(map[uint64]*destActiveShard),
 
 		shardClients: make(map[uint64]gamerules.IShardShardClient),
+
+		trackers: make(map[EntityId]*tracker),
 	}
 
 	shard.selfClient.shard = shard
@@ -67,13 +93,20 @@ func NewChunkShard(shardConnecter gamerules.IShardConnecter, chunkStore chunksto
 	return
 }
 
-// serve services shard requests in the foreground.
+// serve services shard requests in the foreground, until the shard is
+// stopped.
 func (shard *ChunkShard) serve() {
-	ticker := time.NewTicker(NanosecondsInSecond / TicksPerSecond)
+	defer close(shard.done)
+
+	ticker := shard.clock.NewTicker(NanosecondsInSecond / TicksPerSecond)
+	defer ticker.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
+		case <-shard.quit:
+			return
+
+		case <-ticker.C():
 			shard.tick()
 
 		case request := <-shard.requests:
@@ -93,31 +126,81 @@ func (shard *ChunkShard) tick() {
 	}
 
 	if shard.ticksSinceUpdate >= TicksPerSecond {
-		for _, chunk := range shard.chunks {
-			if chunk != nil {
-				chunk.sendUpdate()
-			}
-		}
+		shard.sendUpdates()
+		shard.updateStats()
 		shard.ticksSinceUpdate = 0
 	}
 
 	if shard.saveChunks && shard.chunkStore.SupportsWrite() {
 		shard.ticksSinceSave++
-		if shard.ticksSinceSave > ticksBetweenSaves {
-			log.Printf("%s: Writing chunks.", shard)
+		if shard.ticksSinceSave > ticksBetweenSaves() {
+			logger.Chunk.Debug("Writing chunks", "shard", shard)
 			// TODO Stagger the per-chunk saves over multiple ticks.
-			for _, chunk := range shard.chunks {
-				if chunk != nil {
-					chunk.save(shard.chunkStore)
-				}
-			}
+			shard.writeChunks()
 			shard.ticksSinceSave = 0
 		}
 	}
 
+	shard.ticksSinceMobs++
+	if shard.ticksSinceMobs >= ticksBetweenMobSpawns {
+		shard.updateMobs()
+		shard.ticksSinceMobs = 0
+	}
+
 	shard.transferActiveBlocks()
 }
 
+// writeChunks submits the modified chunks for writing to the chunk store,
+// returning the results of the writes.
+func (shard *ChunkShard) writeChunks() (results []<-chan error) {
+	for _, chunk := range shard.chunks {
+		if chunk != nil {
+			if result := chunk.save(shard.chunkStore); result != nil {
+				results = append(results, result)
+			}
+		}
+	}
+	return
+}
+
+// sendUpdates sends entity movements to the players, spawning and destroying
+// entities as they and the players move in and out of range of each other.
+// Players stop tracking entities that have left the shard, which other shards
+// take over.
+func (shard *ChunkShard) sendUpdates() {
+	present := make(map[EntityId]bool)
+	for _, chunk := range shard.chunks {
+		if chunk != nil {
+			chunk.sendUpdate()
+			for entityId := range chunk.entities {
+				present[entityId] = true
+			}
+			for entityId := range chunk.playersData {
+				present[entityId] = true
+			}
+		}
+	}
+
+	for _, t := range shard.trackers {
+		for entityId := range t.tracked {
+			if !present[entityId] {
+				delete(t.tracked, entityId)
+			}
+		}
+	}
+}
+
+// tracker returns the record of the entities shown to the player, creating it
+// if necessary.
+func (shard *ChunkShard) tracker(entityId EntityId) *tracker {
+	t, ok := shard.trackers[entityId]
+	if !ok {
+		t = newTracker()
+		shard.trackers[entityId] = t
+	}
+	return t
+}
+
 // clientForShard is used to get a IShardShardClient for a given shard, reusing
 // IShardShardClient connections for use within the shard. Returns nil if the
 // shard does not exist.
@@ -182,7 +265,9 @@ func (shard *ChunkShard) transferActiveBlocks() {
 				client.ReqSetActiveBlocks(activeShard.blocks)
 			}
 		}
+		delete(shard.newActiveShards, shardKey)
 	}
+	shard.newActiveBlocks = shard.newActiveBlocks[:0]
 }
 
 // reqSetBlocksActive sets each block in the given slice to be active within
@@ -209,7 +294,7 @@ func (shard *ChunkShard) addActiveBlock(block *BlockXyz) {
 	shardXz := chunkXz.ToShardXz()
 	shardKey := shardXz.Key()
 	activeShard, ok := shard.newActiveShards[shardKey]
-	if ok {
+	if !ok {
 		activeShard = &destActiveShard{
 			loc:    shardXz,
 			blocks: []BlockXyz{*block},
@@ -218,6 +303,27 @@ func (shard *ChunkShard) addActiveBlock(block *BlockXyz) {
 	} else {
 		activeShard.blocks = append(activeShard.blocks, *block)
 	}
+	shard.newActiveBlocks = append(shard.newActiveBlocks, *block)
+}
+
+// scheduleUpdate schedules an update of a block in any chunk, as
+// IChunkBlock.ScheduleUpdate. It is discarded if the chunk isn't loaded.
+func (shard *ChunkShard) scheduleUpdate(block *BlockXyz, delay Ticks) {
+	shardXz := block.ToChunkXz().ToShardXz()
+	if client := shard.clientForShard(shardXz); client != nil {
+		client.ReqScheduleUpdate(*block, delay)
+	}
+}
+
+// reqScheduleUpdate schedules an update of a block within the shard.
+func (shard *ChunkShard) reqScheduleUpdate(block *BlockXyz, delay Ticks) {
+	chunkIndex, _, _, isThisShard := shard.chunkIndexAndRelLoc(*block.ToChunkXz())
+	if !isThisShard {
+		return
+	}
+	if chunk := shard.chunks[chunkIndex]; chunk != nil {
+		chunk.ScheduleUpdate(block, delay)
+	}
 }
 
 func (shard *ChunkShard) String() string {
@@ -244,7 +350,7 @@ func (shard *ChunkShard) chunkIndexAndRelLoc(loc ChunkXz) (index int, x, z Chunk
 func (shard *ChunkShard) chunkAt(loc ChunkXz) *Chunk {
 	chunkIndex, dx, dz, ok := shard.chunkIndexAndRelLoc(loc)
 	if !ok {
-		log.Printf("%v.Get(%#v): ChunkXz outside of shard", shard, loc)
+		logger.Chunk.Warn("Get: chunk outside of shard", "shard", shard, "chunk", loc)
 		return nil
 	}
 
@@ -255,6 +361,10 @@ func (shard *ChunkShard) chunkAt(loc ChunkXz) *Chunk {
 		return chunk
 	}
 
+	if !shard.border.ContainsChunk(loc) {
+		return nil
+	}
+
 	chunk = shard.loadChunk(loc, ChunkXz{dx, dz})
 
 	if chunk == nil {
@@ -275,13 +385,12 @@ func (shard *ChunkShard) loadChunk(loc ChunkXz, locDelta ChunkXz) *Chunk {
 	chunkResult := <-shard.chunkStore.ReadChunk(loc)
 	chunkReader, err := chunkResult.Reader, chunkResult.Err
 	if err != nil {
-		if _, ok := err.(chunkstore.NoSuchChunkError); !ok {
-			log.Printf("%v.load(%#v): chunk loading error: %v", shard, loc, err)
-			return nil
-		} else {
-			// Chunk doesn't exist in store.
-			return nil
+		if !chunkstore.IsNoSuchChunk(err) {
+			// The chunk may exist, but is unreadable. Refuse to serve it rather
+			// than risk it being replaced.
+			logger.Chunk.Error("Chunk loading error", "shard", shard, "chunk", loc, "err", err)
 		}
+		return nil
 	}
 
 	chunk := newChunkFromReader(chunkReader, shard)
@@ -291,21 +400,33 @@ func (shard *ChunkShard) loadChunk(loc ChunkXz, locDelta ChunkXz) *Chunk {
 
 // enqueueAllChunks runs a given function on all loaded chunks in the shard.
 func (shard *ChunkShard) enqueueAllChunks(fn func(chunk *Chunk)) {
-	shard.requests <- &runOnAllChunks{fn}
+	shard.enqueueRequest(&runOnAllChunks{fn})
 }
 
 // enqueueOnChunk runs a function on the chunk at the given location. If the
 // chunk does not exist, it does nothing.
 func (shard *ChunkShard) enqueueOnChunk(loc ChunkXz, fn func(chunk *Chunk)) {
-	shard.requests <- &runOnChunk{loc, fn}
+	shard.enqueueRequest(&runOnChunk{loc, fn})
 }
 
 func (shard *ChunkShard) enqueue(fn func()) {
-	shard.requests <- &runGeneric{fn}
+	shard.enqueueRequest(&runGeneric{fn})
 }
 
+// enqueueRequest queues the request for the shard to perform. Requests made
+// after the shard has stopped are dropped.
 func (shard *ChunkShard) enqueueRequest(req iShardRequest) {
-	shard.requests <- req
+	select {
+	case shard.requests <- req:
+	case <-shard.quit:
+	}
+}
+
+// stop stops the shard serving, returning once it has stopped. Chunks are not
+// saved.
+func (shard *ChunkShard) stop() {
+	close(shard.quit)
+	<-shard.done
 }
 
 type destActiveShard struct {
@@ -326,6 +447,10 @@ func (client *shardSelfClient) ReqSetActiveBlocks(blocks []BlockXyz) {
 	client.shard.reqSetBlocksActive(blocks)
 }
 
+func (client *shardSelfClient) ReqScheduleUpdate(block BlockXyz, delay Ticks) {
+	client.shard.reqScheduleUpdate(&block, delay)
+}
+
 func (client *shardSelfClient) ReqTransferEntity(loc ChunkXz, entity gamerules.INonPlayerEntity) {
 	chunk := client.shard.chunkAt(loc)
 	if chunk != nil {
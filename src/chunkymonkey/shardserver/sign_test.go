@@ -0,0 +1,93 @@
+package shardserver
+
+import (
+	"bytes"
+	"testing"
+
+	"chunkymonkey/gamerules"
+	"chunkymonkey/proto"
+	. "chunkymonkey/types"
+)
+
+const testSignPost = BlockId(63)
+
+func signPacket(loc BlockXyz, lines [4]string) []byte {
+	buf := new(bytes.Buffer)
+	proto.WriteSignUpdate(buf, &loc, lines)
+	return buf.Bytes()
+}
+
+func TestChunk_SetSignText(t *testing.T) {
+	shard := newTestShard(t, ChunkXz{0, 0})
+	chunk := shard.chunkAt(ChunkXz{0, 0})
+	loc := BlockXyz{8, 65, 8}
+	setTestBlock(t, shard, loc, BlockIdAir)
+
+	writer := &testPlayerClient{entityId: 100}
+	chunk.reqSubscribeChunk(writer.entityId, writer, false)
+	other := &testPlayerClient{entityId: 102}
+	chunk.reqSubscribeChunk(other.entityId, other, false)
+
+	slot := gamerules.Slot{ItemTypeId: ItemTypeId(testSignPost), Count: 1}
+	chunk.reqPlaceItem(writer, &loc, &slot)
+	if slot.Count != 0 {
+		t.Fatalf("expected the sign to be placed, got %v", slot)
+	}
+
+	// Only the player who placed the sign may write it.
+	other.packets = nil
+	writer.packets = nil
+	chunk.reqSetSignText(other, &loc, [4]string{"Not", "yours", "", ""})
+	blank := signPacket(loc, [4]string{})
+	if len(other.packets) != 1 || !bytes.Equal(other.packets[0], blank) {
+		t.Errorf("expected blank sign %x sent back, got %x", blank, other.packets)
+	}
+	if len(writer.packets) != 0 {
+		t.Errorf("expected no update for the sign's placer, got %x", writer.packets)
+	}
+
+	// Lines that are too long, or have color codes or control characters, are
+	// left blank.
+	writer.packets = nil
+	chunk.reqSetSignText(writer, &loc, [4]string{"Welcome", "to the longest sign", "§4red", "tab\there"})
+	expected := signPacket(loc, [4]string{"Welcome", "", "", ""})
+	if len(writer.packets) != 1 || !bytes.Equal(writer.packets[0], expected) {
+		t.Fatalf("expected sign update %x, got %x", expected, writer.packets)
+	}
+
+	// Signs can only be written once.
+	writer.packets = nil
+	chunk.reqSetSignText(writer, &loc, [4]string{"Changed", "", "", ""})
+	if len(writer.packets) != 1 || !bytes.Equal(writer.packets[0], expected) {
+		t.Errorf("expected sign to be unchanged %x, got %x", expected, writer.packets)
+	}
+
+	// Players are sent the text of signs with the chunk.
+	reader := &testPlayerClient{entityId: 101}
+	chunk.reqSubscribeChunk(reader.entityId, reader, false)
+	found := false
+	for _, packet := range reader.packets {
+		if bytes.Equal(packet, expected) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected sign update %x sent with the chunk, got %x", expected, reader.packets)
+	}
+
+	// Signs that no player placed can't be written.
+	unplaced := BlockXyz{9, 65, 8}
+	setTestBlock(t, shard, unplaced, testSignPost)
+	writer.packets = nil
+	chunk.reqSetSignText(writer, &unplaced, [4]string{"Hello", "", "", ""})
+	if len(writer.packets) != 0 {
+		t.Errorf("expected no update for an unplaced sign, got %x", writer.packets)
+	}
+
+	// Breaking the sign removes its text.
+	setTestBlock(t, shard, loc, BlockIdAir)
+	index, _, _ := chunk.getBlockIndexByBlockXyz(&loc)
+	if tileEntity := chunk.TileEntity(index); tileEntity != nil {
+		t.Errorf("expected sign tile entity to be removed, got %v", tileEntity)
+	}
+}
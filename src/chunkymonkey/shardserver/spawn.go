@@ -0,0 +1,26 @@
+package shardserver
+
+import (
+	. "chunkymonkey/types"
+)
+
+// spawnPosition returns the position nearest above position at which a player
+// has room to stand, so that they don't spawn inside solid blocks. The
+// position is returned unchanged if the player already has room, or if its
+// chunk isn't loaded.
+func (shard *ChunkShard) spawnPosition(position AbsXyz) AbsXyz {
+	feet := position.ToBlockXyz()
+	if _, _, ok := shard.BlockAt(*feet); !ok {
+		return position
+	}
+
+	for at := feet; at != nil; at = at.AddXyz(0, 1, 0) {
+		if !shard.isSolidAt(at, 0) && !shard.isSolidAt(at, 1) {
+			if at.Y != feet.Y {
+				position.Y = AbsCoord(at.Y)
+			}
+			return position
+		}
+	}
+	return position
+}
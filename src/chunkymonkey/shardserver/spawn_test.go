@@ -0,0 +1,37 @@
+package shardserver
+
+import (
+	"testing"
+
+	. "chunkymonkey/types"
+)
+
+func TestChunkShard_SpawnPosition(t *testing.T) {
+	const stone = BlockId(1)
+
+	type Test struct {
+		desc     string
+		blocks   []BlockXyz // Blocks to set to stone.
+		position AbsXyz
+		expected AbsXyz
+	}
+
+	var tests = []Test{
+		{"open", nil, AbsXyz{8.5, 65.2, 8.5}, AbsXyz{8.5, 65.2, 8.5}},
+		{"in ground", nil, AbsXyz{8.5, 60, 8.5}, AbsXyz{8.5, 65, 8.5}},
+		{"head blocked", []BlockXyz{{8, 66, 8}}, AbsXyz{8.5, 65, 8.5}, AbsXyz{8.5, 67, 8.5}},
+		{"one block gap", []BlockXyz{{8, 66, 8}, {8, 68, 8}}, AbsXyz{8.5, 65, 8.5}, AbsXyz{8.5, 69, 8.5}},
+		{"unloaded", nil, AbsXyz{40, 60, 40}, AbsXyz{40, 60, 40}},
+	}
+
+	for _, test := range tests {
+		shard := newTestShard(t, ChunkXz{0, 0})
+		for _, loc := range test.blocks {
+			shard.SetBlockAt(loc, stone, 0)
+		}
+
+		if result := shard.spawnPosition(test.position); result != test.expected {
+			t.Errorf("%s: expected %v got %v", test.desc, test.expected, result)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package shardserver
+
+import (
+	"sync"
+
+	"chunkymonkey/gamerules"
+)
+
+// ShardStats count what is loaded in shards.
+type ShardStats struct {
+	Chunks   int            // Chunks loaded.
+	Entities map[string]int // Non-player entities, by kind.
+}
+
+// add adds other to the stats.
+func (stats *ShardStats) add(other *ShardStats) {
+	stats.Chunks += other.Chunks
+	for kind, count := range other.Entities {
+		stats.Entities[kind] += count
+	}
+}
+
+// shardStats is a snapshot of a shard's stats, taken by the shard itself so
+// that they can be read without sending it a request.
+type shardStats struct {
+	lock  sync.Mutex
+	stats ShardStats
+}
+
+func (s *shardStats) set(stats ShardStats) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.stats = stats
+}
+
+func (s *shardStats) addTo(total *ShardStats) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	total.add(&s.stats)
+}
+
+// entityKind returns the kind that an entity is counted as in ShardStats.
+func entityKind(entity gamerules.INonPlayerEntity) string {
+	switch entity.(type) {
+	case *gamerules.Item:
+		return "item"
+	case gamerules.IMob:
+		return "mob"
+	case *gamerules.Object:
+		return "object"
+	}
+	return "other"
+}
+
+// updateStats takes a new snapshot of the shard's stats.
+func (shard *ChunkShard) updateStats() {
+	stats := ShardStats{Entities: make(map[string]int)}
+	for _, chunk := range shard.chunks {
+		if chunk != nil {
+			stats.Chunks++
+			for _, entity := range chunk.entities {
+				stats.Entities[entityKind(entity)]++
+			}
+		}
+	}
+	shard.stats.set(stats)
+}
+
+// Stats returns the total of the stats of all shards. They are updated by each
+// shard about once a second.
+func (mgr *LocalShardManager) Stats() (stats ShardStats) {
+	mgr.lock.Lock()
+	defer mgr.lock.Unlock()
+
+	stats.Entities = make(map[string]int)
+	for _, shard := range mgr.shards {
+		shard.stats.addTo(&stats)
+	}
+	return
+}
@@ -0,0 +1,106 @@
+package shardserver
+
+import (
+	"flag"
+	"io"
+
+	"chunkymonkey/gamerules"
+	"chunkymonkey/proto"
+	. "chunkymonkey/types"
+)
+
+// Entities are only shown to players within these distances of them, along
+// both the X and Z axes. Entities are only sent from the chunks that a player
+// is subscribed to, so ranges beyond the view distance have no effect.
+var (
+	playerTrackingRange = flag.Int(
+		"tracking_range_players", ChunkRadius*ChunkSizeH,
+		"Distance in blocks within which players are shown other players.")
+	mobTrackingRange = flag.Int(
+		"tracking_range_mobs", 80,
+		"Distance in blocks within which players are shown mobs.")
+	itemTrackingRange = flag.Int(
+		"tracking_range_items", 64,
+		"Distance in blocks within which players are shown dropped items.")
+	objectTrackingRange = flag.Int(
+		"tracking_range_objects", 80,
+		"Distance in blocks within which players are shown objects such as "+
+			"boats and minecarts.")
+)
+
+// trackingHysteresis is how far beyond its tracking range an entity must go
+// before it is hidden again, so that entities near the edge of the range
+// aren't repeatedly spawned and destroyed.
+const trackingHysteresis = AbsCoord(8)
+
+// entityTrackingRange returns the distance within which the entity is shown
+// to players.
+func entityTrackingRange(e gamerules.INonPlayerEntity) AbsCoord {
+	switch e.(type) {
+	case *gamerules.Item:
+		return AbsCoord(*itemTrackingRange)
+	case gamerules.IMob:
+		return AbsCoord(*mobTrackingRange)
+	}
+	return AbsCoord(*objectTrackingRange)
+}
+
+// tracker is a shard's record of which entities in its chunks have been
+// spawned on a player's client. There is one per player connected to the
+// shard.
+type tracker struct {
+	positioned bool // Until the player's position is known, all are shown.
+	position   AbsXyz
+	tracked    map[EntityId]bool
+}
+
+func newTracker() *tracker {
+	return &tracker{
+		tracked: make(map[EntityId]bool),
+	}
+}
+
+func (t *tracker) setPosition(position *AbsXyz) {
+	t.position = *position
+	t.positioned = true
+}
+
+// inRange returns true if an entity at the position should be shown to the
+// player.
+func (t *tracker) inRange(position *AbsXyz, trackingRange AbsCoord, tracked bool) bool {
+	if !t.positioned {
+		return true
+	}
+	if tracked {
+		trackingRange += trackingHysteresis
+	}
+	dx, dz := position.X-t.position.X, position.Z-t.position.Z
+	return dx >= -trackingRange && dx <= trackingRange && dz >= -trackingRange && dz <= trackingRange
+}
+
+// update spawns the entity on the player's client when it comes within range,
+// and destroys it when it leaves, writing the packets to writer. Returns true
+// if the player's client has the entity afterwards.
+func (t *tracker) update(writer io.Writer, entityId EntityId, position *AbsXyz, trackingRange AbsCoord, sendSpawn func(io.Writer) error) bool {
+	tracked := t.tracked[entityId]
+	inRange := t.inRange(position, trackingRange, tracked)
+
+	switch {
+	case inRange && !tracked:
+		t.tracked[entityId] = true
+		sendSpawn(writer)
+	case !inRange && tracked:
+		delete(t.tracked, entityId)
+		proto.WriteEntityDestroy(writer, entityId)
+	}
+
+	return inRange
+}
+
+// forget stops tracking the entity, returning true if the player's client had
+// it.
+func (t *tracker) forget(entityId EntityId) (tracked bool) {
+	tracked = t.tracked[entityId]
+	delete(t.tracked, entityId)
+	return
+}
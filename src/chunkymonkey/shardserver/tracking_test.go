@@ -0,0 +1,105 @@
+package shardserver
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"chunkymonkey/gamerules"
+	"chunkymonkey/generation"
+	"chunkymonkey/proto"
+	. "chunkymonkey/types"
+)
+
+func TestTracker_Update(t *testing.T) {
+	tr := newTracker()
+	tr.setPosition(&AbsXyz{0, 64, 0})
+	sendSpawn := func(w io.Writer) error {
+		_, err := w.Write([]byte{proto.PacketIdItemSpawn})
+		return err
+	}
+
+	type Test struct {
+		x        AbsCoord
+		packetId byte // 0 for no packet.
+		tracked  bool
+	}
+
+	var tests = []Test{
+		{100, 0, false},
+		{64, proto.PacketIdItemSpawn, true},
+		{-70, 0, true}, // Within the hysteresis.
+		{-73, proto.PacketIdEntityDestroy, false},
+		{70, 0, false},
+		{-10, proto.PacketIdItemSpawn, true},
+	}
+
+	for _, test := range tests {
+		buf := new(bytes.Buffer)
+		tracked := tr.update(buf, 5, &AbsXyz{8, 64, test.x}, 64, sendSpawn)
+		if tracked != test.tracked || tr.tracked[5] != test.tracked {
+			t.Errorf("At z=%v: expected tracked=%t, got %t", test.x, test.tracked, tracked)
+		}
+		var packetId byte
+		if buf.Len() > 0 {
+			packetId = buf.Bytes()[0]
+		}
+		if packetId != test.packetId {
+			t.Errorf("At z=%v: expected packet 0x%02x, got 0x%02x", test.x, test.packetId, packetId)
+		}
+	}
+}
+
+// TestChunk_TrackingRange checks that entities are only sent to players within
+// their kind's range.
+func TestChunk_TrackingRange(t *testing.T) {
+	defer func(r int) { *itemTrackingRange = r }(*itemTrackingRange)
+	defer func(r int) { *playerTrackingRange = r }(*playerTrackingRange)
+	*itemTrackingRange = 64
+	*playerTrackingRange = 160
+
+	chunk := newTestChunk(t, generation.NewTestGenerator(0), ChunkXz{0, 0})
+	player := &testPlayerClient{entityId: 100}
+	chunk.shard.tracker(player.entityId).setPosition(&AbsXyz{108, 70, 8})
+	chunk.reqSubscribeChunk(player.entityId, player, false)
+
+	sent := func() (packetIds []byte) {
+		for _, packet := range player.packets {
+			packetIds = append(packetIds, packet[0])
+		}
+		player.packets = nil
+		return
+	}
+
+	// A pickup item 100 blocks away is not sent.
+	sent()
+	item := gamerules.NewItem(1, 1, 0, &AbsXyz{8, 70, 8}, &AbsVelocity{}, 0)
+	chunk.AddEntity(item)
+	chunk.sendUpdate()
+	if packetIds := sent(); len(packetIds) != 0 {
+		t.Errorf("Expected the item not to be sent, got packets %x", packetIds)
+	}
+
+	// A player at the same distance is.
+	chunk.reqAddPlayerData(101, "other", AbsXyz{8, 70, 8}, LookBytes{}, &gamerules.PlayerEquipment{})
+	if packetIds := sent(); len(packetIds) != 1 || packetIds[0] != proto.PacketIdNamedEntitySpawn {
+		t.Errorf("Expected the player to be spawned, got packets %x", packetIds)
+	}
+
+	// The item is spawned once the player comes within range.
+	chunk.shard.tracker(player.entityId).setPosition(&AbsXyz{40, 70, 8})
+	chunk.sendUpdate()
+	if packetIds := sent(); len(packetIds) != 1 || packetIds[0] != proto.PacketIdItemSpawn {
+		t.Errorf("Expected the item to be spawned, got packets %x", packetIds)
+	}
+
+	// Only the tracked entities are destroyed on unsubscribing.
+	chunk.reqUnsubscribeChunk(player.entityId, true)
+	expected := new(bytes.Buffer)
+	proto.WriteEntityDestroy(expected, item.EntityId)
+	proto.WriteEntityDestroy(expected, 101)
+	proto.WritePreChunk(expected, &chunk.loc, ChunkUnload)
+	if len(player.packets) != 1 || !bytes.Equal(player.packets[0], expected.Bytes()) {
+		t.Errorf("Expected packets %x, got %x", expected.Bytes(), player.packets)
+	}
+}
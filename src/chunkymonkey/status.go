@@ -0,0 +1,120 @@
+package chunkymonkey
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"chunkymonkey/player"
+	. "chunkymonkey/types"
+)
+
+// Version is the version of the server, as shown in its status. It can be set
+// when building, with -ldflags "-X chunkymonkey.Version=<version>".
+var Version = "dev"
+
+// ServerStatus is the status document served by StatusHandler, for web
+// dashboards and monitoring. It is meant to be safe to expose publicly, so
+// holds nothing about the server's internals.
+type ServerStatus struct {
+	Version      string         `json:"version"`
+	UptimeSec    float64        `json:"uptime-sec"`
+	Motd         string         `json:"motd"`
+	Players      []PlayerStatus `json:"players"`
+	ChunksLoaded int            `json:"chunks-loaded"`
+	WorldTime    Ticks          `json:"world-time"`
+	Weather      string         `json:"weather"`
+	// Tps is the number of ticks run in the last second or so.
+	Tps float64 `json:"tps"`
+}
+
+type PlayerStatus struct {
+	Name     string `json:"name"`
+	Position AbsXyz `json:"position"`
+	PingMs   int16  `json:"ping-ms"`
+}
+
+// tickRate measures the ticks run per second. It is only used by the main
+// loop.
+type tickRate struct {
+	since time.Time
+	tps   float64
+}
+
+// updateTickRate measures the tick rate since the previous update, which was
+// TicksPerSecond ticks ago.
+func (game *Game) updateTickRate() {
+	now := game.clock.Now()
+	if elapsed := now.Sub(game.tickRate.since); elapsed > 0 {
+		game.tickRate.tps = TicksPerSecond / elapsed.Seconds()
+	}
+	game.tickRate.since = now
+}
+
+// Status takes a snapshot of the server's status. The game's state is read on
+// its main loop, and the players' positions are then read from each player.
+func (game *Game) Status() (status ServerStatus) {
+	var players []*player.Player
+	result := make(chan bool)
+	game.enqueue(func(_ *Game) {
+		status = ServerStatus{
+			Version:      Version,
+			UptimeSec:    game.clock.Now().Sub(game.started).Seconds(),
+			Motd:         game.serverDesc,
+			ChunksLoaded: game.shardManager.Stats().Chunks,
+			WorldTime:    game.time,
+			// There is no weather yet.
+			Weather: "clear",
+			Tps:     game.tickRate.tps,
+		}
+		for _, player := range game.players {
+			players = append(players, player)
+		}
+		result <- true
+	})
+	<-result
+
+	status.Players = make([]PlayerStatus, 0, len(players))
+	for _, player := range players {
+		status.Players = append(status.Players, PlayerStatus{
+			Name:     player.Name(),
+			Position: player.PositionSnapshot(),
+			PingMs:   player.Ping(),
+		})
+	}
+	sort.Slice(status.Players, func(i, j int) bool {
+		return strings.ToLower(status.Players[i].Name) < strings.ToLower(status.Players[j].Name)
+	})
+	return
+}
+
+// StatusHandler serves the game's status as JSON. If token is set, requests
+// must give it in an "Authorization: Bearer <token>" header.
+func (game *Game) StatusHandler(token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			given := r.Header.Get("Authorization")
+			if subtle.ConstantTimeCompare([]byte(given), []byte("Bearer "+token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		if r.Method != "GET" && r.Method != "HEAD" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := json.MarshalIndent(game.Status(), "", "  ")
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write(body)
+	})
+}
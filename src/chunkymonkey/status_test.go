@@ -0,0 +1,72 @@
+package chunkymonkey
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGame_StatusHandler(t *testing.T) {
+	game, listener := newTestGame(t)
+	loginPlaced(t, listener, "alice")
+	game.SetTime(1234)
+
+	handler := game.StatusHandler("secret")
+
+	type Test struct {
+		header   string
+		expected int
+	}
+
+	var tests = []Test{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"secret", http.StatusUnauthorized},
+		{"Bearer secret", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/status", nil)
+		if test.header != "" {
+			req.Header.Set("Authorization", test.header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != test.expected {
+			t.Errorf("Authorization %q: expected status %d, got %d", test.header, test.expected, rec.Code)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/status", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var status ServerStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Bad status JSON: %v\n%s", err, rec.Body.String())
+	}
+	if status.Motd != "test server" || status.Version != Version {
+		t.Errorf("Unexpected server info in %+v", status)
+	}
+	if len(status.Players) != 1 || status.Players[0].Name != "alice" {
+		t.Errorf("Expected alice to be online, got %+v", status.Players)
+	}
+	if status.WorldTime < 1234 {
+		t.Errorf("Expected world time of at least 1234, got %d", status.WorldTime)
+	}
+}
+
+func TestGame_StatusHandlerNoToken(t *testing.T) {
+	game, _ := newTestGame(t)
+
+	rec := httptest.NewRecorder()
+	game.StatusHandler("").ServeHTTP(rec, httptest.NewRequest("GET", "/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if contentType := rec.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected JSON, got %q", contentType)
+	}
+}
@@ -0,0 +1,281 @@
+package testconn
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"chunkymonkey/proto"
+	. "chunkymonkey/types"
+)
+
+// LoginTimeout is how long Login waits for each reply from the server.
+const LoginTimeout = 10 * time.Second
+
+// sharedSecretLength is the length of the secret that LoginEncrypted agrees
+// with the server, which makes for AES-128.
+const sharedSecretLength = 16
+
+var ErrTimeout = errors.New("timed out waiting for packet")
+
+// DisconnectError is returned when the server disconnects the client, with
+// the reason that it gave.
+type DisconnectError string
+
+func (err DisconnectError) Error() string {
+	return fmt.Sprintf("disconnected: %s", string(err))
+}
+
+// Client is the client end of a connection to the server under test. It
+// decodes everything that the server sends it in the background, for the
+// test to wait for.
+type Client struct {
+	Conn     *FakeConn
+	Writer   io.Writer // Packets for the server, encrypted if Conn is.
+	EntityId EntityId  // Set by Login.
+
+	reader   io.Reader
+	packets  chan *Packet
+	err      error     // Why packets was closed. Read only once it is.
+	received []*Packet // Packets returned by Next so far.
+}
+
+// NewClient starts decoding the packets that the server sends over conn.
+func NewClient(conn *FakeConn) *Client {
+	return newClient(conn, conn)
+}
+
+// newClient starts decoding the packets that the server sends over conn, as
+// read from rw, which also writes the client's packets.
+func newClient(conn *FakeConn, rw io.ReadWriter) *Client {
+	client := &Client{
+		Conn:    conn,
+		Writer:  rw,
+		reader:  rw,
+		packets: make(chan *Packet, 1024),
+	}
+	go client.receiveLoop()
+	return client
+}
+
+func (client *Client) receiveLoop() {
+	defer close(client.packets)
+	for {
+		packet, err := ReadPacket(client.reader)
+		if err != nil {
+			client.err = err
+			return
+		}
+		client.packets <- packet
+	}
+}
+
+// Login connects to the listener and logs in as username. The server must not
+// be checking logins with minecraft.net. It returns once the server has sent
+// the login packet, or else the error that stopped the login, which is a
+// DisconnectError if the server refused it.
+func Login(listener *Listener, username string) (client *Client, err error) {
+	return LoginVersion(listener, username, proto.MaxProtocolVersion)
+}
+
+// LoginVersion is Login, with the client claiming the given protocol version.
+func LoginVersion(listener *Listener, username string, version int32) (client *Client, err error) {
+	conn, err := listener.Dial()
+	if err != nil {
+		return
+	}
+	client = NewClient(conn)
+
+	if err = proto.ClientWriteHandshake(conn, username); err != nil {
+		return nil, err
+	}
+	if _, err = client.WaitFor(LoginTimeout, proto.PacketIdHandshake, nil); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if err = client.login(username, version); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// LoginEncrypted is Login to a server that encrypts connections. Packets to
+// the server must be written to the client's Writer.
+func LoginEncrypted(listener *Listener, username string) (client *Client, err error) {
+	conn, err := listener.Dial()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			conn.Close()
+		}
+	}()
+
+	if err = proto.ClientWriteHandshake(conn, username); err != nil {
+		return
+	}
+
+	// The key exchange is read here rather than by the client, as everything
+	// after it is encrypted.
+	request, err := readPacketExpect(conn, proto.PacketIdEncryptionKeyRequest)
+	if err != nil {
+		return
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(request.Args[1].([]byte))
+	if err != nil {
+		return
+	}
+	rsaKey, ok := publicKey.(*rsa.PublicKey)
+	if !ok {
+		err = errors.New("server public key is not an RSA key")
+		return
+	}
+
+	sharedSecret := make([]byte, sharedSecretLength)
+	if _, err = rand.Read(sharedSecret); err != nil {
+		return
+	}
+	encryptedSecret, err := rsa.EncryptPKCS1v15(rand.Reader, rsaKey, sharedSecret)
+	if err != nil {
+		return
+	}
+	encryptedToken, err := rsa.EncryptPKCS1v15(rand.Reader, rsaKey, request.Args[2].([]byte))
+	if err != nil {
+		return
+	}
+	if err = proto.WriteEncryptionKeyResponse(conn, encryptedSecret, encryptedToken); err != nil {
+		return
+	}
+	if _, err = readPacketExpect(conn, proto.PacketIdEncryptionKeyResponse); err != nil {
+		return
+	}
+
+	encrypted, err := proto.WrapConn(conn, sharedSecret)
+	if err != nil {
+		return
+	}
+	client = newClient(conn, encrypted)
+	if err = client.login(username, proto.MaxProtocolVersion); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// readPacketExpect reads a packet with the given ID from reader. Any other
+// packet is an error, which is a DisconnectError for a disconnect packet.
+func readPacketExpect(reader io.Reader, id byte) (packet *Packet, err error) {
+	if packet, err = ReadPacket(reader); err != nil {
+		return
+	}
+	switch packet.Id {
+	case id:
+		return
+	case proto.PacketIdDisconnect:
+		reason, _ := packet.Args[0].(string)
+		return nil, DisconnectError(reason)
+	}
+	return nil, fmt.Errorf("expected packet 0x%02x, got 0x%02x", id, packet.Id)
+}
+
+// login sends the login packet once the handshake is done, and waits for the
+// server's reply.
+func (client *Client) login(username string, version int32) (err error) {
+	if err = proto.ClientWriteLoginVersion(client.Writer, version, username, ""); err != nil {
+		return
+	}
+	packet, err := client.WaitFor(LoginTimeout, proto.PacketIdLogin, nil)
+	if err != nil {
+		client.Conn.Close()
+		return
+	}
+	client.EntityId, _ = packet.EntityId()
+	return
+}
+
+// Next returns the next packet from the server. The error is ErrTimeout if
+// none arrives in time, or else the error that stopped packets being read.
+func (client *Client) Next(timeout time.Duration) (packet *Packet, err error) {
+	select {
+	case packet, ok := <-client.packets:
+		if !ok {
+			return nil, client.err
+		}
+		client.received = append(client.received, packet)
+		return packet, nil
+	case <-time.After(timeout):
+		return nil, ErrTimeout
+	}
+}
+
+// WaitFor skips packets until one with the given ID arrives that match
+// accepts, or any with the ID if match is nil. The timeout applies to the
+// wait as a whole. A disconnect packet that isn't waited for is returned as a
+// DisconnectError.
+func (client *Client) WaitFor(timeout time.Duration, id byte, match func(*Packet) bool) (packet *Packet, err error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		if packet, err = client.Next(deadline.Sub(time.Now())); err != nil {
+			return nil, err
+		}
+		if packet.Id == id && (match == nil || match(packet)) {
+			return packet, nil
+		}
+		if packet.Id == proto.PacketIdDisconnect {
+			reason, _ := packet.Args[0].(string)
+			return nil, DisconnectError(reason)
+		}
+	}
+}
+
+// Collect returns the packets that arrive until none has for the quiet
+// period, or the connection ends.
+func (client *Client) Collect(quiet time.Duration) (packets []*Packet) {
+	for {
+		packet, err := client.Next(quiet)
+		if err != nil {
+			return
+		}
+		packets = append(packets, packet)
+	}
+}
+
+// Received returns the packets with the given ID that match accepts, or all
+// with the ID if match is nil, out of those already returned by Next,
+// including those skipped by WaitFor.
+func (client *Client) Received(id byte, match func(*Packet) bool) (packets []*Packet) {
+	for _, packet := range client.received {
+		if packet.Id == id && (match == nil || match(packet)) {
+			packets = append(packets, packet)
+		}
+	}
+	return
+}
+
+// Seen returns the first packet with the given ID that match accepts, or any
+// with the ID if match is nil, whether it was already received or is still
+// to come. It is for packets whose order relative to others isn't certain.
+func (client *Client) Seen(timeout time.Duration, id byte, match func(*Packet) bool) (packet *Packet, err error) {
+	if packets := client.Received(id, match); len(packets) > 0 {
+		return packets[0], nil
+	}
+	return client.WaitFor(timeout, id, match)
+}
+
+// Close closes the client's end of the connection.
+func (client *Client) Close() error {
+	return client.Conn.Close()
+}
+
+// ForEntity matches packets about the entity.
+func ForEntity(entityId EntityId) func(*Packet) bool {
+	return func(packet *Packet) bool {
+		id, ok := packet.EntityId()
+		return ok && id == entityId
+	}
+}
@@ -0,0 +1,278 @@
+package testconn
+
+import (
+	"bytes"
+	"io"
+
+	"chunkymonkey/proto"
+	. "chunkymonkey/types"
+)
+
+// Packet is a packet decoded from the server. Args holds the values that it
+// was decoded into, in order. Packets that decode into more than one handler
+// call (e.g PacketIdPlayerPositionLook) have the values from each call.
+type Packet struct {
+	Id   byte
+	Args []interface{}
+}
+
+// EntityId returns the entity that the packet is about, for packets whose
+// first value is an EntityId.
+func (packet *Packet) EntityId() (entityId EntityId, ok bool) {
+	if len(packet.Args) > 0 {
+		entityId, ok = packet.Args[0].(EntityId)
+	}
+	return
+}
+
+// ReadPacket reads and decodes a single packet sent by the server.
+func ReadPacket(reader io.Reader) (packet *Packet, err error) {
+	var id [1]byte
+	if _, err = io.ReadFull(reader, id[:]); err != nil {
+		return
+	}
+
+	packet = &Packet{Id: id[0]}
+	reader = io.MultiReader(bytes.NewReader(id[:]), reader)
+	if err = proto.ClientReadPacket(reader, &decoder{packet}); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// decoder records the values that a packet is decoded into.
+type decoder struct {
+	packet *Packet
+}
+
+func (d *decoder) record(args ...interface{}) {
+	d.packet.Args = append(d.packet.Args, args...)
+}
+
+func (d *decoder) PacketKeepAlive(id int32) {
+	d.record(id)
+}
+
+func (d *decoder) PacketChatMessage(message string) {
+	d.record(message)
+}
+
+func (d *decoder) PacketEntityAction(entityId EntityId, action EntityAction) {
+	d.record(entityId, action)
+}
+
+func (d *decoder) PacketUseEntity(user EntityId, target EntityId, leftClick bool) {
+	d.record(user, target, leftClick)
+}
+
+func (d *decoder) PacketRespawn(dimension DimensionId, unknown int8, gameType GameType, worldHeight int16, mapSeed RandomSeed) {
+	d.record(dimension, unknown, gameType, worldHeight, mapSeed)
+}
+
+func (d *decoder) PacketPlayerPosition(position *AbsXyz, stance AbsCoord, onGround bool) {
+	d.record(position, stance, onGround)
+}
+
+func (d *decoder) PacketPlayerLook(look *LookDegrees, onGround bool) {
+	d.record(look, onGround)
+}
+
+func (d *decoder) PacketPlayerBlockHit(status DigStatus, blockLoc *BlockXyz, face Face) {
+	d.record(status, blockLoc, face)
+}
+
+func (d *decoder) PacketPlayerBlockInteract(itemTypeId ItemTypeId, blockLoc *BlockXyz, face Face, amount ItemCount, data ItemData) {
+	d.record(itemTypeId, blockLoc, face, amount, data)
+}
+
+func (d *decoder) PacketEntityAnimation(entityId EntityId, animation EntityAnimation) {
+	d.record(entityId, animation)
+}
+
+func (d *decoder) PacketWindowTransaction(windowId WindowId, txId TxId, accepted bool) {
+	d.record(windowId, txId, accepted)
+}
+
+func (d *decoder) PacketSignUpdate(position *BlockXyz, lines [4]string) {
+	d.record(position, lines)
+}
+
+func (d *decoder) PacketEncryptionKeyResponse(sharedSecret, verifyToken []byte) {
+	d.record(sharedSecret, verifyToken)
+}
+
+func (d *decoder) PacketDisconnect(reason string) {
+	d.record(reason)
+}
+
+func (d *decoder) PacketClientLogin(entityId EntityId, mapSeed RandomSeed, serverMode int32, dimension DimensionId, unknown int8, worldHeight, maxPlayers byte) {
+	d.record(entityId, mapSeed, serverMode, dimension, unknown, worldHeight, maxPlayers)
+}
+
+func (d *decoder) PacketClientHandshake(serverId string) {
+	d.record(serverId)
+}
+
+func (d *decoder) PacketTimeUpdate(time Ticks) {
+	d.record(time)
+}
+
+func (d *decoder) PacketBedUse(flag bool, bedLoc *BlockXyz) {
+	d.record(flag, bedLoc)
+}
+
+func (d *decoder) PacketNamedEntitySpawn(entityId EntityId, name string, position *AbsIntXyz, look *LookBytes, currentItem ItemTypeId) {
+	d.record(entityId, name, position, look, currentItem)
+}
+
+func (d *decoder) PacketEntityEquipment(entityId EntityId, slot SlotId, itemTypeId ItemTypeId, data ItemData) {
+	d.record(entityId, slot, itemTypeId, data)
+}
+
+func (d *decoder) PacketSpawnPosition(position *BlockXyz) {
+	d.record(position)
+}
+
+func (d *decoder) PacketUpdateHealth(health Health, food FoodUnits, foodSaturation float32) {
+	d.record(health, food, foodSaturation)
+}
+
+func (d *decoder) PacketItemSpawn(entityId EntityId, itemTypeId ItemTypeId, count ItemCount, data ItemData, location *AbsIntXyz, orientation *OrientationBytes) {
+	d.record(entityId, itemTypeId, count, data, location, orientation)
+}
+
+func (d *decoder) PacketItemCollect(collectedItem EntityId, collector EntityId) {
+	d.record(collectedItem, collector)
+}
+
+func (d *decoder) PacketObjectSpawn(entityId EntityId, objType ObjTypeId, position *AbsIntXyz, objectData *proto.ObjectData) {
+	d.record(entityId, objType, position, objectData)
+}
+
+func (d *decoder) PacketEntitySpawn(entityId EntityId, mobType EntityMobType, position *AbsIntXyz, look *LookBytes, data []proto.EntityMetadata) {
+	d.record(entityId, mobType, position, look, data)
+}
+
+func (d *decoder) PacketPaintingSpawn(entityId EntityId, title string, position *BlockXyz, paintingType PaintingTypeId) {
+	d.record(entityId, title, position, paintingType)
+}
+
+func (d *decoder) PacketExperienceOrb(entityId EntityId, position AbsIntXyz, count int16) {
+	d.record(entityId, position, count)
+}
+
+func (d *decoder) PacketEntityVelocity(entityId EntityId, velocity *Velocity) {
+	d.record(entityId, velocity)
+}
+
+func (d *decoder) PacketEntityDestroy(entityId EntityId) {
+	d.record(entityId)
+}
+
+func (d *decoder) PacketEntity(entityId EntityId) {
+	d.record(entityId)
+}
+
+func (d *decoder) PacketEntityRelMove(entityId EntityId, movement *RelMove) {
+	d.record(entityId, movement)
+}
+
+func (d *decoder) PacketEntityLook(entityId EntityId, look *LookBytes) {
+	d.record(entityId, look)
+}
+
+func (d *decoder) PacketEntityTeleport(entityId EntityId, position *AbsIntXyz, look *LookBytes) {
+	d.record(entityId, position, look)
+}
+
+func (d *decoder) PacketEntityStatus(entityId EntityId, status EntityStatus) {
+	d.record(entityId, status)
+}
+
+func (d *decoder) PacketEntityMetadata(entityId EntityId, metadata []proto.EntityMetadata) {
+	d.record(entityId, metadata)
+}
+
+func (d *decoder) PacketEntityEffect(entityId EntityId, effect EntityEffect, value int8, duration int16) {
+	d.record(entityId, effect, value, duration)
+}
+
+func (d *decoder) PacketEntityRemoveEffect(entityId EntityId, effect EntityEffect) {
+	d.record(entityId, effect)
+}
+
+func (d *decoder) PacketPlayerExperience(experience, level int8, totalExperience int16) {
+	d.record(experience, level, totalExperience)
+}
+
+func (d *decoder) PacketPreChunk(position *ChunkXz, mode ChunkLoadMode) {
+	d.record(position, mode)
+}
+
+func (d *decoder) PacketMapChunk(position *BlockXyz, size *SubChunkSize, data []byte) {
+	d.record(position, size, data)
+}
+
+func (d *decoder) PacketBlockChangeMulti(chunkLoc *ChunkXz, blockCoords []SubChunkXyz, blockTypes []BlockId, blockMetaData []byte) {
+	d.record(chunkLoc, blockCoords, blockTypes, blockMetaData)
+}
+
+func (d *decoder) PacketBlockChange(blockLoc *BlockXyz, blockType BlockId, blockMetaData byte) {
+	d.record(blockLoc, blockType, blockMetaData)
+}
+
+func (d *decoder) PacketNoteBlockPlay(position *BlockXyz, instrument InstrumentId, pitch NotePitch) {
+	d.record(position, instrument, pitch)
+}
+
+func (d *decoder) PacketExplosion(position *AbsXyz, power float32, blockOffsets []proto.ExplosionOffsetXyz) {
+	d.record(position, power, blockOffsets)
+}
+
+func (d *decoder) PacketSoundEffect(sound SoundEffect, position BlockXyz, data int32) {
+	d.record(sound, position, data)
+}
+
+func (d *decoder) PacketState(reason, gameMode byte) {
+	d.record(reason, gameMode)
+}
+
+func (d *decoder) PacketWeather(entityId EntityId, raining bool, position *AbsIntXyz) {
+	d.record(entityId, raining, position)
+}
+
+func (d *decoder) PacketWindowOpen(windowId WindowId, invTypeId InvTypeId, windowTitle string, numSlots byte) {
+	d.record(windowId, invTypeId, windowTitle, numSlots)
+}
+
+func (d *decoder) PacketWindowSetSlot(windowId WindowId, slot SlotId, itemTypeId ItemTypeId, amount ItemCount, data ItemData) {
+	d.record(windowId, slot, itemTypeId, amount, data)
+}
+
+func (d *decoder) PacketWindowItems(windowId WindowId, items []proto.WindowSlot) {
+	d.record(windowId, items)
+}
+
+func (d *decoder) PacketWindowProgressBar(windowId WindowId, prgBarId PrgBarId, value PrgBarValue) {
+	d.record(windowId, prgBarId, value)
+}
+
+func (d *decoder) PacketQuickbarSlotUpdate(slot SlotId, itemId ItemTypeId, count ItemCount, data ItemData) {
+	d.record(slot, itemId, count, data)
+}
+
+func (d *decoder) PacketItemData(itemTypeId ItemTypeId, itemDataId ItemData, data []byte) {
+	d.record(itemTypeId, itemDataId, data)
+}
+
+func (d *decoder) PacketIncrementStatistic(statisticId StatisticId, delta int8) {
+	d.record(statisticId, delta)
+}
+
+func (d *decoder) PacketUserListItem(username string, unknown bool, ping int16) {
+	d.record(username, unknown, ping)
+}
+
+func (d *decoder) PacketEncryptionKeyRequest(serverId string, publicKey, verifyToken []byte) {
+	d.record(serverId, publicKey, verifyToken)
+}
@@ -0,0 +1,161 @@
+// The testconn package is used in testing the server at the protocol level.
+// It provides in-memory connections in place of a network, a decoder for
+// packets sent from the server, and a client that logs in and records what
+// the server sends it.
+package testconn
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+var ErrClosed = errors.New("use of closed fake connection")
+
+type fakeAddr string
+
+func (addr fakeAddr) Network() string { return "fake" }
+func (addr fakeAddr) String() string  { return string(addr) }
+
+// pipe is one direction of a FakeConn. Writes never block, so that a test that
+// doesn't read everything the server sends can't stall the server. Once
+// closed, reads return what was already written before returning io.EOF.
+type pipe struct {
+	lock   sync.Mutex
+	cond   sync.Cond
+	buf    bytes.Buffer
+	closed bool
+}
+
+func newPipe() *pipe {
+	p := new(pipe)
+	p.cond.L = &p.lock
+	return p
+}
+
+func (p *pipe) Read(b []byte) (n int, err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for p.buf.Len() == 0 && !p.closed {
+		p.cond.Wait()
+	}
+	if p.buf.Len() == 0 {
+		return 0, io.EOF
+	}
+	return p.buf.Read(b)
+}
+
+func (p *pipe) Write(b []byte) (n int, err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.closed {
+		return 0, ErrClosed
+	}
+	n, err = p.buf.Write(b)
+	p.cond.Broadcast()
+	return
+}
+
+func (p *pipe) Close() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.closed = true
+	p.cond.Broadcast()
+}
+
+// FakeConn is one end of an in-memory connection, created by Pipe. It
+// implements net.Conn, except that deadlines are ignored.
+type FakeConn struct {
+	rx, tx        *pipe
+	local, remote net.Addr
+}
+
+// Pipe creates a connection, returning the server and client ends of it.
+func Pipe() (server, client *FakeConn) {
+	toServer, toClient := newPipe(), newPipe()
+	serverAddr, clientAddr := fakeAddr("server"), fakeAddr("client")
+	server = &FakeConn{toServer, toClient, serverAddr, clientAddr}
+	client = &FakeConn{toClient, toServer, clientAddr, serverAddr}
+	return
+}
+
+func (conn *FakeConn) Read(b []byte) (n int, err error) {
+	return conn.rx.Read(b)
+}
+
+func (conn *FakeConn) Write(b []byte) (n int, err error) {
+	return conn.tx.Write(b)
+}
+
+// Close closes both directions of the connection. Data already written can
+// still be read by either end.
+func (conn *FakeConn) Close() error {
+	conn.rx.Close()
+	conn.tx.Close()
+	return nil
+}
+
+// CloseRead closes the reading direction of the connection only, so that
+// writes by the other end fail while its reads still wait for data.
+func (conn *FakeConn) CloseRead() error {
+	conn.rx.Close()
+	return nil
+}
+
+func (conn *FakeConn) LocalAddr() net.Addr                { return conn.local }
+func (conn *FakeConn) RemoteAddr() net.Addr               { return conn.remote }
+func (conn *FakeConn) SetDeadline(t time.Time) error      { return nil }
+func (conn *FakeConn) SetReadDeadline(t time.Time) error  { return nil }
+func (conn *FakeConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// Listener is a net.Listener that accepts FakeConns made by Dial.
+type Listener struct {
+	conns     chan net.Conn
+	closed    chan bool
+	closeOnce sync.Once
+}
+
+func NewListener() *Listener {
+	return &Listener{
+		conns:  make(chan net.Conn),
+		closed: make(chan bool),
+	}
+}
+
+// Dial connects to the listener, returning the client end of the connection
+// once the server has accepted it.
+func (l *Listener) Dial() (client *FakeConn, err error) {
+	server, client := Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.closed:
+		return nil, ErrClosed
+	}
+}
+
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, ErrClosed
+	}
+}
+
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+	})
+	return nil
+}
+
+func (l *Listener) Addr() net.Addr {
+	return fakeAddr("server")
+}
@@ -0,0 +1,77 @@
+package testconn
+
+import (
+	"io"
+	"testing"
+
+	"chunkymonkey/proto"
+	. "chunkymonkey/types"
+)
+
+func TestFakeConn(t *testing.T) {
+	server, client := Pipe()
+
+	if _, err := server.Write([]byte("abc")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	server.Close()
+
+	if _, err := server.Write([]byte("d")); err != ErrClosed {
+		t.Errorf("Expected ErrClosed writing to closed conn, got %v", err)
+	}
+
+	// Data written before closing can still be read.
+	buf := make([]byte, 8)
+	if n, err := client.Read(buf); err != nil || string(buf[:n]) != "abc" {
+		t.Errorf("Expected to read \"abc\", got %q, %v", buf[:n], err)
+	}
+	if _, err := client.Read(buf); err != io.EOF {
+		t.Errorf("Expected io.EOF, got %v", err)
+	}
+
+	// Closing one direction leaves the other open.
+	server, client = Pipe()
+	client.CloseRead()
+	if _, err := server.Write([]byte("a")); err != ErrClosed {
+		t.Errorf("Expected ErrClosed writing to conn closed for reading, got %v", err)
+	}
+	if _, err := client.Write([]byte("b")); err != nil {
+		t.Errorf("Expected write from conn closed for reading, got %v", err)
+	}
+}
+
+func TestReadPacket(t *testing.T) {
+	server, client := Pipe()
+
+	proto.WriteEntityDestroy(server, 42)
+	proto.WriteUserListItem(server, "alice", true, 120)
+	proto.WriteChatMessage(server, "hello")
+
+	type Test struct {
+		id   byte
+		args []interface{}
+	}
+
+	var tests = []Test{
+		{proto.PacketIdEntityDestroy, []interface{}{EntityId(42)}},
+		{proto.PacketIdUserListItem, []interface{}{"alice", true, int16(120)}},
+		{proto.PacketIdChatMessage, []interface{}{"hello"}},
+	}
+
+	for _, test := range tests {
+		packet, err := ReadPacket(client)
+		if err != nil {
+			t.Fatalf("ReadPacket: %v", err)
+		}
+		if packet.Id != test.id || len(packet.Args) != len(test.args) {
+			t.Errorf("Expected packet 0x%02x%v, got 0x%02x%v", test.id, test.args, packet.Id, packet.Args)
+			continue
+		}
+		for i := range test.args {
+			if packet.Args[i] != test.args[i] {
+				t.Errorf("Expected packet 0x%02x%v, got 0x%02x%v", test.id, test.args, packet.Id, packet.Args)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package types
+
+// WorldBorder is a square around the world spawn that players can't leave.
+// It spans the blocks no more than Radius blocks from the centre along both
+// the X and Z axes. A Radius of 0 or less disables the border.
+type WorldBorder struct {
+	Center BlockXyz
+	Radius BlockCoord
+}
+
+// Enabled returns true if the border limits where players can go.
+func (border *WorldBorder) Enabled() bool {
+	return border.Radius > 0
+}
+
+// bounds returns the absolute coordinates of the edges of the border.
+func (border *WorldBorder) bounds() (minX, maxX, minZ, maxZ AbsCoord) {
+	radius := AbsCoord(border.Radius)
+	minX = AbsCoord(border.Center.X) - radius
+	maxX = AbsCoord(border.Center.X) + radius + 1
+	minZ = AbsCoord(border.Center.Z) - radius
+	maxZ = AbsCoord(border.Center.Z) + radius + 1
+	return
+}
+
+// ContainsChunk returns true if any part of the chunk is inside the border.
+func (border *WorldBorder) ContainsChunk(loc ChunkXz) bool {
+	if !border.Enabled() {
+		return true
+	}
+	minX, maxX, minZ, maxZ := border.bounds()
+	chunkX := AbsCoord(loc.X) * ChunkSizeH
+	chunkZ := AbsCoord(loc.Z) * ChunkSizeH
+	return chunkX < maxX && chunkX+ChunkSizeH > minX &&
+		chunkZ < maxZ && chunkZ+ChunkSizeH > minZ
+}
+
+// Clamp moves the position to the nearest point inside the border, at the
+// middle of the blocks along the edge, if it is outside. Returns true if the
+// position was moved.
+func (border *WorldBorder) Clamp(pos *AbsXyz) (moved bool) {
+	if !border.Enabled() {
+		return false
+	}
+	minX, maxX, minZ, maxZ := border.bounds()
+	clamp := func(coord *AbsCoord, min, max AbsCoord) {
+		if *coord < min {
+			*coord, moved = min+0.5, true
+		} else if *coord > max {
+			*coord, moved = max-0.5, true
+		}
+	}
+	clamp(&pos.X, minX, maxX)
+	clamp(&pos.Z, minZ, maxZ)
+	return
+}
+
+// DistanceToEdge returns how far inside the border the position is, or a
+// negative distance if it is outside.
+func (border *WorldBorder) DistanceToEdge(pos *AbsXyz) AbsCoord {
+	minX, maxX, minZ, maxZ := border.bounds()
+	distance := pos.X - minX
+	for _, d := range []AbsCoord{maxX - pos.X, pos.Z - minZ, maxZ - pos.Z} {
+		if d < distance {
+			distance = d
+		}
+	}
+	return distance
+}
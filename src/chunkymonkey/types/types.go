@@ -14,6 +14,46 @@ const (
 	NanosecondsInSecond = 1e9
 )
 
+// The times of day at which night starts and ends, in ticks since dawn.
+const (
+	NightStartTicks = Ticks(13000)
+	NightEndTicks   = Ticks(23000)
+)
+
+// The world time counts the ticks since the world was created, and only ever
+// grows, while the days wrap around every TicksPerDay.
+
+// DayTicks returns the time of day, in ticks since dawn, in [0, TicksPerDay).
+func (t Ticks) DayTicks() Ticks {
+	dayTicks := t % TicksPerDay
+	if dayTicks < 0 {
+		dayTicks += TicksPerDay
+	}
+	return dayTicks
+}
+
+// Day returns the number of whole days since the world was created.
+func (t Ticks) Day() int64 {
+	return int64((t - t.DayTicks()) / TicksPerDay)
+}
+
+// IsNight returns true if it is night at the time.
+func (t Ticks) IsNight() bool {
+	dayTicks := t.DayTicks()
+	return dayTicks >= NightStartTicks && dayTicks < NightEndTicks
+}
+
+// IsDay returns true if it is day at the time.
+func (t Ticks) IsDay() bool {
+	return !t.IsNight()
+}
+
+// WithDayTicks returns the time on the same day as t, at the given time of
+// day. dayTicks is wrapped into [0, TicksPerDay).
+func (t Ticks) WithDayTicks(dayTicks Ticks) Ticks {
+	return Ticks(t.Day())*TicksPerDay + dayTicks.DayTicks()
+}
+
 // 1 "TickTime" is the duration of a server "tick". This value is intended for
 // use in sub-tick physics calculations.
 type TickTime float64
@@ -35,8 +75,23 @@ type DimensionId int8
 const (
 	DimensionNether = DimensionId(-1)
 	DimensionNormal = DimensionId(0)
+	DimensionEnd    = DimensionId(1)
 )
 
+// BiomeId identifies the biome of a column of blocks. The values match those
+// used by later versions of the Minecraft world format.
+type BiomeId byte
+
+const (
+	BiomePlains = BiomeId(1)
+	BiomeDesert = BiomeId(2)
+	BiomeForest = BiomeId(4)
+	BiomeTundra = BiomeId(12)
+)
+
+// Biomes are stored in a chunk as an array of ChunkSizeH*ChunkSizeH bytes.
+const ChunkBiomesSize = ChunkSizeH * ChunkSizeH
+
 // GameType indicates the server play mode.
 type GameType byte
 
@@ -126,6 +181,11 @@ var MobNameByType = map[EntityMobType]string{}
 
 type EntityStatus byte
 
+const (
+	EntityStatusHurt = EntityStatus(2)
+	EntityStatusDead = EntityStatus(3)
+)
+
 type EntityAnimation byte
 
 const (
@@ -242,7 +302,13 @@ type BlockId byte
 const (
 	BlockIdMin = 0
 	BlockIdAir = BlockId(0)
-	BlockIdMax = 255
+	// Bedrock is the unbreakable floor of the world.
+	BlockIdBedrock = BlockId(7)
+	// Water breaks the fall of players landing in it.
+	BlockIdWater           = BlockId(8)
+	BlockIdStationaryWater = BlockId(9)
+	BlockIdBed             = BlockId(26)
+	BlockIdMax             = 255
 )
 
 // Block face (0-5)
@@ -280,6 +346,73 @@ func (f Face) Dxyz() (dx BlockCoord, dy BlockYCoord, dz BlockCoord) {
 	return
 }
 
+// Offset returns the offset from a block to its neighbour on the face.
+func (f Face) Offset() BlockXyz {
+	dx, dy, dz := f.Dxyz()
+	return BlockXyz{dx, dy, dz}
+}
+
+// Valid returns true if the face is one of the six faces of a block.
+func (f Face) Valid() bool {
+	return f >= FaceMinValid && f <= FaceMaxValid
+}
+
+// Opposite returns the face on the other side of a block, or FaceNull if the
+// face isn't valid.
+func (f Face) Opposite() Face {
+	if !f.Valid() {
+		return FaceNull
+	}
+	// Opposite faces are numbered in pairs.
+	return f ^ 1
+}
+
+// AllFaces returns the six faces of a block, in the order of their values.
+func AllFaces() [6]Face {
+	return [6]Face{FaceBottom, FaceTop, FaceEast, FaceWest, FaceNorth, FaceSouth}
+}
+
+// FaceFromWire converts a face value as sent by a client. ok is false if the
+// value is neither a valid face nor FaceNull, which clients send when not
+// targeting a block.
+func FaceFromWire(value int8) (face Face, ok bool) {
+	face = Face(value)
+	if face == FaceNull || face.Valid() {
+		return face, true
+	}
+	return FaceNull, false
+}
+
+// ToWire returns the face value as sent in packets.
+func (f Face) ToWire() int8 {
+	return int8(f)
+}
+
+// FaceFromVector returns the face that points most nearly in the direction
+// of v, or FaceNull if v is zero. A ray travelling along v hits the face
+// FaceFromVector of the negated v.
+func FaceFromVector(v *AbsXyz) Face {
+	ax, ay, az := math.Abs(float64(v.X)), math.Abs(float64(v.Y)), math.Abs(float64(v.Z))
+	switch {
+	case ay >= ax && ay >= az && ay > 0:
+		if v.Y > 0 {
+			return FaceTop
+		}
+		return FaceBottom
+	case ax >= az && ax > 0:
+		if v.X > 0 {
+			return FaceSouth
+		}
+		return FaceNorth
+	case az > 0:
+		if v.Z > 0 {
+			return FaceWest
+		}
+		return FaceEast
+	}
+	return FaceNull
+}
+
 // Action-related types and constants
 
 type DigStatus byte
@@ -351,25 +484,36 @@ const (
 
 // Movement-related types and constants
 
-// VelocityComponent in VelocityComponentBlocksPerTick
+// VelocityComponent is a velocity as sent in packets, in units of
+// 1/VelocityComponentPerBlock blocks per tick.
 type VelocityComponent int16
 
 const (
 	VelocityComponentMax = 28800
 	VelocityComponentMin = -28800
 
-	AbsToIntVelocityComponent = TicksPerSecond * 32000 / 100
+	VelocityComponentPerBlock = 8000
 )
 
 type Velocity struct {
 	X, Y, Z VelocityComponent
 }
 
+func (v *Velocity) ToAbsVelocity() *AbsVelocity {
+	return &AbsVelocity{
+		AbsVelocityCoord(v.X) / VelocityComponentPerBlock,
+		AbsVelocityCoord(v.Y) / VelocityComponentPerBlock,
+		AbsVelocityCoord(v.Z) / VelocityComponentPerBlock,
+	}
+}
+
 // AbsVelocityCoord is measured in blocks per tick.
 type AbsVelocityCoord AbsCoord
 
+// ToVelocityComponent converts the velocity to packet units, clamped to the
+// range that clients accept.
 func (v AbsVelocityCoord) ToVelocityComponent() VelocityComponent {
-	scaledV := v * AbsToIntVelocityComponent
+	scaledV := v * VelocityComponentPerBlock
 	if scaledV > VelocityComponentMax {
 		return VelocityComponentMax
 	} else if scaledV < VelocityComponentMin {
@@ -382,7 +526,7 @@ type AbsVelocity struct {
 	X, Y, Z AbsVelocityCoord
 }
 
-func (v *AbsVelocity) ToVelocity() *Velocity {
+func (v *AbsVelocity) ToPacketVelocity() *Velocity {
 	return &Velocity{
 		v.X.ToVelocityComponent(),
 		v.Y.ToVelocityComponent(),
@@ -390,6 +534,44 @@ func (v *AbsVelocity) ToVelocity() *Velocity {
 	}
 }
 
+// PhysicsParams are the constants for the motion of a kind of entity.
+type PhysicsParams struct {
+	// Gravity is the downward acceleration, in blocks per tick per tick.
+	Gravity AbsVelocityCoord
+	// Drag is the fraction of the velocity lost each tick.
+	Drag AbsVelocityCoord
+	// MinSpeed is the speed below which a component of the velocity stops.
+	MinSpeed AbsVelocityCoord
+}
+
+// Accelerate applies gravity over dt ticks, unless onGround, and then drag.
+// It returns true if the velocity has stopped.
+func (v *AbsVelocity) Accelerate(dt TickTime, params *PhysicsParams, onGround bool) (stopped bool) {
+	if !onGround {
+		v.Y -= params.Gravity * AbsVelocityCoord(dt)
+	}
+
+	stopped = true
+	for _, c := range [3]*AbsVelocityCoord{&v.X, &v.Y, &v.Z} {
+		if *c > -params.MinSpeed && *c < params.MinSpeed {
+			*c = 0
+		} else {
+			*c -= *c * params.Drag
+			stopped = false
+		}
+	}
+
+	return
+}
+
+// Integrate advances an entity at pos by one tick of free motion, without
+// any collisions. It returns true if the velocity has stopped.
+func (v *AbsVelocity) Integrate(pos *AbsXyz, params *PhysicsParams) (stopped bool) {
+	stopped = v.Accelerate(1, params, false)
+	pos.ApplyVelocity(1, v)
+	return
+}
+
 // Relative movement, using same units as AbsIntCoord, but in byte form so
 // constrained
 type RelMoveCoord int8
@@ -418,11 +600,55 @@ func (d *AngleDegrees) ToAngleBytes() AngleBytes {
 	return AngleBytes(norm * DegreesToBytes)
 }
 
+// ToAngleDegrees converts the angle to degrees in the range [-180, 180).
+func (b AngleBytes) ToAngleDegrees() AngleDegrees {
+	return AngleDegrees(int8(b)) / DegreesToBytes
+}
+
+// Wrap returns the angle wrapped to the range [-180, 180). Angles that aren't
+// finite become 0.
+func (d AngleDegrees) Wrap() AngleDegrees {
+	if math.IsNaN(float64(d)) || math.IsInf(float64(d), 0) {
+		return 0
+	}
+	norm := math.Mod(float64(d)+180, 360)
+	if norm < 0 {
+		norm += 360
+	}
+	wrapped := AngleDegrees(norm - 180)
+	if wrapped >= 180 {
+		// Rounding to float32 can land on the upper bound.
+		wrapped -= 360
+	}
+	return wrapped
+}
+
 type LookDegrees struct {
 	// Pitch is -ve when looking above the horizontal, and +ve below
 	Yaw, Pitch AngleDegrees
 }
 
+const (
+	MinPitch = AngleDegrees(-90)
+	MaxPitch = AngleDegrees(90)
+)
+
+// Normalize wraps the yaw to the range [-180, 180), and clamps the pitch to
+// the range [MinPitch, MaxPitch]. Clients send any angle, such as a yaw of
+// many turns after the player spins round.
+func (l *LookDegrees) Normalize() {
+	l.Yaw = l.Yaw.Wrap()
+
+	switch {
+	case math.IsNaN(float64(l.Pitch)):
+		l.Pitch = 0
+	case l.Pitch < MinPitch:
+		l.Pitch = MinPitch
+	case l.Pitch > MaxPitch:
+		l.Pitch = MaxPitch
+	}
+}
+
 func (l *LookDegrees) ToLookBytes() *LookBytes {
 	return &LookBytes{
 		l.Yaw.ToAngleBytes(),
@@ -434,6 +660,20 @@ type LookBytes struct {
 	Yaw, Pitch AngleBytes
 }
 
+func (l *LookBytes) ToLookDegrees() *LookDegrees {
+	return &LookDegrees{
+		l.Yaw.ToAngleDegrees(),
+		l.Pitch.ToAngleDegrees(),
+	}
+}
+
+// FacingFromYaw returns the horizontal face that is nearest to the direction
+// of the yaw. A yaw of 0 faces +Z, and 90 faces -X.
+func FacingFromYaw(yaw AngleDegrees) Face {
+	quarter := int(math.Floor(float64(yaw.Wrap())/90+0.5)) & 3
+	return [4]Face{FaceWest, FaceNorth, FaceEast, FaceSouth}[quarter]
+}
+
 type OrientationDegrees struct {
 	Yaw, Pitch, Roll AngleDegrees
 }
@@ -492,11 +732,13 @@ func (p *AbsXyz) ApplyVelocity(dt TickTime, v *AbsVelocity) {
 	p.Z += AbsCoord(float64(v.Z) * float64(dt))
 }
 
+// Convert absolute coordinates to pixel coordinates, rounding down so that
+// negative positions land in the pixel below them rather than towards zero.
 func (p *AbsXyz) ToAbsIntXyz() *AbsIntXyz {
 	return &AbsIntXyz{
-		AbsIntCoord(p.X * PixelsPerBlock),
-		AbsIntCoord(p.Y * PixelsPerBlock),
-		AbsIntCoord(p.Z * PixelsPerBlock),
+		AbsIntCoord(math.Floor(float64(p.X * PixelsPerBlock))),
+		AbsIntCoord(math.Floor(float64(p.Y * PixelsPerBlock))),
+		AbsIntCoord(math.Floor(float64(p.Z * PixelsPerBlock))),
 	}
 }
 
@@ -508,6 +750,12 @@ func (p *AbsXyz) ToBlockXyz() *BlockXyz {
 	}
 }
 
+// Convert absolute coordinates to the chunk they are in, and the coordinates
+// of the block within that chunk.
+func (p *AbsXyz) ToChunkLocal() (chunkLoc *ChunkXz, subLoc *SubChunkXyz) {
+	return p.ToBlockXyz().ToChunkLocal()
+}
+
 func (p *AbsXyz) ToShardXz() ShardXz {
 	return ShardXz{
 		X: ShardCoord(math.Floor(float64(p.X / (ChunkSizeH * ShardSize)))),
@@ -515,11 +763,36 @@ func (p *AbsXyz) ToShardXz() ShardXz {
 	}
 }
 
-func (p *AbsXyz) IsWithinDistanceOf(other *AbsXyz, maxDistance AbsCoord) bool {
+// DistanceSquared returns the square of the distance between the positions.
+func (p *AbsXyz) DistanceSquared(other *AbsXyz) AbsCoord {
 	dx := p.X - other.X
 	dy := p.Y - other.Y
 	dz := p.Z - other.Z
-	return (dx*dx + dy*dy + dz*dz) <= maxDistance*maxDistance
+	return dx*dx + dy*dy + dz*dz
+}
+
+// WithinSphere returns true if the position is no further than radius from
+// centre.
+func (p *AbsXyz) WithinSphere(centre *AbsXyz, radius AbsCoord) bool {
+	return p.DistanceSquared(centre) <= radius*radius
+}
+
+// WithinCylinder returns true if the position is within the upright cylinder
+// standing on base, with the given radius and height. Points on the surface
+// are included. This is the shape of reach for item pickup and mob
+// awareness, which care little about height.
+func (p *AbsXyz) WithinCylinder(base *AbsXyz, radius, height AbsCoord) bool {
+	if p.Y < base.Y || p.Y > base.Y+height {
+		return false
+	}
+	dx := p.X - base.X
+	dz := p.Z - base.Z
+	return dx*dx+dz*dz <= radius*radius
+}
+
+// IsWithinDistanceOf is the same as WithinSphere.
+func (p *AbsXyz) IsWithinDistanceOf(other *AbsXyz, maxDistance AbsCoord) bool {
+	return p.WithinSphere(other, maxDistance)
 }
 
 // Specifies approximate world distance in pixels (absolute / PixelsPerBlock)
@@ -529,11 +802,21 @@ type AbsIntXyz struct {
 	X, Y, Z AbsIntCoord
 }
 
+// Convert pixel coordinates to the block they are in. The shift rounds
+// negative coordinates down, where division would round them towards zero.
 func (p *AbsIntXyz) ToBlockXyz() *BlockXyz {
 	return &BlockXyz{
-		BlockCoord(p.X / PixelsPerBlock),
-		BlockYCoord(p.Y / PixelsPerBlock),
-		BlockCoord(p.Z / PixelsPerBlock),
+		BlockCoord(p.X >> PixelShift),
+		BlockYCoord(p.Y >> PixelShift),
+		BlockCoord(p.Z >> PixelShift),
+	}
+}
+
+func (p *AbsIntXyz) ToAbsXyz() *AbsXyz {
+	return &AbsXyz{
+		AbsCoord(p.X) / PixelsPerBlock,
+		AbsCoord(p.Y) / PixelsPerBlock,
+		AbsCoord(p.Z) / PixelsPerBlock,
 	}
 }
 
@@ -607,6 +890,13 @@ func (chunkLoc ChunkXz) Equals(rhs ChunkXz) bool {
 	return chunkLoc.X == rhs.X && chunkLoc.Z == rhs.Z
 }
 
+// WithinRadius returns true if the chunk is within the square of chunks with
+// sides radius chunks from centre, including the chunks along the sides.
+func (chunkLoc *ChunkXz) WithinRadius(centre *ChunkXz, radius ChunkCoord) bool {
+	return chunkLoc.X >= centre.X-radius && chunkLoc.X <= centre.X+radius &&
+		chunkLoc.Z >= centre.Z-radius && chunkLoc.Z <= centre.Z+radius
+}
+
 // Returns the world BlockXyz position of the (0, 0, 0) block in the chunk
 func (chunkLoc *ChunkXz) ChunkCornerBlockXY() *BlockXyz {
 	return &BlockXyz{
@@ -665,6 +955,12 @@ func (subLoc *SubChunkXyz) BlockIndex() (index BlockIndex, ok bool) {
 	return
 }
 
+// BiomeIndex returns the index of the column's biome within a chunk's
+// biome array.
+func (subLoc *SubChunkXyz) BiomeIndex() int {
+	return int(subLoc.Z&ChunkHMask)<<ChunkHShift | int(subLoc.X&ChunkHMask)
+}
+
 type BlockIndex uint32
 
 func (bi BlockIndex) ToSubChunkXyz() (subLoc SubChunkXyz) {
@@ -829,6 +1125,176 @@ func (blockLoc *BlockXyz) MidPointToAbsXyz() AbsXyz {
 	}
 }
 
+// Collision-related types and constants
+
+// AABB is an axis aligned bounding box, from Min to Max.
+type AABB struct {
+	Min, Max AbsXyz
+}
+
+// BoxSize is the size of an entity's bounding box.
+type BoxSize struct {
+	Width, Height AbsCoord
+}
+
+// The standard sizes of entities' bounding boxes.
+var (
+	PlayerBoxSize       = BoxSize{0.6, 1.8}
+	ItemBoxSize         = BoxSize{0.25, 0.25}
+	ArrowBoxSize        = BoxSize{0.5, 0.5}
+	FallingBlockBoxSize = BoxSize{0.98, 0.98}
+	PrimedTntBoxSize    = BoxSize{0.98, 0.98}
+	HumanoidBoxSize     = BoxSize{0.6, 1.8} // zombies, skeletons, creepers
+	PigBoxSize          = BoxSize{0.9, 0.9}
+	SpiderBoxSize       = BoxSize{1.4, 0.9}
+)
+
+// NewEntityAABB returns the bounding box of an entity of the given size,
+// standing at pos. The box is centred on pos horizontally, with its bottom at
+// pos.
+func NewEntityAABB(pos *AbsXyz, size BoxSize) AABB {
+	w := size.Width / 2
+	return AABB{
+		AbsXyz{pos.X - w, pos.Y, pos.Z - w},
+		AbsXyz{pos.X + w, pos.Y + size.Height, pos.Z + w},
+	}
+}
+
+// NewBlockAABB returns the bounding box of the whole of the block.
+func NewBlockAABB(blockLoc *BlockXyz) AABB {
+	min := blockLoc.ToAbsXyz()
+	return AABB{*min, AbsXyz{min.X + 1, min.Y + 1, min.Z + 1}}
+}
+
+// Intersects returns true if the boxes overlap. Boxes that only touch, such
+// as an entity resting on the ground, don't intersect.
+func (b *AABB) Intersects(other *AABB) bool {
+	return b.Min.X < other.Max.X && b.Max.X > other.Min.X &&
+		b.Min.Y < other.Max.Y && b.Max.Y > other.Min.Y &&
+		b.Min.Z < other.Max.Z && b.Max.Z > other.Min.Z
+}
+
+// Contains returns true if the point is inside the box, or on its surface.
+func (b *AABB) Contains(p *AbsXyz) bool {
+	return p.X >= b.Min.X && p.X <= b.Max.X &&
+		p.Y >= b.Min.Y && p.Y <= b.Max.Y &&
+		p.Z >= b.Min.Z && p.Z <= b.Max.Z
+}
+
+// Offset returns the box moved by d.
+func (b *AABB) Offset(d AbsXyz) AABB {
+	return AABB{
+		AbsXyz{b.Min.X + d.X, b.Min.Y + d.Y, b.Min.Z + d.Z},
+		AbsXyz{b.Max.X + d.X, b.Max.Y + d.Y, b.Max.Z + d.Z},
+	}
+}
+
+// Expand returns the box grown by the given amount on every side.
+func (b *AABB) Expand(amount AbsCoord) AABB {
+	return AABB{
+		AbsXyz{b.Min.X - amount, b.Min.Y - amount, b.Min.Z - amount},
+		AbsXyz{b.Max.X + amount, b.Max.Y + amount, b.Max.Z + amount},
+	}
+}
+
+// Stretch returns the box extended in the direction of d, so that it covers
+// everything that the box passes through when moved by d.
+func (b *AABB) Stretch(d AbsXyz) AABB {
+	s := *b
+	stretch := func(min, max *AbsCoord, d AbsCoord) {
+		if d < 0 {
+			*min += d
+		} else {
+			*max += d
+		}
+	}
+	stretch(&s.Min.X, &s.Max.X, d.X)
+	stretch(&s.Min.Y, &s.Max.Y, d.Y)
+	stretch(&s.Min.Z, &s.Max.Z, d.Z)
+	return s
+}
+
+// Sweep moves the box by d, stopping short of any of the obstacles that it
+// would enter, and returns the movement that is possible. The box moves along
+// Y, then X, then Z, so that it slides along surfaces. hit is true for each
+// axis on which the movement was cut short. Obstacles that the box already
+// intersects are ignored, so that a box can move out of them.
+func (b *AABB) Sweep(d AbsXyz, obstacles []AABB) (moved AbsXyz, hitX, hitY, hitZ bool) {
+	box := *b
+
+	moved.Y = box.clipAxis(d.Y, obstacles, axisY)
+	box = box.Offset(AbsXyz{0, moved.Y, 0})
+
+	moved.X = box.clipAxis(d.X, obstacles, axisX)
+	box = box.Offset(AbsXyz{moved.X, 0, 0})
+
+	moved.Z = box.clipAxis(d.Z, obstacles, axisZ)
+
+	return moved, moved.X != d.X, moved.Y != d.Y, moved.Z != d.Z
+}
+
+type aabbAxis byte
+
+const (
+	axisX = aabbAxis(iota)
+	axisY
+	axisZ
+)
+
+// component returns the coordinate of p on the axis.
+func (axis aabbAxis) component(p *AbsXyz) AbsCoord {
+	switch axis {
+	case axisX:
+		return p.X
+	case axisY:
+		return p.Y
+	}
+	return p.Z
+}
+
+// clipAxis returns the distance d along the axis, reduced so that the box
+// doesn't enter any of the obstacles that it overlaps on the other two axes.
+func (b *AABB) clipAxis(d AbsCoord, obstacles []AABB, axis aabbAxis) AbsCoord {
+	if d == 0 {
+		return 0
+	}
+
+	for i := range obstacles {
+		o := &obstacles[i]
+		if !b.overlapsOtherAxes(o, axis) {
+			continue
+		}
+		bMin, bMax := axis.component(&b.Min), axis.component(&b.Max)
+		oMin, oMax := axis.component(&o.Min), axis.component(&o.Max)
+		if d > 0 && bMax <= oMin {
+			if gap := oMin - bMax; gap < d {
+				d = gap
+			}
+		} else if d < 0 && bMin >= oMax {
+			if gap := oMax - bMin; gap > d {
+				d = gap
+			}
+		}
+	}
+
+	return d
+}
+
+// overlapsOtherAxes returns true if the boxes overlap on both of the axes
+// other than the given one.
+func (b *AABB) overlapsOtherAxes(o *AABB, axis aabbAxis) bool {
+	overlapX := b.Min.X < o.Max.X && b.Max.X > o.Min.X
+	overlapY := b.Min.Y < o.Max.Y && b.Max.Y > o.Min.Y
+	overlapZ := b.Min.Z < o.Max.Z && b.Max.Z > o.Min.Z
+	switch axis {
+	case axisX:
+		return overlapY && overlapZ
+	case axisY:
+		return overlapX && overlapZ
+	}
+	return overlapX && overlapY
+}
+
 // Misc. types and constants
 
 type ChunkLoadMode byte
@@ -1,7 +1,9 @@
 package types
 
 import (
+	"math"
 	"testing"
+	"testing/quick"
 )
 
 func TestChunkSizeConsts(t *testing.T) {
@@ -23,6 +25,68 @@ func TestChunkSizeConsts(t *testing.T) {
 	}
 }
 
+func TestTicks_TimeOfDay(t *testing.T) {
+	type Test struct {
+		time     Ticks
+		dayTicks Ticks
+		day      int64
+		night    bool
+	}
+
+	var tests = []Test{
+		{0, 0, 0, false},
+		{12999, 12999, 0, false},
+		{13000, 13000, 0, true},
+		{22999, 22999, 0, true},
+		{23000, 23000, 0, false},
+		{23999, 23999, 0, false},
+		{24000, 0, 1, false},
+		{24000*5 + 13000, 13000, 5, true},
+		{-1, 23999, -1, false},
+		{-24000, 0, -1, false},
+		{-11000, 13000, -1, true},
+	}
+
+	for _, r := range tests {
+		if dayTicks := r.time.DayTicks(); dayTicks != r.dayTicks {
+			t.Errorf("Ticks(%d).DayTicks() expected %d got %d", r.time, r.dayTicks, dayTicks)
+		}
+		if day := r.time.Day(); day != r.day {
+			t.Errorf("Ticks(%d).Day() expected %d got %d", r.time, r.day, day)
+		}
+		if night := r.time.IsNight(); night != r.night || r.time.IsDay() == night {
+			t.Errorf("Ticks(%d).IsNight() expected %t got %t", r.time, r.night, night)
+		}
+	}
+}
+
+func TestTicks_WithDayTicks(t *testing.T) {
+	type Test struct {
+		time     Ticks
+		dayTicks Ticks
+		expected Ticks
+	}
+
+	var tests = []Test{
+		{100, 6000, 6000},
+		{23999, 0, 0},
+		{24000, 23999, 47999},
+		{24000*3 + 20000, 1000, 24000*3 + 1000},
+		{24000*3 + 1000, 20000, 24000*3 + 20000},
+		{24000*3 + 1000, 24000 + 500, 24000*3 + 500},
+	}
+
+	for _, r := range tests {
+		result := r.time.WithDayTicks(r.dayTicks)
+		if result != r.expected {
+			t.Errorf("Ticks(%d).WithDayTicks(%d) expected %d got %d", r.time, r.dayTicks, r.expected, result)
+		}
+		if result.Day() != r.time.Day() {
+			t.Errorf("Ticks(%d).WithDayTicks(%d) changed the day to %d", r.time, r.dayTicks, result.Day())
+		}
+	}
+}
+
 func TestLookDegrees_ToLookBytes(t *testing.T) {
 	type Test struct {
 		input    LookDegrees
@@ -50,6 +114,374 @@ func TestLookDegrees_ToLookBytes(t *testing.T) {
 	}
 }
 
+func TestAbsVelocityCoord_ToVelocityComponent(t *testing.T) {
+	type Test struct {
+		input    AbsVelocityCoord
+		expected VelocityComponent
+	}
+
+	var tests = []Test{
+		{0, 0},
+		{1, 8000},
+		{-1, -8000},
+		{0.5, 4000},
+		{-0.125, -1000},
+		{1.0 / 8000, 1},
+		{3.6, VelocityComponentMax},
+		{3.7, VelocityComponentMax},
+		{-3.7, VelocityComponentMin},
+		{1e10, VelocityComponentMax},
+		{-1e10, VelocityComponentMin},
+	}
+
+	for _, r := range tests {
+		if result := r.input.ToVelocityComponent(); result != r.expected {
+			t.Errorf("AbsVelocityCoord(%v).ToVelocityComponent() expected %d got %d", r.input, r.expected, result)
+		}
+	}
+}
+
+func TestVelocity_ToAbsVelocity(t *testing.T) {
+	type Test struct {
+		input    Velocity
+		expected AbsVelocity
+	}
+
+	var tests = []Test{
+		{Velocity{0, 0, 0}, AbsVelocity{0, 0, 0}},
+		{Velocity{8000, -4000, 1000}, AbsVelocity{1, -0.5, 0.125}},
+		{Velocity{VelocityComponentMax, VelocityComponentMin, 0}, AbsVelocity{3.6, -3.6, 0}},
+	}
+
+	for _, r := range tests {
+		result := r.input.ToAbsVelocity()
+		if *result != r.expected {
+			t.Errorf("Velocity%v.ToAbsVelocity() expected AbsVelocity%v got AbsVelocity%v", r.input, r.expected, *result)
+		}
+		if back := result.ToPacketVelocity(); *back != r.input {
+			t.Errorf("Velocity%v round tripped to Velocity%v", r.input, *back)
+		}
+	}
+}
+
+func TestAbsVelocity_Accelerate(t *testing.T) {
+	params := &PhysicsParams{Gravity: 0.04, Drag: 0.02, MinSpeed: 0.005}
+
+	type Test struct {
+		input    AbsVelocity
+		dt       TickTime
+		onGround bool
+		expected AbsVelocity
+		stopped  bool
+	}
+
+	var tests = []Test{
+		// Falling from rest.
+		{AbsVelocity{0, 0, 0}, 1, false, AbsVelocity{0, -0.0392, 0}, false},
+		{AbsVelocity{0, 0, 0}, 2, false, AbsVelocity{0, -0.0784, 0}, false},
+		// At rest on the ground.
+		{AbsVelocity{0, 0, 0}, 1, true, AbsVelocity{0, 0, 0}, true},
+		{AbsVelocity{0.004, 0, -0.004}, 1, true, AbsVelocity{0, 0, 0}, true},
+		// Sliding on the ground.
+		{AbsVelocity{1, 0, -0.5}, 1, true, AbsVelocity{0.98, 0, -0.49}, false},
+		// Thrown upwards.
+		{AbsVelocity{0, 1, 0}, 1, false, AbsVelocity{0, 0.9408, 0}, false},
+	}
+
+	for _, r := range tests {
+		result := r.input
+		stopped := result.Accelerate(r.dt, params, r.onGround)
+		if stopped != r.stopped ||
+			!almostEqual(float64(result.X), float64(r.expected.X)) ||
+			!almostEqual(float64(result.Y), float64(r.expected.Y)) ||
+			!almostEqual(float64(result.Z), float64(r.expected.Z)) {
+			t.Errorf("AbsVelocity%v.Accelerate(%v, %t) expected (AbsVelocity%v, %t) got (AbsVelocity%v, %t)",
+				r.input, r.dt, r.onGround, r.expected, r.stopped, result, stopped)
+		}
+	}
+}
+
+func TestAbsVelocity_Integrate(t *testing.T) {
+	params := &PhysicsParams{Gravity: 0.05, Drag: 0.01, MinSpeed: 0.001}
+	pos := AbsXyz{0, 100, 0}
+	v := AbsVelocity{1, 0.5, 0}
+
+	// Compare against the closed form of the same recurrence.
+	var expVx, expVy, expX, expY float64 = 1, 0.5, 0, 100
+	for tick := 0; tick < 40; tick++ {
+		if v.Integrate(&pos, params) {
+			t.Fatalf("tick %d: stopped while moving", tick)
+		}
+		expVx *= 0.99
+		expVy = (expVy - 0.05) * 0.99
+		expX += expVx
+		expY += expVy
+	}
+
+	if !almostEqual(float64(pos.X), expX) || !almostEqual(float64(pos.Y), expY) || pos.Z != 0 {
+		t.Errorf("expected position (%v, %v, 0) got %v", expX, expY, pos)
+	}
+	if !almostEqual(float64(v.X), expVx) || !almostEqual(float64(v.Y), expVy) {
+		t.Errorf("expected velocity (%v, %v, 0) got %v", expVx, expVy, v)
+	}
+	// The object has passed the top of its arc and is falling.
+	if v.Y >= 0 || pos.Y >= 100 {
+		t.Errorf("expected object to be falling below its start, got position %v velocity %v", pos, v)
+	}
+}
+
+func almostEqual(v1, v2 float64) bool {
+	return math.Abs(v1-v2) < 1e-9
+}
+
+func TestAngleDegrees_Wrap(t *testing.T) {
+	type Test struct {
+		input    AngleDegrees
+		expected AngleDegrees
+	}
+
+	var tests = []Test{
+		{0, 0},
+		{90, 90},
+		{179.5, 179.5},
+		{180, -180},
+		{-180, -180},
+		{-180.5, 179.5},
+		{270, -90},
+		{360, 0},
+		{-360, 0},
+		{100000, -80},
+		{-100000, 80},
+		{AngleDegrees(math.NaN()), 0},
+		{AngleDegrees(math.Inf(1)), 0},
+	}
+
+	for _, r := range tests {
+		if result := r.input.Wrap(); result != r.expected {
+			t.Errorf("AngleDegrees(%v).Wrap() expected %v got %v", r.input, r.expected, result)
+		}
+	}
+}
+
+func TestLookDegrees_Normalize(t *testing.T) {
+	type Test struct {
+		input    LookDegrees
+		expected LookDegrees
+	}
+
+	var tests = []Test{
+		{LookDegrees{0, 0}, LookDegrees{0, 0}},
+		{LookDegrees{-45, 45}, LookDegrees{-45, 45}},
+		{LookDegrees{540, 90}, LookDegrees{-180, 90}},
+		{LookDegrees{100000, -90}, LookDegrees{-80, -90}},
+		{LookDegrees{-190, 120}, LookDegrees{170, 90}},
+		{LookDegrees{10, -95}, LookDegrees{10, -90}},
+		{LookDegrees{10, AngleDegrees(math.NaN())}, LookDegrees{10, 0}},
+	}
+
+	for _, r := range tests {
+		result := r.input
+		result.Normalize()
+		if result != r.expected {
+			t.Errorf("LookDegrees%v.Normalize() expected LookDegrees%v got LookDegrees%v",
+				r.input, r.expected, result)
+		}
+	}
+}
+
+func TestAngleBytes_ToAngleDegrees(t *testing.T) {
+	type Test struct {
+		input    AngleBytes
+		expected AngleDegrees
+	}
+
+	var tests = []Test{
+		{0, 0},
+		{64, 90},
+		{127, 178.59375},
+		{128, -180},
+		{192, -90},
+		{255, -1.40625},
+	}
+
+	for _, r := range tests {
+		if result := r.input.ToAngleDegrees(); result != r.expected {
+			t.Errorf("AngleBytes(%d).ToAngleDegrees() expected %v got %v", r.input, r.expected, result)
+		}
+	}
+}
+
+// angleBetween returns the smallest angle between a and b.
+func angleBetween(a, b AngleDegrees) float64 {
+	diff := math.Abs(float64((a - b).Wrap()))
+	return math.Min(diff, 360-diff)
+}
+
+// TestLookDegrees_RoundTrip checks that converting any look to bytes and
+// back gives a look within one byte step of the normalized look.
+func TestLookDegrees_RoundTrip(t *testing.T) {
+	const step = 360.0 / 256
+
+	roundTrip := func(yaw, pitch float32) bool {
+		look := LookDegrees{AngleDegrees(yaw), AngleDegrees(pitch)}
+		look.Normalize()
+		result := look.ToLookBytes().ToLookDegrees()
+		result.Normalize()
+
+		if result.Yaw < -180 || result.Yaw >= 180 || result.Pitch < MinPitch || result.Pitch > MaxPitch {
+			t.Errorf("LookDegrees{%v, %v} round tripped out of range to LookDegrees%v", yaw, pitch, *result)
+			return false
+		}
+		if angleBetween(look.Yaw, result.Yaw) >= step || angleBetween(look.Pitch, result.Pitch) >= step {
+			t.Errorf("LookDegrees{%v, %v} normalized to LookDegrees%v, round tripped to LookDegrees%v",
+				yaw, pitch, look, *result)
+			return false
+		}
+		return true
+	}
+
+	if err := quick.Check(roundTrip, &quick.Config{MaxCount: 10000}); err != nil {
+		t.Error(err)
+	}
+
+	// Including large angles, as when a client has spun round many times.
+	large := func(turns int16, yaw, pitch float32) bool {
+		return roundTrip(float32(turns)*360+yaw, pitch)
+	}
+	if err := quick.Check(large, &quick.Config{MaxCount: 10000}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFacingFromYaw(t *testing.T) {
+	type Test struct {
+		yaw      AngleDegrees
+		expected Face
+	}
+
+	var tests = []Test{
+		{0, FaceWest},
+		{44.9, FaceWest},
+		{45, FaceNorth},
+		{90, FaceNorth},
+		{180, FaceEast},
+		{-180, FaceEast},
+		{-135.1, FaceEast},
+		{-90, FaceSouth},
+		{270, FaceSouth},
+		{-44.9, FaceWest},
+		{100000, FaceSouth},
+	}
+
+	for _, r := range tests {
+		if result := FacingFromYaw(r.yaw); result != r.expected {
+			t.Errorf("FacingFromYaw(%v) expected %d got %d", r.yaw, r.expected, result)
+		}
+	}
+}
+
+func TestFace_Opposite(t *testing.T) {
+	type Test struct {
+		face     Face
+		expected Face
+	}
+
+	var tests = []Test{
+		{FaceBottom, FaceTop},
+		{FaceTop, FaceBottom},
+		{FaceEast, FaceWest},
+		{FaceWest, FaceEast},
+		{FaceNorth, FaceSouth},
+		{FaceSouth, FaceNorth},
+		{FaceNull, FaceNull},
+		{6, FaceNull},
+	}
+
+	for _, r := range tests {
+		if result := r.face.Opposite(); result != r.expected {
+			t.Errorf("Face(%d).Opposite() expected %d got %d", r.face, r.expected, result)
+		}
+	}
+}
+
+func TestFace_Offset(t *testing.T) {
+	for _, face := range AllFaces() {
+		offset := face.Offset()
+		opposite := face.Opposite().Offset()
+		if offset.X+opposite.X != 0 || offset.Y+opposite.Y != 0 || offset.Z+opposite.Z != 0 {
+			t.Errorf("Face(%d).Offset() = %v is not the negation of its opposite %v", face, offset, opposite)
+		}
+		if n := abs(int(offset.X)) + abs(int(offset.Y)) + abs(int(offset.Z)); n != 1 {
+			t.Errorf("Face(%d).Offset() = %v is not a unit offset", face, offset)
+		}
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func TestFaceFromWire(t *testing.T) {
+	type Test struct {
+		value      int8
+		expected   Face
+		expectedOk bool
+	}
+
+	var tests = []Test{
+		{-1, FaceNull, true},
+		{0, FaceBottom, true},
+		{5, FaceSouth, true},
+		{6, FaceNull, false},
+		{-2, FaceNull, false},
+		{127, FaceNull, false},
+	}
+
+	for _, r := range tests {
+		result, ok := FaceFromWire(r.value)
+		if result != r.expected || ok != r.expectedOk {
+			t.Errorf("FaceFromWire(%d) expected %d, %t got %d, %t", r.value, r.expected, r.expectedOk, result, ok)
+		} else if ok && result.ToWire() != r.value {
+			t.Errorf("FaceFromWire(%d).ToWire() got %d", r.value, result.ToWire())
+		}
+	}
+}
+
+func TestFaceFromVector(t *testing.T) {
+	type Test struct {
+		v        AbsXyz
+		expected Face
+	}
+
+	var tests = []Test{
+		{AbsXyz{0, 0, 0}, FaceNull},
+		{AbsXyz{0, 1, 0}, FaceTop},
+		{AbsXyz{0.5, -2, 0.5}, FaceBottom},
+		{AbsXyz{3, 1, -2}, FaceSouth},
+		{AbsXyz{-3, 1, 2}, FaceNorth},
+		{AbsXyz{0, 0, 0.1}, FaceWest},
+		{AbsXyz{0.1, 0, -0.2}, FaceEast},
+	}
+
+	for _, r := range tests {
+		if result := FaceFromVector(&r.v); result != r.expected {
+			t.Errorf("FaceFromVector(%v) expected %d got %d", r.v, r.expected, result)
+		}
+	}
+
+	// Each face's offset points back at itself.
+	for _, face := range AllFaces() {
+		offset := face.Offset()
+		v := AbsXyz{AbsCoord(offset.X), AbsCoord(offset.Y), AbsCoord(offset.Z)}
+		if result := FaceFromVector(&v); result != face {
+			t.Errorf("FaceFromVector(%v) expected %d got %d", v, face, result)
+		}
+	}
+}
+
 func TestAbsXyz_ToChunkXz(t *testing.T) {
 	type Test struct {
 		input    AbsXyz
@@ -62,6 +494,9 @@ func TestAbsXyz_ToChunkXz(t *testing.T) {
 		{AbsXyz{0, 0, -16}, ChunkXz{0, -1}},
 		{AbsXyz{-16, 0, 0}, ChunkXz{-1, 0}},
 		{AbsXyz{-1, 0, -1}, ChunkXz{-1, -1}},
+		{AbsXyz{-0.5, 0, -0.5}, ChunkXz{-1, -1}},
+		{AbsXyz{15.999, 0, -16.001}, ChunkXz{0, -2}},
+		{AbsXyz{-16.5, 0, 31.5}, ChunkXz{-2, 1}},
 	}
 
 	for _, test := range tests {
@@ -90,6 +525,8 @@ func TestAbsXyz_ToBlockXyz(t *testing.T) {
 		{AbsXyz{-0.1, -0.2, -0.3}, BlockXyz{-1, -1, -1}},
 		{AbsXyz{-1.0, -2.0, -3.0}, BlockXyz{-1, -2, -3}},
 		{AbsXyz{-1.5, -2.5, -3.5}, BlockXyz{-2, -3, -4}},
+		{AbsXyz{-0.5, 64.5, -16.0}, BlockXyz{-1, 64, -16}},
+		{AbsXyz{-16.5, 0.0, 15.999}, BlockXyz{-17, 0, 15}},
 	}
 
 	for _, r := range tests {
@@ -101,6 +538,60 @@ func TestAbsXyz_ToBlockXyz(t *testing.T) {
 	}
 }
 
+func TestAbsXyz_ToChunkLocal(t *testing.T) {
+	type Test struct {
+		pos      AbsXyz
+		expChunk ChunkXz
+		expSub   SubChunkXyz
+	}
+
+	var tests = []Test{
+		{AbsXyz{0, 0, 0}, ChunkXz{0, 0}, SubChunkXyz{0, 0, 0}},
+		{AbsXyz{0.5, 64.5, 0.5}, ChunkXz{0, 0}, SubChunkXyz{0, 64, 0}},
+		{AbsXyz{15.5, 1, 16}, ChunkXz{0, 1}, SubChunkXyz{15, 1, 0}},
+		{AbsXyz{-0.5, 1, -0.5}, ChunkXz{-1, -1}, SubChunkXyz{15, 1, 15}},
+		{AbsXyz{-1, 1, -16}, ChunkXz{-1, -1}, SubChunkXyz{15, 1, 0}},
+		{AbsXyz{-16.5, 127.9, -17}, ChunkXz{-2, -2}, SubChunkXyz{15, 127, 15}},
+		{AbsXyz{-15.5, 1, 31.9}, ChunkXz{-1, 1}, SubChunkXyz{0, 1, 15}},
+	}
+
+	for _, r := range tests {
+		chunkLoc, subLoc := r.pos.ToChunkLocal()
+		if !r.expChunk.Equals(*chunkLoc) || r.expSub != *subLoc {
+			t.Errorf("AbsXyz%v.ToChunkLocal() expected (ChunkXz%v, SubChunkXyz%v) got (ChunkXz%v, SubChunkXyz%v)",
+				r.pos, r.expChunk, r.expSub, *chunkLoc, *subLoc)
+		}
+		// The chunk and position within it convert back to the same block.
+		if blockLoc := chunkLoc.ToBlockXyz(subLoc); *blockLoc != *r.pos.ToBlockXyz() {
+			t.Errorf("AbsXyz%v: ChunkXz%v.ToBlockXyz(SubChunkXyz%v) expected BlockXyz%v got BlockXyz%v",
+				r.pos, *chunkLoc, *subLoc, *r.pos.ToBlockXyz(), *blockLoc)
+		}
+	}
+}
+
+func TestAbsXyz_ToAbsIntXyz(t *testing.T) {
+	type Test struct {
+		pos AbsXyz
+		exp AbsIntXyz
+	}
+
+	var tests = []Test{
+		{AbsXyz{0, 0, 0}, AbsIntXyz{0, 0, 0}},
+		{AbsXyz{1, 2, 3}, AbsIntXyz{32, 64, 96}},
+		{AbsXyz{0.5, 64.5, 0.99}, AbsIntXyz{16, 2064, 31}},
+		{AbsXyz{-1, -2, -3}, AbsIntXyz{-32, -64, -96}},
+		{AbsXyz{-0.5, -0.01, -0.99}, AbsIntXyz{-16, -1, -32}},
+	}
+
+	for _, r := range tests {
+		result := r.pos.ToAbsIntXyz()
+		if r.exp != *result {
+			t.Errorf("AbsXyz%v.ToAbsIntXyz() expected AbsIntXyz%v got AbsIntXyz%v",
+				r.pos, r.exp, *result)
+		}
+	}
+}
+
 func Test_AbsXyz_IsWithinDistanceOf(t *testing.T) {
 	type Test struct {
 		a, b     AbsXyz
@@ -157,6 +648,61 @@ func Test_AbsXyz_IsWithinDistanceOf(t *testing.T) {
 	}
 }
 
+func TestAbsXyz_DistanceSquared(t *testing.T) {
+	type Test struct {
+		a, b     AbsXyz
+		expected AbsCoord
+	}
+
+	var tests = []Test{
+		{AbsXyz{0, 0, 0}, AbsXyz{0, 0, 0}, 0},
+		{AbsXyz{1, 2, 3}, AbsXyz{1, 2, 3}, 0},
+		{AbsXyz{0, 0, 0}, AbsXyz{3, 4, 0}, 25},
+		{AbsXyz{-1, -1, -1}, AbsXyz{1, 1, 1}, 12},
+		{AbsXyz{-10.5, 64, -0.5}, AbsXyz{-7.5, 68, -0.5}, 25},
+	}
+
+	for _, r := range tests {
+		if result := r.a.DistanceSquared(&r.b); result != r.expected {
+			t.Errorf("AbsXyz%v.DistanceSquared(AbsXyz%v) expected %v got %v", r.a, r.b, r.expected, result)
+		}
+		if result := r.b.DistanceSquared(&r.a); result != r.expected {
+			t.Errorf("AbsXyz%v.DistanceSquared(AbsXyz%v) expected %v got %v", r.b, r.a, r.expected, result)
+		}
+	}
+}
+
+func TestAbsXyz_WithinCylinder(t *testing.T) {
+	type Test struct {
+		pos      AbsXyz
+		base     AbsXyz
+		expected bool
+	}
+
+	// Radius 1, height 2.
+	var tests = []Test{
+		{AbsXyz{0, 0, 0}, AbsXyz{0, 0, 0}, true},
+		{AbsXyz{1, 0, 0}, AbsXyz{0, 0, 0}, true},
+		{AbsXyz{0, 2, -1}, AbsXyz{0, 0, 0}, true},
+		{AbsXyz{0.7, 1, 0.7}, AbsXyz{0, 0, 0}, true},
+		{AbsXyz{0.8, 1, 0.8}, AbsXyz{0, 0, 0}, false},
+		{AbsXyz{0, -0.01, 0}, AbsXyz{0, 0, 0}, false},
+		{AbsXyz{0, 2.01, 0}, AbsXyz{0, 0, 0}, false},
+		// Height doesn't count towards the radius.
+		{AbsXyz{1, 2, 0}, AbsXyz{0, 0, 0}, true},
+		// Negative coordinates.
+		{AbsXyz{-16.5, 63, -0.5}, AbsXyz{-16, 62, -1}, true},
+		{AbsXyz{-17.5, 63, -0.5}, AbsXyz{-16, 62, -1}, false},
+		{AbsXyz{-16.5, 61.5, -0.5}, AbsXyz{-16, 62, -1}, false},
+	}
+
+	for _, r := range tests {
+		if result := r.pos.WithinCylinder(&r.base, 1, 2); result != r.expected {
+			t.Errorf("AbsXyz%v.WithinCylinder(AbsXyz%v, 1, 2) expected %t got %t", r.pos, r.base, r.expected, result)
+		}
+	}
+}
+
 func TestAbsIntXyz_ToChunkXz(t *testing.T) {
 	type Test struct {
 		input    AbsIntXyz
@@ -185,6 +731,35 @@ func TestAbsIntXyz_ToChunkXz(t *testing.T) {
 	}
 }
 
+func TestAbsIntXyz_ToBlockXyz(t *testing.T) {
+	type Test struct {
+		input    AbsIntXyz
+		expected BlockXyz
+	}
+
+	var tests = []Test{
+		{AbsIntXyz{0, 0, 0}, BlockXyz{0, 0, 0}},
+		{AbsIntXyz{31, 32, 33}, BlockXyz{0, 1, 1}},
+		{AbsIntXyz{16 * 32, 64 * 32, 15*32 + 31}, BlockXyz{16, 64, 15}},
+		{AbsIntXyz{-1, 0, -16}, BlockXyz{-1, 0, -1}},
+		{AbsIntXyz{-32, -32, -33}, BlockXyz{-1, -1, -2}},
+		{AbsIntXyz{-16 * 32, 0, -16*32 - 1}, BlockXyz{-16, 0, -17}},
+	}
+
+	for _, r := range tests {
+		result := r.input.ToBlockXyz()
+		if r.expected != *result {
+			t.Errorf("AbsIntXyz%v expected BlockXyz%v got BlockXyz%v",
+				r.input, r.expected, *result)
+		}
+		// The block agrees with converting via absolute coordinates.
+		if viaAbs := r.input.ToAbsXyz().ToBlockXyz(); *viaAbs != *result {
+			t.Errorf("AbsIntXyz%v via AbsXyz expected BlockXyz%v got BlockXyz%v",
+				r.input, *result, *viaAbs)
+		}
+	}
+}
+
 func Test_BlockCoord_ToChunkLocalCoord(t *testing.T) {
 	type Test struct {
 		expected_chunk  ChunkCoord
@@ -276,6 +851,38 @@ func TestChunkXz_ChunkCornerBlockXY(t *testing.T) {
 	}
 }
 
+func TestChunkXz_WithinRadius(t *testing.T) {
+	type Test struct {
+		loc      ChunkXz
+		centre   ChunkXz
+		radius   ChunkCoord
+		expected bool
+	}
+
+	var tests = []Test{
+		{ChunkXz{0, 0}, ChunkXz{0, 0}, 0, true},
+		{ChunkXz{1, 0}, ChunkXz{0, 0}, 0, false},
+		{ChunkXz{2, -2}, ChunkXz{0, 0}, 2, true},
+		{ChunkXz{3, 0}, ChunkXz{0, 0}, 2, false},
+		{ChunkXz{0, -3}, ChunkXz{0, 0}, 2, false},
+		// Negative coordinates, where the sides are still included.
+		{ChunkXz{-1, -1}, ChunkXz{-1, -1}, 0, true},
+		{ChunkXz{-11, 9}, ChunkXz{-1, -1}, 10, true},
+		{ChunkXz{-12, 0}, ChunkXz{-1, -1}, 10, false},
+		{ChunkXz{0, -11}, ChunkXz{-1, -1}, 10, true},
+		{ChunkXz{0, -12}, ChunkXz{-1, -1}, 10, false},
+		{ChunkXz{-20, -20}, ChunkXz{-10, -10}, 10, true},
+		{ChunkXz{-21, -20}, ChunkXz{-10, -10}, 10, false},
+	}
+
+	for _, r := range tests {
+		if result := r.loc.WithinRadius(&r.centre, r.radius); result != r.expected {
+			t.Errorf("ChunkXz%v.WithinRadius(ChunkXz%v, %d) expected %t got %t",
+				r.loc, r.centre, r.radius, r.expected, result)
+		}
+	}
+}
+
 func TestChunkXz_ChunkKey(t *testing.T) {
 	type Test struct {
 		input    ChunkXz
@@ -492,6 +1099,43 @@ func TestAddXyz_Overflow(t *testing.T) {
 	}
 }
 
+func TestBlockXyz_ToChunkLocal(t *testing.T) {
+	type Test struct {
+		input    BlockXyz
+		expChunk ChunkXz
+		expSub   SubChunkXyz
+	}
+
+	var tests = []Test{
+		{BlockXyz{0, 0, 0}, ChunkXz{0, 0}, SubChunkXyz{0, 0, 0}},
+		{BlockXyz{15, 64, 16}, ChunkXz{0, 1}, SubChunkXyz{15, 64, 0}},
+		{BlockXyz{-1, 127, -1}, ChunkXz{-1, -1}, SubChunkXyz{15, 127, 15}},
+		{BlockXyz{-16, 1, -17}, ChunkXz{-1, -2}, SubChunkXyz{0, 1, 15}},
+		{BlockXyz{-33, 1, 32}, ChunkXz{-3, 2}, SubChunkXyz{15, 1, 0}},
+	}
+
+	for _, r := range tests {
+		chunkLoc, subLoc := r.input.ToChunkLocal()
+		if !r.expChunk.Equals(*chunkLoc) || r.expSub != *subLoc {
+			t.Errorf("BlockXyz%v expected (ChunkXz%v, SubChunkXyz%v) got (ChunkXz%v, SubChunkXyz%v)",
+				r.input, r.expChunk, r.expSub, *chunkLoc, *subLoc)
+		}
+		if result := r.input.ToChunkXz(); !r.expChunk.Equals(*result) {
+			t.Errorf("BlockXyz%v.ToChunkXz() expected ChunkXz%v got ChunkXz%v",
+				r.input, r.expChunk, *result)
+		}
+		if result := chunkLoc.ToBlockXyz(subLoc); *result != r.input {
+			t.Errorf("ChunkXz%v.ToBlockXyz(SubChunkXyz%v) expected BlockXyz%v got BlockXyz%v",
+				*chunkLoc, *subLoc, r.input, *result)
+		}
+		// The block's position is inside the chunk it is in.
+		if result := r.input.ToAbsXyz().ToChunkXz(); !r.expChunk.Equals(result) {
+			t.Errorf("BlockXyz%v.ToAbsXyz().ToChunkXz() expected ChunkXz%v got ChunkXz%v",
+				r.input, r.expChunk, result)
+		}
+	}
+}
+
 func TestBlockXyz_ToAbsIntXyz(t *testing.T) {
 	type Test struct {
 		input    BlockXyz
@@ -518,3 +1162,179 @@ func TestBlockXyz_ToAbsIntXyz(t *testing.T) {
 		}
 	}
 }
+
+func TestAABB_Intersects(t *testing.T) {
+	unit := AABB{AbsXyz{0, 0, 0}, AbsXyz{1, 1, 1}}
+
+	type Test struct {
+		box      AABB
+		expected bool
+	}
+
+	var tests = []Test{
+		{unit, true},
+		{AABB{AbsXyz{0.5, 0.5, 0.5}, AbsXyz{1.5, 1.5, 1.5}}, true},
+		{AABB{AbsXyz{0.25, 0.25, 0.25}, AbsXyz{0.75, 0.75, 0.75}}, true},
+		{AABB{AbsXyz{-1, -1, -1}, AbsXyz{2, 2, 2}}, true},
+		// Touching a face, edge or corner.
+		{AABB{AbsXyz{1, 0, 0}, AbsXyz{2, 1, 1}}, false},
+		{AABB{AbsXyz{0, 1, 0}, AbsXyz{1, 2, 1}}, false},
+		{AABB{AbsXyz{0, 0, -1}, AbsXyz{1, 1, 0}}, false},
+		{AABB{AbsXyz{1, 1, 0}, AbsXyz{2, 2, 1}}, false},
+		{AABB{AbsXyz{-1, -1, -1}, AbsXyz{0, 0, 0}}, false},
+		// Apart.
+		{AABB{AbsXyz{0, 2, 0}, AbsXyz{1, 3, 1}}, false},
+		{AABB{AbsXyz{0.5, 0.5, 1.001}, AbsXyz{1.5, 1.5, 2}}, false},
+	}
+
+	for _, r := range tests {
+		if result := unit.Intersects(&r.box); result != r.expected {
+			t.Errorf("AABB%v.Intersects(AABB%v) expected %t got %t", unit, r.box, r.expected, result)
+		}
+		if result := r.box.Intersects(&unit); result != r.expected {
+			t.Errorf("AABB%v.Intersects(AABB%v) expected %t got %t", r.box, unit, r.expected, result)
+		}
+	}
+}
+
+func TestAABB_Resize(t *testing.T) {
+	box := AABB{AbsXyz{0, 0, 0}, AbsXyz{1, 2, 1}}
+
+	if result := box.Expand(0.5); result != (AABB{AbsXyz{-0.5, -0.5, -0.5}, AbsXyz{1.5, 2.5, 1.5}}) {
+		t.Errorf("Expand(0.5) got AABB%v", result)
+	}
+	if result := box.Offset(AbsXyz{-2, 1, 0.5}); result != (AABB{AbsXyz{-2, 1, 0.5}, AbsXyz{-1, 3, 1.5}}) {
+		t.Errorf("Offset got AABB%v", result)
+	}
+	if result := box.Stretch(AbsXyz{-2, 1, 0}); result != (AABB{AbsXyz{-2, 0, 0}, AbsXyz{1, 3, 1}}) {
+		t.Errorf("Stretch got AABB%v", result)
+	}
+
+	entity := NewEntityAABB(&AbsXyz{-10.5, 64, 3}, PlayerBoxSize)
+	expected := AABB{AbsXyz{-10.8, 64, 2.7}, AbsXyz{-10.2, 65.8, 3.3}}
+	if entity.Min != expected.Min || !almostEqual(float64(entity.Max.Y), float64(expected.Max.Y)) ||
+		!almostEqual(float64(entity.Max.X), float64(expected.Max.X)) {
+		t.Errorf("NewEntityAABB expected AABB%v got AABB%v", expected, entity)
+	}
+
+	block := NewBlockAABB(&BlockXyz{-1, 5, 16})
+	if block != (AABB{AbsXyz{-1, 5, 16}, AbsXyz{0, 6, 17}}) {
+		t.Errorf("NewBlockAABB got AABB%v", block)
+	}
+}
+
+func TestAABB_Sweep(t *testing.T) {
+	// Ground from y=0 to y=1 under x=[0, 2), and a wall at x=[2, 3) above it.
+	obstacles := []AABB{
+		{AbsXyz{0, 0, 0}, AbsXyz{1, 1, 1}},
+		{AbsXyz{1, 0, 0}, AbsXyz{2, 1, 1}},
+		{AbsXyz{2, 1, 0}, AbsXyz{3, 2, 1}},
+	}
+	box := AABB{AbsXyz{0.25, 1, 0.25}, AbsXyz{0.75, 1.5, 0.75}}
+
+	type Test struct {
+		desc             string
+		box              AABB
+		d                AbsXyz
+		expected         AbsXyz
+		hitX, hitY, hitZ bool
+	}
+
+	var tests = []Test{
+		{"resting on the ground", box, AbsXyz{0, -0.5, 0}, AbsXyz{0, 0, 0}, false, true, false},
+		{"falling onto the ground", box.Offset(AbsXyz{0, 0.5, 0}), AbsXyz{0, -2, 0}, AbsXyz{0, -0.5, 0}, false, true, false},
+		{"jumping", box, AbsXyz{0, 0.5, 0}, AbsXyz{0, 0.5, 0}, false, false, false},
+		{"sliding along the ground", box, AbsXyz{0.5, -0.1, 0}, AbsXyz{0.5, 0, 0}, false, true, false},
+		{"into a wall", box, AbsXyz{2, 0, 0}, AbsXyz{1.25, 0, 0}, true, false, false},
+		{"against a wall", box.Offset(AbsXyz{1.25, 0, 0}), AbsXyz{0.1, 0, 0}, AbsXyz{0, 0, 0}, true, false, false},
+		{"away from a wall", box.Offset(AbsXyz{1.25, 0, 0}), AbsXyz{-0.1, 0, 0}, AbsXyz{-0.1, 0, 0}, false, false, false},
+		{"past the edge of the wall", box, AbsXyz{0, 0, 1}, AbsXyz{0, 0, 1}, false, false, false},
+		{"off the edge of the ground", box.Offset(AbsXyz{0, 0, 0.5}), AbsXyz{0, -1, 0}, AbsXyz{0, 0, 0}, false, true, false},
+		{"beyond the ground", box.Offset(AbsXyz{0, 0, 1}), AbsXyz{0, -1, 0}, AbsXyz{0, -1, 0}, false, false, false},
+		// Falls diagonally onto the ground, then slides up to the wall.
+		{"diagonally onto the ground", box.Offset(AbsXyz{0, 1, 0}), AbsXyz{3, -2, 0}, AbsXyz{1.25, -1, 0}, true, true, false},
+		// Touching the corner of the wall exactly is not a collision.
+		{"over the corner", box.Offset(AbsXyz{1, 1, 0}), AbsXyz{1, 0, 0}, AbsXyz{1, 0, 0}, false, false, false},
+		// Boxes already inside an obstacle can move out of it.
+		{"out of an obstacle", box.Offset(AbsXyz{0, -0.5, 0}), AbsXyz{0, 1, 0}, AbsXyz{0, 1, 0}, false, false, false},
+		{"no movement", box, AbsXyz{0, 0, 0}, AbsXyz{0, 0, 0}, false, false, false},
+	}
+
+	for _, r := range tests {
+		moved, hitX, hitY, hitZ := r.box.Sweep(r.d, obstacles)
+		if !almostEqual(float64(moved.X), float64(r.expected.X)) ||
+			!almostEqual(float64(moved.Y), float64(r.expected.Y)) ||
+			!almostEqual(float64(moved.Z), float64(r.expected.Z)) ||
+			hitX != r.hitX || hitY != r.hitY || hitZ != r.hitZ {
+			t.Errorf("%s: Sweep(%v) expected (%v, %t, %t, %t) got (%v, %t, %t, %t)",
+				r.desc, r.d, r.expected, r.hitX, r.hitY, r.hitZ, moved, hitX, hitY, hitZ)
+		}
+		// The moved box never ends up overlapping an obstacle it wasn't
+		// already inside.
+		after := r.box.Offset(moved)
+		for _, o := range obstacles {
+			if !r.box.Intersects(&o) && after.Intersects(&o) {
+				t.Errorf("%s: moved into obstacle AABB%v", r.desc, o)
+			}
+		}
+	}
+}
+
+func TestWorldBorder(t *testing.T) {
+	border := WorldBorder{Center: BlockXyz{100, 64, -50}, Radius: 20}
+
+	type Test struct {
+		pos      AbsXyz
+		expected AbsXyz
+		distance AbsCoord
+	}
+
+	var tests = []Test{
+		{AbsXyz{100, 70, -50}, AbsXyz{100, 70, -50}, 20},
+		{AbsXyz{80, 70, -50}, AbsXyz{80, 70, -50}, 0},
+		{AbsXyz{121, 70, -50}, AbsXyz{121, 70, -50}, 0},
+		{AbsXyz{121.5, 70, -50}, AbsXyz{120.5, 70, -50}, -0.5},
+		{AbsXyz{79, 70, -29.5}, AbsXyz{80.5, 70, -29.5}, -1},
+		{AbsXyz{-1000, 70, 1000}, AbsXyz{80.5, 70, -29.5}, -1080},
+	}
+
+	for _, r := range tests {
+		if distance := border.DistanceToEdge(&r.pos); distance != r.distance {
+			t.Errorf("DistanceToEdge(%v) expected %v got %v", r.pos, r.distance, distance)
+		}
+		pos := r.pos
+		moved := border.Clamp(&pos)
+		if pos != r.expected || moved != (r.pos != r.expected) {
+			t.Errorf("Clamp(%v) expected %v got %v (moved %t)", r.pos, r.expected, pos, moved)
+		}
+	}
+
+	// Blocks 80 to 120 are inside, which is chunks 5 to 7 along X, and -5 to
+	// -2 along Z for blocks -70 to -30.
+	type ChunkTest struct {
+		loc      ChunkXz
+		expected bool
+	}
+
+	var chunkTests = []ChunkTest{
+		{ChunkXz{6, -4}, true},
+		{ChunkXz{5, -5}, true},
+		{ChunkXz{7, -2}, true},
+		{ChunkXz{4, -4}, false},
+		{ChunkXz{8, -4}, false},
+		{ChunkXz{6, -6}, false},
+		{ChunkXz{6, -1}, false},
+	}
+
+	for _, r := range chunkTests {
+		if result := border.ContainsChunk(r.loc); result != r.expected {
+			t.Errorf("ContainsChunk(%v) expected %t got %t", r.loc, r.expected, result)
+		}
+	}
+
+	disabled := WorldBorder{}
+	pos := AbsXyz{1e6, 70, -1e6}
+	if disabled.Clamp(&pos) || !disabled.ContainsChunk(ChunkXz{1e5, 1e5}) {
+		t.Errorf("Expected a disabled border to allow everything")
+	}
+}
@@ -3,7 +3,6 @@ package window
 import (
 	"errors"
 	"fmt"
-	"io"
 
 	"chunkymonkey/gamerules"
 	. "chunkymonkey/types"
@@ -48,6 +47,10 @@ func (w *PlayerInventory) Init(entityId EntityId, viewer IWindowViewer) {
 		&w.main,
 		&w.holding,
 	)
+	// Items shift-clicked out of the crafting grid or armor go into the main
+	// inventory first, and items move between the main inventory and the
+	// hotbar.
+	w.Window.shiftTargets = [][]int{{2, 3}, {2, 3}, {3}, {2}}
 	w.holdingIndex = 0
 }
 
@@ -61,7 +64,6 @@ func (w *PlayerInventory) Resubscribe() {
 
 // NewWindow creates a new window for the player that shares its player
 // inventory sections with `w`. Returns nil for unrecognized inventory types.
-// TODO implement more inventory types.
 func (w *PlayerInventory) NewWindow(invTypeId InvTypeId, windowId WindowId, inv IInventory) IWindow {
 	switch invTypeId {
 	case InvTypeIdWorkbench:
@@ -76,20 +78,26 @@ func (w *PlayerInventory) NewWindow(invTypeId InvTypeId, windowId WindowId, inv
 		return NewWindow(
 			windowId, invTypeId, w.viewer, "Furnace",
 			inv, &w.main, &w.holding)
+	case InvTypeIdDispenser:
+		return NewWindow(
+			windowId, invTypeId, w.viewer, "Dispenser",
+			inv, &w.main, &w.holding)
 	}
 	return nil
 }
 
-// SetHolding chooses the held item (0-8). Out of range values have no effect.
-func (w *PlayerInventory) SetHolding(holding SlotId) {
+// SetHolding chooses the held item (0-8). Out of range values have no effect,
+// and ok is false.
+func (w *PlayerInventory) SetHolding(holding SlotId) (ok bool) {
 	if holding >= 0 && holding < SlotId(playerInvHoldingNum) {
 		w.holdingIndex = holding
+		return true
 	}
+	return false
 }
 
-// HeldItem returns the slot that is the current "held" item.
-// TODO need any changes to the held item slot to create notifications to
-// players.
+// HeldItem returns the slot that is the current "held" item, and its index
+// in the hotbar (0-8).
 func (w *PlayerInventory) HeldItem() (slot gamerules.Slot, slotId SlotId) {
 	return w.holding.Slot(w.holdingIndex), w.holdingIndex
 }
@@ -101,30 +109,82 @@ func (w *PlayerInventory) TakeOneHeldItem(into *gamerules.Slot) {
 	w.holding.TakeOneItem(w.holdingIndex, into)
 }
 
-// Writes packets for other players to see the equipped items.
-func (w *PlayerInventory) SendFullEquipmentUpdate(writer io.Writer) (err error) {
-	slot, _ := w.HeldItem()
-	err = slot.SendEquipmentUpdate(writer, w.entityId, 0)
-	if err != nil {
-		return
+// Equipment returns the held item and armor, as other players see them.
+func (w *PlayerInventory) Equipment() (equipment gamerules.PlayerEquipment) {
+	equipment[0], _ = w.HeldItem()
+	// Armor slots run from head to feet, and equipment from feet to head.
+	for i := SlotId(0); i < playerInvArmorNum; i++ {
+		equipment[playerInvArmorNum-i] = w.armor.Slot(i)
 	}
+	return
+}
 
-	numArmor := w.armor.NumSlots()
-	for i := SlotId(0); i < numArmor; i++ {
-		slot := w.armor.Slot(i)
-		err = slot.SendEquipmentUpdate(writer, w.entityId, SlotId(i+1))
-		if err != nil {
-			return
+// AddStack attempts to put the item stack into the player's held and main
+// inventory slots. Partial stacks of the same item are filled before empty
+// slots, with held slots preferred. The item will be modified as a result.
+// Changed slots are sent to the player as they change.
+func (w *PlayerInventory) AddStack(item *gamerules.Slot) (changed bool) {
+	changed = w.holding.AddToStacks(item)
+	if w.main.AddToStacks(item) {
+		changed = true
+	}
+	if w.holding.AddToEmpty(item) {
+		changed = true
+	}
+	if w.main.AddToEmpty(item) {
+		changed = true
+	}
+	return
+}
+
+// inventoryForSlot returns the inventory section that contains the window
+// slot, and the slot's index within it. inv is nil if slotId is out of range.
+func (w *PlayerInventory) inventoryForSlot(slotId SlotId) (inv *gamerules.Inventory, invSlotId SlotId) {
+	for _, section := range [...]*gamerules.Inventory{&w.crafting.Inventory, &w.armor, &w.main, &w.holding} {
+		if slotId < 0 {
+			break
+		}
+		if slotId < section.NumSlots() {
+			return section, slotId
 		}
+		slotId -= section.NumSlots()
+	}
+	return nil, 0
+}
+
+// RemoveFromSlot takes up to count items from the window slot, and returns
+// them.
+func (w *PlayerInventory) RemoveFromSlot(slotId SlotId, count ItemCount) (removed gamerules.Slot) {
+	if inv, invSlotId := w.inventoryForSlot(slotId); inv != nil {
+		removed = inv.RemoveFromSlot(invSlotId, count)
 	}
 	return
 }
 
-// PutItem attempts to put the item stack into the player's inventory. The item
-// will be modified as a result.
-func (w *PlayerInventory) PutItem(item *gamerules.Slot) {
-	w.holding.PutItem(item)
-	w.main.PutItem(item)
+// Swap swaps the contents of two window slots. It returns false if either slot
+// is out of range, or the slots were alike.
+func (w *PlayerInventory) Swap(slotIdA, slotIdB SlotId) (changed bool) {
+	invA, invSlotIdA := w.inventoryForSlot(slotIdA)
+	invB, invSlotIdB := w.inventoryForSlot(slotIdB)
+	if invA == nil || invB == nil || slotIdA == slotIdB {
+		return
+	}
+
+	slot := invA.Slot(invSlotIdA)
+	if !invB.SwapSlot(invSlotIdB, &slot) {
+		return false
+	}
+	invA.SwapSlot(invSlotIdA, &slot)
+	return true
+}
+
+// TakeAllItems empties every section of the inventory, including the crafting
+// grid and armor, and returns the items that were in it.
+func (w *PlayerInventory) TakeAllItems() (items []gamerules.Slot) {
+	items = append(items, w.crafting.TakeAllItems()...)
+	items = append(items, w.armor.TakeAllItems()...)
+	items = append(items, w.main.TakeAllItems()...)
+	items = append(items, w.holding.TakeAllItems()...)
 	return
 }
 
@@ -149,11 +209,11 @@ func (w *PlayerInventory) UnmarshalNbt(tag nbt.ITag) (err error) {
 		if !ok {
 			return errors.New("non-compound found for slot in player inventory")
 		}
-		var slotIdTag *nbt.Byte
-		if slotIdTag, ok = slotTag.Lookup("Slot").(*nbt.Byte); !ok {
+		slotIdValue, ok := nbt.GetByte(slotTag, "Slot")
+		if !ok {
 			return errors.New("slot ID not a byte")
 		}
-		slotId := SlotId(slotIdTag.Value)
+		slotId := SlotId(slotIdValue)
 		// The mapping order in NBT differs from that used in the window protocol.
 		// 0-8 = holding
 		// 9-35 = main inventory
@@ -225,7 +285,5 @@ func (w *PlayerInventory) MarshalNbt(tag *nbt.Compound) (err error) {
 		}
 	}
 
-	tag.Set("Inventory", &nbt.List{nbt.TagCompound, slots})
-
-	return nil
+	return nbt.BuildInto(tag).PutList("Inventory", nbt.TagCompound, slots...).Err()
 }
@@ -14,6 +14,8 @@ import (
 type IInventory interface {
 	NumSlots() SlotId
 	Click(click *gamerules.Click) (txState TxState)
+	ShiftClick(click *gamerules.Click) (taken gamerules.Slot, txState TxState)
+	PutItem(item *gamerules.Slot) (changed bool)
 	SetSubscriber(subscriber gamerules.IInventorySubscriber)
 	WriteProtoSlots(slots []proto.WindowSlot)
 }
@@ -83,6 +85,10 @@ type Window struct {
 	views     []inventoryView
 	title     string
 	numSlots  SlotId
+
+	// shiftTargets holds, for each view, the views that items shift-clicked
+	// out of it are moved into, in order of preference.
+	shiftTargets [][]int
 }
 
 // NewWindow creates a Window as a view onto the given inventories.
@@ -109,6 +115,20 @@ func (w *Window) Init(windowId WindowId, invTypeId InvTypeId, viewer IWindowView
 	}
 	w.numSlots = startSlot
 
+	// By default, items shift-clicked out of the first inventory go into the
+	// others (typically the player's), and items shift-clicked out of the
+	// others go into the first.
+	w.shiftTargets = make([][]int, len(inventories))
+	for index := range inventories {
+		if index == 0 {
+			for other := 1; other < len(inventories); other++ {
+				w.shiftTargets[0] = append(w.shiftTargets[0], other)
+			}
+		} else {
+			w.shiftTargets[index] = []int{0}
+		}
+	}
+
 	return
 }
 
@@ -157,12 +177,16 @@ func (w *Window) WriteWindowItems(writer io.Writer) (err error) {
 
 func (w *Window) Click(click *gamerules.Click) TxState {
 	if click.SlotId >= 0 {
-		for _, inventoryView := range w.views {
+		for index, inventoryView := range w.views {
 
 			if click.SlotId >= inventoryView.startSlot && click.SlotId < inventoryView.endSlot {
 				invClick := *click
 				invClick.SlotId = click.SlotId - inventoryView.startSlot
 
+				if click.ShiftClick {
+					return w.shiftClick(index, &invClick)
+				}
+
 				result := inventoryView.inventory.Click(&invClick)
 
 				click.Cursor = invClick.Cursor
@@ -174,3 +198,29 @@ func (w *Window) Click(click *gamerules.Click) TxState {
 
 	return TxStateRejected
 }
+
+// shiftClick moves the stack in the clicked slot of the view into the
+// inventories that the view shift-clicks into. Whatever they can't take is put
+// back into the slot.
+func (w *Window) shiftClick(from int, click *gamerules.Click) TxState {
+	view := &w.views[from]
+
+	taken, result := view.inventory.ShiftClick(click)
+
+	for _, to := range w.shiftTargets[from] {
+		if taken.IsEmpty() {
+			break
+		}
+		w.views[to].inventory.PutItem(&taken)
+	}
+
+	if !taken.IsEmpty() {
+		restore := gamerules.Click{
+			SlotId: click.SlotId,
+			Cursor: taken,
+		}
+		view.inventory.Click(&restore)
+	}
+
+	return result
+}
@@ -0,0 +1,130 @@
+package worldstore
+
+import (
+	"sort"
+	"sync"
+
+	"chunkymonkey/logger"
+	"nbt"
+)
+
+// playerWriter writes player data in the background, in the order that it was
+// queued. Queueing never blocks: data queued for a user while earlier data is
+// still waiting is merged into it, so that at most one write waits per user.
+type playerWriter struct {
+	once    sync.Once
+	wake    chan bool // Sent to, without blocking, when data is queued.
+	lock    sync.Mutex
+	written *sync.Cond // Signalled as each write completes.
+
+	// The following are guarded by lock.
+	queued  map[string]*nbt.Compound // Data waiting to be written for each user.
+	order   []string                 // The users in queued, in the order queued.
+	writing string                   // The user whose data is being written.
+}
+
+// players returns the world's player writer, starting it if necessary.
+func (world *WorldStore) players() *playerWriter {
+	w := &world.playerWriter
+	w.once.Do(func() {
+		w.wake = make(chan bool, 1)
+		w.written = sync.NewCond(&w.lock)
+		w.queued = make(map[string]*nbt.Compound)
+		go world.writePlayers(w.wake)
+	})
+	return w
+}
+
+// QueuePlayerData queues the user's data to be written in the background,
+// without waiting for any previously queued data to be written. The tags of
+// data replace those already stored for the user, and other stored tags are
+// kept. PlayerData waits for the queued data to be written.
+func (world *WorldStore) QueuePlayerData(user string, data *nbt.Compound) {
+	w := world.players()
+	w.lock.Lock()
+	if waiting, ok := w.queued[user]; ok {
+		for name, tag := range data.Tags {
+			waiting.Set(name, tag)
+		}
+	} else {
+		w.queued[user] = data
+		w.order = append(w.order, user)
+	}
+	w.lock.Unlock()
+
+	select {
+	case w.wake <- true:
+	default:
+	}
+}
+
+// FlushPlayerData waits until no player data is waiting to be written.
+func (world *WorldStore) FlushPlayerData() {
+	w := world.players()
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for len(w.queued) > 0 || w.writing != "" {
+		w.written.Wait()
+	}
+}
+
+// waitPlayerData waits until none of the user's data is waiting to be
+// written.
+func (world *WorldStore) waitPlayerData(user string) {
+	w := world.players()
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for w.queued[user] != nil || w.writing == user {
+		w.written.Wait()
+	}
+}
+
+// writePlayers writes the queued player data each time that it is woken.
+func (world *WorldStore) writePlayers(wake <-chan bool) {
+	w := &world.playerWriter
+	for _ = range wake {
+		for {
+			w.lock.Lock()
+			if len(w.order) == 0 {
+				w.lock.Unlock()
+				break
+			}
+			user := w.order[0]
+			w.order = w.order[1:]
+			data := w.queued[user]
+			delete(w.queued, user)
+			w.writing = user
+			w.lock.Unlock()
+
+			if err := world.mergePlayerData(user, data); err != nil {
+				logger.World.Error("Failed when writing player data", "player", user, "err", err)
+			}
+
+			w.lock.Lock()
+			w.writing = ""
+			w.written.Broadcast()
+			w.lock.Unlock()
+		}
+	}
+}
+
+// mergePlayerData writes the tags of data over those stored for the user, so
+// that data not understood by the server is kept.
+func (world *WorldStore) mergePlayerData(user string, data *nbt.Compound) (err error) {
+	stored, err := world.readPlayerData(user)
+	if err != nil || stored == nil {
+		return world.WritePlayerData(user, data)
+	}
+
+	names := make([]string, 0, len(data.Tags))
+	for name := range data.Tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err = stored.Set(name, data.Tags[name]); err != nil {
+			return
+		}
+	}
+	return world.WritePlayerData(user, stored)
+}
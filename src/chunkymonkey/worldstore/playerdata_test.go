@@ -0,0 +1,87 @@
+package worldstore
+
+import (
+	"testing"
+
+	"nbt"
+)
+
+func TestWorldStore_QueuePlayerData(t *testing.T) {
+	world := &WorldStore{WorldPath: t.TempDir()}
+
+	stored, err := nbt.NewBuilder().
+		PutShort("Health", 5).
+		PutString("Unknown", "kept").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = world.WritePlayerData("alice", stored); err != nil {
+		t.Fatal(err)
+	}
+
+	for health := int16(10); health <= 20; health += 10 {
+		data, err := nbt.NewBuilder().PutShort("Health", health).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		world.QueuePlayerData("alice", data)
+	}
+
+	// Reading waits for the queued data to be written, in order.
+	data, err := world.PlayerData("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if health, _ := nbt.GetShort(data, "Health"); health != 20 {
+		t.Errorf("Expected the last health queued, got %d", health)
+	}
+	if unknown, _ := nbt.GetString(data, "Unknown"); unknown != "kept" {
+		t.Errorf("Expected tags that weren't queued to be kept, got %q", unknown)
+	}
+
+	// Data is written for new players, and flushed.
+	data, _ = nbt.NewBuilder().PutShort("Health", 15).Build()
+	world.QueuePlayerData("bob", data)
+	world.FlushPlayerData()
+	if data, err = world.readPlayerData("bob"); err != nil || data == nil {
+		t.Fatalf("Expected bob's data to be written, got %v, %v", data, err)
+	}
+	if health, _ := nbt.GetShort(data, "Health"); health != 15 {
+		t.Errorf("Expected health 15, got %d", health)
+	}
+}
+
+func TestWorldStore_QueuePlayerDataMerges(t *testing.T) {
+	world := &WorldStore{WorldPath: t.TempDir()}
+
+	// Data queued while earlier data waits is merged into it, so that
+	// queueing doesn't wait on the writes however many there are.
+	users := []string{"alice", "bob", "carol"}
+	for i := 0; i < 1000; i++ {
+		for _, user := range users {
+			builder := nbt.NewBuilder().PutInt("Count", int32(i))
+			if i == 0 {
+				builder.PutString("First", user)
+			}
+			data, err := builder.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			world.QueuePlayerData(user, data)
+		}
+	}
+
+	for _, user := range users {
+		data, err := world.PlayerData(user)
+		if err != nil || data == nil {
+			t.Fatalf("%s: expected data to be written, got %v, %v", user, data, err)
+		}
+		if count, _ := nbt.GetInt(data, "Count"); count != 999 {
+			t.Errorf("%s: expected the last count queued, got %d", user, count)
+		}
+		if first, _ := nbt.GetString(data, "First"); first != user {
+			t.Errorf("%s: expected tags of earlier data to be kept, got %q", user, first)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package worldstore
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+
+	"chunkymonkey/chunkstore"
+	. "chunkymonkey/types"
+	"nbt"
+)
+
+// PruneOptions choose the chunks of the overworld to keep when pruning. The
+// chunks that contain players' beds are always kept, so that they can still
+// respawn at them.
+type PruneOptions struct {
+	// Radius keeps the chunks whose centers are within this many chunks of
+	// the chunk containing the spawn, unless Bounded is set.
+	Radius int
+
+	// Bounded keeps the chunks from Min to Max inclusive, rather than those
+	// within Radius of the spawn.
+	Bounded  bool
+	Min, Max ChunkXz
+
+	// DryRun counts the chunks and bytes that would be removed, without
+	// removing anything.
+	DryRun bool
+}
+
+// PruneWorld removes the overworld chunks that options don't keep from the
+// world at worldPath. The server must not be running on the world.
+func PruneWorld(worldPath string, options PruneOptions) (stats chunkstore.PruneStats, err error) {
+	levelData, err := loadLevelData(worldPath)
+	if err != nil {
+		return
+	}
+	spawn, err := spawnPositionFromNbt(levelData)
+	if err != nil {
+		return
+	}
+	keep, err := options.keeper(worldPath, spawn, nil)
+	if err != nil {
+		return
+	}
+
+	return chunkstore.PruneChunks(worldPath, levelData, DimensionNormal, chunkstore.PruneOptions{
+		Keep:   keep,
+		DryRun: options.DryRun,
+	})
+}
+
+// PruneChunks removes the overworld chunks that options don't keep while the
+// server is running. Chunks for which loaded returns true are kept as well, as
+// they may be saved again. Saving should be paused while pruning, as chunks
+// written meanwhile may be removed.
+func (world *WorldStore) PruneChunks(options PruneOptions, loaded func(loc ChunkXz) bool) (stats chunkstore.PruneStats, err error) {
+	if world.pruner == nil {
+		return stats, chunkstore.ErrPruneNotSupported
+	}
+	keep, err := options.keeper(world.WorldPath, world.SpawnPosition, loaded)
+	if err != nil {
+		return
+	}
+
+	return world.pruner.PruneChunks(chunkstore.PruneOptions{
+		Keep:   keep,
+		DryRun: options.DryRun,
+	})
+}
+
+// keeper returns a function that is true for the chunks to keep.
+func (options *PruneOptions) keeper(worldPath string, spawn BlockXyz, loaded func(loc ChunkXz) bool) (keep func(loc ChunkXz) bool, err error) {
+	beds, err := playerBedChunks(worldPath)
+	if err != nil {
+		return
+	}
+
+	spawnChunk := spawn.ToChunkXz()
+	radiusSq := int64(options.Radius) * int64(options.Radius)
+	return func(loc ChunkXz) bool {
+		if beds[loc] || (loaded != nil && loaded(loc)) {
+			return true
+		}
+		if options.Bounded {
+			return loc.X >= options.Min.X && loc.X <= options.Max.X &&
+				loc.Z >= options.Min.Z && loc.Z <= options.Max.Z
+		}
+		dx := int64(loc.X - spawnChunk.X)
+		dz := int64(loc.Z - spawnChunk.Z)
+		return dx*dx+dz*dz <= radiusSq
+	}, nil
+}
+
+// playerBedChunks returns the chunks containing the beds that players respawn
+// at, as recorded in their player data.
+func playerBedChunks(worldPath string) (chunks map[ChunkXz]bool, err error) {
+	filenames, err := filepath.Glob(path.Join(worldPath, "players", "*.dat"))
+	if err != nil {
+		return
+	}
+
+	chunks = make(map[ChunkXz]bool)
+	for _, filename := range filenames {
+		var file *os.File
+		if file, err = os.Open(filename); err != nil {
+			return
+		}
+		playerData, readErr := nbt.ReadCompressed(file)
+		file.Close()
+		if readErr != nil {
+			return nil, readErr
+		}
+
+		x, okX := nbt.GetInt(playerData, "SpawnX")
+		z, okZ := nbt.GetInt(playerData, "SpawnZ")
+		if okX && okZ {
+			bed := BlockXyz{BlockCoord(x), 0, BlockCoord(z)}
+			chunks[*bed.ToChunkXz()] = true
+		}
+	}
+	return
+}
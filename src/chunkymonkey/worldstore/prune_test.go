@@ -0,0 +1,97 @@
+package worldstore
+
+import (
+	"testing"
+
+	"chunkymonkey/chunkstore"
+	. "chunkymonkey/types"
+	"nbt"
+)
+
+func TestPruneOptions_keeper(t *testing.T) {
+	world := &WorldStore{WorldPath: t.TempDir()}
+	bed, _ := nbt.NewBuilder().
+		PutInt("SpawnX", 200).
+		PutInt("SpawnY", 64).
+		PutInt("SpawnZ", -300).
+		Build()
+	if err := world.WritePlayerData("alice", bed); err != nil {
+		t.Fatal(err)
+	}
+	if err := world.WritePlayerData("bob", new(nbt.Compound)); err != nil {
+		t.Fatal(err)
+	}
+	loaded := func(loc ChunkXz) bool { return loc == ChunkXz{-50, -50} }
+
+	type Test struct {
+		options PruneOptions
+		loc     ChunkXz
+		keep    bool
+	}
+
+	var tests = []Test{
+		// Within 3 chunks of the spawn, at chunk 2,2.
+		{PruneOptions{Radius: 3}, ChunkXz{2, 2}, true},
+		{PruneOptions{Radius: 3}, ChunkXz{5, 2}, true},
+		{PruneOptions{Radius: 3}, ChunkXz{4, 4}, true},
+		{PruneOptions{Radius: 3}, ChunkXz{5, 4}, false},
+		{PruneOptions{Radius: 3}, ChunkXz{-2, 2}, false},
+		{PruneOptions{Bounded: true, Min: ChunkXz{-1, -1}, Max: ChunkXz{0, 0}}, ChunkXz{-1, 0}, true},
+		{PruneOptions{Bounded: true, Min: ChunkXz{-1, -1}, Max: ChunkXz{0, 0}}, ChunkXz{2, 2}, false},
+		// Alice's bed, and loaded chunks, are always kept.
+		{PruneOptions{Radius: 3}, ChunkXz{12, -19}, true},
+		{PruneOptions{Bounded: true}, ChunkXz{12, -19}, true},
+		{PruneOptions{Radius: 3}, ChunkXz{-50, -50}, true},
+	}
+
+	for _, test := range tests {
+		keep, err := test.options.keeper(world.WorldPath, BlockXyz{40, 64, 40}, loaded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result := keep(test.loc); result != test.keep {
+			t.Errorf("%+v: expected keep(%v) = %v, got %v", test.options, test.loc, test.keep, result)
+		}
+	}
+}
+
+func TestPruneWorld(t *testing.T) {
+	useServerProperties(t, "")
+	worldPath := t.TempDir()
+	if err := CreateWorld(worldPath); err != nil {
+		t.Fatal(err)
+	}
+	levelData, err := loadLevelData(worldPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := chunkstore.ChunkStoreForLevel(worldPath, levelData, DimensionNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const numBlocks = ChunkSizeH * ChunkSizeH * ChunkSizeY
+	for _, loc := range []ChunkXz{{0, 0}, {1, 1}, {40, 0}} {
+		writer := store.Writer()
+		writer.SetChunkLoc(loc)
+		writer.SetBlocks(make([]byte, numBlocks))
+		writer.SetBlockData(make([]byte, numBlocks/2))
+		writer.SetBlockLight(make([]byte, numBlocks/2))
+		writer.SetSkyLight(make([]byte, numBlocks/2))
+		writer.SetHeightMap(make([]byte, ChunkSizeH*ChunkSizeH))
+		if err = store.WriteChunk(writer); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := PruneWorld(worldPath, PruneOptions{Radius: 4, DryRun: true})
+	if err != nil || stats.Kept != 2 || stats.Removed != 1 {
+		t.Errorf("Dry run: expected 2 kept and 1 removed, got %+v, %v", stats, err)
+	}
+	stats, err = PruneWorld(worldPath, PruneOptions{Radius: 4})
+	if err != nil || stats.Kept != 2 || stats.Removed != 1 {
+		t.Errorf("Expected 2 kept and 1 removed, got %+v, %v", stats, err)
+	}
+	if stats, err = PruneWorld(worldPath, PruneOptions{Radius: 4}); err != nil || stats.Removed != 0 {
+		t.Errorf("Expected nothing left to remove, got %+v, %v", stats, err)
+	}
+}
@@ -1,32 +1,49 @@
-// Responsible for reading the overall world persistent state.
-// Eventually this should also be responsible for writing it as well.
+// Responsible for reading and writing the overall world persistent state.
 package worldstore
 
 import (
-	"compress/gzip"
-	"errors"
+	"flag"
 	"fmt"
-	"log"
 	"math/rand"
 	"os"
 	"path"
+	"strings"
 	"time"
 
 	"chunkymonkey/chunkstore"
+	"chunkymonkey/config"
 	"chunkymonkey/generation"
+	"chunkymonkey/logger"
 	. "chunkymonkey/types"
 	"nbt"
 )
 
+var persistGeneratedChunks = flag.Bool(
+	"persist_generated_chunks", false,
+	"Write newly generated chunks to the world immediately, rather than when "+
+		"they are first modified.")
+
+var generatorName = flag.String(
+	"generator", "test",
+	"The generator for new worlds, and worlds that don't name one in their "+
+		"level data, one of: "+strings.Join(generation.GeneratorNames(), ", ")+".")
+
 type WorldStore struct {
 	WorldPath string
 
 	Seed int64
 	Time Ticks
 
-	LevelData     nbt.ITag
+	LevelData     *nbt.Compound
 	ChunkStore    chunkstore.IChunkStore
 	SpawnPosition BlockXyz
+
+	chunkStats func() chunkstore.ChunkStoreStats
+	// pruner prunes the chunks stored in the overworld, or is nil if the
+	// store can't.
+	pruner chunkstore.IChunkPruner
+
+	playerWriter playerWriter
 }
 
 func LoadWorldStore(worldPath string) (world *WorldStore, err error) {
@@ -37,23 +54,15 @@ func LoadWorldStore(worldPath string) (world *WorldStore, err error) {
 
 	// In both single-player and SMP maps, the 'spawn position' is stored in
 	// the level data.
-	x, xok := levelData.Lookup("Data/SpawnX").(*nbt.Int)
-	y, yok := levelData.Lookup("Data/SpawnY").(*nbt.Int)
-	z, zok := levelData.Lookup("Data/SpawnZ").(*nbt.Int)
-	if !xok || !yok || !zok {
-		err = errors.New("Invalid map level data: does not contain Spawn{X,Y,Z}")
-		log.Printf("%#v", levelData)
+	spawnPosition, err := spawnPositionFromNbt(levelData)
+	if err != nil {
+		err = fmt.Errorf("Invalid map level data: %v", err)
 		return
 	}
-	spawnPosition := BlockXyz{
-		BlockCoord(x.Value),
-		BlockYCoord(y.Value),
-		BlockCoord(z.Value),
-	}
 
 	var timeTicks Ticks
-	if timeTag, ok := levelData.Lookup("Data/Time").(*nbt.Long); ok {
-		timeTicks = Ticks(timeTag.Value)
+	if t, ok := nbt.GetLong(levelData, "Data/Time"); ok {
+		timeTicks = Ticks(t)
 	}
 
 	var chunkStores []chunkstore.IChunkStore
@@ -66,33 +75,123 @@ func LoadWorldStore(worldPath string) (world *WorldStore, err error) {
 	chunkStores = append(chunkStores, persistantChunkService)
 
 	var seed int64
-	if seedNbt, ok := levelData.Lookup("Data/RandomSeed").(*nbt.Long); ok {
-		seed = seedNbt.Value
-	} else {
+	var ok bool
+	if seed, ok = nbt.GetLong(levelData, "Data/RandomSeed"); !ok {
 		seed = time.Now().Unix()
 	}
 
-	chunkStores = append(chunkStores, chunkstore.NewChunkService(generation.NewTestGenerator(seed)))
+	name, options, err := levelGenerator(levelData)
+	if err != nil {
+		return nil, err
+	}
+	generator, err := generation.NewGenerator(name, seed, options)
+	if err != nil {
+		return nil, fmt.Errorf("World %s: %v", worldPath, err)
+	}
+	generatorChunkService := chunkstore.NewChunkService(generator)
+	chunkStores = append(chunkStores, generatorChunkService)
+
+	fallbackPolicy := chunkstore.PersistOnModify
+	if *persistGeneratedChunks {
+		fallbackPolicy = chunkstore.PersistOnGenerate
+	}
 
 	for _, store := range chunkStores {
 		go store.Serve()
 	}
 
+	multiStore := chunkstore.NewMultiStore(chunkStores, fallbackPolicy)
+
+	chunkstore.PublishStats("persistant", persistantChunkService.Stats)
+	chunkstore.PublishStats("generator", generatorChunkService.Stats)
+	chunkstore.PublishStats("world", multiStore.Stats)
+
 	world = &WorldStore{
 		WorldPath:     worldPath,
 		Seed:          seed,
 		Time:          timeTicks,
 		LevelData:     levelData,
-		ChunkStore:    chunkstore.NewChunkService(chunkstore.NewMultiStore(chunkStores, persistantChunkService)),
+		ChunkStore:    chunkstore.NewChunkService(multiStore),
 		SpawnPosition: spawnPosition,
+		chunkStats:    multiStore.Stats,
 	}
+	world.pruner, _ = persistantChunkStore.(chunkstore.IChunkPruner)
 
 	go world.ChunkStore.Serve()
 
 	return
 }
 
-func loadLevelData(worldPath string) (levelData nbt.ITag, err error) {
+// ChunkStoreStats returns the statistics of the chunk reads made from the
+// world, whether of stored or generated chunks.
+func (world *WorldStore) ChunkStoreStats() (stats chunkstore.ChunkStoreStats) {
+	if world.chunkStats != nil {
+		stats = world.chunkStats()
+	}
+	return
+}
+
+// configuredGenerator returns the generator set by the server properties, or
+// else the -generator flag.
+func configuredGenerator() (name, options string, err error) {
+	properties, err := config.Load()
+	if err != nil {
+		return
+	}
+	if levelType := properties["level-type"]; levelType != "" {
+		return generatorNamed(levelType), properties["generator-settings"], nil
+	}
+	return *generatorName, "", nil
+}
+
+// vanillaGenerators are the generators used for the level types and generator
+// names of vanilla servers and worlds.
+var vanillaGenerators = map[string]string{
+	"default": "noise",
+	"flat":    "flatgrass",
+}
+
+// generatorNamed returns the generator with the name, given as a level type
+// or as the generator name of a world, which are case insensitive.
+func generatorNamed(name string) string {
+	name = strings.ToLower(name)
+	if generator, ok := vanillaGenerators[name]; ok {
+		return generator
+	}
+	return name
+}
+
+// levelGenerator returns the generator for a world. This is the one named in
+// its level data, unless overridden by the server properties. Worlds that
+// don't name a generator get the configured one.
+func levelGenerator(levelData *nbt.Compound) (name, options string, err error) {
+	properties, err := config.Load()
+	if err != nil {
+		return
+	}
+
+	if name, _ = nbt.GetString(levelData, "Data/generatorName"); name != "" {
+		name = generatorNamed(name)
+	}
+	options, _ = nbt.GetString(levelData, "Data/generatorOptions")
+
+	if levelType := properties["level-type"]; levelType != "" {
+		levelType = generatorNamed(levelType)
+		if name != "" && name != levelType {
+			logger.World.Warn("Generator of the world overridden by level-type, "+
+				"there may be seams where new chunks meet old ones", "generator", name, "level-type", levelType)
+		}
+		name = levelType
+		options = properties["generator-settings"]
+	}
+
+	if name == "" {
+		name, options, err = configuredGenerator()
+	}
+	return
+}
+
+func loadLevelData(worldPath string) (levelData *nbt.Compound, err error) {
 	filename := path.Join(worldPath, "level.dat")
 	file, err := os.Open(filename)
 	if err != nil {
@@ -100,17 +199,32 @@ func loadLevelData(worldPath string) (levelData nbt.ITag, err error) {
 	}
 	defer file.Close()
 
-	gzipReader, err := gzip.NewReader(file)
-	if err != nil {
+	return nbt.ReadCompressed(file)
+}
+
+// WriteLevelData updates the time in the level data and writes it back to
+// level.dat. Any other data read from level.dat is preserved.
+func (world *WorldStore) WriteLevelData(time Ticks) (err error) {
+	if err = world.LevelData.Set("Data/Time", &nbt.Long{int64(time)}); err != nil {
+		return
+	}
+	lastPlayed := &nbt.Long{nowMillis()}
+	if err = world.LevelData.Set("Data/LastPlayed", lastPlayed); err != nil {
 		return
 	}
-	defer gzipReader.Close()
 
-	levelData, err = nbt.Read(gzipReader)
+	filename := path.Join(world.WorldPath, "level.dat")
+	return nbt.WriteFileAtomic(filename, world.LevelData, nbt.CompressionGzip)
+}
 
-	return
+func nowMillis() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
 }
 
+// ChunkStoreForDimension returns a store for any supported dimension. The
+// dimension need not exist in the world yet, in which case its chunks are
+// simply not found until written.
+//
 // NOTE: ChunkStoreForDimension shouldn't really be used in the server just
 // yet.
 func (world *WorldStore) ChunkStoreForDimension(dimension DimensionId) (store chunkstore.IChunkStore, err error) {
@@ -123,7 +237,14 @@ func (world *WorldStore) ChunkStoreForDimension(dimension DimensionId) (store ch
 	return
 }
 
+// PlayerData reads the user's stored data, once any of their data queued by
+// QueuePlayerData has been written. playerData is nil if there is none.
 func (world *WorldStore) PlayerData(user string) (playerData *nbt.Compound, err error) {
+	world.waitPlayerData(user)
+	return world.readPlayerData(user)
+}
+
+func (world *WorldStore) readPlayerData(user string) (playerData *nbt.Compound, err error) {
 	file, err := os.Open(path.Join(world.WorldPath, "players", user+".dat"))
 	if err != nil {
 		//if errno, ok := util.Errno(err); ok && errno == os.ENOENT {
@@ -135,15 +256,7 @@ func (world *WorldStore) PlayerData(user string) (playerData *nbt.Compound, err
 	}
 	defer file.Close()
 
-	gzipReader, err := gzip.NewReader(file)
-	if err != nil {
-		return
-	}
-	defer gzipReader.Close()
-
-	playerData, err = nbt.Read(gzipReader)
-
-	return
+	return nbt.ReadCompressed(file)
 }
 
 func (world *WorldStore) WritePlayerData(user string, data *nbt.Compound) (err error) {
@@ -153,45 +266,43 @@ func (world *WorldStore) WritePlayerData(user string, data *nbt.Compound) (err e
 	}
 
 	filename := path.Join(world.WorldPath, "players", user+".dat")
-	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE, 0666)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	gzipWriter := gzip.NewWriter(file)
-
-	err = nbt.Write(gzipWriter, data)
-	gzipWriter.Close()
-
-	return
+	return nbt.WriteFileAtomic(filename, data, nbt.CompressionGzip)
 }
 
-// Creates a new world at 'worldPath'
+// Creates a new world at 'worldPath', using the configured generator.
 func CreateWorld(worldPath string) (err error) {
 	source := rand.NewSource(time.Now().Unix())
 	seed := source.Int63()
 
-	data := &nbt.Compound{
-		map[string]nbt.ITag{
-			"Data": &nbt.Compound{
-				map[string]nbt.ITag{
-					"Time":        &nbt.Long{0},
-					"rainTime":    &nbt.Int{0},
-					"thunderTime": &nbt.Int{0},
-					"version":     &nbt.Int{19132}, // TODO: What should this be?
-					"thundering":  &nbt.Byte{0},
-					"raining":     &nbt.Byte{0},
-					"LevelName":   &nbt.String{"world"}, // TODO: Should be specifyable
-					"SpawnX":      &nbt.Int{0},          // TODO: Figure this out from chunk generator?
-					"SpawnY":      &nbt.Int{75},         // TODO: Figure this out from chunk generator?
-					"SpawnZ":      &nbt.Int{0},          // TODO: Figure this out from chunk generator?
-					"LastPlayed":  &nbt.Long{0},
-					"SizeOnDisk":  &nbt.Long{0}, // Needs to be accurate?
-					"RandomSeed":  &nbt.Long{seed},
-				},
-			},
-		},
+	name, options, err := configuredGenerator()
+	if err != nil {
+		return
+	}
+	// Check the generator exists before creating a world that needs it.
+	if _, err = generation.NewGenerator(name, seed, options); err != nil {
+		return
+	}
+
+	data, err := nbt.NewBuilder().
+		PutCompound("Data", nbt.NewBuilder().
+			PutLong("Time", 0).
+			PutInt("rainTime", 0).
+			PutInt("thunderTime", 0).
+			PutInt("version", 19132). // TODO: What should this be?
+			PutByte("thundering", 0).
+			PutByte("raining", 0).
+			PutString("LevelName", "world"). // TODO: Should be specifyable
+			PutInt("SpawnX", 0).             // TODO: Figure this out from chunk generator?
+			PutInt("SpawnY", 75).            // TODO: Figure this out from chunk generator?
+			PutInt("SpawnZ", 0).             // TODO: Figure this out from chunk generator?
+			PutLong("LastPlayed", 0).
+			PutLong("SizeOnDisk", 0). // Needs to be accurate?
+			PutLong("RandomSeed", seed).
+			PutString("generatorName", name).
+			PutString("generatorOptions", options)).
+		Build()
+	if err != nil {
+		return
 	}
 
 	if err = os.MkdirAll(worldPath, 0777); err != nil {
@@ -203,34 +314,44 @@ func CreateWorld(worldPath string) (err error) {
 	if err != nil {
 		return err
 	}
+	defer file.Close()
+
+	return nbt.WriteCompressed(file, data, nbt.CompressionGzip)
+}
 
-	gzipWriter := gzip.NewWriter(file)
+func spawnPositionFromNbt(levelData nbt.ITag) (pos BlockXyz, err error) {
+	data, err := nbt.MustCompound(levelData, "Data")
+	if err != nil {
+		return
+	}
 
-	err = nbt.Write(gzipWriter, data)
-	gzipWriter.Close()
-	file.Close()
+	var coords [3]int32
+	for i, name := range []string{"SpawnX", "SpawnY", "SpawnZ"} {
+		var ok bool
+		if coords[i], ok = nbt.GetInt(data, name); !ok {
+			err = BadType("Data/" + name)
+			return
+		}
+	}
 
-	return nil
+	return BlockXyz{
+		BlockCoord(coords[0]),
+		BlockYCoord(coords[1]),
+		BlockCoord(coords[2]),
+	}, nil
 }
 
 func absXyzFromNbt(tag nbt.ITag, path string) (pos AbsXyz, err error) {
-	posList, posOk := tag.Lookup(path).(*nbt.List)
-	if !posOk {
-		err = BadType(path)
-		return
-	}
-	x, xOk := posList.Value[0].(*nbt.Double)
-	y, yOk := posList.Value[1].(*nbt.Double)
-	z, zOk := posList.Value[2].(*nbt.Double)
-	if !xOk || !yOk || !zOk {
+	posList, posOk := nbt.GetList(tag, path, nbt.TagDouble)
+	if !posOk || len(posList.Value) != 3 {
 		err = BadType(path)
 		return
 	}
 
 	pos = AbsXyz{
-		AbsCoord(x.Value),
-		AbsCoord(y.Value),
-		AbsCoord(z.Value),
+		AbsCoord(posList.Value[0].(*nbt.Double).Value),
+		AbsCoord(posList.Value[1].(*nbt.Double).Value),
+		AbsCoord(posList.Value[2].(*nbt.Double).Value),
 	}
 	return
 }
@@ -238,5 +359,5 @@ func absXyzFromNbt(tag nbt.ITag, path string) (pos AbsXyz, err error) {
 type BadType string
 
 func (err BadType) Error() string {
-	return fmt.Sprintf("Bad type in level.dat for %s", string(err))
+	return fmt.Sprintf("Bad or missing value in level.dat for %s", string(err))
 }
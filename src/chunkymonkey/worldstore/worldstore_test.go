@@ -0,0 +1,115 @@
+package worldstore
+
+import (
+	"flag"
+	"io/ioutil"
+	"path"
+	"testing"
+
+	"nbt"
+)
+
+// useServerProperties points the server properties at a temporary file with
+// the given content, for the rest of the test.
+func useServerProperties(t *testing.T, content string) {
+	filename := path.Join(t.TempDir(), "server.properties")
+	if err := ioutil.WriteFile(filename, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+	old := flag.Lookup("server_properties").Value.String()
+	flag.Set("server_properties", filename)
+	t.Cleanup(func() { flag.Set("server_properties", old) })
+}
+
+func TestCreateWorld_PersistsGenerator(t *testing.T) {
+	useServerProperties(t, "# comment\nlevel-type=FLATGRASS\n")
+	worldPath := t.TempDir()
+
+	if err := CreateWorld(worldPath); err != nil {
+		t.Fatal(err)
+	}
+	levelData, err := loadLevelData(worldPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, _ := nbt.GetString(levelData, "Data/generatorName"); name != "flatgrass" {
+		t.Errorf("generatorName = %q, want flatgrass", name)
+	}
+}
+
+func TestLevelGenerator(t *testing.T) {
+	levelData := func(name string) *nbt.Compound {
+		data := nbt.NewBuilder()
+		if name != "" {
+			data.PutString("generatorName", name)
+		}
+		compound, _ := nbt.NewBuilder().PutCompound("Data", data).Build()
+		return compound
+	}
+
+	tests := []struct {
+		properties string
+		level      string
+		want       string
+	}{
+		{"", "noise", "noise"},
+		{"", "", *generatorName},
+		{"level-type=flatgrass", "", "flatgrass"},
+		{"level-type=flatgrass", "noise", "flatgrass"},
+		{"motd=hello", "noise", "noise"},
+		// The level types and generator names of vanilla servers.
+		{"level-type=DEFAULT", "", "noise"},
+		{"level-type=FLAT", "", "flatgrass"},
+		{"level-type=FLAT", "default", "flatgrass"},
+		{"", "default", "noise"},
+		{"", "flat", "flatgrass"},
+	}
+
+	for _, test := range tests {
+		useServerProperties(t, test.properties)
+		name, _, err := levelGenerator(levelData(test.level))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != test.want {
+			t.Errorf("properties %q, level %q: generator %q, want %q", test.properties, test.level, name, test.want)
+		}
+	}
+}
+
+func TestCreateWorld_VanillaLevelType(t *testing.T) {
+	for _, levelType := range []string{"DEFAULT", "FLAT"} {
+		useServerProperties(t, "level-type="+levelType+"\n")
+		worldPath := t.TempDir()
+		if err := CreateWorld(worldPath); err != nil {
+			t.Errorf("level-type %s: %v", levelType, err)
+			continue
+		}
+		if _, err := LoadWorldStore(worldPath); err != nil {
+			t.Errorf("level-type %s: %v", levelType, err)
+		}
+	}
+}
+
+func TestLoadWorldStore_UnknownGenerator(t *testing.T) {
+	useServerProperties(t, "level-type=nonesuch\n")
+	worldPath := t.TempDir()
+	if err := CreateWorld(worldPath); err == nil {
+		t.Fatal("created a world with an unknown generator")
+	}
+
+	useServerProperties(t, "")
+	if err := CreateWorld(worldPath); err != nil {
+		t.Fatal(err)
+	}
+	levelData, _ := loadLevelData(worldPath)
+	levelData.Set("Data/generatorName", &nbt.String{"nonesuch"})
+	world := &WorldStore{WorldPath: worldPath, LevelData: levelData}
+	if err := world.WriteLevelData(0); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadWorldStore(worldPath); err == nil {
+		t.Error("loaded a world with an unknown generator")
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"chunkymonkey/chunkdump"
+	. "chunkymonkey/types"
+)
+
+var dimension = flag.Int(
+	"dimension", int(DimensionNormal),
+	"The dimension to read the chunk from (0 for the overworld, -1 for the Nether, 1 for the End).")
+
+var sliceY = flag.Int(
+	"y", -1,
+	"Draw a cross section looking down on the layer at this Y.")
+
+var sliceZ = flag.Int(
+	"z", 0,
+	"Draw a cross section along the slice at this Z within the chunk, if -y isn't given.")
+
+func usage() {
+	os.Stderr.WriteString("usage: " + os.Args[0] + " [flags] <world path> <chunk x> <chunk z>\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() != 3 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	worldPath := flag.Arg(0)
+	x, err := strconv.Atoi(flag.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Bad chunk x %q: %v\n", flag.Arg(1), err)
+		os.Exit(1)
+	}
+	z, err := strconv.Atoi(flag.Arg(2))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Bad chunk z %q: %v\n", flag.Arg(2), err)
+		os.Exit(1)
+	}
+	loc := ChunkXz{ChunkCoord(x), ChunkCoord(z)}
+
+	var slice byte = chunkdump.SliceZ
+	at := *sliceZ
+	if *sliceY >= 0 {
+		slice, at = chunkdump.SliceY, *sliceY
+	}
+
+	reader, err := chunkdump.LoadChunk(worldPath, loc, DimensionId(*dimension))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, chunkdump.DescribeError(loc, err))
+		os.Exit(1)
+	}
+
+	if err = chunkdump.WriteSummary(os.Stdout, reader, slice, at); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -8,20 +8,39 @@ import (
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 
 	"chunkymonkey"
+	"chunkymonkey/config"
+	"chunkymonkey/console"
 	"chunkymonkey/gamerules"
+	"chunkymonkey/logger"
 	"chunkymonkey/worldstore"
 )
 
 var addr = flag.String(
 	"addr", ":25565",
-	"Serves on the given address:port.")
+	"Serves on the given comma separated list of address:port. IPv6 "+
+		"addresses are written in brackets, such as [::1]:25565. The port "+
+		"defaults to 25565.")
 
 var httpAddr = flag.String(
 	"http_addr", ":25566",
 	"Serves HTTP diagnostics on the given address:port.")
 
+var statusAddr = flag.String(
+	"status_addr", "",
+	"If set, serves the server's status as JSON over HTTP on the given "+
+		"address:port, at /status. Unlike -http_addr, this is meant to be "+
+		"exposed to web dashboards and monitoring.")
+
+var statusToken = flag.String(
+	"status_token", "",
+	"If set, requests for the status from -status_addr must give this token "+
+		"in an \"Authorization: Bearer <token>\" header.")
+
 var blockDefs = flag.String(
 	"blocks", "blocks.json",
 	"The JSON file containing block type definitions.")
@@ -54,14 +73,50 @@ var groupDefs = flag.String(
 	"groups", "groups.json",
 	"The JSON file containing group permissions.")
 
+var opsFile = flag.String(
+	"ops", "ops.json",
+	"The JSON file listing the operators, who have every permission. It is "+
+		"created by the /op command if missing.")
+
+var whitelistFile = flag.String(
+	"whitelist_file", "whitelist.json",
+	"The JSON file listing the players allowed to log in when -whitelist "+
+		"is set.")
+
+var bannedPlayersFile = flag.String(
+	"banned_players", "banned-players.json",
+	"The JSON file listing the banned players.")
+
+var bannedIpsFile = flag.String(
+	"banned_ips", "banned-ips.json",
+	"The JSON file listing the banned IP addresses.")
+
 // TODO Implement max player count enforcement. Probably would have to be
 // implemented atomically at the game level.
 var maxPlayerCount = flag.Int(
 	"max_player_count", 16,
 	"Maximum number of players to allow concurrently. (Does not work yet)")
 
+var adminSocket = flag.String(
+	"admin_socket", "",
+	"If set, administrators can run commands by connecting to a unix domain "+
+		"socket at this path, such as with \"socat - UNIX-CONNECT:<path>\". "+
+		"Access is controlled by the socket's file permissions.")
+
+var adminSocketMode = flag.String(
+	"admin_socket_mode", "0600",
+	"The file permissions of the -admin_socket, in octal.")
+
+var logLevels = flag.String(
+	"log_levels", "",
+	"Log levels as a comma separated list of subsystem=level, or of a level "+
+		"for all subsystems, such as \"warn,chunk=debug\". The subsystems are "+
+		"net, chunk, entity, world and cmd. Levels can be changed while running "+
+		"with the /loglevel command.")
+
 func usage() {
-	os.Stderr.WriteString("usage: " + os.Args[0] + " [flags] <world>\n")
+	os.Stderr.WriteString("usage: " + os.Args[0] + " [flags] [<world>]\n" +
+		"The world defaults to the level-name of the server properties.\n")
 	flag.PrintDefaults()
 }
 
@@ -74,24 +129,85 @@ func startHttpServer(addr string) (err error) {
 	return
 }
 
+// shutdownOnSignal shuts the game down, saving the world, when the server is
+// interrupted or terminated. The returned channel receives the exit status
+// once the shutdown has finished.
+func shutdownOnSignal(game *chunkymonkey.Game) <-chan int {
+	status := make(chan int, 1)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		// A second signal exits at once.
+		signal.Stop(signals)
+		log.Printf("Received %v, shutting down", sig)
+		if err := game.Shutdown(); err != nil {
+			log.Printf("Error saving the world: %v", err)
+			status <- 1
+			return
+		}
+		status <- 0
+	}()
+	return status
+}
+
+// startStatusServer serves the game's status. It has its own ServeMux so that
+// the diagnostics served by startHttpServer aren't exposed with it.
+func startStatusServer(addr string, game *chunkymonkey.Game, token string) (err error) {
+	statusPort, err := net.Listen("tcp", addr)
+	if err != nil {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/status", game.StatusHandler(token))
+	go http.Serve(statusPort, mux)
+	return
+}
+
 func main() {
 	var err error
 
 	flag.Usage = usage
 	flag.Parse()
 
-	if flag.NArg() != 1 {
+	properties, err := config.Load()
+	if err != nil {
+		log.Print("Error reading server properties: ", err)
+		os.Exit(1)
+	}
+	if err = properties.ApplyFlags(flag.CommandLine); err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
+
+	worldPath := properties["level-name"]
+	if flag.NArg() == 1 {
+		worldPath = flag.Arg(0)
+	}
+	if flag.NArg() > 1 || worldPath == "" {
 		flag.Usage()
 		os.Exit(1)
 	}
 
+	if err = logger.SetLevels(*logLevels); err != nil {
+		log.Print("Bad -log_levels: ", err)
+		os.Exit(1)
+	}
+
 	err = gamerules.LoadGameRules(*blockDefs, *itemDefs, *recipeDefs, *furnaceDefs, *userDefs, *groupDefs)
 	if err != nil {
 		log.Print("Error loading game rules: ", err)
 		os.Exit(1)
 	}
+	if err = gamerules.LoadOps(*opsFile); err != nil {
+		log.Print("Error loading operators: ", err)
+		os.Exit(1)
+	}
+	if err = gamerules.LoadAccessLists(*whitelistFile, *bannedPlayersFile, *bannedIpsFile); err != nil {
+		log.Print("Error loading whitelist and bans: ", err)
+		os.Exit(1)
+	}
 
-	worldPath := flag.Arg(0)
 	fi, err := os.Stat(worldPath)
 	if err != nil {
 		log.Printf("Could not load world from directory %v: %v", worldPath, err)
@@ -109,20 +225,49 @@ func main() {
 		os.Exit(1)
 	}
 
-	listener, err := net.Listen("tcp", *addr)
+	addrs, err := chunkymonkey.ParseListenAddrs(*addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	listeners, err := chunkymonkey.ListenAll(addrs)
 	if err != nil {
 		log.Fatal(err)
 	}
+	for _, listener := range listeners {
+		log.Printf("Listening on %v", listener.Addr())
+	}
 
-	game, err := chunkymonkey.NewGame(worldPath, listener, *serverDesc, *maintenanceMsg, *maxPlayerCount)
+	game, err := chunkymonkey.NewGame(worldPath, listeners, *serverDesc, *maintenanceMsg, *maxPlayerCount)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	if *adminSocket != "" {
+		mode, err := strconv.ParseUint(*adminSocketMode, 8, 32)
+		if err != nil {
+			log.Fatalf("Bad -admin_socket_mode %q: %v", *adminSocketMode, err)
+		}
+		adminListener, err := console.ListenUnix(*adminSocket, os.FileMode(mode))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer adminListener.Close()
+		go console.New(gamerules.CommandFramework, game).ServeListener(adminListener)
+	}
+
 	err = startHttpServer(*httpAddr)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	if *statusAddr != "" {
+		if err = startStatusServer(*statusAddr, game, *statusToken); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	status := shutdownOnSignal(game)
 	game.Serve()
+	os.Exit(<-status)
 }
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"chunkymonkey/chunkstore"
+)
+
+var deleteOriginals = flag.Bool(
+	"delete", false,
+	"Delete the original chunk files once the world has been converted.")
+
+func usage() {
+	os.Stderr.WriteString("usage: " + os.Args[0] + " [flags] <world path>\n")
+	os.Stderr.WriteString("Converts an Alpha world to the McRegion format. If interrupted, run again to\nresume.\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	options := chunkstore.ConvertOptions{
+		DeleteOriginals: *deleteOriginals,
+		Progress: func(progress chunkstore.ConvertProgress) {
+			done := progress.Converted + progress.Skipped + progress.Failed
+			if done%100 == 0 || done == progress.Total {
+				fmt.Fprintf(os.Stderr, "\r%d/%d chunks (%d converted, %d already done, %d failed)",
+					done, progress.Total, progress.Converted, progress.Skipped, progress.Failed)
+			}
+		},
+	}
+
+	progress, err := chunkstore.ConvertAlphaToRegion(flag.Arg(0), options)
+	if progress.Total > 0 {
+		fmt.Fprintln(os.Stderr)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"compress/gzip"
 	"fmt"
 	"os"
 	"strconv"
@@ -45,6 +44,8 @@ func displayNbt(indentCount int, tag nbt.ITag) {
 		fmt.Printf("Double: %f\n", t.Value)
 	case *nbt.ByteArray:
 		fmt.Printf("ByteArray: %d bytes long\n", len(t.Value))
+	case *nbt.IntArray:
+		fmt.Printf("IntArray: %d ints long\n", len(t.Value))
 	case *nbt.String:
 		fmt.Printf("String: %#v\n", t.Value)
 	default:
@@ -131,13 +132,7 @@ func cmdNbt(args []string) (err error) {
 	}
 	defer file.Close()
 
-	gzipReader, err := gzip.NewReader(file)
-	if err != nil {
-		return
-	}
-	defer gzipReader.Close()
-
-	namedTag, err := nbt.Read(gzipReader)
+	namedTag, err := nbt.ReadCompressed(file)
 	if err != nil {
 		return
 	}
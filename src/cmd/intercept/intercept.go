@@ -12,7 +12,16 @@ import (
 )
 
 var recordBase = flag.String(
-	"record", "", "Record player connections to files with this prefix")
+	"record", "",
+	"Record player connections to files with this prefix. Data from the "+
+		"client is recorded to <prefix>-<conn>-cs.record, and data from the "+
+		"server to <prefix>-<conn>-sc.record.")
+
+var logFile = flag.String(
+	"log", "", "Write the packet log to this file rather than stderr.")
+
+// logOutput is where the packet log is written.
+var logOutput io.Writer = os.Stderr
 
 type RelayReport struct {
 	written int64
@@ -20,28 +29,42 @@ type RelayReport struct {
 }
 
 // Sends a report on reportChan when it completes
-func spliceParser(parser func(reader io.Reader), dst io.Writer, src io.Reader) (reportChan chan RelayReport) {
+func spliceParser(parser func(reader *chunkReader), dst io.Writer, src io.Reader) (reportChan chan RelayReport) {
 
-	parserReader, parserWriter := io.Pipe()
-	wrappedDst := io.MultiWriter(dst, parserWriter)
+	parserReader := newChunkReader()
+	wrappedDst := io.MultiWriter(dst, parserReader)
 	reportChan = make(chan RelayReport)
 
 	go parser(parserReader)
 	go func() {
 		written, err := io.Copy(wrappedDst, src)
+		parserReader.Close()
 		reportChan <- RelayReport{written, err}
 	}()
 
 	return
 }
 
+// recordReader returns a reader that records the data read from reader to the
+// file, for later replay. If the file can't be created, reader is returned
+// as-is.
+func recordReader(logger *log.Logger, reader io.Reader, filename string) (recorded io.Reader, closer io.Closer) {
+	output, err := os.Create(filename)
+	if err != nil {
+		logger.Printf("Failed to open file %q to record connection: %v", filename, err)
+		return reader, nil
+	}
+	recorder := record.NewReaderRecorder(output, reader)
+	return recorder, recorder
+}
+
 func serveConn(clientConn net.Conn, remoteaddr string, connNumber int) {
 	defer clientConn.Close()
 
 	clientAddr := clientConn.RemoteAddr().String()
 
 	logPrefix := fmt.Sprintf("[%d]", connNumber)
-	logger := log.New(os.Stderr, logPrefix+" ", log.Ldate|log.Ltime|log.Lmicroseconds)
+	logger := log.New(logOutput, logPrefix+" ", log.Ldate|log.Ltime|log.Lmicroseconds)
 
 	logger.Printf("Client connected from %v", clientAddr)
 
@@ -54,19 +77,18 @@ func serveConn(clientConn net.Conn, remoteaddr string, connNumber int) {
 	defer serverConn.Close()
 	logger.Print("Connected to server")
 
-	// clientReader reads data sent from the client.
-	clientReader := io.Reader(clientConn)
+	// clientReader reads data sent from the client, and serverReader data
+	// sent from the server.
+	clientReader, serverReader := io.Reader(clientConn), io.Reader(serverConn)
 	if *recordBase != "" {
-		recordFilename := fmt.Sprintf("%s-%d.record", *recordBase, connNumber)
-		recordOutput, err := os.Create(recordFilename)
-		if err != nil {
-			logger.Printf(
-				"Failed to open file %q to record connection: %v",
-				recordFilename, err)
-		} else {
-			recorder := record.NewReaderRecorder(recordOutput, clientConn)
-			defer recorder.Close()
-			clientReader = recorder
+		var closer io.Closer
+		clientReader, closer = recordReader(logger, clientReader, fmt.Sprintf("%s-%d-cs.record", *recordBase, connNumber))
+		if closer != nil {
+			defer closer.Close()
+		}
+		serverReader, closer = recordReader(logger, serverReader, fmt.Sprintf("%s-%d-sc.record", *recordBase, connNumber))
+		if closer != nil {
+			defer closer.Close()
 		}
 	}
 
@@ -74,15 +96,15 @@ func serveConn(clientConn net.Conn, remoteaddr string, connNumber int) {
 	serverParser := new(MessageParser)
 
 	// Set up for parsing messages from server to client
-	scLogger := log.New(os.Stderr, logPrefix+"(S->C) ", log.Ldate|log.Ltime|log.Lmicroseconds)
+	scLogger := log.New(logOutput, logPrefix+"(S->C) ", log.Ldate|log.Ltime|log.Lmicroseconds)
 	serverToClientReportChan := spliceParser(
-		func(reader io.Reader) { serverParser.ScParse(reader, scLogger) },
-		clientConn, serverConn)
+		func(reader *chunkReader) { serverParser.ScParse(reader, scLogger) },
+		clientConn, serverReader)
 
 	// Set up for parsing messages from client to server
-	csLogger := log.New(os.Stderr, logPrefix+"(C->S) ", log.Ldate|log.Ltime|log.Lmicroseconds)
+	csLogger := log.New(logOutput, logPrefix+"(C->S) ", log.Ldate|log.Ltime|log.Lmicroseconds)
 	clientToServerReportChan := spliceParser(
-		func(reader io.Reader) { clientParser.CsParse(reader, csLogger) },
+		func(reader *chunkReader) { clientParser.CsParse(reader, csLogger) },
 		serverConn, clientReader)
 
 	// Wait for the both relay/splices to stop, then we let the connections
@@ -137,6 +159,16 @@ func main() {
 	localaddr := flag.Arg(0)
 	remoteaddr := flag.Arg(1)
 
+	if *logFile != "" {
+		file, err := os.Create(*logFile)
+		if err != nil {
+			log.Fatalf("Failed to open log file %q: %v", *logFile, err)
+		}
+		defer file.Close()
+		logOutput = file
+		log.SetOutput(file)
+	}
+
 	// It's nice to have high time precision when looking at packets
 	log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds)
 
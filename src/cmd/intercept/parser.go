@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/hex"
+	"fmt"
 	"io"
 	"log"
 
@@ -9,32 +10,6 @@ import (
 	. "chunkymonkey/types"
 )
 
-// Hex dumps the input to the log
-func (p *MessageParser) dumpInput(logPrefix string, reader io.Reader) {
-	buf := make([]byte, 16, 16)
-	for {
-		_, err := io.ReadAtLeast(reader, buf, 1)
-		if err != nil {
-			return
-		}
-
-		hexData := hex.EncodeToString(buf)
-		p.printf("Unparsed data: %s", hexData)
-	}
-}
-
-// Consumes data from reader until an error occurs
-func (p *MessageParser) consumeUnrecognizedInput(reader io.Reader) {
-	p.printf("Lost packet sync. Ignoring further data.")
-	buf := make([]byte, 4096)
-	for {
-		_, err := io.ReadAtLeast(reader, buf, 1)
-		if err != nil {
-			return
-		}
-	}
-}
-
 type MessageParser struct {
 	logger *log.Logger
 }
@@ -325,60 +300,101 @@ func (p *MessageParser) PacketServerListPing() {
 	p.printf("PacketServerListPing()")
 }
 
+func (p *MessageParser) PacketEncryptionKeyResponse(sharedSecret, verifyToken []byte) {
+	p.printf("PacketEncryptionKeyResponse(sharedSecret=%x, verifyToken=%x)",
+		sharedSecret, verifyToken)
+}
+
+func (p *MessageParser) PacketEncryptionKeyRequest(serverId string, publicKey, verifyToken []byte) {
+	p.printf("PacketEncryptionKeyRequest(serverId=%q, publicKey=%x, verifyToken=%x)",
+		serverId, publicKey, verifyToken)
+}
+
 func (p *MessageParser) PacketDisconnect(reason string) {
 	p.printf("PacketDisconnect(%q)", reason)
 }
 
 // Parses messages from the client
-func (p *MessageParser) CsParse(reader io.Reader, logger *log.Logger) {
+func (p *MessageParser) CsParse(reader *chunkReader, logger *log.Logger) {
 	p.logger = logger
+	p.parse(reader, func(reader io.Reader) error {
+		return proto.ServerReadPacket(reader, p)
+	})
+}
 
-	// If we return, we should consume all input to avoid blocking the pipe
-	// we're listening on. TODO Maybe we could just close it?
-	defer p.consumeUnrecognizedInput(reader)
-
-	defer func() {
-		if err := recover(); err != nil {
-			p.printf("Parsing failed: %v", err)
-		}
-	}()
+// Parses messages from the server
+func (p *MessageParser) ScParse(reader *chunkReader, logger *log.Logger) {
+	p.logger = logger
+	p.parse(reader, func(reader io.Reader) error {
+		return proto.ClientReadPacket(reader, p)
+	})
+}
 
+// parse reads packets with readPacket until the input ends. Data that can't be
+// parsed, such as packets with unknown IDs, is logged as a hex dump and
+// skipped up to the end of the chunk it arrived in. Parsing carries on from
+// the next chunk, which often starts with a new packet.
+func (p *MessageParser) parse(reader *chunkReader, readPacket func(io.Reader) error) {
 	for {
-		err := proto.ServerReadPacket(reader, p)
-		if err != nil {
-			if err != io.EOF {
-				p.printf("ReceiveLoop failed: %v", err)
-			} else {
-				p.printf("ReceiveLoop hit EOF")
-			}
+		err := p.parsePacket(reader, readPacket)
+		if err == io.EOF {
+			p.printf("ReceiveLoop hit EOF")
 			return
+		} else if err != nil {
+			p.printf("Parsing failed: %v. Skipping data:\n%s", err, hex.Dump(reader.skipChunk()))
 		}
 	}
 }
 
-// Parses messages from the server
-func (p *MessageParser) ScParse(reader io.Reader, logger *log.Logger) {
-	p.logger = logger
-
-	// If we return, we should consume all input to avoid blocking the pipe
-	// we're listening on. TODO Maybe we could just close it?
-	defer p.consumeUnrecognizedInput(reader)
-
+func (p *MessageParser) parsePacket(reader io.Reader, readPacket func(io.Reader) error) (err error) {
 	defer func() {
-		if err := recover(); err != nil {
-			p.printf("Parsing failed: %v", err)
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
 		}
 	}()
+	return readPacket(reader)
+}
 
-	for {
-		err := proto.ClientReadPacket(reader, p)
-		if err != nil {
-			if err != io.EOF {
-				p.printf("ReceiveLoop failed: %v", err)
-			} else {
-				p.printf("ReceiveLoop hit EOF")
-			}
-			return
+// chunkReader passes on data in the chunks that it was relayed in, so that the
+// parser can skip the rest of a chunk that it fails to parse.
+type chunkReader struct {
+	chunks chan []byte
+	cur    []byte
+}
+
+func newChunkReader() *chunkReader {
+	return &chunkReader{
+		chunks: make(chan []byte, 256),
+	}
+}
+
+func (r *chunkReader) Write(b []byte) (n int, err error) {
+	chunk := make([]byte, len(b))
+	copy(chunk, b)
+	r.chunks <- chunk
+	return len(b), nil
+}
+
+// Close ends the input once the chunks already written have been read.
+func (r *chunkReader) Close() error {
+	close(r.chunks)
+	return nil
+}
+
+func (r *chunkReader) Read(b []byte) (n int, err error) {
+	if len(r.cur) == 0 {
+		var ok bool
+		if r.cur, ok = <-r.chunks; !ok {
+			return 0, io.EOF
 		}
 	}
+	n = copy(b, r.cur)
+	r.cur = r.cur[n:]
+	return
+}
+
+// skipChunk discards and returns the unread remainder of the current chunk.
+func (r *chunkReader) skipChunk() (rest []byte) {
+	rest, r.cur = r.cur, nil
+	return
 }
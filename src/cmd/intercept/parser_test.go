@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+
+	"chunkymonkey/proto"
+)
+
+func TestMessageParser_SkipsUnknownPackets(t *testing.T) {
+	reader := newChunkReader()
+
+	chat := new(bytes.Buffer)
+	proto.WriteChatMessage(chat, "hello")
+
+	// An unknown packet, followed by a chat message in the same chunk that is
+	// lost with it, then a chat message in a chunk of its own.
+	reader.Write(append([]byte{0xee, 0x01, 0x02}, chat.Bytes()...))
+	reader.Write(chat.Bytes())
+	reader.Close()
+
+	output := new(bytes.Buffer)
+	parser := new(MessageParser)
+	parser.ScParse(reader, log.New(output, "", 0))
+
+	logged := output.String()
+	if !strings.Contains(logged, "unknown packet ID: 0xee") {
+		t.Errorf("Expected unknown packet to be logged, got:\n%s", logged)
+	}
+	if count := strings.Count(logged, `PacketChatMessage("hello")`); count != 1 {
+		t.Errorf("Expected 1 chat message parsed, got %d in:\n%s", count, logged)
+	}
+	if !strings.HasSuffix(logged, "ReceiveLoop hit EOF\n") {
+		t.Errorf("Expected parsing to reach the end of the input, got:\n%s", logged)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"chunkymonkey/bot"
+)
+
+var (
+	numBots      = flag.Int("bots", 10, "Number of bots to connect.")
+	duration     = flag.Duration("duration", time.Minute, "How long to run the bots for once they have all connected.")
+	ramp         = flag.Duration("ramp", 100*time.Millisecond, "Delay between connecting each bot.")
+	moveInterval = flag.Duration("move_interval", 250*time.Millisecond, "Time between each bot's position updates.")
+	chatChance   = flag.Float64("chat_chance", 0.01, "Chance that a bot chats on each move.")
+	digChance    = flag.Float64("dig_chance", 0.01, "Chance that a bot digs on each move.")
+)
+
+func usage() {
+	os.Stderr.WriteString("usage: " + os.Args[0] + " [flags] server:port\n")
+	os.Stderr.WriteString("The server must be run with -online_mode=false.\n")
+	flag.PrintDefaults()
+}
+
+// durations summarises a set of latencies.
+type durations struct {
+	count         int
+	min, max, sum time.Duration
+}
+
+func (d *durations) add(dur time.Duration) {
+	if d.count == 0 || dur < d.min {
+		d.min = dur
+	}
+	if dur > d.max {
+		d.max = dur
+	}
+	d.sum += dur
+	d.count++
+}
+
+func (d *durations) String() string {
+	if d.count == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("min %v avg %v max %v (%d)", d.min, d.sum/time.Duration(d.count), d.max, d.count)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	serverAddr := flag.Arg(0)
+
+	stop := make(chan bool)
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	var bots []*bot.Bot
+	failed := 0
+
+	for i := 0; i < *numBots; i++ {
+		if i > 0 {
+			time.Sleep(*ramp)
+		}
+
+		wg.Add(1)
+		go func(username string) {
+			defer wg.Done()
+
+			conn, err := net.Dial("tcp", serverAddr)
+			if err != nil {
+				log.Printf("%s: failed to connect to server %q: %v", username, serverAddr, err)
+				lock.Lock()
+				failed++
+				lock.Unlock()
+				return
+			}
+
+			config := bot.DefaultConfig(username)
+			config.MoveInterval = *moveInterval
+			config.ChatChance = *chatChance
+			config.DigChance = *digChance
+			b := bot.New(conn, config)
+			defer b.Close()
+
+			if err = b.Login(); err != nil {
+				log.Printf("%s: failed to log in: %v", username, err)
+				lock.Lock()
+				failed++
+				lock.Unlock()
+				return
+			}
+
+			lock.Lock()
+			bots = append(bots, b)
+			lock.Unlock()
+
+			if err = b.Run(stop); err != nil {
+				log.Printf("%s: %v", username, err)
+			}
+		}(fmt.Sprintf("bot%d", i))
+	}
+
+	start := time.Now()
+	time.Sleep(*duration)
+	elapsed := time.Since(start).Seconds()
+
+	lock.Lock()
+	var login, place, chat durations
+	var sent, received, keepAlives int64
+	disconnected := 0
+	for _, b := range bots {
+		stats := b.Stats()
+		login.add(stats.LoginLatency)
+		place.add(stats.PlaceLatency)
+		for _, latency := range stats.ChatLatencies {
+			chat.add(latency)
+		}
+		sent += stats.PacketsSent
+		received += stats.PacketsReceived
+		keepAlives += stats.KeepAlives
+		if stats.Disconnect != "" {
+			disconnected++
+		}
+	}
+
+	fmt.Printf("Bots: %d connected, %d failed, %d disconnected by the server\n", len(bots), failed, disconnected)
+	fmt.Printf("Login latency: %v\n", &login)
+	fmt.Printf("Place latency: %v\n", &place)
+	fmt.Printf("Chat round trip: %v\n", &chat)
+	fmt.Printf("Packets sent: %d (%.1f/s)\n", sent, float64(sent)/elapsed)
+	fmt.Printf("Packets received: %d (%.1f/s)\n", received, float64(received)/elapsed)
+	fmt.Printf("Keep-alives answered: %d\n", keepAlives)
+	lock.Unlock()
+
+	close(stop)
+	wg.Wait()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"nbt"
+)
+
+var (
+	typed    = flag.Bool("typed", false, "Annotate tags with their types, so that the output can be converted back with -reverse.")
+	byteInts = flag.Bool("byteints", false, "Write byte arrays as arrays of integers rather than base64.")
+	sortKeys = flag.Bool("sort", false, "Sort compound tags by name.")
+	indent   = flag.String("indent", "  ", "Indentation for the output. Empty for compact output.")
+	reverse  = flag.Bool("reverse", false, "Convert typed JSON to gzipped NBT instead.")
+)
+
+func usage() {
+	os.Stderr.WriteString("usage: " + os.Args[0] + " [flags] [file]\n")
+	os.Stderr.WriteString("Converts an NBT file (gzipped or not) to JSON, reading standard input if no\nfile is given.\n")
+	flag.PrintDefaults()
+}
+
+func toJson(input io.Reader, output io.Writer) (err error) {
+	root, err := nbt.ReadCompressed(input)
+	if err != nil {
+		return
+	}
+
+	data, err := nbt.ToJson(root, nbt.JsonOptions{
+		Typed:            *typed,
+		ByteArraysAsInts: *byteInts,
+		SortKeys:         *sortKeys,
+		Indent:           *indent,
+	})
+	if err != nil {
+		return
+	}
+
+	if _, err = output.Write(data); err != nil {
+		return
+	}
+	_, err = io.WriteString(output, "\n")
+	return
+}
+
+func fromJson(input io.Reader, output io.Writer) (err error) {
+	data, err := ioutil.ReadAll(input)
+	if err != nil {
+		return
+	}
+
+	tag, err := nbt.FromJson(data)
+	if err != nil {
+		return
+	}
+
+	root, ok := tag.(*nbt.Compound)
+	if !ok {
+		return fmt.Errorf("top level tag must be a Compound, got %v", tag.Type())
+	}
+
+	return nbt.WriteCompressed(output, root, nbt.CompressionGzip)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	var input io.Reader = os.Stdin
+	switch flag.NArg() {
+	case 0:
+	case 1:
+		file, err := os.Open(flag.Arg(0))
+		if err != nil {
+			log.Fatalf("Failed to open %q: %v", flag.Arg(0), err)
+		}
+		defer file.Close()
+		input = file
+	default:
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var err error
+	if *reverse {
+		err = fromJson(input, os.Stdout)
+	} else {
+		err = toJson(input, os.Stdout)
+	}
+
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"nbt"
+)
+
+var (
+	format   = flag.String("format", "snbt", "Output format, snbt or json.")
+	typed    = flag.Bool("typed", true, "Annotate JSON output with the tag types.")
+	sortKeys = flag.Bool("sort", false, "Sort compound tags by name.")
+	path     = flag.String("path", "", "Print only the tag at this path (e.g Data/SpawnY, or Inventory/0 for a list element).")
+	sets     setFlags
+)
+
+func init() {
+	flag.Var(&sets, "set", "Set the number or string at a path, as path=value, and write the file back. May be repeated.")
+}
+
+// setFlags are the -set flags given, in order.
+type setFlags []string
+
+func (s *setFlags) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *setFlags) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return fmt.Errorf("expected path=value, got %q", value)
+	}
+	*s = append(*s, value)
+	return nil
+}
+
+func usage() {
+	os.Stderr.WriteString("usage: " + os.Args[0] + " [flags] <NBT file>\n")
+	os.Stderr.WriteString("Prints an NBT file (gzipped, zlib compressed or raw), or modifies values in it.\n")
+	flag.PrintDefaults()
+}
+
+func printTag(tag nbt.ITag) (err error) {
+	switch *format {
+	case "snbt":
+		fmt.Println(nbt.FormatSnbt(tag))
+	case "json":
+		var data []byte
+		data, err = nbt.ToJson(tag, nbt.JsonOptions{
+			Typed:    *typed,
+			SortKeys: *sortKeys,
+			Indent:   "  ",
+		})
+		if err != nil {
+			return
+		}
+		fmt.Println(string(data))
+	default:
+		err = fmt.Errorf("unknown format %q", *format)
+	}
+	return
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	filename := flag.Arg(0)
+
+	root, compression, err := nbt.ReadFile(filename)
+	if err != nil {
+		log.Fatalf("Failed to read %q: %v", filename, err)
+	}
+
+	if len(sets) > 0 {
+		for _, set := range sets {
+			parts := strings.SplitN(set, "=", 2)
+			if err = nbt.SetScalar(root, parts[0], parts[1]); err != nil {
+				log.Fatalf("Failed to set %s: %v", parts[0], err)
+			}
+		}
+		if err = nbt.WriteFileAtomic(filename, root, compression); err != nil {
+			log.Fatalf("Failed to write %q: %v", filename, err)
+		}
+		for _, set := range sets {
+			parts := strings.SplitN(set, "=", 2)
+			fmt.Printf("%s = %s\n", parts[0], nbt.FormatSnbt(root.Lookup(strings.TrimPrefix(parts[0], "/"))))
+		}
+		return
+	}
+
+	var tag nbt.ITag = root
+	if *path != "" {
+		if tag = root.Lookup(strings.TrimPrefix(*path, "/")); tag == nil {
+			log.Fatalf("Nothing at path %s", *path)
+		}
+	}
+
+	if err = printTag(tag); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	. "chunkymonkey/types"
+	"chunkymonkey/worldstore"
+)
+
+var radius = flag.Int(
+	"radius", 64,
+	"Keep the chunks within this many chunks of the spawn.")
+
+var bounds = flag.String(
+	"bounds", "",
+	"Keep the chunks within <min x>,<min z>,<max x>,<max z> inclusive, "+
+		"instead of those within -radius of the spawn.")
+
+var dryRun = flag.Bool(
+	"dry_run", false,
+	"Report how many chunks and bytes would be removed, without removing "+
+		"anything.")
+
+func usage() {
+	os.Stderr.WriteString("usage: " + os.Args[0] + " [flags] <world path>\n")
+	os.Stderr.WriteString("Deletes the overworld chunks outside of an area, apart from those containing\nplayers' beds. The server must not be running on the world; use /prune for a\nrunning server.\n")
+	flag.PrintDefaults()
+}
+
+func parseBounds(spec string) (min, max ChunkXz, err error) {
+	parts := strings.Split(spec, ",")
+	if len(parts) != 4 {
+		return min, max, fmt.Errorf("Bad -bounds %q: expected 4 numbers", spec)
+	}
+	coords := make([]ChunkCoord, len(parts))
+	for i, part := range parts {
+		n, err := strconv.ParseInt(strings.TrimSpace(part), 10, 32)
+		if err != nil {
+			return min, max, fmt.Errorf("Bad -bounds %q: %v", spec, err)
+		}
+		coords[i] = ChunkCoord(n)
+	}
+	return ChunkXz{coords[0], coords[1]}, ChunkXz{coords[2], coords[3]}, nil
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	options := worldstore.PruneOptions{Radius: *radius, DryRun: *dryRun}
+	if *bounds != "" {
+		var err error
+		if options.Min, options.Max, err = parseBounds(*bounds); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		options.Bounded = true
+	}
+
+	stats, err := worldstore.PruneWorld(flag.Arg(0), options)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	verb := "removed"
+	if *dryRun {
+		verb = "would be removed"
+	}
+	fmt.Fprintf(os.Stderr, "%d chunks kept, %d %s, freeing %d bytes\n", stats.Kept, stats.Removed, verb, stats.Bytes)
+}
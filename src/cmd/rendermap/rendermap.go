@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"os"
+	"strconv"
+	"strings"
+
+	"chunkymonkey/chunkstore"
+	"chunkymonkey/maprender"
+	. "chunkymonkey/types"
+	"chunkymonkey/worldstore"
+)
+
+var dimension = flag.Int(
+	"dimension", int(DimensionNormal),
+	"The dimension to render (0 for the overworld, -1 for the Nether, 1 for the End).")
+
+var bounds = flag.String(
+	"bounds", "",
+	"The chunks to render, as <min x>,<min z>,<max x>,<max z> inclusive. "+
+		"Defaults to every chunk stored in the world.")
+
+var zoom = flag.Int(
+	"zoom", 1,
+	"The width of a block, in pixels.")
+
+var tileChunks = flag.Int(
+	"tile_chunks", 0,
+	"If set, renders tiles of this width in chunks, as tile.<x>.<z>.png in "+
+		"the output directory, so that large worlds can be rendered without "+
+		"running out of memory.")
+
+func usage() {
+	os.Stderr.WriteString("usage: " + os.Args[0] + " [flags] <world path> <output png or directory>\n")
+	os.Stderr.WriteString("Renders a top-down map of a world.\n")
+	flag.PrintDefaults()
+}
+
+func parseBounds(spec string) (b maprender.Bounds, err error) {
+	parts := strings.Split(spec, ",")
+	if len(parts) != 4 {
+		return b, fmt.Errorf("Bad -bounds %q: expected 4 numbers", spec)
+	}
+	coords := make([]ChunkCoord, len(parts))
+	for i, part := range parts {
+		n, err := strconv.ParseInt(strings.TrimSpace(part), 10, 32)
+		if err != nil {
+			return b, fmt.Errorf("Bad -bounds %q: %v", spec, err)
+		}
+		coords[i] = ChunkCoord(n)
+	}
+	b.Min = ChunkXz{coords[0], coords[1]}
+	b.Max = ChunkXz{coords[2], coords[3]}
+	return
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	worldPath, output := flag.Arg(0), flag.Arg(1)
+
+	world, err := worldstore.LoadWorldStore(worldPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading world: %v\n", err)
+		os.Exit(1)
+	}
+
+	var renderBounds maprender.Bounds
+	if *bounds != "" {
+		if renderBounds, err = parseBounds(*bounds); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	} else {
+		var ok bool
+		renderBounds.Min, renderBounds.Max, ok, err = chunkstore.StoredChunkBounds(worldPath, world.LevelData, DimensionId(*dimension))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error finding chunks: %v\n", err)
+			os.Exit(1)
+		}
+		if !ok {
+			fmt.Fprintln(os.Stderr, "No chunks are stored for the dimension.")
+			os.Exit(1)
+		}
+	}
+
+	store, err := world.ChunkStoreForDimension(DimensionId(*dimension))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var stats maprender.Stats
+	if *tileChunks > 0 {
+		options := maprender.Options{Zoom: *zoom, TileChunks: *tileChunks}
+		stats, err = maprender.WriteTiles(store, renderBounds, options, output)
+	} else {
+		var img image.Image
+		if img, stats, err = maprender.Render(store, renderBounds, *zoom); err == nil {
+			err = maprender.WritePNG(output, img)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "%d chunks rendered, %d missing, %d failed\n", stats.Rendered, stats.Missing, stats.Failed)
+	if stats.Failed > 0 {
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,245 @@
+package nbt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PathError is returned when a tag at a given path is missing or is not of
+// the expected type.
+type PathError struct {
+	Path string
+	Want TagType
+	Got  ITag // nil if the tag was missing.
+}
+
+func (err *PathError) Error() string {
+	if err.Got == nil {
+		return fmt.Sprintf("nbt: %s is missing, expected %v", err.Path, err.Want)
+	}
+	return fmt.Sprintf("nbt: %s is %v, expected %v", err.Path, err.Got.Type(), err.Want)
+}
+
+// lookup is like tag.Lookup, but is safe to call with a nil tag and ignores a
+// leading "/" in the path.
+func lookup(tag ITag, path string) ITag {
+	if tag == nil {
+		return nil
+	}
+	return tag.Lookup(strings.TrimPrefix(path, "/"))
+}
+
+// LookupType looks up the tag at the given path, and checks that it is of the
+// given type. A *PathError is returned if it is missing or of another type.
+func LookupType(tag ITag, path string, tagType TagType) (result ITag, err error) {
+	result = lookup(tag, path)
+	if result == nil || result.Type() != tagType {
+		return nil, &PathError{path, tagType, result}
+	}
+	return result, nil
+}
+
+// GetByte returns the value of the Byte at the given path. ok is false if it
+// is missing or of another type.
+func GetByte(tag ITag, path string) (v int8, ok bool) {
+	t, ok := lookup(tag, path).(*Byte)
+	if !ok {
+		return
+	}
+	return t.Value, true
+}
+
+// GetShort returns the value of the Short at the given path. ok is false if
+// it is missing or of another type.
+func GetShort(tag ITag, path string) (v int16, ok bool) {
+	t, ok := lookup(tag, path).(*Short)
+	if !ok {
+		return
+	}
+	return t.Value, true
+}
+
+// GetInt returns the value of the Int at the given path. ok is false if it is
+// missing or of another type.
+func GetInt(tag ITag, path string) (v int32, ok bool) {
+	t, ok := lookup(tag, path).(*Int)
+	if !ok {
+		return
+	}
+	return t.Value, true
+}
+
+// GetLong returns the value of the Long at the given path. ok is false if it
+// is missing or of another type.
+func GetLong(tag ITag, path string) (v int64, ok bool) {
+	t, ok := lookup(tag, path).(*Long)
+	if !ok {
+		return
+	}
+	return t.Value, true
+}
+
+// GetFloat returns the value of the Float at the given path. ok is false if
+// it is missing or of another type.
+func GetFloat(tag ITag, path string) (v float32, ok bool) {
+	t, ok := lookup(tag, path).(*Float)
+	if !ok {
+		return
+	}
+	return t.Value, true
+}
+
+// GetDouble returns the value of the Double at the given path. ok is false if
+// it is missing or of another type.
+func GetDouble(tag ITag, path string) (v float64, ok bool) {
+	t, ok := lookup(tag, path).(*Double)
+	if !ok {
+		return
+	}
+	return t.Value, true
+}
+
+// GetString returns the value of the String at the given path. ok is false if
+// it is missing or of another type.
+func GetString(tag ITag, path string) (v string, ok bool) {
+	t, ok := lookup(tag, path).(*String)
+	if !ok {
+		return
+	}
+	return t.Value, true
+}
+
+// GetByteArray returns the value of the ByteArray at the given path. ok is
+// false if it is missing or of another type.
+func GetByteArray(tag ITag, path string) (v []byte, ok bool) {
+	t, ok := lookup(tag, path).(*ByteArray)
+	if !ok {
+		return
+	}
+	return t.Value, true
+}
+
+// GetIntArray returns the value of the IntArray at the given path. ok is
+// false if it is missing or of another type.
+func GetIntArray(tag ITag, path string) (v []int32, ok bool) {
+	t, ok := lookup(tag, path).(*IntArray)
+	if !ok {
+		return
+	}
+	return t.Value, true
+}
+
+// GetList returns the List at the given path. ok is false if it is missing,
+// of another type, or if it is a non-empty list of elements other than
+// elemType. Empty lists are accepted regardless of their element type, as
+// the official server is not consistent about the element type it writes for
+// them.
+func GetList(tag ITag, path string, elemType TagType) (list *List, ok bool) {
+	list, ok = lookup(tag, path).(*List)
+	if !ok || (len(list.Value) > 0 && list.TagType != elemType) {
+		return nil, false
+	}
+	return list, true
+}
+
+// GetCompound returns the Compound at the given path. ok is false if it is
+// missing or of another type.
+func GetCompound(tag ITag, path string) (compound *Compound, ok bool) {
+	compound, ok = lookup(tag, path).(*Compound)
+	return
+}
+
+// MustCompound returns the Compound at the given path, or a *PathError if it
+// is missing or of another type.
+func MustCompound(tag ITag, path string) (compound *Compound, err error) {
+	result, err := LookupType(tag, path, TagCompound)
+	if err != nil {
+		return
+	}
+	return result.(*Compound), nil
+}
+
+// ParseScalar parses value as a tag of the given type, which must be a
+// number type or String. A numeric value may carry the SNBT suffix for its
+// type (e.g "64s" for a Short).
+func ParseScalar(tagType TagType, value string) (tag ITag, err error) {
+	number := value
+	if suffix, ok := snbtSuffixes[tagType]; ok && strings.HasSuffix(strings.ToLower(value), suffix) {
+		number = value[:len(value)-1]
+	}
+
+	var i int64
+	var f float64
+	switch tagType {
+	case TagByte:
+		i, err = strconv.ParseInt(number, 10, 8)
+		tag = &Byte{int8(i)}
+	case TagShort:
+		i, err = strconv.ParseInt(number, 10, 16)
+		tag = &Short{int16(i)}
+	case TagInt:
+		i, err = strconv.ParseInt(number, 10, 32)
+		tag = &Int{int32(i)}
+	case TagLong:
+		i, err = strconv.ParseInt(number, 10, 64)
+		tag = &Long{i}
+	case TagFloat:
+		f, err = strconv.ParseFloat(number, 32)
+		tag = &Float{float32(f)}
+	case TagDouble:
+		f, err = strconv.ParseFloat(number, 64)
+		tag = &Double{f}
+	case TagString:
+		tag = &String{value}
+	default:
+		return nil, fmt.Errorf("nbt: %v is not a scalar type", tagType)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("nbt: bad %v value %q", tagType, value)
+	}
+	return
+}
+
+// snbtSuffixes are the (lower case) SNBT suffixes accepted by ParseScalar.
+var snbtSuffixes = map[TagType]string{
+	TagByte:   "b",
+	TagShort:  "s",
+	TagLong:   "l",
+	TagFloat:  "f",
+	TagDouble: "d",
+}
+
+// SetScalar parses value as the type of the existing number or String tag at
+// the given path, and sets the tag to it. The path may index into lists. Tags
+// are not created, so that a mistyped path can't add a new one.
+func SetScalar(tag ITag, path string, value string) (err error) {
+	existing := lookup(tag, path)
+	if existing == nil {
+		return fmt.Errorf("nbt: %s is missing", path)
+	}
+
+	parsed, err := ParseScalar(existing.Type(), value)
+	if err != nil {
+		return
+	}
+
+	switch t := existing.(type) {
+	case *Byte:
+		t.Value = parsed.(*Byte).Value
+	case *Short:
+		t.Value = parsed.(*Short).Value
+	case *Int:
+		t.Value = parsed.(*Int).Value
+	case *Long:
+		t.Value = parsed.(*Long).Value
+	case *Float:
+		t.Value = parsed.(*Float).Value
+	case *Double:
+		t.Value = parsed.(*Double).Value
+	case *String:
+		t.Value = parsed.(*String).Value
+	}
+	return
+}
@@ -0,0 +1,165 @@
+package nbt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testAccessorsCompound() *Compound {
+	return &Compound{
+		Tags: map[string]ITag{
+			"Data": &Compound{
+				Tags: map[string]ITag{
+					"Int":    &Int{3},
+					"Long":   &Long{4},
+					"Double": &Double{6},
+					"String": &String{"foo"},
+					"Pos":    &List{TagDouble, []ITag{&Double{1}, &Double{2}, &Double{3}}},
+					"Empty":  &List{TagEnd, []ITag{}},
+				},
+			},
+		},
+	}
+}
+
+func Test_GetValues(t *testing.T) {
+	root := testAccessorsCompound()
+
+	if v, ok := GetInt(root, "Data/Int"); !ok || v != 3 {
+		t.Errorf("GetInt: got %d, %t", v, ok)
+	}
+	if v, ok := GetLong(root, "/Data/Long"); !ok || v != 4 {
+		t.Errorf("GetLong with leading slash: got %d, %t", v, ok)
+	}
+	if v, ok := GetDouble(root, "Data/Double"); !ok || v != 6 {
+		t.Errorf("GetDouble: got %f, %t", v, ok)
+	}
+	if v, ok := GetString(root, "Data/String"); !ok || v != "foo" {
+		t.Errorf("GetString: got %q, %t", v, ok)
+	}
+	if list, ok := GetList(root, "Data/Pos", TagDouble); !ok || len(list.Value) != 3 {
+		t.Errorf("GetList: got %v, %t", list, ok)
+	}
+	if _, ok := GetList(root, "Data/Empty", TagCompound); !ok {
+		t.Errorf("GetList: expected empty list of any type to be accepted")
+	}
+}
+
+func Test_GetValuesMissingOrWrongType(t *testing.T) {
+	root := testAccessorsCompound()
+
+	if _, ok := GetInt(root, "Data/Long"); ok {
+		t.Errorf("GetInt: expected failure for Long")
+	}
+	if _, ok := GetInt(root, "Data/Missing/Deeper"); ok {
+		t.Errorf("GetInt: expected failure for missing path")
+	}
+	if _, ok := GetInt(root, "Data/Int/Deeper"); ok {
+		t.Errorf("GetInt: expected failure for path through non-compound")
+	}
+	if _, ok := GetInt(nil, "Data/Int"); ok {
+		t.Errorf("GetInt: expected failure for nil tag")
+	}
+	if _, ok := GetList(root, "Data/Pos", TagFloat); ok {
+		t.Errorf("GetList: expected failure for wrong element type")
+	}
+}
+
+func Test_MustCompound(t *testing.T) {
+	root := testAccessorsCompound()
+
+	if _, err := MustCompound(root, "Data"); err != nil {
+		t.Errorf("MustCompound: unexpected error %v", err)
+	}
+
+	_, err := MustCompound(root, "Data/Int")
+	if pathErr, ok := err.(*PathError); !ok || pathErr.Path != "Data/Int" {
+		t.Errorf("MustCompound: expected *PathError for Data/Int, got %v", err)
+	} else if expected := "nbt: Data/Int is TagInt, expected TagCompound"; err.Error() != expected {
+		t.Errorf("MustCompound: expected error %q, got %q", expected, err.Error())
+	}
+
+	if _, err = MustCompound(root, "Player"); err == nil {
+		t.Errorf("MustCompound: expected error for missing Player")
+	}
+}
+
+func Test_GetValuesInLists(t *testing.T) {
+	root := testAccessorsCompound()
+
+	if v, ok := GetDouble(root, "Data/Pos/1"); !ok || v != 2 {
+		t.Errorf("GetDouble in list: got %f, %t", v, ok)
+	}
+	for _, path := range []string{"Data/Pos/3", "Data/Pos/-1", "Data/Pos/x", "Data/Empty/0", "Data/Pos/0/Deeper"} {
+		if tag := lookup(root, path); tag != nil {
+			t.Errorf("Expected nothing at %s, got %v", path, tag)
+		}
+	}
+}
+
+func Test_ParseScalar(t *testing.T) {
+	type Test struct {
+		tagType  TagType
+		value    string
+		expected ITag // nil if the value is bad.
+	}
+
+	var tests = []Test{
+		{TagByte, "-5", &Byte{-5}},
+		{TagByte, "5b", &Byte{5}},
+		{TagByte, "128", nil},
+		{TagShort, "64", &Short{64}},
+		{TagShort, "64S", &Short{64}},
+		{TagShort, "64L", nil},
+		{TagInt, "100000", &Int{100000}},
+		{TagInt, "1.5", nil},
+		{TagLong, "24000L", &Long{24000}},
+		{TagFloat, "1.5f", &Float{1.5}},
+		{TagDouble, "-2.25", &Double{-2.25}},
+		{TagDouble, "2.25d", &Double{2.25}},
+		{TagDouble, "", nil},
+		{TagString, "64s", &String{"64s"}},
+		{TagCompound, "1", nil},
+	}
+
+	for _, test := range tests {
+		tag, err := ParseScalar(test.tagType, test.value)
+		if test.expected == nil {
+			if err == nil {
+				t.Errorf("ParseScalar(%v, %q): expected error, got %v", test.tagType, test.value, tag)
+			}
+		} else if err != nil || !reflect.DeepEqual(tag, test.expected) {
+			t.Errorf("ParseScalar(%v, %q): expected %v, got %v, %v", test.tagType, test.value, test.expected, tag, err)
+		}
+	}
+}
+
+func Test_SetScalar(t *testing.T) {
+	root := testAccessorsCompound()
+
+	if err := SetScalar(root, "Data/Long", "24000"); err != nil {
+		t.Errorf("SetScalar Long: %v", err)
+	}
+	if v, _ := GetLong(root, "Data/Long"); v != 24000 {
+		t.Errorf("Expected Long 24000, got %d", v)
+	}
+
+	if err := SetScalar(root, "Data/Pos/1", "64.5"); err != nil {
+		t.Errorf("SetScalar in list: %v", err)
+	}
+	if v, _ := GetDouble(root, "Data/Pos/1"); v != 64.5 {
+		t.Errorf("Expected Pos/1 64.5, got %f", v)
+	}
+
+	for _, path := range []string{"Data/Missing", "Data/Pos", "Data"} {
+		if err := SetScalar(root, path, "1"); err == nil {
+			t.Errorf("SetScalar %s: expected error", path)
+		}
+	}
+	if err := SetScalar(root, "Data/Int", "abc"); err == nil {
+		t.Errorf("SetScalar with bad value: expected error")
+	}
+	if v, _ := GetInt(root, "Data/Int"); v != 3 {
+		t.Errorf("Expected Int unchanged after a bad value, got %d", v)
+	}
+}
@@ -0,0 +1,145 @@
+package nbt
+
+import (
+	"fmt"
+)
+
+// Builder adds tags to a Compound. Its methods return the Builder so that
+// calls can be chained, for example:
+//
+//   root, err := NewBuilder().
+//     PutCompound("Data", NewBuilder().
+//       PutInt("SpawnX", 0).
+//       PutDoubleList("Pos", 0.5, 64, 0.5)).
+//     Build()
+//
+// Tags are written in the order that they are added. The first error
+// encountered (such as a list with mixed element types) is recorded, causes
+// later calls to be ignored, and is returned by Build.
+type Builder struct {
+	compound *Compound
+	err      error
+}
+
+// NewBuilder creates a Builder for a new Compound.
+func NewBuilder() *Builder {
+	return BuildInto(NewCompound())
+}
+
+// BuildInto creates a Builder that adds tags to an existing Compound.
+func BuildInto(compound *Compound) *Builder {
+	if compound.Tags == nil {
+		compound.Tags = make(map[string]ITag)
+	}
+	return &Builder{compound: compound}
+}
+
+// Build returns the built Compound, or the first error encountered.
+func (b *Builder) Build() (*Compound, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b.compound, nil
+}
+
+// Err returns the first error encountered, if any.
+func (b *Builder) Err() error {
+	return b.err
+}
+
+// Put adds any tag.
+func (b *Builder) Put(name string, tag ITag) *Builder {
+	if b.err != nil {
+		return b
+	}
+	if tag == nil {
+		b.err = fmt.Errorf("nbt: nil tag for %q", name)
+		return b
+	}
+	b.compound.setChild(name, tag)
+	return b
+}
+
+func (b *Builder) PutByte(name string, v int8) *Builder {
+	return b.Put(name, &Byte{v})
+}
+
+func (b *Builder) PutShort(name string, v int16) *Builder {
+	return b.Put(name, &Short{v})
+}
+
+func (b *Builder) PutInt(name string, v int32) *Builder {
+	return b.Put(name, &Int{v})
+}
+
+func (b *Builder) PutLong(name string, v int64) *Builder {
+	return b.Put(name, &Long{v})
+}
+
+func (b *Builder) PutFloat(name string, v float32) *Builder {
+	return b.Put(name, &Float{v})
+}
+
+func (b *Builder) PutDouble(name string, v float64) *Builder {
+	return b.Put(name, &Double{v})
+}
+
+func (b *Builder) PutString(name string, v string) *Builder {
+	return b.Put(name, &String{v})
+}
+
+func (b *Builder) PutByteArray(name string, v []byte) *Builder {
+	return b.Put(name, &ByteArray{v})
+}
+
+func (b *Builder) PutIntArray(name string, v []int32) *Builder {
+	return b.Put(name, &IntArray{v})
+}
+
+// PutList adds a list of elements of elemType. It is an error for any
+// element to be of another type.
+func (b *Builder) PutList(name string, elemType TagType, elems ...ITag) *Builder {
+	if b.err != nil {
+		return b
+	}
+	for i, elem := range elems {
+		if elem == nil || elem.Type() != elemType {
+			b.err = fmt.Errorf("nbt: element %d of List %q is %T, expected %v", i, name, elem, elemType)
+			return b
+		}
+	}
+	if elems == nil {
+		elems = []ITag{}
+	}
+	return b.Put(name, &List{elemType, elems})
+}
+
+// PutFloatList adds a list of Floats (e.g a rotation).
+func (b *Builder) PutFloatList(name string, vs ...float32) *Builder {
+	elems := make([]ITag, len(vs))
+	for i, v := range vs {
+		elems[i] = &Float{v}
+	}
+	return b.PutList(name, TagFloat, elems...)
+}
+
+// PutDoubleList adds a list of Doubles (e.g a position or motion).
+func (b *Builder) PutDoubleList(name string, vs ...float64) *Builder {
+	elems := make([]ITag, len(vs))
+	for i, v := range vs {
+		elems[i] = &Double{v}
+	}
+	return b.PutList(name, TagDouble, elems...)
+}
+
+// PutCompound adds the Compound built by child, or records its error.
+func (b *Builder) PutCompound(name string, child *Builder) *Builder {
+	if b.err != nil {
+		return b
+	}
+	if child.err != nil {
+		b.err = fmt.Errorf("nbt: in %q: %v", name, child.err)
+		return b
+	}
+	return b.Put(name, child.compound)
+}
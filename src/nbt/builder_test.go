@@ -0,0 +1,81 @@
+package nbt
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func Test_BuilderWriteAndRead(t *testing.T) {
+	root, err := NewBuilder().
+		PutCompound("Data", NewBuilder().
+			PutByte("Byte", 1).
+			PutShort("Short", 2).
+			PutInt("Int", 3).
+			PutLong("Long", 4).
+			PutFloat("Float", 5).
+			PutDouble("Double", 6).
+			PutString("String", "foo").
+			PutByteArray("ByteArray", []byte{1, 2}).
+			PutIntArray("IntArray", []int32{3, 4}).
+			PutDoubleList("Pos", 1, 2, 3).
+			PutFloatList("Rotation", 90, 0).
+			PutList("Empty", TagCompound).
+			PutCompound("Player", NewBuilder().
+				PutString("Name", "bob"))).
+		Build()
+	if err != nil {
+		t.Fatalf("Build error: %v", err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err = Write(buf, root); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+
+	result, err := Read(buf)
+	if err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+
+	if !reflect.DeepEqual(root, result) {
+		t.Errorf("Expected %#v, got %#v", root, result)
+	}
+
+	expectedOrder := []string{"Byte", "Short", "Int", "Long", "Float", "Double", "String",
+		"ByteArray", "IntArray", "Pos", "Rotation", "Empty", "Player"}
+	if order := result.Lookup("Data").(*Compound).names(); !reflect.DeepEqual(expectedOrder, order) {
+		t.Errorf("Expected tags in order %v, got %v", expectedOrder, order)
+	}
+
+	if name, ok := GetString(result, "Data/Player/Name"); !ok || name != "bob" {
+		t.Errorf("Expected Data/Player/Name = bob, got %q", name)
+	}
+}
+
+func Test_BuilderErrors(t *testing.T) {
+	_, err := NewBuilder().
+		PutList("Mixed", TagByte, &Byte{1}, &Short{2}).
+		PutInt("After", 1).
+		Build()
+	if err == nil {
+		t.Errorf("Expected error for mixed-type list")
+	}
+
+	_, err = NewBuilder().
+		PutCompound("Outer", NewBuilder().Put("Nil", nil)).
+		Build()
+	if err == nil {
+		t.Errorf("Expected error from nested builder")
+	}
+}
+
+func Test_BuildInto(t *testing.T) {
+	compound := &Compound{}
+	if err := BuildInto(compound).PutInt("x", 1).Err(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if v, ok := GetInt(compound, "x"); !ok || v != 1 {
+		t.Errorf("Expected x = 1 in %#v", compound)
+	}
+}
@@ -0,0 +1,118 @@
+package nbt
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+)
+
+// Compression identifies how NBT data is wrapped.
+type Compression int
+
+const (
+	CompressionNone = Compression(iota) // Raw NBT.
+	CompressionGzip                     // Used for level.dat and player files.
+	CompressionZlib                     // Used for chunk data in region files.
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionGzip:
+		return "gzip"
+	case CompressionZlib:
+		return "zlib"
+	}
+	return fmt.Sprintf("Compression(%d)", int(c))
+}
+
+// DetectCompression identifies the compression of NBT data from its leading
+// bytes, without consuming them.
+func DetectCompression(reader *bufio.Reader) (compression Compression, err error) {
+	header, err := reader.Peek(2)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return
+	}
+
+	switch {
+	case header[0] == 0x1f && header[1] == 0x8b:
+		return CompressionGzip, nil
+	case header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0:
+		// Deflate method, with a valid header checksum.
+		return CompressionZlib, nil
+	case TagType(header[0]) == TagCompound:
+		return CompressionNone, nil
+	}
+
+	return CompressionNone, fmt.Errorf("nbt: unrecognised data starting %#x", header)
+}
+
+// Decompress detects the compression of the NBT data in reader, and returns
+// a reader for the uncompressed data, which should be closed after use.
+func Decompress(reader io.Reader) (decompressed io.ReadCloser, compression Compression, err error) {
+	buffered := bufio.NewReader(reader)
+	if compression, err = DetectCompression(buffered); err != nil {
+		return
+	}
+
+	switch compression {
+	case CompressionGzip:
+		decompressed, err = gzip.NewReader(buffered)
+	case CompressionZlib:
+		decompressed, err = zlib.NewReader(buffered)
+	default:
+		decompressed = nopCloser{buffered}
+	}
+
+	return
+}
+
+type nopCloser struct {
+	io.Reader
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// ReadCompressed reads an NBT compound that may be gzipped, zlib compressed
+// or raw. As the data typically comes from files, DefaultLimits are applied
+// to it.
+func ReadCompressed(reader io.Reader) (tag *Compound, err error) {
+	decompressed, _, err := Decompress(reader)
+	if err != nil {
+		return
+	}
+	defer decompressed.Close()
+
+	return NewDecoder(decompressed, DefaultLimits).Decode()
+}
+
+// WriteCompressed writes an NBT compound with the given compression.
+func WriteCompressed(writer io.Writer, tag *Compound, compression Compression) (err error) {
+	var compressor io.WriteCloser
+
+	switch compression {
+	case CompressionNone:
+		return Write(writer, tag)
+	case CompressionGzip:
+		compressor = gzip.NewWriter(writer)
+	case CompressionZlib:
+		compressor = zlib.NewWriter(writer)
+	default:
+		return fmt.Errorf("nbt: unknown compression %v", compression)
+	}
+
+	if err = Write(compressor, tag); err != nil {
+		compressor.Close()
+		return
+	}
+
+	return compressor.Close()
+}
@@ -0,0 +1,60 @@
+package nbt
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func Test_CompressedRoundTrip(t *testing.T) {
+	root := testJsonCompound()
+
+	for _, compression := range []Compression{CompressionNone, CompressionGzip, CompressionZlib} {
+		buf := new(bytes.Buffer)
+		if err := WriteCompressed(buf, root, compression); err != nil {
+			t.Errorf("%v: WriteCompressed error: %v", compression, err)
+			continue
+		}
+		data := buf.Bytes()
+
+		_, detected, err := Decompress(bytes.NewBuffer(data))
+		if err != nil || detected != compression {
+			t.Errorf("%v: detected as %v, %v", compression, detected, err)
+		}
+
+		result, err := ReadCompressed(bytes.NewBuffer(data))
+		if err != nil {
+			t.Errorf("%v: ReadCompressed error: %v", compression, err)
+			continue
+		}
+		if !reflect.DeepEqual(root, result) {
+			t.Errorf("%v: expected %#v, got %#v", compression, root, result)
+		}
+
+		// Truncated data must produce an error.
+		if _, err = ReadCompressed(bytes.NewBuffer(data[:len(data)/2])); err == nil {
+			t.Errorf("%v: expected error for truncated data", compression)
+		}
+	}
+}
+
+func Test_ReadCompressedErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"\x1f",
+		"\x08\x00\x00", // Root is not a compound.
+		"\x1f\x8bnot really gzip",
+		"\x78\x9cnot really zlib",
+	}
+
+	for _, test := range tests {
+		if _, err := ReadCompressed(bytes.NewBufferString(test)); err == nil {
+			t.Errorf("Expected error reading %q", test)
+		}
+	}
+
+	if _, err := ReadCompressed(bytes.NewBufferString("")); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected io.ErrUnexpectedEOF for empty data, got %v", err)
+	}
+}
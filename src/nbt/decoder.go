@@ -0,0 +1,506 @@
+package nbt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+)
+
+// Limits bound the resources that a Decoder will use, to protect against
+// corrupt or hostile input (e.g a List claiming 2^31 elements). A zero value
+// for a field means that there is no limit.
+type Limits struct {
+	MaxDepth  int   // Maximum nesting of lists and compounds.
+	MaxSize   int64 // Maximum number of bytes to read.
+	MaxLength int   // Maximum number of elements in a single list or array.
+}
+
+// DefaultLimits are generous for any level, player or chunk data written by
+// the official server, while preventing huge allocations.
+var DefaultLimits = Limits{
+	MaxDepth:  64,
+	MaxSize:   16 << 20,
+	MaxLength: 1 << 20,
+}
+
+// LimitError is returned when decoding exceeds one of the Limits.
+type LimitError struct {
+	Limit string // Name of the limit exceeded.
+	Value int64
+	Max   int64
+}
+
+func (err *LimitError) Error() string {
+	return fmt.Sprintf("nbt: %s of %d exceeds limit of %d", err.Limit, err.Value, err.Max)
+}
+
+// limitedReader counts bytes read, and returns a LimitError on attempts to
+// read more than maxSize bytes.
+type limitedReader struct {
+	reader  io.Reader
+	size    int64
+	maxSize int64
+}
+
+func (r *limitedReader) Read(p []byte) (n int, err error) {
+	if r.maxSize > 0 {
+		remaining := r.maxSize - r.size
+		if remaining <= 0 {
+			return 0, &LimitError{"size", r.size + int64(len(p)), r.maxSize}
+		}
+		if int64(len(p)) > remaining {
+			p = p[:remaining]
+		}
+	}
+
+	n, err = r.reader.Read(p)
+	r.size += int64(n)
+	return
+}
+
+// reserve checks that n more bytes may be read before allocating space for
+// them.
+func (r *limitedReader) reserve(n int64) error {
+	if r.maxSize > 0 && r.size+n > r.maxSize {
+		return &LimitError{"size", r.size + n, r.maxSize}
+	}
+	return nil
+}
+
+// tagMinSize is the smallest encoded size of a tag of each type, used to
+// reject impossible list lengths before allocating for them.
+var tagMinSize = map[TagType]int64{
+	TagByte:      1,
+	TagShort:     2,
+	TagInt:       4,
+	TagLong:      8,
+	TagFloat:     4,
+	TagDouble:    8,
+	TagByteArray: 4,
+	TagString:    2,
+	TagList:      5,
+	TagCompound:  1,
+	TagIntArray:  4,
+}
+
+// Decoder reads NBT data, enforcing Limits on it.
+type Decoder struct {
+	reader limitedReader
+	limits Limits
+	depth  int
+}
+
+// NewDecoder creates a Decoder that reads from reader.
+func NewDecoder(reader io.Reader, limits Limits) *Decoder {
+	return &Decoder{
+		reader: limitedReader{reader: reader, maxSize: limits.MaxSize},
+		limits: limits,
+	}
+}
+
+func newUnlimitedDecoder(reader io.Reader) *Decoder {
+	return NewDecoder(reader, Limits{})
+}
+
+// Decode reads an NBT compound, in the same way as Read.
+func (d *Decoder) Decode() (root *Compound, err error) {
+	if err = d.readRootHeader(); err != nil {
+		return
+	}
+
+	root = new(Compound)
+	if err = d.readCompound(root); err != nil {
+		return nil, err
+	}
+
+	return root, nil
+}
+
+// VisitAction is returned by IVisitor.Enter to control what Decoder.Visit
+// does with a tag.
+type VisitAction int
+
+const (
+	// VisitSkip skips over the tag without decoding it.
+	VisitSkip = VisitAction(iota)
+	// VisitDescend visits the tags within a compound or list. It is the same as
+	// VisitSkip for other tag types.
+	VisitDescend
+	// VisitDecode decodes the tag and passes it to IVisitor.Tag.
+	VisitDecode
+)
+
+// IVisitor selects the tags that Decoder.Visit decodes.
+type IVisitor interface {
+	// Enter is called before the payload of each tag is read. Paths are as
+	// for Lookup, with list elements named by their index.
+	Enter(path string, tagType TagType) VisitAction
+
+	// Tag is called with each tag that Enter returned VisitDecode for.
+	Tag(path string, tag ITag)
+}
+
+// Visit reads an NBT compound, decoding only the tags that the visitor asks
+// for. This avoids building the full tree when only a few tags are wanted.
+func (d *Decoder) Visit(visitor IVisitor) (err error) {
+	if err = d.readRootHeader(); err != nil {
+		return
+	}
+
+	return d.visitChildren("", TagCompound, visitor)
+}
+
+func (d *Decoder) readRootHeader() (err error) {
+	var tagType TagType
+	var name string
+	if tagType, name, err = d.readHeader(); err != nil {
+		return
+	}
+
+	switch {
+	case tagType == TagEnd:
+		return errors.New("end tag found at top level")
+	case name != "":
+		return errors.New("root name should be empty")
+	case tagType != TagCompound:
+		return errors.New("expected compound at top level")
+	}
+
+	return nil
+}
+
+// readHeader reads the type and name of a tag in a compound. name is empty
+// for TagEnd.
+func (d *Decoder) readHeader() (tagType TagType, name string, err error) {
+	if err = tagType.read(&d.reader); err != nil {
+		return
+	}
+
+	if tagType == TagEnd {
+		return
+	}
+
+	var nameTag String
+	if err = nameTag.Read(&d.reader); err != nil {
+		return
+	}
+
+	return tagType, nameTag.Value, nil
+}
+
+// readLength reads the length of a list or array whose elements are at least
+// elemSize bytes long.
+func (d *Decoder) readLength(kind string, elemSize int64) (length int, err error) {
+	var lengthTag Int
+	if err = lengthTag.Read(&d.reader); err != nil {
+		return
+	}
+
+	if lengthTag.Value < 0 {
+		return 0, fmt.Errorf("negative %s length %d", kind, lengthTag.Value)
+	}
+
+	length = int(lengthTag.Value)
+	if d.limits.MaxLength > 0 && length > d.limits.MaxLength {
+		return 0, &LimitError{kind + " length", int64(length), int64(d.limits.MaxLength)}
+	}
+
+	if err = d.reader.reserve(int64(length) * elemSize); err != nil {
+		return 0, err
+	}
+
+	return
+}
+
+func (d *Decoder) enter() error {
+	d.depth++
+	if d.limits.MaxDepth > 0 && d.depth > d.limits.MaxDepth {
+		return &LimitError{"depth", int64(d.depth), int64(d.limits.MaxDepth)}
+	}
+	return nil
+}
+
+func (d *Decoder) leave() {
+	d.depth--
+}
+
+func (d *Decoder) readTag(tagType TagType) (tag ITag, err error) {
+	if tag, err = tagType.NewTag(); err != nil {
+		return
+	}
+
+	switch t := tag.(type) {
+	case *ByteArray:
+		err = d.readByteArray(t)
+	case *IntArray:
+		err = d.readIntArray(t)
+	case *List:
+		err = d.readList(t)
+	case *Compound:
+		err = d.readCompound(t)
+	default:
+		err = tag.Read(&d.reader)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+// maxPrealloc and maxListPrealloc are the largest number of bytes or list
+// elements allocated for an array or list before reading its contents. Larger
+// ones are grown as data is read, so that a length claimed in corrupt data can
+// only cause as much allocation as there is data to back it.
+const (
+	maxPrealloc     = 1 << 16
+	maxListPrealloc = 64
+)
+
+// readBytes reads exactly n bytes.
+func (d *Decoder) readBytes(n int) (bs []byte, err error) {
+	if n <= maxPrealloc {
+		bs = make([]byte, n)
+		_, err = io.ReadFull(&d.reader, bs)
+		return
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, maxPrealloc))
+	if _, err = io.CopyN(buf, &d.reader, int64(n)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (d *Decoder) readByteArray(b *ByteArray) (err error) {
+	length, err := d.readLength("ByteArray", 1)
+	if err != nil {
+		return
+	}
+
+	bs, err := d.readBytes(length)
+	if err != nil {
+		return
+	}
+
+	b.Value = bs
+	return
+}
+
+func (d *Decoder) readIntArray(a *IntArray) (err error) {
+	length, err := d.readLength("IntArray", 4)
+	if err != nil {
+		return
+	}
+
+	bs, err := d.readBytes(4 * length)
+	if err != nil {
+		return
+	}
+
+	ints := make([]int32, length)
+	for i := range ints {
+		ints[i] = int32(binary.BigEndian.Uint32(bs[4*i:]))
+	}
+
+	a.Value = ints
+	return
+}
+
+// readListHeader reads the element type and length of a list.
+func (d *Decoder) readListHeader() (elemType TagType, length int, err error) {
+	if err = elemType.read(&d.reader); err != nil {
+		return
+	}
+
+	if length, err = d.readLength("List", tagMinSize[elemType]); err != nil {
+		return
+	}
+
+	if elemType == TagEnd && length > 0 {
+		err = fmt.Errorf("List of TagEnd with length %d", length)
+	}
+
+	return
+}
+
+func (d *Decoder) readList(l *List) (err error) {
+	if err = d.enter(); err != nil {
+		return
+	}
+	defer d.leave()
+
+	length := 0
+	if l.TagType, length, err = d.readListHeader(); err != nil {
+		return
+	}
+
+	capacity := length
+	if capacity > maxListPrealloc {
+		capacity = maxListPrealloc
+	}
+
+	list := make([]ITag, 0, capacity)
+	for i := 0; i < length; i++ {
+		var tag ITag
+		if tag, err = d.readTag(l.TagType); err != nil {
+			return
+		}
+		list = append(list, tag)
+	}
+
+	l.Value = list
+	return
+}
+
+func (d *Decoder) readCompound(c *Compound) (err error) {
+	if err = d.enter(); err != nil {
+		return
+	}
+	defer d.leave()
+
+	tags := make(map[string]ITag)
+	var order []string
+
+	for {
+		var tagType TagType
+		var tagName string
+		if tagType, tagName, err = d.readHeader(); err != nil {
+			return
+		}
+
+		if tagType == TagEnd {
+			break
+		}
+
+		var tag ITag
+		if tag, err = d.readTag(tagType); err != nil {
+			return
+		}
+
+		if _, exists := tags[tagName]; !exists {
+			order = append(order, tagName)
+		}
+		tags[tagName] = tag
+	}
+
+	c.Tags = tags
+	c.order = order
+	return
+}
+
+// visitTag handles a single tag at path according to the visitor.
+func (d *Decoder) visitTag(path string, tagType TagType, visitor IVisitor) (err error) {
+	action := visitor.Enter(path, tagType)
+
+	switch {
+	case action == VisitDecode:
+		var tag ITag
+		if tag, err = d.readTag(tagType); err != nil {
+			return
+		}
+		visitor.Tag(path, tag)
+		return nil
+	case action == VisitDescend && (tagType == TagCompound || tagType == TagList):
+		return d.visitChildren(path, tagType, visitor)
+	}
+
+	return d.skip(tagType)
+}
+
+// visitChildren visits the tags within the compound or list at path.
+func (d *Decoder) visitChildren(path string, tagType TagType, visitor IVisitor) (err error) {
+	if err = d.enter(); err != nil {
+		return
+	}
+	defer d.leave()
+
+	prefix := path
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	if tagType == TagList {
+		var elemType TagType
+		var length int
+		if elemType, length, err = d.readListHeader(); err != nil {
+			return
+		}
+		for i := 0; i < length; i++ {
+			if err = d.visitTag(prefix+strconv.Itoa(i), elemType, visitor); err != nil {
+				return
+			}
+		}
+		return nil
+	}
+
+	for {
+		var childType TagType
+		var name string
+		if childType, name, err = d.readHeader(); err != nil {
+			return
+		}
+		if childType == TagEnd {
+			return nil
+		}
+		if err = d.visitTag(prefix+name, childType, visitor); err != nil {
+			return
+		}
+	}
+}
+
+// skip reads past the payload of a tag without decoding it.
+func (d *Decoder) skip(tagType TagType) (err error) {
+	var n int64
+
+	switch tagType {
+	case TagByte, TagShort, TagInt, TagLong, TagFloat, TagDouble:
+		n = tagMinSize[tagType]
+	case TagByteArray:
+		var length int
+		if length, err = d.readLength("ByteArray", 1); err != nil {
+			return
+		}
+		n = int64(length)
+	case TagIntArray:
+		var length int
+		if length, err = d.readLength("IntArray", 4); err != nil {
+			return
+		}
+		n = 4 * int64(length)
+	case TagString:
+		var length Short
+		if err = length.Read(&d.reader); err != nil {
+			return
+		}
+		n = int64(uint16(length.Value))
+	case TagList:
+		return d.visitChildren("", TagList, skipVisitor{})
+	case TagCompound:
+		return d.visitChildren("", TagCompound, skipVisitor{})
+	default:
+		return fmt.Errorf("invalid NBT tag type %#x", byte(tagType))
+	}
+
+	_, err = io.CopyN(ioutil.Discard, &d.reader, n)
+	return
+}
+
+// skipVisitor skips all tags.
+type skipVisitor struct{}
+
+func (skipVisitor) Enter(path string, tagType TagType) VisitAction {
+	return VisitSkip
+}
+
+func (skipVisitor) Tag(path string, tag ITag) {
+}
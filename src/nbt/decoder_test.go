@@ -0,0 +1,134 @@
+package nbt
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testDecodeLimitError(t *testing.T, serialized string, limits Limits, limit string) {
+	_, err := NewDecoder(bytes.NewBufferString(serialized), limits).Decode()
+	limitErr, ok := err.(*LimitError)
+	if !ok {
+		t.Errorf("Expected LimitError for %s, got %v", limit, err)
+		return
+	}
+	if limitErr.Limit != limit {
+		t.Errorf("Expected %s limit to be exceeded, got %v", limit, err)
+	}
+}
+
+func Test_DecoderLimits(t *testing.T) {
+	// A list claiming 2^31-1 Longs in a tiny input.
+	hugeList := "\x0a\x00\x00\x09\x00\x01L\x04\x7f\xff\xff\xff"
+	testDecodeLimitError(t, hugeList, DefaultLimits, "List length")
+	testDecodeLimitError(t, hugeList, Limits{MaxSize: 1 << 20}, "size")
+
+	hugeArray := "\x0a\x00\x00\x07\x00\x01B\x00\xff\xff\xff"
+	testDecodeLimitError(t, hugeArray, Limits{MaxSize: 1 << 20}, "size")
+	testDecodeLimitError(t, hugeArray, Limits{MaxLength: 1000}, "ByteArray length")
+
+	// Compounds nested 4 deep (including the root).
+	nested := "\x0a\x00\x00" + strings.Repeat("\x0a\x00\x01n", 3) + strings.Repeat("\x00", 4)
+	if _, err := NewDecoder(bytes.NewBufferString(nested), Limits{MaxDepth: 4}).Decode(); err != nil {
+		t.Errorf("Unexpected error at depth limit: %v", err)
+	}
+	testDecodeLimitError(t, nested, Limits{MaxDepth: 3}, "depth")
+
+	// The total size is enforced as data is read, not only for arrays.
+	longString := "\x0a\x00\x00\x08\x00\x01S\x01\x00" + strings.Repeat("x", 256) + "\x00"
+	testDecodeLimitError(t, longString, Limits{MaxSize: 100}, "size")
+}
+
+func Test_DecoderMatchesRead(t *testing.T) {
+	serialized := "" +
+		"\x0a\x00\x00" +
+		"\x0a\x00\x05Level" +
+		"\x09\x00\x08Entities\x0a\x00\x00\x00\x01" +
+		"\x08\x00\x02id\x00\x03Pig" +
+		"\x00" +
+		"\x0b\x00\x09HeightMap\x00\x00\x00\x01\x00\x00\x00\x40" +
+		"\x00" +
+		"\x00"
+
+	expected, err := Read(bytes.NewBufferString(serialized))
+	if err != nil {
+		t.Fatalf("Read error: %v", err)
+	}
+
+	result, err := NewDecoder(bytes.NewBufferString(serialized), DefaultLimits).Decode()
+	if err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+
+	if !reflect.DeepEqual(expected, result) {
+		t.Errorf("Decode result %#v differs from Read result %#v", result, expected)
+	}
+}
+
+// arrayVisitor decodes the named tags within Level, and skips everything
+// else.
+type arrayVisitor struct {
+	wanted  map[string]bool
+	entered []string
+	tags    map[string]ITag
+}
+
+func (v *arrayVisitor) Enter(path string, tagType TagType) VisitAction {
+	v.entered = append(v.entered, path)
+	switch {
+	case path == "Level":
+		return VisitDescend
+	case v.wanted[path]:
+		return VisitDecode
+	}
+	return VisitSkip
+}
+
+func (v *arrayVisitor) Tag(path string, tag ITag) {
+	v.tags[path] = tag
+}
+
+func Test_DecoderVisit(t *testing.T) {
+	serialized := "" +
+		"\x0a\x00\x00" +
+		"\x0a\x00\x05Level" +
+		"\x07\x00\x06Blocks\x00\x00\x00\x02\x01\x02" +
+		"\x09\x00\x08Entities\x0a\x00\x00\x00\x02" +
+		"\x08\x00\x02id\x00\x03Pig\x00" +
+		"\x09\x00\x03Pos\x06\x00\x00\x00\x01\x3f\xf0\x00\x00\x00\x00\x00\x00\x00" +
+		"\x0b\x00\x09HeightMap\x00\x00\x00\x01\x00\x00\x00\x40" +
+		"\x08\x00\x04Name\x00\x02ab" +
+		"\x07\x00\x08SkyLight\x00\x00\x00\x01\x0f" +
+		"\x00" +
+		"\x03\x00\x05Other\x00\x00\x00\x01" +
+		"\x00"
+
+	visitor := &arrayVisitor{
+		wanted: map[string]bool{
+			"Level/Blocks":   true,
+			"Level/SkyLight": true,
+		},
+		tags: make(map[string]ITag),
+	}
+
+	if err := NewDecoder(bytes.NewBufferString(serialized), DefaultLimits).Visit(visitor); err != nil {
+		t.Fatalf("Visit error: %v", err)
+	}
+
+	expectedEntered := []string{
+		"Level", "Level/Blocks", "Level/Entities", "Level/HeightMap", "Level/Name", "Level/SkyLight", "Other",
+	}
+	if !reflect.DeepEqual(expectedEntered, visitor.entered) {
+		t.Errorf("Expected to enter %v, entered %v", expectedEntered, visitor.entered)
+	}
+
+	expectedTags := map[string]ITag{
+		"Level/Blocks":   &ByteArray{[]byte{1, 2}},
+		"Level/SkyLight": &ByteArray{[]byte{0x0f}},
+	}
+	if !reflect.DeepEqual(expectedTags, visitor.tags) {
+		t.Errorf("Expected tags %#v, got %#v", expectedTags, visitor.tags)
+	}
+}
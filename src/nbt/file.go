@@ -0,0 +1,63 @@
+package nbt
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ReadFile reads an NBT file that may be gzipped, zlib compressed or raw, and
+// returns the compression that it used, for writing it back the same way.
+func ReadFile(filename string) (tag *Compound, compression Compression, err error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	decompressed, compression, err := Decompress(file)
+	if err != nil {
+		return
+	}
+	defer decompressed.Close()
+
+	tag, err = NewDecoder(decompressed, DefaultLimits).Decode()
+	return
+}
+
+// WriteFileAtomic replaces the file with the tag, written with the given
+// compression. The data is written to a temporary file in the same directory
+// first and then renamed into place, so the file is never left partially
+// written. An existing file's permissions are kept.
+func WriteFileAtomic(filename string, tag *Compound, compression Compression) (err error) {
+	mode := os.FileMode(0666)
+	if info, statErr := os.Stat(filename); statErr == nil {
+		mode = info.Mode().Perm()
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(file.Name())
+		}
+	}()
+
+	err = WriteCompressed(file, tag, compression)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return
+	}
+
+	if err = os.Chmod(file.Name(), mode); err != nil {
+		return
+	}
+	return os.Rename(file.Name(), filename)
+}
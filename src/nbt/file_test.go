@@ -0,0 +1,170 @@
+package nbt
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_FileRoundTrip(t *testing.T) {
+	root := testJsonCompound()
+
+	for _, compression := range []Compression{CompressionNone, CompressionGzip, CompressionZlib} {
+		dir := t.TempDir()
+		filename := filepath.Join(dir, "level.dat")
+
+		// An existing file is replaced, keeping its permissions.
+		if err := ioutil.WriteFile(filename, []byte("old"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := WriteFileAtomic(filename, root, compression); err != nil {
+			t.Errorf("%v: WriteFileAtomic error: %v", compression, err)
+			continue
+		}
+
+		result, detected, err := ReadFile(filename)
+		if err != nil {
+			t.Errorf("%v: ReadFile error: %v", compression, err)
+			continue
+		}
+		if detected != compression {
+			t.Errorf("%v: read back as %v", compression, detected)
+		}
+		if !reflect.DeepEqual(root, result) {
+			t.Errorf("%v: expected %#v, got %#v", compression, root, result)
+		}
+
+		if info, err := os.Stat(filename); err != nil || info.Mode().Perm() != 0600 {
+			t.Errorf("%v: expected mode 0600, got %v, %v", compression, info.Mode(), err)
+		}
+		if entries, _ := ioutil.ReadDir(dir); len(entries) != 1 {
+			t.Errorf("%v: expected only the file to remain, got %d entries", compression, len(entries))
+		}
+	}
+}
+
+func Test_WriteFileAtomicFailure(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "level.dat")
+	if err := ioutil.WriteFile(filename, []byte("old"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// An unwritable tag leaves the existing file as it was.
+	bad := NewCompound()
+	bad.Set("List", &List{TagInt, []ITag{&Byte{1}}})
+	if err := WriteFileAtomic(filename, bad, CompressionGzip); err == nil {
+		t.Errorf("Expected error writing bad tag")
+	}
+
+	if data, _ := ioutil.ReadFile(filename); string(data) != "old" {
+		t.Errorf("Expected file to be unchanged, got %q", data)
+	}
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected temporary file to be removed, got %d entries", len(entries))
+	}
+}
+
+// testdata/spec/bigtest.nbt has the tags of the "bigtest.nbt" example
+// published with the NBT format specification, gzipped as the official client
+// and server write NBT files. It was assembled from the published description
+// of the file's tags, as a copy of the file itself couldn't be obtained, so
+// the order of the compounds' tags may differ from the original. The Level
+// compound, which is the root of the original, is within an unnamed root
+// compound as in level.dat and chunk files, as Read requires.
+func Test_ReadBigTest(t *testing.T) {
+	const filename = "testdata/spec/bigtest.nbt"
+
+	root, compression, err := ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compression != CompressionGzip {
+		t.Errorf("Expected gzip compression, got %v", compression)
+	}
+
+	level, ok := GetCompound(root, "Level")
+	if !ok {
+		t.Fatalf("Missing Level compound in %v", root)
+	}
+	if v, ok := GetLong(level, "longTest"); !ok || v != 9223372036854775807 {
+		t.Errorf("Bad longTest %v", level.Lookup("longTest"))
+	}
+	if v, ok := GetShort(level, "shortTest"); !ok || v != 32767 {
+		t.Errorf("Bad shortTest %v", level.Lookup("shortTest"))
+	}
+	if v, ok := GetInt(level, "intTest"); !ok || v != 2147483647 {
+		t.Errorf("Bad intTest %v", level.Lookup("intTest"))
+	}
+	if v, ok := GetByte(level, "byteTest"); !ok || v != 127 {
+		t.Errorf("Bad byteTest %v", level.Lookup("byteTest"))
+	}
+	if v, ok := GetFloat(level, "floatTest"); !ok || v != 0.49823147 {
+		t.Errorf("Bad floatTest %v", level.Lookup("floatTest"))
+	}
+	if v, ok := GetDouble(level, "doubleTest"); !ok || v != 0.4931287132182315 {
+		t.Errorf("Bad doubleTest %v", level.Lookup("doubleTest"))
+	}
+	if v, ok := GetString(level, "stringTest"); !ok || v != "HELLO WORLD THIS IS A TEST STRING \u00c5\u00c4\u00d6!" {
+		t.Errorf("Bad stringTest %v", level.Lookup("stringTest"))
+	}
+	if v, ok := GetString(level, "nested compound test/egg/name"); !ok || v != "Eggbert" {
+		t.Errorf("Bad egg name %v", level.Lookup("nested compound test/egg/name"))
+	}
+	if v, ok := GetFloat(level, "nested compound test/ham/value"); !ok || v != 0.75 {
+		t.Errorf("Bad ham value %v", level.Lookup("nested compound test/ham/value"))
+	}
+
+	if longs, ok := GetList(level, "listTest (long)", TagLong); !ok || len(longs.Value) != 5 {
+		t.Errorf("Bad listTest (long) %v", level.Lookup("listTest (long)"))
+	} else {
+		for i, tag := range longs.Value {
+			if tag.(*Long).Value != int64(11+i) {
+				t.Errorf("listTest (long)[%d] = %v, want %d", i, tag, 11+i)
+			}
+		}
+	}
+	if compounds, ok := GetList(level, "listTest (compound)", TagCompound); !ok || len(compounds.Value) != 2 {
+		t.Errorf("Bad listTest (compound) %v", level.Lookup("listTest (compound)"))
+	} else if v, ok := GetLong(compounds.Value[1], "created-on"); !ok || v != 1264099775885 {
+		t.Errorf("Bad created-on %v", compounds.Value[1].Lookup("created-on"))
+	}
+
+	const arrayName = "byteArrayTest (the first 1000 values of (n*n*255+n*7)%100, starting with n=0 (0, 62, 34, 16, 8, ...))"
+	array, ok := GetByteArray(level, arrayName)
+	if !ok || len(array) != 1000 {
+		t.Fatalf("Bad %s", arrayName)
+	}
+	for n, v := range array {
+		if want := byte((n*n*255 + n*7) % 100); v != want {
+			t.Errorf("byteArrayTest[%d] = %d, want %d", n, v, want)
+			break
+		}
+	}
+
+	// Writing the tags out again gives the same bytes.
+	file, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gzipReader, err := gzip.NewReader(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	uncompressed, err := ioutil.ReadAll(gzipReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	written := new(bytes.Buffer)
+	if err = Write(written, root); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(written.Bytes(), uncompressed) {
+		t.Errorf("Round trip output differs from the file")
+	}
+}
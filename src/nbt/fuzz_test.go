@@ -0,0 +1,195 @@
+package nbt
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// The corpus in testdata/corpus contains uncompressed NBT files in the style
+// of level.dat, chunk and player files, and is joined by the decompressed
+// files of testdata/spec. testdata/regress contains inputs that previously
+// caused panics or huge allocations.
+
+const (
+	fuzzIterations = 2000
+	// maxFuzzAlloc is the most that decoding a mutated input may allocate,
+	// beyond a multiple of its size.
+	maxFuzzAlloc = 1 << 20
+)
+
+func readTestFiles(t *testing.T, pattern string) map[string][]byte {
+	filenames, err := filepath.Glob(filepath.Join("testdata", pattern))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filenames) == 0 {
+		t.Fatalf("No test files match %s", pattern)
+	}
+
+	files := make(map[string][]byte)
+	for _, filename := range filenames {
+		if files[filename], err = ioutil.ReadFile(filename); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return files
+}
+
+// readFuzzCorpus returns the corpus of files to mutate.
+func readFuzzCorpus(t *testing.T) map[string][]byte {
+	corpus := readTestFiles(t, "corpus/*.nbt")
+	for name, data := range readTestFiles(t, "spec/*.nbt") {
+		gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if corpus[name], err = ioutil.ReadAll(gzipReader); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+	return corpus
+}
+
+// mutate returns a copy of data with a few random changes made to it.
+func mutate(rng *rand.Rand, data []byte) []byte {
+	data = append([]byte(nil), data...)
+
+	for n := 1 + rng.Intn(4); n > 0 && len(data) > 0; n-- {
+		i := rng.Intn(len(data))
+		switch rng.Intn(6) {
+		case 0: // Flip a bit.
+			data[i] ^= 1 << uint(rng.Intn(8))
+		case 1: // Set a byte to an interesting value.
+			data[i] = []byte{0x00, 0x01, 0x7f, 0x80, 0xff, 0x0a, 0x09}[rng.Intn(7)]
+		case 2: // Truncate.
+			data = data[:i]
+		case 3: // Delete a span.
+			j := i + rng.Intn(len(data)-i)
+			data = append(data[:i], data[j:]...)
+		case 4: // Duplicate a span.
+			j := i + rng.Intn(len(data)-i)
+			if j-i > 64 {
+				j = i + 64
+			}
+			span := append([]byte(nil), data[i:j]...)
+			data = append(data[:j], append(span, data[j:]...)...)
+		case 5: // Overwrite with a large length prefix.
+			if i+4 <= len(data) {
+				copy(data[i:], []byte{0x7f, 0xff, 0xff, byte(rng.Intn(256))})
+			}
+		}
+	}
+
+	return data
+}
+
+// checkDecode decodes data and checks that it does not panic or allocate too
+// much. If decoding succeeds, the result must survive being written and read
+// back. Any failure is reported with the input.
+func checkDecode(t *testing.T, name string, data []byte, limits Limits) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("%s: panic decoding %x: %v", name, data, r)
+		}
+	}()
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	root, err := NewDecoder(bytes.NewBuffer(data), limits).Decode()
+	runtime.ReadMemStats(&after)
+
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > uint64(64*len(data)+maxFuzzAlloc) {
+		t.Fatalf("%s: allocated %d bytes decoding %d bytes: %x", name, alloc, len(data), data)
+	}
+
+	if err != nil {
+		return
+	}
+
+	if err = checkRoundTrip(root); err != nil {
+		t.Fatalf("%s: %v for input %x", name, err, data)
+	}
+}
+
+// checkRoundTrip checks that root can be written and read back to get the
+// same structure, and that writing that produces the same bytes.
+func checkRoundTrip(root *Compound) error {
+	written := new(bytes.Buffer)
+	if err := Write(written, root); err != nil {
+		// Not all decodable structures can be written, e.g strings that are
+		// too long.
+		return nil
+	}
+
+	reread, err := Read(bytes.NewBuffer(written.Bytes()))
+	if err != nil {
+		return fmt.Errorf("error reading written data: %v", err)
+	}
+
+	rewritten := new(bytes.Buffer)
+	if err = Write(rewritten, reread); err != nil {
+		return fmt.Errorf("error rewriting: %v", err)
+	}
+
+	if !bytes.Equal(written.Bytes(), rewritten.Bytes()) {
+		return fmt.Errorf("rewritten data differs")
+	}
+
+	return nil
+}
+
+func Test_FuzzDecode(t *testing.T) {
+	corpus := readFuzzCorpus(t)
+	rng := rand.New(rand.NewSource(1))
+
+	for name, data := range corpus {
+		// Limit the size to that of the original input, plus some slack for
+		// mutations that duplicate data.
+		limits := DefaultLimits
+		limits.MaxSize = int64(len(data)) * 2
+
+		for i := 0; i < fuzzIterations; i++ {
+			checkDecode(t, name, mutate(rng, data), limits)
+		}
+	}
+}
+
+func Test_FuzzRegressions(t *testing.T) {
+	for name, data := range readTestFiles(t, "regress/*.nbt") {
+		// These must be handled even with no limits.
+		checkDecode(t, name, data, Limits{})
+		checkDecode(t, name, data, DefaultLimits)
+	}
+}
+
+func Test_GoldenRoundTrip(t *testing.T) {
+	for name, data := range readTestFiles(t, "corpus/*.nbt") {
+		root, err := Read(bytes.NewBuffer(data))
+		if err != nil {
+			t.Errorf("%s: Read error: %v", name, err)
+			continue
+		}
+
+		written := new(bytes.Buffer)
+		if err = Write(written, root); err != nil {
+			t.Errorf("%s: Write error: %v", name, err)
+			continue
+		}
+
+		if !bytes.Equal(data, written.Bytes()) {
+			t.Errorf("%s: round trip output differs from input", name)
+		}
+
+		reread, err := Read(written)
+		if err != nil || !reflect.DeepEqual(root, reread) {
+			t.Errorf("%s: re-reading written data gave %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,424 @@
+package nbt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JsonOptions control the JSON produced by ToJson.
+type JsonOptions struct {
+	// Typed annotates every tag with its type, so that the JSON can be
+	// converted back to identical NBT with FromJson. Otherwise compounds
+	// become objects, lists and arrays become arrays, and numbers and strings
+	// become JSON numbers and strings.
+	Typed bool
+
+	// ByteArraysAsInts writes ByteArrays as arrays of integers rather than
+	// base64 strings.
+	ByteArraysAsInts bool
+
+	// SortKeys writes compound tags sorted by name, rather than in the order
+	// that they were read in (e.g for diffing files from different sources).
+	SortKeys bool
+
+	// Indent, if not empty, is used to indent the output.
+	Indent string
+}
+
+// In the typed form, every tag is an object with "type" and "value" members.
+// Lists also have an "elementType" member. For example, a Compound containing
+// a List of Doubles:
+//
+//   {"type":"Compound","value":{"Pos":{"type":"List","elementType":"Double",
+//     "value":[{"type":"Double","value":1.5}]}}}
+//
+// Floats and Doubles that are NaN or infinite are written as the strings
+// "NaN", "Infinity" and "-Infinity".
+
+// ToJson converts the tag to JSON.
+func ToJson(tag ITag, options JsonOptions) (result []byte, err error) {
+	buf := new(bytes.Buffer)
+	if err = writeJson(buf, tag, &options); err != nil {
+		return
+	}
+
+	if options.Indent == "" {
+		return buf.Bytes(), nil
+	}
+
+	indented := new(bytes.Buffer)
+	if err = json.Indent(indented, buf.Bytes(), "", options.Indent); err != nil {
+		return
+	}
+	return indented.Bytes(), nil
+}
+
+// jsonTypeName returns the name of the tag type as used in typed JSON.
+func jsonTypeName(tagType TagType) string {
+	return strings.TrimPrefix(tagType.String(), "Tag")
+}
+
+func jsonTagType(name string) (tagType TagType, err error) {
+	for i, typeName := range tagTypeNames {
+		if typeName == "Tag"+name {
+			return TagType(i), nil
+		}
+	}
+	return TagEnd, fmt.Errorf("nbt: unknown tag type %q in JSON", name)
+}
+
+func writeJsonString(buf *bytes.Buffer, s string) {
+	// json.Marshal of a string cannot fail.
+	encoded, _ := json.Marshal(s)
+	buf.Write(encoded)
+}
+
+func writeJsonFloat(buf *bytes.Buffer, v float64, bitSize int) {
+	switch {
+	case math.IsNaN(v):
+		buf.WriteString(`"NaN"`)
+	case math.IsInf(v, 1):
+		buf.WriteString(`"Infinity"`)
+	case math.IsInf(v, -1):
+		buf.WriteString(`"-Infinity"`)
+	default:
+		buf.WriteString(strconv.FormatFloat(v, 'g', -1, bitSize))
+	}
+}
+
+func writeJson(buf *bytes.Buffer, tag ITag, options *JsonOptions) (err error) {
+	if options.Typed {
+		buf.WriteString(`{"type":`)
+		writeJsonString(buf, jsonTypeName(tag.Type()))
+		if list, ok := tag.(*List); ok {
+			buf.WriteString(`,"elementType":`)
+			writeJsonString(buf, jsonTypeName(list.TagType))
+		}
+		buf.WriteString(`,"value":`)
+	}
+
+	switch t := tag.(type) {
+	case *Byte:
+		buf.WriteString(strconv.FormatInt(int64(t.Value), 10))
+	case *Short:
+		buf.WriteString(strconv.FormatInt(int64(t.Value), 10))
+	case *Int:
+		buf.WriteString(strconv.FormatInt(int64(t.Value), 10))
+	case *Long:
+		buf.WriteString(strconv.FormatInt(t.Value, 10))
+	case *Float:
+		writeJsonFloat(buf, float64(t.Value), 32)
+	case *Double:
+		writeJsonFloat(buf, t.Value, 64)
+	case *String:
+		writeJsonString(buf, t.Value)
+	case *ByteArray:
+		if options.ByteArraysAsInts {
+			buf.WriteByte('[')
+			for i, v := range t.Value {
+				if i > 0 {
+					buf.WriteByte(',')
+				}
+				buf.WriteString(strconv.Itoa(int(int8(v))))
+			}
+			buf.WriteByte(']')
+		} else {
+			writeJsonString(buf, base64.StdEncoding.EncodeToString(t.Value))
+		}
+	case *IntArray:
+		buf.WriteByte('[')
+		for i, v := range t.Value {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(strconv.FormatInt(int64(v), 10))
+		}
+		buf.WriteByte(']')
+	case *List:
+		buf.WriteByte('[')
+		for i, v := range t.Value {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err = writeJson(buf, v, options); err != nil {
+				return
+			}
+		}
+		buf.WriteByte(']')
+	case *Compound:
+		names := t.names()
+		if options.SortKeys {
+			sort.Strings(names)
+		}
+		buf.WriteByte('{')
+		for i, name := range names {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJsonString(buf, name)
+			buf.WriteByte(':')
+			if err = writeJson(buf, t.Tags[name], options); err != nil {
+				return
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("nbt: cannot convert %T to JSON", tag)
+	}
+
+	if options.Typed {
+		buf.WriteByte('}')
+	}
+
+	return
+}
+
+// jsonObject is a JSON object with the order of its members preserved.
+type jsonObject struct {
+	names  []string
+	values map[string]interface{}
+}
+
+// readJsonValue reads a JSON value as one of: jsonObject, []interface{},
+// string, json.Number, bool or nil.
+func readJsonValue(decoder *json.Decoder) (value interface{}, err error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return
+	}
+
+	switch token {
+	case json.Delim('{'):
+		obj := jsonObject{values: make(map[string]interface{})}
+		for decoder.More() {
+			var nameToken json.Token
+			if nameToken, err = decoder.Token(); err != nil {
+				return
+			}
+			name := nameToken.(string)
+			var v interface{}
+			if v, err = readJsonValue(decoder); err != nil {
+				return
+			}
+			if _, exists := obj.values[name]; !exists {
+				obj.names = append(obj.names, name)
+			}
+			obj.values[name] = v
+		}
+		_, err = decoder.Token() // '}'
+		return obj, err
+	case json.Delim('['):
+		array := []interface{}{}
+		for decoder.More() {
+			var v interface{}
+			if v, err = readJsonValue(decoder); err != nil {
+				return
+			}
+			array = append(array, v)
+		}
+		_, err = decoder.Token() // ']'
+		return array, err
+	}
+
+	return token, nil
+}
+
+// FromJson converts JSON in the typed form written by ToJson back into a
+// tag.
+func FromJson(data []byte) (tag ITag, err error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	value, err := readJsonValue(decoder)
+	if err != nil {
+		return
+	}
+
+	if _, err = decoder.Token(); err != io.EOF {
+		return nil, errors.New("nbt: unexpected data after JSON value")
+	}
+
+	return tagFromJson(value)
+}
+
+func jsonInt(value interface{}, bitSize int) (v int64, err error) {
+	number, ok := value.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("nbt: expected integer in JSON, got %#v", value)
+	}
+	return strconv.ParseInt(string(number), 10, bitSize)
+}
+
+func jsonFloat(value interface{}, bitSize int) (v float64, err error) {
+	switch t := value.(type) {
+	case json.Number:
+		return strconv.ParseFloat(string(t), bitSize)
+	case string:
+		switch t {
+		case "NaN":
+			return math.NaN(), nil
+		case "Infinity":
+			return math.Inf(1), nil
+		case "-Infinity":
+			return math.Inf(-1), nil
+		}
+	}
+	return 0, fmt.Errorf("nbt: expected number in JSON, got %#v", value)
+}
+
+func tagFromJson(value interface{}) (tag ITag, err error) {
+	obj, ok := value.(jsonObject)
+	if !ok {
+		return nil, fmt.Errorf("nbt: expected typed tag object in JSON, got %#v", value)
+	}
+
+	typeName, ok := obj.values["type"].(string)
+	if !ok {
+		return nil, errors.New("nbt: missing type in JSON tag")
+	}
+	tagType, err := jsonTagType(typeName)
+	if err != nil {
+		return
+	}
+
+	v, ok := obj.values["value"]
+	if !ok {
+		return nil, errors.New("nbt: missing value in JSON tag")
+	}
+
+	var i int64
+	var f float64
+
+	switch tagType {
+	case TagByte:
+		i, err = jsonInt(v, 8)
+		tag = &Byte{int8(i)}
+	case TagShort:
+		i, err = jsonInt(v, 16)
+		tag = &Short{int16(i)}
+	case TagInt:
+		i, err = jsonInt(v, 32)
+		tag = &Int{int32(i)}
+	case TagLong:
+		i, err = jsonInt(v, 64)
+		tag = &Long{i}
+	case TagFloat:
+		f, err = jsonFloat(v, 32)
+		tag = &Float{float32(f)}
+	case TagDouble:
+		f, err = jsonFloat(v, 64)
+		tag = &Double{f}
+	case TagString:
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("nbt: expected string in JSON, got %#v", v)
+		}
+		tag = &String{s}
+	case TagByteArray:
+		tag, err = byteArrayFromJson(v)
+	case TagIntArray:
+		tag, err = intArrayFromJson(v)
+	case TagList:
+		tag, err = listFromJson(obj, v)
+	case TagCompound:
+		tag, err = compoundFromJson(v)
+	default:
+		err = fmt.Errorf("nbt: unexpected %v in JSON", tagType)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+func byteArrayFromJson(v interface{}) (tag ITag, err error) {
+	switch t := v.(type) {
+	case string:
+		var bs []byte
+		if bs, err = base64.StdEncoding.DecodeString(t); err != nil {
+			return
+		}
+		return &ByteArray{bs}, nil
+	case []interface{}:
+		bs := make([]byte, len(t))
+		for i, elem := range t {
+			var b int64
+			if b, err = jsonInt(elem, 8); err != nil {
+				return
+			}
+			bs[i] = byte(b)
+		}
+		return &ByteArray{bs}, nil
+	}
+	return nil, fmt.Errorf("nbt: expected base64 string or array for ByteArray in JSON, got %#v", v)
+}
+
+func intArrayFromJson(v interface{}) (tag ITag, err error) {
+	array, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("nbt: expected array for IntArray in JSON, got %#v", v)
+	}
+
+	ints := make([]int32, len(array))
+	for i, elem := range array {
+		var n int64
+		if n, err = jsonInt(elem, 32); err != nil {
+			return
+		}
+		ints[i] = int32(n)
+	}
+	return &IntArray{ints}, nil
+}
+
+func listFromJson(obj jsonObject, v interface{}) (tag ITag, err error) {
+	elemTypeName, ok := obj.values["elementType"].(string)
+	if !ok {
+		return nil, errors.New("nbt: missing elementType in JSON List")
+	}
+	elemType, err := jsonTagType(elemTypeName)
+	if err != nil {
+		return
+	}
+
+	array, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("nbt: expected array for List in JSON, got %#v", v)
+	}
+
+	list := &List{elemType, make([]ITag, len(array))}
+	for i, elem := range array {
+		if list.Value[i], err = tagFromJson(elem); err != nil {
+			return
+		}
+		if list.Value[i].Type() != elemType {
+			return nil, fmt.Errorf("nbt: %v in List of %v in JSON", list.Value[i].Type(), elemType)
+		}
+	}
+	return list, nil
+}
+
+func compoundFromJson(v interface{}) (tag ITag, err error) {
+	obj, ok := v.(jsonObject)
+	if !ok {
+		return nil, fmt.Errorf("nbt: expected object for Compound in JSON, got %#v", v)
+	}
+
+	compound := NewCompound()
+	for _, name := range obj.names {
+		var child ITag
+		if child, err = tagFromJson(obj.values[name]); err != nil {
+			return
+		}
+		compound.setChild(name, child)
+	}
+	return compound, nil
+}
@@ -0,0 +1,137 @@
+package nbt
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func testJsonCompound() *Compound {
+	root, _ := NewBuilder().
+		PutCompound("Data", NewBuilder().
+			PutInt("SpawnX", -16).
+			PutLong("Time", 24000).
+			PutString("LevelName", "my \"world\"").
+			PutByteArray("Blocks", []byte{1, 0xff}).
+			PutIntArray("HeightMap", []int32{64, 65}).
+			PutDoubleList("Pos", 1.5, -2).
+			PutFloat("Bad", float32(math.Inf(-1))).
+			PutList("Empty", TagByte)).
+		Build()
+	return root
+}
+
+func Test_ToJson(t *testing.T) {
+	tests := []struct {
+		options  JsonOptions
+		expected string
+	}{
+		{
+			JsonOptions{},
+			`{"Data":{"SpawnX":-16,"Time":24000,"LevelName":"my \"world\"","Blocks":"Af8=",` +
+				`"HeightMap":[64,65],"Pos":[1.5,-2],"Bad":"-Infinity","Empty":[]}}`,
+		},
+		{
+			JsonOptions{ByteArraysAsInts: true, SortKeys: true},
+			`{"Data":{"Bad":"-Infinity","Blocks":[1,-1],"Empty":[],"HeightMap":[64,65],` +
+				`"LevelName":"my \"world\"","Pos":[1.5,-2],"SpawnX":-16,"Time":24000}}`,
+		},
+		{
+			JsonOptions{Typed: true},
+			`{"type":"Compound","value":{"Data":{"type":"Compound","value":{` +
+				`"SpawnX":{"type":"Int","value":-16},` +
+				`"Time":{"type":"Long","value":24000},` +
+				`"LevelName":{"type":"String","value":"my \"world\""},` +
+				`"Blocks":{"type":"ByteArray","value":"Af8="},` +
+				`"HeightMap":{"type":"IntArray","value":[64,65]},` +
+				`"Pos":{"type":"List","elementType":"Double","value":[{"type":"Double","value":1.5},{"type":"Double","value":-2}]},` +
+				`"Bad":{"type":"Float","value":"-Infinity"},` +
+				`"Empty":{"type":"List","elementType":"Byte","value":[]}}}}}`,
+		},
+	}
+
+	for _, test := range tests {
+		result, err := ToJson(testJsonCompound(), test.options)
+		if err != nil {
+			t.Errorf("ToJson(%+v) error: %v", test.options, err)
+			continue
+		}
+		if string(result) != test.expected {
+			t.Errorf("ToJson(%+v):\n  expected %s\n  got      %s", test.options, test.expected, result)
+		}
+	}
+}
+
+// checkJsonRoundTrip converts the tag to typed JSON and back, and checks
+// that the NBT written for both is identical.
+func checkJsonRoundTrip(t *testing.T, name string, tag *Compound, options JsonOptions) {
+	options.Typed = true
+	data, err := ToJson(tag, options)
+	if err != nil {
+		t.Errorf("%s: ToJson error: %v", name, err)
+		return
+	}
+
+	result, err := FromJson(data)
+	if err != nil {
+		t.Errorf("%s: FromJson error: %v", name, err)
+		return
+	}
+
+	resultCompound, ok := result.(*Compound)
+	if !ok {
+		t.Errorf("%s: FromJson returned %T", name, result)
+		return
+	}
+
+	expected, written := new(bytes.Buffer), new(bytes.Buffer)
+	if err = Write(expected, tag); err != nil {
+		t.Fatal(err)
+	}
+	if err = Write(written, resultCompound); err != nil {
+		t.Errorf("%s: Write error: %v", name, err)
+		return
+	}
+
+	if !bytes.Equal(expected.Bytes(), written.Bytes()) {
+		t.Errorf("%s: NBT differs after round trip through JSON %s", name, data)
+	}
+}
+
+func Test_JsonRoundTrip(t *testing.T) {
+	checkJsonRoundTrip(t, "test compound", testJsonCompound(), JsonOptions{})
+	checkJsonRoundTrip(t, "test compound (ints)", testJsonCompound(), JsonOptions{ByteArraysAsInts: true})
+	checkJsonRoundTrip(t, "test compound (indented)", testJsonCompound(), JsonOptions{Indent: "  "})
+
+	for name, data := range readTestFiles(t, "corpus/*.nbt") {
+		root, err := Read(bytes.NewBuffer(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkJsonRoundTrip(t, name, root, JsonOptions{})
+	}
+}
+
+func Test_FromJsonErrors(t *testing.T) {
+	tests := []string{
+		``,
+		`{"type":"Int"}`,
+		`{"value":1}`,
+		`{"type":"Nope","value":1}`,
+		`{"type":"Byte","value":300}`,
+		`{"type":"Int","value":1.5}`,
+		`{"type":"String","value":1}`,
+		`{"type":"ByteArray","value":"!!"}`,
+		`{"type":"List","value":[]}`,
+		`{"type":"List","elementType":"Int","value":[{"type":"Byte","value":1}]}`,
+		`{"type":"Compound","value":{"a":1}}`,
+		`{"type":"Int","value":1} 2`,
+		`[1]`,
+	}
+
+	for _, test := range tests {
+		if tag, err := FromJson([]byte(test)); err == nil {
+			t.Errorf("Expected error for %s, got %#v", test, tag)
+		}
+	}
+}
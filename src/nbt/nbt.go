@@ -8,9 +8,9 @@
 // An NBT data structure can be created with code such as the following:
 //
 //   root := &Compound{
-//     map[string]ITag{
+//     Tags: map[string]ITag{
 //       "Data": &Compound{
-//         map[string]ITag{
+//         Tags: map[string]ITag{
 //           "Byte":   &Byte{1},
 //           "Short":  &Short{2},
 //           "Int":    &Int{3},
@@ -27,15 +27,20 @@
 // It is required that the root structure be a Compound for compatibility with
 // existing NBT structures observed in the official server.
 //
-// NBT structures can be read from an io.Reader with the Read function.
+// NBT structures can be read from an io.Reader with the Read function, and
+// written to an io.Writer with the Write function. Compound tags remember the
+// order that their tags were read in, so that a structure that is read and
+// then written back out produces identical output.
 package nbt
 
 import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
+	"sort"
+	"strconv"
 	"strings"
-	"errors"
 )
 
 // ITag is the interface for all tags that can be represented in an NBT tree.
@@ -43,6 +48,10 @@ type ITag interface {
 	Type() TagType
 	Read(io.Reader) error
 	Write(io.Writer) error
+
+	// Lookup returns the tag at the "/" separated path within this one, or
+	// nil if there is none. Path components name the tags in compounds, and
+	// index the elements of lists (e.g "Inventory/0/id").
 	Lookup(path string) ITag
 }
 
@@ -63,6 +72,7 @@ const (
 	TagString    = TagType(8)
 	TagList      = TagType(9)
 	TagCompound  = TagType(10)
+	TagIntArray  = TagType(11)
 )
 
 // NewTag creates a new tag of the given TagType. TagEnd is not a valid value
@@ -89,12 +99,36 @@ func (tt TagType) NewTag() (tag ITag, err error) {
 		tag = new(List)
 	case TagCompound:
 		tag = new(Compound)
+	case TagIntArray:
+		tag = new(IntArray)
 	default:
-		err = fmt.Errorf("invalid NBT tag type %#x", tt)
+		err = fmt.Errorf("invalid NBT tag type %#x", byte(tt))
 	}
 	return
 }
 
+var tagTypeNames = []string{
+	"TagEnd",
+	"TagByte",
+	"TagShort",
+	"TagInt",
+	"TagLong",
+	"TagFloat",
+	"TagDouble",
+	"TagByteArray",
+	"TagString",
+	"TagList",
+	"TagCompound",
+	"TagIntArray",
+}
+
+func (tt TagType) String() string {
+	if int(tt) < len(tagTypeNames) {
+		return tagTypeNames[tt]
+	}
+	return fmt.Sprintf("TagType(%d)", byte(tt))
+}
+
 func (tt *TagType) read(reader io.Reader) error {
 	return binary.Read(reader, binary.BigEndian, tt)
 }
@@ -232,35 +266,47 @@ func (*ByteArray) Type() TagType {
 }
 
 func (b *ByteArray) Read(reader io.Reader) (err error) {
-	var length Int
+	return newUnlimitedDecoder(reader).readByteArray(b)
+}
 
-	err = length.Read(reader)
-	if err != nil {
-		return
-	}
+func (b *ByteArray) Write(writer io.Writer) (err error) {
+	length := Int{int32(len(b.Value))}
 
-	bs := make([]byte, length.Value)
-	_, err = io.ReadFull(reader, bs)
-	if err != nil {
+	if err = length.Write(writer); err != nil {
 		return
 	}
 
-	b.Value = bs
+	_, err = writer.Write(b.Value)
 	return
 }
 
-func (b *ByteArray) Write(writer io.Writer) (err error) {
-	length := Int{int32(len(b.Value))}
+func (*ByteArray) Lookup(path string) ITag {
+	return nil
+}
+
+type IntArray struct {
+	Value []int32
+}
+
+func (*IntArray) Type() TagType {
+	return TagIntArray
+}
+
+func (a *IntArray) Read(reader io.Reader) (err error) {
+	return newUnlimitedDecoder(reader).readIntArray(a)
+}
+
+func (a *IntArray) Write(writer io.Writer) (err error) {
+	length := Int{int32(len(a.Value))}
 
 	if err = length.Write(writer); err != nil {
 		return
 	}
 
-	_, err = writer.Write(b.Value)
-	return
+	return binary.Write(writer, binary.BigEndian, a.Value)
 }
 
-func (*ByteArray) Lookup(path string) ITag {
+func (*IntArray) Lookup(path string) ITag {
 	return nil
 }
 
@@ -273,14 +319,16 @@ func (*String) Type() TagType {
 }
 
 func (s *String) Read(reader io.Reader) (err error) {
-	var length Short
+	// The length prefix is the unsigned length of the UTF-8 encoded string in
+	// bytes.
+	var length uint16
 
-	err = length.Read(reader)
+	err = binary.Read(reader, binary.BigEndian, &length)
 	if err != nil {
 		return
 	}
 
-	bs := make([]byte, length.Value)
+	bs := make([]byte, length)
 	_, err = io.ReadFull(reader, bs)
 	if err != nil {
 		return
@@ -291,13 +339,15 @@ func (s *String) Read(reader io.Reader) (err error) {
 }
 
 func (s *String) Write(writer io.Writer) (err error) {
-	length := Short{int16(len(s.Value))}
+	if len(s.Value) > math.MaxUint16 {
+		return fmt.Errorf("String too long to write (%d bytes)", len(s.Value))
+	}
 
-	if err = length.Write(writer); err != nil {
+	if err = binary.Write(writer, binary.BigEndian, uint16(len(s.Value))); err != nil {
 		return
 	}
 
-	_, err = writer.Write([]byte(s.Value))
+	_, err = io.WriteString(writer, s.Value)
 	return
 }
 
@@ -315,35 +365,20 @@ func (*List) Type() TagType {
 }
 
 func (l *List) Read(reader io.Reader) (err error) {
-	if err = l.TagType.read(reader); err != nil {
-		return
-	}
-
-	var length Int
-	err = length.Read(reader)
-	if err != nil {
-		return
-	}
+	return newUnlimitedDecoder(reader).readList(l)
+}
 
-	list := make([]ITag, length.Value)
-	for i, _ := range list {
-		var tag ITag
-		if tag, err = l.TagType.NewTag(); err != nil {
-			return
-		}
-		err = tag.Read(reader)
-		if err != nil {
-			return
+// Write writes the list. The element type is written as given in TagType
+// even if the list is empty (the official server often writes empty lists
+// with an element type of TagEnd or TagByte), so that it is preserved when
+// writing back a list that was read.
+func (l *List) Write(writer io.Writer) (err error) {
+	for _, tag := range l.Value {
+		if tag.Type() != l.TagType {
+			return fmt.Errorf("List of %v contains tag of type %v", l.TagType, tag.Type())
 		}
-
-		list[i] = tag
 	}
 
-	l.Value = list
-	return
-}
-
-func (l *List) Write(writer io.Writer) (err error) {
 	tagType := Byte{int8(l.TagType)}
 	if err = tagType.Write(writer); err != nil {
 		return
@@ -363,12 +398,32 @@ func (l *List) Write(writer io.Writer) (err error) {
 	return
 }
 
-func (*List) Lookup(path string) ITag {
-	return nil
+func (l *List) Lookup(path string) ITag {
+	if l == nil {
+		return nil
+	}
+
+	components := strings.SplitN(path, "/", 2)
+	index, err := strconv.Atoi(components[0])
+	if err != nil || index < 0 || index >= len(l.Value) {
+		return nil
+	}
+	tag := l.Value[index]
+
+	if len(components) >= 2 {
+		return tag.Lookup(components[1])
+	}
+
+	return tag
 }
 
 type Compound struct {
 	Tags map[string]ITag
+
+	// order records the order of tag names as read or added, so that
+	// they can be written back out in that order. Any tags in Tags that are
+	// not in order are written afterwards in sorted order.
+	order []string
 }
 
 func NewCompound() *Compound {
@@ -381,70 +436,55 @@ func (*Compound) Type() TagType {
 	return TagCompound
 }
 
-func readTagAndName(reader io.Reader) (tag ITag, name string, err error) {
-	var tagType TagType
-	if tagType.read(reader); err != nil {
-		return
-	}
+func (c *Compound) Read(reader io.Reader) (err error) {
+	return newUnlimitedDecoder(reader).readCompound(c)
+}
 
-	if tagType == TagEnd {
+func writeTagAndName(writer io.Writer, tag ITag, name string) (err error) {
+	if err = tag.Type().write(writer); err != nil {
 		return
 	}
 
-	var nameTag String
-	if err = nameTag.Read(reader); err != nil {
+	nameTag := String{name}
+	if err = nameTag.Write(writer); err != nil {
 		return
 	}
 
-	name = nameTag.Value
-
-	if tag, err = tagType.NewTag(); err != nil {
-		return
-	}
-	err = tag.Read(reader)
+	err = tag.Write(writer)
 
 	return
 }
 
-func (c *Compound) Read(reader io.Reader) (err error) {
-	tags := make(map[string]ITag)
-	var tag ITag
-	var tagName string
-
-	for {
-		if tag, tagName, err = readTagAndName(reader); err != nil {
-			return
-		}
+// names returns the names of the tags in the compound in the order that they
+// should be written.
+func (c *Compound) names() []string {
+	names := make([]string, 0, len(c.Tags))
+	seen := make(map[string]bool, len(c.Tags))
 
-		if tag == nil {
-			break
+	for _, name := range c.order {
+		if _, ok := c.Tags[name]; ok && !seen[name] {
+			names = append(names, name)
+			seen[name] = true
 		}
-
-		tags[tagName] = tag
 	}
 
-	c.Tags = tags
-	return
-}
-
-func writeTagAndName(writer io.Writer, tag ITag, name string) (err error) {
-	if err = tag.Type().write(writer); err != nil {
-		return
-	}
-
-	nameTag := String{name}
-	if err = nameTag.Write(writer); err != nil {
-		return
+	if len(names) < len(c.Tags) {
+		var unordered []string
+		for name := range c.Tags {
+			if !seen[name] {
+				unordered = append(unordered, name)
+			}
+		}
+		sort.Strings(unordered)
+		names = append(names, unordered...)
 	}
 
-	err = tag.Write(writer)
-
-	return
+	return names
 }
 
 func (c *Compound) Write(writer io.Writer) (err error) {
-	for name, tag := range c.Tags {
-		if err = writeTagAndName(writer, tag, name); err != nil {
+	for _, name := range c.names() {
+		if err = writeTagAndName(writer, c.Tags[name], name); err != nil {
 			return
 		}
 	}
@@ -455,6 +495,10 @@ func (c *Compound) Write(writer io.Writer) (err error) {
 }
 
 func (c *Compound) Lookup(path string) (tag ITag) {
+	if c == nil {
+		return nil
+	}
+
 	components := strings.SplitN(path, "/", 2)
 	tag, ok := c.Tags[components[0]]
 	if !ok {
@@ -468,30 +512,22 @@ func (c *Compound) Lookup(path string) (tag ITag) {
 	return tag
 }
 
-func (c *Compound) Set(key string, tag ITag) {
-	c.Tags[key] = tag
-}
-
-// Read reads an NBT compound from the given reader.
-func Read(reader io.Reader) (tag *Compound, err error) {
-	var itag ITag
-	var name string
-	if itag, name, err = readTagAndName(reader); err != nil {
-		return nil, err
+// setChild sets the tag with the given name directly within the compound.
+// Unlike Set, the name is not treated as a path.
+func (c *Compound) setChild(name string, tag ITag) {
+	if c.Tags == nil {
+		c.Tags = make(map[string]ITag)
 	}
-
-	if name != "" {
-		return nil, errors.New("root name should be empty")
-	} else if itag == nil {
-		return nil, errors.New("end tag found at top level")
-	}
-
-	tag, ok := itag.(*Compound)
-	if !ok {
-		return nil, errors.New("expected compound at top level")
+	if _, exists := c.Tags[name]; !exists {
+		c.order = append(c.order, name)
 	}
+	c.Tags[name] = tag
+}
 
-	return tag, nil
+// Read reads an NBT compound from the given reader. No limits are applied to
+// the data, so a Decoder should be used instead for untrusted input.
+func Read(reader io.Reader) (tag *Compound, err error) {
+	return newUnlimitedDecoder(reader).Decode()
 }
 
 // Write writes an NBT compound to the given writer.
@@ -9,6 +9,22 @@ import (
 	te "testencoding"
 )
 
+// clearOrder removes the record of tag order from compounds, so that tags
+// read can be compared with literal structures using reflect.DeepEqual.
+func clearOrder(tag ITag) {
+	switch tag := tag.(type) {
+	case *Compound:
+		tag.order = nil
+		for _, child := range tag.Tags {
+			clearOrder(child)
+		}
+	case *List:
+		for _, child := range tag.Value {
+			clearOrder(child)
+		}
+	}
+}
+
 type Test struct {
 	Serialized te.IBytesMatcher
 	Value      ITag
@@ -36,6 +52,7 @@ func (test *Test) testRead(t *testing.T) {
 		return
 	}
 
+	clearOrder(result)
 	if !reflect.DeepEqual(test.Value, result) {
 		t.Errorf("  Fail: got result = %T%v", result, result)
 	}
@@ -71,6 +88,15 @@ func TestSerialization(t *testing.T) {
 		{te.LiteralString("\x00\x03foo"), &String{"foo"}},
 		{te.LiteralString("\x01\x00\x00\x00\x02\x01\x02"), &List{TagByte, []ITag{&Byte{1}, &Byte{2}}}},
 		{te.LiteralString("\x03\x00\x00\x00\x02\x00\x00\x00\x01\x00\x00\x00\x02"), &List{TagInt, []ITag{&Int{1}, &Int{2}}}},
+		{te.LiteralString("\x00\x00\x00\x02\x00\x00\x00\x01\xff\xff\xff\xfe"), &IntArray{[]int32{1, -2}}},
+		{te.LiteralString("\x00\x00\x00\x00"), &IntArray{[]int32{}}},
+		{
+			// List of IntArray.
+			te.LiteralString("\x0b\x00\x00\x00\x02" +
+				"\x00\x00\x00\x01\x00\x00\x00\x07" +
+				"\x00\x00\x00\x00"),
+			&List{TagIntArray, []ITag{&IntArray{[]int32{7}}, &IntArray{[]int32{}}}},
+		},
 
 		{
 			// Single item Compound.
@@ -79,7 +105,7 @@ func TestSerialization(t *testing.T) {
 				te.LiteralString("\x00"),                // End
 			),
 			&Compound{
-				map[string]ITag{
+				Tags: map[string]ITag{
 					"foo": &Byte{1},
 				},
 			},
@@ -108,7 +134,7 @@ func TestSerialization(t *testing.T) {
 				te.LiteralString("\x00"), // End
 			),
 			&Compound{
-				map[string]ITag{
+				Tags: map[string]ITag{
 					"Byte":   &Byte{1},
 					"Short":  &Short{2},
 					"Int":    &Int{3},
@@ -130,9 +156,9 @@ func TestSerialization(t *testing.T) {
 
 func Test_ReadAndWrite(t *testing.T) {
 	compound := &Compound{
-		map[string]ITag{
+		Tags: map[string]ITag{
 			"Data": &Compound{
-				map[string]ITag{
+				Tags: map[string]ITag{
 					"Byte": &Byte{5},
 				},
 			},
@@ -152,6 +178,7 @@ func Test_ReadAndWrite(t *testing.T) {
 		t.Fatalf("Got Read error: %v", err)
 	}
 
+	clearOrder(result)
 	if !reflect.DeepEqual(compound, result) {
 		t.Errorf("Got unexpected result: %#v", result)
 	}
@@ -171,9 +198,9 @@ func Test_ReadAndWrite(t *testing.T) {
 
 func Test_Lookup(t *testing.T) {
 	root := &Compound{
-		map[string]ITag{
+		Tags: map[string]ITag{
 			"Data": &Compound{
-				map[string]ITag{
+				Tags: map[string]ITag{
 					"Byte":   &Byte{1},
 					"Short":  &Short{2},
 					"Int":    &Int{3},
@@ -213,3 +240,169 @@ func Test_Lookup(t *testing.T) {
 		t.Fatalf("Failed to look up Byte, got: %#v", tag)
 	}
 }
+
+// roundTrip reads the serialized NBT and checks that writing it back out
+// produces identical output.
+func roundTrip(t *testing.T, serialized []byte) *Compound {
+	root, err := Read(bytes.NewBuffer(serialized))
+	if err != nil {
+		t.Fatalf("Got Read error: %v", err)
+	}
+
+	writer := new(bytes.Buffer)
+	if err = Write(writer, root); err != nil {
+		t.Fatalf("Got Write error: %v", err)
+	}
+
+	if !bytes.Equal(serialized, writer.Bytes()) {
+		t.Errorf("Round trip output differs:\n  input:  %x\n  output: %x", serialized, writer.Bytes())
+	}
+
+	return root
+}
+
+func Test_RoundTripLevelData(t *testing.T) {
+	// Level data in the order that the official server writes it (which is
+	// not sorted).
+	serialized := []byte("" +
+		"\x0a\x00\x00" +
+		"\x0a\x00\x04Data" +
+		"\x03\x00\x0bthunderTime\x00\x01\x86\xa0" +
+		"\x04\x00\x0aLastPlayed\x00\x00\x01\x30\x00\x00\x00\x00" +
+		"\x04\x00\x0aRandomSeed\xff\xff\xff\xff\xff\xff\xff\xfe" +
+		"\x03\x00\x07version\x00\x00\x4a\xbc" +
+		"\x04\x00\x04Time\x00\x00\x00\x00\x00\x00\x5d\xc0" +
+		"\x01\x00\x07raining\x00" +
+		"\x03\x00\x06SpawnX\xff\xff\xff\xf0" +
+		"\x03\x00\x06SpawnY\x00\x00\x00\x40" +
+		"\x03\x00\x06SpawnZ\x00\x00\x00\x20" +
+		"\x08\x00\x09LevelName\x00\x05world" +
+		"\x00" + // End of Data.
+		"\x00") // End of root.
+
+	root := roundTrip(t, serialized)
+
+	if seed, ok := root.Lookup("Data/RandomSeed").(*Long); !ok || seed.Value != -2 {
+		t.Errorf("Bad RandomSeed: %#v", root.Lookup("Data/RandomSeed"))
+	}
+}
+
+func Test_RoundTripChunk(t *testing.T) {
+	blocks := bytes.Repeat([]byte{1, 2, 3, 4}, 8)
+
+	serialized := []byte("" +
+		"\x0a\x00\x00" +
+		"\x0a\x00\x05Level" +
+		"\x07\x00\x04Data\x00\x00\x00\x00" +
+		// Empty lists as written by the official server, with TagByte as the
+		// element type.
+		"\x09\x00\x08Entities\x01\x00\x00\x00\x00" +
+		"\x04\x00\x0aLastUpdate\x00\x00\x00\x00\x00\x00\x01\x00" +
+		"\x03\x00\x04xPos\xff\xff\xff\xff" +
+		"\x03\x00\x04zPos\x00\x00\x00\x02" +
+		"\x09\x00\x0cTileEntities\x0a\x00\x00\x00\x01" +
+		"\x08\x00\x02id\x00\x05Chest" +
+		"\x09\x00\x05Items\x00\x00\x00\x00\x00" + // Empty list of TagEnd.
+		"\x03\x00\x01x\xff\xff\xff\xf1" +
+		"\x00" + // End of tile entity.
+		"\x01\x00\x10TerrainPopulated\x01" +
+		"\x07\x00\x06Blocks\x00\x00\x00\x20" + string(blocks) +
+		"\x00" + // End of Level.
+		"\x00") // End of root.
+
+	root := roundTrip(t, serialized)
+
+	if items, ok := root.Lookup("Level/Entities").(*List); !ok || items.TagType != TagByte {
+		t.Errorf("Bad Entities: %#v", root.Lookup("Level/Entities"))
+	}
+}
+
+func Test_WriteAfterSet(t *testing.T) {
+	compound := &Compound{
+		Tags: map[string]ITag{
+			"b": &Byte{2},
+			"a": &Byte{1},
+		},
+	}
+	compound.Set("c", &Byte{3})
+	compound.Set("a", &Byte{4})
+
+	writer := new(bytes.Buffer)
+	if err := compound.Write(writer); err != nil {
+		t.Fatalf("Got Write error: %v", err)
+	}
+
+	// Tags added with Set come first in the order added, followed by the
+	// remaining tags in sorted order.
+	expected := []byte("" +
+		"\x01\x00\x01c\x03" +
+		"\x01\x00\x01a\x04" +
+		"\x01\x00\x01b\x02" +
+		"\x00")
+	if !bytes.Equal(expected, writer.Bytes()) {
+		t.Errorf("Expected %x, got %x", expected, writer.Bytes())
+	}
+}
+
+func Test_WriteErrors(t *testing.T) {
+	tests := []ITag{
+		&List{TagByte, []ITag{&Byte{1}, &Short{2}}},
+		&String{string(make([]byte, 0x10000))},
+	}
+
+	for _, tag := range tests {
+		if err := tag.Write(new(bytes.Buffer)); err == nil {
+			t.Errorf("Expected error writing %T", tag)
+		}
+	}
+}
+
+func Test_ReadErrors(t *testing.T) {
+	tests := []struct {
+		serialized string
+		tag        ITag
+	}{
+		{"\xff\xff\xff\xff", &ByteArray{}},
+		{"\x01\xff\xff\xff\xff", &List{}},
+		{"\x01\x00", &Compound{}},
+	}
+
+	for _, test := range tests {
+		if err := test.tag.Read(bytes.NewBufferString(test.serialized)); err == nil {
+			t.Errorf("Expected error reading %T from %x", test.tag, test.serialized)
+		}
+	}
+}
+
+func Test_AnvilChunkHeightMap(t *testing.T) {
+	// The start of an Anvil format chunk, as far as the height map. This is
+	// hand-built following the layout of chunks written by the official
+	// server.
+	heightMap := new(bytes.Buffer)
+	heightMap.WriteString("\x00\x00\x01\x00") // 256 ints.
+	for i := 0; i < 256; i++ {
+		heightMap.Write([]byte{0, 0, 0, byte(i % 128)})
+	}
+
+	serialized := []byte("" +
+		"\x0a\x00\x00" +
+		"\x0a\x00\x05Level" +
+		"\x03\x00\x04xPos\x00\x00\x00\x01" +
+		"\x03\x00\x04zPos\xff\xff\xff\xfc" +
+		"\x04\x00\x0aLastUpdate\x00\x00\x00\x00\x00\x00\x12\x34" +
+		"\x01\x00\x10TerrainPopulated\x01" +
+		"\x0b\x00\x09HeightMap" + heightMap.String() +
+		"\x09\x00\x08Sections\x0a\x00\x00\x00\x00" +
+		"\x00" + // End of Level.
+		"\x00") // End of root.
+
+	root := roundTrip(t, serialized)
+
+	heights, ok := GetIntArray(root, "Level/HeightMap")
+	if !ok || len(heights) != 256 {
+		t.Fatalf("Bad HeightMap: %#v", root.Lookup("Level/HeightMap"))
+	}
+	if heights[255] != 255%128 {
+		t.Errorf("Expected HeightMap[255] == %d, got %d", 255%128, heights[255])
+	}
+}
@@ -0,0 +1,108 @@
+package nbt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// splitPath splits a path as used by Lookup into its components. A leading
+// "/" is ignored.
+func splitPath(path string) (components []string, err error) {
+	components = strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for _, component := range components {
+		if component == "" {
+			return nil, fmt.Errorf("nbt: empty component in path %q", path)
+		}
+	}
+	return
+}
+
+// walkPath returns the compound containing the last component of the path,
+// and the name of the last component. If create is true, missing
+// intermediate compounds are created, otherwise parent is nil if any are
+// missing.
+func (c *Compound) walkPath(path string, create bool) (parent *Compound, name string, err error) {
+	components, err := splitPath(path)
+	if err != nil {
+		return
+	}
+
+	parent = c
+	for i, component := range components[:len(components)-1] {
+		child, exists := parent.Tags[component]
+		if !exists {
+			if !create {
+				return nil, "", nil
+			}
+			child = NewCompound()
+			parent.setChild(component, child)
+		}
+
+		var ok bool
+		if parent, ok = child.(*Compound); !ok {
+			return nil, "", &PathError{strings.Join(components[:i+1], "/"), TagCompound, child}
+		}
+	}
+
+	return parent, components[len(components)-1], nil
+}
+
+// Set sets the tag at the given path (as used by Lookup), creating any
+// missing intermediate compounds. A *PathError is returned if an
+// intermediate tag exists but is not a compound.
+func (c *Compound) Set(path string, tag ITag) (err error) {
+	parent, name, err := c.walkPath(path, true)
+	if err != nil {
+		return
+	}
+
+	parent.setChild(name, tag)
+	return nil
+}
+
+// Delete removes the tag at the given path, if it exists. A *PathError is
+// returned if an intermediate tag exists but is not a compound.
+func (c *Compound) Delete(path string) (err error) {
+	parent, name, err := c.walkPath(path, false)
+	if err != nil || parent == nil {
+		return
+	}
+
+	if _, exists := parent.Tags[name]; !exists {
+		return nil
+	}
+
+	delete(parent.Tags, name)
+	for i, orderName := range parent.order {
+		if orderName == name {
+			parent.order = append(parent.order[:i], parent.order[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+// CreatePath returns the compound at the given path, creating it and any
+// missing intermediate compounds. A *PathError is returned if a tag on the
+// path exists but is not a compound.
+func (c *Compound) CreatePath(path string) (compound *Compound, err error) {
+	parent, name, err := c.walkPath(path, true)
+	if err != nil {
+		return
+	}
+
+	tag, exists := parent.Tags[name]
+	if !exists {
+		compound = NewCompound()
+		parent.setChild(name, compound)
+		return compound, nil
+	}
+
+	var ok bool
+	if compound, ok = tag.(*Compound); !ok {
+		return nil, &PathError{strings.TrimPrefix(path, "/"), TagCompound, tag}
+	}
+
+	return compound, nil
+}
@@ -0,0 +1,107 @@
+package nbt
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_CompoundSet(t *testing.T) {
+	root := NewCompound()
+
+	if err := root.Set("Data/Player/Health", &Short{20}); err != nil {
+		t.Fatalf("Set error: %v", err)
+	}
+	if err := root.Set("/Data/Time", &Long{100}); err != nil {
+		t.Fatalf("Set error: %v", err)
+	}
+	if err := root.Set("Data/Time", &Long{200}); err != nil {
+		t.Fatalf("Set error: %v", err)
+	}
+
+	if v, ok := GetShort(root, "Data/Player/Health"); !ok || v != 20 {
+		t.Errorf("Expected Health 20, got %d (%t)", v, ok)
+	}
+	if v, ok := GetLong(root, "Data/Time"); !ok || v != 200 {
+		t.Errorf("Expected Time 200, got %d (%t)", v, ok)
+	}
+
+	// Replacing a tag keeps its position.
+	expected, _ := NewBuilder().
+		PutCompound("Data", NewBuilder().
+			PutCompound("Player", NewBuilder().
+				PutShort("Health", 20)).
+			PutLong("Time", 200)).
+		Build()
+	expectedBuf, resultBuf := new(bytes.Buffer), new(bytes.Buffer)
+	Write(expectedBuf, expected)
+	Write(resultBuf, root)
+	if !bytes.Equal(expectedBuf.Bytes(), resultBuf.Bytes()) {
+		t.Errorf("Written data differs from expected")
+	}
+}
+
+func Test_CompoundPathErrors(t *testing.T) {
+	root, _ := NewBuilder().
+		PutCompound("Data", NewBuilder().
+			PutLong("Time", 0)).
+		Build()
+
+	if err := root.Set("Data/Time/Day", &Int{1}); err == nil {
+		t.Errorf("Expected error setting beneath a Long")
+	} else if pathErr, ok := err.(*PathError); !ok || pathErr.Path != "Data/Time" {
+		t.Errorf("Expected PathError for Data/Time, got %v", err)
+	}
+	if _, err := root.CreatePath("Data/Time"); err == nil {
+		t.Errorf("Expected error creating path over a Long")
+	}
+	if err := root.Delete("Data/Time/Day"); err == nil {
+		t.Errorf("Expected error deleting beneath a Long")
+	}
+	if err := root.Set("Data//Time", &Int{1}); err == nil {
+		t.Errorf("Expected error for empty path component")
+	}
+}
+
+func Test_CompoundDelete(t *testing.T) {
+	root, _ := NewBuilder().
+		PutCompound("Data", NewBuilder().
+			PutLong("Time", 0).
+			PutInt("SpawnX", 1)).
+		Build()
+
+	if err := root.Delete("Data/Time"); err != nil {
+		t.Fatalf("Delete error: %v", err)
+	}
+	if tag := root.Lookup("Data/Time"); tag != nil {
+		t.Errorf("Expected Data/Time to be deleted, got %v", tag)
+	}
+	if names := root.Lookup("Data").(*Compound).names(); len(names) != 1 || names[0] != "SpawnX" {
+		t.Errorf("Expected only SpawnX to remain, got %v", names)
+	}
+
+	// Missing paths are not an error.
+	if err := root.Delete("Data/Time"); err != nil {
+		t.Errorf("Delete of missing tag error: %v", err)
+	}
+	if err := root.Delete("Nope/Time"); err != nil {
+		t.Errorf("Delete of missing parent error: %v", err)
+	}
+}
+
+func Test_CompoundCreatePath(t *testing.T) {
+	root := NewCompound()
+
+	created, err := root.CreatePath("Data/Player")
+	if err != nil {
+		t.Fatalf("CreatePath error: %v", err)
+	}
+	created.Set("Score", &Int{5})
+
+	again, err := root.CreatePath("Data/Player")
+	if err != nil || again != created {
+		t.Errorf("Expected existing compound from CreatePath, got %v, %v", again, err)
+	}
+	if v, ok := GetInt(root, "Data/Player/Score"); !ok || v != 5 {
+		t.Errorf("Expected Score 5, got %d (%t)", v, ok)
+	}
+}
@@ -0,0 +1,409 @@
+package nbt
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Stringified NBT (SNBT) is a human readable text form of NBT, for example:
+//
+//   {Data:{SpawnX:0,SpawnY:64,Time:24000L,LevelName:"world"}}
+//
+// Numeric tags other than Int carry a type suffix: b (Byte), s (Short),
+// L (Long), f (Float) and d (Double). Strings are always quoted by
+// FormatSnbt, but ParseSnbt also accepts unquoted strings and single quotes.
+// Lists are written as [a,b], ByteArrays as [B;1b,2b] and IntArrays as
+// [I;1,2].
+//
+// The element type of an empty list is not represented, so an empty list is
+// parsed as a List of TagEnd.
+
+// FormatSnbt returns the SNBT representation of tag.
+func FormatSnbt(tag ITag) string {
+	buf := new(bytes.Buffer)
+	formatSnbt(buf, tag)
+	return buf.String()
+}
+
+func formatSnbt(buf *bytes.Buffer, tag ITag) {
+	switch t := tag.(type) {
+	case *Byte:
+		fmt.Fprintf(buf, "%db", t.Value)
+	case *Short:
+		fmt.Fprintf(buf, "%ds", t.Value)
+	case *Int:
+		fmt.Fprintf(buf, "%d", t.Value)
+	case *Long:
+		fmt.Fprintf(buf, "%dL", t.Value)
+	case *Float:
+		buf.WriteString(strconv.FormatFloat(float64(t.Value), 'g', -1, 32))
+		buf.WriteByte('f')
+	case *Double:
+		buf.WriteString(strconv.FormatFloat(t.Value, 'g', -1, 64))
+		buf.WriteByte('d')
+	case *ByteArray:
+		buf.WriteString("[B;")
+		for i, v := range t.Value {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(buf, "%db", int8(v))
+		}
+		buf.WriteByte(']')
+	case *IntArray:
+		buf.WriteString("[I;")
+		for i, v := range t.Value {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(buf, "%d", v)
+		}
+		buf.WriteByte(']')
+	case *String:
+		formatSnbtString(buf, t.Value)
+	case *List:
+		buf.WriteByte('[')
+		for i, v := range t.Value {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			formatSnbt(buf, v)
+		}
+		buf.WriteByte(']')
+	case *Compound:
+		buf.WriteByte('{')
+		for i, name := range t.names() {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if isSnbtBare(name) {
+				buf.WriteString(name)
+			} else {
+				formatSnbtString(buf, name)
+			}
+			buf.WriteByte(':')
+			formatSnbt(buf, t.Tags[name])
+		}
+		buf.WriteByte('}')
+	default:
+		fmt.Fprintf(buf, "<%T>", tag)
+	}
+}
+
+func formatSnbtString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' {
+			buf.WriteByte('\\')
+		}
+		buf.WriteByte(s[i])
+	}
+	buf.WriteByte('"')
+}
+
+func isSnbtBareChar(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') ||
+		c == '_' || c == '-' || c == '.' || c == '+'
+}
+
+func isSnbtBare(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isSnbtBareChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseSnbt parses the SNBT representation of a tag.
+func ParseSnbt(text string) (tag ITag, err error) {
+	p := &snbtParser{text: text}
+
+	if tag, err = p.parseValue(); err != nil {
+		return nil, err
+	}
+
+	p.skipSpace()
+	if p.pos < len(p.text) {
+		return nil, p.errorf("unexpected trailing text")
+	}
+
+	return tag, nil
+}
+
+type snbtParser struct {
+	text string
+	pos  int
+}
+
+func (p *snbtParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("snbt: %s at offset %d", fmt.Sprintf(format, args...), p.pos)
+}
+
+func (p *snbtParser) skipSpace() {
+	for p.pos < len(p.text) && strings.IndexByte(" \t\r\n", p.text[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+// peek returns the next non-space character, or 0 at the end of the text.
+func (p *snbtParser) peek() byte {
+	p.skipSpace()
+	if p.pos >= len(p.text) {
+		return 0
+	}
+	return p.text[p.pos]
+}
+
+func (p *snbtParser) expect(c byte) error {
+	if p.peek() != c {
+		return p.errorf("expected %q", c)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *snbtParser) parseValue() (tag ITag, err error) {
+	switch c := p.peek(); c {
+	case '{':
+		return p.parseCompound()
+	case '[':
+		return p.parseList()
+	case '"', '\'':
+		var s string
+		if s, err = p.parseQuoted(); err != nil {
+			return
+		}
+		return &String{s}, nil
+	case 0:
+		return nil, p.errorf("unexpected end of text")
+	}
+
+	word := p.parseBare()
+	if word == "" {
+		return nil, p.errorf("unexpected character %q", p.text[p.pos])
+	}
+	return parseSnbtScalar(word), nil
+}
+
+func (p *snbtParser) parseBare() string {
+	start := p.pos
+	for p.pos < len(p.text) && isSnbtBareChar(p.text[p.pos]) {
+		p.pos++
+	}
+	return p.text[start:p.pos]
+}
+
+func (p *snbtParser) parseQuoted() (s string, err error) {
+	quote := p.text[p.pos]
+	p.pos++
+
+	buf := new(bytes.Buffer)
+	for p.pos < len(p.text) {
+		c := p.text[p.pos]
+		p.pos++
+		switch {
+		case c == quote:
+			return buf.String(), nil
+		case c == '\\':
+			if p.pos >= len(p.text) {
+				return "", p.errorf("unterminated escape")
+			}
+			buf.WriteByte(p.text[p.pos])
+			p.pos++
+		default:
+			buf.WriteByte(c)
+		}
+	}
+
+	return "", p.errorf("unterminated string")
+}
+
+// parseSnbtScalar interprets a bare word as a number if it has the form of
+// one, and otherwise as an unquoted string.
+func parseSnbtScalar(word string) ITag {
+	last := word[len(word)-1]
+	body := word[:len(word)-1]
+
+	switch last {
+	case 'b', 'B':
+		if v, err := strconv.ParseInt(body, 10, 8); err == nil {
+			return &Byte{int8(v)}
+		}
+	case 's', 'S':
+		if v, err := strconv.ParseInt(body, 10, 16); err == nil {
+			return &Short{int16(v)}
+		}
+	case 'l', 'L':
+		if v, err := strconv.ParseInt(body, 10, 64); err == nil {
+			return &Long{v}
+		}
+	case 'f', 'F':
+		if v, err := strconv.ParseFloat(body, 32); err == nil {
+			return &Float{float32(v)}
+		}
+	case 'd', 'D':
+		if v, err := strconv.ParseFloat(body, 64); err == nil {
+			return &Double{v}
+		}
+	}
+
+	if v, err := strconv.ParseInt(word, 10, 32); err == nil {
+		return &Int{int32(v)}
+	}
+	if strings.ContainsAny(word, ".eE") {
+		if v, err := strconv.ParseFloat(word, 64); err == nil {
+			return &Double{v}
+		}
+	}
+
+	return &String{word}
+}
+
+func (p *snbtParser) parseCompound() (tag ITag, err error) {
+	p.pos++ // '{'
+	compound := NewCompound()
+
+	if p.peek() == '}' {
+		p.pos++
+		return compound, nil
+	}
+
+	for {
+		var name string
+		switch p.peek() {
+		case '"', '\'':
+			if name, err = p.parseQuoted(); err != nil {
+				return
+			}
+		default:
+			if name = p.parseBare(); name == "" {
+				return nil, p.errorf("expected tag name")
+			}
+		}
+
+		if err = p.expect(':'); err != nil {
+			return
+		}
+
+		var value ITag
+		if value, err = p.parseValue(); err != nil {
+			return
+		}
+		compound.setChild(name, value)
+
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			return compound, nil
+		default:
+			return nil, p.errorf("expected ',' or '}'")
+		}
+	}
+}
+
+func (p *snbtParser) parseList() (tag ITag, err error) {
+	p.pos++ // '['
+
+	// Check for an array type prefix.
+	if p.pos+1 < len(p.text) && p.text[p.pos+1] == ';' {
+		switch p.text[p.pos] {
+		case 'B':
+			p.pos += 2
+			return p.parseByteArray()
+		case 'I':
+			p.pos += 2
+			return p.parseIntArray()
+		}
+	}
+
+	values, err := p.parseElements()
+	if err != nil {
+		return
+	}
+
+	list := &List{TagEnd, values}
+	if len(values) > 0 {
+		list.TagType = values[0].Type()
+	}
+	if err = checkSnbtElements(values, list.TagType); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// parseElements parses comma separated values up to and including the
+// closing ']'.
+func (p *snbtParser) parseElements() (values []ITag, err error) {
+	values = []ITag{}
+	if p.peek() == ']' {
+		p.pos++
+		return
+	}
+
+	for {
+		var value ITag
+		if value, err = p.parseValue(); err != nil {
+			return
+		}
+		values = append(values, value)
+
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+			p.pos++
+			return
+		default:
+			return nil, p.errorf("expected ',' or ']'")
+		}
+	}
+}
+
+func checkSnbtElements(values []ITag, tagType TagType) error {
+	for _, v := range values {
+		if v.Type() != tagType {
+			return fmt.Errorf("snbt: %v found among elements of %v", v.Type(), tagType)
+		}
+	}
+	return nil
+}
+
+func (p *snbtParser) parseByteArray() (tag ITag, err error) {
+	values, err := p.parseElements()
+	if err != nil {
+		return
+	}
+	if err = checkSnbtElements(values, TagByte); err != nil {
+		return nil, err
+	}
+
+	array := &ByteArray{make([]byte, len(values))}
+	for i, v := range values {
+		array.Value[i] = byte(v.(*Byte).Value)
+	}
+	return array, nil
+}
+
+func (p *snbtParser) parseIntArray() (tag ITag, err error) {
+	values, err := p.parseElements()
+	if err != nil {
+		return
+	}
+	if err = checkSnbtElements(values, TagInt); err != nil {
+		return nil, err
+	}
+
+	array := &IntArray{make([]int32, len(values))}
+	for i, v := range values {
+		array.Value[i] = v.(*Int).Value
+	}
+	return array, nil
+}
@@ -0,0 +1,178 @@
+package nbt
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func Test_FormatSnbt(t *testing.T) {
+	root := NewCompound()
+	data := NewCompound()
+	root.Set("Data", data)
+	data.Set("SpawnX", &Int{0})
+	data.Set("Time", &Long{24000})
+	data.Set("raining", &Byte{-1})
+	data.Set("Air", &Short{300})
+	data.Set("Speed", &Float{0.5})
+	data.Set("Pos", &List{TagDouble, []ITag{&Double{1.5}, &Double{-2}}})
+	data.Set("LevelName", &String{`my "world" \o/`})
+	data.Set("odd name", &ByteArray{[]byte{1, 0xff}})
+	data.Set("HeightMap", &IntArray{[]int32{64, -1}})
+	data.Set("Empty", &List{TagEnd, []ITag{}})
+
+	expected := `{Data:{SpawnX:0,Time:24000L,raining:-1b,Air:300s,Speed:0.5f,` +
+		`Pos:[1.5d,-2d],LevelName:"my \"world\" \\o/","odd name":[B;1b,-1b],` +
+		`HeightMap:[I;64,-1],Empty:[]}}`
+
+	if result := FormatSnbt(root); result != expected {
+		t.Errorf("Expected:\n  %s\ngot:\n  %s", expected, result)
+	}
+}
+
+func Test_ParseSnbt(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected ITag
+	}{
+		{"1b", &Byte{1}},
+		{"-3S", &Short{-3}},
+		{" 42 ", &Int{42}},
+		{"42l", &Long{42}},
+		{"1.25F", &Float{1.25}},
+		{"1.25", &Double{1.25}},
+		{"1e3d", &Double{1000}},
+		{"stone", &String{"stone"}},
+		{`'single "quoted"'`, &String{`single "quoted"`}},
+		{"[ ]", &List{TagEnd, []ITag{}}},
+		{"[1s, 2s]", &List{TagShort, []ITag{&Short{1}, &Short{2}}}},
+		{"[B;]", &ByteArray{[]byte{}}},
+		{"[I; 1, 2]", &IntArray{[]int32{1, 2}}},
+		{"{}", NewCompound()},
+	}
+
+	for _, test := range tests {
+		result, err := ParseSnbt(test.text)
+		if err != nil {
+			t.Errorf("Error parsing %q: %v", test.text, err)
+			continue
+		}
+		if !reflect.DeepEqual(test.expected, result) {
+			t.Errorf("Parsing %q: expected %#v, got %#v", test.text, test.expected, result)
+		}
+	}
+}
+
+func Test_ParseSnbtErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"{",
+		"{a:1",
+		"{a 1}",
+		"{:1}",
+		"[1b,2s]",
+		"[B;1,2]",
+		"[I;1b]",
+		`"unterminated`,
+		"1b 2b",
+		"}",
+		"minecraft:stone", // Colons are not valid in unquoted strings.
+	}
+
+	for _, text := range tests {
+		if tag, err := ParseSnbt(text); err == nil {
+			t.Errorf("Expected error parsing %q, got %#v", text, tag)
+		}
+	}
+}
+
+// randomTag creates a random tag tree for property tests. NaN is never
+// generated, as it does not compare equal to itself.
+func randomTag(rng *rand.Rand, depth int) ITag {
+	maxType := 12
+	if depth <= 0 {
+		// No nested lists or compounds.
+		maxType = 9
+	}
+
+	switch rng.Intn(maxType) {
+	case 0:
+		return &Byte{int8(rng.Int())}
+	case 1:
+		return &Short{int16(rng.Int())}
+	case 2:
+		return &Int{int32(rng.Int())}
+	case 3:
+		return &Long{rng.Int63() - rng.Int63()}
+	case 4:
+		return &Float{float32(rng.NormFloat64() * 1e3)}
+	case 5:
+		return &Double{rng.NormFloat64() * 1e10}
+	case 6:
+		v := make([]byte, rng.Intn(5))
+		for i := range v {
+			v[i] = byte(rng.Int())
+		}
+		return &ByteArray{v}
+	case 7:
+		v := make([]int32, rng.Intn(5))
+		for i := range v {
+			v[i] = int32(rng.Int())
+		}
+		return &IntArray{v}
+	case 8:
+		return &String{randomString(rng)}
+	case 9, 10:
+		elem := randomTag(rng, depth-1)
+		list := &List{elem.Type(), []ITag{elem}}
+		for n := rng.Intn(3); n > 0; n-- {
+			// Generate until the type matches.
+			for {
+				if elem = randomTag(rng, depth-1); elem.Type() == list.TagType {
+					break
+				}
+			}
+			list.Value = append(list.Value, elem)
+		}
+		return list
+	}
+
+	compound := NewCompound()
+	for n := rng.Intn(4); n > 0; n-- {
+		compound.Set(randomString(rng), randomTag(rng, depth-1))
+	}
+	return compound
+}
+
+func randomString(rng *rand.Rand) string {
+	const chars = `abcXYZ019_-.+ :,"'\{}[]` + "\u00e9"
+	runes := []rune(chars)
+	s := make([]rune, rng.Intn(8))
+	for i := range s {
+		s[i] = runes[rng.Intn(len(runes))]
+	}
+	return string(s)
+}
+
+func Test_SnbtRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 500; i++ {
+		tag := randomTag(rng, 3)
+		text := FormatSnbt(tag)
+
+		// Tree -> text -> tree.
+		result, err := ParseSnbt(text)
+		if err != nil {
+			t.Fatalf("Error parsing %q: %v", text, err)
+		}
+		if !reflect.DeepEqual(tag, result) {
+			t.Fatalf("Round trip of %q:\n  expected %#v\n  got %#v", text, tag, result)
+		}
+
+		// Text -> tree -> text.
+		if resultText := FormatSnbt(result); resultText != text {
+			t.Fatalf("Round trip of text:\n  expected %q\n  got %q", text, resultText)
+		}
+	}
+}
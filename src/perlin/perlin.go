@@ -14,6 +14,7 @@ type PerlinNoise struct {
 	seed   int64
 	permut [256]int
 	g2d    [256][2]float64 // Randomly generated 2D unit vectors.
+	g3d    [256][3]float64 // Randomly generated 3D unit vectors.
 }
 
 func NewPerlinNoise(seed int64) *PerlinNoise {
@@ -41,6 +42,13 @@ func NewPerlinNoise(seed int64) *PerlinNoise {
 		normVector(gen.g2d[i][:])
 	}
 
+	// Initialize gen.g3d.
+	source.Seed(seed)
+	for i := range perm {
+		randVector(gen.g3d[i][:], rnd)
+		normVector(gen.g3d[i][:])
+	}
+
 	return gen
 }
 
@@ -82,6 +90,55 @@ func (gen *PerlinNoise) At2d(x, y float64) float64 {
 	return a + sy*(b-a)
 }
 
+func (gen *PerlinNoise) grad3d(x, y, z int) *[3]float64 {
+	gradIndex := x&0xff + gen.permut[(y+gen.permut[z&0xff])&0xff]
+	return &gen.g3d[gradIndex&0xff]
+}
+
+// dot3d returns grad · ((x,y,z) - (x0,y0,z0)) for the gradient at the given
+// lattice point.
+func (gen *PerlinNoise) dot3d(x0, y0, z0, x, y, z float64) float64 {
+	grad := gen.grad3d(int(x0), int(y0), int(z0))
+	return grad[0]*(x-x0) + grad[1]*(y-y0) + grad[2]*(z-z0)
+}
+
+// At3d returns the noise value at a given 3D point.
+func (gen *PerlinNoise) At3d(x, y, z float64) float64 {
+	x0 := floor(x)
+	y0 := floor(y)
+	z0 := floor(z)
+	x1 := x0 + 1
+	y1 := y0 + 1
+	z1 := z0 + 1
+
+	dx := x - x0
+	sx := 3*dx*dx - 2*dx*dx*dx
+	dy := y - y0
+	sy := 3*dy*dy - 2*dy*dy*dy
+	dz := z - z0
+	sz := 3*dz*dz - 2*dz*dz*dz
+
+	// Trilinear interpolation of the eight corners, using the same "ease"
+	// function as At2d.
+	a := gen.dot3d(x0, y0, z0, x, y, z)
+	b := gen.dot3d(x1, y0, z0, x, y, z)
+	c := gen.dot3d(x0, y1, z0, x, y, z)
+	d := gen.dot3d(x1, y1, z0, x, y, z)
+	lower0 := a + sx*(b-a)
+	lower1 := c + sx*(d-c)
+	lower := lower0 + sy*(lower1-lower0)
+
+	a = gen.dot3d(x0, y0, z1, x, y, z)
+	b = gen.dot3d(x1, y0, z1, x, y, z)
+	c = gen.dot3d(x0, y1, z1, x, y, z)
+	d = gen.dot3d(x1, y1, z1, x, y, z)
+	upper0 := a + sx*(b-a)
+	upper1 := c + sx*(d-c)
+	upper := upper0 + sy*(upper1-upper0)
+
+	return lower + sz*(upper-lower)
+}
+
 func (gen *PerlinNoise) MeanMagnitude() float64 {
 	return 0.5
 }
@@ -12,3 +12,33 @@ func Benchmark_Perlin_At2d(b *testing.B) {
 		n.At2d(0, 0)
 	}
 }
+
+func Benchmark_Perlin_At3d(b *testing.B) {
+	n := NewPerlinNoise(0)
+	b.ResetTimer()
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		n.At3d(0, 0, 0)
+	}
+}
+
+func TestPerlin_At3d(t *testing.T) {
+	a := NewPerlinNoise(1)
+	b := NewPerlinNoise(1)
+
+	for i := 0; i < 100; i++ {
+		x, y, z := float64(i)*0.37, float64(i)*-1.13, float64(i)*2.71
+		v := a.At3d(x, y, z)
+		if v != b.At3d(x, y, z) {
+			t.Fatalf("At3d(%v, %v, %v) differs for the same seed", x, y, z)
+		}
+		if v < -1.5 || v > 1.5 {
+			t.Errorf("At3d(%v, %v, %v) = %v, out of range", x, y, z, v)
+		}
+	}
+
+	// Noise is zero at lattice points.
+	if v := a.At3d(3, -4, 5); v != 0 {
+		t.Errorf("At3d at lattice point = %v, want 0", v)
+	}
+}